@@ -0,0 +1,205 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"adotkaya.playground/internal/models"
+)
+
+// =============================================================================
+// Page Analytics
+// =============================================================================
+// Pages tell the server they were viewed by posting to /beacon from
+// main.js, so views served from the page cache are counted too and
+// crawlers that don't run scripts aren't. The beacon carries the page's
+// route pattern, never its address, and the referrer, which is only
+// classed. It sets no cookies and skips the session, and visitors asking
+// not to be tracked (DNT or Sec-GPC) aren't counted. ANALYTICS_ENABLED=false
+// turns it off. Anyone can post to it, so bodies are kept small and each
+// client address gets beaconsPerMinute posts a minute.
+
+const (
+	// analyticsDays is the number of days the admin dashboard covers
+	analyticsDays = 30
+
+	// maxBeaconSize is the largest beacon body accepted, in bytes
+	maxBeaconSize = 4 << 10
+
+	// beaconsPerMinute is how many beacons a client address may post a
+	// minute
+	beaconsPerMinute = 60
+)
+
+// searchDomains and socialDomains are the sites whose links are counted as
+// coming from a search engine or a social network. Subdomains count too.
+var (
+	searchDomains = []string{
+		"google.com", "bing.com", "duckduckgo.com", "search.yahoo.com", "yandex.com", "yandex.ru",
+		"baidu.com", "ecosia.org", "startpage.com", "search.brave.com", "kagi.com", "qwant.com",
+	}
+	socialDomains = []string{
+		"facebook.com", "twitter.com", "x.com", "t.co", "reddit.com", "linkedin.com",
+		"news.ycombinator.com", "lobste.rs", "mastodon.social", "bsky.app", "threads.net", "youtube.com",
+	}
+)
+
+// beacon counts a view of the page in the posted form's page field, which
+// must be the pattern of a page of the site
+func (app *application) beacon(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	page := r.PostForm.Get("page")
+	if _, ok := routePolicies[http.MethodGet+" "+page]; !ok {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if r.Header.Get("DNT") == "1" || r.Header.Get("Sec-GPC") == "1" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	referrer := classifyReferrer(r.PostForm.Get("referrer"), app.siteHost(r))
+	if err := app.analytics.Record(r.Context(), page, referrer); err != nil {
+		app.serverError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// limitBeacons refuses beacons over the client address's rate limit with
+// 429 Too Many Requests
+func (app *application) limitBeacons(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ok, retry := app.quotas.allowBeacon(app.visitor(r)); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+			app.clientError(w, http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// siteHost returns the host name of the site, from BASE_URL if set or the
+// request otherwise
+func (app *application) siteHost(r *http.Request) string {
+	if u, err := url.Parse(app.config.Server.BaseURL); err == nil && u.Host != "" {
+		return u.Hostname()
+	}
+	host := r.Host
+	if u, err := url.Parse("//" + host); err == nil {
+		host = u.Hostname()
+	}
+	return host
+}
+
+// classifyReferrer returns the class of the referrer URL for a page of the
+// site at host
+func classifyReferrer(referrer, host string) string {
+	if referrer == "" {
+		return models.ReferrerDirect
+	}
+	u, err := url.Parse(referrer)
+	if err != nil || u.Hostname() == "" {
+		return models.ReferrerOther
+	}
+
+	from := strings.ToLower(u.Hostname())
+	switch {
+	case strings.EqualFold(from, host):
+		return models.ReferrerInternal
+	// Google searches from every country's domain
+	case inDomains(from, searchDomains) || strings.HasPrefix(from, "google.") || strings.Contains(from, ".google."):
+		return models.ReferrerSearch
+	case inDomains(from, socialDomains):
+		return models.ReferrerSocial
+	default:
+		return models.ReferrerOther
+	}
+}
+
+// inDomains reports whether host is one of domains or a subdomain of one
+func inDomains(host string, domains []string) bool {
+	for _, d := range domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// pageForBeacon returns the route pattern pages served for r report to the
+// beacon, or "" if they shouldn't report one: when analytics is off, and
+// for error pages, which aren't pages of the site
+func (app *application) pageForBeacon(r *http.Request) string {
+	if !app.config.Analytics.Enabled || r.Method != http.MethodGet {
+		return ""
+	}
+	page := routeFromContext(r.Context())
+	if _, ok := routePolicies[http.MethodGet+" "+page]; !ok {
+		return ""
+	}
+	return page
+}
+
+// =============================================================================
+// Admin Dashboard
+// =============================================================================
+
+// analyticsReport is what the admin dashboard shows, drawn as bars like the
+// public statistics
+type analyticsReport struct {
+	Days      int
+	Page      string     // Page whose daily views are shown; empty for all
+	Pages     []statsBar // Views per page, most viewed first
+	Daily     []statsBar // Views per day, oldest first
+	Referrers []statsBar // Views per class of referrer, labelled with the class
+}
+
+// adminAnalytics shows the page views of the last analyticsDays days, with
+// the daily views of the page in the page query parameter, or of every
+// page without one
+func (app *application) adminAnalytics(w http.ResponseWriter, r *http.Request) {
+	report := &analyticsReport{Days: analyticsDays, Page: r.URL.Query().Get("page")}
+
+	pages, err := app.analytics.Pages(analyticsDays)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	daily, err := app.analytics.Daily(analyticsDays, report.Page)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	referrers, err := app.analytics.Referrers(analyticsDays)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	for _, p := range pages {
+		report.Pages = append(report.Pages, statsBar{Label: p.Page, Count: p.Views})
+	}
+	for _, d := range daily {
+		report.Daily = append(report.Daily, statsBar{Label: d.Day.Format(time.DateOnly), Count: d.Views})
+	}
+	for _, ref := range referrers {
+		report.Referrers = append(report.Referrers, statsBar{Label: ref.Referrer, Count: ref.Views})
+	}
+	scaleBars(report.Pages)
+	scaleBars(report.Daily)
+	scaleBars(report.Referrers)
+
+	data := app.newTemplateData(r)
+	data.Analytics = report
+	data.Breadcrumbs = app.breadcrumbs(r, Crumb{Label: app.translate(r, "admin_analytics.title")})
+	app.render(w, http.StatusOK, "admin_analytics.tmpl", data)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/models/mocks"
+	"adotkaya.playground/internal/testutil"
+)
+
+// recordingAnalytics records the page views counted
+type recordingAnalytics struct {
+	mocks.AnalyticsModel
+	views []string
+}
+
+func (m *recordingAnalytics) Record(ctx context.Context, page, referrer string) error {
+	m.views = append(m.views, page+" "+referrer)
+	return nil
+}
+
+func TestClassifyReferrer(t *testing.T) {
+	tests := []struct {
+		referrer string
+		want     string
+	}{
+		{"", models.ReferrerDirect},
+		{"https://snippetbox.example.com/snippet/view/1", models.ReferrerInternal},
+		{"https://www.google.com/", models.ReferrerSearch},
+		{"https://www.google.co.uk/", models.ReferrerSearch},
+		{"https://duckduckgo.com/", models.ReferrerSearch},
+		{"https://old.reddit.com/r/golang", models.ReferrerSocial},
+		{"https://t.co/abc", models.ReferrerSocial},
+		{"https://notreddit.com/", models.ReferrerOther},
+		{"https://blog.example.org/post", models.ReferrerOther},
+		{"not a url", models.ReferrerOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.referrer, func(t *testing.T) {
+			assert.Equal(t, classifyReferrer(tt.referrer, "snippetbox.example.com"), tt.want)
+		})
+	}
+}
+
+func TestBeacon(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.Analytics.Enabled = true
+	analytics := &recordingAnalytics{}
+	app.analytics = analytics
+	ts := testutil.NewServer(t, app.routes())
+
+	post := func(values url.Values, header ...string) testutil.Response {
+		req := ts.NewRequest(t, http.MethodPost, "/beacon", bytes.NewBufferString(values.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		return ts.Do(t, req)
+	}
+
+	rs := post(url.Values{"page": {"/snippet/view/:id"}, "referrer": {"https://www.bing.com/"}})
+	assert.Equal(t, rs.Status, http.StatusNoContent)
+	assert.Equal(t, rs.Header.Get("Set-Cookie"), "")
+
+	rs = post(url.Values{"page": {"/"}})
+	assert.Equal(t, rs.Status, http.StatusNoContent)
+
+	// Only pages of the site are counted
+	rs = post(url.Values{"page": {"/snippet/view/1"}})
+	assert.Equal(t, rs.Status, http.StatusBadRequest)
+	rs = post(url.Values{"page": {"/admin/logging/../../etc"}})
+	assert.Equal(t, rs.Status, http.StatusBadRequest)
+
+	// Visitors asking not to be tracked aren't counted
+	rs = post(url.Values{"page": {"/"}}, "DNT", "1")
+	assert.Equal(t, rs.Status, http.StatusNoContent)
+	rs = post(url.Values{"page": {"/"}}, "Sec-GPC", "1")
+	assert.Equal(t, rs.Status, http.StatusNoContent)
+
+	assert.DeepEqual(t, analytics.views, []string{"/snippet/view/:id search", "/ direct"})
+
+	// Bodies are kept small
+	rs = post(url.Values{"page": {"/"}, "referrer": {strings.Repeat("a", maxBeaconSize)}})
+	assert.Equal(t, rs.Status, http.StatusRequestEntityTooLarge)
+	assert.Equal(t, len(analytics.views), 2)
+
+	// Each address gets beaconsPerMinute beacons a minute
+	for range beaconsPerMinute - 6 {
+		rs = post(url.Values{"page": {"/"}})
+		assert.Equal(t, rs.Status, http.StatusNoContent)
+	}
+	rs = post(url.Values{"page": {"/"}})
+	assert.Equal(t, rs.Status, http.StatusTooManyRequests)
+	if rs.Header.Get("Retry-After") == "" {
+		t.Error("expected a Retry-After header")
+	}
+	assert.Equal(t, len(analytics.views), beaconsPerMinute-4)
+	analytics.views = analytics.views[:2]
+
+	// Pages carry their route pattern for the beacon
+	page := ts.Get(t, "/snippet/view/1")
+	assert.StringContains(t, page.Body, `<body data-page="/snippet/view/:id">`)
+	page = ts.Get(t, "/snippet/view/99")
+	assert.StringContains(t, page.Body, "<body>")
+
+	// Without analytics, there is no beacon
+	app.config.Analytics.Enabled = false
+	ts = testutil.NewServer(t, app.routes())
+	page = ts.Get(t, "/snippet/view/1")
+	assert.StringContains(t, page.Body, "<body>")
+	rs = post(url.Values{"page": {"/"}})
+	if rs.Status == http.StatusNoContent {
+		t.Error("expected no beacon with analytics off")
+	}
+	assert.Equal(t, len(analytics.views), 2)
+}
+
+func TestAdminAnalytics(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+
+	ts.Login(t, "alice@example.com", "pa$$word")
+	rs := ts.Get(t, "/admin/analytics")
+	assert.Equal(t, rs.Status, http.StatusForbidden)
+
+	ts.Login(t, "admin@example.com", "pa$$word")
+	rs = ts.Get(t, "/admin/analytics")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.StringContains(t, rs.Body, `<a href="/admin/analytics?page=%2fsnippet%2fview%2f%3aid">/snippet/view/:id</a>`)
+	assert.StringContains(t, rs.Body, "Views per Day")
+	assert.StringContains(t, rs.Body, `<span class="bar" style="width: 100%"></span> 17`)
+	assert.StringContains(t, rs.Body, "Search engines")
+
+	rs = ts.Get(t, "/admin/analytics?page=/")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.StringContains(t, rs.Body, "Views of / per Day")
+	assert.StringContains(t, rs.Body, `<span class="bar" style="width: 100%"></span> 5`)
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// =============================================================================
+// Announcement Banner
+// =============================================================================
+// Admins can announce maintenance windows and incidents with a banner shown
+// at the top of every page between its start and end times.
+
+const (
+	// announcementRefreshInterval is how often the announcements are
+	// reloaded, bounding how long a change made on another instance takes
+	// to show here
+	announcementRefreshInterval = 30 * time.Second
+
+	// maxAnnouncementLength is the most characters an announcement can have
+	maxAnnouncementLength = 500
+
+	// announcementTimeLayout is the format of datetime-local inputs. Times
+	// are entered in UTC.
+	announcementTimeLayout = "2006-01-02T15:04"
+)
+
+// announcementBoard is an in-memory copy of the announcements that haven't
+// ended, so rendering a page costs no database round trip
+type announcementBoard struct {
+	model  models.AnnouncementModelInterface
+	logger *slog.Logger
+
+	mu            sync.RWMutex
+	announcements []*models.Announcement
+}
+
+// newAnnouncementBoard creates an empty board backed by model
+func newAnnouncementBoard(model models.AnnouncementModelInterface, logger *slog.Logger) *announcementBoard {
+	return &announcementBoard{model: model, logger: logger}
+}
+
+// refresh reloads the announcements from the database
+func (b *announcementBoard) refresh() error {
+	announcements, err := b.model.Current()
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.announcements = announcements
+	b.mu.Unlock()
+	return nil
+}
+
+// run refreshes the board every announcementRefreshInterval until ctx is
+// cancelled. On failure the previous announcements stay up.
+func (b *announcementBoard) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(announcementRefreshInterval):
+		}
+
+		if err := b.refresh(); err != nil {
+			b.logger.Error("refresh announcements", "error", err)
+		}
+	}
+}
+
+// current returns the announcement to show at t, or nil if there is none.
+// When several are active the most severe wins, then the latest to start.
+func (b *announcementBoard) current(t time.Time) *models.Announcement {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var shown *models.Announcement
+	for _, a := range b.announcements {
+		if !a.Active(t) {
+			continue
+		}
+		if shown == nil || severity(a.Level) > severity(shown.Level) ||
+			(a.Level == shown.Level && !a.Starts.Before(shown.Starts)) {
+			shown = a
+		}
+	}
+	return shown
+}
+
+// severity ranks an announcement level, higher being more severe
+func severity(level string) int {
+	return slices.Index(models.AnnouncementLevels, level)
+}
+
+// announce adds the announcement to show, if any, to the request context
+// for newTemplateData
+func (app *application) announce(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.announcements != nil {
+			if a := app.announcements.current(time.Now()); a != nil {
+				r = r.WithContext(context.WithValue(r.Context(), announcementContextKey, a))
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// announcement returns the announcement added by the announce middleware,
+// or nil if there is none
+func (app *application) announcement(r *http.Request) *models.Announcement {
+	a, _ := r.Context().Value(announcementContextKey).(*models.Announcement)
+	return a
+}
+
+// announcementsChanged reloads the board after an admin change, so it shows
+// on this instance straight away, and drops cached pages showing the old
+// banner. Other instances catch up when they next refresh.
+func (app *application) announcementsChanged() {
+	if err := app.announcements.refresh(); err != nil {
+		app.logger.Error("refresh announcements", "error", err)
+	}
+	app.pages.purgeAll()
+}
+
+// =============================================================================
+// Admin Pages
+// =============================================================================
+
+// announcementForm represents the add and edit announcement form
+type announcementForm struct {
+	ID                  int    `form:"-"`
+	Message             string `form:"message"`
+	Level               string `form:"level"`
+	Starts              string `form:"starts"`
+	Ends                string `form:"ends"`
+	validator.Validator `form:"-"`
+}
+
+// newAnnouncementForm fills the form from an existing announcement
+func newAnnouncementForm(a *models.Announcement) announcementForm {
+	form := announcementForm{
+		ID:      a.ID,
+		Message: a.Message,
+		Level:   a.Level,
+		Starts:  a.Starts.UTC().Format(announcementTimeLayout),
+	}
+	if !a.Ends.IsZero() {
+		form.Ends = a.Ends.UTC().Format(announcementTimeLayout)
+	}
+	return form
+}
+
+// announcement validates the form and returns the announcement it describes.
+// A blank start means now and a blank end means the banner shows until it
+// is deleted.
+func (form *announcementForm) announcement(app *application, r *http.Request) *models.Announcement {
+	a := &models.Announcement{
+		ID:      form.ID,
+		Message: strings.TrimSpace(form.Message),
+		Level:   form.Level,
+		Starts:  time.Now().UTC().Truncate(time.Minute),
+	}
+
+	form.CheckField(validator.NotBlank(a.Message), "message", app.translate(r, "validation.blank"))
+	form.CheckField(validator.MaxChars(a.Message, maxAnnouncementLength), "message", app.translate(r, "validation.max_chars", maxAnnouncementLength))
+	form.CheckField(validator.PermittedValue(a.Level, models.AnnouncementLevels...), "level", app.translate(r, "validation.announcement_level"))
+
+	var err error
+	if form.Starts != "" {
+		a.Starts, err = time.Parse(announcementTimeLayout, form.Starts)
+		form.CheckField(err == nil, "starts", app.translate(r, "validation.datetime"))
+	}
+	if form.Ends != "" {
+		a.Ends, err = time.Parse(announcementTimeLayout, form.Ends)
+		form.CheckField(err == nil, "ends", app.translate(r, "validation.datetime"))
+		form.CheckField(err != nil || a.Ends.After(a.Starts), "ends", app.translate(r, "validation.announcement_ends"))
+	}
+
+	return a
+}
+
+// adminAnnouncements lists the current and scheduled announcements with a
+// form to add one
+func (app *application) adminAnnouncements(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = announcementForm{Level: models.AnnouncementInfo}
+	app.renderAnnouncements(w, r, http.StatusOK, data)
+}
+
+// adminAnnouncementsPost adds an announcement
+func (app *application) adminAnnouncementsPost(w http.ResponseWriter, r *http.Request) {
+	var form announcementForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	a := form.announcement(app, r)
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.renderAnnouncements(w, r, http.StatusUnprocessableEntity, data)
+		return
+	}
+
+	userID := userIDKey.Get(app.sessionManager, r.Context())
+	id, err := app.announcements.model.Insert(a, userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.announcementsChanged()
+	app.recordAudit(r, models.AuditAnnouncementAdd, announcementTarget(id), a.Message)
+
+	app.putFlash(r, app.translate(r, "flash.announcement_added"))
+	http.Redirect(w, r, "/admin/announcements", http.StatusSeeOther)
+}
+
+// adminAnnouncementEdit shows the form to change an announcement
+func (app *application) adminAnnouncementEdit(w http.ResponseWriter, r *http.Request) {
+	id, ok := announcementID(r)
+	if !ok {
+		app.notFound(w, r)
+		return
+	}
+
+	a, err := app.announcements.model.Get(id)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = newAnnouncementForm(a)
+	app.renderAnnouncements(w, r, http.StatusOK, data)
+}
+
+// adminAnnouncementEditPost changes an announcement
+func (app *application) adminAnnouncementEditPost(w http.ResponseWriter, r *http.Request) {
+	id, ok := announcementID(r)
+	if !ok {
+		app.notFound(w, r)
+		return
+	}
+
+	var form announcementForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form.ID = id
+
+	a := form.announcement(app, r)
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.renderAnnouncements(w, r, http.StatusUnprocessableEntity, data)
+		return
+	}
+
+	err = app.announcements.model.Update(a)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	app.announcementsChanged()
+	app.recordAudit(r, models.AuditAnnouncementEdit, announcementTarget(id), a.Message)
+
+	app.putFlash(r, app.translate(r, "flash.announcement_saved"))
+	http.Redirect(w, r, "/admin/announcements", http.StatusSeeOther)
+}
+
+// adminAnnouncementDelete takes an announcement down
+func (app *application) adminAnnouncementDelete(w http.ResponseWriter, r *http.Request) {
+	id, ok := announcementID(r)
+	if !ok {
+		app.notFound(w, r)
+		return
+	}
+
+	err := app.announcements.model.Delete(id)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	app.announcementsChanged()
+	app.recordAudit(r, models.AuditAnnouncementDelete, announcementTarget(id), "")
+
+	app.putFlash(r, app.translate(r, "flash.announcement_deleted"))
+	http.Redirect(w, r, "/admin/announcements", http.StatusSeeOther)
+}
+
+// announcementID returns the announcement ID in the URL
+func announcementID(r *http.Request) (int, bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	return id, err == nil && id > 0
+}
+
+// announcementTarget names an announcement in the audit log
+func announcementTarget(id int) string {
+	return "announcement:" + strconv.Itoa(id)
+}
+
+// renderAnnouncements renders the admin announcements page with the
+// current and scheduled announcements and the form held in data
+func (app *application) renderAnnouncements(w http.ResponseWriter, r *http.Request, status int, data *templateData) {
+	announcements, err := app.announcements.model.Current()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data.Announcements = announcements
+	data.Levels = models.AnnouncementLevels
+	data.Breadcrumbs = app.breadcrumbs(r, Crumb{Label: app.translate(r, "admin_announcements.title")})
+	app.render(w, status, "admin_announcements.tmpl", data)
+}
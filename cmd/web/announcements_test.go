@@ -0,0 +1,266 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/models/mocks"
+	"adotkaya.playground/internal/testutil"
+)
+
+// liveAnnouncements returns announcements around the current time
+type liveAnnouncements struct {
+	mocks.AnnouncementModel
+}
+
+func (m *liveAnnouncements) Current() ([]*models.Announcement, error) {
+	now := time.Now()
+	return []*models.Announcement{
+		{ID: 1, Message: "Old news", Level: models.AnnouncementInfo, Starts: now.Add(-2 * time.Hour)},
+		{ID: 2, Message: "Degraded search", Level: models.AnnouncementWarning, Starts: now.Add(-time.Hour), Ends: now.Add(time.Hour)},
+		{ID: 3, Message: "Maintenance", Level: models.AnnouncementCritical, Starts: now.Add(2 * time.Hour)},
+		{ID: 4, Message: "Latest news", Level: models.AnnouncementInfo, Starts: now.Add(-time.Hour)},
+	}, nil
+}
+
+func TestAnnouncementBoardCurrent(t *testing.T) {
+	board := newAnnouncementBoard(&liveAnnouncements{}, slog.New(slog.DiscardHandler))
+	assert.NilError(t, board.refresh())
+	now := time.Now()
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want int
+	}{
+		{"Most severe", now, 2},
+		{"Latest of the same level", now.Add(90 * time.Minute), 4},
+		{"Only one started", now.Add(-90 * time.Minute), 1},
+		{"Scheduled critical", now.Add(3 * time.Hour), 3},
+		{"Before any start", now.Add(-3 * time.Hour), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := board.current(tt.at)
+			if tt.want == 0 {
+				assert.Nil(t, a)
+				return
+			}
+			assert.NotNil(t, a)
+			assert.Equal(t, a.ID, tt.want)
+		})
+	}
+}
+
+func TestAnnouncementBanner(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+
+	// The mock announcement is scheduled, so no banner shows yet
+	rs := ts.Get(t, "/")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.Equal(t, strings.Contains(rs.Body, `class="announcement`), false)
+
+	app.announcements = newAnnouncementBoard(&liveAnnouncements{}, slog.New(slog.DiscardHandler))
+	assert.NilError(t, app.announcements.refresh())
+	ts = testutil.NewServer(t, app.routes())
+
+	rs = ts.Get(t, "/")
+	assert.StringContains(t, rs.Body, `<div class="announcement announcement-warning" role="alert">Degraded search</div>`)
+}
+
+func TestAdminAnnouncements(t *testing.T) {
+	tests := []struct {
+		name      string
+		email     string
+		path      string
+		wantCode  int
+		wantBody  []string
+		wantRedir string
+	}{
+		{
+			name:      "Anonymous",
+			path:      "/admin/announcements",
+			wantCode:  http.StatusSeeOther,
+			wantRedir: "/user/login",
+		},
+		{
+			name:     "Regular user",
+			email:    "alice@example.com",
+			path:     "/admin/announcements",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Admin",
+			email:    "admin@example.com",
+			path:     "/admin/announcements",
+			wantCode: http.StatusOK,
+			wantBody: []string{
+				"<h2>Current and Scheduled Announcements</h2>",
+				`<a href="/admin/announcements/1">Scheduled maintenance from 02:00 to 04:00 UTC</a>`,
+				"<td>Warning</td>",
+				`action="/admin/announcements/1/delete"`,
+				"<h2>Add an Announcement</h2>",
+				`<input type="radio" name="level" value="info" checked />`,
+			},
+		},
+		{
+			name:     "Edit",
+			email:    "admin@example.com",
+			path:     "/admin/announcements/1",
+			wantCode: http.StatusOK,
+			wantBody: []string{
+				"<h2>Edit Announcement</h2>",
+				`<form action="/admin/announcements/1" method="POST">`,
+				`<input type="datetime-local" name="starts" value="2099-01-04T02:00" />`,
+				`<input type="radio" name="level" value="warning" checked />`,
+			},
+		},
+		{
+			name:     "Edit missing",
+			email:    "admin@example.com",
+			path:     "/admin/announcements/99",
+			wantCode: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := testutil.NewServer(t, app.routes())
+			if tt.email != "" {
+				ts.Login(t, tt.email, "pa$$word")
+			}
+
+			rs := ts.Get(t, tt.path)
+			assert.Equal(t, rs.Status, tt.wantCode)
+			if tt.wantRedir != "" {
+				assert.Equal(t, rs.Header.Get("Location"), tt.wantRedir)
+			}
+			for _, want := range tt.wantBody {
+				assert.StringContains(t, rs.Body, want)
+			}
+		})
+	}
+}
+
+func TestAdminAnnouncementsPost(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		message  string
+		level    string
+		starts   string
+		ends     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Now, until taken down",
+			path:     "/admin/announcements",
+			message:  "Search is degraded",
+			level:    "warning",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Scheduled",
+			path:     "/admin/announcements",
+			message:  "Maintenance",
+			level:    "critical",
+			starts:   "2099-01-04T02:00",
+			ends:     "2099-01-04T04:00",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Edit",
+			path:     "/admin/announcements/1",
+			message:  "Maintenance moved",
+			level:    "warning",
+			starts:   "2099-01-05T02:00",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Edit missing",
+			path:     "/admin/announcements/99",
+			message:  "Maintenance",
+			level:    "info",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Blank message",
+			path:     "/admin/announcements",
+			level:    "info",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field cannot be blank",
+		},
+		{
+			name:     "Unknown level",
+			path:     "/admin/announcements",
+			message:  "Maintenance",
+			level:    "panic",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "Choose a level",
+		},
+		{
+			name:     "Malformed time",
+			path:     "/admin/announcements",
+			message:  "Maintenance",
+			level:    "info",
+			starts:   "tomorrow",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "Enter a date and time",
+		},
+		{
+			name:     "Ends before start",
+			path:     "/admin/announcements",
+			message:  "Maintenance",
+			level:    "info",
+			starts:   "2099-01-04T02:00",
+			ends:     "2099-01-04T01:00",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "The end must be after the start",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := testutil.NewServer(t, app.routes())
+			ts.Login(t, "admin@example.com", "pa$$word")
+
+			form := url.Values{}
+			form.Add("message", tt.message)
+			form.Add("level", tt.level)
+			form.Add("starts", tt.starts)
+			form.Add("ends", tt.ends)
+			rs := ts.Submit(t, "/admin/announcements", tt.path, form)
+
+			assert.Equal(t, rs.Status, tt.wantCode)
+			if tt.wantCode == http.StatusSeeOther {
+				assert.Equal(t, rs.Header.Get("Location"), "/admin/announcements")
+			}
+			if tt.wantBody != "" {
+				assert.StringContains(t, rs.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestAdminAnnouncementDelete(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+	ts.Login(t, "admin@example.com", "pa$$word")
+
+	rs := ts.Submit(t, "/admin/announcements", "/admin/announcements/1/delete", url.Values{})
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/admin/announcements")
+
+	rs = ts.Get(t, "/admin/announcements")
+	assert.StringContains(t, rs.Body, "The announcement has been taken down.")
+
+	rs = ts.Submit(t, "/admin/announcements", "/admin/announcements/99/delete", url.Values{})
+	assert.Equal(t, rs.Status, http.StatusNotFound)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/hmac"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"adotkaya.playground/internal/models"
+)
+
+// =============================================================================
+// Anonymous Snippets
+// =============================================================================
+
+// canEdit reports whether the current visitor may edit or delete s: its
+// owner if they are logged in, or whoever holds the encrypted cookie issued
+// when an anonymous snippet was created
+func (app *application) canEdit(r *http.Request, s *models.Snippet) bool {
+	if s.UserID != 0 {
+		return app.isAuthenticated(r) && userIDKey.Get(app.sessionManager, r.Context()) == s.UserID
+	}
+	for _, id := range app.ownedSnippets(r) {
+		if id == s.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// =============================================================================
+// Owned Snippets Cookie
+// =============================================================================
+
+const (
+	// ownedSnippetsCookie lists the anonymous snippets the visitor created
+	ownedSnippetsCookie = "owned_snippets"
+
+	// maxOwnedSnippets caps the cookie's size; the oldest IDs are dropped
+	maxOwnedSnippets = 20
+
+	// ownedSnippetsMaxAge outlives the longest snippet expiry
+	ownedSnippetsMaxAge = 366 * 24 * time.Hour
+)
+
+// ownedSnippets returns the snippet IDs in the visitor's owned snippets
+// cookie, or nil if there is no cookie or it isn't valid
+func (app *application) ownedSnippets(r *http.Request) []int {
+	list, err := app.cookies.Read(r, ownedSnippetsCookie)
+	if err != nil || list == "" {
+		return nil
+	}
+
+	var ids []int
+	for _, s := range strings.Split(list, "-") {
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			return nil
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// hasCookie reports whether the request carries the named cookie
+func hasCookie(r *http.Request, name string) bool {
+	_, err := r.Cookie(name)
+	return err == nil
+}
+
+// addOwnedSnippet adds id to the visitor's owned snippets cookie
+func (app *application) addOwnedSnippet(w http.ResponseWriter, r *http.Request, id int) {
+	ids := append(app.ownedSnippets(r), id)
+	if len(ids) > maxOwnedSnippets {
+		ids = ids[len(ids)-maxOwnedSnippets:]
+	}
+
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Itoa(id)
+	}
+	list := strings.Join(parts, "-")
+
+	err := app.cookies.Write(w, &http.Cookie{
+		Name:     ownedSnippetsCookie,
+		Value:    list,
+		Path:     "/",
+		MaxAge:   int(ownedSnippetsMaxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	if err != nil {
+		app.logger.ErrorContext(r.Context(), "owned snippets cookie", "error", err)
+	}
+}
+
+// =============================================================================
+// CAPTCHA
+// =============================================================================
+
+// captchaTTL is how long a visitor has to answer a CAPTCHA
+const captchaTTL = 15 * time.Minute
+
+// captcha is a small sum for anonymous visitors to solve. Token carries the
+// expiry and a signature over the answer, so no server-side state is kept.
+// A solved token can be reused until it expires; the per-address quota
+// bounds what that buys.
+type captcha struct {
+	A, B  int
+	Token string
+}
+
+// newCaptcha returns a fresh CAPTCHA
+func (app *application) newCaptcha() *captcha {
+	a, b := rand.IntN(9)+1, rand.IntN(9)+1
+	expires := time.Now().Add(captchaTTL).Unix()
+	return &captcha{A: a, B: b, Token: fmt.Sprintf("%d.%s", expires, app.captchaSignature(a+b, expires))}
+}
+
+// validCaptcha reports whether answer solves the CAPTCHA token was issued
+// for, and the token hasn't expired
+func (app *application) validCaptcha(token, answer string) bool {
+	exp, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(answer))
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(app.captchaSignature(n, expires)))
+}
+
+// captchaSignature signs a CAPTCHA's answer and expiry
+func (app *application) captchaSignature(answer int, expires int64) string {
+	return app.sign(fmt.Sprintf("captcha:%d:%d", answer, expires))
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/models/mocks"
+	"adotkaya.playground/internal/testutil"
+)
+
+// anonymousSnippets returns an anonymous snippet for IDs 1 and 2, so the
+// snippet created by the mock Insert (ID 2) can be viewed and edited
+type anonymousSnippets struct {
+	mocks.SnippetModel
+}
+
+func (m *anonymousSnippets) Get(ctx context.Context, id int) (*models.Snippet, error) {
+	if id != 1 && id != 2 {
+		return nil, models.ErrNoRecord
+	}
+	return &models.Snippet{ID: id, Title: "O snail", Content: "Climb Mount Fuji", Created: time.Now(), Expires: time.Now().Add(time.Hour)}, nil
+}
+func (m *anonymousSnippets) Update(id int, title string, content string, private bool, limits models.SnippetLimits) error {
+	return nil
+}
+func (m *anonymousSnippets) Delete(id int) error {
+	return nil
+}
+
+var captchaRX = regexp.MustCompile(`what is (\d) (?:\+|&#43;) (\d)\?</label>(?s:.*?)name="captcha_token" value="([^"]+)"`)
+
+// solveCaptcha answers the CAPTCHA on a create page
+func solveCaptcha(t *testing.T, body string) (token, answer string) {
+	t.Helper()
+
+	m := captchaRX.FindStringSubmatch(body)
+	if m == nil {
+		t.Fatal("no CAPTCHA found in body")
+	}
+	a, _ := strconv.Atoi(m[1])
+	b, _ := strconv.Atoi(m[2])
+	return m[3], strconv.Itoa(a + b)
+}
+
+func TestValidCaptcha(t *testing.T) {
+	app := newTestApplication(t)
+	c := app.newCaptcha()
+	answer := strconv.Itoa(c.A + c.B)
+
+	expired := fmt.Sprintf("%d.%s", time.Now().Add(-time.Minute).Unix(), app.captchaSignature(c.A+c.B, time.Now().Add(-time.Minute).Unix()))
+
+	tests := []struct {
+		name   string
+		token  string
+		answer string
+		want   bool
+	}{
+		{"Correct", c.Token, answer, true},
+		{"Correct with spaces", c.Token, " " + answer + " ", true},
+		{"Wrong answer", c.Token, strconv.Itoa(c.A + c.B + 1), false},
+		{"Not a number", c.Token, "seven", false},
+		{"Expired", expired, answer, false},
+		{"Tampered expiry", "9999999999" + c.Token[strings.Index(c.Token, "."):], answer, false},
+		{"Empty", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, app.validCaptcha(tt.token, tt.answer), tt.want)
+		})
+	}
+}
+
+func TestOwnedSnippets(t *testing.T) {
+	app := newTestApplication(t)
+
+	// Build up the cookie one snippet at a time, as a browser would
+	var cookie *http.Cookie
+	for id := 1; id <= maxOwnedSnippets+2; id++ {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		app.addOwnedSnippet(rr, r, id)
+		cookie = rr.Result().Cookies()[0]
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(cookie)
+	ids := app.ownedSnippets(r)
+	assert.Equal(t, len(ids), maxOwnedSnippets)
+	assert.Equal(t, ids[0], 3)
+	assert.Equal(t, ids[len(ids)-1], maxOwnedSnippets+2)
+
+	// A cookie edited to claim another snippet is ignored
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: ownedSnippetsCookie, Value: "1"})
+	assert.Equal(t, len(app.ownedSnippets(r)), 0)
+}
+
+func TestAnonymousSnippetCreate(t *testing.T) {
+	t.Run("Disabled", func(t *testing.T) {
+		app := newTestApplication(t)
+		ts := testutil.NewServer(t, app.routes())
+
+		rs := ts.Get(t, "/snippet/create")
+		assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/user/login")
+	})
+
+	app := newTestApplication(t)
+	app.config.Anonymous = AnonymousConfig{Enabled: true, PerHour: 3, Total: 20}
+	app.snippets = &anonymousSnippets{}
+	ts := testutil.NewServer(t, app.routes())
+
+	form := url.Values{}
+	form.Add("title", "O snail")
+	form.Add("content", "Climb Mount Fuji")
+	form.Add("expires", "7")
+
+	page := ts.Get(t, "/snippet/create")
+	assert.Equal(t, page.Status, http.StatusOK)
+	assert.StringContains(t, page.Body, `name="captcha"`)
+
+	// Without the CAPTCHA
+	rs := ts.PostForm(t, "/snippet/create", withCSRF(t, page.Body, form))
+	assert.Equal(t, rs.Status, http.StatusUnprocessableEntity)
+	assert.StringContains(t, rs.Body, "That answer is wrong or has expired.")
+
+	// With it solved
+	token, answer := solveCaptcha(t, rs.Body)
+	solved := withCSRF(t, rs.Body, form)
+	solved.Set("captcha_token", token)
+	solved.Set("captcha", answer)
+	rs = ts.PostForm(t, "/snippet/create", solved)
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/snippet/view/2")
+	assert.StringContains(t, rs.Header.Get("Set-Cookie"), ownedSnippetsCookie+"=")
+
+	// The creator can edit and delete their snippet, but not others
+	rs = ts.Get(t, "/snippet/view/2")
+	assert.StringContains(t, rs.Body, `href="/snippet/edit/2"`)
+
+	rs = ts.Get(t, "/snippet/view/1")
+	if strings.Contains(rs.Body, `href="/snippet/edit/1"`) {
+		t.Error("edit link shown for a snippet the visitor doesn't own")
+	}
+
+	edit := url.Values{}
+	edit.Add("title", "O snail, slowly")
+	edit.Add("content", "Climb Mount Fuji")
+	rs = ts.Submit(t, "/snippet/edit/2", "/snippet/edit/2", edit)
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/snippet/view/2")
+
+	rs = ts.Get(t, "/snippet/edit/1")
+	assert.Equal(t, rs.Status, http.StatusForbidden)
+
+	rs = ts.Submit(t, "/snippet/view/2", "/snippet/delete/1", url.Values{})
+	assert.Equal(t, rs.Status, http.StatusForbidden)
+
+	rs = ts.Submit(t, "/snippet/view/2", "/snippet/delete/2", url.Values{})
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/")
+}
+
+// withCSRF copies form and adds the CSRF token from a page
+func withCSRF(t *testing.T, body string, form url.Values) url.Values {
+	t.Helper()
+
+	values := url.Values{}
+	for k, v := range form {
+		values[k] = v
+	}
+	values.Set("csrf_token", testutil.ExtractCSRFToken(t, body))
+	return values
+}
+
+// aliceSnippets belong to Alice
+type aliceSnippets struct {
+	mocks.SnippetModel
+}
+
+func (m *aliceSnippets) Get(ctx context.Context, id int) (*models.Snippet, error) {
+	s, err := m.SnippetModel.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	owned := *s
+	owned.UserID = 1
+	return &owned, nil
+}
+
+func TestSnippetEditOwner(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		wantCode int
+		wantPost int
+	}{
+		{"Owner", "alice@example.com", http.StatusOK, http.StatusSeeOther},
+		{"Other user", "admin@example.com", http.StatusForbidden, http.StatusForbidden},
+		{"Anonymous", "", http.StatusForbidden, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.snippets = &aliceSnippets{}
+			ts := testutil.NewServer(t, app.routes())
+			if tt.email != "" {
+				ts.Login(t, tt.email, "pa$$word")
+			}
+
+			rs := ts.Get(t, "/snippet/edit/1")
+			assert.Equal(t, rs.Status, tt.wantCode)
+
+			// Saving and deleting are checked the same way, whatever form
+			// the request comes from
+			edit := url.Values{"title": {"A new pond"}, "content": {"A frog jumps in"}, "expires": {"7"}}
+			rs = ts.Submit(t, "/", "/snippet/edit/1", edit)
+			assert.Equal(t, rs.Status, tt.wantPost)
+
+			rs = ts.Submit(t, "/", "/snippet/delete/1", url.Values{})
+			assert.Equal(t, rs.Status, tt.wantPost)
+		})
+	}
+}
@@ -0,0 +1,635 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/validator"
+)
+
+// =============================================================================
+// JSON API
+// =============================================================================
+// Routes under /api/ are for scripts. They authenticate with a personal
+// access token in the Authorization header instead of the session cookie,
+// so they have no session or CSRF cookies and skip the CSRF check: browsers
+// never send the token on their own, so another site can't forge requests.
+//
+// Every response is JSON wrapped in an apiEnvelope. Tokens are created on
+// the API tokens page, where logins are screened like any other, and can
+// be listed and revoked through the API.
+
+const (
+	// maxAPITokens is the most tokens a user can have
+	maxAPITokens = 10
+
+	// apiTokenRealm names the API in WWW-Authenticate challenges
+	apiTokenRealm = "api"
+)
+
+// apiUser is a user as the API shows them
+type apiUser struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Role  string `json:"role"`
+	Tier  string `json:"tier"`
+}
+
+// authenticateToken checks the bearer token of an API request and, if it
+// belongs to an active user, adds them to the request context like
+// authenticate does for sessions. Requests without a token carry on
+// anonymously; a token that doesn't check out gets 401 Unauthorized, so
+// scripts with a revoked token find out rather than being served as
+// anonymous.
+func (app *application) authenticateToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			app.apiUnauthorized(w, "invalid_request", "Authorization must be a bearer token")
+			return
+		}
+
+		userID, err := app.tokens.Authenticate(token)
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidCredentials) {
+				app.apiUnauthorized(w, "invalid_token", "Invalid or revoked token")
+			} else {
+				app.serverError(w, err)
+			}
+			return
+		}
+
+		// Tokens of banned and deactivated users stop working with them
+		user, err := app.users.Get(userID)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.apiUnauthorized(w, "invalid_token", "Invalid or revoked token")
+			} else {
+				app.serverError(w, err)
+			}
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(withUser(r.Context(), user)))
+	})
+}
+
+// requireToken refuses API requests made without a token
+func (app *application) requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.isAuthenticated(r) {
+			app.apiUnauthorized(w, "", "A bearer token is required")
+			return
+		}
+
+		w.Header().Add("Cache-Control", "no-store")
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiUnauthorized sends 401 Unauthorized with a bearer challenge (RFC 6750).
+// code is the challenge's error code, or "" when no token was sent.
+func (app *application) apiUnauthorized(w http.ResponseWriter, code, message string) {
+	challenge := `Bearer realm="` + apiTokenRealm + `"`
+	if code != "" {
+		challenge += `, error="` + code + `"`
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	app.apiError(w, http.StatusUnauthorized, message)
+}
+
+// =============================================================================
+// API Responses
+// =============================================================================
+
+// apiEnvelope wraps every API response: the result in data, or a message
+// in error, with what is wrong with each field of invalid input in fields
+type apiEnvelope struct {
+	Data   any               `json:"data,omitempty"`
+	Error  string            `json:"error,omitempty"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// apiError sends an API error response
+func (app *application) apiError(w http.ResponseWriter, status int, message string) {
+	app.apiRespond(w, status, apiEnvelope{Error: message})
+}
+
+// apiInvalid sends 422 Unprocessable Entity for input failing v's checks
+func (app *application) apiInvalid(w http.ResponseWriter, v validator.Validator) {
+	message := "Invalid input"
+	if len(v.NonFieldErrors) > 0 {
+		message = strings.Join(v.NonFieldErrors, " ")
+	}
+	app.apiRespond(w, http.StatusUnprocessableEntity, apiEnvelope{Error: message, Fields: v.FieldErrors})
+}
+
+// apiJSON sends an API response with data as its result
+func (app *application) apiJSON(w http.ResponseWriter, status int, data any) {
+	app.apiRespond(w, status, apiEnvelope{Data: data})
+}
+
+// apiRespond sends an API response
+func (app *application) apiRespond(w http.ResponseWriter, status int, body apiEnvelope) {
+	js, err := json.Marshal(body)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
+}
+
+// =============================================================================
+// Content Negotiation
+// =============================================================================
+
+// maxAPIBodySize caps API request bodies. The visitor's snippet size limit
+// is checked once the body has been decoded.
+const maxAPIBodySize = 16 << 20
+
+// negotiateJSON sends 406 Not Acceptable to API requests whose Accept
+// header rules out JSON, the only format the API speaks
+func (app *application) negotiateJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !acceptsJSON(r.Header.Values("Accept")) {
+			app.apiError(w, http.StatusNotAcceptable, "Responses are only available as application/json")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// acceptsJSON reports whether Accept header values allow a JSON response.
+// No header at all allows anything.
+func acceptsJSON(values []string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, value := range values {
+		for _, accepted := range strings.Split(value, ",") {
+			mediaType, params, err := mime.ParseMediaType(accepted)
+			if err != nil || params["q"] == "0" || params["q"] == "0.0" {
+				continue
+			}
+			switch mediaType {
+			case "application/json", "application/*", "*/*":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// decodeJSON decodes a JSON request body into dst. It sends 415
+// Unsupported Media Type for bodies that aren't JSON, or 400 Bad Request
+// for malformed ones, and returns false.
+func (app *application) decodeJSON(w http.ResponseWriter, r *http.Request, dst any) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		app.apiError(w, http.StatusUnsupportedMediaType, "Request bodies must be application/json")
+		return false
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			app.apiError(w, http.StatusRequestEntityTooLarge, "Request body is too large")
+		} else {
+			app.apiError(w, http.StatusBadRequest, "Request body is not valid JSON: "+err.Error())
+		}
+		return false
+	}
+	return true
+}
+
+// =============================================================================
+// API Handlers
+// =============================================================================
+
+// apiCurrentUser shows the user the token belongs to, so scripts can check
+// their token
+func (app *application) apiCurrentUser(w http.ResponseWriter, r *http.Request) {
+	user, err := app.users.Get(currentUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.apiJSON(w, http.StatusOK, apiUser{
+		ID:    user.ID,
+		Name:  user.Name,
+		Email: user.Email,
+		Role:  user.Role,
+		Tier:  user.Tier,
+	})
+}
+
+// apiSnippetSummary is a snippet in an API listing
+type apiSnippetSummary struct {
+	ID       int       `json:"id"`
+	Title    string    `json:"title"`
+	Excerpt  string    `json:"excerpt"`
+	Language string    `json:"language,omitempty"`
+	Created  time.Time `json:"created"`
+	Expires  time.Time `json:"expires"`
+}
+
+// apiSnippet is a snippet as the API shows it. Encrypted snippets have
+// no title, and their content is the ciphertext.
+type apiSnippet struct {
+	ID        int       `json:"id"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	Language  string    `json:"language,omitempty"`
+	Tags      []string  `json:"tags"`
+	Private   bool      `json:"private"`
+	Encrypted bool      `json:"encrypted"`
+	OwnerID   int       `json:"owner_id,omitempty"`
+	URL       string    `json:"url"`
+	Created   time.Time `json:"created"`
+	Expires   time.Time `json:"expires"`
+}
+
+// apiSnippetInput is the body creating or updating a snippet. Expires, in
+// days, is only read when creating.
+type apiSnippetInput struct {
+	Title   string   `json:"title"`
+	Content string   `json:"content"`
+	Tags    []string `json:"tags"`
+	Private bool     `json:"private"`
+	Expires int      `json:"expires"`
+
+	validator.Validator `json:"-"`
+}
+
+// apiToken is one of the user's tokens as the API shows it, without the
+// token itself
+type apiToken struct {
+	ID       int        `json:"id"`
+	Name     string     `json:"name"`
+	Prefix   string     `json:"prefix"`
+	Created  time.Time  `json:"created"`
+	LastUsed *time.Time `json:"last_used,omitempty"`
+}
+
+// newAPISnippet returns s as the API shows it
+func (app *application) newAPISnippet(s *models.Snippet) apiSnippet {
+	tags := s.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return apiSnippet{
+		ID:        s.ID,
+		Title:     s.Title,
+		Content:   s.Content,
+		Language:  s.Language,
+		Tags:      tags,
+		Private:   s.Private,
+		Encrypted: s.Encrypted,
+		OwnerID:   s.UserID,
+		URL:       app.canonicalURL(fmt.Sprintf("/snippet/view/%d", s.ID)),
+		Created:   s.Created,
+		Expires:   s.Expires,
+	}
+}
+
+// apiSnippetList lists the latest public snippets, like the home page
+func (app *application) apiSnippetList(w http.ResponseWriter, r *http.Request) {
+	snippets, err := app.snippets.Latest(r.Context())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	list := make([]apiSnippetSummary, len(snippets))
+	for i, s := range snippets {
+		list[i] = apiSnippetSummary{
+			ID:       s.ID,
+			Title:    s.Title,
+			Excerpt:  s.Excerpt,
+			Language: s.Language,
+			Created:  s.Created,
+			Expires:  s.Expires,
+		}
+	}
+	app.apiJSON(w, http.StatusOK, list)
+}
+
+// apiSnippetView shows a snippet. Private snippets are only shown to their
+// owner, and look missing to anyone else.
+func (app *application) apiSnippetView(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.apiLoadSnippet(w, r)
+	if !ok {
+		return
+	}
+	if snippet.Private && snippet.UserID != currentUserID(r) {
+		app.apiError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	app.apiJSON(w, http.StatusOK, app.newAPISnippet(snippet))
+}
+
+// apiSnippetCreate creates a snippet owned by the token's user, with the
+// same checks and limits as the create page
+func (app *application) apiSnippetCreate(w http.ResponseWriter, r *http.Request) {
+	key, ok := idempotencyKey(r, "")
+	if !ok {
+		app.apiError(w, http.StatusBadRequest, "Invalid Idempotency-Key")
+		return
+	}
+
+	var input apiSnippetInput
+	if !app.decodeJSON(w, r, &input) {
+		return
+	}
+
+	input.CheckField(validator.PermittedValue(input.Expires, 1, 7, 365), "expires", app.translate(r, "validation.expires"))
+	tags := app.checkAPISnippet(r, &input)
+	if !input.Valid() {
+		app.apiInvalid(w, input.Validator)
+		return
+	}
+
+	limits, err := app.quotas.snippetLimits(app.visitor(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// A repeated request gets the first one's result
+	var id int
+	if key != "" {
+		if !app.apiClaimSubmission(w, r, key) {
+			return
+		}
+		defer func() { app.finishSubmission(r, key, id) }()
+	}
+
+	id, err = app.snippets.Insert(currentUserID(r), app.clientIP(r), input.Title, input.Content, input.Expires, input.Private, limits)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+	if len(tags) > 0 {
+		if err = app.snippets.SetTags(id, tags); err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+	now := time.Now()
+	snippet := &models.Snippet{
+		ID:      id,
+		Title:   input.Title,
+		Content: input.Content,
+		Created: now,
+		Expires: now.AddDate(0, 0, input.Expires),
+		UserID:  currentUserID(r),
+		Tags:    tags,
+		Private: input.Private,
+	}
+	app.pages.purge("/")
+	if !input.Private {
+		app.events.publish(snippetEvent{ID: id, Title: input.Title, Created: now})
+	}
+	app.recordChange(r, id, models.ChangeCreate, nil, snippetMeta(snippet))
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/snippets/%d", id))
+	app.apiJSON(w, http.StatusCreated, app.newAPISnippet(snippet))
+}
+
+// apiClaimSubmission is claimSubmission for the API: a repeat of a request
+// that created a snippet gets that snippet back, as the first request did
+func (app *application) apiClaimSubmission(w http.ResponseWriter, r *http.Request, key string) bool {
+	id, err := app.claimKey(r, key)
+	switch {
+	case err == nil && id == 0:
+		return true
+	case errors.Is(err, models.ErrKeyInProgress):
+		app.apiError(w, http.StatusConflict, "A request with this Idempotency-Key is in progress")
+		return false
+	case r.Context().Err() != nil:
+		return false
+	case err != nil:
+		app.serverError(w, err)
+		return false
+	}
+
+	snippet, err := app.snippets.Get(r.Context(), id)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return false
+	}
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/snippets/%d", id))
+	app.apiJSON(w, http.StatusCreated, app.newAPISnippet(snippet))
+	return false
+}
+
+// apiSnippetUpdate replaces the title, content, tags and privacy of one of
+// the token user's snippets. The expiry can't be changed.
+func (app *application) apiSnippetUpdate(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.apiOwnSnippet(w, r)
+	if !ok {
+		return
+	}
+	if snippet.Encrypted {
+		app.apiError(w, http.StatusConflict, "Encrypted snippets can't be edited")
+		return
+	}
+
+	var input apiSnippetInput
+	if !app.decodeJSON(w, r, &input) {
+		return
+	}
+	tags := app.checkAPISnippet(r, &input)
+	if !input.Valid() {
+		app.apiInvalid(w, input.Validator)
+		return
+	}
+
+	limits, err := app.quotas.snippetLimits(app.visitor(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.snippets.Update(snippet.ID, input.Title, input.Content, input.Private, limits)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+	if err = app.snippets.SetTags(snippet.ID, tags); err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.snippetChanged(snippet.ID)
+	app.syncGist(snippet.ID)
+
+	edited := *snippet
+	edited.Title, edited.Content, edited.Tags, edited.Private = input.Title, input.Content, tags, input.Private
+	app.recordChange(r, snippet.ID, models.ChangeEdit, snippetMeta(snippet), snippetMeta(&edited))
+
+	app.apiJSON(w, http.StatusOK, app.newAPISnippet(&edited))
+}
+
+// apiSnippetDelete deletes one of the token user's snippets
+func (app *application) apiSnippetDelete(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.apiOwnSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	keys, err := app.attachmentKeys(snippet.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	err = app.snippets.Delete(snippet.ID)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return
+	}
+	app.deleteObjects(keys)
+	app.snippetChanged(snippet.ID)
+	app.recordChange(r, snippet.ID, models.ChangeDelete, snippetMeta(snippet), nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiTokenList lists the token user's tokens
+func (app *application) apiTokenList(w http.ResponseWriter, r *http.Request) {
+	tokens, err := app.tokens.List(currentUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	list := make([]apiToken, len(tokens))
+	for i, t := range tokens {
+		list[i] = apiToken{ID: t.ID, Name: t.Name, Prefix: t.Prefix, Created: t.Created}
+		if !t.LastUsed.IsZero() {
+			list[i].LastUsed = &t.LastUsed
+		}
+	}
+	app.apiJSON(w, http.StatusOK, list)
+}
+
+// apiTokenDelete revokes one of the token user's tokens, which may be the
+// one the request was made with
+func (app *application) apiTokenDelete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(httprouter.ParamsFromContext(r.Context()).ByName("id"))
+	if err != nil || id < 1 {
+		app.apiError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	err = app.tokens.Delete(currentUserID(r), id)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiLoadSnippet fetches the snippet in :id, sending a 404 if there is no
+// such snippet
+func (app *application) apiLoadSnippet(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	id, err := strconv.Atoi(httprouter.ParamsFromContext(r.Context()).ByName("id"))
+	if err != nil || id < 1 {
+		app.apiError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return nil, false
+	}
+
+	snippet, err := app.snippets.Get(r.Context(), id)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return nil, false
+	}
+	return snippet, true
+}
+
+// apiOwnSnippet fetches the snippet in :id, sending a 404 if there is no
+// such snippet the token's user may see, or a 403 if they may see it but
+// don't own it
+func (app *application) apiOwnSnippet(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	snippet, ok := app.apiLoadSnippet(w, r)
+	if !ok {
+		return nil, false
+	}
+	if snippet.UserID == currentUserID(r) {
+		return snippet, true
+	}
+
+	if snippet.Private {
+		app.apiError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+	} else {
+		app.apiError(w, http.StatusForbidden, "Only the snippet's owner can change it")
+	}
+	return nil, false
+}
+
+// checkAPISnippet checks a snippet's title, content and tags like the
+// create and edit pages do, and returns the tags tidied up
+func (app *application) checkAPISnippet(r *http.Request, input *apiSnippetInput) []string {
+	input.CheckField(validator.NotBlank(input.Title), "title", app.translate(r, "validation.blank"))
+	input.CheckField(validator.MaxChars(input.Title, 100), "title", app.translate(r, "validation.max_chars", 100))
+	input.CheckField(validator.NotBlank(input.Content), "content", app.translate(r, "validation.blank"))
+	sizeOK, maxSize := app.quotas.allowsSize(app.visitor(r), len(input.Content))
+	input.CheckField(sizeOK, "content", app.sizeMessage(r, maxSize))
+
+	tags := parseTags(strings.Join(input.Tags, ","))
+	app.checkTags(r, &input.Validator, tags)
+	return tags
+}
+
+// apiModelError responds to an error from a model, as modelError does for
+// pages: 404 for a record that doesn't exist, 409 Conflict for a write
+// clashing with existing data, 422 for a value the database turned away,
+// 429 Too Many Requests when the user is at a snippet limit, and a server
+// error otherwise
+func (app *application) apiModelError(w http.ResponseWriter, r *http.Request, err error) {
+	var quotaErr *models.QuotaError
+	var conflict *models.ConflictError
+	var invalid *models.ValidationError
+	switch {
+	case errors.As(err, &quotaErr):
+		if quotaErr.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(quotaErr.RetryAfter.Seconds())))
+		}
+		app.apiError(w, http.StatusTooManyRequests, app.quotaMessage(r, quotaErr))
+	case errors.Is(err, models.ErrNoRecord):
+		app.apiError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+	case errors.As(err, &conflict):
+		app.apiError(w, http.StatusConflict, http.StatusText(http.StatusConflict))
+	case errors.As(err, &invalid):
+		app.apiRespond(w, http.StatusUnprocessableEntity, apiEnvelope{
+			Error:  "Invalid input",
+			Fields: map[string]string{invalid.Field: invalid.Message},
+		})
+	default:
+		app.serverError(w, err)
+	}
+}
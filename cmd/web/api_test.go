@@ -0,0 +1,252 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+// aliceAPIToken is Alice's token in the mock token model
+const aliceAPIToken = "sbx_ALICEALICEALICEALICEALICE"
+
+func TestAPIAuthentication(t *testing.T) {
+	ts := testutil.NewServer(t, newTestApplication(t).routes())
+
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		wantCode      int
+		wantChallenge string
+		wantBody      string
+	}{
+		{"No token", "/api/v1/user", "", http.StatusUnauthorized, `Bearer realm="api"`, `"error":"A bearer token is required"`},
+		{"Not a bearer token", "/api/v1/user", "Basic YWxpY2U6cGFzcw==", http.StatusUnauthorized, `Bearer realm="api", error="invalid_request"`, ""},
+		{"Unknown token", "/api/v1/user", "Bearer sbx_NOPE", http.StatusUnauthorized, `Bearer realm="api", error="invalid_token"`, ""},
+		{"Valid token", "/api/v1/user", "Bearer " + aliceAPIToken, http.StatusOK, "", `{"data":{"id":1,"name":"Alice","email":"alice@example.com","role":"user","tier":"free"}}`},
+		{"Unknown route", "/api/v1/nope", "", http.StatusNotFound, "", `{"error":"Not Found"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := ts.NewRequest(t, http.MethodGet, tt.path, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rs := ts.Do(t, req)
+
+			assert.Equal(t, rs.Status, tt.wantCode)
+			assert.Equal(t, rs.Header.Get("WWW-Authenticate"), tt.wantChallenge)
+			assert.Equal(t, rs.Header.Get("Content-Type"), "application/json")
+			if tt.wantBody != "" {
+				assert.StringContains(t, rs.Body, tt.wantBody)
+			}
+
+			// API routes set neither session nor CSRF cookies
+			assert.Equal(t, len(rs.Header.Values("Set-Cookie")), 0)
+		})
+	}
+}
+
+func TestAPIIgnoresSession(t *testing.T) {
+	ts := testutil.NewServer(t, newTestApplication(t).routes())
+	ts.Login(t, "alice@example.com", "pa$$word")
+
+	// A logged in browser isn't authenticated to the API by its cookies
+	rs := ts.Get(t, "/api/v1/user")
+	assert.Equal(t, rs.Status, http.StatusUnauthorized)
+}
+
+func TestAccountTokens(t *testing.T) {
+	ts := testutil.NewServer(t, newTestApplication(t).routes())
+
+	rs := ts.Get(t, "/account/tokens")
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/user/login")
+
+	ts.Login(t, "alice@example.com", "pa$$word")
+
+	rs = ts.Get(t, "/account/tokens")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.StringContains(t, rs.Body, "<td>Laptop</td>")
+	assert.StringContains(t, rs.Body, "<code>sbx_ALICEALI…</code>")
+
+	// A new token is shown once, on the page returned
+	rs = ts.Submit(t, "/account/tokens", "/account/tokens", url.Values{"name": {"CI"}})
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.StringContains(t, rs.Body, `value="sbx_NEWTOKENNEWTOKENNEWTOKEN"`)
+
+	rs = ts.Submit(t, "/account/tokens", "/account/tokens", url.Values{"name": {"  "}})
+	assert.Equal(t, rs.Status, http.StatusUnprocessableEntity)
+	assert.StringContains(t, rs.Body, "This field cannot be blank")
+
+	rs = ts.Submit(t, "/account/tokens", "/account/tokens/1/delete", url.Values{})
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/account/tokens")
+
+	rs = ts.Submit(t, "/account/tokens", "/account/tokens/9/delete", url.Values{})
+	assert.Equal(t, rs.Status, http.StatusNotFound)
+}
+
+func TestAPINegotiation(t *testing.T) {
+	ts := testutil.NewServer(t, newTestApplication(t).routes())
+
+	tests := []struct {
+		name        string
+		method      string
+		accept      string
+		contentType string
+		body        string
+		wantCode    int
+	}{
+		{"No Accept header", http.MethodGet, "", "", "", http.StatusOK},
+		{"JSON", http.MethodGet, "application/json", "", "", http.StatusOK},
+		{"Anything", http.MethodGet, "text/html, */*;q=0.1", "", "", http.StatusOK},
+		{"Only HTML", http.MethodGet, "text/html", "", "", http.StatusNotAcceptable},
+		{"JSON refused", http.MethodGet, "application/json;q=0", "", "", http.StatusNotAcceptable},
+		{"Form body", http.MethodPost, "", "application/x-www-form-urlencoded", "title=x", http.StatusUnsupportedMediaType},
+		{"Malformed JSON", http.MethodPost, "", "application/json", `{"title":`, http.StatusBadRequest},
+		{"Unknown field", http.MethodPost, "", "application/json", `{"name":"x"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := ts.NewRequest(t, tt.method, "/api/v1/snippets", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+aliceAPIToken)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rs := ts.Do(t, req)
+
+			assert.Equal(t, rs.Status, tt.wantCode)
+			assert.Equal(t, rs.Header.Get("Content-Type"), "application/json")
+		})
+	}
+}
+
+func TestAPISnippets(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+
+	call := func(method, path, token, body string) testutil.Response {
+		req := ts.NewRequest(t, method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		return ts.Do(t, req)
+	}
+
+	rs := call(http.MethodGet, "/api/v1/snippets", "", "")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.StringContains(t, rs.Body, `{"data":[{"id":1,"title":"An old silent pond","excerpt":"An old silent pond..."`)
+
+	rs = call(http.MethodGet, "/api/v1/snippets/1", "", "")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.StringContains(t, rs.Body, `"content":"An old silent pond...","tags":[],"private":false,"encrypted":false,"url":"https://snippetbox.example.com/snippet/view/1"`)
+
+	// Private snippets are only shown to their owner
+	rs = call(http.MethodGet, "/api/v1/snippets/4", "", "")
+	assert.Equal(t, rs.Status, http.StatusNotFound)
+	rs = call(http.MethodGet, "/api/v1/snippets/4", aliceAPIToken, "")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.StringContains(t, rs.Body, `"owner_id":1`)
+
+	rs = call(http.MethodGet, "/api/v1/snippets/99", "", "")
+	assert.Equal(t, rs.Status, http.StatusNotFound)
+	assert.Equal(t, rs.Body, `{"error":"Not Found"}`)
+
+	// Writing needs a token
+	body := `{"title":"Frog","content":"splash","tags":["#Haiku","pond"],"expires":7}`
+	rs = call(http.MethodPost, "/api/v1/snippets", "", body)
+	assert.Equal(t, rs.Status, http.StatusUnauthorized)
+
+	rs = call(http.MethodPost, "/api/v1/snippets", aliceAPIToken, body)
+	assert.Equal(t, rs.Status, http.StatusCreated)
+	assert.Equal(t, rs.Header.Get("Location"), "/api/v1/snippets/2")
+	assert.StringContains(t, rs.Body, `{"data":{"id":2,"title":"Frog","content":"splash","tags":["haiku","pond"],"private":false,"encrypted":false,"owner_id":1,`)
+
+	rs = call(http.MethodPost, "/api/v1/snippets", aliceAPIToken, `{"title":"","content":"x","expires":3}`)
+	assert.Equal(t, rs.Status, http.StatusUnprocessableEntity)
+	assert.Equal(t, rs.Body, `{"error":"Invalid input","fields":{"expires":"This field must equal 1, 7 or 365","title":"This field cannot be blank"}}`)
+
+	rs = call(http.MethodPut, "/api/v1/snippets/4", aliceAPIToken, `{"title":"Dear diary","content":"Two haiku.","tags":["diary"],"private":true}`)
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.StringContains(t, rs.Body, `"content":"Two haiku.","tags":["diary"],"private":true`)
+
+	// Only the owner can change a snippet
+	rs = call(http.MethodPut, "/api/v1/snippets/1", aliceAPIToken, `{"title":"Mine now","content":"x"}`)
+	assert.Equal(t, rs.Status, http.StatusForbidden)
+	rs = call(http.MethodDelete, "/api/v1/snippets/1", aliceAPIToken, "")
+	assert.Equal(t, rs.Status, http.StatusForbidden)
+
+	rs = call(http.MethodDelete, "/api/v1/snippets/4", aliceAPIToken, "")
+	assert.Equal(t, rs.Status, http.StatusNoContent)
+	assert.Equal(t, rs.Body, "")
+}
+
+func TestAPIIdempotentCreate(t *testing.T) {
+	app := newTestApplication(t)
+	snippets := &countingSnippets{}
+	app.snippets = snippets
+	ts := testutil.NewServer(t, app.routes())
+
+	post := func(key string) testutil.Response {
+		req := ts.NewRequest(t, http.MethodPost, "/api/v1/snippets", strings.NewReader(`{"title":"Frog","content":"splash","expires":7}`))
+		req.Header.Set("Authorization", "Bearer "+aliceAPIToken)
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		return ts.Do(t, req)
+	}
+
+	// Retrying a request creates one snippet, and gets it back
+	for range 2 {
+		rs := post("cli-1")
+		assert.Equal(t, rs.Status, http.StatusCreated)
+		assert.Equal(t, rs.Header.Get("Location"), "/api/v1/snippets/1")
+		assert.StringContains(t, rs.Body, `{"data":{"id":1,`)
+	}
+	assert.Equal(t, snippets.inserted, 1)
+
+	rs := post("cli-2")
+	assert.Equal(t, rs.Header.Get("Location"), "/api/v1/snippets/2")
+
+	// Requests without a key aren't deduplicated
+	post("")
+	post("")
+	assert.Equal(t, snippets.inserted, 4)
+
+	rs = post(strings.Repeat("k", idempotencyKeyMaxLen+1))
+	assert.Equal(t, rs.Status, http.StatusBadRequest)
+	assert.Equal(t, snippets.inserted, 4)
+}
+
+func TestAPITokens(t *testing.T) {
+	ts := testutil.NewServer(t, newTestApplication(t).routes())
+
+	call := func(method, path string) testutil.Response {
+		req := ts.NewRequest(t, method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+aliceAPIToken)
+		return ts.Do(t, req)
+	}
+
+	rs := call(http.MethodGet, "/api/v1/tokens")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.StringContains(t, rs.Body, `{"data":[{"id":1,"name":"Laptop","prefix":"sbx_ALICEALI"`)
+	if strings.Contains(rs.Body, aliceAPIToken) {
+		t.Error("tokens are never shown again")
+	}
+
+	rs = call(http.MethodDelete, "/api/v1/tokens/1")
+	assert.Equal(t, rs.Status, http.StatusNoContent)
+
+	rs = call(http.MethodDelete, "/api/v1/tokens/9")
+	assert.Equal(t, rs.Status, http.StatusNotFound)
+}
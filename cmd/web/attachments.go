@@ -0,0 +1,277 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/validator"
+)
+
+// =============================================================================
+// Snippet Attachments
+// =============================================================================
+// Owners can attach files such as screenshots and logs to their snippets.
+// The files are kept in an S3-compatible object store and never pass back
+// through the application: downloads are redirected to a signed link to
+// the store, which works for a few minutes. The routes only exist when an
+// object store is configured.
+
+// maxAttachments caps the files attached to one snippet
+const maxAttachments = 10
+
+// attachmentTypes are the kinds of file that can be attached, as sniffed
+// from their content rather than taken from the browser's say-so
+var attachmentTypes = []string{
+	"image/png",
+	"image/jpeg",
+	"image/gif",
+	"image/webp",
+	"text/plain",
+	"application/pdf",
+	"application/x-gzip",
+	"application/zip",
+}
+
+// attachmentForm represents the attachment upload form; the file itself
+// is read from the multipart body
+type attachmentForm struct {
+	validator.Validator `form:"-"`
+}
+
+// snippetAttachments shows the owner of a snippet its attachments with the
+// form for uploading more
+func (app *application) snippetAttachments(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.attachableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	app.renderAttachments(w, r, http.StatusOK, snippet, attachmentForm{})
+}
+
+// snippetAttachmentsPost uploads a file to the object store and attaches
+// it to the snippet
+func (app *application) snippetAttachmentsPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.attachableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	var form attachmentForm
+	file, header, err := r.FormFile("file")
+	if errors.Is(err, http.ErrMissingFile) {
+		form.AddFieldError("file", app.translate(r, "validation.blank"))
+		app.renderAttachments(w, r, http.StatusUnprocessableEntity, snippet, form)
+		return
+	} else if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	attachments, err := app.attachments.ForSnippet(snippet.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// The first bytes tell what the file really is
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		app.serverError(w, err)
+		return
+	}
+	contentType := http.DetectContentType(head[:n])
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	maxSize := int64(app.config.Attachments.MaxSize)
+	form.CheckField(len(attachments) < maxAttachments, "file", app.translate(r, "validation.attachments_max", maxAttachments))
+	form.CheckField(header.Size > 0, "file", app.translate(r, "validation.attachment_empty"))
+	form.CheckField(header.Size <= maxSize, "file", app.translate(r, "validation.attachment_size", humanSize(maxSize)))
+	form.CheckField(validator.PermittedValue(mediaType, attachmentTypes...), "file", app.translate(r, "validation.attachment_type"))
+	form.CheckField(validator.MaxChars(header.Filename, 255), "file", app.translate(r, "validation.max_chars", 255))
+	if !form.Valid() {
+		app.renderAttachments(w, r, http.StatusUnprocessableEntity, snippet, form)
+		return
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		app.serverError(w, err)
+		return
+	}
+	key, err := attachmentKey(snippet.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	err = app.objects.Put(key, contentType, file, header.Size)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	_, err = app.attachments.Insert(snippet.ID, key, header.Filename, contentType, header.Size)
+	if err != nil {
+		app.deleteObjects([]string{key})
+		app.serverError(w, err)
+		return
+	}
+	app.snippetChanged(snippet.ID)
+
+	app.putFlash(r, app.translate(r, "flash.attachment_added", header.Filename))
+	http.Redirect(w, r, fmt.Sprintf("/snippet/attachments/%d", snippet.ID), http.StatusSeeOther)
+}
+
+// snippetAttachment sends whoever can see a snippet on to a signed link
+// downloading one of its attachments from the object store
+func (app *application) snippetAttachment(w http.ResponseWriter, r *http.Request) {
+	a, snippet, ok := app.attachment(w, r)
+	if !ok {
+		return
+	}
+
+	// Private snippets' files look like missing ones to everyone but
+	// their owner
+	if !app.canView(r, snippet.UserID, snippet.Private) {
+		app.notFound(w, r)
+		return
+	}
+
+	link, err := app.objects.URL(a.Key, a.Filename, app.config.Attachments.URLExpiry)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// The link stops working, so nothing may keep the redirect
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, link, http.StatusSeeOther)
+}
+
+// snippetAttachmentDelete removes an attachment from the owner's snippet,
+// and its file from the object store
+func (app *application) snippetAttachmentDelete(w http.ResponseWriter, r *http.Request) {
+	a, snippet, ok := app.attachment(w, r)
+	if !ok {
+		return
+	}
+	if !app.canEdit(r, snippet) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	err := app.attachments.Delete(a.ID)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return
+	}
+	app.deleteObjects([]string{a.Key})
+	app.snippetChanged(snippet.ID)
+
+	app.putFlash(r, app.translate(r, "flash.attachment_deleted", a.Filename))
+	http.Redirect(w, r, fmt.Sprintf("/snippet/attachments/%d", snippet.ID), http.StatusSeeOther)
+}
+
+// renderAttachments renders the attachments page of a snippet with the
+// upload form
+func (app *application) renderAttachments(w http.ResponseWriter, r *http.Request, status int, snippet *models.Snippet, form attachmentForm) {
+	attachments, err := app.attachments.ForSnippet(snippet.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Attachments = attachments
+	data.MaxUpload = int64(app.config.Attachments.MaxSize)
+	data.Form = form
+	data.Breadcrumbs = app.breadcrumbs(r,
+		Crumb{Label: snippet.Title, URL: fmt.Sprintf("/snippet/view/%d", snippet.ID)},
+		Crumb{Label: app.translate(r, "attachments.title")},
+	)
+	app.render(w, status, "attachments.tmpl", data)
+}
+
+// attachableSnippet returns the snippet loaded for the attachments pages if
+// it can have attachments. Anonymous snippets can't, and nor can encrypted
+// ones: their files would be stored as they are, readable by the server.
+func (app *application) attachableSnippet(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	snippet := app.loadedSnippet(r)
+	if snippet.UserID == 0 || snippet.Encrypted {
+		app.notFound(w, r)
+		return nil, false
+	}
+	return snippet, true
+}
+
+// attachment returns the attachment in the URL and the snippet it belongs
+// to, or sends a 404
+func (app *application) attachment(w http.ResponseWriter, r *http.Request) (*models.Attachment, *models.Snippet, bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return nil, nil, false
+	}
+
+	a, err := app.attachments.Get(id)
+	if err == nil {
+		var snippet *models.Snippet
+		snippet, err = app.snippets.Get(r.Context(), a.SnippetID)
+		if err == nil {
+			return a, snippet, true
+		}
+	}
+	app.modelError(w, r, err)
+	return nil, nil, false
+}
+
+// attachmentKey returns a new, unguessable object store key for a file
+// attached to a snippet
+func attachmentKey(snippetID int) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("snippets/%d/%s", snippetID, hex.EncodeToString(b)), nil
+}
+
+// attachmentKeys returns the object store keys of a snippet's attachments,
+// for deleting their files once the snippet is gone. Returns none when
+// attachments are off.
+func (app *application) attachmentKeys(snippetID int) ([]string, error) {
+	if app.objects == nil {
+		return nil, nil
+	}
+
+	attachments, err := app.attachments.ForSnippet(snippetID)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, len(attachments))
+	for i, a := range attachments {
+		keys[i] = a.Key
+	}
+	return keys, nil
+}
+
+// deleteObjects removes files from the object store. Their records are
+// already gone, so a failure only leaves a stray file and is just logged.
+func (app *application) deleteObjects(keys []string) {
+	for _, key := range keys {
+		if err := app.objects.Delete(key); err != nil {
+			app.logger.Error("delete attachment", "key", key, "error", err)
+		}
+	}
+}
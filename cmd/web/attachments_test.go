@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/objectstore"
+	"adotkaya.playground/internal/testutil"
+)
+
+// fakeStore is an objectstore.Store, and an avatarStore, keeping files in
+// memory
+type fakeStore struct {
+	files    map[string]string // Content types by key
+	contents map[string][]byte
+	deleted  []string
+}
+
+func (s *fakeStore) Put(key, contentType string, body io.Reader, size int64) error {
+	if s.files == nil {
+		s.files = map[string]string{}
+		s.contents = map[string][]byte{}
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	s.files[key] = contentType
+	s.contents[key] = b
+	return nil
+}
+func (s *fakeStore) Get(key string) (io.ReadCloser, error) {
+	b, ok := s.contents[key]
+	if !ok {
+		return nil, objectstore.ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+func (s *fakeStore) Delete(key string) error {
+	s.deleted = append(s.deleted, key)
+	return nil
+}
+func (s *fakeStore) URL(key, filename string, expires time.Duration) (string, error) {
+	return "https://objects.example.com/" + key + "?filename=" + url.QueryEscape(filename), nil
+}
+
+// uploadFile posts a file in the named field to a page as its upload form
+// would
+func uploadFile(t *testing.T, ts *testutil.Server, pagePath, field, filename, content string) testutil.Response {
+	t.Helper()
+
+	page := ts.Get(t, pagePath)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	assert.NilError(t, mw.WriteField("csrf_token", testutil.ExtractCSRFToken(t, page.Body)))
+	fw, err := mw.CreateFormFile(field, filename)
+	assert.NilError(t, err)
+	io.WriteString(fw, content)
+	assert.NilError(t, mw.Close())
+
+	req := ts.NewRequest(t, http.MethodPost, pagePath, &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Referer", ts.URL+pagePath)
+	return ts.Do(t, req)
+}
+
+func TestSnippetAttachments(t *testing.T) {
+	app := newTestApplication(t)
+	store := &fakeStore{}
+	app.objects = store
+	app.config.Attachments = AttachmentConfig{MaxSize: 1024, URLExpiry: time.Minute}
+	ts := testutil.NewServer(t, app.routes())
+
+	rs := ts.Get(t, "/snippet/attachments/4")
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/user/login")
+
+	// Snippet 4 is private, so so are its files
+	rs = ts.Get(t, "/snippet/attachment/1")
+	assert.Equal(t, rs.Status, http.StatusNotFound)
+
+	ts.Login(t, "alice@example.com", "pa$$word")
+
+	rs = ts.Get(t, "/snippet/view/4")
+	assert.StringContains(t, rs.Body, `<a href="/snippet/attachment/1" rel="nofollow">diary.log</a> <span>1.5 KB</span>`)
+	assert.StringContains(t, rs.Body, `<a href="/snippet/attachments/4">Attachments</a>`)
+
+	rs = ts.Get(t, "/snippet/attachment/1")
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "https://objects.example.com/snippets/4/0f1e2d3c4b5a69788796a5b4c3d2e1f0?filename=diary.log")
+	assert.Equal(t, rs.Header.Get("Cache-Control"), "no-store")
+
+	rs = uploadFile(t, ts, "/snippet/attachments/4", "file", "build.log", "ok: 12 tests passed\n")
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/snippet/attachments/4")
+	assert.Equal(t, len(store.files), 1)
+	for key, contentType := range store.files {
+		assert.Equal(t, strings.HasPrefix(key, "snippets/4/"), true)
+		assert.Equal(t, contentType, "text/plain; charset=utf-8")
+	}
+
+	// The type is sniffed from the content, whatever the file is called
+	rs = uploadFile(t, ts, "/snippet/attachments/4", "file", "pond.png", "<html><script>alert(1)</script></html>")
+	assert.Equal(t, rs.Status, http.StatusUnprocessableEntity)
+	assert.StringContains(t, rs.Body, "Only images, text files, PDFs and gzip or zip archives can be attached")
+
+	rs = uploadFile(t, ts, "/snippet/attachments/4", "file", "empty.log", "")
+	assert.Equal(t, rs.Status, http.StatusUnprocessableEntity)
+	assert.StringContains(t, rs.Body, "This file is empty")
+
+	rs = uploadFile(t, ts, "/snippet/attachments/4", "file", "big.log", strings.Repeat("a", 2000))
+	assert.Equal(t, rs.Status, http.StatusUnprocessableEntity)
+	assert.StringContains(t, rs.Body, "Files can be up to 1 KB")
+
+	// Bodies far too large are turned away before being read
+	rs = uploadFile(t, ts, "/snippet/attachments/4", "file", "huge.log", strings.Repeat("a", 2*uploadOverhead))
+	assert.Equal(t, rs.Status, http.StatusRequestEntityTooLarge)
+	assert.Equal(t, len(store.files), 1)
+
+	rs = ts.Submit(t, "/snippet/attachments/4", "/snippet/attachment/1", url.Values{"_method": {"DELETE"}})
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/snippet/attachments/4")
+	assert.DeepEqual(t, store.deleted, []string{"snippets/4/0f1e2d3c4b5a69788796a5b4c3d2e1f0"})
+
+	rs = ts.Get(t, "/snippet/attachment/99")
+	assert.Equal(t, rs.Status, http.StatusNotFound)
+
+	// Only the owner manages attachments
+	rs = ts.Get(t, "/snippet/attachments/1")
+	assert.Equal(t, rs.Status, http.StatusForbidden)
+}
+
+func TestSnippetAttachmentsDisabled(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+	ts.Login(t, "alice@example.com", "pa$$word")
+
+	rs := ts.Get(t, "/snippet/attachments/4")
+	assert.Equal(t, rs.Status, http.StatusNotFound)
+
+	rs = ts.Get(t, "/snippet/view/4")
+	assert.Equal(t, strings.Contains(rs.Body, "/snippet/attachment"), false)
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"adotkaya.playground/internal/avatar"
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/objectstore"
+	"adotkaya.playground/internal/validator"
+)
+
+// =============================================================================
+// Avatars
+// =============================================================================
+// Users can upload a picture on their avatar page. It is cropped square and
+// stored as PNGs of each of avatarSizes, in a local directory or the S3
+// bucket, and served by /avatar/:id. Users without an avatar get an
+// identicon drawn from their ID instead, so every user has a picture that
+// stays the same from page to page. Links carry the avatar's version, or
+// none for the identicon, so browsers can keep whatever a link shows for
+// good: uploading or removing an avatar changes the link.
+
+// avatarSizes are the sizes avatars are stored at, in pixels square: small
+// for lists, large for profiles. Both suit screens of double density.
+var avatarSizes = []int{64, 256}
+
+const (
+	// avatarMaxPixels caps the dimensions of uploaded pictures, since they
+	// are decoded in full
+	avatarMaxPixels = 16 << 20
+
+	// avatarCacheAge is how long browsers keep a picture fetched by the
+	// current link to a user's avatar
+	avatarCacheAge = 365 * 24 * time.Hour
+
+	// staleAvatarCacheAge is how long browsers keep a picture fetched by an
+	// out of date link, which shows something else once caches catch up
+	staleAvatarCacheAge = time.Hour
+)
+
+// avatarStore keeps the resized pictures: an objectstore.Dir, or the S3
+// bucket
+type avatarStore interface {
+	Put(key, contentType string, body io.Reader, size int64) error
+	Get(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+// userAvatar is the user's avatar shown on the avatar page
+type userAvatar struct {
+	URL      string
+	Uploaded bool // False for an identicon
+}
+
+// avatarForm represents the avatar upload form; the picture itself is
+// read from the multipart body
+type avatarForm struct {
+	validator.Validator `form:"-"`
+}
+
+// avatarKey names a stored size of a version of a user's avatar
+func avatarKey(userID, version, size int) string {
+	return fmt.Sprintf("avatars/%d/%d-%d.png", userID, version, size)
+}
+
+// avatarPath returns the link to a version of a user's avatar of one of
+// avatarSizes, or to their identicon for version 0. Templates use it as
+// avatarURL for lists that know their users' avatar versions.
+func avatarPath(userID, version, size int) string {
+	if version == 0 {
+		return fmt.Sprintf("/avatar/%d?s=%d", userID, size)
+	}
+	return fmt.Sprintf("/avatar/%d?s=%d&v=%d", userID, size, version)
+}
+
+// avatarURL returns the link to a user's current avatar of one of
+// avatarSizes
+func (app *application) avatarURL(userID, size int) (string, error) {
+	a, err := app.avatars.Get(userID)
+	if errors.Is(err, models.ErrNoRecord) {
+		return avatarPath(userID, 0, size), nil
+	} else if err != nil {
+		return "", err
+	}
+	return avatarPath(userID, a.Version, size), nil
+}
+
+// accountAvatar shows the user's avatar with the form to upload one
+func (app *application) accountAvatar(w http.ResponseWriter, r *http.Request) {
+	app.renderAvatar(w, r, http.StatusOK, avatarForm{})
+}
+
+// accountAvatarPost resizes an uploaded picture and makes it the user's
+// avatar
+func (app *application) accountAvatarPost(w http.ResponseWriter, r *http.Request) {
+	userID := userIDKey.Get(app.sessionManager, r.Context())
+
+	var form avatarForm
+	file, header, err := r.FormFile("avatar")
+	if errors.Is(err, http.ErrMissingFile) {
+		form.AddFieldError("avatar", app.translate(r, "validation.blank"))
+		app.renderAvatar(w, r, http.StatusUnprocessableEntity, form)
+		return
+	} else if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	maxSize := int64(app.config.Avatars.MaxSize)
+	form.CheckField(header.Size <= maxSize, "avatar", app.translate(r, "validation.avatar_size", humanSize(maxSize)))
+	if !form.Valid() {
+		app.renderAvatar(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	b, err := io.ReadAll(file)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	img, err := avatar.Decode(b, avatarMaxPixels)
+	switch {
+	case errors.Is(err, avatar.ErrFormat):
+		form.AddFieldError("avatar", app.translate(r, "validation.avatar_type"))
+	case errors.Is(err, avatar.ErrDimensions):
+		form.AddFieldError("avatar", app.translate(r, "validation.avatar_dimensions"))
+	case err != nil:
+		app.serverError(w, err)
+		return
+	}
+	if !form.Valid() {
+		app.renderAvatar(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	current, err := app.avatars.Get(userID)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return
+	}
+	version := 1
+	if current != nil {
+		version = current.Version + 1
+	}
+
+	for _, size := range avatarSizes {
+		var buf bytes.Buffer
+		if err := avatar.Encode(&buf, avatar.Resize(img, size)); err != nil {
+			app.serverError(w, err)
+			return
+		}
+		n := int64(buf.Len())
+		if err := app.avatarStore.Put(avatarKey(userID, version, size), "image/png", &buf, n); err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	err = app.avatars.Set(userID, version)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if current != nil {
+		app.deleteAvatarFiles(userID, current.Version)
+	}
+
+	app.putFlash(r, app.translate(r, "flash.avatar_updated"))
+	http.Redirect(w, r, "/account/avatar", http.StatusSeeOther)
+}
+
+// accountAvatarDelete removes the user's avatar, leaving them with an
+// identicon
+func (app *application) accountAvatarDelete(w http.ResponseWriter, r *http.Request) {
+	userID := userIDKey.Get(app.sessionManager, r.Context())
+
+	current, err := app.avatars.Get(userID)
+	if errors.Is(err, models.ErrNoRecord) {
+		http.Redirect(w, r, "/account/avatar", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.avatars.Delete(userID)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return
+	}
+	app.deleteAvatarFiles(userID, current.Version)
+
+	app.putFlash(r, app.translate(r, "flash.avatar_removed"))
+	http.Redirect(w, r, "/account/avatar", http.StatusSeeOther)
+}
+
+// renderAvatar renders the avatar page with its form
+func (app *application) renderAvatar(w http.ResponseWriter, r *http.Request, status int, form avatarForm) {
+	userID := userIDKey.Get(app.sessionManager, r.Context())
+
+	_, err := app.avatars.Get(userID)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return
+	}
+	uploaded := err == nil
+	url, err := app.avatarURL(userID, avatarSizes[len(avatarSizes)-1])
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Avatar = &userAvatar{URL: url, Uploaded: uploaded}
+	data.MaxUpload = int64(app.config.Avatars.MaxSize)
+	data.Form = form
+	data.Breadcrumbs = app.breadcrumbs(r, Crumb{Label: app.translate(r, "avatar.title")})
+	app.render(w, status, "avatar.tmpl", data)
+}
+
+// deleteAvatarFiles removes the stored sizes of a version of a user's
+// avatar. Its record is already gone or replaced, so a failure only leaves
+// stray files and is just logged.
+func (app *application) deleteAvatarFiles(userID, version int) {
+	for _, size := range avatarSizes {
+		key := avatarKey(userID, version, size)
+		if err := app.avatarStore.Delete(key); err != nil {
+			app.logger.Error("delete avatar", "key", key, "error", err)
+		}
+	}
+}
+
+// avatar serves a user's avatar at the size in the s query parameter, or
+// the smallest, falling back to their identicon. It runs without the
+// session, so responses can be cached by anything in between. Only the
+// current link is cached for long; see avatarPath.
+func (app *application) avatar(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	size := avatarSizes[0]
+	if s := r.URL.Query().Get("s"); s != "" {
+		size, err = strconv.Atoi(s)
+		if err != nil || !slices.Contains(avatarSizes, size) {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+	}
+
+	a, err := app.avatars.Get(id)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return
+	}
+	if a != nil {
+		f, err := app.avatarStore.Get(avatarKey(id, a.Version, size))
+		if err == nil {
+			defer f.Close()
+			b, err := io.ReadAll(f)
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+
+			current := r.URL.Query().Get("v") == strconv.Itoa(a.Version)
+			setAvatarCacheControl(w, current)
+			w.Header().Set("Content-Type", "image/png")
+			w.Header().Set("ETag", fmt.Sprintf(`"%d-%d"`, a.Version, size))
+			http.ServeContent(w, r, "", a.Updated, bytes.NewReader(b))
+			return
+		}
+		// A missing file falls back to the identicon
+		if !errors.Is(err, objectstore.ErrNotFound) {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	// Identicons depend on nothing but the ID and size, so the link
+	// without a version always shows the same one
+	var buf bytes.Buffer
+	if err := avatar.Encode(&buf, avatar.Identicon(identiconSeed(id), size)); err != nil {
+		app.serverError(w, err)
+		return
+	}
+	setAvatarCacheControl(w, a == nil && !r.URL.Query().Has("v"))
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("ETag", fmt.Sprintf(`"identicon-%d"`, size))
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(buf.Bytes()))
+}
+
+// identiconSeed returns what a user's identicon is drawn from. It is their
+// ID rather than their email, which would change the picture along with
+// the address and could be guessed back from it.
+func identiconSeed(userID int) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// setAvatarCacheControl lets anything cache an avatar response: for a
+// year without checking back if it was fetched by the current link, and
+// for an hour otherwise
+func setAvatarCacheControl(w http.ResponseWriter, current bool) {
+	if current {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", int(avatarCacheAge.Seconds())))
+		return
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(staleAvatarCacheAge.Seconds())))
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+// testPNG returns a PNG picture of the given dimensions
+func testPNG(t *testing.T, width, height int) string {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = 0x80
+	}
+	img.Set(0, 0, color.Black)
+	var buf bytes.Buffer
+	assert.NilError(t, png.Encode(&buf, img))
+	return buf.String()
+}
+
+// decodePNG decodes a served avatar
+func decodePNG(t *testing.T, body string) image.Image {
+	t.Helper()
+
+	img, err := png.Decode(strings.NewReader(body))
+	assert.NilError(t, err)
+	return img
+}
+
+func TestAccountAvatar(t *testing.T) {
+	app := newTestApplication(t)
+	store := &fakeStore{}
+	app.avatarStore = store
+	app.config.Avatars = AvatarConfig{MaxSize: 4096}
+	ts := testutil.NewServer(t, app.routes())
+
+	rs := ts.Get(t, "/account/avatar")
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/user/login")
+
+	ts.Login(t, "alice@example.com", "pa$$word")
+
+	rs = ts.Get(t, "/account/avatar")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.StringContains(t, rs.Body, `src="/avatar/1?s=256&amp;v=2"`)
+	assert.StringContains(t, rs.Body, "Remove avatar")
+
+	rs = uploadFile(t, ts, "/account/avatar", "avatar", "me.png", testPNG(t, 300, 200))
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/account/avatar")
+	assert.Equal(t, store.files["avatars/1/3-64.png"], "image/png")
+	assert.Equal(t, store.files["avatars/1/3-256.png"], "image/png")
+	assert.Equal(t, decodePNG(t, string(store.contents["avatars/1/3-64.png"])).Bounds(), image.Rect(0, 0, 64, 64))
+	// The previous version's files go
+	assert.DeepEqual(t, store.deleted, []string{"avatars/1/2-64.png", "avatars/1/2-256.png"})
+
+	rs = uploadFile(t, ts, "/account/avatar", "avatar", "me.png", "<svg></svg>")
+	assert.Equal(t, rs.Status, http.StatusUnprocessableEntity)
+	assert.StringContains(t, rs.Body, "Only PNG, JPEG and GIF pictures can be used")
+
+	rs = uploadFile(t, ts, "/account/avatar", "avatar", "me.png", strings.Repeat("a", 5000))
+	assert.Equal(t, rs.Status, http.StatusUnprocessableEntity)
+	assert.StringContains(t, rs.Body, "Pictures can be up to 4 KB")
+
+	store.deleted = nil
+	rs = ts.Submit(t, "/account/avatar", "/account/avatar", url.Values{"_method": {"DELETE"}})
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/account/avatar")
+	assert.DeepEqual(t, store.deleted, []string{"avatars/1/2-64.png", "avatars/1/2-256.png"})
+}
+
+func TestAvatar(t *testing.T) {
+	app := newTestApplication(t)
+	store := &fakeStore{}
+	app.avatarStore = store
+	ts := testutil.NewServer(t, app.routes())
+
+	// Carol has no avatar, so gets her identicon, the same every time
+	rs := ts.Get(t, "/avatar/3")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.Equal(t, rs.Header.Get("Content-Type"), "image/png")
+	assert.Equal(t, rs.Header.Get("Cache-Control"), "public, max-age=31536000, immutable")
+	assert.Equal(t, decodePNG(t, rs.Body).Bounds(), image.Rect(0, 0, 64, 64))
+	identicon := rs.Body
+	assert.Equal(t, ts.Get(t, "/avatar/3").Body, identicon)
+
+	// A link to an avatar she has since removed
+	rs = ts.Get(t, "/avatar/3?v=1")
+	assert.Equal(t, rs.Body, identicon)
+	assert.Equal(t, rs.Header.Get("Cache-Control"), "public, max-age=3600")
+
+	req := ts.NewRequest(t, http.MethodGet, "/avatar/3", nil)
+	req.Header.Set("If-None-Match", rs.Header.Get("ETag"))
+	assert.Equal(t, ts.Do(t, req).Status, http.StatusNotModified)
+
+	rs = ts.Get(t, "/avatar/3?s=256")
+	assert.Equal(t, decodePNG(t, rs.Body).Bounds(), image.Rect(0, 0, 256, 256))
+
+	// Alice's files are missing until stored
+	rs = ts.Get(t, "/avatar/1?v=2")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.Equal(t, rs.Body == identicon, false)
+	assert.Equal(t, rs.Header.Get("Cache-Control"), "public, max-age=3600")
+
+	uploaded := testPNG(t, 64, 64)
+	assert.NilError(t, store.Put("avatars/1/2-64.png", "image/png", strings.NewReader(uploaded), int64(len(uploaded))))
+
+	rs = ts.Get(t, "/avatar/1?s=64&v=2")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.Equal(t, rs.Body, uploaded)
+	assert.Equal(t, rs.Header.Get("Cache-Control"), "public, max-age=31536000, immutable")
+	assert.Equal(t, rs.Header.Get("ETag"), `"2-64"`)
+
+	// Links to an old version are cached briefly
+	rs = ts.Get(t, "/avatar/1?v=1")
+	assert.Equal(t, rs.Header.Get("Cache-Control"), "public, max-age=3600")
+
+	req = ts.NewRequest(t, http.MethodGet, "/avatar/1?v=2", nil)
+	req.Header.Set("If-None-Match", `"2-64"`)
+	rs = ts.Do(t, req)
+	assert.Equal(t, rs.Status, http.StatusNotModified)
+
+	for _, path := range []string{"/avatar/1?s=100", "/avatar/1?s=big", "/avatar/0", "/avatar/alice"} {
+		rs = ts.Get(t, path)
+		assert.Equal(t, rs.Status, http.StatusNotFound)
+	}
+}
+
+func TestAvatarLinks(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+
+	rs := ts.Get(t, "/user/profile/1")
+	assert.StringContains(t, rs.Body, `<img class="avatar" src="/avatar/1?s=256&amp;v=2"`)
+	rs = ts.Get(t, "/user/profile/3")
+	assert.StringContains(t, rs.Body, `<img class="avatar" src="/avatar/3?s=256"`)
+
+	ts.Login(t, "admin@example.com", "pa$$word")
+	rs = ts.Get(t, "/feed")
+	assert.StringContains(t, rs.Body, `<img class="avatar" src="/avatar/1?s=64&amp;v=2"`)
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"adotkaya.playground/internal/models"
+)
+
+// =============================================================================
+// Backups
+// =============================================================================
+
+const (
+	backupJobKind     = "backup"
+	backupMaxAttempts = 3
+	backupRecentLimit = 20 // Backups listed on the admin page
+)
+
+// backupJob is the payload of a backup job
+type backupJob struct {
+	File      string `json:"file"` // Name of the archive in the backup directory
+	Passwords bool   `json:"passwords"`
+}
+
+// backupRun is a backup job with its payload, for the admin backups page
+type backupRun struct {
+	*models.Job
+	File      string
+	Passwords bool
+}
+
+// backupForm is the admin form requesting a backup
+type backupForm struct {
+	Passwords bool `form:"passwords"`
+}
+
+// backupFileName names an archive after the time it was requested
+func backupFileName(t time.Time) string {
+	return "snippetbox-" + t.UTC().Format("20060102-150405") + ".ndjson"
+}
+
+// adminBackups lists recent backups with a form to request another
+func (app *application) adminBackups(w http.ResponseWriter, r *http.Request) {
+	jobs, err := app.jobs.Recent(backupJobKind, backupRecentLimit)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	runs := make([]backupRun, 0, len(jobs))
+	for _, j := range jobs {
+		var payload backupJob
+		// A payload that doesn't decode still shows its status and error
+		json.Unmarshal(j.Payload, &payload)
+		runs = append(runs, backupRun{Job: j, File: payload.File, Passwords: payload.Passwords})
+	}
+
+	data := app.newTemplateData(r)
+	data.Backups = runs
+	data.BackupDir = app.config.Backup.Dir
+	data.Breadcrumbs = app.breadcrumbs(r, Crumb{Label: app.translate(r, "admin_backups.title")})
+	app.render(w, http.StatusOK, "admin_backups.tmpl", data)
+}
+
+// adminBackupsPost queues a backup, which the job worker writes to the
+// backup directory
+func (app *application) adminBackupsPost(w http.ResponseWriter, r *http.Request) {
+	var form backupForm
+	if err := app.decodePostForm(r, &form); err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	job := backupJob{File: backupFileName(time.Now()), Passwords: form.Passwords}
+	if _, err := app.jobs.Enqueue(backupJobKind, job, backupMaxAttempts); err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	detail := ""
+	if job.Passwords {
+		detail = "passwords"
+	}
+	app.recordAudit(r, models.AuditBackup, "backup:"+job.File, detail)
+
+	app.putFlash(r, app.translate(r, "flash.backup_queued", job.File))
+	http.Redirect(w, r, "/admin/backups", http.StatusSeeOther)
+}
+
+// runBackupJob is the job handler writing a requested backup to the backup
+// directory
+func (app *application) runBackupJob(payload []byte) error {
+	var job backupJob
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return permanent(err)
+	}
+	// The name is only ever set by adminBackupsPost, but make sure it stays
+	// inside the directory
+	if job.File == "" || filepath.Base(job.File) != job.File {
+		return permanent(fmt.Errorf("invalid backup file name %q", job.File))
+	}
+
+	path := filepath.Join(app.config.Backup.Dir, job.File)
+	stats, err := writeBackupFile(app.backups, path, job.Passwords)
+	if err != nil {
+		return err
+	}
+
+	app.logger.Info("Backed up the database", "stats", formatBackupStats(stats), "path", path)
+	return nil
+}
+
+// writeBackupFile exports an archive to path. It is written to a temporary
+// file which is renamed once complete, so path only ever holds a whole
+// archive. Archives can hold password hashes, so only the owner may read
+// them.
+func writeBackupFile(backups models.BackupModelInterface, path string, passwords bool) (models.BackupStats, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return models.BackupStats{}, err
+	}
+
+	f, err := os.CreateTemp(dir, ".backup-*")
+	if err != nil {
+		return models.BackupStats{}, err
+	}
+	// Fails harmlessly once the file has been renamed
+	defer os.Remove(f.Name())
+
+	stats, err := backups.Export(f, passwords)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return models.BackupStats{}, err
+	}
+
+	if err = os.Rename(f.Name(), path); err != nil {
+		return models.BackupStats{}, err
+	}
+	return stats, nil
+}
+
+// formatBackupStats describes what an archive holds
+func formatBackupStats(s models.BackupStats) string {
+	return fmt.Sprintf("%d users, %d snippets, %d days of views, %d follows, %d notification preferences and %d quotas",
+		s.Users, s.Snippets, s.Views, s.Follows, s.Preferences, s.Quotas)
+}
+
+// =============================================================================
+// Backup and Restore Subcommands
+// =============================================================================
+
+// runBackup implements `web backup`: it writes an archive of the database
+// configured in the environment to a file or, without -o, to stdout.
+// Messages go to stderr. It returns the process exit code.
+func runBackup(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	output := fs.String("o", "", "Archive file to write (default standard output)")
+	passwords := fs.Bool("passwords", true, "Include users' password hashes")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintln(stderr, "backup: unexpected arguments:", fs.Args())
+		return 2
+	}
+
+	cfg, pool, err := commandDB(false)
+	if err != nil {
+		fmt.Fprintln(stderr, "backup:", err)
+		return 1
+	}
+	defer pool.Close()
+
+	backups := &models.BackupModel{DB: pool}
+	var stats models.BackupStats
+	if *output == "" {
+		stats, err = backups.Export(stdout, *passwords)
+	} else {
+		stats, err = writeBackupFile(backups, *output, *passwords)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "backup:", err)
+		return 1
+	}
+
+	fmt.Fprintf(stderr, "Backed up %s from %s\n", formatBackupStats(stats), cfg.Database.Name)
+	return 0
+}
+
+// runRestore implements `web restore`: it checks an archive and imports it
+// into the empty database configured in the environment, after applying
+// migrations if they are applied automatically. With -check it only checks
+// the archive. It returns the process exit code.
+func runRestore(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	fs.SetOutput(out)
+	check := fs.Bool("check", false, "Only check the archive; don't restore it")
+	fs.Usage = func() {
+		fmt.Fprintln(out, "Usage: web restore [-check] ARCHIVE")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(out, "restore:", err)
+		return 1
+	}
+	defer f.Close()
+
+	if *check {
+		stats, err := models.ValidateBackup(f)
+		if err != nil {
+			fmt.Fprintln(out, "restore:", err)
+			return 1
+		}
+		fmt.Fprintf(out, "Archive is valid: %s\n", formatBackupStats(stats))
+		return 0
+	}
+
+	cfg, pool, err := commandDB(true)
+	if err != nil {
+		fmt.Fprintln(out, "restore:", err)
+		return 1
+	}
+	defer pool.Close()
+
+	// Content sealed at rest needs the keys it was sealed with
+	var keys *models.ContentKeys
+	if len(cfg.Content.Keys) > 0 {
+		if keys, err = models.NewContentKeys(cfg.Content.Keys); err != nil {
+			fmt.Fprintln(out, "restore:", err)
+			return 1
+		}
+	}
+
+	stats, err := (&models.BackupModel{DB: pool, Keys: keys}).Restore(f)
+	if err != nil {
+		if errors.Is(err, models.ErrRestoreNotEmpty) {
+			fmt.Fprintf(out, "restore: %s already has users or snippets; restore into a new database\n", cfg.Database.Name)
+		} else {
+			fmt.Fprintln(out, "restore:", err)
+		}
+		return 1
+	}
+
+	fmt.Fprintf(out, "Restored %s\n", formatBackupStats(stats))
+	return 0
+}
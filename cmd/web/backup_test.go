@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/models/mocks"
+	"adotkaya.playground/internal/testutil"
+)
+
+// backupJobs is a job queue that has run a backup
+type backupJobs struct {
+	fakeJobs
+}
+
+func (j *backupJobs) Recent(kind string, limit int) ([]*models.Job, error) {
+	if kind != backupJobKind {
+		return nil, nil
+	}
+	return []*models.Job{{
+		ID:          7,
+		Kind:        backupJobKind,
+		Payload:     json.RawMessage(`{"file":"snippetbox-20260101-030000.ndjson","passwords":true}`),
+		Status:      models.JobFailed,
+		Attempts:    3,
+		MaxAttempts: 3,
+		LastError:   "no space left on device",
+	}}, nil
+}
+
+func TestAdminBackups(t *testing.T) {
+	app := newTestApplication(t)
+	jobs := &backupJobs{}
+	app.jobs = jobs
+	audit := &recordingAudit{}
+	app.audit = audit
+	app.config.Backup.Dir = "/var/backups/snippetbox"
+	ts := testutil.NewServer(t, app.routes())
+
+	ts.Login(t, "alice@example.com", "pa$$word")
+	rs := ts.Get(t, "/admin/backups")
+	assert.Equal(t, rs.Status, http.StatusForbidden)
+
+	ts.Login(t, "admin@example.com", "pa$$word")
+	rs = ts.Get(t, "/admin/backups")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.StringContains(t, rs.Body, "/var/backups/snippetbox")
+	assert.StringContains(t, rs.Body, "snippetbox-20260101-030000.ndjson")
+	assert.StringContains(t, rs.Body, "With password hashes")
+	assert.StringContains(t, rs.Body, "no space left on device")
+
+	rs = ts.Submit(t, "/admin/backups", "/admin/backups", url.Values{"passwords": {"true"}})
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/admin/backups")
+
+	assert.Equal(t, len(jobs.enqueued), 1)
+	job := jobs.enqueued[0].(backupJob)
+	assert.Equal(t, job.Passwords, true)
+	assert.Equal(t, len(audit.entries), 1)
+	assert.Equal(t, audit.entries[0], auditRecord{3, models.AuditBackup, "backup:" + job.File, "passwords"})
+
+	rs = ts.Get(t, "/admin/backups")
+	assert.StringContains(t, rs.Body, "Backup "+job.File+" has been queued.")
+}
+
+func TestBackupJob(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.Backup.Dir = filepath.Join(t.TempDir(), "backups")
+
+	err := app.runBackupJob([]byte(`{"file":"nightly.ndjson"}`))
+	assert.NilError(t, err)
+
+	path := filepath.Join(app.config.Backup.Dir, "nightly.ndjson")
+	info, err := os.Stat(path)
+	assert.NilError(t, err)
+	assert.Equal(t, info.Mode().Perm(), os.FileMode(0o600))
+
+	b, err := os.ReadFile(path)
+	assert.NilError(t, err)
+	stats, err := models.ValidateBackup(bytes.NewReader(b))
+	assert.NilError(t, err)
+	assert.Equal(t, stats.Users, 2)
+
+	// Only the archive is left in the directory
+	entries, err := os.ReadDir(app.config.Backup.Dir)
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 1)
+
+	for _, payload := range []string{`{"file":"../escape.ndjson"}`, `{"file":""}`, `{`} {
+		err = app.runBackupJob([]byte(payload))
+		var perm permanentError
+		if !errors.As(err, &perm) {
+			t.Errorf("payload %s: got %v; want a permanent error", payload, err)
+		}
+	}
+}
+
+func TestRunRestoreCheck(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.ndjson")
+	var archive bytes.Buffer
+	_, err := (&mocks.BackupModel{}).Export(&archive, false)
+	assert.NilError(t, err)
+	assert.NilError(t, os.WriteFile(valid, archive.Bytes(), 0o600))
+
+	truncated := filepath.Join(dir, "truncated.ndjson")
+	assert.NilError(t, os.WriteFile(truncated, archive.Bytes()[:archive.Len()/2], 0o600))
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+		wantOut  string
+	}{
+		{"Valid", []string{"-check", valid}, 0, "Archive is valid: 2 users, 0 snippets"},
+		{"Truncated", []string{"-check", truncated}, 1, "invalid backup archive"},
+		{"Missing", []string{"-check", filepath.Join(dir, "missing.ndjson")}, 1, "no such file"},
+		{"No archive", []string{"-check"}, 2, "Usage: web restore"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			code := runRestore(tt.args, &out)
+			assert.Equal(t, code, tt.wantCode)
+			assert.StringContains(t, out.String(), tt.wantOut)
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"sync"
+	"time"
+
+	"adotkaya.playground/internal/models"
+)
+
+// =============================================================================
+// IP Bans
+// =============================================================================
+
+// banRefreshInterval is how often the ban list is reloaded, bounding how
+// long a ban added on another instance takes to apply here
+const banRefreshInterval = 30 * time.Second
+
+// banDurations are the ban lengths offered on the admin page, in hours.
+// 0 is permanent.
+var banDurations = []int{1, 24, 168, 720, 0}
+
+// banList is an in-memory copy of the active IP bans, so checking a request
+// costs no database round trip
+type banList struct {
+	model  models.BanModelInterface
+	logger *slog.Logger
+
+	mu   sync.RWMutex
+	bans []*models.IPBan
+}
+
+// newBanList creates an empty ban list backed by model
+func newBanList(model models.BanModelInterface, logger *slog.Logger) *banList {
+	return &banList{model: model, logger: logger}
+}
+
+// refresh reloads the active bans from the database
+func (b *banList) refresh() error {
+	bans, err := b.model.Active()
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.bans = bans
+	b.mu.Unlock()
+	return nil
+}
+
+// run refreshes the list every banRefreshInterval until ctx is cancelled.
+// On failure the previous list stays in force.
+func (b *banList) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(banRefreshInterval):
+		}
+
+		if err := b.refresh(); err != nil {
+			b.logger.Error("refresh ip bans", "error", err)
+		}
+	}
+}
+
+// banned reports whether ip is covered by an active ban
+func (b *banList) banned(ip netip.Addr) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	now := time.Now()
+	for _, ban := range b.bans {
+		if ban.Network.Contains(ip) && ban.Active(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// rejectBanned responds 403 Forbidden to banned clients before any other
+// work is done for them
+func (app *application) rejectBanned(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.bans != nil && app.bans.banned(app.clientIP(r)) {
+			w.Header().Set("Connection", "close")
+			app.clientError(w, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// renderBans renders the admin bans page with the active bans and the add
+// form held in data
+func (app *application) renderBans(w http.ResponseWriter, r *http.Request, status int, data *templateData) {
+	bans, err := app.bans.model.Active()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data.Bans = bans
+	data.BanDurations = banDurations
+	data.Breadcrumbs = app.breadcrumbs(r, Crumb{Label: app.translate(r, "admin_bans.title")})
+	app.render(w, status, "admin_bans.tmpl", data)
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"testing"
+	"time"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/models/mocks"
+	"adotkaya.playground/internal/testutil"
+)
+
+// expiredBans returns a ban that ran out while the list was cached
+type expiredBans struct {
+	mocks.BanModel
+}
+
+func (m *expiredBans) Active() ([]*models.IPBan, error) {
+	return []*models.IPBan{{
+		ID:      1,
+		Network: netip.MustParsePrefix("192.0.2.0/24"),
+		Expires: time.Now().Add(-time.Minute),
+	}}, nil
+}
+
+func TestBanListBanned(t *testing.T) {
+	bans := newBanList(&mocks.BanModel{}, slog.New(slog.DiscardHandler))
+	assert.NilError(t, bans.refresh())
+
+	assert.Equal(t, bans.banned(netip.MustParseAddr("198.51.100.7")), true)
+	assert.Equal(t, bans.banned(netip.MustParseAddr("198.51.100.8")), false)
+	assert.Equal(t, bans.banned(netip.MustParseAddr("203.0.113.200")), true)
+	assert.Equal(t, bans.banned(netip.MustParseAddr("2001:db8::1")), false)
+
+	expired := newBanList(&expiredBans{}, slog.New(slog.DiscardHandler))
+	assert.NilError(t, expired.refresh())
+	assert.Equal(t, expired.banned(netip.MustParseAddr("192.0.2.1")), false)
+}
+
+func TestRejectBanned(t *testing.T) {
+	proxies, err := parsePrefixes("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		wantCode   int
+	}{
+		{
+			name:       "Allowed",
+			remoteAddr: "192.0.2.1:1234",
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "Banned address",
+			remoteAddr: "198.51.100.7:1234",
+			wantCode:   http.StatusForbidden,
+		},
+		{
+			name:       "Banned network",
+			remoteAddr: "203.0.113.45:1234",
+			wantCode:   http.StatusForbidden,
+		},
+		{
+			name:       "Banned behind proxy",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  "203.0.113.45",
+			wantCode:   http.StatusForbidden,
+		},
+		{
+			name:       "Spoofed header",
+			remoteAddr: "198.51.100.7:1234",
+			forwarded:  "192.0.2.1",
+			wantCode:   http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.Server.TrustedProxies = proxies
+
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("OK"))
+			})
+			app.rejectBanned(next).ServeHTTP(rr, r)
+
+			assert.Equal(t, rr.Code, tt.wantCode)
+		})
+	}
+}
+
+func TestAdminBans(t *testing.T) {
+	tests := []struct {
+		name      string
+		email     string
+		wantCode  int
+		wantBody  []string
+		wantRedir string
+	}{
+		{
+			name:      "Anonymous",
+			wantCode:  http.StatusSeeOther,
+			wantRedir: "/user/login",
+		},
+		{
+			name:     "Regular user",
+			email:    "alice@example.com",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Admin",
+			email:    "admin@example.com",
+			wantCode: http.StatusOK,
+			wantBody: []string{
+				"<h2>Active IP Bans</h2>",
+				"<code>198.51.100.7/32</code>",
+				"<td>Credential stuffing</td>",
+				"<td>Never</td>",
+				`action="/admin/bans/2/delete"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := testutil.NewServer(t, app.routes())
+			if tt.email != "" {
+				ts.Login(t, tt.email, "pa$$word")
+			}
+
+			rs := ts.Get(t, "/admin/bans")
+			assert.Equal(t, rs.Status, tt.wantCode)
+			if tt.wantRedir != "" {
+				assert.Equal(t, rs.Header.Get("Location"), tt.wantRedir)
+			}
+			for _, want := range tt.wantBody {
+				assert.StringContains(t, rs.Body, want)
+			}
+		})
+	}
+}
+
+func TestAdminBansPost(t *testing.T) {
+	tests := []struct {
+		name     string
+		network  string
+		reason   string
+		hours    string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Single address",
+			network:  "192.0.2.1",
+			reason:   "Scraping",
+			hours:    "24",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Network",
+			network:  "192.0.2.0/24",
+			reason:   "Scraping",
+			hours:    "0",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Invalid network",
+			network:  "192.0.2.0/33",
+			reason:   "Scraping",
+			hours:    "24",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field must be an IP address or CIDR network",
+		},
+		{
+			name:     "Own address",
+			network:  "127.0.0.0/8",
+			reason:   "Oops",
+			hours:    "24",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This would ban your own address",
+		},
+		{
+			name:     "Blank reason",
+			network:  "192.0.2.1",
+			hours:    "24",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field cannot be blank",
+		},
+		{
+			name:     "Unlisted duration",
+			network:  "192.0.2.1",
+			reason:   "Scraping",
+			hours:    "5",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "Please choose one of the listed durations",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := testutil.NewServer(t, app.routes())
+			ts.Login(t, "admin@example.com", "pa$$word")
+
+			form := url.Values{}
+			form.Add("network", tt.network)
+			form.Add("reason", tt.reason)
+			form.Add("hours", tt.hours)
+			rs := ts.Submit(t, "/admin/bans", "/admin/bans", form)
+
+			assert.Equal(t, rs.Status, tt.wantCode)
+			if tt.wantCode == http.StatusSeeOther {
+				assert.Equal(t, rs.Header.Get("Location"), "/admin/bans")
+			}
+			if tt.wantBody != "" {
+				assert.StringContains(t, rs.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestAdminBanDelete(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+	ts.Login(t, "admin@example.com", "pa$$word")
+
+	rs := ts.Submit(t, "/admin/bans", "/admin/bans/2/delete", url.Values{})
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/admin/bans")
+
+	rs = ts.Get(t, "/admin/bans")
+	assert.StringContains(t, rs.Body, "The ban has been lifted.")
+
+	rs = ts.Submit(t, "/admin/bans", "/admin/bans/99/delete", url.Values{})
+	assert.Equal(t, rs.Status, http.StatusNotFound)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// =============================================================================
+// Bot Traps
+// =============================================================================
+
+const (
+	// honeypotField is a form field hidden from people, so only bots that
+	// fill in every field fill it in
+	honeypotField = "website"
+
+	// formStartedField carries the signed time a form was rendered, so
+	// forms submitted faster than a person could fill them in are caught
+	formStartedField = "form_started"
+)
+
+// botRejections counts submissions refused by the bot traps, by trap
+var botRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "snippetbox",
+	Subsystem: "bot_traps",
+	Name:      "rejections_total",
+	Help:      "Form submissions refused as coming from bots.",
+}, []string{"trap"})
+
+// formStarted returns the token for a form's formStartedField. A form
+// re-rendered after a failed submission keeps the token it was posted
+// with, so the visitor isn't timed from the re-render.
+func (app *application) formStarted(r *http.Request) string {
+	if token := r.PostFormValue(formStartedField); token != "" {
+		if _, ok := app.formStartedAt(token); ok {
+			return token
+		}
+	}
+	stamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	return stamp + "." + app.sign("form_started:"+stamp)
+}
+
+// formStartedAt returns the time in a formStartedField token, reporting
+// false if it is malformed or its signature doesn't match
+func (app *application) formStartedAt(token string) (time.Time, bool) {
+	stamp, sig, ok := strings.Cut(token, ".")
+	if !ok || !app.validSignature("form_started:"+stamp, sig) {
+		return time.Time{}, false
+	}
+	ms, err := strconv.ParseInt(stamp, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(ms), true
+}
+
+// botTrap returns the name of the trap a form submission fell into, or ""
+// if it looks like a person's: "honeypot" if the hidden field was filled
+// in, "time" if the form came back sooner than the minimum fill time or
+// without a valid start time. The time trap is off when the minimum fill
+// time is zero.
+func (app *application) botTrap(r *http.Request) string {
+	if r.PostFormValue(honeypotField) != "" {
+		return "honeypot"
+	}
+
+	if minFill := app.config.Bots.MinFillTime; minFill > 0 {
+		started, ok := app.formStartedAt(r.PostFormValue(formStartedField))
+		if !ok || time.Since(started) < minFill {
+			return "time"
+		}
+	}
+
+	return ""
+}
+
+// trapBots quietly turns away form submissions caught by a bot trap,
+// redirecting them home as if they had worked, so bots aren't told what
+// gave them away. It runs before the handler, so caught submissions never
+// reach the CAPTCHA or the database.
+func (app *application) trapBots(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if trap := app.botTrap(r); trap != "" {
+			botRejections.WithLabelValues(trap).Inc()
+			app.logger.InfoContext(r.Context(), "Bot trap caught a submission", "trap", trap, "method", r.Method, "path", r.URL.Path, "client", app.clientIP(r))
+			app.redirect(w, r, "/")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+var formStartedRX = regexp.MustCompile(`name="form_started" value="([^"]+)"`)
+
+// startedAgo returns a form_started token for a form rendered d ago
+func startedAgo(app *application, d time.Duration) string {
+	stamp := strconv.FormatInt(time.Now().Add(-d).UnixMilli(), 10)
+	return stamp + "." + app.sign("form_started:"+stamp)
+}
+
+func TestBotTraps(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.Bots.MinFillTime = 3 * time.Second
+	snippets := &countingSnippets{}
+	app.snippets = snippets
+	ts := testutil.NewServer(t, app.routes())
+	ts.Login(t, "alice@example.com", "pa$$word")
+
+	snippet := url.Values{
+		"title":   {"O snail"},
+		"content": {"O snail\nClimb Mount Fuji,\nBut slowly, slowly!"},
+		"expires": {"7"},
+	}
+
+	tests := []struct {
+		name      string
+		honeypot  string
+		started   string
+		wantRedir string
+	}{
+		{"Person", "", startedAgo(app, time.Minute), "/snippet/view/1"},
+		{"Honeypot filled in", "https://spam.example.com", startedAgo(app, time.Minute), "/"},
+		{"Too fast", "", startedAgo(app, time.Second), "/"},
+		{"No start time", "", "", "/"},
+		{"Forged start time", "", "1.forged", "/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"website": {tt.honeypot}, "form_started": {tt.started}}
+			for k, v := range snippet {
+				form[k] = v
+			}
+			rs := ts.Submit(t, "/snippet/create", "/snippet/create", form)
+			assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, tt.wantRedir)
+		})
+	}
+	// Only the person's snippet was created
+	assert.Equal(t, snippets.inserted, 1)
+
+	// Signups are trapped too, rather than sent on to log in
+	ts = testutil.NewServer(t, app.routes())
+	signup := url.Values{
+		"name":         {"Bob"},
+		"email":        {"bob@example.com"},
+		"password":     {"validPa$$word"},
+		"website":      {"https://spam.example.com"},
+		"form_started": {startedAgo(app, time.Minute)},
+	}
+	rs := ts.Submit(t, "/user/signup", "/user/signup", signup)
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/")
+	signup.Del("website")
+	rs = ts.Submit(t, "/user/signup", "/user/signup", signup)
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/user/login")
+}
+
+func TestFormStarted(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+
+	// Forms are stamped with the time they were rendered
+	m := formStartedRX.FindStringSubmatch(ts.Get(t, "/user/signup").Body)
+	assert.NotNil(t, m)
+	started, ok := app.formStartedAt(m[1])
+	assert.Equal(t, ok, true)
+	if time.Since(started) > time.Minute {
+		t.Errorf("form started at %s; want about now", started)
+	}
+
+	// A form posted back keeps its time, unless it was forged
+	earlier := startedAgo(app, time.Hour)
+	for _, tt := range []struct {
+		token string
+		keep  bool
+	}{{earlier, true}, {"1.forged", false}} {
+		r := httptest.NewRequest(http.MethodPost, "/user/signup", strings.NewReader("form_started="+url.QueryEscape(tt.token)))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		assert.Equal(t, app.formStarted(r) == tt.token, tt.keep)
+	}
+}
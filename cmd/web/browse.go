@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+
+	"adotkaya.playground/internal/langdetect"
+	"adotkaya.playground/internal/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// =============================================================================
+// Browse Pages
+// =============================================================================
+// Public snippets can be browsed by language and by tag, a page at a time,
+// with the number of snippets in each language and under the most used
+// tags alongside.
+
+const (
+	// browsePageSize is the number of snippets shown per browse page
+	browsePageSize = 20
+
+	// browseTagCount is the number of most used tags shown alongside
+	browseTagCount = 30
+)
+
+// browsing describes what a browse page lists, with the sidebar counts
+type browsing struct {
+	Language  string // Language listed, if browsing by language
+	Tag       string // Tag listed, if browsing by tag
+	Languages []*models.GroupCount
+	Tags      []*models.GroupCount
+}
+
+// browseLanguage lists the public snippets guessed to be in a language
+func (app *application) browseLanguage(w http.ResponseWriter, r *http.Request) {
+	language := httprouter.ParamsFromContext(r.Context()).ByName("lang")
+	if !langdetect.Known(language) {
+		app.notFound(w, r)
+		return
+	}
+
+	page := pageParam(r)
+	snippets, total, err := app.snippets.ByLanguage(r.Context(), language, browsePageSize, (page-1)*browsePageSize)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.renderBrowse(w, r, &browsing{Language: language}, snippets, page, total,
+		app.translate(r, "browse.language_heading", langdetect.Name(language)))
+}
+
+// browseTag lists the public snippets with a tag
+func (app *application) browseTag(w http.ResponseWriter, r *http.Request) {
+	tag := httprouter.ParamsFromContext(r.Context()).ByName("tag")
+	if !tagRX.MatchString(tag) {
+		app.notFound(w, r)
+		return
+	}
+
+	page := pageParam(r)
+	snippets, total, err := app.snippets.ByTag(r.Context(), tag, browsePageSize, (page-1)*browsePageSize)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.renderBrowse(w, r, &browsing{Tag: tag}, snippets, page, total,
+		app.translate(r, "browse.tag_heading", tag))
+}
+
+// renderBrowse renders a page of a browse listing, loading the sidebar
+// counts
+func (app *application) renderBrowse(w http.ResponseWriter, r *http.Request, browse *browsing, snippets []*models.SnippetSummary, page, total int, heading string) {
+	var err error
+	browse.Languages, err = app.snippets.LanguageCounts()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	browse.Tags, err = app.snippets.TagCounts(browseTagCount)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Title = heading
+	data.Browse = browse
+	data.Snippets = snippets
+	data.Pagination = newPaginator(r, page, browsePageSize, total)
+	data.Breadcrumbs = app.breadcrumbs(r, Crumb{Label: heading})
+
+	app.render(w, http.StatusOK, "browse.tmpl", data)
+}
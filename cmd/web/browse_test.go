@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestBrowse(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+		wantBody []string
+	}{
+		{
+			name:     "Language",
+			path:     "/browse/language/go",
+			wantCode: http.StatusOK,
+			wantBody: []string{
+				"<h2>Go Snippets</h2>",
+				`<a href="/snippet/view/1">An old silent pond</a>`,
+				`<li class="current">`,
+				`<a href="/browse/language/go">Go</a> <span>1</span>`,
+				`<a href="/browse/tag/haiku">#haiku</a> <span>1</span>`,
+			},
+		},
+		{
+			name:     "Language without snippets",
+			path:     "/browse/language/python",
+			wantCode: http.StatusOK,
+			wantBody: []string{"<h2>Python Snippets</h2>", "There are no snippets here yet."},
+		},
+		{
+			name:     "Unknown language",
+			path:     "/browse/language/cobol",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Tag",
+			path:     "/browse/tag/haiku",
+			wantCode: http.StatusOK,
+			wantBody: []string{
+				"<h2>Snippets Tagged #haiku</h2>",
+				`<a href="/snippet/view/1">An old silent pond</a>`,
+			},
+		},
+		{
+			name:     "Past the last page",
+			path:     "/browse/tag/haiku?page=2",
+			wantCode: http.StatusOK,
+			wantBody: []string{"There are no snippets here yet."},
+		},
+		{
+			name:     "Malformed tag",
+			path:     "/browse/tag/Not_A_Tag",
+			wantCode: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := ts.Get(t, tt.path)
+			assert.Equal(t, rs.Status, tt.wantCode)
+			for _, want := range tt.wantBody {
+				assert.StringContains(t, rs.Body, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+)
+
+// =============================================================================
+// Render Buffer Pool
+// =============================================================================
+
+// maxPooledBuffer is the largest buffer kept for reuse. Rare huge pages
+// shouldn't pin their memory for the life of the process.
+const maxPooledBuffer = 1 << 20
+
+// renderBuffers recycles the buffers pages are rendered into
+var renderBuffers bufferPool
+
+// bufferPool is a sync.Pool of bytes.Buffers. New buffers are pre-sized to
+// a running average of recently returned ones, so a render rarely has to
+// grow its buffer. The zero value is ready to use.
+type bufferPool struct {
+	pool    sync.Pool
+	avgSize atomic.Int64
+}
+
+// get returns an empty buffer
+func (p *bufferPool) get() *bytes.Buffer {
+	if buf, ok := p.pool.Get().(*bytes.Buffer); ok {
+		return buf
+	}
+	return bytes.NewBuffer(make([]byte, 0, p.avgSize.Load()))
+}
+
+// put resets a buffer and returns it to the pool. The buffer must not be
+// used afterwards.
+func (p *bufferPool) put(buf *bytes.Buffer) {
+	// Exponential moving average weighting the latest size by 1/8. Lost
+	// updates from concurrent puts only make the estimate a little stale.
+	avg := p.avgSize.Load()
+	p.avgSize.Store(avg + (int64(buf.Len())-avg)/8)
+
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	buf.Reset()
+	p.pool.Put(buf)
+}
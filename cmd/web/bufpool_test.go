@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/models"
+)
+
+func TestBufferPool(t *testing.T) {
+	var p bufferPool
+
+	buf := p.get()
+	buf.WriteString(strings.Repeat("x", 800))
+	p.put(buf)
+	assert.Equal(t, p.avgSize.Load(), int64(100))
+
+	// Buffers come back empty
+	buf = p.get()
+	assert.Equal(t, buf.Len(), 0)
+
+	// Oversized buffers are dropped rather than pooled, but still counted
+	big := bytes.NewBuffer(make([]byte, 0, maxPooledBuffer+1))
+	p.put(big)
+	assert.Equal(t, p.avgSize.Load(), int64(100-100/8))
+}
+
+// discardWriter is a ResponseWriter that throws the body away, so
+// benchmarks only measure rendering
+type discardWriter struct{ header http.Header }
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardWriter) WriteHeader(int)             {}
+
+// BenchmarkRenderBuffer compares allocating a buffer per render, as render
+// used to, with taking one from the pool
+func BenchmarkRenderBuffer(b *testing.B) {
+	templateCache, err := newTemplateCache()
+	if err != nil {
+		b.Fatal(err)
+	}
+	ts := templateCache["home.tmpl"]
+
+	created := time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC)
+	snippets := make([]*models.SnippetSummary, 10)
+	for i := range snippets {
+		snippets[i] = &models.SnippetSummary{ID: i + 1, Title: "An old silent pond", Created: created, Expires: created}
+	}
+	data := &templateData{CurrentYear: 2024, Locale: "en", Title: "Home", Snippets: snippets}
+	w := &discardWriter{header: http.Header{}}
+
+	b.Run("New", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			buf := new(bytes.Buffer)
+			if err := ts.ExecuteTemplate(buf, "base", data); err != nil {
+				b.Fatal(err)
+			}
+			buf.WriteTo(w)
+		}
+	})
+
+	b.Run("Pool", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			buf := renderBuffers.get()
+			if err := ts.ExecuteTemplate(buf, "base", data); err != nil {
+				b.Fatal(err)
+			}
+			buf.WriteTo(w)
+			renderBuffers.put(buf)
+		}
+	})
+}
@@ -1,9 +1,21 @@
 package main
 
 import (
+	"encoding/base64"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
 	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"adotkaya.playground/internal/models"
 )
 
 // =============================================================================
@@ -12,8 +24,31 @@ import (
 
 // Config holds all configuration for the application
 type Config struct {
-	Database DatabaseConfig
-	Server   ServerConfig
+	Database  DatabaseConfig
+	Server    ServerConfig
+	Cache     CacheConfig
+	Robots    RobotsConfig
+	Mail      MailConfig
+	Jobs      JobsConfig
+	Quota     QuotaConfig
+	Anonymous AnonymousConfig
+	Content   ContentConfig
+	SAML      SAMLConfig
+	SCIM      SCIMConfig
+	Backup    BackupConfig
+	Bots      BotConfig
+	Passwords PasswordConfig
+	Session   SessionConfig
+	CSRF      CSRFConfig
+	Logins    LoginConfig
+	GitHub    GitHubConfig
+	Logging   LogConfig
+	Analytics AnalyticsConfig
+	Links     LinkConfig
+
+	S3          S3Config
+	Attachments AttachmentConfig
+	Avatars     AvatarConfig
 }
 
 // DatabaseConfig holds database connection configuration
@@ -24,16 +59,303 @@ type DatabaseConfig struct {
 	Port     string
 	Name     string
 	SSLMode  string
+
+	// MonitorInterval is how often the pool health monitor pings the database
+	MonitorInterval time.Duration
+
+	// AutoMigrate applies pending embedded migrations on startup
+	AutoMigrate bool
+
+	// AllowDrift starts the server even when the database's migrations
+	// don't match the embedded ones, warning instead
+	AllowDrift bool
+
+	// SlowQuery is how long a query may take before it is logged as a
+	// warning, with the request it was made for; zero logs none
+	SlowQuery time.Duration
 }
 
 // ServerConfig holds HTTP server configuration
 type ServerConfig struct {
-	Port         string
+	Port        string
+	BaseURL     string // Public URL of the site, used for canonical links
+	Environment string // "production", "staging" or "development"
+	SecretKey   string // Signs links emailed to users (e.g. unsubscribe)
+
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For header
+	// is believed when working out the client's address
+	TrustedProxies []netip.Prefix
+
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
 	IdleTimeout  time.Duration
+
+	// ShutdownTimeout is how long requests in flight get to finish when
+	// the server is stopped
+	ShutdownTimeout time.Duration
+
+	// SelfCheck checks the schema, templates, TLS certificate and SMTP
+	// server before starting, refusing to start if any check fails
+	SelfCheck bool
+
+	// ReferrerPolicy and PermissionsPolicy are sent in the headers of the
+	// same names on every response
+	ReferrerPolicy    string
+	PermissionsPolicy string
+}
+
+// CacheConfig holds in-memory snippet cache configuration
+type CacheConfig struct {
+	Enabled bool
+
+	// LatestTTL is how long snippets and the home page listing are served
+	// from memory before being refetched, even without an invalidation
+	LatestTTL time.Duration
+
+	// MaxSnippets is how many snippets are kept in memory, dropping the
+	// least recently read first
+	MaxSnippets int
+
+	// PageTTL is how long rendered pages are served to anonymous visitors
+	// as is; zero disables the page cache. For PageStale longer the old
+	// page is still served while it is rendered again in the background.
+	PageTTL   time.Duration
+	PageStale time.Duration
+
+	// SessionTTL is how long session lookups are cached in memory; zero
+	// (the default) disables the session read cache
+	SessionTTL time.Duration
+}
+
+// RobotsConfig holds robots.txt configuration
+type RobotsConfig struct {
+	// SitemapURL is advertised to crawlers in production, if set
+	SitemapURL string
+}
+
+// MailConfig holds outgoing email configuration. When SMTPHost is empty,
+// emails are written to the info log instead of being sent.
+type MailConfig struct {
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPTLS      string // "starttls", "tls" or "none"
+	Sender       string
+}
+
+// JobsConfig holds background job worker configuration
+type JobsConfig struct {
+	// PollInterval is how long the worker waits before checking an empty
+	// queue again
+	PollInterval time.Duration
+
+	// Digest enables the weekly digest email of popular snippets
+	Digest bool
+
+	// SubscriptionEmails enables the daily email of new snippets matching
+	// users' saved searches and tags
+	SubscriptionEmails bool
+}
+
+// QuotaConfig holds the limits of each tier users can be on. Admins have
+// none, and per-user overrides of PerHour and Total live in the
+// snippet_quotas table.
+type QuotaConfig struct {
+	Tiers map[string]Tier // Always has models.TierFree
+}
+
+// Tier is the set of limits of a plan. Zero means no limit.
+type Tier struct {
+	PerHour      int // Snippets created per rolling hour
+	Total        int // Unexpired snippets
+	Private      int // Unexpired private snippets
+	MaxSize      int // Bytes of content per snippet
+	APIPerMinute int // Requests to the API per minute
+}
+
+// AnonymousConfig controls snippet creation by visitors without an
+// account. Their limits apply per client address.
+type AnonymousConfig struct {
+	Enabled bool
+	PerHour int // Snippets created per rolling hour; zero means no limit
+	Total   int // Unexpired snippets; zero means no limit
+}
+
+// ContentConfig controls encryption of snippet content at rest. With no
+// keys, content is stored as plaintext.
+type ContentConfig struct {
+	// Keys are the AES-256 keys for content. The first seals new content;
+	// the rest are older keys still needed to read content until it has
+	// been resealed.
+	Keys []models.ContentKey
 }
 
+// SAMLConfig configures SAML 2.0 single sign-on. It is off unless the
+// identity provider's metadata is configured.
+type SAMLConfig struct {
+	// IDPMetadataURL is fetched at startup. IDPMetadataFile is read
+	// instead, if set, for identity providers unreachable from the server.
+	IDPMetadataURL  string
+	IDPMetadataFile string
+
+	// CertFile and KeyFile hold the PEM encoded certificate and RSA key
+	// that sign authentication requests and decrypt assertions
+	CertFile string
+	KeyFile  string
+
+	// EmailAttribute and NameAttribute name the assertion attributes
+	// holding the user's email address and display name
+	EmailAttribute string
+	NameAttribute  string
+}
+
+// SCIMConfig configures the SCIM 2.0 provisioning API, through which an
+// identity provider manages user accounts. It is off unless a token is
+// set.
+type SCIMConfig struct {
+	// Token is the bearer token the identity provider authenticates with
+	Token string
+}
+
+// BackupConfig holds where backups requested by admins are written
+type BackupConfig struct {
+	// Dir is the directory archives are written to, created if missing
+	Dir string
+}
+
+// BotConfig holds the bot traps on the signup and create forms
+type BotConfig struct {
+	// MinFillTime is the least time a person takes to fill in a form.
+	// Forms submitted sooner are taken for bots; zero turns the check off.
+	MinFillTime time.Duration
+}
+
+// PasswordConfig holds how passwords are hashed. Hashes made otherwise are
+// replaced when their user next logs in.
+type PasswordConfig struct {
+	// BcryptCost is the bcrypt cost of new hashes
+	BcryptCost int
+
+	// Pepper is a secret mixed into passwords before hashing; empty for
+	// none. Once set it can't be changed or removed without locking out
+	// everyone whose hash was made with it.
+	Pepper string
+}
+
+// SessionConfig holds how long sessions last and their cookie
+type SessionConfig struct {
+	// Lifetime is how long a session lasts from login, however active
+	// the visitor is
+	Lifetime time.Duration
+
+	// IdleTimeout ends a session sooner if it goes this long without a
+	// request; zero for no idle timeout
+	IdleTimeout time.Duration
+
+	CookieName   string
+	CookieDomain string // Empty for just the host the site is served from
+	SameSite     http.SameSite
+}
+
+// CSRFConfig holds which routes skip the CSRF check. The JSON API under
+// /api/ never has it: it authenticates with bearer tokens, which browsers
+// don't send on their own, instead of the session cookie.
+type CSRFConfig struct {
+	// ExemptPaths are path.Match patterns of other routes that skip the
+	// check, such as webhooks posted from other sites. Exempt routes must
+	// authenticate their requests some other way.
+	ExemptPaths []string
+}
+
+// LoginConfig holds how logins are compared with earlier ones
+type LoginConfig struct {
+	// CountryHeader names a request header holding the client's ISO 3166
+	// country code, such as CF-IPCountry, set by a trusted proxy. Empty
+	// (the default) leaves countries unknown, so only new devices are
+	// noticed.
+	CountryHeader string
+}
+
+// LogConfig holds the log level and debug sampling in force at startup,
+// which can be changed while the server runs
+type LogConfig struct {
+	Level slog.Level
+
+	// DebugSample is the percent of requests logged at debug level whatever
+	// the level, from 0 (the default) to 100
+	DebugSample int
+}
+
+// AnalyticsConfig holds the first-party page analytics
+type AnalyticsConfig struct {
+	// Enabled has pages report their views to /beacon (the default)
+	Enabled bool
+}
+
+// LinkConfig holds how links to other sites in user content are shown
+type LinkConfig struct {
+	// Interstitial sends them through the /leaving page (the default)
+	Interstitial bool
+}
+
+// GitHubConfig holds where the GitHub API is, for pushing snippets to
+// Gists
+type GitHubConfig struct {
+	// APIURL is the REST API's base URL; GitHub Enterprise Server has it
+	// at https://<host>/api/v3
+	APIURL string
+}
+
+// S3Config holds the bucket of an S3-compatible object store, such as
+// Amazon S3 or MinIO, for attachments and avatars. It is off unless a
+// bucket is set.
+type S3Config struct {
+	// Endpoint is the store's URL; empty means Amazon S3 in Region
+	Endpoint string
+	Region   string
+	Bucket   string
+
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// PathStyle puts the bucket in URLs' paths rather than their host
+	// names, as MinIO needs
+	PathStyle bool
+}
+
+// AttachmentConfig holds the limits of files attached to snippets, which
+// are kept in the S3 bucket
+type AttachmentConfig struct {
+	// MaxSize is the largest file accepted, in bytes
+	MaxSize int
+
+	// URLExpiry is how long download links work
+	URLExpiry time.Duration
+}
+
+// AvatarConfig holds where avatars are kept and how large uploads can be
+type AvatarConfig struct {
+	// Storage is "local" to keep avatars in Dir, or "s3" to keep them in
+	// the S3 bucket, as deployments with several servers need
+	Storage string
+	Dir     string
+
+	// MaxSize is the largest picture accepted, in bytes
+	MaxSize int
+}
+
+// minPepperLength is the shortest password pepper accepted
+const minPepperLength = 32
+
+// Default security headers: send other sites only the origin of pages,
+// never their path or query, and turn off browser features the site
+// doesn't use
+const (
+	defaultReferrerPolicy    = "origin-when-cross-origin"
+	defaultPermissionsPolicy = "camera=(), microphone=(), geolocation=(), payment=(), usb=(), browsing-topics=()"
+)
+
 // =============================================================================
 // Configuration Loading
 // =============================================================================
@@ -48,13 +370,176 @@ func LoadConfig() (*Config, error) {
 			Port:     getEnvOrDefault("DB_PORT", "5432"),
 			Name:     os.Getenv("DB_NAME"),
 			SSLMode:  getEnvOrDefault("DB_SSLMODE", "disable"),
+
+			MonitorInterval: parseDurationOrDefault("DB_MONITOR_INTERVAL", 15*time.Second),
+			AutoMigrate:     parseBoolOrDefault("DB_AUTO_MIGRATE", true),
+			AllowDrift:      parseBoolOrDefault("DB_ALLOW_SCHEMA_DRIFT", false),
+			SlowQuery:       parseDurationOrDefault("DB_SLOW_QUERY", 500*time.Millisecond),
 		},
 		Server: ServerConfig{
-			Port:         getEnvOrDefault("SERVER_PORT", "4000"),
-			ReadTimeout:  parseDurationOrDefault("SERVER_READ_TIMEOUT", 5*time.Second),
-			WriteTimeout: parseDurationOrDefault("SERVER_WRITE_TIMEOUT", 10*time.Second),
-			IdleTimeout:  parseDurationOrDefault("SERVER_IDLE_TIMEOUT", time.Minute),
+			Port:              getEnvOrDefault("SERVER_PORT", "4000"),
+			BaseURL:           getEnvOrDefault("SERVER_BASE_URL", "https://localhost:4000"),
+			Environment:       getEnvOrDefault("APP_ENV", "development"),
+			SecretKey:         os.Getenv("SECRET_KEY"),
+			ReadTimeout:       parseDurationOrDefault("SERVER_READ_TIMEOUT", 5*time.Second),
+			WriteTimeout:      parseDurationOrDefault("SERVER_WRITE_TIMEOUT", 10*time.Second),
+			IdleTimeout:       parseDurationOrDefault("SERVER_IDLE_TIMEOUT", time.Minute),
+			ShutdownTimeout:   parseDurationOrDefault("SERVER_SHUTDOWN_TIMEOUT", 30*time.Second),
+			SelfCheck:         parseBoolOrDefault("SELF_CHECK", true),
+			PermissionsPolicy: getEnvOrDefault("PERMISSIONS_POLICY", defaultPermissionsPolicy),
+		},
+		Cache: CacheConfig{
+			Enabled:     parseBoolOrDefault("CACHE_ENABLED", true),
+			LatestTTL:   parseDurationOrDefault("CACHE_LATEST_TTL", 30*time.Second),
+			MaxSnippets: parseIntOrDefault("CACHE_MAX_SNIPPETS", 1000),
+			PageTTL:     parseDurationOrDefault("PAGE_CACHE_TTL", 5*time.Second),
+			PageStale:   parseDurationOrDefault("PAGE_CACHE_STALE", 30*time.Second),
+			SessionTTL:  parseDurationOrDefault("SESSION_CACHE_TTL", 0),
+		},
+		Robots: RobotsConfig{
+			SitemapURL: os.Getenv("ROBOTS_SITEMAP_URL"),
+		},
+		Mail: MailConfig{
+			SMTPHost:     os.Getenv("SMTP_HOST"),
+			SMTPPort:     parseIntOrDefault("SMTP_PORT", 587),
+			SMTPUsername: os.Getenv("SMTP_USERNAME"),
+			SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+			SMTPTLS:      getEnvOrDefault("SMTP_TLS", "starttls"),
+			Sender:       getEnvOrDefault("MAIL_SENDER", "Snippetbox <no-reply@snippetbox.example.com>"),
 		},
+		Jobs: JobsConfig{
+			PollInterval:       parseDurationOrDefault("JOBS_POLL_INTERVAL", time.Second),
+			Digest:             parseBoolOrDefault("DIGEST_ENABLED", true),
+			SubscriptionEmails: parseBoolOrDefault("SUBSCRIPTION_EMAILS_ENABLED", true),
+		},
+		Anonymous: AnonymousConfig{
+			Enabled: parseBoolOrDefault("ANONYMOUS_SNIPPETS", false),
+			PerHour: parseIntOrDefault("ANONYMOUS_HOURLY_LIMIT", 3),
+			Total:   parseIntOrDefault("ANONYMOUS_TOTAL_LIMIT", 20),
+		},
+		SAML: SAMLConfig{
+			IDPMetadataURL:  os.Getenv("SAML_IDP_METADATA_URL"),
+			IDPMetadataFile: os.Getenv("SAML_IDP_METADATA_FILE"),
+			CertFile:        os.Getenv("SAML_CERT_FILE"),
+			KeyFile:         os.Getenv("SAML_KEY_FILE"),
+			EmailAttribute:  getEnvOrDefault("SAML_EMAIL_ATTRIBUTE", "email"),
+			NameAttribute:   getEnvOrDefault("SAML_NAME_ATTRIBUTE", "name"),
+		},
+		SCIM: SCIMConfig{
+			Token: os.Getenv("SCIM_TOKEN"),
+		},
+		Backup: BackupConfig{
+			Dir: getEnvOrDefault("BACKUP_DIR", "./backups"),
+		},
+		Bots: BotConfig{
+			MinFillTime: parseDurationOrDefault("BOT_MIN_FILL_TIME", 3*time.Second),
+		},
+		Analytics: AnalyticsConfig{
+			Enabled: parseBoolOrDefault("ANALYTICS_ENABLED", true),
+		},
+		Links: LinkConfig{
+			Interstitial: parseBoolOrDefault("LINK_INTERSTITIAL", true),
+		},
+		Session: SessionConfig{
+			Lifetime:     parseDurationOrDefault("SESSION_LIFETIME", 12*time.Hour),
+			IdleTimeout:  parseDurationOrDefault("SESSION_IDLE_TIMEOUT", 0),
+			CookieName:   getEnvOrDefault("SESSION_COOKIE_NAME", "session"),
+			CookieDomain: os.Getenv("SESSION_COOKIE_DOMAIN"),
+		},
+		Logins: LoginConfig{
+			CountryHeader: os.Getenv("LOGIN_COUNTRY_HEADER"),
+		},
+		GitHub: GitHubConfig{
+			APIURL: getEnvOrDefault("GITHUB_API_URL", "https://api.github.com"),
+		},
+		S3: S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          getEnvOrDefault("S3_REGION", "us-east-1"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PathStyle:       parseBoolOrDefault("S3_PATH_STYLE", false),
+		},
+		Attachments: AttachmentConfig{
+			MaxSize:   parseIntOrDefault("ATTACHMENT_MAX_SIZE", 10<<20),
+			URLExpiry: parseDurationOrDefault("ATTACHMENT_URL_EXPIRY", 15*time.Minute),
+		},
+		Avatars: AvatarConfig{
+			Storage: getEnvOrDefault("AVATAR_STORAGE", "local"),
+			Dir:     getEnvOrDefault("AVATAR_DIR", "./avatars"),
+			MaxSize: parseIntOrDefault("AVATAR_MAX_SIZE", 2<<20),
+		},
+		Passwords: PasswordConfig{
+			BcryptCost: parseIntOrDefault("PASSWORD_BCRYPT_COST", models.DefaultBcryptCost),
+			Pepper:     os.Getenv("PASSWORD_PEPPER"),
+		},
+	}
+
+	sameSite, err := parseSameSite(getEnvOrDefault("SESSION_COOKIE_SAMESITE", "lax"))
+	if err != nil {
+		return nil, fmt.Errorf("SESSION_COOKIE_SAMESITE: %w", err)
+	}
+	cfg.Session.SameSite = sameSite
+
+	referrerPolicy, err := parseReferrerPolicy(getEnvOrDefault("REFERRER_POLICY", defaultReferrerPolicy))
+	if err != nil {
+		return nil, fmt.Errorf("REFERRER_POLICY: %w", err)
+	}
+	cfg.Server.ReferrerPolicy = referrerPolicy
+
+	exempt, err := parsePathPatterns(os.Getenv("CSRF_EXEMPT_PATHS"))
+	if err != nil {
+		return nil, fmt.Errorf("CSRF_EXEMPT_PATHS: %w", err)
+	}
+	cfg.CSRF.ExemptPaths = exempt
+
+	level, err := parseLogLevel(getEnvOrDefault("LOG_LEVEL", "info"))
+	if err != nil {
+		return nil, fmt.Errorf("LOG_LEVEL: %w", err)
+	}
+	cfg.Logging.Level = level
+
+	sample, err := parseLogSample(getEnvOrDefault("LOG_DEBUG_SAMPLE", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("LOG_DEBUG_SAMPLE: %w", err)
+	}
+	cfg.Logging.DebugSample = sample
+
+	proxies, err := parsePrefixes(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		return nil, fmt.Errorf("TRUSTED_PROXIES: %w", err)
+	}
+	cfg.Server.TrustedProxies = proxies
+
+	tiers, err := parseTiers(os.Getenv("TIERS"), defaultTiers())
+	if err != nil {
+		return nil, fmt.Errorf("TIERS: %w", err)
+	}
+	cfg.Quota.Tiers = tiers
+
+	// Content keys come from the environment or, to keep them out of it, a
+	// file such as one written by a secrets manager or KMS agent
+	keyList := os.Getenv("CONTENT_KEYS")
+	if path := os.Getenv("CONTENT_KEYS_FILE"); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("CONTENT_KEYS_FILE: %w", err)
+		}
+		keyList = string(b)
+	}
+	keys, err := parseContentKeys(keyList)
+	if err != nil {
+		return nil, fmt.Errorf("CONTENT_KEYS: %w", err)
+	}
+	cfg.Content.Keys = keys
+
+	// Like content keys, the pepper can be kept out of the environment
+	if path := os.Getenv("PASSWORD_PEPPER_FILE"); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("PASSWORD_PEPPER_FILE: %w", err)
+		}
+		cfg.Passwords.Pepper = strings.TrimSpace(string(b))
 	}
 
 	// Validate required fields
@@ -78,11 +563,78 @@ func (c *Config) Validate() error {
 	if c.Database.Name == "" {
 		missing = append(missing, "DB_NAME")
 	}
+	// Elsewhere a random key is generated at startup, so emailed links
+	// stop working on restart
+	if c.Server.IsProduction() && c.Server.SecretKey == "" {
+		missing = append(missing, "SECRET_KEY")
+	}
+	if c.SAML.Enabled() {
+		if c.SAML.CertFile == "" {
+			missing = append(missing, "SAML_CERT_FILE")
+		}
+		if c.SAML.KeyFile == "" {
+			missing = append(missing, "SAML_KEY_FILE")
+		}
+	}
+	if c.S3.Enabled() {
+		if c.S3.AccessKeyID == "" {
+			missing = append(missing, "S3_ACCESS_KEY_ID")
+		}
+		if c.S3.SecretAccessKey == "" {
+			missing = append(missing, "S3_SECRET_ACCESS_KEY")
+		}
+	}
 
 	if len(missing) > 0 {
 		return fmt.Errorf("missing required environment variables: %v", missing)
 	}
 
+	// The token is all that guards account management
+	if c.SCIM.Enabled() && len(c.SCIM.Token) < minSCIMTokenLength {
+		return fmt.Errorf("SCIM_TOKEN must be at least %d characters", minSCIMTokenLength)
+	}
+
+	switch c.Mail.SMTPTLS {
+	case "starttls", "tls", "none":
+	default:
+		return fmt.Errorf("SMTP_TLS must be one of starttls, tls or none; got %q", c.Mail.SMTPTLS)
+	}
+
+	if c.Session.Lifetime <= 0 || c.Session.IdleTimeout < 0 {
+		return fmt.Errorf("SESSION_LIFETIME must be positive and SESSION_IDLE_TIMEOUT zero or more")
+	}
+	if !validCookieName(c.Session.CookieName) {
+		return fmt.Errorf("SESSION_COOKIE_NAME %q is not a valid cookie name", c.Session.CookieName)
+	}
+
+	// Signed links can't outlive a week
+	if c.Attachments.MaxSize <= 0 || c.Attachments.URLExpiry <= 0 || c.Attachments.URLExpiry > 7*24*time.Hour {
+		return fmt.Errorf("ATTACHMENT_MAX_SIZE must be positive and ATTACHMENT_URL_EXPIRY from 1s to 168h")
+	}
+
+	switch c.Avatars.Storage {
+	case "local":
+	case "s3":
+		if !c.S3.Enabled() {
+			return fmt.Errorf("AVATAR_STORAGE=s3 needs S3_BUCKET")
+		}
+	default:
+		return fmt.Errorf("AVATAR_STORAGE must be local or s3; got %q", c.Avatars.Storage)
+	}
+	if c.Cache.MaxSnippets <= 0 {
+		return fmt.Errorf("CACHE_MAX_SNIPPETS must be positive")
+	}
+	if c.Avatars.MaxSize <= 0 {
+		return fmt.Errorf("AVATAR_MAX_SIZE must be positive")
+	}
+
+	if c.Passwords.BcryptCost < bcrypt.MinCost || c.Passwords.BcryptCost > bcrypt.MaxCost {
+		return fmt.Errorf("PASSWORD_BCRYPT_COST must be from %d to %d; got %d", bcrypt.MinCost, bcrypt.MaxCost, c.Passwords.BcryptCost)
+	}
+	if c.Passwords.Pepper != "" && len(c.Passwords.Pepper) < minPepperLength {
+		return fmt.Errorf("PASSWORD_PEPPER must be at least %d characters", minPepperLength)
+	}
+
 	return nil
 }
 
@@ -90,6 +642,32 @@ func (c *Config) Validate() error {
 // Configuration Methods
 // =============================================================================
 
+// hasher returns the password hasher for the configured parameters
+func (c *PasswordConfig) hasher() models.PasswordHasher {
+	return models.PasswordHasher{Cost: c.BcryptCost, Pepper: []byte(c.Pepper)}
+}
+
+// IsProduction reports whether the app is running in the production
+// environment
+func (c *ServerConfig) IsProduction() bool {
+	return c.Environment == "production"
+}
+
+// Enabled reports whether SAML single sign-on is configured
+func (c *SAMLConfig) Enabled() bool {
+	return c.IDPMetadataURL != "" || c.IDPMetadataFile != ""
+}
+
+// Enabled reports whether an S3 bucket is configured
+func (c *S3Config) Enabled() bool {
+	return c.Bucket != ""
+}
+
+// Enabled reports whether the SCIM provisioning API is configured
+func (c *SCIMConfig) Enabled() bool {
+	return c.Token != ""
+}
+
 // DSN returns the PostgreSQL connection string
 func (c *DatabaseConfig) DSN() string {
 	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s",
@@ -123,3 +701,219 @@ func parseDurationOrDefault(key string, defaultValue time.Duration) time.Duratio
 	}
 	return defaultValue
 }
+
+// parseBoolOrDefault parses a boolean from env var or returns a default
+func parseBoolOrDefault(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return defaultValue
+}
+
+// parseIntOrDefault parses an integer from env var or returns a default
+func parseIntOrDefault(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
+
+// parseSameSite parses a cookie SameSite mode: lax, strict or none
+func parseSameSite(mode string) (http.SameSite, error) {
+	switch strings.ToLower(mode) {
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	}
+	return 0, fmt.Errorf("must be lax, strict or none; got %q", mode)
+}
+
+// referrerPolicies are the policies a Referrer-Policy header can name
+var referrerPolicies = []string{
+	"no-referrer", "no-referrer-when-downgrade", "origin", "origin-when-cross-origin",
+	"same-origin", "strict-origin", "strict-origin-when-cross-origin", "unsafe-url",
+}
+
+// parseReferrerPolicy parses a Referrer-Policy: one of referrerPolicies, or
+// a comma-separated list of them for browsers to pick the last they know
+func parseReferrerPolicy(policy string) (string, error) {
+	var parts []string
+	for part := range strings.SplitSeq(policy, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if !slices.Contains(referrerPolicies, part) {
+			return "", fmt.Errorf("unknown policy %q", part)
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ", "), nil
+}
+
+// validCookieName reports whether name can name a cookie: a non-empty
+// token of printable ASCII without separators
+func validCookieName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c <= ' ' || c >= 0x7f || strings.ContainsRune(`()<>@,;:\"/[]?={}`, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// parsePrefixes parses a comma-separated list of IP addresses and CIDR
+// networks. Single addresses become /32 or /128 networks.
+func parsePrefixes(list string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		prefix, err := parsePrefix(item)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+// parsePathPatterns parses a comma separated list of path.Match patterns,
+// each starting with a slash, such as "/hooks/*"
+func parsePathPatterns(list string) ([]string, error) {
+	var patterns []string
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.HasPrefix(item, "/") {
+			return nil, fmt.Errorf("pattern %q must start with /", item)
+		}
+		if _, err := path.Match(item, ""); err != nil {
+			return nil, fmt.Errorf("pattern %q: %w", item, err)
+		}
+		patterns = append(patterns, item)
+	}
+	return patterns, nil
+}
+
+// defaultTiers returns the built-in tiers. The free tier's snippet limits
+// can also be set with the variables that predate tiers.
+func defaultTiers() map[string]Tier {
+	return map[string]Tier{
+		models.TierFree: {
+			PerHour:      parseIntOrDefault("SNIPPET_HOURLY_LIMIT", 10),
+			Total:        parseIntOrDefault("SNIPPET_TOTAL_LIMIT", 500),
+			Private:      10,
+			MaxSize:      64 << 10,
+			APIPerMinute: 60,
+		},
+		models.TierPro: {
+			PerHour:      100,
+			Total:        10000,
+			MaxSize:      1 << 20,
+			APIPerMinute: 600,
+		},
+	}
+}
+
+// parseTiers parses a semicolon-separated list of tiers, each a name and
+// comma-separated limits after a colon (e.g.
+// "pro:api=1200;team:hourly=50,total=5000,private=0,size=262144,api=600"),
+// on top of the given tiers. Newlines count as semicolons. Limits left out
+// keep their value in the given tier or, for a new tier, the free tier.
+func parseTiers(list string, tiers map[string]Tier) (map[string]Tier, error) {
+	for _, item := range strings.FieldsFunc(list, func(r rune) bool { return r == ';' || r == '\n' }) {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, limits, _ := strings.Cut(item, ":")
+		name = strings.TrimSpace(name)
+		if name == "" || len(name) > 20 {
+			return nil, fmt.Errorf("tier %q must have a name of up to 20 characters", item)
+		}
+
+		tier, ok := tiers[name]
+		if !ok {
+			tier = tiers[models.TierFree]
+		}
+		for _, limit := range strings.Split(limits, ",") {
+			if strings.TrimSpace(limit) == "" {
+				continue
+			}
+			key, value, _ := strings.Cut(limit, "=")
+			n, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("tier %s: %q must be a number of zero or more", name, limit)
+			}
+			switch strings.TrimSpace(key) {
+			case "hourly":
+				tier.PerHour = n
+			case "total":
+				tier.Total = n
+			case "private":
+				tier.Private = n
+			case "size":
+				tier.MaxSize = n
+			case "api":
+				tier.APIPerMinute = n
+			default:
+				return nil, fmt.Errorf("tier %s: unknown limit %q", name, key)
+			}
+		}
+		tiers[name] = tier
+	}
+	return tiers, nil
+}
+
+// parseContentKeys parses a comma-separated list of content keys, each an
+// ID and a base64 encoded 32-byte key separated by a colon (e.g.
+// "2024-06:q3Jw...,2023-01:Zm9v..."). Newlines count as commas.
+func parseContentKeys(list string) ([]models.ContentKey, error) {
+	var keys []models.ContentKey
+	for _, item := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == '\n' }) {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(item, ":")
+		if !ok {
+			return nil, fmt.Errorf("key %q has no ID", item)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		keys = append(keys, models.ContentKey{ID: id, Key: key})
+	}
+	return keys, nil
+}
+
+// parsePrefix parses an IP address or CIDR network, clearing host bits
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()).Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
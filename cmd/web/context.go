@@ -10,3 +10,48 @@ type contextKey string
 // isAuthenticatedContextKey is used to store/retrieve authentication status
 // from the request context
 const isAuthenticatedContextKey = contextKey("isAuthenticated")
+
+// localeContextKey is used to store/retrieve the negotiated UI locale from
+// the request context
+const localeContextKey = contextKey("locale")
+
+// themeContextKey is used to store/retrieve the selected colour theme from
+// the request context
+const themeContextKey = contextKey("theme")
+
+// userRoleContextKey is used to store/retrieve the authenticated user's role
+// from the request context
+const userRoleContextKey = contextKey("userRole")
+
+// userTierContextKey is used to store/retrieve the authenticated user's tier
+// from the request context
+const userTierContextKey = contextKey("userTier")
+
+// pageCacheContextKey marks a request whose response may be cached and
+// served to other anonymous visitors
+const pageCacheContextKey = contextKey("pageCache")
+
+// userIDContextKey is used to store/retrieve the authenticated user's ID
+// from the request context, whether they authenticated with a session or an
+// API token
+const userIDContextKey = contextKey("userID")
+
+// announcementContextKey is used to store/retrieve the announcement banner
+// to show from the request context
+const announcementContextKey = contextKey("announcement")
+
+// routeContextKey is used to store/retrieve the routeLabel naming the route
+// that serves a request
+const routeContextKey = contextKey("route")
+
+// snippetContextKey is used to store/retrieve the snippet in the URL,
+// loaded and checked by the loadSnippet middleware
+const snippetContextKey = contextKey("snippet")
+
+// debugSampleContextKey marks a request picked for debug logging by
+// sampling
+const debugSampleContextKey = contextKey("debugSample")
+
+// requestIDContextKey is used to store/retrieve the request's ID, set by
+// the assignRequestID middleware
+const requestIDContextKey = contextKey("requestID")
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"adotkaya.playground/internal/models"
+)
+
+// =============================================================================
+// Weekly Digest
+// =============================================================================
+
+const (
+	digestJobKind     = "digest"
+	digestMaxAttempts = 3
+	digestDays        = 7  // Period the digest covers
+	digestSize        = 10 // Snippets listed in the digest
+)
+
+// digestSchedule sends the digest on Monday mornings
+var digestSchedule = weekly(time.Monday, 9)
+
+// digestJob is the payload of a digest job
+type digestJob struct {
+	Week string `json:"week"` // First day covered, as YYYY-MM-DD
+}
+
+// enqueueDigest queues the digest for the week ending now. It is run by the
+// scheduler so building and sending the digest happens on the job worker.
+func (app *application) enqueueDigest() error {
+	week := time.Now().UTC().AddDate(0, 0, -digestDays).Format(time.DateOnly)
+	_, err := app.jobs.Enqueue(digestJobKind, digestJob{Week: week}, digestMaxAttempts)
+	return err
+}
+
+// sendDigestJob is the job handler compiling the week's most viewed snippets
+// and queuing a digest email to every user who opted in.
+//
+// Once the first email is queued the job succeeds even if some users fail,
+// so a retry can't send duplicates to the others.
+func (app *application) sendDigestJob(payload []byte) error {
+	var job digestJob
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return permanent(err)
+	}
+
+	popular, err := app.snippets.Popular(digestDays, digestSize)
+	if err != nil {
+		return err
+	}
+	if len(popular) == 0 {
+		return nil
+	}
+
+	subscribers, err := app.users.NotificationSubscribers(models.NotifyDigest)
+	if err != nil {
+		return err
+	}
+
+	snippets := make([]map[string]any, 0, len(popular))
+	for _, p := range popular {
+		snippets = append(snippets, map[string]any{
+			"Title": p.Title,
+			"URL":   app.canonicalURL(fmt.Sprintf("/snippet/view/%d", p.ID)),
+			"Views": p.Views,
+		})
+	}
+
+	for _, id := range subscribers {
+		data := map[string]any{"Week": job.Week, "Snippets": snippets}
+		if err := app.notify(id, models.NotifyDigest, "weekly_digest.tmpl", data); err != nil {
+			app.logger.Error("digest", "user_id", id, "error", err)
+		}
+	}
+
+	return nil
+}
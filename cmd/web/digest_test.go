@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/mailer"
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/models/mocks"
+)
+
+// digestUsers opts Alice into the digest
+type digestUsers struct {
+	mocks.UserModel
+}
+
+func (u *digestUsers) NotificationPreferences(id int) (map[string]bool, error) {
+	return map[string]bool{models.NotifyDigest: id == 1}, nil
+}
+func (u *digestUsers) NotificationSubscribers(kind string) ([]int, error) {
+	return []int{1}, nil
+}
+
+func TestSendDigestJob(t *testing.T) {
+	app := newTestApplication(t)
+	jobs := &fakeJobs{}
+	app.jobs = jobs
+	app.users = &digestUsers{}
+
+	err := app.enqueueDigest()
+	assert.NilError(t, err)
+	assert.Equal(t, len(jobs.enqueued), 1)
+
+	payload, err := json.Marshal(jobs.enqueued[0])
+	assert.NilError(t, err)
+	jobs.enqueued = nil
+
+	err = app.sendDigestJob(payload)
+	assert.NilError(t, err)
+	assert.Equal(t, len(jobs.enqueued), 1)
+
+	job := jobs.enqueued[0].(emailJob)
+	assert.Equal(t, job.Recipient, "alice@example.com")
+	assert.Equal(t, job.Template, "weekly_digest.tmpl")
+
+	// Render what the mail worker will see after the payload round trip
+	payload, err = json.Marshal(job)
+	assert.NilError(t, err)
+	var queued emailJob
+	assert.NilError(t, json.Unmarshal(payload, &queued))
+
+	msg, err := mailer.Render(queued.Recipient, queued.Template, queued.Data)
+	assert.NilError(t, err)
+	assert.Equal(t, msg.Subject, "Popular on Snippetbox this week")
+	assert.StringContains(t, msg.Text, "- An old silent pond (42 views)")
+	assert.StringContains(t, msg.Text, "https://snippetbox.example.com/snippet/view/1")
+	assert.StringContains(t, msg.HTML, "/unsubscribe?kind=digest")
+}
+
+func TestSendDigestJobBadPayload(t *testing.T) {
+	app := newTestApplication(t)
+
+	err := app.sendDigestJob([]byte("not json"))
+	assert.Equal(t, errors.As(err, new(permanentError)), true)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"adotkaya.playground/internal/migrate"
+	"adotkaya.playground/migrations"
+)
+
+// =============================================================================
+// Schema Drift
+// =============================================================================
+// The server expects the database to have exactly the migrations embedded
+// in it. Behind, queries fail on missing columns; ahead, as after rolling
+// back to an older release, the newer schema may break the older code in
+// ways that only show up later. Either way the server refuses to start,
+// unless DB_ALLOW_SCHEMA_DRIFT=true, when it only warns.
+
+// checkDrift returns an error if the database has drifted from the embedded
+// migrations, or logs a warning instead if drift is allowed
+func checkDrift(drift migrate.Drift, allow bool, logger *slog.Logger) error {
+	if !drift.Ahead() && !drift.Behind() {
+		return nil
+	}
+
+	hint := "apply the pending migrations with DB_AUTO_MIGRATE=true"
+	if drift.Ahead() {
+		hint = "deploy the release that added them"
+	}
+	if allow {
+		logger.Warn("Schema drift", "drift", drift.String(), "hint", hint)
+		return nil
+	}
+	return fmt.Errorf("schema drift: %s; %s, or set DB_ALLOW_SCHEMA_DRIFT=true to start anyway", drift, hint)
+}
+
+// runSchema implements `web schema`: it compares the database configured
+// in the environment with the embedded migrations, without migrating it,
+// and prints the result. It returns 1 if the schema has drifted, so it can
+// gate a deploy.
+func runSchema(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("schema", flag.ContinueOnError)
+	fs.SetOutput(out)
+	fs.Usage = func() {
+		fmt.Fprintln(out, "Usage: web schema")
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+
+	_, pool, err := commandDB(false)
+	if err != nil {
+		fmt.Fprintln(out, "schema:", err)
+		return 1
+	}
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	drift, err := migrate.Check(ctx, pool, migrations.Files)
+	if err != nil {
+		fmt.Fprintln(out, "schema:", err)
+		return 1
+	}
+
+	fmt.Fprintln(out, drift)
+	if drift.Ahead() || drift.Behind() {
+		return 1
+	}
+	return 0
+}
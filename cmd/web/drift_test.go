@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/migrate"
+)
+
+func TestCheckDrift(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	upToDate := migrate.Drift{Database: 3, Embedded: 3}
+	assert.NilError(t, checkDrift(upToDate, false, logger))
+
+	behind := migrate.Drift{Database: 2, Embedded: 3, Pending: []int{3}}
+	err := checkDrift(behind, false, logger)
+	assert.StringContains(t, err.Error(), "is behind the embedded migrations")
+	assert.StringContains(t, err.Error(), "DB_AUTO_MIGRATE=true")
+
+	ahead := migrate.Drift{Database: 4, Embedded: 3, Unknown: []int{4}}
+	err = checkDrift(ahead, false, logger)
+	assert.StringContains(t, err.Error(), "is ahead of the embedded migrations")
+	assert.Equal(t, buf.String(), "")
+
+	// Allowed drift is only logged
+	assert.NilError(t, checkDrift(ahead, true, logger))
+	assert.StringContains(t, buf.String(), `level=WARN msg="Schema drift" drift="database at version 4 is ahead`)
+}
+
+func TestRunSchemaUsage(t *testing.T) {
+	var out bytes.Buffer
+	assert.Equal(t, runSchema([]string{"extra"}, &out), 2)
+	assert.Equal(t, out.String(), "Usage: web schema\n")
+}
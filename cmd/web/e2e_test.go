@@ -0,0 +1,138 @@
+//go:build e2e
+
+// End-to-end tests running the full application (real models, Postgres
+// sessions, migrations and middleware) against a throwaway Postgres
+// container. They need Docker and are excluded from the default test run:
+//
+//	go test -tags e2e ./cmd/web
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/pgxstore"
+	"github.com/alexedwards/scs/v2"
+	"github.com/go-playground/form/v4"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/mailer"
+	"adotkaya.playground/internal/migrate"
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/testutil"
+	"adotkaya.playground/migrations"
+)
+
+// newE2EApplication starts a Postgres container, applies the embedded
+// migrations and returns an application wired to it exactly as main() does
+func newE2EApplication(t *testing.T) *application {
+	t.Helper()
+	ctx := context.Background()
+
+	ctr, err := postgres.Run(ctx, "postgres:16-alpine",
+		postgres.WithDatabase("snippetbox"),
+		postgres.WithUsername("web"),
+		postgres.WithPassword("pass"),
+		postgres.BasicWaitStrategies(),
+	)
+	testcontainers.CleanupContainer(t, ctr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dsn, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	_, err = migrate.Up(ctx, pool, migrations.Files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.LoadFixtures(t, pool, "users", "snippets")
+
+	templateCache, err := newTemplateCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessionManager := scs.New()
+	sessionManager.Store = pgxstore.NewWithCleanupInterval(pool, 0)
+	sessionManager.Lifetime = 12 * time.Hour
+	sessionManager.Cookie.Secure = true
+
+	return &application{
+		logger:         slog.New(slog.DiscardHandler),
+		snippets:       &models.SnippetModel{DB: pool},
+		users:          &models.UserModel{DB: pool},
+		jobs:           &models.JobModel{DB: pool},
+		templateCache:  templateCache,
+		formDecoder:    form.NewDecoder(),
+		sessionManager: sessionManager,
+		cookies:        testCookies(t),
+		mailer:         mailer.NewLogMailer(slog.New(slog.DiscardHandler)),
+		config: &Config{
+			Server: ServerConfig{BaseURL: "https://snippetbox.example.com", SecretKey: "test-secret"},
+		},
+	}
+}
+
+func TestE2ESignupLoginCreateView(t *testing.T) {
+	app := newE2EApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+
+	// Anonymous visitors are sent to the login page
+	rs := ts.Get(t, "/snippet/create")
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/user/login")
+
+	// Sign up
+	signup := url.Values{}
+	signup.Add("name", "Bob")
+	signup.Add("email", "bob@example.com")
+	signup.Add("password", "validPa$$word")
+	rs = ts.Submit(t, "/user/signup", "/user/signup", signup)
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/user/login")
+
+	// Signing up again with the same email hits the unique constraint
+	rs = ts.Submit(t, "/user/signup", "/user/signup", signup)
+	assert.Status(t, rs.Status, http.StatusUnprocessableEntity)
+	assert.StringContains(t, rs.Body, "Email address is already in use")
+
+	// Log in
+	ts.Login(t, "bob@example.com", "validPa$$word")
+
+	// Create a snippet
+	create := url.Values{}
+	create.Add("title", "O snail")
+	create.Add("content", "O snail\nClimb Mount Fuji,\nBut slowly, slowly!")
+	create.Add("expires", "7")
+	rs = ts.Submit(t, "/snippet/create", "/snippet/create", create)
+	assert.Status(t, rs.Status, http.StatusSeeOther)
+
+	location := rs.Header.Get("Location")
+	assert.StringContains(t, location, "/snippet/view/")
+
+	// View it, including the flash message set on creation
+	rs = ts.Get(t, location)
+	assert.Status(t, rs.Status, http.StatusOK)
+	assert.StringContains(t, rs.Body, "Snippet successfully created!")
+	assert.StringContains(t, rs.Body, "Climb Mount Fuji,")
+
+	// And find it on the home page, next to the fixture snippets
+	rs = ts.Get(t, "/")
+	assert.StringContains(t, rs.Body, "O snail")
+	assert.StringContains(t, rs.Body, "An old silent pond")
+}
@@ -0,0 +1,23 @@
+package main
+
+import "encoding/base64"
+
+// =============================================================================
+// Encrypted Snippets
+// =============================================================================
+
+// Encrypted snippets are encrypted with AES-GCM in the browser
+// (ui/static/js/encrypted.js). The ciphertext is the base64url encoded IV
+// followed by the sealed title and content, and the key travels only in the
+// URL fragment.
+const (
+	gcmNonceSize = 12
+	gcmTagSize   = 16
+)
+
+// validCiphertext reports whether s looks like ciphertext from the browser.
+// It can't be decrypted here, so only the encoding and length are checked.
+func validCiphertext(s string) bool {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	return err == nil && len(b) > gcmNonceSize+gcmTagSize
+}
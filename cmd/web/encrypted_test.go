@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestValidCiphertext(t *testing.T) {
+	tests := []struct {
+		name       string
+		ciphertext string
+		want       bool
+	}{
+		{"Valid", "dHdlbHZlIGJ5dGVzeyJ0aXRsZSI6IkhpIn1zaXh0ZWVuIGJ5dGUgdGFn", true},
+		{"Empty", "", false},
+		{"Too short", "c2VjcmV0", false},
+		{"Padded", "dHdlbHZlIGJ5dGVzeyJ0aXRsZSI6IkhpIn1zaXh0ZWVuIGJ5dGUgdGFn=", false},
+		{"Plaintext", "An old silent pond, a frog jumps in", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, validCiphertext(tt.ciphertext), tt.want)
+		})
+	}
+}
+
+func TestEncryptedSnippetView(t *testing.T) {
+	ts := testutil.NewServer(t, newTestApplication(t).routes())
+
+	rs := ts.Get(t, "/snippet/view/5")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.StringContains(t, rs.Body, `data-ciphertext="dHdlbHZlIGJ5dGVzeyJ0aXRsZSI6IkhpIn1zaXh0ZWVuIGJ5dGUgdGFn"`)
+	assert.StringContains(t, rs.Body, `src="/static/js/encrypted.js"`)
+	assert.Equal(t, rs.Header.Get("X-Robots-Tag"), "noindex")
+
+	// The server only hands out the ciphertext on the decryption page
+	rs = ts.Get(t, "/snippet/raw/5")
+	assert.Equal(t, rs.Status, http.StatusNotFound)
+}
+
+func TestSnippetCreateEncryptedPost(t *testing.T) {
+	const ciphertext = "dHdlbHZlIGJ5dGVzeyJ0aXRsZSI6IkhpIn1zaXh0ZWVuIGJ5dGUgdGFn"
+
+	tests := []struct {
+		name     string
+		form     url.Values
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid",
+			form:     url.Values{"ciphertext": {ciphertext}, "expires": {"7"}},
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "No ciphertext",
+			form:     url.Values{"expires": {"7"}},
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "Encrypted snippets need JavaScript to be enabled.",
+		},
+		{
+			name:     "Plaintext",
+			form:     url.Values{"ciphertext": {"An old silent pond"}, "expires": {"7"}},
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Invalid expiry",
+			form:     url.Values{"ciphertext": {ciphertext}, "expires": {"30"}},
+			wantCode: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := testutil.NewServer(t, newTestApplication(t).routes())
+			ts.Login(t, "alice@example.com", "pa$$word")
+
+			rs := ts.Submit(t, "/snippet/create/encrypted", "/snippet/create/encrypted", tt.form)
+			assert.Equal(t, rs.Status, tt.wantCode)
+			if tt.wantCode == http.StatusSeeOther {
+				assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/snippet/view/5")
+			}
+			if tt.wantBody != "" {
+				assert.StringContains(t, rs.Body, tt.wantBody)
+			}
+		})
+	}
+
+	// The script posts like htmx, so it can add the key to the redirect
+	t.Run("Script", func(t *testing.T) {
+		ts := testutil.NewServer(t, newTestApplication(t).routes())
+		ts.Login(t, "alice@example.com", "pa$$word")
+
+		page := ts.Get(t, "/snippet/create/encrypted")
+		form := url.Values{
+			"csrf_token": {testutil.ExtractCSRFToken(t, page.Body)},
+			"ciphertext": {ciphertext},
+			"expires":    {"7"},
+		}
+		req := ts.NewRequest(t, http.MethodPost, "/snippet/create/encrypted", bytes.NewBufferString(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Referer", ts.URL+"/snippet/create/encrypted")
+		req.Header.Set("HX-Request", "true")
+
+		rs := ts.Do(t, req)
+		assert.Equal(t, rs.Status, http.StatusOK)
+		assert.Equal(t, rs.Header.Get("HX-Redirect"), "/snippet/view/5")
+	})
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// =============================================================================
+// Live Updates
+// =============================================================================
+
+const (
+	// eventBuffer is how many events a subscriber can fall behind by before
+	// it misses some
+	eventBuffer = 16
+
+	// eventHeartbeat is how often an idle stream sends a comment, so
+	// proxies don't close it
+	eventHeartbeat = 30 * time.Second
+
+	// eventRetry is how long browsers wait before reconnecting a dropped
+	// stream, in milliseconds
+	eventRetry = 5000
+)
+
+// snippetEvent announces a newly created public snippet
+type snippetEvent struct {
+	ID      int
+	Title   string
+	Created time.Time
+}
+
+// eventHub fans events out to the visitors streaming them. Events are only
+// delivered within this instance. A subscriber that falls behind misses
+// events rather than holding up the publisher.
+type eventHub struct {
+	mu     sync.Mutex
+	subs   map[chan snippetEvent]struct{}
+	closed bool
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subs: make(map[chan snippetEvent]struct{})}
+}
+
+// subscribe returns a channel receiving events until unsubscribe is called
+// or the hub is closed, which closes the channel
+func (h *eventHub) subscribe() (events <-chan snippetEvent, unsubscribe func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan snippetEvent, eventBuffer)
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	h.subs[ch] = struct{}{}
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subs[ch]; ok {
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// publish sends e to every subscriber with room for it
+func (h *eventHub) publish(e snippetEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// close ends every subscriber's stream, so the server can shut down
+// without waiting for them. Later subscribers get a closed channel.
+func (h *eventHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for ch := range h.subs {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
+
+// eventStream streams newly created public snippets to the home page as
+// server-sent events named "snippet", with the creation time formatted for
+// the visitor's locale
+func (app *application) eventStream(w http.ResponseWriter, r *http.Request) {
+	// The stream outlasts the server's write timeout
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		app.serverError(w, err)
+		return
+	}
+
+	events, unsubscribe := app.events.subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Stop nginx buffering the stream
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", eventRetry)
+	rc.Flush()
+
+	locale := app.locale(r)
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(map[string]any{
+				"id":      e.ID,
+				"title":   e.Title,
+				"created": humanDate(e.Created, locale),
+			})
+			if err != nil {
+				app.logger.ErrorContext(r.Context(), "event stream", "error", err)
+				return
+			}
+			fmt.Fprintf(w, "id: %d\nevent: snippet\ndata: %s\n\n", e.ID, data)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestEventHub(t *testing.T) {
+	hub := newEventHub()
+	a, unsubscribeA := hub.subscribe()
+	b, unsubscribeB := hub.subscribe()
+
+	hub.publish(snippetEvent{ID: 1, Title: "An old silent pond"})
+	assert.Equal(t, (<-a).ID, 1)
+	assert.Equal(t, (<-b).ID, 1)
+
+	// An unsubscribed channel is closed and gets nothing more
+	unsubscribeB()
+	unsubscribeB()
+	hub.publish(snippetEvent{ID: 2})
+	assert.Equal(t, (<-a).ID, 2)
+	_, ok := <-b
+	assert.Equal(t, ok, false)
+
+	// A subscriber that falls behind misses events instead of blocking
+	for i := range eventBuffer + 5 {
+		hub.publish(snippetEvent{ID: 10 + i})
+	}
+	assert.Equal(t, len(a), eventBuffer)
+
+	// Closing ends every stream, including ones started afterwards
+	hub.close()
+	for range a {
+	}
+	c, unsubscribeC := hub.subscribe()
+	_, ok = <-c
+	assert.Equal(t, ok, false)
+	unsubscribeA()
+	unsubscribeC()
+}
+
+func TestEventStream(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+
+	rs, err := ts.Client().Do(ts.NewRequest(t, http.MethodGet, "/events", nil))
+	assert.NilError(t, err)
+	defer rs.Body.Close()
+
+	assert.Equal(t, rs.StatusCode, http.StatusOK)
+	assert.Equal(t, rs.Header.Get("Content-Type"), "text/event-stream")
+
+	// The retry interval comes first, once the visitor is subscribed
+	lines := bufio.NewReader(rs.Body)
+	line, err := lines.ReadString('\n')
+	assert.NilError(t, err)
+	assert.Equal(t, line, "retry: 5000\n")
+	lines.ReadString('\n')
+
+	created := time.Date(2026, 3, 17, 10, 15, 0, 0, time.UTC)
+	app.events.publish(snippetEvent{ID: 42, Title: "<An old silent pond>", Created: created})
+
+	var event []string
+	for {
+		line, err = lines.ReadString('\n')
+		assert.NilError(t, err)
+		if line == "\n" {
+			break
+		}
+		event = append(event, strings.TrimSuffix(line, "\n"))
+	}
+	assert.Equal(t, strings.Join(event, "|"),
+		`id: 42|event: snippet|data: {"created":"17 Mar 2026 at 10:15","id":42,"title":"\u003cAn old silent pond\u003e"}`)
+
+	// Closing the hub ends the stream
+	app.events.close()
+	_, err = io.ReadAll(lines)
+	assert.NilError(t, err)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"adotkaya.playground/internal/models"
+)
+
+// =============================================================================
+// CSV Exports
+// =============================================================================
+// Admins can download every user and every snippet as CSV, and users their
+// own snippets, for analysis in a spreadsheet. Rows are written as they are
+// read from the database. Once the first has gone out the status can't
+// change, so a failure part way through is logged and leaves the file cut
+// short.
+
+// csvTimeFormat is how times are written in CSV files
+const csvTimeFormat = time.RFC3339
+
+// csvDownload is a CSV file being written to the client
+type csvDownload struct {
+	*csv.Writer
+	rw *responseWriter
+}
+
+// newCSVDownload starts a CSV download named after name and today's date,
+// e.g. "users-2026-01-02.csv"
+func newCSVDownload(w http.ResponseWriter, name string) *csvDownload {
+	filename := fmt.Sprintf("%s-%s.csv", name, time.Now().UTC().Format("2006-01-02"))
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	rw := wrapResponse(w)
+	return &csvDownload{Writer: csv.NewWriter(rw), rw: rw}
+}
+
+// Row writes a row of cells, each guarded by csvCell
+func (d *csvDownload) Row(cells ...string) error {
+	for i, v := range cells {
+		cells[i] = csvCell(v)
+	}
+	return d.Write(cells)
+}
+
+// csvCell guards a value against being run as a formula when the file is
+// opened in a spreadsheet, by prefixing values that would start one with
+// an apostrophe. Snippet titles and user names are written by anyone.
+func csvCell(v string) string {
+	if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+// userCSVHeader names the columns of a users export
+var userCSVHeader = []string{"id", "name", "email", "role", "tier", "active", "banned", "created", "snippets"}
+
+// snippetCSVHeader names the columns of a snippets export
+var snippetCSVHeader = []string{"id", "user_id", "title", "language", "tags", "bytes", "private", "encrypted", "held", "views", "created", "expires"}
+
+// adminExportUsers downloads every user as CSV
+func (app *application) adminExportUsers(w http.ResponseWriter, r *http.Request) {
+	app.recordAudit(r, models.AuditDataExport, "users", "")
+
+	d := newCSVDownload(w, "users")
+	d.Write(userCSVHeader)
+	err := app.exports.Users(r.Context(), func(u *models.ExportedUser) error {
+		return d.Row(
+			strconv.Itoa(u.ID), u.Name, u.Email, u.Role, u.Tier,
+			strconv.FormatBool(u.Active), strconv.FormatBool(u.Banned),
+			u.Created.UTC().Format(csvTimeFormat), strconv.Itoa(u.Snippets))
+	})
+	app.finishCSV(w, d, "users", err)
+}
+
+// adminExportSnippets downloads every snippet as CSV
+func (app *application) adminExportSnippets(w http.ResponseWriter, r *http.Request) {
+	app.recordAudit(r, models.AuditDataExport, "snippets", "")
+	app.exportSnippets(w, r, "snippets", 0)
+}
+
+// accountExportSnippets downloads the user's own snippets as CSV,
+// including private and expired ones
+func (app *application) accountExportSnippets(w http.ResponseWriter, r *http.Request) {
+	app.exportSnippets(w, r, "my-snippets", userIDKey.Get(app.sessionManager, r.Context()))
+}
+
+// exportSnippets writes the snippets of the user with userID, or every
+// snippet for 0, as a CSV file named after name
+func (app *application) exportSnippets(w http.ResponseWriter, r *http.Request, name string, userID int) {
+	d := newCSVDownload(w, name)
+	d.Write(snippetCSVHeader)
+	err := app.exports.Snippets(r.Context(), userID, func(s *models.ExportedSnippet) error {
+		return d.Row(
+			strconv.Itoa(s.ID), strconv.Itoa(s.UserID), s.Title, s.Language,
+			strings.Join(s.Tags, " "), strconv.Itoa(s.Size),
+			strconv.FormatBool(s.Private), strconv.FormatBool(s.Encrypted), strconv.FormatBool(s.Held),
+			strconv.Itoa(s.Views),
+			s.Created.UTC().Format(csvTimeFormat), s.Expires.UTC().Format(csvTimeFormat))
+	})
+	app.finishCSV(w, d, name, err)
+}
+
+// finishCSV ends a CSV download. If err stopped it before anything was
+// sent, the client gets an error page instead; after that all that can be
+// done is to log it.
+func (app *application) finishCSV(w http.ResponseWriter, d *csvDownload, name string, err error) {
+	if err == nil {
+		d.Flush()
+		err = d.Error()
+	} else if d.rw.status == 0 {
+		w.Header().Del("Content-Disposition")
+		app.serverError(w, err)
+		return
+	}
+	if err != nil {
+		app.logger.Error("export", "name", name, "error", err)
+	}
+}
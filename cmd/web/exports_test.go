@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/models/mocks"
+	"adotkaya.playground/internal/testutil"
+)
+
+// failingExports fails every export before the first row
+type failingExports struct {
+	mocks.ExportModel
+}
+
+func (m *failingExports) Users(ctx context.Context, fn func(*models.ExportedUser) error) error {
+	return errors.New("connection refused")
+}
+
+func TestAdminExports(t *testing.T) {
+	app := newTestApplication(t)
+	audit := &recordingAudit{}
+	app.audit = audit
+	ts := testutil.NewServer(t, app.routes())
+
+	ts.Login(t, "alice@example.com", "pa$$word")
+	rs := ts.Get(t, "/admin/export/users.csv")
+	assert.Equal(t, rs.Status, http.StatusForbidden)
+
+	ts.Login(t, "admin@example.com", "pa$$word")
+	rs = ts.Get(t, "/admin/export/users.csv")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.Equal(t, rs.Header.Get("Content-Type"), "text/csv; charset=utf-8")
+	assert.StringContains(t, rs.Header.Get("Content-Disposition"), `attachment; filename="users-`)
+	assert.Equal(t, rs.Body, "id,name,email,role,tier,active,banned,created,snippets\n"+
+		"1,Alice Jones,alice@example.com,user,free,true,false,2022-01-01T10:00:00Z,1\n"+
+		"3,Carol Admin,admin@example.com,admin,free,true,false,2022-01-01T10:00:00Z,0\n")
+
+	rs = ts.Get(t, "/admin/export/snippets.csv")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.Equal(t, rs.Body, "id,user_id,title,language,tags,bytes,private,encrypted,held,views,created,expires\n"+
+		"1,0,An old silent pond,,,21,false,false,false,7,2026-01-02T00:00:00Z,2027-01-02T00:00:00Z\n"+
+		"4,1,'=1+1,go,diary haiku,22,true,false,false,0,2026-01-03T00:00:00Z,2027-01-03T00:00:00Z\n")
+
+	assert.DeepEqual(t, audit.entries, []auditRecord{
+		{3, models.AuditDataExport, "users", ""},
+		{3, models.AuditDataExport, "snippets", ""},
+	})
+
+	// A failure before anything is sent is an error page, not a download
+	app.exports = &failingExports{}
+	rs = ts.Get(t, "/admin/export/users.csv")
+	assert.Equal(t, rs.Status, http.StatusInternalServerError)
+	assert.Equal(t, rs.Header.Get("Content-Disposition"), "")
+}
+
+func TestAccountExportSnippets(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+
+	rs := ts.Get(t, "/account/snippets.csv")
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/user/login")
+
+	// Only Alice's own snippets
+	ts.Login(t, "alice@example.com", "pa$$word")
+	rs = ts.Get(t, "/account/snippets.csv")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.StringContains(t, rs.Header.Get("Content-Disposition"), `attachment; filename="my-snippets-`)
+	assert.Equal(t, rs.Body, "id,user_id,title,language,tags,bytes,private,encrypted,held,views,created,expires\n"+
+		"4,1,'=1+1,go,diary haiku,22,true,false,false,0,2026-01-03T00:00:00Z,2027-01-03T00:00:00Z\n")
+
+	rs = ts.Get(t, "/user/profile/1")
+	assert.StringContains(t, rs.Body, `<a href="/account/snippets.csv">`)
+}
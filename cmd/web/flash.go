@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/gob"
+	"net/http"
+	"slices"
+
+	"github.com/alexedwards/scs/v2"
+)
+
+// =============================================================================
+// Flash Messages
+// =============================================================================
+// Flash messages are kept in the session until a page shows them. Most are
+// one-off confirmations, shown on the page a form redirects to. Others can
+// stay for a number of pages, or until cleared, so they survive a round
+// trip through other pages, such as the login confirmation notice shown
+// while the user goes to find the email. htmx fragments and redirects never
+// use them up; only full pages do.
+
+// Flash message levels, styling the message
+const (
+	flashSuccess = ""
+	flashInfo    = "info"
+	flashWarning = "warning"
+)
+
+// flashSticky as a message's Views keeps it until clearFlash removes it
+const flashSticky = -1
+
+// maxFlashes caps the messages queued in a session; the oldest are dropped
+const maxFlashes = 5
+
+// flashMessage is a message shown at the top of the next pages
+type flashMessage struct {
+	Key     string // Names the message, replacing any other with the same key
+	Level   string // flashSuccess, flashInfo or flashWarning
+	Message string
+	Views   int // How many pages show it: 0 or 1 for one, or flashSticky
+}
+
+// flashesKey holds the messages waiting to be shown
+const flashesKey sessionKey[[]flashMessage] = "flashes"
+
+func init() {
+	// Sessions encode their values with gob, which must know the type
+	gob.Register([]flashMessage{})
+}
+
+// putFlash queues a one-off confirmation for the next page
+func (app *application) putFlash(r *http.Request, message string) {
+	app.addFlash(r, flashMessage{Message: message})
+}
+
+// addFlash queues a message, replacing any queued message with its key
+func (app *application) addFlash(r *http.Request, f flashMessage) {
+	flashes := flashesKey.Get(app.sessionManager, r.Context())
+	if f.Key != "" {
+		flashes = slices.DeleteFunc(flashes, func(q flashMessage) bool { return q.Key == f.Key })
+	}
+	flashes = append(flashes, f)
+	if len(flashes) > maxFlashes {
+		flashes = flashes[len(flashes)-maxFlashes:]
+	}
+	flashesKey.Put(app.sessionManager, r.Context(), flashes)
+}
+
+// clearFlash removes the queued message with key, if any
+func (app *application) clearFlash(r *http.Request, key string) {
+	flashes := flashesKey.Get(app.sessionManager, r.Context())
+	kept := slices.DeleteFunc(slices.Clone(flashes), func(f flashMessage) bool { return f.Key == key })
+	if len(kept) != len(flashes) {
+		app.setFlashes(r.Context(), kept)
+	}
+}
+
+// popFlashes returns the messages for the page being rendered, counting it
+// against each message's views. htmx fragments get none, as they don't show
+// them.
+func (app *application) popFlashes(r *http.Request) []flashMessage {
+	if isHTMX(r) {
+		return nil
+	}
+	flashes := flashesKey.Get(app.sessionManager, r.Context())
+	if len(flashes) == 0 {
+		return nil
+	}
+
+	var kept []flashMessage
+	for _, f := range flashes {
+		switch {
+		case f.Views == flashSticky:
+			kept = append(kept, f)
+		case f.Views > 1:
+			f.Views--
+			kept = append(kept, f)
+		}
+	}
+	app.setFlashes(r.Context(), kept)
+	return flashes
+}
+
+// setFlashes replaces the queued messages, removing the key when none are
+// left
+func (app *application) setFlashes(ctx context.Context, flashes []flashMessage) {
+	if len(flashes) == 0 {
+		flashesKey.Remove(app.sessionManager, ctx)
+		return
+	}
+	flashesKey.Put(app.sessionManager, ctx, flashes)
+}
+
+// migrateFlash moves the single flash string sessions held before version
+// 2 into the message list
+func migrateFlash(ctx context.Context, sm *scs.SessionManager) error {
+	if message, ok := sm.Pop(ctx, "flash").(string); ok && message != "" {
+		flashesKey.Put(sm, ctx, []flashMessage{{Message: message}})
+	}
+	return nil
+}
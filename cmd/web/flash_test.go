@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+)
+
+// messages returns the text of flashes
+func messages(flashes []flashMessage) []string {
+	var texts []string
+	for _, f := range flashes {
+		texts = append(texts, f.Message)
+	}
+	return texts
+}
+
+func TestFlashes(t *testing.T) {
+	app := newTestApplication(t)
+	ctx, err := app.sessionManager.Load(t.Context(), "")
+	assert.NilError(t, err)
+	r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+
+	app.putFlash(r, "Saved")
+	app.addFlash(r, flashMessage{Message: "Twice", Views: 2})
+	app.addFlash(r, flashMessage{Key: "notice", Message: "Old notice", Views: flashSticky})
+	app.addFlash(r, flashMessage{Key: "notice", Level: flashInfo, Message: "Notice", Views: flashSticky})
+
+	// htmx fragments don't use them up
+	fragment := r.Clone(ctx)
+	fragment.Header.Set("HX-Request", "true")
+	assert.Equal(t, len(app.popFlashes(fragment)), 0)
+
+	assert.DeepEqual(t, messages(app.popFlashes(r)), []string{"Saved", "Twice", "Notice"})
+	assert.DeepEqual(t, messages(app.popFlashes(r)), []string{"Twice", "Notice"})
+	assert.DeepEqual(t, messages(app.popFlashes(r)), []string{"Notice"})
+	assert.DeepEqual(t, messages(app.popFlashes(r)), []string{"Notice"})
+
+	app.clearFlash(r, "notice")
+	assert.Equal(t, len(app.popFlashes(r)), 0)
+	assert.Equal(t, flashesKey.Exists(app.sessionManager, ctx), false)
+
+	// Only the newest are kept
+	for i := range maxFlashes + 2 {
+		app.putFlash(r, fmt.Sprint(i))
+	}
+	assert.DeepEqual(t, messages(app.popFlashes(r)), []string{"2", "3", "4", "5", "6"})
+}
+
+func TestMigrateFlash(t *testing.T) {
+	app := newTestApplication(t)
+	sm := app.sessionManager
+	ctx, err := sm.Load(t.Context(), "")
+	assert.NilError(t, err)
+
+	sm.Put(ctx, "authenticatedUserID", 1)
+	sm.Put(ctx, "flash", "Snippet successfully created!")
+	assert.NilError(t, migrateSession(ctx, sm, sessionMigrations))
+
+	assert.Equal(t, sm.Exists(ctx, "flash"), false)
+	assert.DeepEqual(t, flashesKey.Get(sm, ctx), []flashMessage{{Message: "Snippet successfully created!"}})
+	assert.Equal(t, sessionVersionKey.Get(sm, ctx), sessionVersion)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+
+	"adotkaya.playground/internal/models"
+)
+
+// =============================================================================
+// Follows
+// =============================================================================
+
+// feedPageSize is the number of snippets per page of the activity feed
+const feedPageSize = 20
+
+// profile is a user's public profile page
+type profile struct {
+	User        *models.User
+	AvatarURL   string
+	Counts      models.FollowCounts
+	IsFollowing bool // Whether the visitor follows this user
+	IsSelf      bool // Whether the visitor is this user
+}
+
+// newFollowerDelivery lets a user know that someone followed them, when the
+// outbox relay delivers the follow
+func (app *application) newFollowerDelivery(followerID, followedID int) (models.OutboxDelivery, error) {
+	follower, err := app.users.Get(followerID)
+	if err != nil {
+		return models.OutboxDelivery{}, err
+	}
+
+	return app.activityDelivery(activity{
+		UserID:   followedID,
+		ActorID:  followerID,
+		Kind:     models.NotifyFollowers,
+		Link:     profilePath(followerID),
+		Template: "new_follower.tmpl",
+		Data: map[string]any{
+			"Follower":   follower.Name,
+			"ProfileURL": app.canonicalURL(profilePath(followerID)),
+		},
+	})
+}
+
+// profilePath is the path of a user's profile page
+func profilePath(id int) string {
+	return fmt.Sprintf("/user/profile/%d", id)
+}
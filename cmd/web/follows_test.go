@@ -0,0 +1,199 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestUserProfile(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		path     string
+		wantCode int
+		wantBody []string
+		dontWant []string
+	}{
+		{
+			name:     "Anonymous",
+			path:     "/user/profile/1",
+			wantCode: http.StatusOK,
+			wantBody: []string{"<h2>Alice</h2>", "Followers: 1", "Following: 0"},
+			dontWant: []string{"/user/profile/1/follow"},
+		},
+		{
+			name:     "Not following",
+			email:    "alice@example.com",
+			path:     "/user/profile/3",
+			wantCode: http.StatusOK,
+			wantBody: []string{"<h2>Carol</h2>", `action="/user/profile/3/follow"`},
+		},
+		{
+			name:     "Following",
+			email:    "admin@example.com",
+			path:     "/user/profile/1",
+			wantCode: http.StatusOK,
+			wantBody: []string{`action="/user/profile/1/unfollow"`},
+		},
+		{
+			name:     "Own profile",
+			email:    "alice@example.com",
+			path:     "/user/profile/1",
+			wantCode: http.StatusOK,
+			wantBody: []string{"<h2>Alice</h2>"},
+			dontWant: []string{"/user/profile/1/follow", "/user/profile/1/unfollow"},
+		},
+		{
+			name:     "Non-existent user",
+			path:     "/user/profile/2",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Invalid ID",
+			path:     "/user/profile/foo",
+			wantCode: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := testutil.NewServer(t, newTestApplication(t).routes())
+			if tt.email != "" {
+				ts.Login(t, tt.email, "pa$$word")
+			}
+
+			rs := ts.Get(t, tt.path)
+			assert.Equal(t, rs.Status, tt.wantCode)
+			for _, want := range tt.wantBody {
+				assert.StringContains(t, rs.Body, want)
+			}
+			for _, unwanted := range tt.dontWant {
+				assert.Equal(t, strings.Contains(rs.Body, unwanted), false)
+			}
+		})
+	}
+}
+
+func TestUserFollowPost(t *testing.T) {
+	tests := []struct {
+		name      string
+		email     string
+		path      string
+		wantCode  int
+		wantRedir string
+	}{
+		{
+			name:      "Follow",
+			email:     "alice@example.com",
+			path:      "/user/profile/3/follow",
+			wantCode:  http.StatusSeeOther,
+			wantRedir: "/user/profile/3",
+		},
+		{
+			name:      "Already following",
+			email:     "admin@example.com",
+			path:      "/user/profile/1/follow",
+			wantCode:  http.StatusSeeOther,
+			wantRedir: "/user/profile/1",
+		},
+		{
+			name:     "Self",
+			email:    "alice@example.com",
+			path:     "/user/profile/1/follow",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Non-existent user",
+			email:    "alice@example.com",
+			path:     "/user/profile/2/follow",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:      "Unfollow",
+			email:     "admin@example.com",
+			path:      "/user/profile/1/unfollow",
+			wantCode:  http.StatusSeeOther,
+			wantRedir: "/user/profile/1",
+		},
+		{
+			name:      "Anonymous",
+			path:      "/user/profile/3/follow",
+			wantCode:  http.StatusSeeOther,
+			wantRedir: "/user/login",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := testutil.NewServer(t, newTestApplication(t).routes())
+			if tt.email != "" {
+				ts.Login(t, tt.email, "pa$$word")
+			}
+
+			rs := ts.Submit(t, "/user/login", tt.path, url.Values{})
+			assert.Equal(t, rs.Status, tt.wantCode)
+			if tt.wantRedir != "" {
+				assert.Equal(t, rs.Header.Get("Location"), tt.wantRedir)
+			}
+		})
+	}
+}
+
+func TestFeed(t *testing.T) {
+	tests := []struct {
+		name      string
+		email     string
+		path      string
+		wantCode  int
+		wantBody  string
+		wantRedir string
+	}{
+		{
+			name:     "Following",
+			email:    "admin@example.com",
+			path:     "/feed",
+			wantCode: http.StatusOK,
+			wantBody: `<a href="/user/profile/1">Alice</a>`,
+		},
+		{
+			name:     "Past the last page",
+			email:    "admin@example.com",
+			path:     "/feed?page=2",
+			wantCode: http.StatusOK,
+			wantBody: "Nothing here yet.",
+		},
+		{
+			name:     "Following nobody",
+			email:    "alice@example.com",
+			path:     "/feed",
+			wantCode: http.StatusOK,
+			wantBody: "Nothing here yet.",
+		},
+		{
+			name:      "Anonymous",
+			path:      "/feed",
+			wantCode:  http.StatusSeeOther,
+			wantRedir: "/user/login",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := testutil.NewServer(t, newTestApplication(t).routes())
+			if tt.email != "" {
+				ts.Login(t, tt.email, "pa$$word")
+			}
+
+			rs := ts.Get(t, tt.path)
+			assert.Equal(t, rs.Status, tt.wantCode)
+			if tt.wantRedir != "" {
+				assert.Equal(t, rs.Header.Get("Location"), tt.wantRedir)
+			}
+			if tt.wantBody != "" {
+				assert.StringContains(t, rs.Body, tt.wantBody)
+			}
+		})
+	}
+}
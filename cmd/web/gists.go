@@ -0,0 +1,427 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/validator"
+)
+
+// =============================================================================
+// GitHub Gist Integration
+// =============================================================================
+// Users connect a GitHub token on the integrations page, then push their
+// snippets to Gists from the snippet page, optionally keeping the Gist in
+// sync as the snippet is edited. Pushes happen on the job worker, so a slow
+// or unreachable GitHub never holds up a page.
+
+const (
+	gistJobKind     = "gist"
+	gistMaxAttempts = 5
+
+	// githubTimeout bounds each call to the GitHub API
+	githubTimeout = 10 * time.Second
+
+	// maxGitHubResponse caps how much of a GitHub response is read
+	maxGitHubResponse = 1 << 20
+)
+
+var (
+	// errGitHubUnauthorized is returned when GitHub rejects a token, which
+	// has been revoked or lacks the gist scope
+	errGitHubUnauthorized = errors.New("github: token rejected")
+
+	// errGistNotFound is returned when updating a Gist that was deleted on
+	// GitHub
+	errGistNotFound = errors.New("github: gist not found")
+)
+
+// gistFile is the content of a Gist, which holds a single file
+type gistFile struct {
+	Description string
+	Public      bool
+	Filename    string
+	Content     string
+}
+
+// gistClient talks to the GitHub Gist API on behalf of a user's token
+type gistClient interface {
+	// User returns the username a token belongs to
+	User(token string) (string, error)
+	// Create creates a Gist, returning its ID and URL
+	Create(token string, f gistFile) (id, url string, err error)
+	// Update replaces the content of a Gist, returning its URL
+	Update(token, id string, f gistFile) (url string, err error)
+}
+
+// githubGists is the gistClient for the GitHub REST API
+type githubGists struct {
+	client  *http.Client
+	baseURL string // Such as https://api.github.com
+}
+
+// newGitHubGists returns a client for the GitHub REST API at baseURL
+func newGitHubGists(baseURL string) *githubGists {
+	return &githubGists{
+		client:  &http.Client{Timeout: githubTimeout},
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+func (g *githubGists) User(token string) (string, error) {
+	var user struct {
+		Login string `json:"login"`
+	}
+	err := g.do(token, http.MethodGet, "/user", nil, &user)
+	return user.Login, err
+}
+
+func (g *githubGists) Create(token string, f gistFile) (string, string, error) {
+	var created struct {
+		ID      string `json:"id"`
+		HTMLURL string `json:"html_url"`
+	}
+	err := g.do(token, http.MethodPost, "/gists", gistRequest(f, true), &created)
+	return created.ID, created.HTMLURL, err
+}
+
+func (g *githubGists) Update(token, id string, f gistFile) (string, error) {
+	var updated struct {
+		HTMLURL string `json:"html_url"`
+	}
+	err := g.do(token, http.MethodPatch, "/gists/"+id, gistRequest(f, false), &updated)
+	return updated.HTMLURL, err
+}
+
+// gistRequest builds the body creating or updating a Gist. Whether a Gist
+// is public can't be changed once it is created.
+func gistRequest(f gistFile, create bool) map[string]any {
+	body := map[string]any{
+		"description": f.Description,
+		"files":       map[string]any{f.Filename: map[string]string{"content": f.Content}},
+	}
+	if create {
+		body["public"] = f.Public
+	}
+	return body
+}
+
+// do sends a request to the GitHub API and decodes the JSON response into
+// out
+func (g *githubGists) do(token, method, path string, in, out any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), githubTimeout)
+	defer cancel()
+
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, g.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return errGitHubUnauthorized
+	case resp.StatusCode == http.StatusNotFound && method == http.MethodPatch:
+		return errGistNotFound
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return fmt.Errorf("github: %s %s: %s", method, path, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxGitHubResponse)).Decode(out)
+}
+
+// gistExtensions are the file extensions Gists are named with, so GitHub
+// highlights them, by detected language
+var gistExtensions = map[string]string{
+	"c":          ".c",
+	"cpp":        ".cpp",
+	"css":        ".css",
+	"go":         ".go",
+	"html":       ".html",
+	"java":       ".java",
+	"javascript": ".js",
+	"json":       ".json",
+	"markdown":   ".md",
+	"php":        ".php",
+	"python":     ".py",
+	"ruby":       ".rb",
+	"rust":       ".rs",
+	"shell":      ".sh",
+	"sql":        ".sql",
+	"typescript": ".ts",
+	"yaml":       ".yaml",
+}
+
+// gistFilename names a snippet's Gist file after its title, with the
+// extension of its language
+func gistFilename(s *models.Snippet) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s.Title) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+			dash = false
+		case !dash && b.Len() > 0:
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	name := strings.TrimSuffix(b.String(), "-")
+	if name == "" {
+		name = fmt.Sprintf("snippet-%d", s.ID)
+	}
+
+	ext, ok := gistExtensions[s.Language]
+	if !ok {
+		ext = ".txt"
+	}
+	return name + ext
+}
+
+// gistJob is the payload of a job pushing a snippet to its Gist
+type gistJob struct {
+	SnippetID int
+}
+
+// enqueueGist queues a push of a snippet to its Gist
+func (app *application) enqueueGist(snippetID int) error {
+	_, err := app.jobs.Enqueue(gistJobKind, gistJob{SnippetID: snippetID}, gistMaxAttempts)
+	return err
+}
+
+// pushGistJob is the job handler pushing a snippet to its Gist, creating
+// the Gist on the first push. A snippet deleted or unlinked since the job
+// was queued, or whose owner has disconnected GitHub, is skipped.
+func (app *application) pushGistJob(payload []byte) error {
+	var job gistJob
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return permanent(err)
+	}
+
+	link, err := app.gists.GetLink(job.SnippetID)
+	if errors.Is(err, models.ErrNoRecord) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	token, err := app.gists.Token(link.UserID)
+	if errors.Is(err, models.ErrNoRecord) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	snippet, err := app.snippets.Get(context.Background(), job.SnippetID)
+	if errors.Is(err, models.ErrNoRecord) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	// Content encrypted in the browser can't be read here, and pushing the
+	// ciphertext would be no use to anyone
+	if snippet.Encrypted {
+		return nil
+	}
+
+	f := gistFile{
+		Description: snippet.Title,
+		Public:      !snippet.Private,
+		Filename:    gistFilename(snippet),
+		Content:     snippet.Content,
+	}
+
+	id, url := link.GistID, ""
+	if id != "" {
+		url, err = app.github.Update(token.Token, id, f)
+	}
+	// A Gist deleted on GitHub is created afresh
+	if id == "" || errors.Is(err, errGistNotFound) {
+		id, url, err = app.github.Create(token.Token, f)
+	}
+	if errors.Is(err, errGitHubUnauthorized) {
+		return permanent(err)
+	} else if err != nil {
+		return err
+	}
+
+	return app.gists.SetGist(snippet.ID, id, url)
+}
+
+// =============================================================================
+// Handlers
+// =============================================================================
+
+// githubTokenForm represents the form connecting a GitHub token
+type githubTokenForm struct {
+	Token               string `form:"token"`
+	validator.Validator `form:"-"`
+}
+
+// gistForm represents the form pushing a snippet to a Gist
+type gistForm struct {
+	Sync bool `form:"sync"`
+}
+
+// accountIntegrations shows the user's connected GitHub account with the
+// form to connect one
+func (app *application) accountIntegrations(w http.ResponseWriter, r *http.Request) {
+	app.renderIntegrations(w, r, http.StatusOK, githubTokenForm{})
+}
+
+// accountIntegrationsPost connects a GitHub token, once GitHub has said
+// whose it is
+func (app *application) accountIntegrationsPost(w http.ResponseWriter, r *http.Request) {
+	var form githubTokenForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.Token = strings.TrimSpace(form.Token)
+	form.CheckField(validator.NotBlank(form.Token), "token", app.translate(r, "validation.blank"))
+	form.CheckField(validator.MaxChars(form.Token, 255), "token", app.translate(r, "validation.max_chars", 255))
+
+	var login string
+	if form.Valid() {
+		login, err = app.github.User(form.Token)
+		switch {
+		case errors.Is(err, errGitHubUnauthorized):
+			form.AddFieldError("token", app.translate(r, "validation.github_token"))
+		case err != nil:
+			app.logger.ErrorContext(r.Context(), "github user", "error", err)
+			form.AddNonFieldError(app.translate(r, "validation.github_unavailable"))
+		}
+	}
+
+	if !form.Valid() {
+		app.renderIntegrations(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	userID := userIDKey.Get(app.sessionManager, r.Context())
+	err = app.gists.SetToken(userID, form.Token, login)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.putFlash(r, app.translate(r, "flash.github_connected", login))
+	http.Redirect(w, r, "/account/integrations", http.StatusSeeOther)
+}
+
+// accountIntegrationsDeletePost disconnects the user's GitHub token
+func (app *application) accountIntegrationsDeletePost(w http.ResponseWriter, r *http.Request) {
+	userID := userIDKey.Get(app.sessionManager, r.Context())
+	err := app.gists.DeleteToken(userID)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return
+	}
+
+	app.putFlash(r, app.translate(r, "flash.github_disconnected"))
+	http.Redirect(w, r, "/account/integrations", http.StatusSeeOther)
+}
+
+// renderIntegrations renders the integrations page with the form to
+// connect GitHub
+func (app *application) renderIntegrations(w http.ResponseWriter, r *http.Request, status int, form githubTokenForm) {
+	userID := userIDKey.Get(app.sessionManager, r.Context())
+	token, err := app.gists.Token(userID)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.GitHub = token
+	data.Form = form
+	data.Breadcrumbs = app.breadcrumbs(r, Crumb{Label: app.translate(r, "integrations.title")})
+	app.render(w, status, "integrations.tmpl", data)
+}
+
+// snippetGistPost pushes one of the user's snippets to a Gist, and keeps
+// pushing its edits if asked to
+func (app *application) snippetGistPost(w http.ResponseWriter, r *http.Request) {
+	snippet := app.loadedSnippet(r)
+	// Anonymous snippets have no account to connect GitHub to
+	if snippet.UserID == 0 || snippet.Encrypted {
+		app.notFound(w, r)
+		return
+	}
+
+	var form gistForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	_, err = app.gists.Token(snippet.UserID)
+	if errors.Is(err, models.ErrNoRecord) {
+		app.putFlash(r, app.translate(r, "flash.github_required"))
+		http.Redirect(w, r, "/account/integrations", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.gists.Link(snippet.ID, snippet.UserID, form.Sync)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	err = app.enqueueGist(snippet.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.putFlash(r, app.translate(r, "flash.gist_queued"))
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+// syncGist queues a push of an edited snippet to its Gist, if it is kept
+// in sync with one. The edit has already been saved, so a failure is
+// logged rather than shown to the user.
+func (app *application) syncGist(id int) {
+	link, err := app.gists.GetLink(id)
+	if errors.Is(err, models.ErrNoRecord) || (err == nil && !link.Sync) {
+		return
+	}
+	if err == nil {
+		err = app.enqueueGist(id)
+	}
+	if err != nil {
+		app.logger.Error("sync gist", "snippet_id", id, "error", err)
+	}
+}
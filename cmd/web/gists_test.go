@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/testutil"
+)
+
+// fakeGists is a gistClient recording the Gists pushed to it
+type fakeGists struct {
+	err     error // Returned by every call, if set
+	created []gistFile
+	updated map[string]gistFile
+}
+
+func (f *fakeGists) User(token string) (string, error) {
+	return "alice", f.err
+}
+func (f *fakeGists) Create(token string, g gistFile) (string, string, error) {
+	if f.err != nil {
+		return "", "", f.err
+	}
+	f.created = append(f.created, g)
+	return "new", "https://gist.github.com/alice/new", nil
+}
+func (f *fakeGists) Update(token, id string, g gistFile) (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+	if f.updated == nil {
+		f.updated = map[string]gistFile{}
+	}
+	f.updated[id] = g
+	return "https://gist.github.com/alice/" + id, nil
+}
+
+func TestGitHubGists(t *testing.T) {
+	var got map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer ghp_alice" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /user":
+			io.WriteString(w, `{"login": "alice"}`)
+		case "POST /gists":
+			json.NewDecoder(r.Body).Decode(&got)
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"id": "abc", "html_url": "https://gist.github.com/alice/abc"}`)
+		case "PATCH /gists/abc":
+			json.NewDecoder(r.Body).Decode(&got)
+			io.WriteString(w, `{"id": "abc", "html_url": "https://gist.github.com/alice/abc"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	g := newGitHubGists(srv.URL + "/")
+
+	login, err := g.User("ghp_alice")
+	assert.NilError(t, err)
+	assert.Equal(t, login, "alice")
+
+	_, err = g.User("ghp_mallory")
+	assert.ErrorIs(t, err, errGitHubUnauthorized)
+
+	f := gistFile{Description: "Pond", Public: false, Filename: "pond.go", Content: "package pond"}
+	id, url, err := g.Create("ghp_alice", f)
+	assert.NilError(t, err)
+	assert.Equal(t, id, "abc")
+	assert.Equal(t, url, "https://gist.github.com/alice/abc")
+	assert.Equal(t, got["public"], false)
+	assert.DeepEqual(t, got["files"], any(map[string]any{"pond.go": map[string]any{"content": "package pond"}}))
+
+	// Updates leave the Gist's visibility alone
+	got = nil
+	_, err = g.Update("ghp_alice", "abc", f)
+	assert.NilError(t, err)
+	assert.Equal(t, got["public"], nil)
+
+	_, err = g.Update("ghp_alice", "gone", f)
+	assert.ErrorIs(t, err, errGistNotFound)
+}
+
+func TestGistFilename(t *testing.T) {
+	tests := []struct {
+		name    string
+		snippet *models.Snippet
+		want    string
+	}{
+		{"Title", &models.Snippet{ID: 1, Title: "An old silent pond", Language: "go"}, "an-old-silent-pond.go"},
+		{"Punctuation", &models.Snippet{ID: 1, Title: "  Hello, World!  "}, "hello-world.txt"},
+		{"Unicode", &models.Snippet{ID: 1, Title: "Kış günü", Language: "python"}, "kış-günü.py"},
+		{"No title", &models.Snippet{ID: 7, Title: "!!!"}, "snippet-7.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, gistFilename(tt.snippet), tt.want)
+		})
+	}
+}
+
+func TestPushGistJob(t *testing.T) {
+	app := newTestApplication(t)
+	github := &fakeGists{}
+	app.github = github
+
+	payload := func(id int) []byte {
+		b, err := json.Marshal(gistJob{SnippetID: id})
+		assert.NilError(t, err)
+		return b
+	}
+
+	// Snippet 4 is already pushed, so its Gist is updated; private
+	// snippets make secret Gists
+	assert.NilError(t, app.pushGistJob(payload(4)))
+	assert.Equal(t, github.updated["aa5a315d61ae9438b18d"].Filename, "dear-diary.txt")
+	assert.Equal(t, github.updated["aa5a315d61ae9438b18d"].Content, "Today I wrote a haiku.")
+
+	// Snippet 1 is linked but not pushed yet, so its Gist is created
+	assert.NilError(t, app.pushGistJob(payload(1)))
+	assert.Equal(t, len(github.created), 1)
+	assert.Equal(t, github.created[0].Public, true)
+
+	// Unlinked snippets are skipped
+	assert.NilError(t, app.pushGistJob(payload(2)))
+	assert.Equal(t, len(github.created), 1)
+
+	// A rejected token isn't retried
+	github.err = errGitHubUnauthorized
+	err := app.pushGistJob(payload(4))
+	var perm permanentError
+	assert.Equal(t, errors.As(err, &perm), true)
+
+	github.err = errors.New("connection reset")
+	err = app.pushGistJob(payload(4))
+	assert.Equal(t, err != nil && !errors.As(err, &perm), true)
+
+	err = app.pushGistJob([]byte("{"))
+	assert.Equal(t, errors.As(err, &perm), true)
+}
+
+func TestAccountIntegrations(t *testing.T) {
+	app := newTestApplication(t)
+	github := &fakeGists{}
+	app.github = github
+	ts := testutil.NewServer(t, app.routes())
+
+	rs := ts.Get(t, "/account/integrations")
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/user/login")
+
+	ts.Login(t, "alice@example.com", "pa$$word")
+
+	rs = ts.Get(t, "/account/integrations")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.StringContains(t, rs.Body, "Connected to GitHub as alice")
+
+	rs = ts.Submit(t, "/account/integrations", "/account/integrations", url.Values{"token": {"ghp_alice"}})
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/account/integrations")
+
+	rs = ts.Submit(t, "/account/integrations", "/account/integrations", url.Values{"token": {" "}})
+	assert.Equal(t, rs.Status, http.StatusUnprocessableEntity)
+	assert.StringContains(t, rs.Body, "This field cannot be blank")
+
+	github.err = errGitHubUnauthorized
+	rs = ts.Submit(t, "/account/integrations", "/account/integrations", url.Values{"token": {"ghp_revoked"}})
+	assert.Equal(t, rs.Status, http.StatusUnprocessableEntity)
+	assert.StringContains(t, rs.Body, "GitHub rejected this token")
+
+	rs = ts.Submit(t, "/account/integrations", "/account/integrations/delete", url.Values{})
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/account/integrations")
+}
+
+func TestSnippetGistPost(t *testing.T) {
+	app := newTestApplication(t)
+	jobs := &fakeJobs{}
+	app.jobs = jobs
+	ts := testutil.NewServer(t, app.routes())
+	ts.Login(t, "alice@example.com", "pa$$word")
+
+	// The owner sees the Gist the snippet is pushed to
+	rs := ts.Get(t, "/snippet/view/4")
+	assert.StringContains(t, rs.Body, `<a href="https://gist.github.com/alice/aa5a315d61ae9438b18d">View on GitHub Gist</a>`)
+	assert.StringContains(t, rs.Body, `name="sync" value="true" checked`)
+
+	rs = ts.Submit(t, "/snippet/view/4", "/snippet/gist/4", url.Values{"sync": {"true"}})
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/snippet/view/4")
+	assert.DeepEqual(t, jobs.enqueued, []any{gistJob{SnippetID: 4}})
+
+	// Only the owner can push a snippet
+	rs = ts.Submit(t, "/snippet/view/4", "/snippet/gist/1", url.Values{})
+	assert.Equal(t, rs.Status, http.StatusForbidden)
+}
@@ -1,13 +1,20 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 
+	"adotkaya.playground/internal/cookies"
+	"adotkaya.playground/internal/i18n"
+	"adotkaya.playground/internal/langdetect"
 	"adotkaya.playground/internal/models"
 	"adotkaya.playground/internal/validator"
 )
@@ -16,11 +23,38 @@ import (
 // Form Types
 // =============================================================================
 
-// SnippetCreateForm represents the form data for creating a snippet
+// SnippetCreateForm represents the form data for creating a snippet. The
+// CAPTCHA fields are only used by anonymous visitors.
 type SnippetCreateForm struct {
 	Title               string `form:"title"`
 	Content             string `form:"content"`
 	Expires             int    `form:"expires"`
+	Tags                string `form:"tags"`
+	Private             bool   `form:"private"`
+	CaptchaToken        string `form:"captcha_token"`
+	CaptchaAnswer       string `form:"captcha"`
+	IdempotencyKey      string `form:"idempotency_key"`
+	validator.Validator `form:"-"`
+}
+
+// encryptedCreateForm represents the form for creating an encrypted
+// snippet. The title and content are encrypted in the browser and only the
+// ciphertext is posted.
+type encryptedCreateForm struct {
+	Ciphertext          string `form:"ciphertext"`
+	Expires             int    `form:"expires"`
+	CaptchaToken        string `form:"captcha_token"`
+	CaptchaAnswer       string `form:"captcha"`
+	IdempotencyKey      string `form:"idempotency_key"`
+	validator.Validator `form:"-"`
+}
+
+// snippetEditForm represents the form data for editing a snippet
+type snippetEditForm struct {
+	Title               string `form:"title"`
+	Content             string `form:"content"`
+	Tags                string `form:"tags"`
+	Private             bool   `form:"private"`
 	validator.Validator `form:"-"`
 }
 
@@ -32,6 +66,29 @@ type userSignupForm struct {
 	validator.Validator `form:"-"`
 }
 
+// userLocaleForm represents the language switcher form data
+type userLocaleForm struct {
+	Locale string `form:"locale"`
+}
+
+// userThemeForm represents the theme switcher form data
+type userThemeForm struct {
+	Theme string `form:"theme"`
+}
+
+// notificationsForm represents the notification preferences form. Enabled
+// lists the kinds left ticked.
+type notificationsForm struct {
+	Enabled []string `form:"enabled"`
+}
+
+// unsubscribeForm carries the signed unsubscribe link parameters
+type unsubscribeForm struct {
+	User  int    `form:"user"`
+	Kind  string `form:"kind"`
+	Token string `form:"token"`
+}
+
 // userLoginForm represents the form data for user login
 type userLoginForm struct {
 	Email               string `form:"email"`
@@ -39,6 +96,51 @@ type userLoginForm struct {
 	validator.Validator `form:"-"`
 }
 
+// accountPasswordUpdateForm represents the form data for changing the
+// user's password
+type accountPasswordUpdateForm struct {
+	CurrentPassword         string `form:"currentPassword"`
+	NewPassword             string `form:"newPassword"`
+	NewPasswordConfirmation string `form:"newPasswordConfirmation"`
+	validator.Validator     `form:"-"`
+}
+
+// banForm represents the admin form for banning an IP address or network.
+// Hours is how long the ban lasts; 0 bans permanently.
+type banForm struct {
+	Network             string `form:"network"`
+	Reason              string `form:"reason"`
+	Hours               int    `form:"hours"`
+	validator.Validator `form:"-"`
+}
+
+// reportForm represents the snippet report form data
+type reportForm struct {
+	Reason string `form:"reason"`
+}
+
+// shareForm represents the form for generating a share link. Days is how
+// long the link works.
+type shareForm struct {
+	Days int `form:"days"`
+}
+
+// subscriptionForm represents the form for saving a search or subscribing
+// to a tag. Email asks for new matches to be emailed.
+type subscriptionForm struct {
+	Kind                string `form:"kind"`
+	Query               string `form:"query"`
+	Email               bool   `form:"email"`
+	validator.Validator `form:"-"`
+}
+
+// apiTokenForm represents the form for creating an API token. Name reminds
+// the user what the token is for.
+type apiTokenForm struct {
+	Name                string `form:"name"`
+	validator.Validator `form:"-"`
+}
+
 // =============================================================================
 // Public Handlers
 // =============================================================================
@@ -48,9 +150,62 @@ func ping(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("OK"))
 }
 
-// home displays the homepage with a list of the latest snippets
+// robots serves robots.txt. Only production is opened up to crawlers (minus
+// account and form pages); every other environment disallows everything so
+// staging copies never end up in search results.
+func (app *application) robots(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+	b.WriteString("User-agent: *\n")
+
+	if app.config.Server.IsProduction() {
+		b.WriteString("Disallow: /user/\n")
+		b.WriteString("Disallow: /snippet/create\n")
+		b.WriteString("Disallow: /snippet/search\n")
+		if app.config.Robots.SitemapURL != "" {
+			fmt.Fprintf(&b, "\nSitemap: %s\n", app.config.Robots.SitemapURL)
+		}
+	} else {
+		b.WriteString("Disallow: /\n")
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
+
+// health reports application health as JSON, including the database pool
+// status when a monitor is running. Responds 503 when the database is down.
+func (app *application) health(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+	body := map[string]any{"status": "ok"}
+
+	if app.dbMonitor != nil {
+		db := app.dbMonitor.snapshot()
+		body["database"] = db
+		if !db.Healthy {
+			status = http.StatusServiceUnavailable
+			body["status"] = "unavailable"
+		}
+	}
+
+	js, err := json.Marshal(body)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
+}
+
+// homePageSize is the number of snippets on each page of the home page
+const homePageSize = 10
+
+// home displays the homepage with a page of the latest snippets, the first
+// by default
 func (app *application) home(w http.ResponseWriter, r *http.Request) {
-	snippets, err := app.snippets.Latest()
+	page := pageParam(r)
+	snippets, total, err := app.snippets.All(r.Context(), page, homePageSize)
 	if err != nil {
 		app.serverError(w, err)
 		return
@@ -58,6 +213,11 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 
 	data := app.newTemplateData(r)
 	data.Snippets = snippets
+	data.Pagination = newPaginator(r, page, homePageSize, total)
+	data.CanonicalURL = app.canonicalURL("/")
+	if page > 1 {
+		data.CanonicalURL = app.canonicalURL(fmt.Sprintf("/?page=%d", page))
+	}
 
 	app.render(w, http.StatusOK, "home.tmpl", data)
 }
@@ -66,38 +226,158 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 // Snippet Handlers
 // =============================================================================
 
+// snippetList returns the latest snippets listing. htmx requests (the home
+// page polls this) receive just the list fragment.
+func (app *application) snippetList(w http.ResponseWriter, r *http.Request) {
+	snippets, err := app.snippets.Latest(r.Context())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippets = snippets
+	data.Breadcrumbs = app.breadcrumbs(r, Crumb{Label: app.translate(r, "nav.snippets")})
+
+	app.renderHTMX(w, r, http.StatusOK, "home.tmpl", "snippet-list", data)
+}
+
 // snippetView displays a single snippet
 func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
+	snippet := app.loadedSnippet(r)
+	if snippet.Encrypted {
+		app.renderDecrypt(w, r, snippet)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Title = snippet.Title
+	data.Description = truncate(snippet.Content, 160)
+	if !snippet.Private {
+		data.CanonicalURL = app.canonicalURL(fmt.Sprintf("/snippet/view/%d", snippet.ID))
+		data.OGType = "article"
+		data.StructuredData = snippetStructuredData(snippet, data.Description, data.CanonicalURL)
+	}
+	data.CanEdit = app.canEdit(r, snippet)
+	var err error
+	// Owners with an account can push the snippet to a Gist
+	if data.CanEdit && snippet.UserID != 0 {
+		data.Gist, err = app.gists.GetLink(snippet.ID)
+		if errors.Is(err, models.ErrNoRecord) {
+			data.Gist = &models.GistLink{}
+		} else if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+	if app.objects != nil {
+		data.Attachments, err = app.attachments.ForSnippet(snippet.ID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		data.CanAttach = data.CanEdit && snippet.UserID != 0
+	}
+	data.Breadcrumbs = app.breadcrumbs(r,
+		Crumb{Label: app.translate(r, "nav.snippets"), URL: "/snippet/list"},
+		Crumb{Label: snippet.Title},
+	)
+
+	// ?plain=1 prints without navigation; ?linenos=1 numbers the lines;
+	// ?lines=10-20 numbers them and highlights a range. Browsers don't send
+	// the #L10-L20 fragment, so main.js turns it into the query.
+	data.Plain = queryFlag(r, "plain")
+	data.Lines = parseLineRange(r.URL.Query().Get("lines"))
+	data.LineNumbers = queryFlag(r, "linenos") || data.Lines != nil
+
+	app.render(w, http.StatusOK, "view.tmpl", data)
+}
+
+// snippetRaw serves a snippet's content as plain text
+func (app *application) snippetRaw(w http.ResponseWriter, r *http.Request) {
+	app.serveSnippetContent(w, r, false)
+}
+
+// snippetDownload serves a snippet's content as a file attachment
+func (app *application) snippetDownload(w http.ResponseWriter, r *http.Request) {
+	app.serveSnippetContent(w, r, true)
+}
+
+// serveSnippetContent streams a snippet's content straight from the
+// database, so memory use stays flat however large the snippet is
+func (app *application) serveSnippetContent(w http.ResponseWriter, r *http.Request, attachment bool) {
 	params := httprouter.ParamsFromContext(r.Context())
 
 	id, err := strconv.Atoi(params.ByName("id"))
 	if err != nil || id < 1 {
-		app.notFound(w)
+		app.notFound(w, r)
 		return
 	}
 
-	snippet, err := app.snippets.Get(id)
+	header, err := app.snippets.GetHeader(r.Context(), id)
 	if err != nil {
-		if errors.Is(err, models.ErrNoRecord) {
-			app.notFound(w)
-		} else {
-			app.serverError(w, err)
-		}
+		app.modelError(w, r, err)
 		return
 	}
+	// Encrypted content is only served on the decryption page
+	if !app.canView(r, header.UserID, header.Private) || header.Encrypted {
+		app.notFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.FormatInt(header.Size, 10))
+	if attachment {
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="snippet-%d.txt"`, header.ID))
+	}
+
+	// Once streaming has started the status can't be changed, so a failure
+	// can only be logged; the short body tells the client something broke
+	_, err = app.snippets.CopyContent(r.Context(), w, id)
+	if err != nil {
+		app.logger.ErrorContext(r.Context(), "stream snippet", "snippet_id", id, "error", err)
+	}
+}
+
+// snippetSearch displays snippets matching the q query string parameter,
+// which can include filters
+func (app *application) snippetSearch(w http.ResponseWriter, r *http.Request) {
+	raw := strings.TrimSpace(r.URL.Query().Get("q"))
 
 	data := app.newTemplateData(r)
-	data.Snippet = snippet
+	data.Query = raw
+	data.Breadcrumbs = app.breadcrumbs(r, Crumb{Label: app.translate(r, "search.title")})
 
-	app.render(w, http.StatusOK, "view.tmpl", data)
+	if raw != "" {
+		var form searchForm
+		q := app.parseSearch(r, &form, raw)
+		if !form.Valid() {
+			data.Form = form
+			app.render(w, http.StatusUnprocessableEntity, "search.tmpl", data)
+			return
+		}
+
+		page := pageParam(r)
+		snippets, total, err := app.snippets.Search(r.Context(), q, searchPageSize, (page-1)*searchPageSize)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		data.Snippets = snippets
+		data.Pagination = newPaginator(r, page, searchPageSize, total)
+	}
+
+	app.render(w, http.StatusOK, "search.tmpl", data)
 }
 
 // snippetCreate displays the form for creating a new snippet
 func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
-	data := app.newTemplateData(r)
-	data.Form = SnippetCreateForm{
-		Expires: 365, // Default to 1 year
-	}
+	data := app.createFormData(r, SnippetCreateForm{
+		Expires:        365, // Default to 1 year
+		IdempotencyKey: newIdempotencyKey(),
+	})
+	data.Breadcrumbs = app.breadcrumbs(r, Crumb{Label: app.translate(r, "nav.create")})
 
 	app.render(w, http.StatusOK, "create.tmpl", data)
 }
@@ -111,165 +391,1445 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
+	key, ok := idempotencyKey(r, form.IdempotencyKey)
+	if !ok {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
 
 	// Validate form fields
-	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank.")
-	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
-	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
-	form.CheckField(validator.PermittedValue(form.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
+	form.CheckField(validator.NotBlank(form.Title), "title", app.translate(r, "validation.blank"))
+	form.CheckField(validator.MaxChars(form.Title, 100), "title", app.translate(r, "validation.max_chars", 100))
+	form.CheckField(validator.NotBlank(form.Content), "content", app.translate(r, "validation.blank"))
+	form.CheckField(validator.PermittedValue(form.Expires, 1, 7, 365), "expires", app.translate(r, "validation.expires"))
+	tags := parseTags(form.Tags)
+	app.checkTags(r, &form.Validator, tags)
 
-	// If validation failed, re-display the form with errors
+	visitor := app.visitor(r)
+	sizeOK, maxSize := app.quotas.allowsSize(visitor, len(form.Content))
+	form.CheckField(sizeOK, "content", app.sizeMessage(r, maxSize))
+
+	anonymous := !app.isAuthenticated(r)
+	if anonymous {
+		form.CheckField(app.validCaptcha(form.CaptchaToken, form.CaptchaAnswer), "captcha", app.translate(r, "validation.captcha"))
+	}
+
+	// If validation failed, re-display the form with errors (just the form
+	// itself for htmx requests)
 	if !form.Valid() {
-		data := app.newTemplateData(r)
-		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "create.tmpl", data)
+		data := app.createFormData(r, form)
+		app.renderHTMX(w, r, http.StatusUnprocessableEntity, "create.tmpl", "create-form", data)
+		return
+	}
+
+	userID := userIDKey.Get(app.sessionManager, r.Context())
+	limits, err := app.quotas.snippetLimits(visitor)
+	if err != nil {
+		app.serverError(w, err)
 		return
 	}
 
-	// Insert snippet into database
-	id, err := app.snippets.Insert(form.Title, form.Content, form.Expires)
+	// A repeated submission gets the first one's result
+	var id int
+	if key != "" {
+		if !app.claimSubmission(w, r, key) {
+			return
+		}
+		defer func() { app.finishSubmission(r, key, id) }()
+	}
+
+	// Insert snippet into database, unless the creator is at a limit
+	id, err = app.snippets.Insert(userID, app.clientIP(r), form.Title, form.Content, form.Expires, form.Private && !anonymous, limits)
 	if err != nil {
+		var quotaErr *models.QuotaError
+		if errors.As(err, &quotaErr) {
+			form.AddNonFieldError(app.quotaMessage(r, quotaErr))
+			if quotaErr.RetryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(quotaErr.RetryAfter.Seconds())))
+			}
+
+			data := app.createFormData(r, form)
+			app.renderHTMX(w, r, http.StatusTooManyRequests, "create.tmpl", "create-form", data)
+			return
+		}
 		app.serverError(w, err)
 		return
 	}
+	if len(tags) > 0 {
+		if err = app.snippets.SetTags(id, tags); err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+	app.pages.purge("/")
+	if !form.Private || anonymous {
+		app.events.publish(snippetEvent{ID: id, Title: form.Title, Created: time.Now()})
+	}
+	app.recordChange(r, id, models.ChangeCreate, nil, snippetMeta(&models.Snippet{
+		Title:   form.Title,
+		Content: form.Content,
+		Tags:    tags,
+		Private: form.Private && !anonymous,
+		Expires: time.Now().AddDate(0, 0, form.Expires),
+	}))
+
+	// Anonymous creators get a signed cookie letting them edit and delete
+	if anonymous {
+		app.addOwnedSnippet(w, r, id)
+	}
 
 	// Add success flash message and redirect
-	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created!")
-	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+	app.putFlash(r, app.translate(r, "flash.snippet_created"))
+	app.redirect(w, r, fmt.Sprintf("/snippet/view/%d", id))
 }
 
-// =============================================================================
-// User Authentication Handlers
-// =============================================================================
-
-// userSignup displays the user signup form
-func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
-	data := app.newTemplateData(r)
-	data.Form = userSignupForm{}
+// snippetCreateEncrypted displays the form for creating an encrypted
+// snippet
+func (app *application) snippetCreateEncrypted(w http.ResponseWriter, r *http.Request) {
+	data := app.createFormData(r, encryptedCreateForm{
+		Expires:        7, // Default to 1 week
+		IdempotencyKey: newIdempotencyKey(),
+	})
+	data.Breadcrumbs = app.breadcrumbs(r,
+		Crumb{Label: app.translate(r, "nav.create"), URL: "/snippet/create"},
+		Crumb{Label: app.translate(r, "encrypted.title")},
+	)
 
-	app.render(w, http.StatusOK, "signup.tmpl", data)
+	app.render(w, http.StatusOK, "encrypted.tmpl", data)
 }
 
-// userSignupPost processes the user signup form submission
-func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
-	// Decode form data
-	var form userSignupForm
+// snippetCreateEncryptedPost stores a snippet encrypted in the browser. The
+// script posting the form appends the key to the redirect URL's fragment,
+// so the server never sees it.
+func (app *application) snippetCreateEncryptedPost(w http.ResponseWriter, r *http.Request) {
+	var form encryptedCreateForm
 	err := app.decodePostForm(r, &form)
 	if err != nil {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
+	key, ok := idempotencyKey(r, form.IdempotencyKey)
+	if !ok {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
 
-	// Validate form fields
-	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
-	form.CheckField(validator.MaxChars(form.Name, 255), "name", "This field cannot be more than 255 characters long")
-	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
-	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
-	form.CheckField(validator.MaxChars(form.Email, 255), "email", "This field cannot be more than 255 characters long")
-	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
-	form.CheckField(validator.MinChars(form.Password, 8), "password", "This field must be at least 8 characters long")
+	// A missing or malformed ciphertext means the script didn't run
+	if !validCiphertext(form.Ciphertext) {
+		form.AddNonFieldError(app.translate(r, "validation.ciphertext"))
+	}
+	form.CheckField(validator.PermittedValue(form.Expires, 1, 7, 365), "expires", app.translate(r, "validation.expires"))
+
+	visitor := app.visitor(r)
+	if ok, maxSize := app.quotas.allowsSize(visitor, len(form.Ciphertext)); !ok {
+		form.AddNonFieldError(app.sizeMessage(r, maxSize))
+	}
+
+	anonymous := !app.isAuthenticated(r)
+	if anonymous {
+		form.CheckField(app.validCaptcha(form.CaptchaToken, form.CaptchaAnswer), "captcha", app.translate(r, "validation.captcha"))
+	}
 
-	// If validation failed, re-display the form with errors
 	if !form.Valid() {
-		data := app.newTemplateData(r)
-		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "signup.tmpl", data)
+		data := app.createFormData(r, form)
+		app.renderHTMX(w, r, http.StatusUnprocessableEntity, "encrypted.tmpl", "encrypted-form", data)
 		return
 	}
 
-	// Attempt to create the user
-	err = app.users.Insert(form.Name, form.Email, form.Password)
+	userID := userIDKey.Get(app.sessionManager, r.Context())
+	limits, err := app.quotas.snippetLimits(visitor)
 	if err != nil {
-		if errors.Is(err, models.ErrDuplicateEmail) {
-			form.AddFieldError("email", "Email address is already in use")
-			data := app.newTemplateData(r)
-			data.Form = form
-			app.render(w, http.StatusUnprocessableEntity, "signup.tmpl", data)
-		} else {
-			app.serverError(w, err)
+		app.serverError(w, err)
+		return
+	}
+
+	var id int
+	if key != "" {
+		if !app.claimSubmission(w, r, key) {
+			return
+		}
+		defer func() { app.finishSubmission(r, key, id) }()
+	}
+
+	id, err = app.snippets.InsertEncrypted(userID, app.clientIP(r), form.Ciphertext, form.Expires, limits)
+	if err != nil {
+		var quotaErr *models.QuotaError
+		if errors.As(err, &quotaErr) {
+			form.AddNonFieldError(app.quotaMessage(r, quotaErr))
+			if quotaErr.RetryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(quotaErr.RetryAfter.Seconds())))
+			}
+
+			data := app.createFormData(r, form)
+			app.renderHTMX(w, r, http.StatusTooManyRequests, "encrypted.tmpl", "encrypted-form", data)
+			return
 		}
+		app.serverError(w, err)
 		return
 	}
+	app.recordChange(r, id, models.ChangeCreate, nil, snippetMeta(&models.Snippet{
+		Content:   form.Ciphertext,
+		Encrypted: true,
+		Expires:   time.Now().AddDate(0, 0, form.Expires),
+	}))
 
-	// Add success flash message and redirect to login
-	app.sessionManager.Put(r.Context(), "flash", "Successfully signed up. Please log in.")
-	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+	if anonymous {
+		app.addOwnedSnippet(w, r, id)
+	}
+
+	app.putFlash(r, app.translate(r, "flash.snippet_created"))
+	app.redirect(w, r, fmt.Sprintf("/snippet/view/%d", id))
 }
 
-// userLogin displays the user login form
-func (app *application) userLogin(w http.ResponseWriter, r *http.Request) {
+// renderDecrypt renders the page decrypting an encrypted snippet in the
+// browser, using the key from the URL fragment
+func (app *application) renderDecrypt(w http.ResponseWriter, r *http.Request, snippet *models.Snippet) {
+	// The ciphertext is useless to search engines
+	w.Header().Set("X-Robots-Tag", "noindex")
+
 	data := app.newTemplateData(r)
-	data.Form = userLoginForm{}
+	data.Snippet = snippet
+	data.Title = app.translate(r, "decrypt.title")
+	data.CanEdit = app.canEdit(r, snippet)
+	data.Breadcrumbs = app.breadcrumbs(r, Crumb{Label: data.Title})
+	app.render(w, http.StatusOK, "decrypt.tmpl", data)
+}
 
-	app.render(w, http.StatusOK, "login.tmpl", data)
+// createFormData returns the template data for a create form, with a fresh
+// CAPTCHA for anonymous visitors
+func (app *application) createFormData(r *http.Request, form any) *templateData {
+	data := app.newTemplateData(r)
+	data.Form = form
+	if !data.IsAuthenticated {
+		data.Captcha = app.newCaptcha()
+	}
+	return data
 }
 
-// userLoginPost processes the user login form submission
-func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
-	// Decode form data
-	var form userLoginForm
+// snippetEdit displays the edit form for a snippet the visitor owns
+func (app *application) snippetEdit(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.editableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Form = snippetEditForm{
+		Title:   snippet.Title,
+		Content: snippet.Content,
+		Tags:    strings.Join(snippet.Tags, ", "),
+		Private: snippet.Private,
+	}
+	data.Breadcrumbs = app.breadcrumbs(r,
+		Crumb{Label: snippet.Title, URL: fmt.Sprintf("/snippet/view/%d", snippet.ID)},
+		Crumb{Label: app.translate(r, "edit.title")},
+	)
+	app.render(w, http.StatusOK, "edit.tmpl", data)
+}
+
+// snippetEditPost saves changes to a snippet's title, content, tags and
+// privacy. The expiry can't be changed.
+func (app *application) snippetEditPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.editableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	var form snippetEditForm
 	err := app.decodePostForm(r, &form)
 	if err != nil {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	// Validate form fields
-	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
-	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address.")
-	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	form.CheckField(validator.NotBlank(form.Title), "title", app.translate(r, "validation.blank"))
+	form.CheckField(validator.MaxChars(form.Title, 100), "title", app.translate(r, "validation.max_chars", 100))
+	form.CheckField(validator.NotBlank(form.Content), "content", app.translate(r, "validation.blank"))
+	visitor := app.visitor(r)
+	sizeOK, maxSize := app.quotas.allowsSize(visitor, len(form.Content))
+	form.CheckField(sizeOK, "content", app.sizeMessage(r, maxSize))
+	tags := parseTags(form.Tags)
+	app.checkTags(r, &form.Validator, tags)
 
-	// If validation failed, re-display the form with errors
 	if !form.Valid() {
 		data := app.newTemplateData(r)
+		data.Snippet = snippet
 		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "login.tmpl", data)
+		app.render(w, http.StatusUnprocessableEntity, "edit.tmpl", data)
 		return
 	}
 
-	// Attempt to authenticate the user
-	id, err := app.users.Authenticate(form.Email, form.Password)
+	limits, err := app.quotas.snippetLimits(visitor)
 	if err != nil {
-		if errors.Is(err, models.ErrInvalidCredentials) {
-			form.AddNonFieldError("Email or password is incorrect")
+		app.serverError(w, err)
+		return
+	}
+
+	// Making the snippet private counts against the owner's allowance
+	err = app.snippets.Update(snippet.ID, form.Title, form.Content, form.Private, limits)
+	if err != nil {
+		var quotaErr *models.QuotaError
+		switch {
+		case errors.As(err, &quotaErr):
+			form.AddNonFieldError(app.quotaMessage(r, quotaErr))
 			data := app.newTemplateData(r)
+			data.Snippet = snippet
 			data.Form = form
-			app.render(w, http.StatusUnprocessableEntity, "login.tmpl", data)
-		} else {
+			app.render(w, http.StatusTooManyRequests, "edit.tmpl", data)
+		case errors.Is(err, models.ErrNoRecord):
+			app.notFound(w, r)
+		default:
 			app.serverError(w, err)
 		}
 		return
 	}
-
-	// Renew session token to prevent session fixation attacks
-	err = app.sessionManager.RenewToken(r.Context())
+	err = app.snippets.SetTags(snippet.ID, tags)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
+	app.snippetChanged(snippet.ID)
+	app.syncGist(snippet.ID)
 
-	// Store user ID in session
-	app.sessionManager.Put(r.Context(), "authenticatedUserID", id)
+	edited := *snippet
+	edited.Title, edited.Content, edited.Tags, edited.Private = form.Title, form.Content, tags, form.Private
+	app.recordChange(r, snippet.ID, models.ChangeEdit, snippetMeta(snippet), snippetMeta(&edited))
 
-	// Redirect to snippet create page
-	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+	app.putFlash(r, app.translate(r, "flash.snippet_updated"))
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
 }
 
-// userLogoutPost logs out the user and clears their session
-func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
-	// Renew session token to prevent session fixation attacks
-	err := app.sessionManager.RenewToken(r.Context())
+// snippetDeletePost deletes a snippet the visitor owns
+func (app *application) snippetDeletePost(w http.ResponseWriter, r *http.Request) {
+	snippet := app.loadedSnippet(r)
+
+	keys, err := app.attachmentKeys(snippet.ID)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
+	err = app.snippets.Delete(snippet.ID)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return
+	}
+	app.deleteObjects(keys)
+	app.snippetChanged(snippet.ID)
+	app.recordChange(r, snippet.ID, models.ChangeDelete, snippetMeta(snippet), nil)
 
-	// Remove authenticated user ID from session
-	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+	app.putFlash(r, app.translate(r, "flash.snippet_deleted"))
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
 
-	// Add success flash message
-	app.sessionManager.Put(r.Context(), "flash", "You've been logged out successfully!")
+// snippetShare shows the owner of a private snippet the form for creating
+// share links and revoking them
+func (app *application) snippetShare(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.privateSnippet(w, r)
+	if !ok {
+		return
+	}
 
-	// Redirect to home page
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	app.renderShare(w, r, snippet, "", time.Time{})
+}
+
+// snippetSharePost creates a signed share link for a private snippet,
+// working for the chosen number of days
+func (app *application) snippetSharePost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.privateSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	var form shareForm
+	err := app.decodePostForm(r, &form)
+	if err != nil || !validator.PermittedValue(form.Days, shareDurations...) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	expires := time.Now().AddDate(0, 0, form.Days)
+	app.renderShare(w, r, snippet, app.shareURL(snippet, expires), expires)
+}
+
+// snippetShareRevokePost stops every share link issued so far for a
+// private snippet from working
+func (app *application) snippetShareRevokePost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.privateSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.snippets.RevokeShares(snippet.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.putFlash(r, app.translate(r, "flash.shares_revoked"))
+	http.Redirect(w, r, fmt.Sprintf("/snippet/share/%d", snippet.ID), http.StatusSeeOther)
+}
+
+// snippetShared shows a private snippet to anyone with a valid share link.
+// Bad, expired and revoked links get the same 404 as a missing snippet.
+func (app *application) snippetShared(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
+
+	snippet, err := app.snippets.Get(r.Context(), id)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	// Public snippets don't need a share link
+	if !snippet.Private {
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+		return
+	}
+
+	q := r.URL.Query()
+	if !app.validShare(snippet, q.Get("expires"), q.Get("sig")) {
+		app.notFound(w, r)
+		return
+	}
+
+	// Keep shared pages out of search engines and shared caches
+	w.Header().Set("X-Robots-Tag", "noindex")
+	w.Header().Set("Cache-Control", "no-store")
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Title = snippet.Title
+	data.CanEdit = app.canEdit(r, snippet)
+	data.Breadcrumbs = app.breadcrumbs(r, Crumb{Label: snippet.Title})
+	app.render(w, http.StatusOK, "view.tmpl", data)
+}
+
+// editableSnippet returns the snippet loaded for the edit pages, sending a
+// 404 for encrypted snippets: they can only be deleted, since the server
+// can't read them
+func (app *application) editableSnippet(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	snippet := app.loadedSnippet(r)
+	if snippet.Encrypted {
+		app.notFound(w, r)
+		return nil, false
+	}
+	return snippet, true
+}
+
+// privateSnippet returns the snippet loaded for the share pages, which only
+// exist for private snippets, sending a 404 for others
+func (app *application) privateSnippet(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	snippet := app.loadedSnippet(r)
+	if !snippet.Private {
+		app.notFound(w, r)
+		return nil, false
+	}
+	return snippet, true
+}
+
+// renderShare renders the share page, with a newly created link if there is
+// one
+func (app *application) renderShare(w http.ResponseWriter, r *http.Request, snippet *models.Snippet, link string, expires time.Time) {
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Share = &shareLink{URL: link, Expires: expires}
+	data.ShareDurations = shareDurations
+	data.Breadcrumbs = app.breadcrumbs(r,
+		Crumb{Label: snippet.Title, URL: fmt.Sprintf("/snippet/view/%d", snippet.ID)},
+		Crumb{Label: app.translate(r, "share.title")},
+	)
+	app.render(w, http.StatusOK, "share.tmpl", data)
+}
+
+// snippetReportPost records the user's report of a snippet. Enough reports
+// hold the snippet for moderation.
+func (app *application) snippetReportPost(w http.ResponseWriter, r *http.Request) {
+	id := app.loadedSnippet(r).ID
+
+	var form reportForm
+	err := app.decodePostForm(r, &form)
+	if err != nil || !validator.PermittedValue(form.Reason, models.ReportReasons...) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	userID := userIDKey.Get(app.sessionManager, r.Context())
+	held, err := app.moderation.Report(id, userID, form.Reason)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	if held {
+		app.snippetChanged(id)
+		app.putFlash(r, app.translate(r, "flash.snippet_held"))
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	app.putFlash(r, app.translate(r, "flash.snippet_reported"))
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+}
+
+// snippetPreview renders the submitted (unsaved) snippet exactly as the view
+// page would, returning just the preview fragment for htmx requests
+func (app *application) snippetPreview(w http.ResponseWriter, r *http.Request) {
+	var form SnippetCreateForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	if !validator.PermittedValue(form.Expires, 1, 7, 365) {
+		form.Expires = 365
+	}
+
+	data := app.newTemplateData(r)
+	data.Title = app.translate(r, "preview.heading")
+	data.Snippet = &models.Snippet{
+		Title:    form.Title,
+		Content:  form.Content,
+		Created:  now,
+		Expires:  now.AddDate(0, 0, form.Expires),
+		Language: langdetect.Detect(form.Content),
+	}
+
+	app.renderHTMX(w, r, http.StatusOK, "preview.tmpl", "snippet-preview", data)
+}
+
+// =============================================================================
+// User Authentication Handlers
+// =============================================================================
+
+// userSignup displays the user signup form
+func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = userSignupForm{}
+
+	app.render(w, http.StatusOK, "signup.tmpl", data)
+}
+
+// userSignupPost processes the user signup form submission
+func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
+	// Decode form data
+	var form userSignupForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// Validate form fields
+	form.CheckField(validator.NotBlank(form.Name), "name", app.translate(r, "validation.blank"))
+	form.CheckField(validator.MaxChars(form.Name, 255), "name", app.translate(r, "validation.max_chars", 255))
+	form.CheckField(validator.NotBlank(form.Email), "email", app.translate(r, "validation.blank"))
+	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", app.translate(r, "validation.email"))
+	form.CheckField(validator.MaxChars(form.Email, 255), "email", app.translate(r, "validation.max_chars", 255))
+	form.CheckField(validator.NotBlank(form.Password), "password", app.translate(r, "validation.blank"))
+	form.CheckField(validator.MinChars(form.Password, 8), "password", app.translate(r, "validation.min_chars", 8))
+	app.checkPasswordLength(r, &form.Validator, form.Password, "password")
+
+	// If validation failed, re-display the form with errors
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "signup.tmpl", data)
+		return
+	}
+
+	// Attempt to create the user
+	err = app.users.Insert(form.Name, form.Email, form.Password)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateEmail) {
+			form.AddFieldError("email", app.translate(r, "validation.email_in_use"))
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, http.StatusUnprocessableEntity, "signup.tmpl", data)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	// Queue the welcome email. The account exists either way, so a queue
+	// failure is logged rather than shown to the user.
+	err = app.sendMail(form.Email, "user_welcome.tmpl", map[string]any{
+		"Name":     form.Name,
+		"LoginURL": app.config.Server.BaseURL + "/user/login",
+	})
+	if err != nil {
+		app.logger.ErrorContext(r.Context(), "queueing welcome email", "email", form.Email, "error", err)
+	}
+
+	// Add success flash message and redirect to login
+	app.putFlash(r, app.translate(r, "flash.signed_up"))
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// userLogin displays the user login form
+func (app *application) userLogin(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = userLoginForm{}
+
+	app.render(w, http.StatusOK, "login.tmpl", data)
+}
+
+// userLoginPost processes the user login form submission
+func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
+	// Decode form data
+	var form userLoginForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// Validate form fields
+	form.CheckField(validator.NotBlank(form.Email), "email", app.translate(r, "validation.blank"))
+	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", app.translate(r, "validation.email"))
+	form.CheckField(validator.NotBlank(form.Password), "password", app.translate(r, "validation.blank"))
+
+	// If validation failed, re-display the form with errors
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "login.tmpl", data)
+		return
+	}
+
+	// Attempt to authenticate the user
+	id, err := app.users.Authenticate(form.Email, form.Password)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			failedLoginsTotal.WithLabelValues(routePattern(r)).Inc()
+			form.AddNonFieldError(app.translate(r, "validation.bad_credentials"))
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, http.StatusUnprocessableEntity, "login.tmpl", data)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	// Logins from unfamiliar devices are emailed about, or held for
+	// confirmation
+	if !app.screenLogin(w, r, id) {
+		return
+	}
+
+	err = app.logIn(r, id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Redirect to snippet create page
+	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+}
+
+// userLogoutPost logs out the user and clears their session
+func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
+	// Renew session token to prevent session fixation attacks
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Remove authenticated user ID from session
+	userIDKey.Remove(app.sessionManager, r.Context())
+
+	// Add success flash message
+	app.putFlash(r, app.translate(r, "flash.logged_out"))
+
+	// Redirect to home page
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// accountPasswordUpdate displays the form for changing the user's password
+func (app *application) accountPasswordUpdate(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = accountPasswordUpdateForm{}
+	data.Breadcrumbs = app.breadcrumbs(r, Crumb{Label: app.translate(r, "password.title")})
+
+	app.render(w, http.StatusOK, "password.tmpl", data)
+}
+
+// checkPasswordLength adds an error for field to v if password is too long
+// to be hashed, which it can be without a pepper
+func (app *application) checkPasswordLength(r *http.Request, v *validator.Validator, password, field string) {
+	if limit := app.config.Passwords.hasher().MaxBytes(); limit > 0 {
+		v.CheckField(validator.MaxBytes(password, limit), field, app.translate(r, "validation.password_bytes", limit))
+	}
+}
+
+// accountPasswordUpdatePost changes the user's password, once they have
+// given their current one
+func (app *application) accountPasswordUpdatePost(w http.ResponseWriter, r *http.Request) {
+	var form accountPasswordUpdateForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.CurrentPassword), "currentPassword", app.translate(r, "validation.blank"))
+	form.CheckField(validator.NotBlank(form.NewPassword), "newPassword", app.translate(r, "validation.blank"))
+	form.CheckField(validator.MinChars(form.NewPassword, 8), "newPassword", app.translate(r, "validation.min_chars", 8))
+	app.checkPasswordLength(r, &form.Validator, form.NewPassword, "newPassword")
+	form.CheckField(validator.NotBlank(form.NewPasswordConfirmation), "newPasswordConfirmation", app.translate(r, "validation.blank"))
+	form.CheckField(form.NewPassword == form.NewPasswordConfirmation, "newPasswordConfirmation", app.translate(r, "validation.password_mismatch"))
+
+	renderForm := func() {
+		// Passwords are never sent back
+		form.CurrentPassword, form.NewPassword, form.NewPasswordConfirmation = "", "", ""
+		data := app.newTemplateData(r)
+		data.Form = form
+		data.Breadcrumbs = app.breadcrumbs(r, Crumb{Label: app.translate(r, "password.title")})
+		app.render(w, http.StatusUnprocessableEntity, "password.tmpl", data)
+	}
+	if !form.Valid() {
+		renderForm()
+		return
+	}
+
+	userID := userIDKey.Get(app.sessionManager, r.Context())
+	err = app.users.PasswordUpdate(userID, form.CurrentPassword, form.NewPassword)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			form.AddFieldError("currentPassword", app.translate(r, "validation.wrong_password"))
+			renderForm()
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	// Other sessions and the user's API tokens end with the old password.
+	// This one carries on with a new session token, so one captured before
+	// the change stops working too.
+	err = app.logIn(r, userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.putFlash(r, app.translate(r, "flash.password_updated"))
+	http.Redirect(w, r, "/account/security", http.StatusSeeOther)
+}
+
+// =============================================================================
+// Preference Handlers
+// =============================================================================
+
+// userLocalePost switches the UI language. The choice is remembered in a
+// long-lived cookie, and also in the session and on the user record when
+// logged in. Redirects back to the page the form was posted from.
+func (app *application) userLocalePost(w http.ResponseWriter, r *http.Request) {
+	var form userLocaleForm
+	err := app.decodePostForm(r, &form)
+	if err != nil || !i18n.IsSupported(form.Locale) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.cookies.Write(w, &http.Cookie{
+		Name:     localeCookieName,
+		Value:    form.Locale,
+		Path:     "/",
+		MaxAge:   365 * 24 * 60 * 60,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	// Anonymous visitors only get the cookie, so they don't need a session
+	// (and its store lookup on every request) just for this
+	if !app.isAuthenticated(r) {
+		localeKey.Remove(app.sessionManager, r.Context())
+	} else {
+		localeKey.Put(app.sessionManager, r.Context(), form.Locale)
+
+		id := userIDKey.Get(app.sessionManager, r.Context())
+		err = app.users.SetLocale(id, form.Locale)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	http.Redirect(w, r, localRedirectTarget(r.Referer()), http.StatusSeeOther)
+}
+
+// userThemePost switches the colour theme. Like the language switcher, the
+// choice goes in a cookie, and also in the session and the user record when
+// logged in. An empty theme means "follow the OS setting".
+func (app *application) userThemePost(w http.ResponseWriter, r *http.Request) {
+	var form userThemeForm
+	err := app.decodePostForm(r, &form)
+	if err != nil || !validator.PermittedValue(form.Theme, themes...) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if form.Theme == "" {
+		cookies.Delete(w, themeCookieName, "/")
+	} else {
+		err = app.cookies.Write(w, &http.Cookie{
+			Name:     themeCookieName,
+			Value:    form.Theme,
+			Path:     "/",
+			MaxAge:   365 * 24 * 60 * 60,
+			HttpOnly: true,
+			Secure:   true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+	// As with the locale, anonymous visitors only get the cookie
+	if !app.isAuthenticated(r) {
+		themeKey.Remove(app.sessionManager, r.Context())
+	} else {
+		themeKey.Put(app.sessionManager, r.Context(), form.Theme)
+
+		id := userIDKey.Get(app.sessionManager, r.Context())
+		err = app.users.SetTheme(id, form.Theme)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	http.Redirect(w, r, localRedirectTarget(r.Referer()), http.StatusSeeOther)
+}
+
+// =============================================================================
+// Notification Preference Handlers
+// =============================================================================
+
+// inbox lists the user's recent in-app notifications and marks them all
+// read. Ones that were unread are still highlighted on this visit.
+func (app *application) inbox(w http.ResponseWriter, r *http.Request) {
+	id := userIDKey.Get(app.sessionManager, r.Context())
+
+	notifications, err := app.notifications.Recent(id, inboxSize)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.notifications.MarkAllRead(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Inbox = notifications
+	data.Unread = 0
+	data.Breadcrumbs = app.breadcrumbs(r, Crumb{Label: app.translate(r, "inbox.title")})
+	app.render(w, http.StatusOK, "inbox.tmpl", data)
+}
+
+// accountNotifications displays the user's email notification preferences
+func (app *application) accountNotifications(w http.ResponseWriter, r *http.Request) {
+	id := userIDKey.Get(app.sessionManager, r.Context())
+
+	prefs, err := app.users.NotificationPreferences(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Notifications = notificationPrefs(prefs)
+	data.Breadcrumbs = app.breadcrumbs(r, Crumb{Label: app.translate(r, "notifications.title")})
+	app.render(w, http.StatusOK, "notifications.tmpl", data)
+}
+
+// accountNotificationsPost saves the notification preferences form. Kinds
+// not ticked are turned off.
+func (app *application) accountNotificationsPost(w http.ResponseWriter, r *http.Request) {
+	var form notificationsForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	for _, kind := range form.Enabled {
+		if !validator.PermittedValue(kind, models.NotificationKinds...) {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	id := userIDKey.Get(app.sessionManager, r.Context())
+	for _, kind := range models.NotificationKinds {
+		err = app.users.SetNotificationPreference(id, kind, validator.PermittedValue(kind, form.Enabled...))
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	app.putFlash(r, app.translate(r, "flash.notifications_saved"))
+	http.Redirect(w, r, "/account/notifications", http.StatusSeeOther)
+}
+
+// unsubscribe shows the confirmation page for an emailed unsubscribe link.
+// Nothing changes until the form is submitted, so link scanners that follow
+// URLs in emails can't unsubscribe anyone.
+func (app *application) unsubscribe(w http.ResponseWriter, r *http.Request) {
+	form := unsubscribeForm{
+		Kind:  r.URL.Query().Get("kind"),
+		Token: r.URL.Query().Get("token"),
+	}
+	form.User, _ = strconv.Atoi(r.URL.Query().Get("user"))
+
+	if !app.validUnsubscribeLink(form) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = form
+	app.render(w, http.StatusOK, "unsubscribe.tmpl", data)
+}
+
+// unsubscribePost turns off the notification kind named in a signed
+// unsubscribe link. No login is needed; the signature is the proof.
+func (app *application) unsubscribePost(w http.ResponseWriter, r *http.Request) {
+	var form unsubscribeForm
+	err := app.decodePostForm(r, &form)
+	if err != nil || !app.validUnsubscribeLink(form) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.users.SetNotificationPreference(form.User, form.Kind, false)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.putFlash(r, app.translate(r, "flash.unsubscribed"))
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// validUnsubscribeLink checks an unsubscribe link names a known kind and
+// carries a valid signature
+func (app *application) validUnsubscribeLink(form unsubscribeForm) bool {
+	return validator.PermittedValue(form.Kind, models.NotificationKinds...) &&
+		app.validUnsubscribeToken(form.User, form.Kind, form.Token)
+}
+
+// =============================================================================
+// Profile and Feed Handlers
+// =============================================================================
+
+// userProfile displays a user's public profile with their follower counts
+// and, for other logged-in users, a follow or unfollow button
+func (app *application) userProfile(w http.ResponseWriter, r *http.Request) {
+	id, ok := profileID(r)
+	if !ok {
+		app.notFound(w, r)
+		return
+	}
+
+	user, err := app.users.Get(id)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	counts, err := app.follows.Counts(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	avatarURL, err := app.avatarURL(id, avatarSizes[len(avatarSizes)-1])
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	p := &profile{User: user, AvatarURL: avatarURL, Counts: counts}
+	if visitorID := userIDKey.Get(app.sessionManager, r.Context()); visitorID != 0 {
+		p.IsSelf = visitorID == id
+		if !p.IsSelf {
+			p.IsFollowing, err = app.follows.IsFollowing(visitorID, id)
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+		}
+	}
+
+	data := app.newTemplateData(r)
+	data.Profile = p
+	if data.IsAdmin {
+		data.Tiers = app.quotas.tierNames()
+	}
+	data.Title = user.Name
+	data.Breadcrumbs = app.breadcrumbs(r, Crumb{Label: user.Name})
+	app.render(w, http.StatusOK, "profile.tmpl", data)
+}
+
+// userFollowPost makes the logged-in user follow the profile's user, and
+// lets them know unless they've turned follower emails off
+func (app *application) userFollowPost(w http.ResponseWriter, r *http.Request) {
+	id, ok := profileID(r)
+	if !ok {
+		app.notFound(w, r)
+		return
+	}
+
+	followerID := userIDKey.Get(app.sessionManager, r.Context())
+	if followerID == id {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// A new follow is notified by the outbox relay
+	_, err := app.follows.Follow(followerID, id)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	app.putFlash(r, app.translate(r, "flash.followed"))
+	http.Redirect(w, r, profilePath(id), http.StatusSeeOther)
+}
+
+// userUnfollowPost makes the logged-in user stop following the profile's
+// user
+func (app *application) userUnfollowPost(w http.ResponseWriter, r *http.Request) {
+	id, ok := profileID(r)
+	if !ok {
+		app.notFound(w, r)
+		return
+	}
+
+	followerID := userIDKey.Get(app.sessionManager, r.Context())
+	err := app.follows.Unfollow(followerID, id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.putFlash(r, app.translate(r, "flash.unfollowed"))
+	http.Redirect(w, r, profilePath(id), http.StatusSeeOther)
+}
+
+// profileID reads the user ID from a profile route
+func profileID(r *http.Request) (int, bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	return id, err == nil && id > 0
+}
+
+// feed lists recent public snippets by the users the logged-in user
+// follows, newest first
+func (app *application) feed(w http.ResponseWriter, r *http.Request) {
+	userID := userIDKey.Get(app.sessionManager, r.Context())
+
+	page := pageParam(r)
+	items, total, err := app.follows.Feed(userID, feedPageSize, (page-1)*feedPageSize)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Feed = items
+	data.Pagination = newPaginator(r, page, feedPageSize, total)
+	data.Breadcrumbs = app.breadcrumbs(r, Crumb{Label: app.translate(r, "feed.title")})
+	app.render(w, http.StatusOK, "feed.tmpl", data)
+}
+
+// =============================================================================
+// Subscription Handlers
+// =============================================================================
+
+// subscriptionList lists the user's saved searches and tag subscriptions with
+// the snippets created since each was made
+func (app *application) subscriptionList(w http.ResponseWriter, r *http.Request) {
+	app.renderSubscriptions(w, r, http.StatusOK, subscriptionForm{Kind: models.SubscriptionTag})
+}
+
+// subscriptionCreatePost saves a search or subscribes to a tag. It is posted
+// from the search page, snippet tags and the subscriptions page.
+func (app *application) subscriptionCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form subscriptionForm
+	err := app.decodePostForm(r, &form)
+	if err != nil || !validator.PermittedValue(form.Kind, models.SubscriptionSearch, models.SubscriptionTag) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.Query = strings.TrimSpace(form.Query)
+	if form.Kind == models.SubscriptionTag {
+		form.Query = strings.ToLower(strings.TrimPrefix(form.Query, "#"))
+		form.CheckField(tagRX.MatchString(form.Query), "query", app.translate(r, "validation.tag"))
+	}
+	form.CheckField(validator.NotBlank(form.Query), "query", app.translate(r, "validation.blank"))
+	form.CheckField(validator.MaxChars(form.Query, 100), "query", app.translate(r, "validation.max_chars", 100))
+
+	userID := userIDKey.Get(app.sessionManager, r.Context())
+	subs, err := app.subscriptions.List(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	subscribed := slices.ContainsFunc(subs, func(s *models.Subscription) bool {
+		return s.Kind == form.Kind && s.Query == form.Query
+	})
+	if !subscribed && len(subs) >= maxSubscriptions {
+		form.AddNonFieldError(app.translate(r, "validation.max_subscriptions", maxSubscriptions))
+	}
+
+	if !form.Valid() {
+		app.renderSubscriptions(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	_, err = app.subscriptions.Insert(userID, form.Kind, form.Query, form.Email)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.putFlash(r, app.translate(r, "flash.subscribed"))
+	http.Redirect(w, r, "/subscriptions", http.StatusSeeOther)
+}
+
+// subscriptionDeletePost removes one of the user's subscriptions
+func (app *application) subscriptionDeletePost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
+
+	userID := userIDKey.Get(app.sessionManager, r.Context())
+	err = app.subscriptions.Delete(userID, id)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	app.putFlash(r, app.translate(r, "flash.subscription_removed"))
+	http.Redirect(w, r, "/subscriptions", http.StatusSeeOther)
+}
+
+// renderSubscriptions renders the subscriptions page with the add form
+func (app *application) renderSubscriptions(w http.ResponseWriter, r *http.Request, status int, form subscriptionForm) {
+	userID := userIDKey.Get(app.sessionManager, r.Context())
+	subs, err := app.subscriptions.List(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	matches := make([]subscriptionMatches, 0, len(subs))
+	for _, sub := range subs {
+		snippets, err := app.subscriptions.Matches(sub, sub.StartID, subscriptionListed)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		matches = append(matches, subscriptionMatches{Subscription: sub, Snippets: snippets})
+	}
+
+	data := app.newTemplateData(r)
+	data.Subscriptions = matches
+	data.Form = form
+	data.Breadcrumbs = app.breadcrumbs(r, Crumb{Label: app.translate(r, "subscriptions.title")})
+	app.render(w, status, "subscriptions.tmpl", data)
+}
+
+// accountTokens lists the user's API tokens with the form to create one
+func (app *application) accountTokens(w http.ResponseWriter, r *http.Request) {
+	app.renderTokens(w, r, http.StatusOK, apiTokenForm{}, "")
+}
+
+// accountTokensPost creates an API token. The token is shown on the page
+// returned, and never again.
+func (app *application) accountTokensPost(w http.ResponseWriter, r *http.Request) {
+	var form apiTokenForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.Name = strings.TrimSpace(form.Name)
+	form.CheckField(validator.NotBlank(form.Name), "name", app.translate(r, "validation.blank"))
+	form.CheckField(validator.MaxChars(form.Name, 50), "name", app.translate(r, "validation.max_chars", 50))
+
+	userID := userIDKey.Get(app.sessionManager, r.Context())
+	tokens, err := app.tokens.List(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if len(tokens) >= maxAPITokens {
+		form.AddNonFieldError(app.translate(r, "validation.max_tokens", maxAPITokens))
+	}
+
+	if !form.Valid() {
+		app.renderTokens(w, r, http.StatusUnprocessableEntity, form, "")
+		return
+	}
+
+	token, _, err := app.tokens.Insert(userID, form.Name)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.renderTokens(w, r, http.StatusOK, apiTokenForm{}, token)
+}
+
+// accountTokenDeletePost revokes one of the user's API tokens
+func (app *application) accountTokenDeletePost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
+
+	userID := userIDKey.Get(app.sessionManager, r.Context())
+	err = app.tokens.Delete(userID, id)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	app.putFlash(r, app.translate(r, "flash.token_revoked"))
+	http.Redirect(w, r, "/account/tokens", http.StatusSeeOther)
+}
+
+// renderTokens renders the API tokens page with the create form, and the
+// token just created, if any
+func (app *application) renderTokens(w http.ResponseWriter, r *http.Request, status int, form apiTokenForm, token string) {
+	userID := userIDKey.Get(app.sessionManager, r.Context())
+	tokens, err := app.tokens.List(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.APITokens = tokens
+	data.NewAPIToken = token
+	data.Form = form
+	data.Breadcrumbs = app.breadcrumbs(r, Crumb{Label: app.translate(r, "tokens.title")})
+	app.render(w, status, "tokens.tmpl", data)
+}
+
+// =============================================================================
+// Admin Handlers
+// =============================================================================
+
+// adminMail lists the most recent outgoing emails with their delivery
+// status, attempts and last error
+func (app *application) adminMail(w http.ResponseWriter, r *http.Request) {
+	jobs, err := app.jobs.Recent(emailJobKind, 50)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	deliveries := make([]emailDelivery, 0, len(jobs))
+	for _, j := range jobs {
+		var payload emailJob
+		// A payload that doesn't decode still shows its status and error
+		json.Unmarshal(j.Payload, &payload)
+		deliveries = append(deliveries, emailDelivery{Job: j, Recipient: payload.Recipient, Template: payload.Template})
+	}
+
+	data := app.newTemplateData(r)
+	data.Deliveries = deliveries
+	data.Breadcrumbs = app.breadcrumbs(r, Crumb{Label: app.translate(r, "admin_mail.title")})
+	app.render(w, http.StatusOK, "admin_mail.tmpl", data)
+}
+
+// adminBans lists the IP bans in force, with a form to add another
+func (app *application) adminBans(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = banForm{Hours: 24}
+	app.renderBans(w, r, http.StatusOK, data)
+}
+
+// adminBansPost adds a ban for a single IP address or a CIDR network
+func (app *application) adminBansPost(w http.ResponseWriter, r *http.Request) {
+	var form banForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	network, err := parsePrefix(strings.TrimSpace(form.Network))
+	form.CheckField(err == nil, "network", app.translate(r, "validation.network"))
+	if err == nil {
+		form.CheckField(!network.Contains(app.clientIP(r)), "network", app.translate(r, "validation.network_self"))
+	}
+	form.CheckField(validator.NotBlank(form.Reason), "reason", app.translate(r, "validation.blank"))
+	form.CheckField(validator.MaxChars(form.Reason, 255), "reason", app.translate(r, "validation.max_chars", 255))
+	form.CheckField(validator.PermittedValue(form.Hours, banDurations...), "hours", app.translate(r, "validation.ban_hours"))
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.renderBans(w, r, http.StatusUnprocessableEntity, data)
+		return
+	}
+
+	userID := userIDKey.Get(app.sessionManager, r.Context())
+	_, err = app.bans.model.Insert(network, form.Reason, time.Duration(form.Hours)*time.Hour, userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Apply the ban on this instance straight away
+	if err := app.bans.refresh(); err != nil {
+		app.logger.ErrorContext(r.Context(), "refresh ip bans", "error", err)
+	}
+
+	app.recordAudit(r, models.AuditIPBan, "ip:"+network.String(), form.Reason)
+
+	app.putFlash(r, app.translate(r, "flash.ban_added", network.String()))
+	http.Redirect(w, r, "/admin/bans", http.StatusSeeOther)
+}
+
+// adminBanDelete lifts a ban
+func (app *application) adminBanDelete(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
+
+	err = app.bans.model.Delete(id)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	if err := app.bans.refresh(); err != nil {
+		app.logger.ErrorContext(r.Context(), "refresh ip bans", "error", err)
+	}
+
+	app.recordAudit(r, models.AuditIPUnban, fmt.Sprintf("ip_ban:%d", id), "")
+
+	app.putFlash(r, app.translate(r, "flash.ban_lifted"))
+	http.Redirect(w, r, "/admin/bans", http.StatusSeeOther)
+}
+
+// adminModeration lists held and reported snippets with the actions a
+// moderator can take, and the recent audit log
+func (app *application) adminModeration(w http.ResponseWriter, r *http.Request) {
+	queue, err := app.moderation.Queue(moderationQueueSize)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	audit, err := app.audit.Recent(20)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Queue = queue
+	data.Audit = audit
+	data.Breadcrumbs = app.breadcrumbs(r, Crumb{Label: app.translate(r, "admin_moderation.title")})
+	app.render(w, http.StatusOK, "admin_moderation.tmpl", data)
+}
+
+// adminModerationApprove publishes a held or reported snippet and dismisses
+// its reports
+func (app *application) adminModerationApprove(w http.ResponseWriter, r *http.Request) {
+	app.moderate(w, r, models.AuditSnippetApprove, "flash.snippet_approved", func(id int) (string, error) {
+		return "", app.moderation.Approve(id)
+	})
+}
+
+// adminModerationRemove deletes a snippet
+func (app *application) adminModerationRemove(w http.ResponseWriter, r *http.Request) {
+	app.moderate(w, r, models.AuditSnippetRemove, "flash.snippet_removed", func(id int) (string, error) {
+		keys, err := app.attachmentKeys(id)
+		if err != nil {
+			return "", err
+		}
+		if err = app.moderation.Remove(id); err != nil {
+			return "", err
+		}
+		app.deleteObjects(keys)
+		return "", nil
+	})
+}
+
+// adminModerationBan deletes a snippet and bans its author
+func (app *application) adminModerationBan(w http.ResponseWriter, r *http.Request) {
+	app.moderate(w, r, models.AuditUserBan, "flash.author_banned", func(id int) (string, error) {
+		keys, err := app.attachmentKeys(id)
+		if err != nil {
+			return "", err
+		}
+		authorID, err := app.moderation.BanAuthor(id)
+		if err != nil {
+			return "", err
+		}
+		app.deleteObjects(keys)
+		return fmt.Sprintf("user:%d", authorID), nil
+	})
+}
+
+// moderate runs a moderation action on the snippet in the URL, records it
+// in the audit log and returns to the queue. The action may return detail
+// for the audit entry.
+func (app *application) moderate(w http.ResponseWriter, r *http.Request, action, flash string, fn func(id int) (string, error)) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
+
+	detail, err := fn(id)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	app.snippetChanged(id)
+	app.recordAudit(r, action, snippetTarget(id), detail)
+
+	app.putFlash(r, app.translate(r, flash))
+	http.Redirect(w, r, "/admin/moderation", http.StatusSeeOther)
 }
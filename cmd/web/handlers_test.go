@@ -3,18 +3,121 @@ package main
 import (
 	"net/http"
 	"net/url"
+	"strings"
 	"testing"
 
 	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/models/mocks"
+	"adotkaya.playground/internal/testutil"
 )
 
 func TestPing(t *testing.T) {
 	app := newTestApplication(t)
-	ts := newTestServer(t, app.routes())
-	defer ts.Close()
-	code, _, body := ts.get(t, "/ping")
-	assert.Equal(t, code, http.StatusOK)
-	assert.Equal(t, body, "OK")
+	ts := testutil.NewServer(t, app.routes())
+	rs := ts.Get(t, "/ping")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.Equal(t, rs.Body, "OK")
+}
+
+func TestHealth(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+	rs := ts.Get(t, "/health")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.Equal(t, rs.Header.Get("Content-Type"), "application/json")
+	assert.StringContains(t, rs.Body, `"status":"ok"`)
+}
+
+func TestNotFound(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantBody string
+	}{
+		{
+			name:     "HTML page",
+			urlPath:  "/missing",
+			wantBody: "<h2>Page Not Found</h2>",
+		},
+		{
+			name:     "Static file",
+			urlPath:  "/static/missing.css",
+			wantBody: "404 page not found",
+		},
+		{
+			name:     "API path",
+			urlPath:  "/api/missing",
+			wantBody: "Not Found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := ts.Get(t, tt.urlPath)
+			assert.Equal(t, rs.Status, http.StatusNotFound)
+			assert.StringContains(t, rs.Body, tt.wantBody)
+		})
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+
+	tests := []struct {
+		name      string
+		method    string
+		urlPath   string
+		wantAllow string
+		wantType  string
+		wantBody  string
+	}{
+		{
+			name:      "HTML page",
+			method:    http.MethodDelete,
+			urlPath:   "/snippet/view/1",
+			wantAllow: "GET, HEAD, OPTIONS",
+			wantType:  "text/html; charset=utf-8",
+			wantBody:  "<h2>Method Not Allowed</h2>",
+		},
+		{
+			// No CSRF token is needed to be told so
+			name:      "HTML form",
+			method:    http.MethodPost,
+			urlPath:   "/snippet/view/1",
+			wantAllow: "GET, HEAD, OPTIONS",
+			wantType:  "text/html; charset=utf-8",
+			wantBody:  "<h2>Method Not Allowed</h2>",
+		},
+		{
+			name:      "Static file",
+			method:    http.MethodPost,
+			urlPath:   "/static/css/main.css",
+			wantAllow: "GET, HEAD, OPTIONS",
+			wantType:  "text/plain; charset=utf-8",
+			wantBody:  "Method Not Allowed",
+		},
+		{
+			name:      "API path",
+			method:    http.MethodPost,
+			urlPath:   "/api/v1/user",
+			wantAllow: "GET, HEAD, OPTIONS",
+			wantType:  "application/json",
+			wantBody:  `{"error":"Method Not Allowed"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := ts.Do(t, ts.NewRequest(t, tt.method, tt.urlPath, nil))
+			assert.Equal(t, rs.Status, http.StatusMethodNotAllowed)
+			assert.Equal(t, rs.Header.Get("Allow"), tt.wantAllow)
+			assert.Equal(t, rs.Header.Get("Content-Type"), tt.wantType)
+			assert.StringContains(t, rs.Body, tt.wantBody)
+		})
+	}
 }
 
 func TestSnippetView(t *testing.T) {
@@ -22,8 +125,7 @@ func TestSnippetView(t *testing.T) {
 	// dependencies.
 	app := newTestApplication(t)
 	// Establish a new test server for running end-to-end tests.
-	ts := newTestServer(t, app.routes())
-	defer ts.Close()
+	ts := testutil.NewServer(t, app.routes())
 	// Set up some table-driven tests to check the responses sent by our
 	// application for different URLs.
 	tests := []struct {
@@ -66,21 +168,94 @@ func TestSnippetView(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			code, _, body := ts.get(t, tt.urlPath)
-			assert.Equal(t, code, tt.wantCode)
+			rs := ts.Get(t, tt.urlPath)
+			assert.Equal(t, rs.Status, tt.wantCode)
 			if tt.wantBody != "" {
-				assert.StringContains(t, body, tt.wantBody)
+				assert.StringContains(t, rs.Body, tt.wantBody)
 			}
 		})
 	}
 }
 
+func TestSnippetViewMetadata(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+
+	body := ts.Get(t, "/snippet/view/1").Body
+	assert.StringContains(t, body, "<title>An old silent pond - Snippetbox</title>")
+	assert.StringContains(t, body, `<meta name="description" content="An old silent pond..." />`)
+	assert.StringContains(t, body, `<link rel="canonical" href="https://snippetbox.example.com/snippet/view/1" />`)
+	assert.StringContains(t, body, `<li><a href="/snippet/list">Snippets</a></li>`)
+	assert.StringContains(t, body, `<li><span aria-current="page">An old silent pond</span></li>`)
+	assert.StringContains(t, body, `<meta property="og:type" content="article" />`)
+	assert.StringContains(t, body, `<meta property="og:title" content="An old silent pond" />`)
+	assert.StringContains(t, body, `"@type":"SoftwareSourceCode"`)
+}
+
+func TestSnippetViewModes(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+
+	// Line numbers, each line an anchor
+	body := ts.Get(t, "/snippet/view/1?linenos=1").Body
+	assert.StringContains(t, body, `<span class="line" id="L1"><a class="lineno" href="#L1">1</a>An old silent pond...`)
+	assert.StringContains(t, body, `<a href="/snippet/view/1">Hide line numbers</a>`)
+	assert.StringContains(t, body, `<nav>`)
+
+	// The print view has no navigation, forms or theme stylesheet, and
+	// keeps the normal page as canonical
+	body = ts.Get(t, "/snippet/view/1?plain=true").Body
+	assert.StringContains(t, body, `<body class="plain">`)
+	assert.StringContains(t, body, "<pre><code>An old silent pond...")
+	assert.StringContains(t, body, `<link rel="canonical" href="https://snippetbox.example.com/snippet/view/1" />`)
+	for _, unwanted := range []string{"<nav>", "<footer>", "<form", "dark.css", `class="metadata actions"`} {
+		assert.Equal(t, strings.Contains(body, unwanted), false)
+	}
+
+	// A line range turns on line numbers and is highlighted
+	body = ts.Get(t, "/snippet/view/1?lines=1-3").Body
+	assert.StringContains(t, body, `<span class="line highlighted" id="L1">`)
+	assert.StringContains(t, body, `<a href="/snippet/view/1?plain=1&linenos=1&lines=1-3">Print view</a>`)
+
+	// Anything other than a boolean is ignored
+	body = ts.Get(t, "/snippet/view/1?plain=yes").Body
+	assert.StringContains(t, body, `<nav>`)
+}
+
+func TestSnippetRaw(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+
+	tests := []struct {
+		name            string
+		urlPath         string
+		wantCode        int
+		wantDisposition string
+	}{
+		{"Raw", "/snippet/raw/1", http.StatusOK, ""},
+		{"Download", "/snippet/download/1", http.StatusOK, `attachment; filename="snippet-1.txt"`},
+		{"Non-existent ID", "/snippet/raw/2", http.StatusNotFound, ""},
+		{"String ID", "/snippet/download/foo", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := ts.Get(t, tt.urlPath)
+			assert.Equal(t, rs.Status, tt.wantCode)
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			assert.Equal(t, rs.Body, "An old silent pond...")
+			assert.Equal(t, rs.Header.Get("Content-Type"), "text/plain; charset=utf-8")
+			assert.Equal(t, rs.Header.Get("Content-Length"), "21")
+			assert.Equal(t, rs.Header.Get("Content-Disposition"), tt.wantDisposition)
+		})
+	}
+}
+
 func TestUserSignup(t *testing.T) {
 	app := newTestApplication(t)
-	ts := newTestServer(t, app.routes())
-	defer ts.Close()
-	_, _, body := ts.get(t, "/user/signup")
-	validCSRFToken := extractCSRFToken(t, body)
+	ts := testutil.NewServer(t, app.routes())
+	validCSRFToken := testutil.ExtractCSRFToken(t, ts.Get(t, "/user/signup").Body)
 	const (
 		validName     = "Bob"
 		validPassword = "validPa$$word"
@@ -174,10 +349,310 @@ func TestUserSignup(t *testing.T) {
 			form.Add("email", tt.userEmail)
 			form.Add("password", tt.userPassword)
 			form.Add("csrf_token", tt.csrfToken)
-			code, _, body := ts.postForm(t, "/user/signup", form)
-			assert.Equal(t, code, tt.wantCode)
+			rs := ts.PostForm(t, "/user/signup", form)
+			assert.Equal(t, rs.Status, tt.wantCode)
 			if tt.wantFormTag != "" {
-				assert.StringContains(t, body, tt.wantFormTag)
+				assert.StringContains(t, rs.Body, tt.wantFormTag)
+			}
+		})
+	}
+}
+
+func TestHomePagination(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+
+	rs := ts.Get(t, "/")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.StringContains(t, rs.Body, `<a href="/snippet/view/1">An old silent pond</a>`)
+	assert.StringContains(t, rs.Body, `hx-get="/snippet/list"`)
+	assert.StringContains(t, rs.Body, `<link rel="canonical" href="https://snippetbox.example.com/" />`)
+
+	// Later pages aren't refreshed with the latest snippets
+	rs = ts.Get(t, "/?page=2")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.StringContains(t, rs.Body, "There&#39;s nothing to see here... yet!")
+	assert.StringContains(t, rs.Body, `<link rel="canonical" href="https://snippetbox.example.com/?page=2" />`)
+	if strings.Contains(rs.Body, `hx-get="/snippet/list"`) {
+		t.Error("expected no live refresh on page 2")
+	}
+}
+
+func TestSnippetList(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+
+	t.Run("Full page", func(t *testing.T) {
+		rs := ts.Get(t, "/snippet/list")
+		assert.Equal(t, rs.Status, http.StatusOK)
+		assert.StringContains(t, rs.Body, "<html")
+		assert.StringContains(t, rs.Body, `<div id="snippet-list"`)
+	})
+
+	t.Run("htmx fragment", func(t *testing.T) {
+		req := ts.NewRequest(t, http.MethodGet, "/snippet/list", nil)
+		req.Header.Set("HX-Request", "true")
+		rs := ts.Do(t, req)
+
+		assert.Equal(t, rs.Status, http.StatusOK)
+		assert.StringContains(t, rs.Body, "An old silent pond")
+		if strings.Contains(rs.Body, "<html") {
+			t.Errorf("got full page; expected fragment only")
+		}
+	})
+}
+
+func TestAccountPasswordUpdate(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+
+	// Only for logged-in users
+	rs := ts.Get(t, "/account/password/update")
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/user/login")
+
+	ts.Login(t, "alice@example.com", "pa$$word")
+	rs = ts.Get(t, "/account/password/update")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.StringContains(t, rs.Body, `<form action="/account/password/update" method="POST" novalidate>`)
+
+	tests := []struct {
+		name         string
+		current      string
+		newPassword  string
+		confirmation string
+		wantCode     int
+		wantError    string
+	}{
+		{"Valid", "pa$$word", "new-pa$$word", "new-pa$$word", http.StatusSeeOther, ""},
+		{"Wrong current password", "wrong", "new-pa$$word", "new-pa$$word", http.StatusUnprocessableEntity, "Your current password is incorrect"},
+		{"Blank current password", "", "new-pa$$word", "new-pa$$word", http.StatusUnprocessableEntity, "This field cannot be blank"},
+		{"Short new password", "pa$$word", "short", "short", http.StatusUnprocessableEntity, "This field must be at least 8 characters long"},
+		{"Mismatched confirmation", "pa$$word", "new-pa$$word", "other-pa$$word", http.StatusUnprocessableEntity, "The passwords don&#39;t match"},
+		{"Too long for bcrypt", "pa$$word", strings.Repeat("ä", 37), strings.Repeat("ä", 37), http.StatusUnprocessableEntity, "Passwords can be up to 72 bytes long"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := ts.Submit(t, "/account/password/update", "/account/password/update", url.Values{
+				"currentPassword":         {tt.current},
+				"newPassword":             {tt.newPassword},
+				"newPasswordConfirmation": {tt.confirmation},
+			})
+			assert.Equal(t, rs.Status, tt.wantCode)
+			if tt.wantError != "" {
+				assert.StringContains(t, rs.Body, tt.wantError)
+				if strings.Contains(rs.Body, `value="`+tt.newPassword) {
+					t.Error("expected the passwords not to be sent back")
+				}
+			} else {
+				assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/account/security")
+			}
+		})
+	}
+}
+
+// versionedUsers bumps the credential version on password changes, as the
+// database does
+type versionedUsers struct {
+	mocks.UserModel
+	version int
+}
+
+func (m *versionedUsers) Get(id int) (*models.User, error) {
+	user, err := m.UserModel.Get(id)
+	if user != nil {
+		user.CredentialVersion = m.version
+	}
+	return user, err
+}
+
+func (m *versionedUsers) PasswordUpdate(id int, currentPassword, newPassword string) error {
+	err := m.UserModel.PasswordUpdate(id, currentPassword, newPassword)
+	if err == nil {
+		m.version++
+	}
+	return err
+}
+
+func TestPasswordUpdateEndsOtherSessions(t *testing.T) {
+	app := newTestApplication(t)
+	app.users = &versionedUsers{}
+	laptop := testutil.NewServer(t, app.routes())
+	phone := testutil.NewServer(t, app.routes())
+	laptop.Login(t, "alice@example.com", "pa$$word")
+	phone.Login(t, "alice@example.com", "pa$$word")
+
+	rs := laptop.Submit(t, "/account/password/update", "/account/password/update", url.Values{
+		"currentPassword":         {"pa$$word"},
+		"newPassword":             {"new-pa$$word"},
+		"newPasswordConfirmation": {"new-pa$$word"},
+	})
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/account/security")
+
+	// The session that changed it carries on; the other is logged out
+	rs = laptop.Get(t, "/account/password/update")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	rs = phone.Get(t, "/account/password/update")
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/user/login")
+}
+
+func TestUserThemePost(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+
+	rs := ts.Get(t, "/")
+	assert.StringContains(t, rs.Body, `<link rel="stylesheet" href="/static/css/dark.css" media="(prefers-color-scheme: dark)" />`)
+
+	form := url.Values{}
+	form.Add("theme", "dark")
+	rs = ts.Submit(t, "/", "/user/theme", form)
+	assert.Equal(t, rs.Status, http.StatusSeeOther)
+
+	rs = ts.Get(t, "/")
+	assert.StringContains(t, rs.Body, `data-theme="dark"`)
+	assert.StringContains(t, rs.Body, `<link rel="stylesheet" href="/static/css/dark.css" />`)
+
+	form.Set("theme", "purple")
+	rs = ts.Submit(t, "/", "/user/theme", form)
+	assert.Equal(t, rs.Status, http.StatusBadRequest)
+}
+
+func TestRobots(t *testing.T) {
+	tests := []struct {
+		name        string
+		environment string
+		sitemapURL  string
+		wantBody    string
+	}{
+		{
+			name:        "Staging",
+			environment: "staging",
+			wantBody:    "User-agent: *\nDisallow: /\n",
+		},
+		{
+			name:        "Production",
+			environment: "production",
+			sitemapURL:  "https://snippetbox.example.com/sitemap.xml",
+			wantBody:    "Disallow: /user/\nDisallow: /snippet/create\nDisallow: /snippet/search\n\nSitemap: https://snippetbox.example.com/sitemap.xml\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.Server.Environment = tt.environment
+			app.config.Robots.SitemapURL = tt.sitemapURL
+			ts := testutil.NewServer(t, app.routes())
+
+			rs := ts.Get(t, "/robots.txt")
+			assert.Equal(t, rs.Status, http.StatusOK)
+			assert.Equal(t, rs.Header.Get("Content-Type"), "text/plain; charset=utf-8")
+			assert.StringContains(t, rs.Body, tt.wantBody)
+		})
+	}
+}
+
+func TestSnippetCreate(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		rs := ts.Get(t, "/snippet/create")
+		assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/user/login")
+	})
+
+	ts.Login(t, "alice@example.com", "pa$$word")
+
+	t.Run("Authenticated", func(t *testing.T) {
+		rs := ts.Get(t, "/snippet/create")
+		assert.Equal(t, rs.Status, http.StatusOK)
+		assert.StringContains(t, rs.Body, `<form action="/snippet/create" method="POST"`)
+	})
+
+	t.Run("Valid submission", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("title", "O snail")
+		form.Add("content", "O snail\nClimb Mount Fuji,\nBut slowly, slowly!")
+		form.Add("expires", "7")
+
+		rs := ts.Submit(t, "/snippet/create", "/snippet/create", form)
+		assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/snippet/view/2")
+	})
+}
+
+func TestSnippetPreview(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+	ts.Login(t, "alice@example.com", "pa$$word")
+
+	form := url.Values{}
+	form.Add("title", "O snail")
+	form.Add("content", "Climb Mount Fuji")
+
+	// htmx posts the preview without a CSRF token
+	preview := func(header string) testutil.Response {
+		req := ts.NewRequest(t, http.MethodPost, "/snippet/preview", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Sec-Fetch-Site", "same-origin")
+		if header != "" {
+			req.Header.Set("HX-Request", header)
+		}
+		return ts.Do(t, req)
+	}
+
+	rs := preview("true")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.StringContains(t, rs.Body, "Climb Mount Fuji")
+
+	rs = preview("")
+	assert.Equal(t, rs.Status, http.StatusForbidden)
+}
+
+func TestAdminMail(t *testing.T) {
+	tests := []struct {
+		name      string
+		email     string
+		wantCode  int
+		wantBody  []string
+		wantRedir string
+	}{
+		{
+			name:      "Anonymous",
+			wantCode:  http.StatusSeeOther,
+			wantRedir: "/user/login",
+		},
+		{
+			name:     "Regular user",
+			email:    "alice@example.com",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Admin",
+			email:    "admin@example.com",
+			wantCode: http.StatusOK,
+			wantBody: []string{
+				"<h2>Recent Email Deliveries</h2>",
+				"<td>bob@example.com</td>",
+				"dial tcp: connection refused",
+				"<td>5/5</td>",
+				"Failed",
+				"Sent",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := testutil.NewServer(t, app.routes())
+			if tt.email != "" {
+				ts.Login(t, tt.email, "pa$$word")
+			}
+
+			rs := ts.Get(t, "/admin/mail")
+			assert.Equal(t, rs.Status, tt.wantCode)
+			if tt.wantRedir != "" {
+				assert.Equal(t, rs.Header.Get("Location"), tt.wantRedir)
+			}
+			for _, want := range tt.wantBody {
+				assert.StringContains(t, rs.Body, want)
 			}
 		})
 	}
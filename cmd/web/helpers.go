@@ -1,15 +1,23 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"runtime/debug"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-playground/form/v4"
-	"github.com/justinas/nosurf"
+
+	"adotkaya.playground/internal/i18n"
+	"adotkaya.playground/internal/models"
 )
 
 // =============================================================================
@@ -20,9 +28,20 @@ import (
 func (app *application) newTemplateData(r *http.Request) *templateData {
 	return &templateData{
 		CurrentYear:     time.Now().Year(),
-		Flash:           app.sessionManager.PopString(r.Context(), "flash"),
+		Flashes:         app.popFlashes(r),
 		IsAuthenticated: app.isAuthenticated(r),
-		CSRFToken:       nosurf.Token(r),
+		IsAdmin:         app.hasRole(r, models.RoleAdmin),
+		IsModerator:     app.hasRole(r, models.RoleModerator),
+		CanCreate:       app.isAuthenticated(r) || app.config.Anonymous.Enabled,
+		SSO:             app.saml != nil,
+		Unread:          app.unreadNotifications(r),
+		CSRFToken:       csrfToken(r),
+		FormStarted:     app.formStarted(r),
+		Locale:          app.locale(r),
+		Theme:           app.theme(r),
+		Announcement:    app.announcement(r),
+		Page:            app.pageForBeacon(r),
+		Interstitial:    app.config.Links.Interstitial,
 	}
 }
 
@@ -30,11 +49,25 @@ func (app *application) newTemplateData(r *http.Request) *templateData {
 // Error Handlers
 // =============================================================================
 
-// serverError logs the error with a stack trace and sends a 500 response
+// serverError logs the error with a stack trace and the request's ID, and
+// sends a 500 response, or a 503 if the work ran out of time (see
+// requestDeadline)
 func (app *application) serverError(w http.ResponseWriter, err error) {
-	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
-	app.errorLog.Output(2, trace)
-	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	status := http.StatusInternalServerError
+	timedOut := errors.Is(err, context.DeadlineExceeded)
+	if timedOut {
+		status = http.StatusServiceUnavailable
+	}
+
+	requestID := "-"
+	// instrument counts them under the route
+	if rw := findResponse(w); rw != nil {
+		rw.serverError, rw.dbTimeout = true, timedOut
+		requestID = rw.requestID
+	}
+	app.logger.Error(err.Error(), "request_id", requestID, "trace", string(debug.Stack()))
+
+	http.Error(w, http.StatusText(status), status)
 }
 
 // clientError sends a specific HTTP status code and corresponding description
@@ -42,9 +75,60 @@ func (app *application) clientError(w http.ResponseWriter, status int) {
 	http.Error(w, http.StatusText(status), status)
 }
 
-// notFound is a convenience wrapper around clientError which sends a 404
-func (app *application) notFound(w http.ResponseWriter) {
-	app.clientError(w, http.StatusNotFound)
+// notFound sends a 404 response. HTML pages get the templated 404 page with
+// the usual layout; static and API paths keep the plain-text response.
+func (app *application) notFound(w http.ResponseWriter, r *http.Request) {
+	if !wantsHTMLError(r) {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Title = app.translate(r, "notfound.title")
+	data.Page = "" // Not a view of the route's page
+	app.render(w, http.StatusNotFound, "404.tmpl", data)
+}
+
+// modelError responds to an error from a model: 404 for a record that
+// doesn't exist, 409 Conflict for a write clashing with existing data, 422
+// for a value the database turned away and a server error for anything
+// else
+func (app *application) modelError(w http.ResponseWriter, r *http.Request, err error) {
+	var conflict *models.ConflictError
+	var invalid *models.ValidationError
+	switch {
+	case errors.Is(err, models.ErrNoRecord):
+		app.notFound(w, r)
+	case errors.As(err, &conflict):
+		app.clientError(w, http.StatusConflict)
+	case errors.As(err, &invalid):
+		app.clientError(w, http.StatusUnprocessableEntity)
+	default:
+		app.serverError(w, err)
+	}
+}
+
+// methodNotAllowed sends a 405 response, in the same style as notFound:
+// the templated page for HTML pages, a JSON error for API paths and plain
+// text for static ones. The router has already set the Allow header.
+func (app *application) methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/api/"):
+		app.apiError(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+	case !wantsHTMLError(r):
+		app.clientError(w, http.StatusMethodNotAllowed)
+	default:
+		data := app.newTemplateData(r)
+		data.Title = app.translate(r, "notallowed.title")
+		app.render(w, http.StatusMethodNotAllowed, "405.tmpl", data)
+	}
+}
+
+// wantsHTMLError reports whether an error for this request should be rendered
+// as an HTML page rather than plain text
+func wantsHTMLError(r *http.Request) bool {
+	path := r.URL.Path
+	return !strings.HasPrefix(path, "/static/") && !strings.HasPrefix(path, "/api/")
 }
 
 // =============================================================================
@@ -53,6 +137,25 @@ func (app *application) notFound(w http.ResponseWriter) {
 
 // render renders a template with the given data and status code
 func (app *application) render(w http.ResponseWriter, status int, page string, data *templateData) {
+	app.renderBlock(w, status, page, "base", data)
+}
+
+// renderHTMX renders only the named block of a page for htmx requests, so
+// the fragment can be swapped into the current page, and the full page
+// otherwise
+func (app *application) renderHTMX(w http.ResponseWriter, r *http.Request, status int, page, block string, data *templateData) {
+	// The response differs depending on the header, so caches must key on it
+	w.Header().Add("Vary", "HX-Request")
+
+	if isHTMX(r) {
+		app.renderBlock(w, status, page, block, data)
+		return
+	}
+	app.render(w, status, page, data)
+}
+
+// renderBlock executes a named block of a page template set
+func (app *application) renderBlock(w http.ResponseWriter, status int, page, block string, data *templateData) {
 	// Retrieve the appropriate template from the cache
 	ts, ok := app.templateCache[page]
 	if !ok {
@@ -61,9 +164,22 @@ func (app *application) render(w http.ResponseWriter, status int, page string, d
 		return
 	}
 
+	// Fill in head metadata the handler didn't set explicitly
+	if data.Title == "" {
+		data.Title = i18n.T(data.Locale, strings.TrimSuffix(page, ".tmpl")+".title")
+	}
+	if data.Description == "" {
+		data.Description = i18n.T(data.Locale, "site.description")
+	}
+	if data.OGType == "" {
+		data.OGType = "website"
+	}
+
 	// Write template to a buffer first to catch any errors before writing to response
-	buf := new(bytes.Buffer)
-	err := ts.ExecuteTemplate(buf, "base", data)
+	buf := renderBuffers.get()
+	defer renderBuffers.put(buf)
+
+	err := ts.ExecuteTemplate(buf, block, data)
 	if err != nil {
 		app.serverError(w, err)
 		return
@@ -74,6 +190,57 @@ func (app *application) render(w http.ResponseWriter, status int, page string, d
 	buf.WriteTo(w)
 }
 
+// breadcrumbs builds a navigation trail starting with the Home crumb
+func (app *application) breadcrumbs(r *http.Request, trail ...Crumb) []Crumb {
+	return append([]Crumb{{Label: app.translate(r, "nav.home"), URL: "/"}}, trail...)
+}
+
+// canonicalURL returns the absolute URL for a path on the configured base URL
+func (app *application) canonicalURL(path string) string {
+	return strings.TrimSuffix(app.config.Server.BaseURL, "/") + path
+}
+
+// isHTMX reports whether the request was issued by htmx
+func isHTMX(r *http.Request) bool {
+	return r.Header.Get("HX-Request") == "true"
+}
+
+// queryFlag reports whether the named query parameter is switched on, as in
+// ?plain=1 or ?plain=true
+func queryFlag(r *http.Request, name string) bool {
+	on, _ := strconv.ParseBool(r.URL.Query().Get(name))
+	return on
+}
+
+// redirect sends a 303 redirect. htmx would follow a plain redirect and swap
+// the whole target page into the fragment, so it gets HX-Redirect instead.
+func (app *application) redirect(w http.ResponseWriter, r *http.Request, url string) {
+	if isHTMX(r) {
+		w.Header().Set("HX-Redirect", url)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	http.Redirect(w, r, url, http.StatusSeeOther)
+}
+
+// =============================================================================
+// Signing Helpers
+// =============================================================================
+
+// sign returns an HMAC of msg keyed with the secret key. Messages should
+// start with their purpose (e.g. "unsubscribe:") so a signature issued for
+// one purpose can't be replayed for another.
+func (app *application) sign(msg string) string {
+	mac := hmac.New(sha256.New, []byte(app.config.Server.SecretKey))
+	mac.Write([]byte(msg))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// validSignature reports whether sig is the signature of msg
+func (app *application) validSignature(msg, sig string) bool {
+	return hmac.Equal([]byte(sig), []byte(app.sign(msg)))
+}
+
 // =============================================================================
 // Authentication Helpers
 // =============================================================================
@@ -87,6 +254,94 @@ func (app *application) isAuthenticated(r *http.Request) bool {
 	return isAuthenticated
 }
 
+// currentUserID returns the ID of the authenticated user, whether they
+// authenticated with a session or an API token, or 0 for anonymous
+// visitors
+func currentUserID(r *http.Request) int {
+	id, _ := r.Context().Value(userIDContextKey).(int)
+	return id
+}
+
+// hasRole reports whether the current request is from an authenticated user
+// with the given role (admins have every role)
+func (app *application) hasRole(r *http.Request, role string) bool {
+	userRole, ok := r.Context().Value(userRoleContextKey).(string)
+	if !ok {
+		return false
+	}
+	return (&models.User{Role: userRole}).HasRole(role)
+}
+
+// logIn starts an authenticated session for the user, switching to their
+// saved locale and theme
+func (app *application) logIn(r *http.Request, id int) error {
+	// Renew session token to prevent session fixation attacks
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		return err
+	}
+
+	// Store user ID in session
+	userIDKey.Put(app.sessionManager, r.Context(), id)
+
+	// Switch to the user's saved locale, if they have chosen one
+	user, err := app.users.Get(id)
+	if err != nil {
+		return err
+	}
+	credentialVersionKey.Put(app.sessionManager, r.Context(), user.CredentialVersion)
+	if user.Locale != "" {
+		localeKey.Put(app.sessionManager, r.Context(), user.Locale)
+	}
+	if user.Theme != "" {
+		themeKey.Put(app.sessionManager, r.Context(), user.Theme)
+	}
+	return nil
+}
+
+// =============================================================================
+// Theme Helpers
+// =============================================================================
+
+// themes lists the selectable colour themes. The empty theme ("auto")
+// follows the visitor's OS preference via a prefers-color-scheme query.
+var themes = []string{"", "light", "dark"}
+
+// theme returns the colour theme selected by the detectTheme middleware
+func (app *application) theme(r *http.Request) string {
+	theme, _ := r.Context().Value(themeContextKey).(string)
+	return theme
+}
+
+// =============================================================================
+// Internationalization Helpers
+// =============================================================================
+
+// locale returns the UI locale negotiated by the detectLocale middleware
+func (app *application) locale(r *http.Request) string {
+	locale, ok := r.Context().Value(localeContextKey).(string)
+	if !ok {
+		return i18n.DefaultLocale
+	}
+	return locale
+}
+
+// translate translates a message key into the request's locale
+func (app *application) translate(r *http.Request, key string, args ...any) string {
+	return i18n.T(app.locale(r), key, args...)
+}
+
+// localRedirectTarget returns the path and query of a Referer header value,
+// or "/" if it is missing. Dropping the scheme and host means the result can
+// only ever redirect within this site.
+func localRedirectTarget(referer string) string {
+	u, err := url.Parse(referer)
+	if err != nil || u.Path == "" || !strings.HasPrefix(u.Path, "/") || strings.HasPrefix(u.Path, "//") {
+		return "/"
+	}
+	return u.RequestURI()
+}
+
 // =============================================================================
 // Form Handling
 // =============================================================================
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/form/v4"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/models"
+)
+
+func BenchmarkDecodePostForm(b *testing.B) {
+	app := &application{formDecoder: form.NewDecoder()}
+
+	values := url.Values{}
+	values.Add("title", "O snail")
+	values.Add("content", "O snail\nClimb Mount Fuji,\nBut slowly, slowly!")
+	values.Add("expires", "7")
+	body := values.Encode()
+
+	for b.Loop() {
+		r := httptest.NewRequest(http.MethodPost, "/snippet/create", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		var f SnippetCreateForm
+		if err := app.decodePostForm(r, &f); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestModelError(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"Not found", fmt.Errorf("loading: %w", &models.NotFoundError{Resource: "snippet", ID: 7}), http.StatusNotFound},
+		{"Sentinel", models.ErrNoRecord, http.StatusNotFound},
+		{"Conflict", &models.ConflictError{Constraint: "users_uc_email", Err: models.ErrDuplicateEmail}, http.StatusConflict},
+		{"Invalid", &models.ValidationError{Field: "level", Message: "unknown level"}, http.StatusUnprocessableEntity},
+		{"Other", errors.New("connection reset"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler := app.sessionManager.LoadAndSave(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				app.modelError(w, r, tt.err)
+			}))
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			assert.Equal(t, rec.Code, tt.want)
+		})
+	}
+}
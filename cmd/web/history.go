@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"adotkaya.playground/internal/models"
+)
+
+// =============================================================================
+// Snippet History
+// =============================================================================
+
+// historyAuditLimit is how many audit log entries the history page shows
+// for a snippet
+const historyAuditLimit = 50
+
+// historyChange is a recorded change with the fields it changed, for the
+// admin history page
+type historyChange struct {
+	*models.SnippetChange
+	Fields []fieldChange
+}
+
+// fieldChange is one field's value before and after a change. Before is
+// empty for creations and After for deletions.
+type fieldChange struct {
+	Name   string // Suffix of the "admin_history.field_*" message
+	Before string
+	After  string
+}
+
+// recordChange adds a change by the current visitor to a snippet's
+// history. Like recordAudit, a failure is logged rather than shown.
+func (app *application) recordChange(r *http.Request, snippetID int, action string, before, after *models.SnippetMeta) {
+	c := &models.SnippetChange{
+		SnippetID: snippetID,
+		ActorID:   currentUserID(r),
+		Action:    action,
+		Before:    before,
+		After:     after,
+	}
+	if c.ActorID == 0 {
+		c.ActorIP = app.clientIP(r)
+	}
+
+	if err := app.changes.Record(c); err != nil {
+		app.logger.ErrorContext(r.Context(), "history", "action", action, "target", snippetTarget(snippetID), "error", err)
+	}
+}
+
+// snippetMeta returns the metadata recorded in a snippet's history, with
+// the content reduced to its size and a short hash
+func snippetMeta(s *models.Snippet) *models.SnippetMeta {
+	sum := sha256.Sum256([]byte(s.Content))
+	tags := slices.Clone(s.Tags)
+	slices.Sort(tags)
+
+	return &models.SnippetMeta{
+		Title:       s.Title,
+		Size:        len(s.Content),
+		ContentHash: hex.EncodeToString(sum[:8]),
+		Tags:        tags,
+		Private:     s.Private,
+		Encrypted:   s.Encrypted,
+		Expires:     s.Expires.UTC().Truncate(time.Second),
+	}
+}
+
+// changedFields lists the fields shown for a change: every field of a
+// created or deleted snippet, and the fields that differ for an edit
+func changedFields(c *models.SnippetChange) []fieldChange {
+	before, after := metaFields(c.Before), metaFields(c.After)
+
+	fields := []fieldChange{}
+	for i, name := range metaFieldNames {
+		if before[i] != after[i] {
+			fields = append(fields, fieldChange{Name: name, Before: before[i], After: after[i]})
+		}
+	}
+	return fields
+}
+
+// metaFieldNames names the values returned by metaFields
+var metaFieldNames = []string{"title", "size", "content_hash", "tags", "private", "encrypted", "expires"}
+
+// metaFields formats a snippet's recorded metadata for display, or returns
+// empty values for nil
+func metaFields(m *models.SnippetMeta) []string {
+	if m == nil {
+		return make([]string, len(metaFieldNames))
+	}
+	return []string{
+		m.Title,
+		strconv.Itoa(m.Size),
+		m.ContentHash,
+		strings.Join(m.Tags, ", "),
+		strconv.FormatBool(m.Private),
+		strconv.FormatBool(m.Encrypted),
+		m.Expires.UTC().Format("2006-01-02 15:04 UTC"),
+	}
+}
+
+// adminHistory shows admins every recorded change to a snippet, along with
+// moderation and admin actions taken on it. Deleted snippets keep their
+// history, so it is looked up by ID.
+func (app *application) adminHistory(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Query = r.URL.Query().Get("snippet")
+
+	if data.Query != "" {
+		id, err := strconv.Atoi(data.Query)
+		if err != nil || id < 1 {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+
+		changes, err := app.changes.History(id)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		data.Changes = make([]historyChange, 0, len(changes))
+		for _, c := range changes {
+			data.Changes = append(data.Changes, historyChange{SnippetChange: c, Fields: changedFields(c)})
+		}
+
+		data.Audit, err = app.audit.ForTarget(snippetTarget(id), historyAuditLimit)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	app.render(w, http.StatusOK, "admin_history.tmpl", data)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/models/mocks"
+	"adotkaya.playground/internal/testutil"
+)
+
+// recordingChanges keeps the changes it is asked to record
+type recordingChanges struct {
+	mocks.SnippetChangeModel
+	changes []*models.SnippetChange
+}
+
+func (m *recordingChanges) Record(c *models.SnippetChange) error {
+	m.changes = append(m.changes, c)
+	return nil
+}
+
+func TestChangedFields(t *testing.T) {
+	expires := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	before := &models.SnippetMeta{Title: "Pond", Size: 4, ContentHash: "aa", Tags: []string{"haiku"}, Expires: expires}
+	after := &models.SnippetMeta{Title: "Pond", Size: 5, ContentHash: "bb", Tags: []string{"haiku", "nature"}, Expires: expires}
+
+	fields := changedFields(&models.SnippetChange{Action: models.ChangeEdit, Before: before, After: after})
+	assert.Equal(t, len(fields), 3)
+	assert.Equal(t, fields[0], fieldChange{"size", "4", "5"})
+	assert.Equal(t, fields[1], fieldChange{"content_hash", "aa", "bb"})
+	assert.Equal(t, fields[2], fieldChange{"tags", "haiku", "haiku, nature"})
+
+	// Every field of a deleted snippet is shown
+	fields = changedFields(&models.SnippetChange{Action: models.ChangeDelete, Before: before})
+	assert.Equal(t, len(fields), len(metaFieldNames))
+	assert.Equal(t, fields[6], fieldChange{"expires", "2025-06-01 12:00 UTC", ""})
+}
+
+func TestSnippetChangesRecorded(t *testing.T) {
+	app := newTestApplication(t)
+	app.snippets = &aliceSnippets{}
+	changes := &recordingChanges{}
+	app.changes = changes
+	ts := testutil.NewServer(t, app.routes())
+	ts.Login(t, "alice@example.com", "pa$$word")
+
+	rs := ts.Submit(t, "/snippet/create", "/snippet/create", url.Values{
+		"title":   {"O snail"},
+		"content": {"Climb Mount Fuji"},
+		"tags":    {"nature, haiku"},
+		"expires": {"7"},
+	})
+	assert.Equal(t, rs.Status, http.StatusSeeOther)
+
+	rs = ts.Submit(t, "/snippet/edit/1", "/snippet/edit/1", url.Values{
+		"title":   {"O snail"},
+		"content": {"An old silent pond..."},
+	})
+	assert.Equal(t, rs.Status, http.StatusSeeOther)
+
+	rs = ts.Submit(t, "/snippet/view/1", "/snippet/delete/1", url.Values{})
+	assert.Equal(t, rs.Status, http.StatusSeeOther)
+
+	assert.Equal(t, len(changes.changes), 3)
+
+	created := changes.changes[0]
+	assert.Equal(t, created.SnippetID, 2)
+	assert.Equal(t, created.ActorID, 1)
+	assert.Equal(t, created.Action, models.ChangeCreate)
+	assert.Equal(t, created.Before, (*models.SnippetMeta)(nil))
+	assert.Equal(t, created.After.Title, "O snail")
+	assert.Equal(t, created.After.Size, len("Climb Mount Fuji"))
+	assert.DeepEqual(t, created.After.Tags, []string{"haiku", "nature"})
+
+	// Only the title changed
+	edited := changes.changes[1]
+	assert.Equal(t, edited.Action, models.ChangeEdit)
+	fields := changedFields(edited)
+	assert.Equal(t, len(fields), 1)
+	assert.Equal(t, fields[0].After, "O snail")
+
+	deleted := changes.changes[2]
+	assert.Equal(t, deleted.Action, models.ChangeDelete)
+	assert.Equal(t, deleted.Before.Title, "An old silent pond")
+	assert.Equal(t, deleted.After, (*models.SnippetMeta)(nil))
+}
+
+func TestAdminHistory(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{"Admin", "admin@example.com", "/admin/history?snippet=1", http.StatusOK, "An old silent pond"},
+		{"No changes", "admin@example.com", "/admin/history?snippet=99", http.StatusOK, "No changes are recorded for this snippet."},
+		{"Lookup form", "admin@example.com", "/admin/history", http.StatusOK, `name="snippet"`},
+		{"Invalid ID", "admin@example.com", "/admin/history?snippet=abc", http.StatusBadRequest, ""},
+		{"Non-admin", "alice@example.com", "/admin/history?snippet=1", http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := testutil.NewServer(t, newTestApplication(t).routes())
+			ts.Login(t, tt.email, "pa$$word")
+
+			rs := ts.Get(t, tt.path)
+			assert.Equal(t, rs.Status, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, rs.Body, tt.wantBody)
+			}
+		})
+	}
+}
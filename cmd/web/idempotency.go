@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"adotkaya.playground/internal/models"
+)
+
+// =============================================================================
+// Idempotent Submissions
+// =============================================================================
+
+const (
+	// idempotencyHeader carries the key of a scripted submission. Forms send
+	// it in the idempotency_key field instead.
+	idempotencyHeader = "Idempotency-Key"
+
+	// idempotencyKeyMaxLen is the longest key accepted
+	idempotencyKeyMaxLen = 255
+
+	// idempotencyWait is how long a repeated submission waits for the first
+	// one to finish before giving up with 409 Conflict
+	idempotencyWait = 5 * time.Second
+
+	// idempotencyPoll is how often a waiting submission checks again
+	idempotencyPoll = 100 * time.Millisecond
+)
+
+// idempotencySchedule is when keys older than their lifetime are deleted
+var idempotencySchedule = daily(4)
+
+// newIdempotencyKey returns a random key for a create form to submit, so
+// submitting it twice creates one snippet
+func newIdempotencyKey() string {
+	return rand.Text()
+}
+
+// idempotencyKey returns the key sent with a submission, from the
+// Idempotency-Key header or else the form's field, or "" if there is none.
+// It reports false for a key too long or containing anything but printable
+// ASCII.
+func idempotencyKey(r *http.Request, field string) (string, bool) {
+	key := r.Header.Get(idempotencyHeader)
+	if key == "" {
+		key = field
+	}
+	if len(key) > idempotencyKeyMaxLen {
+		return "", false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < ' ' || key[i] > '~' {
+			return "", false
+		}
+	}
+	return key, true
+}
+
+// idempotencyScope keeps different creators' keys apart, so one can't
+// replay another's submission: users by account, whether logged in or
+// using an API token, and anonymous visitors by address
+func (app *application) idempotencyScope(r *http.Request) string {
+	if userID := currentUserID(r); userID != 0 {
+		return fmt.Sprintf("user:%d", userID)
+	}
+	return "ip:" + app.clientIP(r).String()
+}
+
+// claimKey claims key for a submission about to create a snippet, returning
+// 0 if the submission should go ahead and call finishSubmission, or the ID
+// of the snippet an earlier submission with the key created. If an earlier
+// one is still in progress, as when a form is submitted twice in quick
+// succession, it waits for its result, returning models.ErrKeyInProgress if
+// it doesn't come in time.
+func (app *application) claimKey(r *http.Request, key string) (int, error) {
+	scope := app.idempotencyScope(r)
+	deadline := time.Now().Add(idempotencyWait)
+	for {
+		id, err := app.idempotency.Claim(scope, key)
+		if !errors.Is(err, models.ErrKeyInProgress) || time.Now().After(deadline) {
+			return id, err
+		}
+
+		select {
+		case <-r.Context().Done():
+			return 0, r.Context().Err()
+		case <-time.After(idempotencyPoll):
+		}
+	}
+}
+
+// claimSubmission claims key for a form submission with claimKey. If an
+// earlier submission with the key created a snippet, it redirects there
+// instead, as the earlier submission did. It returns false if it has
+// written the response, and true if the submission should go ahead.
+func (app *application) claimSubmission(w http.ResponseWriter, r *http.Request, key string) bool {
+	id, err := app.claimKey(r, key)
+	switch {
+	case err == nil && id == 0:
+		return true
+	case err == nil:
+		app.redirect(w, r, fmt.Sprintf("/snippet/view/%d", id))
+	case errors.Is(err, models.ErrKeyInProgress):
+		app.clientError(w, http.StatusConflict)
+	case r.Context().Err() != nil:
+		// The client has gone
+	default:
+		app.serverError(w, err)
+	}
+	return false
+}
+
+// finishSubmission records the snippet a claimed submission created, so
+// repeats of it are sent there, or frees the key if it created none (id is
+// 0), so the submission can be corrected and retried
+func (app *application) finishSubmission(r *http.Request, key string, id int) {
+	scope := app.idempotencyScope(r)
+	var err error
+	if id == 0 {
+		err = app.idempotency.Release(scope, key)
+	} else {
+		err = app.idempotency.Complete(scope, key, id)
+	}
+	// The snippet exists either way, so only log failures
+	if err != nil {
+		app.logger.ErrorContext(r.Context(), "idempotency key", "key", key, "error", err)
+	}
+}
+
+// pruneIdempotencyKeys is the scheduled task deleting keys older than their
+// lifetime
+func (app *application) pruneIdempotencyKeys() error {
+	n, err := app.idempotency.Prune()
+	if err != nil {
+		return err
+	}
+	app.logger.Info("Pruned idempotency keys", "count", n)
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/models/mocks"
+	"adotkaya.playground/internal/testutil"
+)
+
+// countingSnippets numbers the snippets it is asked to insert, or fails
+// with err while it is set
+type countingSnippets struct {
+	mocks.SnippetModel
+	inserted int
+	err      error
+}
+
+func (m *countingSnippets) Insert(userID int, creatorIP netip.Addr, title string, content string, expires int, private bool, limits models.SnippetLimits) (int, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+	m.inserted++
+	return m.inserted, nil
+}
+
+var idempotencyKeyRX = regexp.MustCompile(`name="idempotency_key" value="([^"]+)"`)
+
+func TestIdempotentCreate(t *testing.T) {
+	app := newTestApplication(t)
+	snippets := &countingSnippets{}
+	app.snippets = snippets
+	ts := testutil.NewServer(t, app.routes())
+	ts.Login(t, "alice@example.com", "pa$$word")
+
+	page := ts.Get(t, "/snippet/create")
+	m := idempotencyKeyRX.FindStringSubmatch(page.Body)
+	assert.NotNil(t, m)
+	key := m[1]
+
+	form := url.Values{
+		"title":           {"O snail"},
+		"content":         {"O snail\nClimb Mount Fuji,\nBut slowly, slowly!"},
+		"expires":         {"7"},
+		"idempotency_key": {key},
+	}
+
+	// Submitting the form twice creates one snippet
+	for range 2 {
+		rs := ts.Submit(t, "/snippet/create", "/snippet/create", form)
+		assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/snippet/view/1")
+	}
+	assert.Equal(t, snippets.inserted, 1)
+
+	// A failed submission can be retried with the same key
+	form.Set("idempotency_key", "retry-after-quota")
+	snippets.err = &models.QuotaError{Limit: models.QuotaHourly, Max: 10, RetryAfter: time.Minute}
+	rs := ts.Submit(t, "/snippet/create", "/snippet/create", form)
+	assert.Equal(t, rs.Status, http.StatusTooManyRequests)
+	snippets.err = nil
+	rs = ts.Submit(t, "/snippet/create", "/snippet/create", form)
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/snippet/view/2")
+
+	// Scripts send the key in a header, which wins over the field
+	post := func(header string) testutil.Response {
+		values := withCSRF(t, ts.Get(t, "/snippet/create").Body, form)
+		req := ts.NewRequest(t, http.MethodPost, "/snippet/create", strings.NewReader(values.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Referer", ts.URL+"/snippet/create")
+		req.Header.Set("Idempotency-Key", header)
+		return ts.Do(t, req)
+	}
+	for range 2 {
+		rs = post("script-1")
+		assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/snippet/view/3")
+	}
+	assert.Equal(t, snippets.inserted, 3)
+
+	// Malformed keys are refused
+	rs = post(strings.Repeat("k", idempotencyKeyMaxLen+1))
+	assert.Equal(t, rs.Status, http.StatusBadRequest)
+	form.Set("idempotency_key", "bad\x00key")
+	rs = ts.Submit(t, "/snippet/create", "/snippet/create", form)
+	assert.Equal(t, rs.Status, http.StatusBadRequest)
+
+	// Another user's key is their own
+	ts.Login(t, "admin@example.com", "pa$$word")
+	form.Set("idempotency_key", key)
+	rs = ts.Submit(t, "/snippet/create", "/snippet/create", form)
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/snippet/view/4")
+
+	// Forms without a key, as before, aren't deduplicated
+	form.Del("idempotency_key")
+	for i := range 2 {
+		rs = ts.Submit(t, "/snippet/create", "/snippet/create", form)
+		assert.Equal(t, rs.Header.Get("Location"), "/snippet/view/"+strconv.Itoa(5+i))
+	}
+}
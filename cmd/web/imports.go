@@ -0,0 +1,397 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/validator"
+)
+
+// =============================================================================
+// Importing Snippets
+// =============================================================================
+// Logged-in users can import a snippet from a Pastebin paste or a GitLab
+// snippet by its URL. Only those two sites are fetched from, at URLs built
+// from the parts of the given URL that identify the snippet, so the form
+// can't be used to make the server fetch anything else. The fetch also
+// refuses to connect to private and local addresses, in case a site's name
+// ever resolves to one.
+
+const (
+	// importTimeout bounds fetching an imported snippet
+	importTimeout = 10 * time.Second
+
+	// maxImportSize caps imported content for users whose tier has no
+	// size limit
+	maxImportSize = 1 << 20
+
+	// maxImportRedirects is how many redirects, all within the allowed
+	// sites, a fetch follows
+	maxImportRedirects = 3
+
+	// importsPerMinute is how many imports a user may start a minute
+	importsPerMinute = 5
+)
+
+var (
+	// errImportURL is returned for URLs that aren't a Pastebin paste or
+	// GitLab snippet
+	errImportURL = errors.New("import: not a Pastebin or GitLab snippet URL")
+
+	// errImportNotFound is returned when the snippet doesn't exist or
+	// isn't public
+	errImportNotFound = errors.New("import: snippet not found")
+
+	// errImportTooLarge is returned when the content is over the size
+	// limit
+	errImportTooLarge = errors.New("import: content too large")
+
+	// errImportNotText is returned when the content isn't UTF-8 text
+	errImportNotText = errors.New("import: content isn't text")
+
+	// errImportBlocked is returned when a fetch would connect to a private
+	// or local address
+	errImportBlocked = errors.New("import: address not allowed")
+)
+
+var (
+	// pastebinIDRX matches Pastebin paste IDs
+	pastebinIDRX = regexp.MustCompile(`^[A-Za-z0-9]{8}$`)
+
+	// gitlabIDRX and gitlabPathRX match GitLab snippet IDs and the
+	// namespace and project segments of project snippet paths
+	gitlabIDRX   = regexp.MustCompile(`^[0-9]{1,12}$`)
+	gitlabPathRX = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,254}$`)
+)
+
+// importHosts are the hosts imports are fetched from
+var importHosts = map[string]bool{
+	"pastebin.com": true,
+	"gitlab.com":   true,
+}
+
+// importSource is a snippet on another site, identified by its URL
+type importSource struct {
+	Site string // "Pastebin" or "GitLab"
+	ID   string
+	Page string // Canonical URL of the snippet's page, kept as its source
+	Raw  string // URL of its raw content
+}
+
+// parseImportURL identifies the Pastebin paste or GitLab snippet a URL
+// points to, either its page or its raw content. Returns errImportURL for
+// anything else.
+func parseImportURL(raw string) (importSource, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.User != nil || u.Port() != "" {
+		return importSource{}, errImportURL
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+
+	switch host {
+	case "pastebin.com":
+		// /<id> or /raw/<id>
+		if len(segments) == 2 && segments[0] == "raw" {
+			segments = segments[1:]
+		}
+		if len(segments) != 1 || !pastebinIDRX.MatchString(segments[0]) {
+			return importSource{}, errImportURL
+		}
+		id := segments[0]
+		return importSource{
+			Site: "Pastebin",
+			ID:   id,
+			Page: "https://pastebin.com/" + id,
+			Raw:  "https://pastebin.com/raw/" + id,
+		}, nil
+
+	case "gitlab.com":
+		// [/<namespace>/<project>]/-/snippets/<id>[/raw]
+		if segments[len(segments)-1] == "raw" {
+			segments = segments[:len(segments)-1]
+		}
+		n := len(segments)
+		if n < 3 || segments[n-3] != "-" || segments[n-2] != "snippets" || !gitlabIDRX.MatchString(segments[n-1]) {
+			return importSource{}, errImportURL
+		}
+		// Personal snippets have no project; project snippets have a
+		// namespace, perhaps with subgroups, and a project
+		project := segments[:n-3]
+		if len(project) == 1 {
+			return importSource{}, errImportURL
+		}
+		for _, s := range project {
+			if !gitlabPathRX.MatchString(s) {
+				return importSource{}, errImportURL
+			}
+		}
+		page := "https://gitlab.com/" + strings.Join(append(project, "-", "snippets", segments[n-1]), "/")
+		return importSource{
+			Site: "GitLab",
+			ID:   segments[n-1],
+			Page: page,
+			Raw:  page + "/raw",
+		}, nil
+	}
+	return importSource{}, errImportURL
+}
+
+// normalizeImport tidies fetched content the way a pasted snippet would
+// be: without a byte order mark, with Unix line endings and without
+// trailing blank lines
+func normalizeImport(content string) string {
+	content = strings.TrimPrefix(content, "\uFEFF")
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.ReplaceAll(content, "\r", "\n")
+	return strings.TrimRight(content, "\n\t ")
+}
+
+// snippetFetcher fetches the raw content of snippets on other sites
+type snippetFetcher interface {
+	// Fetch returns the content of a snippet, failing with
+	// errImportTooLarge if it is longer than maxSize bytes
+	Fetch(src importSource, maxSize int) (string, error)
+}
+
+// httpFetcher is the snippetFetcher fetching over HTTPS from the allowed
+// sites
+type httpFetcher struct {
+	client *http.Client
+}
+
+// newHTTPFetcher returns a fetcher that only connects to public addresses
+// and only follows redirects within the allowed sites
+func newHTTPFetcher() *httpFetcher {
+	dialer := &net.Dialer{Timeout: importTimeout, Control: publicAddressOnly}
+	return &httpFetcher{
+		client: &http.Client{
+			Timeout: importTimeout,
+			Transport: &http.Transport{
+				// No proxy: it would be the proxy's address that was checked
+				Proxy:               nil,
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: importTimeout,
+			},
+			CheckRedirect: checkImportRedirect,
+		},
+	}
+}
+
+func (f *httpFetcher) Fetch(src importSource, maxSize int) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), importTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src.Raw, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "text/plain")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound, resp.StatusCode == http.StatusForbidden,
+		resp.StatusCode == http.StatusUnauthorized:
+		return "", errImportNotFound
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("import: GET %s: %s", src.Raw, resp.Status)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, int64(maxSize)+1))
+	if err != nil {
+		return "", err
+	}
+	if len(b) > maxSize {
+		return "", errImportTooLarge
+	}
+	if !utf8.Valid(b) {
+		return "", errImportNotText
+	}
+	return string(b), nil
+}
+
+// checkImportRedirect follows a few redirects over HTTPS to the allowed
+// sites, and no others
+func checkImportRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > maxImportRedirects {
+		return errors.New("import: too many redirects")
+	}
+	host := strings.TrimPrefix(strings.ToLower(req.URL.Hostname()), "www.")
+	if req.URL.Scheme != "https" || req.URL.Port() != "" || !importHosts[host] {
+		return errImportBlocked
+	}
+	return nil
+}
+
+// blockedPrefixes are public-looking ranges that aren't reachable on the
+// internet, on top of the private, loopback and link-local ones
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("100.64.0.0/10"), // Carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"), // Benchmarking
+}
+
+// publicAddressOnly is a dialer Control function refusing connections to
+// anything but public unicast addresses. It runs after name resolution,
+// so it catches names resolving to internal addresses too.
+func publicAddressOnly(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return errImportBlocked
+	}
+	addr := addrPort.Addr().Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return errImportBlocked
+	}
+	for _, p := range blockedPrefixes {
+		if p.Contains(addr) {
+			return errImportBlocked
+		}
+	}
+	return nil
+}
+
+// =============================================================================
+// Handlers
+// =============================================================================
+
+// importForm represents the form importing a snippet
+type importForm struct {
+	URL                 string `form:"url"`
+	Title               string `form:"title"`
+	Expires             int    `form:"expires"`
+	Private             bool   `form:"private"`
+	validator.Validator `form:"-"`
+}
+
+// snippetImport displays the form for importing a snippet
+func (app *application) snippetImport(w http.ResponseWriter, r *http.Request) {
+	app.renderImport(w, r, http.StatusOK, importForm{Expires: 7})
+}
+
+// snippetImportPost fetches a snippet from Pastebin or GitLab and creates
+// a snippet with its content, recording where it came from
+func (app *application) snippetImportPost(w http.ResponseWriter, r *http.Request) {
+	var form importForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	src, err := parseImportURL(form.URL)
+	form.CheckField(validator.NotBlank(form.URL), "url", app.translate(r, "validation.blank"))
+	form.CheckField(err == nil, "url", app.translate(r, "validation.import_url"))
+	form.Title = strings.TrimSpace(form.Title)
+	form.CheckField(validator.MaxChars(form.Title, 100), "title", app.translate(r, "validation.max_chars", 100))
+	form.CheckField(validator.PermittedValue(form.Expires, 1, 7, 365), "expires", app.translate(r, "validation.expires"))
+	if !form.Valid() {
+		app.renderImport(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	visitor := app.visitor(r)
+	if ok, retry := app.quotas.allowImport(visitor); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+		form.AddNonFieldError(app.translate(r, "validation.import_rate", importsPerMinute))
+		app.renderImport(w, r, http.StatusTooManyRequests, form)
+		return
+	}
+
+	_, maxSize := app.quotas.allowsSize(visitor, 0)
+	if maxSize == 0 {
+		maxSize = maxImportSize
+	}
+	content, err := app.importer.Fetch(src, maxSize)
+	switch {
+	case errors.Is(err, errImportNotFound):
+		form.AddFieldError("url", app.translate(r, "validation.import_not_found", src.Site))
+	case errors.Is(err, errImportTooLarge):
+		form.AddFieldError("url", app.sizeMessage(r, maxSize))
+	case errors.Is(err, errImportNotText):
+		form.AddFieldError("url", app.translate(r, "validation.import_not_text"))
+	case err != nil:
+		app.logger.ErrorContext(r.Context(), "import", "source", src.Raw, "error", err)
+		form.AddNonFieldError(app.translate(r, "validation.import_failed", src.Site))
+	}
+	content = normalizeImport(content)
+	if err == nil && content == "" {
+		form.AddFieldError("url", app.translate(r, "validation.import_empty"))
+	}
+	if !form.Valid() {
+		app.renderImport(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	if form.Title == "" {
+		form.Title = app.translate(r, "import.default_title", src.Site, src.ID)
+	}
+
+	limits, err := app.quotas.snippetLimits(visitor)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	userID := userIDKey.Get(app.sessionManager, r.Context())
+	id, err := app.snippets.Insert(userID, app.clientIP(r), form.Title, content, form.Expires, form.Private, limits)
+	if err != nil {
+		var quotaErr *models.QuotaError
+		if errors.As(err, &quotaErr) {
+			form.AddNonFieldError(app.quotaMessage(r, quotaErr))
+			app.renderImport(w, r, http.StatusTooManyRequests, form)
+			return
+		}
+		app.serverError(w, err)
+		return
+	}
+	err = app.snippets.SetSource(id, src.Page)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.pages.purge("/")
+	if !form.Private {
+		app.events.publish(snippetEvent{ID: id, Title: form.Title, Created: time.Now()})
+	}
+	app.recordChange(r, id, models.ChangeCreate, nil, snippetMeta(&models.Snippet{
+		Title:   form.Title,
+		Content: content,
+		Private: form.Private,
+		Expires: time.Now().AddDate(0, 0, form.Expires),
+	}))
+
+	app.putFlash(r, app.translate(r, "flash.snippet_imported", src.Site))
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+}
+
+// renderImport renders the import page with its form
+func (app *application) renderImport(w http.ResponseWriter, r *http.Request, status int, form importForm) {
+	data := app.newTemplateData(r)
+	data.Form = form
+	data.Breadcrumbs = app.breadcrumbs(r,
+		Crumb{Label: app.translate(r, "nav.create"), URL: "/snippet/create"},
+		Crumb{Label: app.translate(r, "import.title")},
+	)
+	app.render(w, status, "import.tmpl", data)
+}
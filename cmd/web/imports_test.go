@@ -0,0 +1,148 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+// fakeFetcher is a snippetFetcher returning fixed content
+type fakeFetcher struct {
+	content string
+	err     error
+	fetched []importSource
+}
+
+func (f *fakeFetcher) Fetch(src importSource, maxSize int) (string, error) {
+	f.fetched = append(f.fetched, src)
+	if len(f.content) > maxSize {
+		return "", errImportTooLarge
+	}
+	return f.content, f.err
+}
+
+func TestParseImportURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		wantPage string
+		wantRaw  string
+	}{
+		{"Pastebin", "https://pastebin.com/AbCd1234", "https://pastebin.com/AbCd1234", "https://pastebin.com/raw/AbCd1234"},
+		{"Pastebin raw", "http://www.pastebin.com/raw/AbCd1234/", "https://pastebin.com/AbCd1234", "https://pastebin.com/raw/AbCd1234"},
+		{"GitLab personal", "https://gitlab.com/-/snippets/2021", "https://gitlab.com/-/snippets/2021", "https://gitlab.com/-/snippets/2021/raw"},
+		{"GitLab project", "https://gitlab.com/pond/sub/frogs/-/snippets/7/raw", "https://gitlab.com/pond/sub/frogs/-/snippets/7", "https://gitlab.com/pond/sub/frogs/-/snippets/7/raw"},
+		{"GitLab query", "https://gitlab.com/-/snippets/2021?ref=x#L1", "https://gitlab.com/-/snippets/2021", "https://gitlab.com/-/snippets/2021/raw"},
+		{"Other host", "https://example.com/AbCd1234", "", ""},
+		{"Lookalike host", "https://pastebin.com.example.com/AbCd1234", "", ""},
+		{"Port", "https://pastebin.com:8443/AbCd1234", "", ""},
+		{"User info", "https://evil@pastebin.com/AbCd1234", "", ""},
+		{"Scheme", "file:///etc/passwd", "", ""},
+		{"Bad Pastebin ID", "https://pastebin.com/u/alice", "", ""},
+		{"GitLab namespace only", "https://gitlab.com/pond/-/snippets/7", "", ""},
+		{"GitLab traversal", "https://gitlab.com/../admin/-/snippets/7", "", ""},
+		{"GitLab not a snippet", "https://gitlab.com/pond/frogs/-/issues/7", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := parseImportURL(tt.url)
+			if tt.wantPage == "" {
+				assert.ErrorIs(t, err, errImportURL)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, src.Page, tt.wantPage)
+			assert.Equal(t, src.Raw, tt.wantRaw)
+		})
+	}
+}
+
+func TestNormalizeImport(t *testing.T) {
+	assert.Equal(t, normalizeImport("\uFEFFline one\r\nline two\rline three\r\n\r\n  "), "line one\nline two\nline three")
+}
+
+func TestPublicAddressOnly(t *testing.T) {
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{"104.20.67.143:443", true},
+		{"[2606:4700::6812:438f]:443", true},
+		{"127.0.0.1:443", false},
+		{"10.0.0.8:443", false},
+		{"192.168.1.1:443", false},
+		{"169.254.169.254:80", false},
+		{"100.64.0.1:443", false},
+		{"0.0.0.0:443", false},
+		{"[::1]:443", false},
+		{"[fd00::1]:443", false},
+		{"[::ffff:127.0.0.1]:443", false},
+		{"not-an-address", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			err := publicAddressOnly("tcp", tt.address, nil)
+			assert.Equal(t, err == nil, tt.allowed)
+		})
+	}
+}
+
+func TestCheckImportRedirect(t *testing.T) {
+	redirect := func(target string) error {
+		req, err := http.NewRequest(http.MethodGet, target, nil)
+		assert.NilError(t, err)
+		return checkImportRedirect(req, make([]*http.Request, 1))
+	}
+	assert.NilError(t, redirect("https://gitlab.com/-/snippets/2021/raw/main/pond.go"))
+	assert.ErrorIs(t, redirect("http://gitlab.com/-/snippets/2021/raw"), errImportBlocked)
+	assert.ErrorIs(t, redirect("https://169.254.169.254/latest/meta-data"), errImportBlocked)
+}
+
+func TestSnippetImport(t *testing.T) {
+	app := newTestApplication(t)
+	fetcher := &fakeFetcher{content: "An old silent pond...\r\n"}
+	app.importer = fetcher
+	ts := testutil.NewServer(t, app.routes())
+
+	rs := ts.Get(t, "/snippet/import")
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/user/login")
+
+	ts.Login(t, "alice@example.com", "pa$$word")
+
+	rs = ts.Get(t, "/snippet/import")
+	assert.Equal(t, rs.Status, http.StatusOK)
+
+	rs = ts.Submit(t, "/snippet/import", "/snippet/import", url.Values{"url": {"https://pastebin.com/AbCd1234"}, "expires": {"7"}})
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/snippet/view/2")
+	assert.Equal(t, fetcher.fetched[0].Raw, "https://pastebin.com/raw/AbCd1234")
+
+	// Nothing is fetched for other URLs
+	rs = ts.Submit(t, "/snippet/import", "/snippet/import", url.Values{"url": {"http://169.254.169.254/latest"}, "expires": {"7"}})
+	assert.Equal(t, rs.Status, http.StatusUnprocessableEntity)
+	assert.StringContains(t, rs.Body, "This must be a link to a Pastebin paste or a GitLab snippet")
+	assert.Equal(t, len(fetcher.fetched), 1)
+
+	fetcher.err = errImportNotFound
+	rs = ts.Submit(t, "/snippet/import", "/snippet/import", url.Values{"url": {"https://gitlab.com/-/snippets/2021"}, "expires": {"7"}})
+	assert.Equal(t, rs.Status, http.StatusUnprocessableEntity)
+	assert.StringContains(t, rs.Body, "GitLab has no public snippet at this link")
+}
+
+func TestSnippetImportRateLimit(t *testing.T) {
+	app := newTestApplication(t)
+	app.importer = &fakeFetcher{err: errImportNotFound}
+	ts := testutil.NewServer(t, app.routes())
+	ts.Login(t, "alice@example.com", "pa$$word")
+
+	form := url.Values{"url": {"https://pastebin.com/AbCd1234"}, "expires": {"7"}}
+	for range importsPerMinute {
+		rs := ts.Submit(t, "/snippet/import", "/snippet/import", form)
+		assert.Equal(t, rs.Status, http.StatusUnprocessableEntity)
+	}
+	rs := ts.Submit(t, "/snippet/import", "/snippet/import", form)
+	assert.Equal(t, rs.Status, http.StatusTooManyRequests)
+	assert.Equal(t, rs.Header.Get("Retry-After") != "", true)
+}
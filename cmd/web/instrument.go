@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// =============================================================================
+// Route Instrumentation
+// =============================================================================
+// Requests are labelled with the pattern of the route that served them,
+// such as /snippet/view/:id, rather than their path, so metrics group every
+// snippet's views together instead of growing a series per snippet. The
+// labelledRouter records each route's pattern as it is matched.
+
+// unmatchedRoute labels requests that no route matched
+const unmatchedRoute = "unmatched"
+
+// requestDuration times requests by method and route pattern
+var requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "snippetbox",
+	Subsystem: "http",
+	Name:      "request_duration_seconds",
+	Help:      "Time taken to serve requests, by route pattern.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"method", "route"})
+
+// requestsTotal counts responses by method, route pattern and status
+var requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "snippetbox",
+	Subsystem: "http",
+	Name:      "requests_total",
+	Help:      "Requests served, by route pattern and response status.",
+}, []string{"method", "route", "status"})
+
+// sizeBuckets run from 256 bytes to 16 MB, the largest upload allowed
+var sizeBuckets = prometheus.ExponentialBuckets(256, 4, 9)
+
+// requestSize measures request bodies by method and route pattern, as
+// declared by their Content-Length
+var requestSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "snippetbox",
+	Subsystem: "http",
+	Name:      "request_size_bytes",
+	Help:      "Size of request bodies, by route pattern.",
+	Buckets:   sizeBuckets,
+}, []string{"method", "route"})
+
+// responseSize measures response bodies by method and route pattern
+var responseSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "snippetbox",
+	Subsystem: "http",
+	Name:      "response_size_bytes",
+	Help:      "Size of response bodies, by route pattern.",
+	Buckets:   sizeBuckets,
+}, []string{"method", "route"})
+
+// serverErrorsTotal counts responses sent by serverError by route pattern,
+// for alerting on failures without scraping the logs
+var serverErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "snippetbox",
+	Subsystem: "http",
+	Name:      "server_errors_total",
+	Help:      "Requests that failed with a server error, by route pattern.",
+}, []string{"route"})
+
+// panicsTotal counts panics recoverPanic recovered by route pattern
+var panicsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "snippetbox",
+	Subsystem: "http",
+	Name:      "panics_total",
+	Help:      "Panics recovered while serving requests, by route pattern.",
+}, []string{"route"})
+
+// dbTimeoutsTotal counts server errors caused by the request's database
+// work running out of time (see requestDeadline) by route pattern
+var dbTimeoutsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "snippetbox",
+	Subsystem: "db",
+	Name:      "timeouts_total",
+	Help:      "Requests whose database work timed out, by route pattern.",
+}, []string{"route"})
+
+// failedLoginsTotal counts refused password and single sign-on logins by
+// route pattern
+var failedLoginsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "snippetbox",
+	Subsystem: "auth",
+	Name:      "failed_logins_total",
+	Help:      "Login attempts refused, by route pattern.",
+}, []string{"route"})
+
+// routeLabel is filled in with the pattern of the route serving a request
+// once the router has matched it
+type routeLabel struct {
+	pattern string
+}
+
+// routePattern returns the pattern of the route serving a request, or
+// unmatchedRoute. It is only known once the router has run, so middleware
+// reads it after calling the next handler.
+func routePattern(r *http.Request) string {
+	if label, ok := r.Context().Value(routeContextKey).(*routeLabel); ok && label.pattern != "" {
+		return label.pattern
+	}
+	return unmatchedRoute
+}
+
+// instrument adds the routeLabel to each request's context and wraps the
+// response in the shared responseWriter, then records the request's
+// duration, status and sizes under its route pattern, and whether it
+// failed with a server error
+func (app *application) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := wrapResponse(w)
+		r = r.WithContext(context.WithValue(r.Context(), routeContextKey, &routeLabel{}))
+
+		next.ServeHTTP(rw, r)
+
+		method, route := methodLabel(r.Method), routePattern(r)
+		requestDuration.WithLabelValues(method, route).Observe(rw.Duration().Seconds())
+		requestsTotal.WithLabelValues(method, route, strconv.Itoa(rw.Status())).Inc()
+		responseSize.WithLabelValues(method, route).Observe(float64(rw.Written()))
+		if r.ContentLength > 0 {
+			requestSize.WithLabelValues(method, route).Observe(float64(r.ContentLength))
+		}
+		if rw.serverError {
+			serverErrorsTotal.WithLabelValues(route).Inc()
+		}
+		if rw.dbTimeout {
+			dbTimeoutsTotal.WithLabelValues(route).Inc()
+		}
+	})
+}
+
+// methodLabel returns the method to label a request with. Made-up methods
+// are lumped together, as they would otherwise add a series each.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	default:
+		return "other"
+	}
+}
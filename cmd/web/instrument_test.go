@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestRoutePattern(t *testing.T) {
+	app := newTestApplication(t)
+
+	router := newRouter()
+	router.HandlerFunc(http.MethodGet, "/snippet/view/:id", func(w http.ResponseWriter, r *http.Request) {})
+	router.Handler(http.MethodPost, "/snippet/edit/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	var got string
+	h := app.instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		router.ServeHTTP(w, r)
+		got = routePattern(r)
+	}))
+
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{http.MethodGet, "/snippet/view/1", "/snippet/view/:id"},
+		{http.MethodGet, "/snippet/view/2?plain=true", "/snippet/view/:id"},
+		{http.MethodPost, "/snippet/edit/2", "/snippet/edit/:id"},
+		{http.MethodGet, "/snippet/nope", unmatchedRoute},
+		{http.MethodPut, "/snippet/view/1", unmatchedRoute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, nil))
+			assert.Equal(t, got, tt.want)
+		})
+	}
+
+	// Outside instrument, there is nowhere to record the pattern
+	r := httptest.NewRequest(http.MethodGet, "/snippet/view/1", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, routePattern(r), unmatchedRoute)
+}
+
+func TestMethodLabel(t *testing.T) {
+	assert.Equal(t, methodLabel(http.MethodGet), "GET")
+	assert.Equal(t, methodLabel(http.MethodDelete), "DELETE")
+	assert.Equal(t, methodLabel("BREW"), "other")
+}
+
+func TestErrorCounters(t *testing.T) {
+	app := newTestApplication(t)
+
+	router := newRouter()
+	router.HandlerFunc(http.MethodGet, "/fail/:id", func(w http.ResponseWriter, r *http.Request) {
+		app.serverError(w, fmt.Errorf("broken"))
+	})
+	router.HandlerFunc(http.MethodGet, "/slow/:id", func(w http.ResponseWriter, r *http.Request) {
+		app.serverError(w, fmt.Errorf("query: %w", context.DeadlineExceeded))
+	})
+	router.HandlerFunc(http.MethodGet, "/panic/:id", func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	})
+	// The session manager wraps the writer serverError is given
+	h := app.instrument(app.recoverPanic(app.sessionManager.LoadAndSave(router)))
+
+	tests := []struct {
+		path                     string
+		route                    string
+		errors, timeouts, panics float64
+	}{
+		{"/fail/1", "/fail/:id", 1, 0, 0},
+		{"/slow/1", "/slow/:id", 1, 1, 0},
+		{"/panic/1", "/panic/:id", 1, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			errors := serverErrorsTotal.WithLabelValues(tt.route)
+			timeouts := dbTimeoutsTotal.WithLabelValues(tt.route)
+			panics := panicsTotal.WithLabelValues(tt.route)
+			before := []float64{promtest.ToFloat64(errors), promtest.ToFloat64(timeouts), promtest.ToFloat64(panics)}
+
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			assert.Equal(t, promtest.ToFloat64(errors), before[0]+tt.errors)
+			assert.Equal(t, promtest.ToFloat64(timeouts), before[1]+tt.timeouts)
+			assert.Equal(t, promtest.ToFloat64(panics), before[2]+tt.panics)
+		})
+	}
+
+	t.Run("Failed login", func(t *testing.T) {
+		failed := failedLoginsTotal.WithLabelValues("/user/login")
+		before := promtest.ToFloat64(failed)
+
+		ts := testutil.NewServer(t, app.routes())
+		ts.Submit(t, "/user/login", "/user/login", url.Values{"email": {"alice@example.com"}, "password": {"wrong"}})
+		assert.Equal(t, promtest.ToFloat64(failed), before+1)
+
+		ts.Login(t, "alice@example.com", "pa$$word")
+		assert.Equal(t, promtest.ToFloat64(failed), before+1)
+	})
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"adotkaya.playground/internal/mailer"
+	"adotkaya.playground/internal/models"
+)
+
+// =============================================================================
+// Background Job Worker
+// =============================================================================
+
+// jobHandler performs one job given its JSON payload. Returning an error
+// wrapped with permanent() fails the job without further retries.
+type jobHandler func(payload []byte) error
+
+// progressFunc records that a job has done done of total units of work
+type progressFunc func(done, total int)
+
+// trackedJobHandler is a jobHandler for long jobs, reporting their progress
+// as they go
+type trackedJobHandler func(payload []byte, progress progressFunc) error
+
+// permanentError marks a job error that retrying cannot fix
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// permanent wraps err so the worker fails the job instead of retrying it
+func permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// jobWorker claims jobs from the queue one at a time and runs the handler
+// registered for their kind, retrying failures with exponential backoff
+type jobWorker struct {
+	jobs     models.JobModelInterface
+	handlers map[string]trackedJobHandler
+	interval time.Duration // How long to sleep when the queue is empty
+	logger   *slog.Logger
+}
+
+// newJobWorker creates a worker polling jobs every interval when idle
+func newJobWorker(jobs models.JobModelInterface, interval time.Duration, logger *slog.Logger) *jobWorker {
+	return &jobWorker{
+		jobs:     jobs,
+		handlers: make(map[string]trackedJobHandler),
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// handle registers the handler for a job kind
+func (w *jobWorker) handle(kind string, h jobHandler) {
+	w.handlers[kind] = func(payload []byte, _ progressFunc) error { return h(payload) }
+}
+
+// handleTracked registers a handler reporting its progress for a job kind
+func (w *jobWorker) handleTracked(kind string, h trackedJobHandler) {
+	w.handlers[kind] = h
+}
+
+// run processes jobs until ctx is cancelled, sleeping for the interval
+// whenever the queue is empty
+func (w *jobWorker) run(ctx context.Context) {
+	for {
+		for w.processNext() {
+			if ctx.Err() != nil {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(w.interval):
+		}
+	}
+}
+
+// processNext claims and runs one job, recording the outcome. It reports
+// whether a job was claimed.
+func (w *jobWorker) processNext() bool {
+	job, err := w.jobs.Claim()
+	if err != nil {
+		if !errors.Is(err, models.ErrNoRecord) {
+			w.logger.Error("claiming job", "error", err)
+		}
+		return false
+	}
+
+	err = w.runHandler(job)
+
+	switch {
+	case err == nil:
+		err = w.jobs.Complete(job.ID)
+	case errors.As(err, new(permanentError)) || job.Attempts >= job.MaxAttempts:
+		w.logger.Error("job failed", "job_id", job.ID, "kind", job.Kind, "attempts", job.Attempts, "error", err)
+		err = w.jobs.Fail(job.ID, err.Error())
+	default:
+		err = w.jobs.Retry(job.ID, backoff(job.Attempts), err.Error())
+	}
+	if err != nil {
+		w.logger.Error("recording job result", "job_id", job.ID, "error", err)
+	}
+
+	return true
+}
+
+// runHandler runs the handler for job, turning panics and unknown kinds
+// into permanent errors
+func (w *jobWorker) runHandler(job *models.Job) (err error) {
+	h, ok := w.handlers[job.Kind]
+	if !ok {
+		return permanent(fmt.Errorf("no handler for job kind %q", job.Kind))
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = permanent(fmt.Errorf("panic: %v", r))
+		}
+	}()
+
+	// Progress is only for show, so failing to record it doesn't stop the
+	// job
+	progress := func(done, total int) {
+		if err := w.jobs.Progress(job.ID, done, total); err != nil {
+			w.logger.Error("recording job progress", "job_id", job.ID, "error", err)
+		}
+	}
+
+	return h(job.Payload, progress)
+}
+
+// backoff returns the delay before retrying a job that has failed attempts
+// times: 30s, 1m, 2m, 4m... capped at one hour
+func backoff(attempts int) time.Duration {
+	const base, limit = 30 * time.Second, time.Hour
+
+	d := base
+	for i := 1; i < attempts && d < limit; i++ {
+		d *= 2
+	}
+	return min(d, limit)
+}
+
+// =============================================================================
+// Email Jobs
+// =============================================================================
+
+// emailJobKind is the job kind for outgoing emails
+const emailJobKind = "email"
+
+// emailMaxAttempts is how many times an email is tried before giving up
+const emailMaxAttempts = 5
+
+// emailJob is the payload of an email job
+type emailJob struct {
+	Recipient string         `json:"recipient"`
+	Template  string         `json:"template"`
+	Data      map[string]any `json:"data"`
+}
+
+// sendMail queues an email to be sent by the job worker, so a slow or
+// failing SMTP server never holds up the request
+func (app *application) sendMail(recipient, templateFile string, data map[string]any) error {
+	_, err := app.jobs.Enqueue(emailJobKind, emailJob{
+		Recipient: recipient,
+		Template:  templateFile,
+		Data:      data,
+	}, emailMaxAttempts)
+	return err
+}
+
+// sendMailJob is the job handler delivering queued emails. Bounces and
+// unrenderable messages fail immediately; other errors are retried.
+func (app *application) sendMailJob(payload []byte) error {
+	var job emailJob
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return permanent(err)
+	}
+
+	err := app.mailer.Send(job.Recipient, job.Template, job.Data)
+	if err != nil && mailer.IsPermanent(err) {
+		return permanent(err)
+	}
+	return err
+}
+
+// emailDelivery is an email job decoded for display on the admin page
+type emailDelivery struct {
+	*models.Job
+	Recipient string
+	Template  string
+}
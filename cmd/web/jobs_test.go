@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/models"
+)
+
+// fakeJobs is an in-memory job queue holding a single job and recording
+// what the worker did with it
+type fakeJobs struct {
+	job      *models.Job
+	outcome  string
+	delay    time.Duration
+	errMsg   string
+	enqueued []any
+	done     int
+	total    int
+}
+
+func (f *fakeJobs) Enqueue(kind string, payload any, maxAttempts int) (int, error) {
+	f.enqueued = append(f.enqueued, payload)
+	return len(f.enqueued), nil
+}
+func (f *fakeJobs) Claim() (*models.Job, error) {
+	if f.job == nil || f.outcome != "" {
+		return nil, models.ErrNoRecord
+	}
+	f.job.Attempts++
+	return f.job, nil
+}
+func (f *fakeJobs) Complete(id int) error {
+	f.outcome = models.JobDone
+	return nil
+}
+func (f *fakeJobs) Retry(id int, delay time.Duration, errMsg string) error {
+	f.outcome, f.delay, f.errMsg = models.JobPending, delay, errMsg
+	return nil
+}
+func (f *fakeJobs) Fail(id int, errMsg string) error {
+	f.outcome, f.errMsg = models.JobFailed, errMsg
+	return nil
+}
+func (f *fakeJobs) Progress(id, done, total int) error {
+	f.done, f.total = done, total
+	return nil
+}
+func (f *fakeJobs) Recent(kind string, limit int) ([]*models.Job, error) {
+	return nil, nil
+}
+
+func TestJobWorker(t *testing.T) {
+	tests := []struct {
+		name        string
+		kind        string
+		attempts    int // Attempts made before this one
+		handlerErr  error
+		wantOutcome string
+		wantDelay   time.Duration
+	}{
+		{
+			name:        "Success",
+			kind:        "test",
+			wantOutcome: models.JobDone,
+		},
+		{
+			name:        "Temporary error",
+			kind:        "test",
+			attempts:    1,
+			handlerErr:  errors.New("connection refused"),
+			wantOutcome: models.JobPending,
+			wantDelay:   time.Minute,
+		},
+		{
+			name:        "Permanent error",
+			kind:        "test",
+			handlerErr:  permanent(errors.New("bad payload")),
+			wantOutcome: models.JobFailed,
+		},
+		{
+			name:        "Out of attempts",
+			kind:        "test",
+			attempts:    2,
+			handlerErr:  errors.New("connection refused"),
+			wantOutcome: models.JobFailed,
+		},
+		{
+			name:        "Unknown kind",
+			kind:        "unknown",
+			wantOutcome: models.JobFailed,
+		},
+		{
+			name:        "Panic",
+			kind:        "panic",
+			wantOutcome: models.JobFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs := &fakeJobs{job: &models.Job{ID: 1, Kind: tt.kind, Attempts: tt.attempts, MaxAttempts: 3}}
+
+			w := newJobWorker(jobs, time.Second, slog.New(slog.DiscardHandler))
+			w.handle("test", func(payload []byte) error { return tt.handlerErr })
+			w.handle("panic", func(payload []byte) error { panic("boom") })
+
+			assert.Equal(t, w.processNext(), true)
+			assert.Equal(t, jobs.outcome, tt.wantOutcome)
+			assert.Equal(t, jobs.delay, tt.wantDelay)
+			if tt.handlerErr != nil {
+				assert.Equal(t, jobs.errMsg, tt.handlerErr.Error())
+			}
+
+			// The queue is now empty
+			assert.Equal(t, w.processNext(), false)
+		})
+	}
+}
+
+func TestJobWorkerProgress(t *testing.T) {
+	jobs := &fakeJobs{job: &models.Job{ID: 1, Kind: "tracked", MaxAttempts: 3}}
+
+	w := newJobWorker(jobs, time.Second, slog.New(slog.DiscardHandler))
+	w.handleTracked("tracked", func(payload []byte, progress progressFunc) error {
+		progress(1, 2)
+		progress(2, 2)
+		return nil
+	})
+
+	assert.Equal(t, w.processNext(), true)
+	assert.Equal(t, jobs.outcome, models.JobDone)
+	assert.Equal(t, jobs.done, 2)
+	assert.Equal(t, jobs.total, 2)
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{7, 32 * time.Minute},
+		{8, time.Hour},
+		{50, time.Hour},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, backoff(tt.attempts), tt.want)
+	}
+}
+
+// fakeMailer returns a fixed error from Send
+type fakeMailer struct{ err error }
+
+func (m fakeMailer) Send(recipient, templateFile string, data any) error { return m.err }
+
+func TestSendMailJob(t *testing.T) {
+	payload := []byte(`{"recipient":"bob@example.com","template":"user_welcome.tmpl","data":{"Name":"Bob"}}`)
+
+	tests := []struct {
+		name          string
+		payload       []byte
+		sendErr       error
+		wantErr       bool
+		wantPermanent bool
+	}{
+		{"Sent", payload, nil, false, false},
+		{"Greylisted", payload, &textproto.Error{Code: 451}, true, false},
+		{"Bounced", payload, &textproto.Error{Code: 550}, true, true},
+		{"Bad payload", []byte(`{`), nil, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &application{mailer: fakeMailer{err: tt.sendErr}}
+
+			err := app.sendMailJob(tt.payload)
+			assert.Equal(t, err != nil, tt.wantErr)
+			assert.Equal(t, errors.As(err, new(permanentError)), tt.wantPermanent)
+		})
+	}
+}
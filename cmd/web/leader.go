@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// =============================================================================
+// Leader Election
+// =============================================================================
+// Every instance runs the scheduler, but scheduled tasks must only run once
+// per occurrence, not once per instance: otherwise each replica would queue
+// its own weekly digest. The instances elect a leader by racing for a
+// Postgres advisory lock, and only the leader runs scheduled tasks. The
+// lock goes with the leader's connection, so if it dies another instance
+// takes over within leaderCheckInterval.
+
+// schedulerLockKey is the advisory lock key held by the instance running
+// scheduled tasks
+const schedulerLockKey = 7_318_004_211
+
+// leaderCheckInterval is how often followers try to become the leader, and
+// the leader checks it still is
+const leaderCheckInterval = 15 * time.Second
+
+// sessionLock is an advisory lock held for a session, as implemented by
+// models.AdvisoryLock
+type sessionLock interface {
+	TryAcquire() (bool, error)
+	Check() error
+	Release() error
+}
+
+// leaderElection keeps trying to take a sessionLock, and knows whether
+// this instance holds it
+type leaderElection struct {
+	lock    sessionLock
+	leading atomic.Bool
+	logger  *slog.Logger
+}
+
+// newLeaderElection creates an election for lock. Nobody leads until run
+// has taken it.
+func newLeaderElection(lock sessionLock, logger *slog.Logger) *leaderElection {
+	return &leaderElection{lock: lock, logger: logger}
+}
+
+// isLeader reports whether this instance is the leader
+func (e *leaderElection) isLeader() bool {
+	return e.leading.Load()
+}
+
+// run campaigns for the lock every leaderCheckInterval until ctx is
+// cancelled, then steps down
+func (e *leaderElection) run(ctx context.Context) {
+	ticker := time.NewTicker(leaderCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		e.campaign()
+
+		select {
+		case <-ctx.Done():
+			e.leading.Store(false)
+			if err := e.lock.Release(); err != nil {
+				e.logger.Error("leader: releasing lock", "error", err)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// campaign makes sure the leader still holds the lock, or tries to take it
+// if nobody does
+func (e *leaderElection) campaign() {
+	if e.leading.Load() {
+		if err := e.lock.Check(); err != nil {
+			e.leading.Store(false)
+			e.logger.Error("leader: no longer leading", "error", err)
+		}
+		return
+	}
+
+	acquired, err := e.lock.TryAcquire()
+	if err != nil {
+		e.logger.Error("leader: taking lock", "error", err)
+		return
+	}
+	if acquired {
+		e.leading.Store(true)
+		e.logger.Info("leader: this instance now runs scheduled tasks")
+	}
+}
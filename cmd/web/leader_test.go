@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/models"
+)
+
+// fakeLock is a sessionLock that another instance may be holding
+type fakeLock struct {
+	heldElsewhere bool
+	held          bool
+	lost          bool // The held lock's connection has failed
+	err           error
+}
+
+func (l *fakeLock) TryAcquire() (bool, error) {
+	if l.err != nil {
+		return false, l.err
+	}
+	if !l.heldElsewhere {
+		l.held, l.lost = true, false
+	}
+	return l.held, nil
+}
+func (l *fakeLock) Check() error {
+	if !l.held || l.lost {
+		l.held = false
+		return models.ErrLockLost
+	}
+	return nil
+}
+func (l *fakeLock) Release() error {
+	l.held = false
+	return nil
+}
+
+func TestLeaderElection(t *testing.T) {
+	logger := slog.New(slog.DiscardHandler)
+	lock := &fakeLock{heldElsewhere: true}
+	e := newLeaderElection(lock, logger)
+
+	// Following while another instance leads
+	e.campaign()
+	assert.Equal(t, e.isLeader(), false)
+
+	// Errors taking the lock leave this instance following
+	lock.heldElsewhere, lock.err = false, errors.New("connection refused")
+	e.campaign()
+	assert.Equal(t, e.isLeader(), false)
+
+	// Taking over once the leader has gone
+	lock.err = nil
+	e.campaign()
+	assert.Equal(t, e.isLeader(), true)
+	e.campaign()
+	assert.Equal(t, e.isLeader(), true)
+
+	// Losing the connection steps down until the lock is taken again
+	lock.lost, lock.heldElsewhere = true, true
+	e.campaign()
+	assert.Equal(t, e.isLeader(), false)
+	e.campaign()
+	assert.Equal(t, e.isLeader(), false)
+
+	lock.heldElsewhere = false
+	e.campaign()
+	assert.Equal(t, e.isLeader(), true)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// =============================================================================
+// External Links
+// =============================================================================
+// Links to other sites in rendered markdown are marked as user-generated,
+// so search engines don't credit pastes used as link farms, and with
+// LINK_INTERSTITIAL on (the default) they go through /leaving, which shows
+// where the link really goes before following it. /leaving never redirects
+// by itself, so it can't be used to disguise a phishing link as one of ours.
+
+// externalRel is the rel attribute of links to other sites
+const externalRel = "noopener nofollow ugc"
+
+// interstitialKey holds whether markdown being converted should send
+// external links through /leaving
+var interstitialKey = parser.NewContextKey()
+
+// externalLinks is the markdown transformer marking links to other sites
+// and, when asked, pointing them at /leaving
+type externalLinks struct{}
+
+// Transform marks the external links of doc, replacing bare URLs made links
+// by the linkify extension with ordinary links so they can be rewritten
+func (externalLinks) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	interstitial, _ := pc.Get(interstitialKey).(bool)
+	source := reader.Source()
+
+	var autolinks []*ast.AutoLink
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Link:
+			if target, ok := externalURL(string(n.Destination)); ok {
+				n.SetAttributeString("rel", externalRel)
+				if interstitial {
+					n.Destination = []byte(leavingPath(target))
+				}
+			}
+		case *ast.AutoLink:
+			if _, ok := externalURL(string(n.URL(source))); ok && n.AutoLinkType == ast.AutoLinkURL {
+				autolinks = append(autolinks, n)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, a := range autolinks {
+		target, _ := externalURL(string(a.URL(source)))
+		link := ast.NewLink()
+		link.Destination = []byte(target.String())
+		if interstitial {
+			link.Destination = []byte(leavingPath(target))
+		}
+		link.SetAttributeString("rel", externalRel)
+		link.AppendChild(link, ast.NewString(a.Label(source)))
+		a.Parent().ReplaceChild(a.Parent(), a, link)
+	}
+}
+
+// externalLinksTransformer runs externalLinks after goldmark's own
+// transformers
+var externalLinksTransformer = util.Prioritized(externalLinks{}, 999)
+
+// externalURL parses raw as a link to another site: an absolute http or
+// https URL, or a scheme-relative one, taken as https
+func externalURL(raw string) (*url.URL, bool) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return nil, false
+	}
+	switch u.Scheme {
+	case "":
+		u.Scheme = "https"
+	case "http", "https":
+	default:
+		return nil, false
+	}
+	return u, true
+}
+
+// leavingPath returns the link to the /leaving page for target
+func leavingPath(target *url.URL) string {
+	return "/leaving?url=" + url.QueryEscape(target.String())
+}
+
+// leaving shows the site the url query parameter links to, with a link to
+// carry on there. Anything but a link to another site is refused.
+func (app *application) leaving(w http.ResponseWriter, r *http.Request) {
+	target, ok := externalURL(r.URL.Query().Get("url"))
+	if !ok {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// Keep the page out of search engines, so links to it pass on nothing
+	w.Header().Set("X-Robots-Tag", "noindex")
+
+	data := app.newTemplateData(r)
+	data.Leaving = target
+	app.render(w, http.StatusOK, "leaving.tmpl", data)
+}
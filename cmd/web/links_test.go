@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestMarkdownExternalLinks(t *testing.T) {
+	source := "[a](https://evil.example/x?y=1) [b](/snippet/view/1) www.example.org/p [m](mailto:a@b.c)"
+
+	got := string(markdown(source, false))
+	assert.StringContains(t, got, `<a href="https://evil.example/x?y=1" rel="noopener nofollow ugc">a</a>`)
+	assert.StringContains(t, got, `<a href="http://www.example.org/p" rel="noopener nofollow ugc">www.example.org/p</a>`)
+	assert.StringContains(t, got, `<a href="/snippet/view/1" rel="nofollow">b</a>`)
+	assert.StringContains(t, got, `<a href="mailto:a@b.c" rel="nofollow">m</a>`)
+
+	got = string(markdown(source, true))
+	assert.StringContains(t, got, `<a href="/leaving?url=https%3A%2F%2Fevil.example%2Fx%3Fy%3D1" rel="noopener nofollow ugc">a</a>`)
+	assert.StringContains(t, got, `<a href="/leaving?url=http%3A%2F%2Fwww.example.org%2Fp" rel="noopener nofollow ugc">www.example.org/p</a>`)
+	assert.StringContains(t, got, `<a href="/snippet/view/1" rel="nofollow">b</a>`)
+
+	// Users can't write their own rel attributes
+	got = string(markdown(`<a href="https://evil.example" rel="opener">x</a> [y](https://evil.example)`, true))
+	assert.Equal(t, got, "<p>x <a href=\"/leaving?url=https%3A%2F%2Fevil.example\" rel=\"noopener nofollow ugc\">y</a></p>\n")
+}
+
+func TestLeaving(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+
+	rs := ts.Get(t, "/leaving?url="+url.QueryEscape("https://evil.example/login?next=1"))
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.Equal(t, rs.Header.Get("X-Robots-Tag"), "noindex")
+	assert.Equal(t, rs.Header.Get("Location"), "")
+	assert.StringContains(t, rs.Body, "goes to evil.example.")
+	assert.StringContains(t, rs.Body, `<a href="https://evil.example/login?next=1" rel="noopener noreferrer nofollow ugc">`)
+
+	// Only links to other sites are shown
+	for _, target := range []string{"", "/user/login", "javascript:alert(1)", "data:text/html,hi", "mailto:a@b.c"} {
+		rs = ts.Get(t, "/leaving?url="+url.QueryEscape(target))
+		assert.Equal(t, rs.Status, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// =============================================================================
+// Load Test Subcommand
+// =============================================================================
+
+// loadtestResult is what a single request observed
+type loadtestResult struct {
+	latency time.Duration
+	status  int // 0 when the request failed outright
+}
+
+// runLoadtest implements `web loadtest`: it sends GET requests for the given
+// paths from several concurrent workers against a running instance for a fixed
+// duration, then prints throughput, status codes and latency percentiles.
+// It returns the process exit code.
+func runLoadtest(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("loadtest", flag.ContinueOnError)
+	fs.SetOutput(out)
+	baseURL := fs.String("url", "https://localhost:4000", "Base URL of the running instance")
+	paths := fs.String("paths", "/,/snippet/view/1", "Comma-separated paths to request in turn")
+	concurrency := fs.Int("c", 10, "Number of concurrent workers")
+	duration := fs.Duration("d", 10*time.Second, "How long to run")
+	insecure := fs.Bool("insecure", true, "Skip TLS certificate verification (for the self-signed dev certificate)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	targets := []string{}
+	for _, p := range strings.Split(*paths, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			targets = append(targets, strings.TrimRight(*baseURL, "/")+p)
+		}
+	}
+	if len(targets) == 0 || *concurrency < 1 {
+		fmt.Fprintln(out, "loadtest: need at least one path and one worker")
+		return 2
+	}
+
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig:     &tls.Config{InsecureSkipVerify: *insecure},
+			MaxIdleConnsPerHost: *concurrency,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	fmt.Fprintf(out, "Load testing %s for %s with %d workers\n", *baseURL, *duration, *concurrency)
+
+	deadline := time.Now().Add(*duration)
+	results := make([][]loadtestResult, *concurrency)
+
+	var wg sync.WaitGroup
+	for w := range *concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := w; time.Now().Before(deadline); i++ {
+				results[w] = append(results[w], loadtestRequest(client, targets[i%len(targets)]))
+			}
+		}()
+	}
+	wg.Wait()
+
+	all := []loadtestResult{}
+	for _, r := range results {
+		all = append(all, r...)
+	}
+	loadtestReport(out, all, *duration)
+
+	return 0
+}
+
+// loadtestRequest performs one GET, draining the body so the connection can
+// be reused
+func loadtestRequest(client *http.Client, url string) loadtestResult {
+	start := time.Now()
+
+	rs, err := client.Get(url)
+	if err != nil {
+		return loadtestResult{latency: time.Since(start)}
+	}
+	io.Copy(io.Discard, rs.Body)
+	rs.Body.Close()
+
+	return loadtestResult{latency: time.Since(start), status: rs.StatusCode}
+}
+
+// loadtestReport prints a summary of the results
+func loadtestReport(out io.Writer, results []loadtestResult, elapsed time.Duration) {
+	if len(results) == 0 {
+		fmt.Fprintln(out, "No requests completed")
+		return
+	}
+
+	latencies := make([]time.Duration, len(results))
+	statuses := map[int]int{}
+	for i, r := range results {
+		latencies[i] = r.latency
+		statuses[r.status]++
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	fmt.Fprintf(out, "Requests:   %d (%.1f/s)\n", len(results), float64(len(results))/elapsed.Seconds())
+
+	codes := make([]int, 0, len(statuses))
+	for code := range statuses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		label := fmt.Sprint(code)
+		if code == 0 {
+			label = "error"
+		}
+		fmt.Fprintf(out, "  %-8s %d\n", label+":", statuses[code])
+	}
+
+	fmt.Fprintf(out, "Latency:    p50 %s  p90 %s  p99 %s  max %s\n",
+		percentile(latencies, 50), percentile(latencies, 90),
+		percentile(latencies, 99), latencies[len(latencies)-1])
+}
+
+// percentile returns the p-th percentile (nearest-rank) of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	rank = max(0, min(rank, len(sorted)-1))
+	return sorted[rank]
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestPercentile(t *testing.T) {
+	sorted := []time.Duration{}
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+
+	tests := []struct {
+		name   string
+		sorted []time.Duration
+		p      float64
+		want   time.Duration
+	}{
+		{"p50", sorted, 50, 50 * time.Millisecond},
+		{"p99", sorted, 99, 99 * time.Millisecond},
+		{"p100", sorted, 100, 100 * time.Millisecond},
+		{"p0", sorted, 0, 1 * time.Millisecond},
+		{"Single", sorted[:1], 90, 1 * time.Millisecond},
+		{"Empty", nil, 50, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, percentile(tt.sorted, tt.p), tt.want)
+		})
+	}
+}
+
+func TestRunLoadtest(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+
+	var out bytes.Buffer
+	code := runLoadtest([]string{"-url", ts.URL, "-paths", "/ping,/missing", "-c", "2", "-d", "100ms"}, &out)
+
+	assert.Equal(t, code, 0)
+	assert.StringContains(t, out.String(), "200:")
+	assert.StringContains(t, out.String(), "404:")
+	assert.StringContains(t, out.String(), "Latency:    p50")
+}
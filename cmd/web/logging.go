@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"adotkaya.playground/internal/models"
+)
+
+// =============================================================================
+// Log Level and Debug Sampling
+// =============================================================================
+// Logs are written with log/slog as lines of key=value pairs, those logged
+// for a request carrying its ID. The log level and the share of requests
+// logged at debug level can be changed while the server runs, to look into
+// a problem in production without redeploying: from LOG_LEVEL and
+// LOG_DEBUG_SAMPLE at startup, from the .env file again on SIGHUP, or from
+// /admin/logging. Changes apply to the instance they're made on only, and
+// last until it restarts.
+
+// logLevelNames are the levels LOG_LEVEL and the admin page accept
+var logLevelNames = []string{"debug", "info", "warn", "error"}
+
+// logSettings holds the log level and debug sampling rate in force
+type logSettings struct {
+	level  slog.LevelVar
+	sample atomic.Int32 // Percent of requests logged at debug level
+}
+
+// newLogSettings returns settings logging at level, with sample percent of
+// requests logged at debug level
+func newLogSettings(level slog.Level, sample int) *logSettings {
+	s := &logSettings{}
+	s.set(level, sample)
+	return s
+}
+
+// set changes the level and sampling rate
+func (s *logSettings) set(level slog.Level, sample int) {
+	s.level.Set(level)
+	s.sample.Store(int32(sample))
+}
+
+// Level returns the level in force
+func (s *logSettings) Level() slog.Level {
+	return s.level.Level()
+}
+
+// Sample returns the percent of requests logged at debug level
+func (s *logSettings) Sample() int {
+	return int(s.sample.Load())
+}
+
+// debug reports whether debug lines are logged for requests with ctx,
+// either for all requests or because this one was picked by sampling
+func (s *logSettings) debug(ctx context.Context) bool {
+	if s.Level() <= slog.LevelDebug {
+		return true
+	}
+	sampled, _ := ctx.Value(debugSampleContextKey).(bool)
+	return sampled
+}
+
+// reload applies LOG_LEVEL and LOG_DEBUG_SAMPLE from env, as read from the
+// .env file on SIGHUP. Either may be left out to keep its current value.
+func (s *logSettings) reload(env map[string]string) error {
+	level, sample := s.Level(), s.Sample()
+	var err error
+	if v, ok := env["LOG_LEVEL"]; ok {
+		if level, err = parseLogLevel(v); err != nil {
+			return fmt.Errorf("LOG_LEVEL: %w", err)
+		}
+	}
+	if v, ok := env["LOG_DEBUG_SAMPLE"]; ok {
+		if sample, err = parseLogSample(v); err != nil {
+			return fmt.Errorf("LOG_DEBUG_SAMPLE: %w", err)
+		}
+	}
+	s.set(level, sample)
+	return nil
+}
+
+// parseLogLevel parses one of logLevelNames
+func parseLogLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !slices.Contains(logLevelNames, name) {
+		return level, fmt.Errorf("must be one of %s; got %q", strings.Join(logLevelNames, ", "), name)
+	}
+	err := level.UnmarshalText([]byte(name))
+	return level, err
+}
+
+// parseLogSample parses a percentage of requests from 0 to 100
+func parseLogSample(s string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || n < 0 || n > 100 {
+		return 0, fmt.Errorf("must be a percentage from 0 to 100; got %q", s)
+	}
+	return n, nil
+}
+
+// levelName returns level's name as in logLevelNames
+func levelName(level slog.Level) string {
+	return strings.ToLower(level.String())
+}
+
+// leveledHandler passes on the records at or above the settings' level, and
+// debug records for requests picked by sampling. Records logged with the
+// context of a request are stamped with its ID.
+type leveledHandler struct {
+	slog.Handler
+	settings *logSettings
+}
+
+// newLogger returns a logger writing lines of key=value pairs to w, at the
+// level and sampling rate in settings
+func newLogger(w io.Writer, settings *logSettings) *slog.Logger {
+	text := slog.NewTextHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug})
+	return slog.New(leveledHandler{text, settings})
+}
+
+func (h leveledHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.settings.Level() || (level >= slog.LevelDebug && h.settings.debug(ctx))
+}
+
+func (h leveledHandler) Handle(ctx context.Context, rec slog.Record) error {
+	if id, ok := ctx.Value(requestIDContextKey).(string); ok {
+		rec.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, rec)
+}
+
+func (h leveledHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return leveledHandler{h.Handler.WithAttrs(attrs), h.settings}
+}
+
+func (h leveledHandler) WithGroup(name string) slog.Handler {
+	return leveledHandler{h.Handler.WithGroup(name), h.settings}
+}
+
+// sampleDebug picks the request for debug logging, with the chance set by
+// the sampling rate, and returns it with the choice in its context
+func (s *logSettings) sampleDebug(r *http.Request) *http.Request {
+	n := s.Sample()
+	if n == 0 || rand.IntN(100) >= n {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), debugSampleContextKey, true))
+}
+
+// debugHeaders returns r's headers as a group for a debug line, leaving
+// out the values of those carrying credentials
+func debugHeaders(h http.Header) slog.Attr {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	attrs := make([]any, 0, len(names))
+	for _, name := range names {
+		value := strings.Join(h[name], ", ")
+		switch name {
+		case "Authorization", "Cookie", "X-Csrf-Token":
+			value = "[redacted]"
+		}
+		attrs = append(attrs, slog.String(name, value))
+	}
+	return slog.Group("headers", attrs...)
+}
+
+// =============================================================================
+// Admin Page
+// =============================================================================
+
+// logSettingsForm is the admin form changing the log settings
+type logSettingsForm struct {
+	Level  string `form:"level"`
+	Sample string `form:"sample"`
+}
+
+// adminLogging shows the log settings in force, with a form to change them
+func (app *application) adminLogging(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = logSettingsForm{
+		Level:  levelName(app.logSettings.Level()),
+		Sample: strconv.Itoa(app.logSettings.Sample()),
+	}
+	data.Breadcrumbs = app.breadcrumbs(r, Crumb{Label: app.translate(r, "admin_logging.title")})
+	app.render(w, http.StatusOK, "admin_logging.tmpl", data)
+}
+
+// adminLoggingPost changes the log settings of this instance
+func (app *application) adminLoggingPost(w http.ResponseWriter, r *http.Request) {
+	var form logSettingsForm
+	if err := app.decodePostForm(r, &form); err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	level, err := parseLogLevel(form.Level)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	sample, err := parseLogSample(form.Sample)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	app.logSettings.set(level, sample)
+	app.logger.InfoContext(r.Context(), "Log settings changed", "level", levelName(level), "debug_sample", sample)
+	app.recordAudit(r, models.AuditLogSettings, "logging", fmt.Sprintf("level=%s sample=%d", levelName(level), sample))
+
+	app.putFlash(r, app.translate(r, "flash.log_settings_saved"))
+	http.Redirect(w, r, "/admin/logging", http.StatusSeeOther)
+}
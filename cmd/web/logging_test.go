@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestLeveledHandler(t *testing.T) {
+	settings := newLogSettings(slog.LevelInfo, 0)
+	var buf bytes.Buffer
+	logger := newLogger(&buf, settings)
+
+	logger.Info("one")
+	logger.Error("two")
+	logger.Debug("hidden")
+	settings.set(slog.LevelWarn, 0)
+	logger.Info("three")
+	logger.Error("four")
+
+	out := buf.String()
+	for _, want := range []string{"level=INFO msg=one", "level=ERROR msg=two", "level=ERROR msg=four"} {
+		assert.StringContains(t, out, want)
+	}
+	for _, unwanted := range []string{"msg=hidden", "msg=three"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("expected %q to be dropped", unwanted)
+		}
+	}
+
+	// Records for a request carry its ID, and debug records are let through
+	// for sampled requests
+	buf.Reset()
+	ctx := context.WithValue(t.Context(), requestIDContextKey, "abc123")
+	logger.ErrorContext(ctx, "failed", "snippet_id", 7)
+	logger.DebugContext(ctx, "hidden")
+	logger.DebugContext(context.WithValue(ctx, debugSampleContextKey, true), "sampled")
+	logger.With("job", "digest").Error("grouped")
+	assert.StringContains(t, buf.String(), "level=ERROR msg=failed snippet_id=7 request_id=abc123")
+	assert.StringContains(t, buf.String(), "level=DEBUG msg=sampled request_id=abc123")
+	assert.StringContains(t, buf.String(), "level=ERROR msg=grouped job=digest")
+	if strings.Contains(buf.String(), "msg=hidden") {
+		t.Error("expected the unsampled debug record to be dropped")
+	}
+}
+
+func TestLogSettingsReload(t *testing.T) {
+	settings := newLogSettings(slog.LevelInfo, 0)
+
+	assert.NilError(t, settings.reload(map[string]string{"LOG_LEVEL": "DEBUG"}))
+	assert.Equal(t, settings.Level(), slog.LevelDebug)
+	assert.Equal(t, settings.Sample(), 0)
+
+	assert.NilError(t, settings.reload(map[string]string{"LOG_DEBUG_SAMPLE": "25"}))
+	assert.Equal(t, settings.Level(), slog.LevelDebug)
+	assert.Equal(t, settings.Sample(), 25)
+
+	// A bad value changes nothing
+	err := settings.reload(map[string]string{"LOG_LEVEL": "error", "LOG_DEBUG_SAMPLE": "101"})
+	assert.StringContains(t, err.Error(), "LOG_DEBUG_SAMPLE")
+	assert.Equal(t, settings.Level(), slog.LevelDebug)
+
+	err = settings.reload(map[string]string{"LOG_LEVEL": "trace"})
+	assert.StringContains(t, err.Error(), "LOG_LEVEL")
+}
+
+func TestDebugSampling(t *testing.T) {
+	app := newTestApplication(t)
+	var buf bytes.Buffer
+	app.logger = newLogger(&buf, app.logSettings)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	serve := func() {
+		r := httptest.NewRequest(http.MethodGet, "/about", nil)
+		r.Header.Set("Cookie", "session=secret")
+		r.Header.Set("Accept", "text/html")
+		app.logRequest(next).ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	serve()
+	if strings.Contains(buf.String(), "level=DEBUG") {
+		t.Errorf("expected no debug lines; got %q", buf.String())
+	}
+
+	// Every request is sampled at 100%
+	app.logSettings.set(slog.LevelInfo, 100)
+	serve()
+	assert.StringContains(t, buf.String(), `level=DEBUG msg="Request started" client=192.0.2.1 method=GET uri=/about headers.Accept=text/html headers.Cookie=[redacted]`)
+
+	// As at debug level
+	buf.Reset()
+	app.logSettings.set(slog.LevelDebug, 0)
+	serve()
+	assert.StringContains(t, buf.String(), "level=DEBUG msg=\"Request started\"")
+}
+
+func TestRequestLogging(t *testing.T) {
+	app := newTestApplication(t)
+	var buf bytes.Buffer
+	app.logger = newLogger(&buf, app.logSettings)
+
+	failing := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.serverError(w, errors.New("database unreachable"))
+	})
+	rec := httptest.NewRecorder()
+	app.assignRequestID(app.instrument(app.logRequest(failing))).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/about", nil))
+
+	// The error and the access log line can be matched up by the request ID
+	id := rec.Header().Get(requestIDHeader)
+	assert.StringContains(t, buf.String(), `level=ERROR msg="database unreachable" request_id=`+id+" trace=")
+	assert.StringContains(t, buf.String(), `level=INFO msg="Request served" client=192.0.2.1 proto=HTTP/1.1 method=GET uri=/about status=500`)
+	assert.StringContains(t, buf.String(), "request_id="+id+"\n")
+}
+
+func TestAdminLogging(t *testing.T) {
+	app := newTestApplication(t)
+	audit := &recordingAudit{}
+	app.audit = audit
+	ts := testutil.NewServer(t, app.routes())
+
+	ts.Login(t, "alice@example.com", "pa$$word")
+	rs := ts.Get(t, "/admin/logging")
+	assert.Equal(t, rs.Status, http.StatusForbidden)
+
+	ts.Login(t, "admin@example.com", "pa$$word")
+	rs = ts.Get(t, "/admin/logging")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.StringContains(t, rs.Body, `<option value="info" selected>`)
+
+	rs = ts.Submit(t, "/admin/logging", "/admin/logging", url.Values{"level": {"debug"}, "sample": {"10"}})
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/admin/logging")
+	assert.Equal(t, app.logSettings.Level(), slog.LevelDebug)
+	assert.Equal(t, app.logSettings.Sample(), 10)
+	assert.DeepEqual(t, audit.entries, []auditRecord{{3, models.AuditLogSettings, "logging", "level=debug sample=10"}})
+
+	rs = ts.Get(t, "/admin/logging")
+	assert.StringContains(t, rs.Body, `<option value="debug" selected>`)
+	assert.StringContains(t, rs.Body, `name="sample" value="10"`)
+
+	tests := []struct {
+		name   string
+		values url.Values
+	}{
+		{"Unknown level", url.Values{"level": {"trace"}, "sample": {"0"}}},
+		{"Sample too large", url.Values{"level": {"info"}, "sample": {"150"}}},
+		{"Sample not a number", url.Values{"level": {"info"}, "sample": {"x"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := ts.Submit(t, "/admin/logging", "/admin/logging", tt.values)
+			assert.Equal(t, rs.Status, http.StatusBadRequest)
+		})
+	}
+	assert.Equal(t, app.logSettings.Sample(), 10)
+}
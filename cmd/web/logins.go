@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"adotkaya.playground/internal/models"
+)
+
+// =============================================================================
+// Login Anomaly Detection
+// =============================================================================
+// Password logins are compared with the user's recent logins. A login from
+// a new device (user agent) or country is emailed to the user, who can also
+// require such logins to be confirmed from the email before they complete.
+
+const (
+	// maxUserAgentLength is the most characters of a user agent stored,
+	// including the ellipsis marking a truncated one
+	maxUserAgentLength = 255
+
+	// securityLoginsListed is how many recent logins the security page lists
+	securityLoginsListed = 10
+
+	// loginConfirmFlash is the key of the notice shown while a login awaits
+	// confirmation
+	loginConfirmFlash = "login_confirm"
+)
+
+// countryRX matches an ISO 3166 alpha-2 country code
+var countryRX = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// loginCountry returns the client's country from the configured header,
+// or "" if there is none or the request didn't come through a trusted
+// proxy, which would have set it. Proxies send XX when they don't know.
+func (app *application) loginCountry(r *http.Request) string {
+	header := app.config.Logins.CountryHeader
+	if header == "" || !app.trustedProxy(remoteAddr(r)) {
+		return ""
+	}
+	country := strings.ToUpper(strings.TrimSpace(r.Header.Get(header)))
+	if !countryRX.MatchString(country) || country == "XX" {
+		return ""
+	}
+	return country
+}
+
+// screenLogin records a password login and compares it with the user's
+// recent logins. Unfamiliar logins are emailed to the user or, if they
+// require it, held until confirmed from the email, in which case the
+// visitor is sent back to the login page. It returns false if it has
+// written the response, and true if the login should go ahead.
+func (app *application) screenLogin(w http.ResponseWriter, r *http.Request, userID int) bool {
+	user, err := app.users.Get(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return false
+	}
+
+	event := &models.LoginEvent{
+		UserID:    userID,
+		IP:        app.clientIP(r),
+		UserAgent: truncate(r.UserAgent(), maxUserAgentLength-1),
+		Country:   app.loginCountry(r),
+	}
+	event.NewDevice, event.NewCountry, err = app.logins.Familiarity(userID, event.UserAgent, event.Country)
+	if err != nil {
+		app.serverError(w, err)
+		return false
+	}
+	hold := event.Unfamiliar() && user.ConfirmNewDevices
+	event.Confirmed = !hold
+
+	event.ID, err = app.logins.Insert(event)
+	if err != nil {
+		app.serverError(w, err)
+		return false
+	}
+
+	if !event.Unfamiliar() {
+		return true
+	}
+
+	data := map[string]any{
+		"Name":        user.Name,
+		"Time":        humanDate(time.Now()),
+		"IP":          event.IP.String(),
+		"UserAgent":   event.UserAgent,
+		"Country":     event.Country,
+		"SecurityURL": app.canonicalURL("/account/security"),
+	}
+	if !hold {
+		// The login has happened, so a failure to email is only logged
+		if err := app.sendMail(user.Email, "new_sign_in.tmpl", data); err != nil {
+			app.logger.ErrorContext(r.Context(), "new sign-in email", "user_id", userID, "error", err)
+		}
+		return true
+	}
+
+	data["ConfirmURL"] = app.loginConfirmURL(event.ID)
+	if err := app.sendMail(user.Email, "confirm_sign_in.tmpl", data); err != nil {
+		app.serverError(w, err)
+		return false
+	}
+
+	// The notice stays up, whatever the user looks at meanwhile, until the
+	// login is confirmed or the link expires
+	pendingLoginKey.Put(app.sessionManager, r.Context(), event.ID)
+	app.addFlash(r, flashMessage{
+		Key:     loginConfirmFlash,
+		Level:   flashInfo,
+		Message: app.translate(r, "flash.login_confirm_sent"),
+		Views:   flashSticky,
+	})
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+	return false
+}
+
+// loginConfirmURL returns the emailed link confirming a held login
+func (app *application) loginConfirmURL(id int64) string {
+	q := url.Values{}
+	q.Set("login", strconv.FormatInt(id, 10))
+	q.Set("sig", app.sign(fmt.Sprintf("login:%d", id)))
+	return app.canonicalURL("/user/login/confirm?" + q.Encode())
+}
+
+// userLoginConfirm completes a held login from the link in the
+// confirmation email. The link only works in the browser that logged in,
+// so someone else who knows the password can't be let in by a user
+// clicking it, and only until models.LoginConfirmationLifetime has passed.
+func (app *application) userLoginConfirm(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("login"), 10, 64)
+	if err != nil || !app.validSignature(fmt.Sprintf("login:%d", id), r.URL.Query().Get("sig")) {
+		app.notFound(w, r)
+		return
+	}
+
+	if pendingLoginKey.Get(app.sessionManager, r.Context()) != id {
+		app.putFlash(r, app.translate(r, "flash.login_confirm_browser"))
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	userID, err := app.logins.Confirm(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			pendingLoginKey.Remove(app.sessionManager, r.Context())
+			app.clearFlash(r, loginConfirmFlash)
+			app.putFlash(r, app.translate(r, "flash.login_confirm_expired"))
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	pendingLoginKey.Remove(app.sessionManager, r.Context())
+	app.clearFlash(r, loginConfirmFlash)
+	if err := app.logIn(r, userID); err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.putFlash(r, app.translate(r, "flash.login_confirmed"))
+	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+}
+
+// =============================================================================
+// Security Settings
+// =============================================================================
+
+// securityForm represents the sign-in security settings form
+type securityForm struct {
+	ConfirmNewDevices bool `form:"confirm_new_devices"`
+}
+
+// accountSecurity shows the user's recent logins and whether logins from
+// unfamiliar devices must be confirmed
+func (app *application) accountSecurity(w http.ResponseWriter, r *http.Request) {
+	userID := userIDKey.Get(app.sessionManager, r.Context())
+
+	user, err := app.users.Get(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	logins, err := app.logins.Recent(userID, securityLoginsListed)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Logins = logins
+	data.Form = securityForm{ConfirmNewDevices: user.ConfirmNewDevices}
+	data.Breadcrumbs = app.breadcrumbs(r, Crumb{Label: app.translate(r, "security.title")})
+	app.render(w, http.StatusOK, "security.tmpl", data)
+}
+
+// accountSecurityPost saves the sign-in security settings
+func (app *application) accountSecurityPost(w http.ResponseWriter, r *http.Request) {
+	var form securityForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	userID := userIDKey.Get(app.sessionManager, r.Context())
+	err = app.users.SetConfirmNewDevices(userID, form.ConfirmNewDevices)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.putFlash(r, app.translate(r, "flash.security_saved"))
+	http.Redirect(w, r, "/account/security", http.StatusSeeOther)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/models/mocks"
+	"adotkaya.playground/internal/testutil"
+)
+
+// cautiousUsers require logins from new devices to be confirmed
+type cautiousUsers struct {
+	mocks.UserModel
+}
+
+func (m *cautiousUsers) Get(id int) (*models.User, error) {
+	user, err := m.UserModel.Get(id)
+	if user != nil {
+		user.ConfirmNewDevices = true
+	}
+	return user, err
+}
+
+// loginFrom logs Alice in through the login form from a browser with the
+// given user agent, returning the login response
+func loginFrom(t *testing.T, ts *testutil.Server, userAgent string) testutil.Response {
+	t.Helper()
+
+	form := url.Values{"email": {"alice@example.com"}, "password": {"pa$$word"}}
+	values := withCSRF(t, ts.Get(t, "/user/login").Body, form)
+	req := ts.NewRequest(t, http.MethodPost, "/user/login", strings.NewReader(values.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Referer", ts.URL+"/user/login")
+	req.Header.Set("User-Agent", userAgent)
+	return ts.Do(t, req)
+}
+
+// sentEmails returns the templates of the emails queued on jobs
+func sentEmails(jobs *fakeJobs) []string {
+	var templates []string
+	for _, payload := range jobs.enqueued {
+		if job, ok := payload.(emailJob); ok {
+			templates = append(templates, job.Template)
+		}
+	}
+	return templates
+}
+
+func TestLoginNewDevice(t *testing.T) {
+	app := newTestApplication(t)
+	jobs := &fakeJobs{}
+	app.jobs = jobs
+
+	// The first login, and later ones from the same browser, are familiar
+	for range 2 {
+		rs := loginFrom(t, testutil.NewServer(t, app.routes()), "Laptop")
+		assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/snippet/create")
+	}
+	assert.Equal(t, len(sentEmails(jobs)), 0)
+
+	// A new browser logs in, and the user is told
+	rs := loginFrom(t, testutil.NewServer(t, app.routes()), "Phone")
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/snippet/create")
+	assert.DeepEqual(t, sentEmails(jobs), []string{"new_sign_in.tmpl"})
+
+	logins, err := app.logins.Recent(1, 10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(logins), 3)
+	assert.Equal(t, logins[0].NewDevice, true)
+	assert.Equal(t, logins[0].Confirmed, true)
+}
+
+func TestLoginConfirmation(t *testing.T) {
+	app := newTestApplication(t)
+	jobs := &fakeJobs{}
+	app.jobs = jobs
+	app.users = &cautiousUsers{}
+
+	loginFrom(t, testutil.NewServer(t, app.routes()), "Laptop")
+
+	// A login from a new browser is held until confirmed from the email
+	ts := testutil.NewServer(t, app.routes())
+	rs := loginFrom(t, ts, "Phone")
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/user/login")
+	assert.StringContains(t, ts.Get(t, "/user/login").Body, "we&#39;ve emailed you a link")
+	rs = ts.Get(t, "/snippet/create")
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/user/login")
+
+	// The notice stays up on other pages meanwhile
+	assert.StringContains(t, ts.Get(t, "/").Body, `<div class="flash flash-info" role="status">This device is new`)
+
+	assert.DeepEqual(t, sentEmails(jobs), []string{"confirm_sign_in.tmpl"})
+	link, err := url.Parse(jobs.enqueued[0].(emailJob).Data["ConfirmURL"].(string))
+	assert.NilError(t, err)
+	confirm := link.RequestURI()
+
+	// The link doesn't work in another browser, or once tampered with
+	other := testutil.NewServer(t, app.routes())
+	rs = other.Get(t, confirm)
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/user/login")
+	rs = ts.Get(t, strings.Replace(confirm, "login=2", "login=1", 1))
+	assert.Equal(t, rs.Status, http.StatusNotFound)
+
+	// In the browser that logged in it completes the login, once
+	rs = ts.Get(t, confirm)
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/snippet/create")
+	rs = ts.Get(t, "/snippet/create")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.StringContains(t, rs.Body, "Thanks for confirming")
+	if strings.Contains(rs.Body, "This device is new") {
+		t.Error("confirmation notice still shown after confirming")
+	}
+	rs = ts.Get(t, confirm)
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/user/login")
+
+	// Now the browser is familiar
+	rs = loginFrom(t, testutil.NewServer(t, app.routes()), "Phone")
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/snippet/create")
+}
+
+func TestLoginCountry(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.Logins.CountryHeader = "CF-IPCountry"
+	app.config.Server.TrustedProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		country    string
+		want       string
+	}{
+		{"From proxy", "10.0.0.1:1234", "de", "DE"},
+		{"Unknown", "10.0.0.1:1234", "XX", ""},
+		{"Malformed", "10.0.0.1:1234", "Germany", ""},
+		{"Not from proxy", "192.0.2.1:1234", "DE", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodPost, "/user/login", nil)
+			assert.NilError(t, err)
+			r.RemoteAddr = tt.remoteAddr
+			r.Header.Set("CF-IPCountry", tt.country)
+			assert.Equal(t, app.loginCountry(r), tt.want)
+		})
+	}
+}
+
+func TestAccountSecurity(t *testing.T) {
+	ts := testutil.NewServer(t, newTestApplication(t).routes())
+	ts.Login(t, "alice@example.com", "pa$$word")
+
+	rs := ts.Get(t, "/account/security")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.StringContains(t, rs.Body, "<td>Go-http-client/1.1</td>")
+
+	rs = ts.Submit(t, "/account/security", "/account/security", url.Values{"confirm_new_devices": {"true"}})
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/account/security")
+}
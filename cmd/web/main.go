@@ -2,20 +2,33 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"html/template"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/alexedwards/scs/pgxstore"
 	"github.com/alexedwards/scs/v2"
+	"github.com/crewjam/saml"
 	"github.com/go-playground/form/v4"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus"
 
+	"adotkaya.playground/internal/cookies"
+	"adotkaya.playground/internal/mailer"
+	"adotkaya.playground/internal/migrate"
 	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/objectstore"
+	"adotkaya.playground/migrations"
 )
 
 // =============================================================================
@@ -24,13 +37,47 @@ import (
 
 // application holds the application-wide dependencies and configuration
 type application struct {
-	errorLog       *log.Logger
-	infoLog        *log.Logger
+	logger         *slog.Logger
+	logSettings    *logSettings
 	snippets       models.SnippetModelInterface
 	users          models.UserModelInterface
+	jobs           models.JobModelInterface
+	moderation     models.ModerationModelInterface
+	audit          models.AuditModelInterface
+	changes        models.SnippetChangeModelInterface
+	follows        models.FollowModelInterface
+	notifications  models.NotificationModelInterface
+	subscriptions  models.SubscriptionModelInterface
+	backups        models.BackupModelInterface
+	idempotency    models.IdempotencyModelInterface
+	tokens         models.APITokenModelInterface
+	logins         models.LoginEventModelInterface
+	gists          models.GistModelInterface
+	attachments    models.AttachmentModelInterface
+	avatars        models.AvatarModelInterface
+	maintenance    models.MaintenanceModelInterface
+	reports        models.ReportModelInterface
+	exports        models.ExportModelInterface
+	outbox         models.OutboxModelInterface
+	analytics      models.AnalyticsModelInterface
 	templateCache  map[string]*template.Template
+	pages          *pageCache // Nil when page caching is off
+	bans           *banList
+	announcements  *announcementBoard
+	stats          *statsCache
 	formDecoder    *form.Decoder
 	sessionManager *scs.SessionManager
+	cookies        *cookies.Codec // Encrypts state kept in cookies outside the session
+	dbMonitor      *poolMonitor
+	mailer         mailer.Sender
+	saml           *saml.ServiceProvider // Nil unless single sign-on is configured
+	github         gistClient
+	importer       snippetFetcher
+	objects        objectstore.Store // Nil unless attachments are configured
+	avatarStore    avatarStore
+	quotas         *quotaService
+	events         *eventHub // Newly created snippets for live updates
+	config         *Config
 }
 
 // =============================================================================
@@ -38,26 +85,56 @@ type application struct {
 // =============================================================================
 
 func main() {
+	// -------------------------------------------------------------------------
+	// Subcommands
+	// -------------------------------------------------------------------------
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "loadtest":
+			os.Exit(runLoadtest(os.Args[2:], os.Stdout))
+		case "backup":
+			os.Exit(runBackup(os.Args[2:], os.Stdout, os.Stderr))
+		case "restore":
+			os.Exit(runRestore(os.Args[2:], os.Stdout))
+		case "seed":
+			os.Exit(runSeed(os.Args[2:], os.Stdout))
+		case "maintenance":
+			os.Exit(runMaintenance(os.Args[2:], os.Stdout))
+		case "schema":
+			os.Exit(runSchema(os.Args[2:], os.Stdout))
+		}
+	}
+
 	// -------------------------------------------------------------------------
 	// Load Environment Configuration
 	// -------------------------------------------------------------------------
 	err := godotenv.Load()
-	if err != nil {
-		log.Println("No .env file found, using system environment variables")
-	}
 
 	// -------------------------------------------------------------------------
-	// Initialize Loggers
+	// Initialize Logger
 	// -------------------------------------------------------------------------
-	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
+	// Records below the level in force are dropped, except debug records
+	// for requests picked by sampling
+	logs := newLogSettings(slog.LevelInfo, 0)
+	logger := newLogger(os.Stdout, logs)
+	if err != nil {
+		logger.Info("No .env file found, using system environment variables")
+	}
 
 	// -------------------------------------------------------------------------
 	// Load and Validate Configuration
 	// -------------------------------------------------------------------------
 	cfg, err := LoadConfig()
 	if err != nil {
-		errorLog.Fatal("Configuration error:", err)
+		fatal(logger, "Configuration error", err)
+	}
+	logs.set(cfg.Logging.Level, cfg.Logging.DebugSample)
+
+	if cfg.Server.SecretKey == "" {
+		key := make([]byte, 32)
+		rand.Read(key)
+		cfg.Server.SecretKey = hex.EncodeToString(key)
+		logger.Info("SECRET_KEY not set; using a random key (emailed links and preference cookies will break on restart)")
 	}
 
 	// -------------------------------------------------------------------------
@@ -66,23 +143,95 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	pool, err := pgxpool.New(ctx, cfg.Database.DSN())
+	poolConfig, err := pgxpool.ParseConfig(cfg.Database.DSN())
 	if err != nil {
-		errorLog.Fatal("Unable to connect to database:", err)
+		fatal(logger, "Invalid database configuration", err)
+	}
+	poolConfig.ConnConfig.Tracer = &queryTracer{slow: cfg.Database.SlowQuery, logger: logger}
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		fatal(logger, "Unable to connect to database", err)
 	}
 	defer pool.Close()
 
 	if err = pool.Ping(ctx); err != nil {
-		errorLog.Fatal("Unable to ping database:", err)
+		fatal(logger, "Unable to ping database", err)
+	}
+	logger.Info("Database connection established")
+
+	// -------------------------------------------------------------------------
+	// Apply Database Migrations
+	// -------------------------------------------------------------------------
+	if cfg.Database.AutoMigrate {
+		migrateCtx, cancelMigrate := context.WithTimeout(context.Background(), time.Minute)
+		applied, err := migrate.Up(migrateCtx, pool, migrations.Files)
+		cancelMigrate()
+		if err != nil {
+			fatal(logger, "Unable to migrate database", err)
+		}
+		if len(applied) > 0 {
+			logger.Info("Applied database migrations", "versions", applied)
+		}
+	}
+
+	// -------------------------------------------------------------------------
+	// Check for Schema Drift
+	// -------------------------------------------------------------------------
+	driftCtx, cancelDrift := context.WithTimeout(context.Background(), 5*time.Second)
+	drift, err := migrate.Check(driftCtx, pool, migrations.Files)
+	cancelDrift()
+	if err != nil {
+		fatal(logger, "Unable to check database migrations", err)
+	}
+	if err = checkDrift(drift, cfg.Database.AllowDrift, logger); err != nil {
+		fatal(logger, "Database schema", err)
+	}
+
+	// -------------------------------------------------------------------------
+	// Initialize Mailer (log-only unless an SMTP server is configured)
+	// -------------------------------------------------------------------------
+	var mail mailer.Sender = mailer.NewLogMailer(logger)
+	var smtpMailer *mailer.SMTPMailer
+	if cfg.Mail.SMTPHost != "" {
+		smtpMailer = mailer.New(mailer.Config{
+			Host:     cfg.Mail.SMTPHost,
+			Port:     cfg.Mail.SMTPPort,
+			Username: cfg.Mail.SMTPUsername,
+			Password: cfg.Mail.SMTPPassword,
+			Sender:   cfg.Mail.Sender,
+			TLS:      cfg.Mail.SMTPTLS,
+		})
+		mail = smtpMailer
+	}
+
+	// -------------------------------------------------------------------------
+	// Run Startup Self-Check
+	// -------------------------------------------------------------------------
+	// The schema, templates, TLS certificate and SMTP server are checked
+	// now, so problems stop the server with what to do about them instead
+	// of failing the first requests
+	if cfg.Server.SelfCheck {
+		checks := startupChecks(&models.SchemaModel{DB: pool}, smtpMailer, logger)
+		if err := runSelfChecks(context.Background(), checks, logger); err != nil {
+			fatal(logger, "Startup checks", err)
+		}
+		logger.Info("Startup checks passed")
 	}
-	infoLog.Println("Database connection established")
+
+	// -------------------------------------------------------------------------
+	// Start Database Pool Monitor
+	// -------------------------------------------------------------------------
+	dbMonitor := newPoolMonitor(pool, cfg.Database.MonitorInterval, logger)
+	prometheus.MustRegister(dbMonitor.collectors()...)
+	go dbMonitor.run(context.Background())
 
 	// -------------------------------------------------------------------------
 	// Initialize Template Cache
 	// -------------------------------------------------------------------------
 	templateCache, err := newTemplateCache()
 	if err != nil {
-		errorLog.Fatal(err)
+		fatal(logger, "Unable to load templates", err)
 	}
 
 	// -------------------------------------------------------------------------
@@ -95,21 +244,194 @@ func main() {
 	// -------------------------------------------------------------------------
 	sessionManager := scs.New()
 	sessionManager.Store = pgxstore.New(pool)
-	sessionManager.Lifetime = 12 * time.Hour
-	sessionManager.Cookie.Secure = true
+	if cfg.Cache.SessionTTL > 0 {
+		sessionManager.Store = newCachedSessionStore(sessionManager.Store, cfg.Cache.SessionTTL)
+	}
+	configureSessions(sessionManager, cfg.Session)
+
+	// State kept in cookies outside the session is encrypted with a key
+	// derived from SECRET_KEY
+	cookieCodec, err := cookies.New(cfg.Server.SecretKey)
+	if err != nil {
+		fatal(logger, "Cookie codec", err)
+	}
+
+	// -------------------------------------------------------------------------
+	// Initialize Snippet Model (optionally cached)
+	// -------------------------------------------------------------------------
+	// Content is encrypted at rest when keys are configured
+	var contentKeys *models.ContentKeys
+	if len(cfg.Content.Keys) > 0 {
+		contentKeys, err = models.NewContentKeys(cfg.Content.Keys)
+		if err != nil {
+			fatal(logger, "Invalid content keys", err)
+		}
+		logger.Info("Snippet content encryption enabled")
+	}
+
+	snippetModel := &models.SnippetModel{DB: pool, Keys: contentKeys}
+	var snippets models.SnippetModelInterface = snippetModel
+	if cfg.Cache.Enabled {
+		cache := models.NewSnippetCache(snippets, pool, cfg.Cache.LatestTTL, cfg.Cache.MaxSnippets)
+		go listenForInvalidations(cache, logger)
+		prometheus.MustRegister(cacheCollectors(cache)...)
+		snippets = cache
+		logger.Info("Snippet cache enabled")
+	}
+
+	// Rendered pages for anonymous visitors
+	var pages *pageCache
+	if cfg.Cache.Enabled && cfg.Cache.PageTTL > 0 {
+		pages = newPageCache(cfg.Cache.PageTTL, cfg.Cache.PageStale, 1000)
+	}
+
+	// IP bans, loaded before the server starts so they apply from the first
+	// request
+	bans := newBanList(&models.BanModel{DB: pool}, logger)
+	if err := bans.refresh(); err != nil {
+		fatal(logger, "Unable to load ip bans", err)
+	}
+	go bans.run(context.Background())
+
+	// Announcement banners, loaded before the server starts so they show
+	// from the first request
+	announcements := newAnnouncementBoard(&models.AnnouncementModel{DB: pool}, logger)
+	if err := announcements.refresh(); err != nil {
+		fatal(logger, "Unable to load announcements", err)
+	}
+	go announcements.run(context.Background())
+
+	// -------------------------------------------------------------------------
+	// Initialize SAML Single Sign-On (if configured)
+	// -------------------------------------------------------------------------
+	var sp *saml.ServiceProvider
+	if cfg.SAML.Enabled() {
+		sp, err = newServiceProvider(cfg)
+		if err != nil {
+			fatal(logger, "Unable to set up SAML single sign-on", err)
+		}
+		logger.Info("SAML single sign-on enabled", "idp", sp.IDPMetadata.EntityID)
+	}
+
+	// -------------------------------------------------------------------------
+	// Initialize Object Stores for Attachments (if configured) and Avatars
+	// -------------------------------------------------------------------------
+	var objects objectstore.Store
+	s3, err := attachmentStore(cfg)
+	if err != nil {
+		fatal(logger, "Unable to set up the S3 bucket", err)
+	}
+	if s3 != nil {
+		objects = s3
+		logger.Info("Attachments enabled", "bucket", cfg.S3.Bucket)
+	}
+
+	var avatars avatarStore = s3
+	if cfg.Avatars.Storage == "local" {
+		avatars, err = objectstore.NewDir(cfg.Avatars.Dir)
+		if err != nil {
+			fatal(logger, "Unable to set up the avatar directory", err)
+		}
+	}
 
 	// -------------------------------------------------------------------------
 	// Create Application Instance
 	// -------------------------------------------------------------------------
 	app := &application{
-		errorLog:       errorLog,
-		infoLog:        infoLog,
-		snippets:       &models.SnippetModel{DB: pool},
-		users:          &models.UserModel{DB: pool},
+		logger:         logger,
+		logSettings:    logs,
+		snippets:       snippets,
+		users:          &models.UserModel{DB: pool, Passwords: cfg.Passwords.hasher()},
+		jobs:           &models.JobModel{DB: pool},
+		moderation:     &models.ModerationModel{DB: pool, Keys: contentKeys},
+		audit:          &models.AuditModel{DB: pool},
+		changes:        &models.SnippetChangeModel{DB: pool},
+		follows:        &models.FollowModel{DB: pool, Keys: contentKeys},
+		notifications:  &models.NotificationModel{DB: pool},
+		subscriptions:  &models.SubscriptionModel{DB: pool, Keys: contentKeys},
+		backups:        &models.BackupModel{DB: pool, Keys: contentKeys},
+		idempotency:    &models.IdempotencyModel{DB: pool},
+		tokens:         &models.APITokenModel{DB: pool},
+		logins:         &models.LoginEventModel{DB: pool},
+		gists:          &models.GistModel{DB: pool, Keys: contentKeys},
+		attachments:    &models.AttachmentModel{DB: pool},
+		avatars:        &models.AvatarModel{DB: pool},
+		maintenance:    &models.MaintenanceModel{DB: pool},
+		reports:        &models.ReportModel{DB: pool},
+		exports:        &models.ExportModel{DB: pool},
+		outbox:         &models.OutboxModel{DB: pool},
+		analytics:      &models.AnalyticsModel{DB: pool},
 		templateCache:  templateCache,
+		pages:          pages,
+		bans:           bans,
+		announcements:  announcements,
+		stats:          newStatsCache(&models.SiteStatsModel{DB: pool}, snippets),
 		formDecoder:    formDecoder,
 		sessionManager: sessionManager,
+		cookies:        cookieCodec,
+		dbMonitor:      dbMonitor,
+		mailer:         mail,
+		saml:           sp,
+		github:         newGitHubGists(cfg.GitHub.APIURL),
+		importer:       newHTTPFetcher(),
+		objects:        objects,
+		avatarStore:    avatars,
+		config:         cfg,
+	}
+	app.quotas = newQuotaService(cfg, app.users)
+	app.events = newEventHub()
+	prometheus.MustRegister(botRejections, requestDuration, requestsTotal, requestSize, responseSize,
+		serverErrorsTotal, panicsTotal, dbTimeoutsTotal, failedLoginsTotal)
+
+	// -------------------------------------------------------------------------
+	// Start Background Job Worker
+	// -------------------------------------------------------------------------
+	worker := newJobWorker(app.jobs, cfg.Jobs.PollInterval, logger)
+	worker.handle(emailJobKind, app.sendMailJob)
+	worker.handle(digestJobKind, app.sendDigestJob)
+	worker.handle(subscriptionsJobKind, app.sendSubscriptionsJob)
+	worker.handle(backupJobKind, app.runBackupJob)
+	worker.handle(trendingJobKind, app.refreshTrendingJob)
+	worker.handle(gistJobKind, app.pushGistJob)
+	worker.handleTracked(reindexJobKind, app.reindexJob)
+	worker.handleTracked(vacuumJobKind, app.vacuumJob)
+	go worker.run(context.Background())
+
+	// -------------------------------------------------------------------------
+	// Start Outbox Relay
+	// -------------------------------------------------------------------------
+	go app.relayOutbox(context.Background(), cfg.Jobs.PollInterval)
+
+	// -------------------------------------------------------------------------
+	// Start Scheduler
+	// -------------------------------------------------------------------------
+	// Every instance runs the scheduler, but only the one holding the
+	// scheduler lock runs its tasks
+	election := newLeaderElection(&models.AdvisoryLock{DB: pool, Key: schedulerLockKey}, logger)
+	go election.run(context.Background())
+
+	sched := newScheduler(logger)
+	sched.lead = election.isLeader
+	if cfg.Jobs.Digest {
+		sched.add("weekly digest", digestSchedule, app.enqueueDigest)
+	}
+	if cfg.Jobs.SubscriptionEmails {
+		sched.add("subscription emails", subscriptionsSchedule, app.enqueueSubscriptionEmails)
 	}
+	sched.add("prune idempotency keys", idempotencySchedule, app.pruneIdempotencyKeys)
+	sched.add("trending scores", trendingSchedule, app.enqueueTrending)
+	if contentKeys != nil {
+		reseal := func() error { return resealContent(snippetModel, logger) }
+		sched.add("reseal content", resealSchedule, reseal)
+
+		// Encrypt existing content, or move it to a new key, straight away
+		go func() {
+			if err := reseal(); err != nil {
+				logger.Error("Resealing content", "error", err)
+			}
+		}()
+	}
+	go sched.run(context.Background())
 
 	// -------------------------------------------------------------------------
 	// Configure TLS
@@ -126,7 +448,7 @@ func main() {
 	// against slow-client attacks.
 	srv := &http.Server{
 		Addr:         ":" + cfg.Server.Port,
-		ErrorLog:     errorLog,
+		ErrorLog:     slog.NewLogLogger(logger.Handler(), slog.LevelError),
 		Handler:      app.routes(),
 		TLSConfig:    tlsConfig,
 		IdleTimeout:  cfg.Server.IdleTimeout,
@@ -134,10 +456,145 @@ func main() {
 		WriteTimeout: cfg.Server.WriteTimeout,
 	}
 
+	// -------------------------------------------------------------------------
+	// Reload Log Settings on SIGHUP
+	// -------------------------------------------------------------------------
+	// The environment can't change under a running process, so LOG_LEVEL
+	// and LOG_DEBUG_SAMPLE are read again from the .env file
+	go func() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		for range hup {
+			env, err := godotenv.Read()
+			if err == nil {
+				err = logs.reload(env)
+			}
+			if err != nil {
+				logger.Error("Reloading log settings", "error", err)
+				continue
+			}
+			logger.Info("Log settings reloaded", "level", levelName(logs.Level()), "debug_sample", logs.Sample())
+		}
+	}()
+
+	// -------------------------------------------------------------------------
+	// Shut Down Gracefully on SIGINT or SIGTERM
+	// -------------------------------------------------------------------------
+	// Shutdown stops accepting connections and waits for requests in
+	// flight. Live event streams never finish by themselves, so closing the
+	// hub ends them.
+	srv.RegisterOnShutdown(app.events.close)
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		s := <-quit
+		logger.Info("Shutting down", "signal", s.String())
+
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+		shutdownErr <- srv.Shutdown(ctx)
+	}()
+
 	// -------------------------------------------------------------------------
 	// Start HTTPS Server
 	// -------------------------------------------------------------------------
-	infoLog.Printf("Starting server on :%s", cfg.Server.Port)
-	err = srv.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem")
-	errorLog.Fatal(err)
+	logger.Info("Starting server", "addr", srv.Addr)
+	err = srv.ListenAndServeTLS(tlsCertFile, tlsKeyFile)
+	if !errors.Is(err, http.ErrServerClosed) {
+		fatal(logger, "Server failed", err)
+	}
+
+	if err = <-shutdownErr; err != nil {
+		fatal(logger, "Shutting down", err)
+	}
+	logger.Info("Server stopped")
+}
+
+// cacheCollectors returns counters exposing the snippet cache hit rate
+func cacheCollectors(cache *models.SnippetCache) []prometheus.Collector {
+	counter := func(name, help string, value func(models.CacheStats) uint64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: "snippetbox",
+			Subsystem: "snippet_cache",
+			Name:      name,
+			Help:      help,
+		}, func() float64 { return float64(value(cache.Stats())) })
+	}
+
+	return []prometheus.Collector{
+		counter("hits_total", "Snippet lookups served from memory.",
+			func(s models.CacheStats) uint64 { return s.Hits }),
+		counter("misses_total", "Snippet lookups that queried the database.",
+			func(s models.CacheStats) uint64 { return s.Misses }),
+	}
+}
+
+// listenForInvalidations keeps the cache's LISTEN connection alive, retrying
+// after a short delay whenever it drops
+func listenForInvalidations(cache *models.SnippetCache, logger *slog.Logger) {
+	for {
+		err := cache.Listen(context.Background())
+		logger.Error("snippet cache listener stopped", "error", err)
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// fatal logs msg with err and exits, for errors the server can't run with
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// attachmentStore returns the S3 bucket holding attachments, or nil if none
+// is configured
+func attachmentStore(cfg *Config) (*objectstore.S3, error) {
+	if !cfg.S3.Enabled() {
+		return nil, nil
+	}
+	return objectstore.New(objectstore.Config{
+		Endpoint:        cfg.S3.Endpoint,
+		Region:          cfg.S3.Region,
+		Bucket:          cfg.S3.Bucket,
+		AccessKeyID:     cfg.S3.AccessKeyID,
+		SecretAccessKey: cfg.S3.SecretAccessKey,
+		PathStyle:       cfg.S3.PathStyle,
+	})
+}
+
+// commandDB loads the configuration and connects to the database for a
+// subcommand, applying migrations first if asked to and they are applied
+// automatically
+func commandDB(migrateUp bool) (*Config, *pgxpool.Pool, error) {
+	// Without a .env file the environment is used as is
+	godotenv.Load()
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pool, err := pgxpool.New(ctx, cfg.Database.DSN())
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, nil, err
+	}
+
+	if migrateUp && cfg.Database.AutoMigrate {
+		migrateCtx, cancelMigrate := context.WithTimeout(context.Background(), time.Minute)
+		defer cancelMigrate()
+		if _, err = migrate.Up(migrateCtx, pool, migrations.Files); err != nil {
+			pool.Close()
+			return nil, nil, fmt.Errorf("migrating database: %w", err)
+		}
+	}
+
+	return cfg, pool, nil
 }
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"adotkaya.playground/internal/models"
+)
+
+// =============================================================================
+// Maintenance
+// =============================================================================
+// Admins can rebuild the search index, recompute the trending scores and
+// vacuum expired data on demand, from /admin/maintenance or with the
+// maintenance subcommand. From the admin page each runs as a job, whose
+// progress the page shows.
+
+const (
+	reindexJobKind         = "reindex"
+	vacuumJobKind          = "vacuum"
+	maintenanceMaxAttempts = 3
+	maintenanceRecentLimit = 20  // Runs listed on the admin page
+	maintenanceBatchSize   = 500 // Snippets reindexed or deleted per transaction
+
+	// expiredSnippetRetention is how long expired snippets are kept before
+	// vacuuming deletes them, in case their authors want them back
+	expiredSnippetRetention = 30 * 24 * time.Hour
+
+	// finishedJobRetention is how long finished jobs are kept for the admin
+	// pages before vacuuming deletes them
+	finishedJobRetention = 30 * 24 * time.Hour
+)
+
+// maintenanceTasks are the job kinds the admin maintenance page can start,
+// in the order it lists them
+var maintenanceTasks = []string{reindexJobKind, trendingJobKind, vacuumJobKind}
+
+// maintenanceForm is the admin form starting a maintenance task
+type maintenanceForm struct {
+	Task string `form:"task"`
+}
+
+// vacuumStats counts what vacuumExpired deleted
+type vacuumStats struct {
+	models.PruneStats
+	Snippets int
+	Files    []string // Object store keys of the deleted snippets' attachments
+}
+
+// adminMaintenance lists recent maintenance runs with their progress, with
+// a form to start each task
+func (app *application) adminMaintenance(w http.ResponseWriter, r *http.Request) {
+	runs := []*models.Job{}
+	for _, kind := range maintenanceTasks {
+		jobs, err := app.jobs.Recent(kind, maintenanceRecentLimit)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		runs = append(runs, jobs...)
+	}
+	slices.SortFunc(runs, func(a, b *models.Job) int { return cmp.Compare(b.ID, a.ID) })
+	if len(runs) > maintenanceRecentLimit {
+		runs = runs[:maintenanceRecentLimit]
+	}
+
+	data := app.newTemplateData(r)
+	data.MaintenanceRuns = runs
+	data.Breadcrumbs = app.breadcrumbs(r, Crumb{Label: app.translate(r, "admin_maintenance.title")})
+	app.render(w, http.StatusOK, "admin_maintenance.tmpl", data)
+}
+
+// adminMaintenancePost queues a maintenance task for the job worker
+func (app *application) adminMaintenancePost(w http.ResponseWriter, r *http.Request) {
+	var form maintenanceForm
+	if err := app.decodePostForm(r, &form); err != nil || !slices.Contains(maintenanceTasks, form.Task) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	maxAttempts := maintenanceMaxAttempts
+	if form.Task == trendingJobKind {
+		maxAttempts = trendingMaxAttempts
+	}
+	id, err := app.jobs.Enqueue(form.Task, struct{}{}, maxAttempts)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.recordAudit(r, models.AuditMaintenance, fmt.Sprintf("job:%d", id), form.Task)
+
+	task := app.translate(r, "admin_maintenance.task."+form.Task)
+	app.putFlash(r, app.translate(r, "flash.maintenance_queued", task))
+	http.Redirect(w, r, "/admin/maintenance", http.StatusSeeOther)
+}
+
+// reindexJob is the job handler rebuilding the search index
+func (app *application) reindexJob(payload []byte, progress progressFunc) error {
+	n, err := rebuildSearchIndex(app.maintenance, progress)
+	if err != nil {
+		return err
+	}
+
+	app.logger.Info("Rebuilt the search index", "snippets", n)
+	return nil
+}
+
+// vacuumJob is the job handler deleting expired data, along with the files
+// of expired snippets' attachments
+func (app *application) vacuumJob(payload []byte, progress progressFunc) error {
+	stats, err := vacuumExpired(app.maintenance, progress)
+	if err != nil {
+		return err
+	}
+	if app.objects != nil {
+		app.deleteObjects(stats.Files)
+	}
+
+	app.logger.Info("Vacuumed", "stats", formatVacuumStats(stats))
+	return nil
+}
+
+// rebuildSearchIndex recomputes every snippet's search vector in batches,
+// reporting progress after each, and returns how many it rebuilt. Snippets
+// created while it runs are indexed as they are written, so the total is
+// only a guide.
+func rebuildSearchIndex(m models.MaintenanceModelInterface, progress progressFunc) (int, error) {
+	total, err := m.CountSnippets()
+	if err != nil {
+		return 0, err
+	}
+	progress(0, total)
+
+	done, last := 0, 0
+	for {
+		var n int
+		last, n, err = m.RebuildSearch(last, maintenanceBatchSize)
+		if err != nil {
+			return done, err
+		}
+		done += n
+		progress(done, max(done, total))
+		if n < maintenanceBatchSize {
+			return done, nil
+		}
+	}
+}
+
+// vacuumExpired deletes snippets that expired longer ago than the
+// retention period in batches, reporting progress after each, then expired
+// sessions, IP bans, old finished jobs and old delivered outbox events
+func vacuumExpired(m models.MaintenanceModelInterface, progress progressFunc) (vacuumStats, error) {
+	var stats vacuumStats
+
+	total, err := m.CountExpiredSnippets(expiredSnippetRetention)
+	if err != nil {
+		return stats, err
+	}
+	progress(0, total)
+
+	for {
+		n, files, err := m.PruneSnippets(expiredSnippetRetention, maintenanceBatchSize)
+		if err != nil {
+			return stats, err
+		}
+		stats.Snippets += n
+		stats.Files = append(stats.Files, files...)
+		progress(stats.Snippets, max(stats.Snippets, total))
+		if n < maintenanceBatchSize {
+			break
+		}
+	}
+
+	stats.PruneStats, err = m.PruneExpired(finishedJobRetention)
+	return stats, err
+}
+
+// formatVacuumStats describes what vacuuming deleted
+func formatVacuumStats(s vacuumStats) string {
+	return fmt.Sprintf("%d expired snippets with %d attachments, %d sessions, %d IP bans, %d finished jobs and %d delivered events",
+		s.Snippets, len(s.Files), s.Sessions, s.Bans, s.Jobs, s.Events)
+}
+
+// =============================================================================
+// Maintenance Subcommand
+// =============================================================================
+
+// runMaintenance implements `web maintenance TASK`: it runs a maintenance
+// task against the database configured in the environment, printing its
+// progress. It returns the process exit code.
+func runMaintenance(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("maintenance", flag.ContinueOnError)
+	fs.SetOutput(out)
+	fs.Usage = func() {
+		fmt.Fprintln(out, "Usage: web maintenance reindex|trending|vacuum")
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 || !slices.Contains(maintenanceTasks, fs.Arg(0)) {
+		fs.Usage()
+		return 2
+	}
+	task := fs.Arg(0)
+
+	cfg, pool, err := commandDB(false)
+	if err != nil {
+		fmt.Fprintln(out, "maintenance:", err)
+		return 1
+	}
+	defer pool.Close()
+
+	m := &models.MaintenanceModel{DB: pool}
+	progress := func(done, total int) {
+		fmt.Fprintf(out, "%s: %d of %d\n", task, done, total)
+	}
+
+	switch task {
+	case reindexJobKind:
+		n, err := rebuildSearchIndex(m, progress)
+		if err != nil {
+			fmt.Fprintln(out, "maintenance:", err)
+			return 1
+		}
+		fmt.Fprintf(out, "Rebuilt the search index of %d snippets\n", n)
+
+	case trendingJobKind:
+		n, err := (&models.SnippetModel{DB: pool}).RefreshTrending()
+		if err != nil {
+			fmt.Fprintln(out, "maintenance:", err)
+			return 1
+		}
+		fmt.Fprintf(out, "Scored %d trending snippets\n", n)
+
+	case vacuumJobKind:
+		stats, err := vacuumExpired(m, progress)
+		if err != nil {
+			fmt.Fprintln(out, "maintenance:", err)
+			return 1
+		}
+
+		store, err := attachmentStore(cfg)
+		if err != nil {
+			fmt.Fprintln(out, "maintenance:", err)
+			return 1
+		}
+		if store != nil {
+			for _, key := range stats.Files {
+				if err := store.Delete(key); err != nil {
+					fmt.Fprintf(out, "maintenance: delete attachment %s: %v\n", key, err)
+				}
+			}
+		}
+		fmt.Fprintf(out, "Vacuumed %s\n", formatVacuumStats(stats))
+	}
+
+	return 0
+}
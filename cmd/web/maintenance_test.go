@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/testutil"
+)
+
+// maintenanceJobs is a job queue with a reindex running and a vacuum that
+// failed
+type maintenanceJobs struct {
+	fakeJobs
+	kinds []string
+}
+
+func (j *maintenanceJobs) Enqueue(kind string, payload any, maxAttempts int) (int, error) {
+	j.kinds = append(j.kinds, kind)
+	return j.fakeJobs.Enqueue(kind, payload, maxAttempts)
+}
+
+func (j *maintenanceJobs) Recent(kind string, limit int) ([]*models.Job, error) {
+	switch kind {
+	case reindexJobKind:
+		return []*models.Job{{ID: 9, Kind: kind, Status: models.JobRunning, Done: 1500, Total: 4000}}, nil
+	case vacuumJobKind:
+		return []*models.Job{{ID: 4, Kind: kind, Status: models.JobFailed, LastError: "deadlock detected"}}, nil
+	}
+	return nil, nil
+}
+
+func TestAdminMaintenance(t *testing.T) {
+	app := newTestApplication(t)
+	jobs := &maintenanceJobs{}
+	app.jobs = jobs
+	audit := &recordingAudit{}
+	app.audit = audit
+	ts := testutil.NewServer(t, app.routes())
+
+	ts.Login(t, "alice@example.com", "pa$$word")
+	rs := ts.Get(t, "/admin/maintenance")
+	assert.Equal(t, rs.Status, http.StatusForbidden)
+
+	ts.Login(t, "admin@example.com", "pa$$word")
+	rs = ts.Get(t, "/admin/maintenance")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.StringContains(t, rs.Body, `<progress value="1500" max="4000"></progress>`)
+	assert.StringContains(t, rs.Body, "1500 of 4000")
+	assert.StringContains(t, rs.Body, "deadlock detected")
+
+	rs = ts.Submit(t, "/admin/maintenance", "/admin/maintenance", url.Values{"task": {"trending"}})
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/admin/maintenance")
+	assert.DeepEqual(t, jobs.kinds, []string{trendingJobKind})
+	assert.Equal(t, audit.entries[0], auditRecord{3, models.AuditMaintenance, "job:1", "trending"})
+
+	rs = ts.Get(t, "/admin/maintenance")
+	assert.StringContains(t, rs.Body, "Refresh trending scores has been queued.")
+
+	rs = ts.Submit(t, "/admin/maintenance", "/admin/maintenance", url.Values{"task": {"backup"}})
+	assert.Equal(t, rs.Status, http.StatusBadRequest)
+	assert.Equal(t, len(jobs.kinds), 1)
+}
+
+// batchedMaintenance is a maintenance model with n snippets to reindex or
+// prune
+type batchedMaintenance struct {
+	n      int
+	pruned int
+}
+
+func (m *batchedMaintenance) CountSnippets() (int, error) {
+	return m.n, nil
+}
+func (m *batchedMaintenance) RebuildSearch(afterID, limit int) (int, int, error) {
+	n := min(limit, m.n-afterID)
+	return afterID + n, n, nil
+}
+func (m *batchedMaintenance) CountExpiredSnippets(retention time.Duration) (int, error) {
+	return m.n, nil
+}
+func (m *batchedMaintenance) PruneSnippets(retention time.Duration, limit int) (int, []string, error) {
+	n := min(limit, m.n-m.pruned)
+	m.pruned += n
+	if n == 0 {
+		return 0, nil, nil
+	}
+	return n, []string{"attachments/x"}, nil
+}
+func (m *batchedMaintenance) PruneExpired(jobRetention time.Duration) (models.PruneStats, error) {
+	return models.PruneStats{Sessions: 2, Bans: 1, Jobs: 3, Events: 4}, nil
+}
+
+func TestRebuildSearchIndex(t *testing.T) {
+	var reports [][2]int
+	progress := func(done, total int) { reports = append(reports, [2]int{done, total}) }
+
+	n, err := rebuildSearchIndex(&batchedMaintenance{n: 1200}, progress)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 1200)
+	assert.DeepEqual(t, reports, [][2]int{{0, 1200}, {500, 1200}, {1000, 1200}, {1200, 1200}})
+
+	// A whole last batch takes another, empty one to notice the end
+	reports = nil
+	n, err = rebuildSearchIndex(&batchedMaintenance{n: 500}, progress)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 500)
+	assert.DeepEqual(t, reports, [][2]int{{0, 500}, {500, 500}, {500, 500}})
+}
+
+func TestVacuumExpired(t *testing.T) {
+	var last [2]int
+	stats, err := vacuumExpired(&batchedMaintenance{n: 700}, func(done, total int) { last = [2]int{done, total} })
+	assert.NilError(t, err)
+	assert.Equal(t, stats.Snippets, 700)
+	assert.Equal(t, len(stats.Files), 2)
+	assert.Equal(t, stats.PruneStats, models.PruneStats{Sessions: 2, Bans: 1, Jobs: 3, Events: 4})
+	assert.Equal(t, last, [2]int{700, 700})
+	assert.Equal(t, formatVacuumStats(stats), "700 expired snippets with 2 attachments, 2 sessions, 1 IP bans, 3 finished jobs and 4 delivered events")
+}
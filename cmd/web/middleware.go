@@ -2,59 +2,160 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/justinas/nosurf"
+
+	"adotkaya.playground/internal/i18n"
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/validator"
 )
 
 // =============================================================================
 // Security Middleware
 // =============================================================================
 
-// secureHeaders adds security headers to all HTTP responses
-func secureHeaders(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Content Security Policy: Restricts where resources can be loaded from
-		w.Header().Set("Content-Security-Policy",
-			"default-src 'self'; style-src 'self' fonts.googleapis.com; font-src fonts.gstatic.com")
+// secureHeaders adds security headers to all HTTP responses, with the
+// Referrer-Policy and Permissions-Policy given. An empty policy sends no
+// header.
+func secureHeaders(referrerPolicy, permissionsPolicy string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Content Security Policy: Restricts where resources can be loaded from
+			w.Header().Set("Content-Security-Policy",
+				"default-src 'self'; style-src 'self' fonts.googleapis.com; font-src fonts.gstatic.com")
 
-		// Referrer Policy: Controls referrer information
-		w.Header().Set("Referrer-Policy", "origin-when-cross-origin")
+			// Referrer Policy: Controls how much of the page's address other
+			// sites see when a link is followed. Share links carry their token
+			// in the query string.
+			if referrerPolicy != "" {
+				w.Header().Set("Referrer-Policy", referrerPolicy)
+			}
+
+			// Permissions Policy: Turns off browser features the site never uses
+			if permissionsPolicy != "" {
+				w.Header().Set("Permissions-Policy", permissionsPolicy)
+			}
 
-		// X-Content-Type-Options: Prevents MIME-type sniffing
-		w.Header().Set("X-Content-Type-Options", "nosniff")
+			// X-Content-Type-Options: Prevents MIME-type sniffing
+			w.Header().Set("X-Content-Type-Options", "nosniff")
 
-		// X-Frame-Options: Prevents clickjacking by denying framing
-		w.Header().Set("X-Frame-Options", "deny")
+			// X-Frame-Options: Prevents clickjacking by denying framing
+			w.Header().Set("X-Frame-Options", "deny")
 
-		// X-XSS-Protection: Disable legacy XSS filter (rely on CSP instead)
-		w.Header().Set("X-XSS-Protection", "0")
+			// X-XSS-Protection: Disable legacy XSS filter (rely on CSP instead)
+			w.Header().Set("X-XSS-Protection", "0")
 
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// noSurf returns middleware providing CSRF protection for all
+// state-changing requests, except to paths matching one of the exempt
+// path.Match patterns
+func noSurf(exempt []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		csrfHandler := nosurf.New(next)
+		csrfHandler.SetBaseCookie(http.Cookie{
+			HttpOnly: true, // Prevent JavaScript access
+			Path:     "/",
+			Secure:   true, // HTTPS only
+		})
+		csrfHandler.ExemptGlobs(exempt...)
+		return csrfHandler
+	}
+}
+
+// requireCSRFHeader is an alternative to noSurf for routes only called from
+// scripts, such as htmx fragments, which needs no token or cookie. Requests
+// that change state must carry an HX-Request header, which htmx sends on
+// every request and other scripts can send too: forms on other sites can't
+// set headers, and scripts on them would need a CORS preflight, which is
+// never granted. Where the browser says where the request came from, with
+// Sec-Fetch-Site or Origin, it must also be this site.
+func (app *application) requireCSRFHeader(next http.Handler) http.Handler {
+	origins := http.NewCrossOriginProtection()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Header.Get("HX-Request") == "" || origins.Check(r) != nil {
+			app.clientError(w, http.StatusForbidden)
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 }
 
-// noSurf provides CSRF protection for all state-changing requests
-func noSurf(next http.Handler) http.Handler {
-	csrfHandler := nosurf.New(next)
-	csrfHandler.SetBaseCookie(http.Cookie{
-		HttpOnly: true, // Prevent JavaScript access
-		Path:     "/",
-		Secure:   true, // HTTPS only
+// uploadOverhead is the room an upload's body gets on top of the file, for
+// the multipart headers and the CSRF token
+const uploadOverhead = 64 << 10
+
+// limitBody caps request bodies at n bytes, with 413 for ones declared
+// larger. It must come before noSurf, which reads the whole form, files
+// and all, before any handler could check it.
+func (app *application) limitBody(n int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > n {
+				app.clientError(w, http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requestDeadline gives each request's context a deadline a little before
+// the server's write timeout, after which the response could no longer be
+// sent, leaving the rest for the error page. Model calls take the context,
+// so database work stops at the deadline, or as soon as the client goes
+// away, which cancels the context too. Event streams, which outlast the
+// write timeout, only get the latter.
+func (app *application) requestDeadline(next http.Handler) http.Handler {
+	timeout := app.config.Server.WriteTimeout * 9 / 10
+	if timeout <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") == "text/event-stream" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
-	return csrfHandler
 }
 
 // =============================================================================
 // Logging and Error Recovery Middleware
 // =============================================================================
 
-// logRequest logs details about each HTTP request
+// logRequest logs details about each HTTP request once it has been served,
+// with the response's status, size and duration. It picks the requests
+// sampled for debug logging, whose headers are logged as they arrive.
 func (app *application) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		app.infoLog.Printf("%s - %s %s %s", r.RemoteAddr, r.Proto, r.Method, r.URL.RequestURI())
-		next.ServeHTTP(w, r)
+		r = app.logSettings.sampleDebug(r)
+		app.logger.DebugContext(r.Context(), "Request started", "client", app.clientIP(r), "method", r.Method,
+			"uri", r.URL.RequestURI(), debugHeaders(r.Header))
+
+		rw := wrapResponse(w)
+		rw.requestID = requestIDFromContext(r.Context())
+		next.ServeHTTP(rw, r)
+		app.logger.InfoContext(r.Context(), "Request served", "client", app.clientIP(r), "proto", r.Proto, "method", r.Method,
+			"uri", r.URL.RequestURI(), "status", rw.Status(), "size", rw.Written(), "duration", rw.Duration().Round(time.Microsecond))
 	})
 }
 
@@ -64,6 +165,8 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 		// Deferred function will run in the event of a panic
 		defer func() {
 			if err := recover(); err != nil {
+				panicsTotal.WithLabelValues(routePattern(r)).Inc()
+
 				// Set connection close header to trigger Go's HTTP server
 				// to automatically close the current connection
 				w.Header().Set("Connection", "close")
@@ -75,6 +178,68 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
+// =============================================================================
+// Internationalization Middleware
+// =============================================================================
+
+// localeCookieName is the cookie remembering an explicit language choice
+const localeCookieName = "lang"
+
+// detectLocale negotiates the UI locale and adds it to the request context
+//
+// Precedence: the session (set at login from the user's saved preference or
+// by the language switcher while logged in), then the lang cookie, then the
+// Accept-Language header.
+func (app *application) detectLocale(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		locale := localeKey.Get(app.sessionManager, r.Context())
+
+		if !i18n.IsSupported(locale) {
+			locale = ""
+			if c, err := app.cookies.Read(r, localeCookieName); err == nil && i18n.IsSupported(c) {
+				locale = c
+			}
+		}
+
+		if locale == "" {
+			locale = i18n.Match(r.Header.Get("Accept-Language"))
+		}
+
+		// Responses differ by Accept-Language, so caches must key on it
+		w.Header().Add("Vary", "Accept-Language")
+		w.Header().Set("Content-Language", locale)
+
+		ctx := context.WithValue(r.Context(), localeContextKey, locale)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// =============================================================================
+// Theme Middleware
+// =============================================================================
+
+// themeCookieName is the cookie remembering an anonymous visitor's theme
+const themeCookieName = "theme"
+
+// detectTheme adds the visitor's colour theme to the request context, taken
+// from the session (logged-in users) or the theme cookie (anonymous
+// visitors). Anything unrecognised falls back to following the OS setting.
+func (app *application) detectTheme(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		theme := themeKey.Get(app.sessionManager, r.Context())
+		if theme == "" {
+			theme, _ = app.cookies.Read(r, themeCookieName)
+		}
+
+		if !validator.PermittedValue(theme, themes...) {
+			theme = ""
+		}
+
+		ctx := context.WithValue(r.Context(), themeContextKey, theme)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 // =============================================================================
 // Authentication Middleware
 // =============================================================================
@@ -83,43 +248,41 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Retrieve authenticated user ID from session
-		id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+		id := userIDKey.Get(app.sessionManager, r.Context())
 		if id == 0 {
 			// User not authenticated
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		// Check if user still exists in database
-		exists, err := app.users.Exists(id)
-		if err != nil {
+		// Check the user still exists in the database, loading their role and
+		// tier
+		user, err := app.users.Get(id)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
 			app.serverError(w, err)
 			return
 		}
 
-		// If user exists, add isAuthenticated flag to request context
-		if exists {
-			ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
-			r = r.WithContext(ctx)
+		// Sessions logged in before the password last changed are over
+		if user != nil && credentialVersionKey.Get(app.sessionManager, r.Context()) != user.CredentialVersion {
+			userIDKey.Remove(app.sessionManager, r.Context())
+			user = nil
 		}
 
-		next.ServeHTTP(w, r)
-	})
-}
-
-// requireAuthentication redirects unauthenticated users to the login page
-func (app *application) requireAuthentication(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Check if user is authenticated
-		if !app.isAuthenticated(r) {
-			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
-			return
+		// If user exists, add isAuthenticated flag, ID, role and tier to
+		// request context
+		if user != nil {
+			r = r.WithContext(withUser(r.Context(), user))
 		}
 
-		// Set Cache-Control header to prevent browsers from caching pages
-		// that require authentication
-		w.Header().Add("Cache-Control", "no-store")
-
 		next.ServeHTTP(w, r)
 	})
 }
+
+// withUser returns ctx marked as authenticated as user
+func withUser(ctx context.Context, user *models.User) context.Context {
+	ctx = context.WithValue(ctx, isAuthenticatedContextKey, true)
+	ctx = context.WithValue(ctx, userIDContextKey, user.ID)
+	ctx = context.WithValue(ctx, userRoleContextKey, user.Role)
+	return context.WithValue(ctx, userTierContextKey, user.Tier)
+}
@@ -2,12 +2,16 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/models"
 )
 
 func TestSecureHeaders(t *testing.T) {
@@ -24,7 +28,7 @@ func TestSecureHeaders(t *testing.T) {
 	// secureHeaders *returns* a http.Handler we can call its ServeHTTP()
 	// method, passing in the http.ResponseRecorder and dummy http.Request to
 	// execute it.
-	secureHeaders(next).ServeHTTP(rr, r)
+	secureHeaders("origin-when-cross-origin", "camera=(), geolocation=()")(next).ServeHTTP(rr, r)
 
 	rs := rr.Result()
 
@@ -36,6 +40,8 @@ func TestSecureHeaders(t *testing.T) {
 	assert.Equal(t, rs.Header.Get("Referrer-Policy"), expectedValue)
 	// Check that the middleware has correctly set the X-Content-Type-Options
 	// header on the response.
+	expectedValue = "camera=(), geolocation=()"
+	assert.Equal(t, rs.Header.Get("Permissions-Policy"), expectedValue)
 	expectedValue = "nosniff"
 	assert.Equal(t, rs.Header.Get("X-Content-Type-Options"), expectedValue)
 	// Check that the middleware has correctly set the X-Frame-Options header
@@ -55,3 +61,367 @@ func TestSecureHeaders(t *testing.T) {
 	bytes.TrimSpace(body)
 	assert.Equal(t, string(body), "OK")
 }
+
+func TestParseReferrerPolicy(t *testing.T) {
+	tests := []struct {
+		policy  string
+		want    string
+		wantErr bool
+	}{
+		{"no-referrer", "no-referrer", false},
+		{"Strict-Origin-When-Cross-Origin", "strict-origin-when-cross-origin", false},
+		{"no-referrer,strict-origin-when-cross-origin", "no-referrer, strict-origin-when-cross-origin", false},
+		{"origin-only", "", true},
+		{"same-origin, ", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			got, err := parseReferrerPolicy(tt.policy)
+			assert.Equal(t, err != nil, tt.wantErr)
+			assert.Equal(t, got, tt.want)
+		})
+	}
+}
+
+// =============================================================================
+// Middleware Harness
+// =============================================================================
+
+// middlewareCase is one request passed through a single middleware
+type middlewareCase struct {
+	name       string
+	middleware func(http.Handler) http.Handler
+
+	// The request: method (default GET), headers, cookies, values put in the
+	// session and values put in the request context before the middleware
+	// runs
+	method  string
+	header  map[string]string
+	cookies []*http.Cookie
+	session map[string]any
+	context map[contextKey]any
+
+	// next replaces the default handler, which writes 200 "OK"
+	next http.HandlerFunc
+
+	wantStatus int
+	// wantHeader values must appear among the response's values for that
+	// header (so Vary and similar multi-value headers can be checked)
+	wantHeader  map[string]string
+	wantNext    bool
+	wantContext map[contextKey]any
+}
+
+// runMiddlewareCases runs each case through app's session manager, seeding
+// the session and context first, and checks the response and what reached
+// the next handler
+func runMiddlewareCases(t *testing.T, app *application, cases []middlewareCase) {
+	t.Helper()
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var nextCalled bool
+			var nextCtx context.Context
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				nextCalled = true
+				nextCtx = r.Context()
+				if tt.next != nil {
+					tt.next(w, r)
+					return
+				}
+				w.Write([]byte("OK"))
+			})
+
+			seed := func(h http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					for k, v := range tt.session {
+						app.sessionManager.Put(r.Context(), k, v)
+					}
+					ctx := r.Context()
+					for k, v := range tt.context {
+						ctx = context.WithValue(ctx, k, v)
+					}
+					h.ServeHTTP(w, r.WithContext(ctx))
+				})
+			}
+
+			handler := app.sessionManager.LoadAndSave(seed(tt.middleware(next)))
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			r := httptest.NewRequest(method, "https://snippetbox.example.com/", nil)
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			for _, c := range tt.cookies {
+				r.AddCookie(c)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, r)
+
+			assert.Equal(t, rr.Code, tt.wantStatus)
+			for k, v := range tt.wantHeader {
+				assert.StringContains(t, strings.Join(rr.Header().Values(k), ", "), v)
+			}
+			assert.Equal(t, nextCalled, tt.wantNext)
+			for k, v := range tt.wantContext {
+				if nextCtx == nil {
+					t.Fatalf("context value %v: next handler was not called", k)
+				}
+				assert.Equal(t, nextCtx.Value(k), v)
+			}
+		})
+	}
+}
+
+// sealedCookie returns the cookie app writes for name and value
+func sealedCookie(t *testing.T, app *application, name, value string) *http.Cookie {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	if err := app.cookies.Write(rr, &http.Cookie{Name: name, Value: value}); err != nil {
+		t.Fatal(err)
+	}
+	return rr.Result().Cookies()[0]
+}
+
+func TestMiddleware(t *testing.T) {
+	app := newTestApplication(t)
+
+	cases := []middlewareCase{
+		{
+			name:       "secureHeaders",
+			middleware: secureHeaders("no-referrer", ""),
+			wantStatus: http.StatusOK,
+			wantHeader: map[string]string{
+				"Referrer-Policy":        "no-referrer",
+				"X-Frame-Options":        "deny",
+				"X-Content-Type-Options": "nosniff",
+			},
+			wantNext: true,
+		},
+		{
+			name:       "noSurf allows safe methods",
+			middleware: noSurf(nil),
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+		},
+		{
+			name:       "noSurf rejects POST without token",
+			middleware: noSurf(nil),
+			method:     http.MethodPost,
+			header:     map[string]string{"Referer": "https://snippetbox.example.com/"},
+			wantStatus: http.StatusBadRequest,
+			wantNext:   false,
+		},
+		{
+			name:       "noSurf skips exempt paths",
+			middleware: noSurf([]string{"/"}),
+			method:     http.MethodPost,
+			header:     map[string]string{"Referer": "https://snippetbox.example.com/"},
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+		},
+		{
+			name:        "authenticate anonymous",
+			middleware:  app.authenticate,
+			wantStatus:  http.StatusOK,
+			wantNext:    true,
+			wantContext: map[contextKey]any{isAuthenticatedContextKey: nil},
+		},
+		{
+			name:        "authenticate existing user",
+			middleware:  app.authenticate,
+			session:     map[string]any{"authenticatedUserID": 1},
+			wantStatus:  http.StatusOK,
+			wantNext:    true,
+			wantContext: map[contextKey]any{isAuthenticatedContextKey: true, userRoleContextKey: models.RoleUser},
+		},
+		{
+			name:        "authenticate deleted user",
+			middleware:  app.authenticate,
+			session:     map[string]any{"authenticatedUserID": 2},
+			wantStatus:  http.StatusOK,
+			wantNext:    true,
+			wantContext: map[contextKey]any{isAuthenticatedContextKey: nil},
+		},
+		{
+			name:        "detectLocale from Accept-Language",
+			middleware:  app.detectLocale,
+			header:      map[string]string{"Accept-Language": "de-DE,de;q=0.9"},
+			wantStatus:  http.StatusOK,
+			wantHeader:  map[string]string{"Content-Language": "de", "Vary": "Accept-Language"},
+			wantNext:    true,
+			wantContext: map[contextKey]any{localeContextKey: "de"},
+		},
+		{
+			name:        "detectLocale session beats header",
+			middleware:  app.detectLocale,
+			header:      map[string]string{"Accept-Language": "de"},
+			session:     map[string]any{"locale": "tr"},
+			wantStatus:  http.StatusOK,
+			wantNext:    true,
+			wantContext: map[contextKey]any{localeContextKey: "tr"},
+		},
+		{
+			name:        "detectLocale from cookie",
+			middleware:  app.detectLocale,
+			header:      map[string]string{"Accept-Language": "de"},
+			cookies:     []*http.Cookie{sealedCookie(t, app, localeCookieName, "tr")},
+			wantStatus:  http.StatusOK,
+			wantNext:    true,
+			wantContext: map[contextKey]any{localeContextKey: "tr"},
+		},
+		{
+			name:        "detectTheme from cookie",
+			middleware:  app.detectTheme,
+			cookies:     []*http.Cookie{sealedCookie(t, app, themeCookieName, "dark")},
+			wantStatus:  http.StatusOK,
+			wantNext:    true,
+			wantContext: map[contextKey]any{themeContextKey: "dark"},
+		},
+		{
+			name:        "detectTheme ignores unsealed cookie",
+			middleware:  app.detectTheme,
+			cookies:     []*http.Cookie{{Name: themeCookieName, Value: "dark"}},
+			wantStatus:  http.StatusOK,
+			wantNext:    true,
+			wantContext: map[contextKey]any{themeContextKey: ""},
+		},
+		{
+			name:        "detectTheme ignores unknown theme",
+			middleware:  app.detectTheme,
+			cookies:     []*http.Cookie{sealedCookie(t, app, themeCookieName, "purple")},
+			wantStatus:  http.StatusOK,
+			wantNext:    true,
+			wantContext: map[contextKey]any{themeContextKey: ""},
+		},
+		{
+			name:       "recoverPanic",
+			middleware: app.recoverPanic,
+			next:       func(w http.ResponseWriter, r *http.Request) { panic("boom") },
+			wantStatus: http.StatusInternalServerError,
+			wantHeader: map[string]string{"Connection": "close"},
+			wantNext:   true,
+		},
+	}
+
+	runMiddlewareCases(t, app, cases)
+}
+
+func TestRequireCSRFHeader(t *testing.T) {
+	app := newTestApplication(t)
+	cases := []middlewareCase{
+		{
+			name:       "GET without the header",
+			middleware: app.requireCSRFHeader,
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+		},
+		{
+			name:       "POST without the header",
+			middleware: app.requireCSRFHeader,
+			method:     http.MethodPost,
+			header:     map[string]string{"Sec-Fetch-Site": "same-origin"},
+			wantStatus: http.StatusForbidden,
+			wantNext:   false,
+		},
+		{
+			name:       "POST from htmx",
+			middleware: app.requireCSRFHeader,
+			method:     http.MethodPost,
+			header:     map[string]string{"HX-Request": "true", "Sec-Fetch-Site": "same-origin"},
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+		},
+		{
+			name:       "POST from another site",
+			middleware: app.requireCSRFHeader,
+			method:     http.MethodPost,
+			header:     map[string]string{"HX-Request": "true", "Sec-Fetch-Site": "cross-site"},
+			wantStatus: http.StatusForbidden,
+			wantNext:   false,
+		},
+		{
+			name:       "POST from another origin",
+			middleware: app.requireCSRFHeader,
+			method:     http.MethodPost,
+			header:     map[string]string{"HX-Request": "true", "Origin": "https://evil.example.com"},
+			wantStatus: http.StatusForbidden,
+			wantNext:   false,
+		},
+		{
+			name:       "POST from a script without Fetch Metadata",
+			middleware: app.requireCSRFHeader,
+			method:     http.MethodPost,
+			header:     map[string]string{"HX-Request": "true"},
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+		},
+	}
+
+	runMiddlewareCases(t, app, cases)
+}
+
+func TestParsePathPatterns(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    string
+		want    []string
+		wantErr bool
+	}{
+		{"Empty", "", nil, false},
+		{"List", " /hooks/*, /saml/acs ", []string{"/hooks/*", "/saml/acs"}, false},
+		{"Relative", "hooks/*", nil, true},
+		{"Malformed", "/hooks/[", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePathPatterns(tt.list)
+			assert.Equal(t, err != nil, tt.wantErr)
+			assert.DeepEqual(t, got, tt.want)
+		})
+	}
+}
+
+func TestRequestDeadline(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.Server.WriteTimeout = 10 * time.Second
+
+	var deadline time.Time
+	var ok bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline, ok = r.Context().Deadline()
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	app.requestDeadline(next).ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, ok, true)
+	left := time.Until(deadline)
+	assert.Equal(t, left > 8*time.Second && left <= 9*time.Second, true)
+
+	// Event streams run past the write timeout
+	r = httptest.NewRequest(http.MethodGet, "/events", nil)
+	r.Header.Set("Accept", "text/event-stream")
+	app.requestDeadline(next).ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, ok, false)
+
+	app.config.Server.WriteTimeout = 0
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	app.requestDeadline(next).ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, ok, false)
+
+	// Work cut short by the deadline is reported as unavailable
+	app.config.Server.WriteTimeout = 10 * time.Millisecond
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		app.serverError(w, r.Context().Err())
+	})
+	rr := httptest.NewRecorder()
+	app.requestDeadline(slow).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, rr.Code, http.StatusServiceUnavailable)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// =============================================================================
+// Moderation
+// =============================================================================
+
+// moderationQueueSize is the number of snippets shown in the moderation queue
+const moderationQueueSize = 100
+
+// recordAudit logs an action by the current user to the audit log. The
+// action has already happened, so a failure to record it is logged rather
+// than shown to the user.
+func (app *application) recordAudit(r *http.Request, action, target, detail string) {
+	actorID := userIDKey.Get(app.sessionManager, r.Context())
+	if err := app.audit.Record(actorID, action, target, detail); err != nil {
+		app.logger.ErrorContext(r.Context(), "audit", "action", action, "target", target, "error", err)
+	}
+}
+
+// snippetChanged drops cached pages that may show the snippet. Other
+// instances purge theirs when the page cache expires.
+func (app *application) snippetChanged(id int) {
+	app.pages.purge("/", fmt.Sprintf("/snippet/view/%d", id))
+}
+
+// snippetTarget names a snippet in the audit log
+func snippetTarget(id int) string {
+	return fmt.Sprintf("snippet:%d", id)
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/models/mocks"
+	"adotkaya.playground/internal/testutil"
+)
+
+// heldModeration holds every reported snippet
+type heldModeration struct {
+	mocks.ModerationModel
+}
+
+func (m *heldModeration) Report(snippetID, userID int, reason string) (bool, error) {
+	return true, nil
+}
+
+// auditRecord is one call to recordingAudit.Record
+type auditRecord struct {
+	actorID                int
+	action, target, detail string
+}
+
+// recordingAudit keeps the entries it is asked to record
+type recordingAudit struct {
+	mocks.AuditModel
+	entries []auditRecord
+}
+
+func (m *recordingAudit) Record(actorID int, action, target, detail string) error {
+	m.entries = append(m.entries, auditRecord{actorID, action, target, detail})
+	return nil
+}
+
+// moderatorUsers makes Alice a moderator
+type moderatorUsers struct {
+	mocks.UserModel
+}
+
+func (u *moderatorUsers) Get(id int) (*models.User, error) {
+	user, err := u.UserModel.Get(id)
+	if err == nil && id == 1 {
+		user.Role = models.RoleModerator
+	}
+	return user, err
+}
+
+func TestSnippetReportPost(t *testing.T) {
+	tests := []struct {
+		name       string
+		email      string
+		moderation models.ModerationModelInterface
+		path       string
+		reason     string
+		wantCode   int
+		wantRedir  string
+	}{
+		{
+			name:       "Reported",
+			email:      "alice@example.com",
+			moderation: &mocks.ModerationModel{},
+			path:       "/snippet/report/1",
+			reason:     models.ReportSpam,
+			wantCode:   http.StatusSeeOther,
+			wantRedir:  "/snippet/view/1",
+		},
+		{
+			name:       "Held",
+			email:      "alice@example.com",
+			moderation: &heldModeration{},
+			path:       "/snippet/report/1",
+			reason:     models.ReportAbuse,
+			wantCode:   http.StatusSeeOther,
+			wantRedir:  "/",
+		},
+		{
+			name:       "Unknown reason",
+			email:      "alice@example.com",
+			moderation: &mocks.ModerationModel{},
+			path:       "/snippet/report/1",
+			reason:     "boring",
+			wantCode:   http.StatusBadRequest,
+		},
+		{
+			name:       "Non-existent snippet",
+			email:      "alice@example.com",
+			moderation: &mocks.ModerationModel{},
+			path:       "/snippet/report/2",
+			reason:     models.ReportSpam,
+			wantCode:   http.StatusNotFound,
+		},
+		{
+			name:       "Anonymous",
+			moderation: &mocks.ModerationModel{},
+			path:       "/snippet/report/1",
+			reason:     models.ReportSpam,
+			wantCode:   http.StatusSeeOther,
+			wantRedir:  "/user/login",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.moderation = tt.moderation
+			ts := testutil.NewServer(t, app.routes())
+			if tt.email != "" {
+				ts.Login(t, tt.email, "pa$$word")
+			}
+
+			form := url.Values{}
+			form.Add("reason", tt.reason)
+			rs := ts.Submit(t, "/user/login", tt.path, form)
+
+			assert.Equal(t, rs.Status, tt.wantCode)
+			if tt.wantRedir != "" {
+				assert.Equal(t, rs.Header.Get("Location"), tt.wantRedir)
+			}
+		})
+	}
+}
+
+func TestAdminModeration(t *testing.T) {
+	tests := []struct {
+		name      string
+		email     string
+		users     models.UserModelInterface
+		wantCode  int
+		wantBody  []string
+		wantRedir string
+	}{
+		{
+			name:      "Anonymous",
+			users:     &mocks.UserModel{},
+			wantCode:  http.StatusSeeOther,
+			wantRedir: "/user/login",
+		},
+		{
+			name:     "Regular user",
+			email:    "alice@example.com",
+			users:    &mocks.UserModel{},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Moderator",
+			email:    "alice@example.com",
+			users:    &moderatorUsers{},
+			wantCode: http.StatusOK,
+			wantBody: []string{
+				"<h2>Moderation Queue</h2>",
+				"<strong>An old silent pond</strong>",
+				`action="/admin/moderation/1/ban"`,
+				"Abuse or harassment",
+				"Banned IP",
+			},
+		},
+		{
+			name:     "Admin",
+			email:    "admin@example.com",
+			users:    &mocks.UserModel{},
+			wantCode: http.StatusOK,
+			wantBody: []string{
+				"<h2>Moderation Queue</h2>",
+				`<a href="/admin/bans">IP bans</a>`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.users = tt.users
+			ts := testutil.NewServer(t, app.routes())
+			if tt.email != "" {
+				ts.Login(t, tt.email, "pa$$word")
+			}
+
+			rs := ts.Get(t, "/admin/moderation")
+			assert.Equal(t, rs.Status, tt.wantCode)
+			if tt.wantRedir != "" {
+				assert.Equal(t, rs.Header.Get("Location"), tt.wantRedir)
+			}
+			for _, want := range tt.wantBody {
+				assert.StringContains(t, rs.Body, want)
+			}
+		})
+	}
+}
+
+func TestAdminModerationActions(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		wantCode   int
+		wantAction string
+		wantDetail string
+		wantFlash  string
+	}{
+		{
+			name:       "Approve",
+			path:       "/admin/moderation/1/approve",
+			wantCode:   http.StatusSeeOther,
+			wantAction: models.AuditSnippetApprove,
+			wantFlash:  "The snippet has been approved.",
+		},
+		{
+			name:       "Remove",
+			path:       "/admin/moderation/1/remove",
+			wantCode:   http.StatusSeeOther,
+			wantAction: models.AuditSnippetRemove,
+			wantFlash:  "The snippet has been removed.",
+		},
+		{
+			name:       "Ban author",
+			path:       "/admin/moderation/1/ban",
+			wantCode:   http.StatusSeeOther,
+			wantAction: models.AuditUserBan,
+			wantDetail: "user:1",
+			wantFlash:  "The snippet has been removed and its author banned.",
+		},
+		{
+			name:     "Non-existent snippet",
+			path:     "/admin/moderation/2/remove",
+			wantCode: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			audit := &recordingAudit{}
+			app.audit = audit
+			ts := testutil.NewServer(t, app.routes())
+			ts.Login(t, "admin@example.com", "pa$$word")
+
+			rs := ts.Submit(t, "/admin/moderation", tt.path, url.Values{})
+			assert.Equal(t, rs.Status, tt.wantCode)
+			if tt.wantCode != http.StatusSeeOther {
+				assert.Equal(t, len(audit.entries), 0)
+				return
+			}
+
+			assert.Equal(t, rs.Header.Get("Location"), "/admin/moderation")
+			assert.Equal(t, len(audit.entries), 1)
+			assert.Equal(t, audit.entries[0], auditRecord{3, tt.wantAction, "snippet:1", tt.wantDetail})
+
+			rs = ts.Get(t, "/admin/moderation")
+			assert.StringContains(t, rs.Body, tt.wantFlash)
+		})
+	}
+}
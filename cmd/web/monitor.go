@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// =============================================================================
+// Database Pool Monitor
+// =============================================================================
+
+// poolStatus is a point-in-time summary of database pool health
+type poolStatus struct {
+	Healthy        bool          `json:"healthy"`
+	Error          string        `json:"error,omitempty"`
+	LastCheck      time.Time     `json:"last_check"`
+	PingLatency    time.Duration `json:"ping_latency_ns"`
+	AvgAcquireWait time.Duration `json:"avg_acquire_wait_ns"`
+	Saturated      bool          `json:"saturated"`
+	AcquiredConns  int32         `json:"acquired_conns"`
+	IdleConns      int32         `json:"idle_conns"`
+	MaxConns       int32         `json:"max_conns"`
+}
+
+// poolMonitor periodically pings the database pool and tracks how long
+// requests wait to acquire a connection, so problems surface in /health and
+// /metrics before users notice them
+type poolMonitor struct {
+	pool     *pgxpool.Pool
+	interval time.Duration
+	logger   *slog.Logger
+
+	mu     sync.RWMutex
+	status poolStatus
+
+	// Counters from the previous check, used to compute per-interval deltas
+	prevEmptyAcquireCount int64
+	prevEmptyAcquireWait  time.Duration
+}
+
+// newPoolMonitor creates a monitor for the given pool
+func newPoolMonitor(pool *pgxpool.Pool, interval time.Duration, logger *slog.Logger) *poolMonitor {
+	return &poolMonitor{
+		pool:     pool,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// run checks the pool once immediately and then on every interval until ctx
+// is cancelled
+func (m *poolMonitor) run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		m.check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check pings the pool, samples its statistics and logs state changes
+func (m *poolMonitor) check(ctx context.Context) {
+	pingCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	err := m.pool.Ping(pingCtx)
+	latency := time.Since(start)
+
+	stat := m.pool.Stat()
+
+	// Average wait of acquires that found no idle connection since last check
+	var avgWait time.Duration
+	waits := stat.EmptyAcquireCount() - m.prevEmptyAcquireCount
+	if waits > 0 {
+		avgWait = (stat.EmptyAcquireWaitTime() - m.prevEmptyAcquireWait) / time.Duration(waits)
+	}
+	m.prevEmptyAcquireCount = stat.EmptyAcquireCount()
+	m.prevEmptyAcquireWait = stat.EmptyAcquireWaitTime()
+
+	status := poolStatus{
+		Healthy:        err == nil,
+		LastCheck:      start,
+		PingLatency:    latency,
+		AvgAcquireWait: avgWait,
+		Saturated:      stat.AcquiredConns() >= stat.MaxConns(),
+		AcquiredConns:  stat.AcquiredConns(),
+		IdleConns:      stat.IdleConns(),
+		MaxConns:       stat.MaxConns(),
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	m.mu.Lock()
+	prev := m.status
+	m.status = status
+	m.mu.Unlock()
+
+	// Log only on transitions to avoid flooding the logs
+	switch {
+	case err != nil && (prev.Healthy || prev.LastCheck.IsZero()):
+		m.logger.Error("database ping failed", "error", err)
+	case err == nil && !prev.Healthy && !prev.LastCheck.IsZero():
+		m.logger.Info("database ping recovered")
+	}
+	if status.Saturated && !prev.Saturated {
+		m.logger.Error("database pool saturated", "acquired_conns", status.AcquiredConns,
+			"max_conns", status.MaxConns, "avg_acquire_wait", avgWait)
+	}
+}
+
+// snapshot returns the result of the most recent check
+func (m *poolMonitor) snapshot() poolStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.status
+}
+
+// =============================================================================
+// Prometheus Collectors
+// =============================================================================
+
+// collectors returns gauges exposing the monitored pool state
+func (m *poolMonitor) collectors() []prometheus.Collector {
+	gauge := func(name, help string, value func(poolStatus) float64) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "snippetbox",
+			Subsystem: "db_pool",
+			Name:      name,
+			Help:      help,
+		}, func() float64 { return value(m.snapshot()) })
+	}
+
+	boolValue := func(b bool) float64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+
+	return []prometheus.Collector{
+		gauge("healthy", "Whether the last database ping succeeded.",
+			func(s poolStatus) float64 { return boolValue(s.Healthy) }),
+		gauge("saturated", "Whether every pool connection was in use at the last check.",
+			func(s poolStatus) float64 { return boolValue(s.Saturated) }),
+		gauge("ping_seconds", "Latency of the last database ping.",
+			func(s poolStatus) float64 { return s.PingLatency.Seconds() }),
+		gauge("acquire_wait_seconds", "Average connection acquire wait since the previous check.",
+			func(s poolStatus) float64 { return s.AvgAcquireWait.Seconds() }),
+		gauge("acquired_conns", "Connections currently checked out of the pool.",
+			func(s poolStatus) float64 { return float64(s.AcquiredConns) }),
+		gauge("idle_conns", "Idle connections in the pool.",
+			func(s poolStatus) float64 { return float64(s.IdleConns) }),
+		gauge("max_conns", "Maximum size of the pool.",
+			func(s poolStatus) float64 { return float64(s.MaxConns) }),
+	}
+}
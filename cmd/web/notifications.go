@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/hmac"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"adotkaya.playground/internal/models"
+)
+
+// =============================================================================
+// Notification Emails
+// =============================================================================
+
+// inboxSize is the number of notifications shown on the notifications page
+const inboxSize = 50
+
+// notify queues a notification email to a user, unless they have opted out
+// of that kind. Every notification producer must send through here, or
+// notificationEmail, so preferences are respected and each email carries an
+// unsubscribe link.
+//
+// data is passed to the template with UnsubscribeURL added.
+func (app *application) notify(userID int, kind, templateFile string, data map[string]any) error {
+	mail, err := app.notificationEmail(userID, kind, templateFile, data)
+	if err != nil || mail == nil {
+		return err
+	}
+
+	return app.sendMail(mail.Recipient, mail.Template, mail.Data)
+}
+
+// notificationEmail builds the email job notifying a user, or returns nil
+// if they have opted out of that kind
+func (app *application) notificationEmail(userID int, kind, templateFile string, data map[string]any) (*emailJob, error) {
+	prefs, err := app.users.NotificationPreferences(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !prefs[kind] {
+		return nil, nil
+	}
+
+	user, err := app.users.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if data == nil {
+		data = map[string]any{}
+	}
+	data["UnsubscribeURL"] = app.unsubscribeURL(userID, kind)
+
+	return &emailJob{Recipient: user.Email, Template: templateFile, Data: data}, nil
+}
+
+// activity is something a user did that concerns another user, such as
+// following them or commenting on their snippet
+type activity struct {
+	UserID   int            // Who to notify
+	ActorID  int            // Who did it
+	Kind     string         // One of the models.Notify* kinds
+	Link     string         // Path of the page the activity is about
+	Detail   string         // Kind-specific text, such as a snippet title
+	Template string         // Email template
+	Data     map[string]any // Email template data
+}
+
+// activityDelivery is what the outbox relay writes for an activity: an
+// in-app notification and, unless the user has opted out, an email
+func (app *application) activityDelivery(a activity) (models.OutboxDelivery, error) {
+	delivery := models.OutboxDelivery{
+		Notification: &models.NewNotification{
+			UserID:  a.UserID,
+			ActorID: a.ActorID,
+			Kind:    a.Kind,
+			Link:    a.Link,
+			Detail:  a.Detail,
+		},
+	}
+
+	mail, err := app.notificationEmail(a.UserID, a.Kind, a.Template, a.Data)
+	if err != nil {
+		return models.OutboxDelivery{}, err
+	}
+	if mail != nil {
+		delivery.Jobs = append(delivery.Jobs, models.NewJob{Kind: emailJobKind, Payload: *mail, MaxAttempts: emailMaxAttempts})
+	}
+	return delivery, nil
+}
+
+// unreadNotifications returns the number of unread in-app notifications for
+// the nav badge. A failed lookup is logged and shows no badge rather than
+// failing the page.
+func (app *application) unreadNotifications(r *http.Request) int {
+	if !app.isAuthenticated(r) {
+		return 0
+	}
+
+	id := userIDKey.Get(app.sessionManager, r.Context())
+	count, err := app.notifications.UnreadCount(id)
+	if err != nil {
+		app.logger.ErrorContext(r.Context(), "unread notifications", "user_id", id, "error", err)
+		return 0
+	}
+	return count
+}
+
+// notificationPref is one row of the preferences form
+type notificationPref struct {
+	Kind    string
+	Enabled bool
+}
+
+// notificationPrefs orders a user's preferences for display
+func notificationPrefs(prefs map[string]bool) []notificationPref {
+	list := make([]notificationPref, 0, len(models.NotificationKinds))
+	for _, kind := range models.NotificationKinds {
+		list = append(list, notificationPref{Kind: kind, Enabled: prefs[kind]})
+	}
+	return list
+}
+
+// =============================================================================
+// Unsubscribe Links
+// =============================================================================
+
+// unsubscribeURL returns an absolute link that turns off one notification
+// kind for a user without logging in
+func (app *application) unsubscribeURL(userID int, kind string) string {
+	q := url.Values{}
+	q.Set("user", strconv.Itoa(userID))
+	q.Set("kind", kind)
+	q.Set("token", app.unsubscribeToken(userID, kind))
+	return app.canonicalURL("/unsubscribe?" + q.Encode())
+}
+
+// unsubscribeToken signs the user and kind with the secret key, so links
+// can't be forged to unsubscribe someone else
+func (app *application) unsubscribeToken(userID int, kind string) string {
+	return app.sign(fmt.Sprintf("unsubscribe:%d:%s", userID, kind))
+}
+
+// validUnsubscribeToken reports whether token was issued for this user and
+// kind
+func (app *application) validUnsubscribeToken(userID int, kind, token string) bool {
+	return hmac.Equal([]byte(token), []byte(app.unsubscribeToken(userID, kind)))
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/models/mocks"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestNotify(t *testing.T) {
+	app := newTestApplication(t)
+	jobs := &fakeJobs{}
+	app.jobs = jobs
+
+	// Announcements are opt-in, so nothing is queued
+	err := app.notify(1, models.NotifyAnnouncements, "announcement.tmpl", nil)
+	assert.NilError(t, err)
+	assert.Equal(t, len(jobs.enqueued), 0)
+
+	err = app.notify(1, models.NotifyComments, "comment.tmpl", map[string]any{"Snippet": "An old silent pond"})
+	assert.NilError(t, err)
+	assert.Equal(t, len(jobs.enqueued), 1)
+
+	job := jobs.enqueued[0].(emailJob)
+	assert.Equal(t, job.Recipient, "alice@example.com")
+	assert.Equal(t, job.Template, "comment.tmpl")
+	assert.StringContains(t, job.Data["UnsubscribeURL"].(string), "https://snippetbox.example.com/unsubscribe?kind=comments&token=")
+}
+
+// optedOutUsers turns every notification email off
+type optedOutUsers struct {
+	mocks.UserModel
+}
+
+func (u *optedOutUsers) NotificationPreferences(id int) (map[string]bool, error) {
+	return map[string]bool{}, nil
+}
+
+func TestActivityDelivery(t *testing.T) {
+	a := activity{
+		UserID:   1,
+		ActorID:  3,
+		Kind:     models.NotifyComments,
+		Link:     "/snippet/view/1",
+		Detail:   "An old silent pond",
+		Template: "comment.tmpl",
+	}
+
+	tests := []struct {
+		name      string
+		users     models.UserModelInterface
+		wantMails int
+	}{
+		{"Subscribed", &mocks.UserModel{}, 1},
+		{"Opted out", &optedOutUsers{}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.users = tt.users
+
+			delivery, err := app.activityDelivery(a)
+			assert.NilError(t, err)
+
+			// The in-app notification is recorded either way
+			assert.DeepEqual(t, delivery.Notification, &models.NewNotification{UserID: 1, ActorID: 3, Kind: a.Kind, Link: a.Link, Detail: a.Detail})
+			assert.Equal(t, len(delivery.Jobs), tt.wantMails)
+			if tt.wantMails > 0 {
+				assert.Equal(t, delivery.Jobs[0].Kind, emailJobKind)
+				assert.Equal(t, delivery.Jobs[0].Payload.(emailJob).Recipient, "alice@example.com")
+			}
+		})
+	}
+}
+
+func TestInbox(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+
+	rs := ts.Get(t, "/notifications")
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/user/login")
+
+	ts.Login(t, "alice@example.com", "pa$$word")
+
+	rs = ts.Get(t, "/")
+	assert.StringContains(t, rs.Body, `<a href="/notifications">Notifications <span class="badge">1</span></a>`)
+
+	rs = ts.Get(t, "/notifications")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.StringContains(t, rs.Body, `<li class="unread">`)
+	assert.StringContains(t, rs.Body, "Carol started following you.")
+	assert.StringContains(t, rs.Body, `<a href="/notifications">Notifications</a>`)
+}
+
+func TestUnsubscribe(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+
+	link, err := url.Parse(app.unsubscribeURL(1, models.NotifyComments))
+	assert.NilError(t, err)
+	validPath := link.RequestURI()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+	}{
+		{"Valid link", validPath, http.StatusOK},
+		{"Other user", strings.Replace(validPath, "user=1", "user=2", 1), http.StatusBadRequest},
+		{"Other kind", strings.Replace(validPath, "kind=comments", "kind=followers", 1), http.StatusBadRequest},
+		{"Unknown kind", "/unsubscribe?kind=spam&user=1&token=x", http.StatusBadRequest},
+		{"No token", "/unsubscribe?kind=comments&user=1", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := ts.Get(t, tt.urlPath)
+			assert.Equal(t, rs.Status, tt.wantCode)
+		})
+	}
+
+	t.Run("Confirm without login", func(t *testing.T) {
+		rs := ts.Get(t, validPath)
+		assert.StringContains(t, rs.Body, "Stop receiving emails about: Comments on my snippets?")
+
+		form := url.Values{}
+		form.Add("user", "1")
+		form.Add("kind", models.NotifyComments)
+		form.Add("token", link.Query().Get("token"))
+		rs = ts.Submit(t, validPath, "/unsubscribe", form)
+		assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/")
+
+		form.Set("token", "forged")
+		rs = ts.Submit(t, validPath, "/unsubscribe", form)
+		assert.Equal(t, rs.Status, http.StatusBadRequest)
+	})
+}
+
+func TestAccountNotifications(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+
+	rs := ts.Get(t, "/account/notifications")
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/user/login")
+
+	ts.Login(t, "alice@example.com", "pa$$word")
+
+	rs = ts.Get(t, "/account/notifications")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.StringContains(t, rs.Body, `<input type="checkbox" name="enabled" value="comments" checked />`)
+	assert.StringContains(t, rs.Body, `<input type="checkbox" name="enabled" value="announcements"  />`)
+
+	form := url.Values{}
+	form.Add("enabled", models.NotifyAnnouncements)
+	rs = ts.Submit(t, "/account/notifications", "/account/notifications", form)
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/account/notifications")
+
+	form.Set("enabled", "spam")
+	rs = ts.Submit(t, "/account/notifications", "/account/notifications", form)
+	assert.Equal(t, rs.Status, http.StatusBadRequest)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"adotkaya.playground/internal/models"
+)
+
+// =============================================================================
+// Outbox Relay
+// =============================================================================
+// Changes that notify someone, such as a new follow, write an event to the
+// outbox in the same transaction as the change, rather than notifying from
+// the request, which could crash between the two. The relay turns each
+// event into what it causes and writes that in one transaction with
+// marking the event delivered, so a crash at any point neither loses a
+// notification nor sends it twice. Every instance runs a relay.
+
+// outboxBatchSize is how many events the relay delivers per poll
+const outboxBatchSize = 100
+
+// relayOutbox delivers pending outbox events until ctx is cancelled,
+// sleeping for interval whenever none are left
+func (app *application) relayOutbox(ctx context.Context, interval time.Duration) {
+	for {
+		for app.relayBatch() == outboxBatchSize {
+			if ctx.Err() != nil {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// relayBatch delivers up to outboxBatchSize pending events, and returns how
+// many it delivered
+func (app *application) relayBatch() int {
+	events, err := app.outbox.Pending(outboxBatchSize)
+	if err != nil {
+		app.logger.Error("outbox", "error", err)
+		return 0
+	}
+
+	delivered := 0
+	for _, e := range events {
+		if err := app.relayEvent(e); err != nil {
+			app.logger.Error("outbox delivery", "event_id", e.ID, "kind", e.Kind, "attempt", e.Attempts+1, "error", err)
+			if err := app.outbox.Failed(e.ID, err.Error()); err != nil {
+				app.logger.Error("outbox: recording failure", "event_id", e.ID, "error", err)
+			}
+			continue
+		}
+		delivered++
+	}
+	return delivered
+}
+
+// relayEvent delivers one event. Events about users or snippets that have
+// since been deleted are marked delivered without doing anything.
+func (app *application) relayEvent(e *models.OutboxEvent) error {
+	delivery, err := app.outboxDelivery(e)
+	if errors.Is(err, models.ErrNoRecord) {
+		delivery, err = models.OutboxDelivery{}, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = app.outbox.Deliver(e.ID, delivery)
+	return err
+}
+
+// outboxDelivery works out what delivering an event writes
+func (app *application) outboxDelivery(e *models.OutboxEvent) (models.OutboxDelivery, error) {
+	switch e.Kind {
+	case models.EventUserFollowed:
+		var ev models.UserFollowedEvent
+		if err := json.Unmarshal(e.Payload, &ev); err != nil {
+			return models.OutboxDelivery{}, err
+		}
+		return app.newFollowerDelivery(ev.FollowerID, ev.FollowedID)
+
+	default:
+		return models.OutboxDelivery{}, fmt.Errorf("unknown event kind %q", e.Kind)
+	}
+}
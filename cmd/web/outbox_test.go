@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/mailer"
+	"adotkaya.playground/internal/models"
+)
+
+// fakeOutbox is an in-memory outbox recording deliveries and failures
+type fakeOutbox struct {
+	events    []*models.OutboxEvent
+	delivered map[int]models.OutboxDelivery
+	failed    map[int]string
+}
+
+func (f *fakeOutbox) Pending(limit int) ([]*models.OutboxEvent, error) {
+	pending := []*models.OutboxEvent{}
+	for _, e := range f.events {
+		if _, ok := f.delivered[e.ID]; !ok && e.Attempts < models.OutboxMaxAttempts {
+			pending = append(pending, e)
+		}
+	}
+	return pending, nil
+}
+func (f *fakeOutbox) Deliver(id int, delivery models.OutboxDelivery) (bool, error) {
+	if _, ok := f.delivered[id]; ok {
+		return false, nil
+	}
+	f.delivered[id] = delivery
+	return true, nil
+}
+func (f *fakeOutbox) Failed(id int, errMsg string) error {
+	for _, e := range f.events {
+		if e.ID == id {
+			e.Attempts++
+		}
+	}
+	f.failed[id] = errMsg
+	return nil
+}
+
+// followedEvent returns an EventUserFollowed outbox event
+func followedEvent(t *testing.T, id, followerID, followedID int) *models.OutboxEvent {
+	payload, err := json.Marshal(models.UserFollowedEvent{FollowerID: followerID, FollowedID: followedID})
+	assert.NilError(t, err)
+	return &models.OutboxEvent{ID: id, Kind: models.EventUserFollowed, Payload: payload}
+}
+
+func TestRelayOutbox(t *testing.T) {
+	app := newTestApplication(t)
+	outbox := &fakeOutbox{
+		events: []*models.OutboxEvent{
+			followedEvent(t, 1, 1, 3),
+			followedEvent(t, 2, 2, 3), // Follower since deleted
+			{ID: 3, Kind: "snippet.exploded", Payload: json.RawMessage(`{}`)},
+		},
+		delivered: map[int]models.OutboxDelivery{},
+		failed:    map[int]string{},
+	}
+	app.outbox = outbox
+
+	assert.Equal(t, app.relayBatch(), 2)
+
+	// A new follower is notified in-app and by email
+	delivery := outbox.delivered[1]
+	assert.DeepEqual(t, delivery.Notification, &models.NewNotification{
+		UserID: 3, ActorID: 1, Kind: models.NotifyFollowers, Link: "/user/profile/1",
+	})
+	assert.Equal(t, len(delivery.Jobs), 1)
+	mail := delivery.Jobs[0].Payload.(emailJob)
+	assert.Equal(t, mail.Recipient, "admin@example.com")
+	msg, err := mailer.Render(mail.Recipient, mail.Template, mail.Data)
+	assert.NilError(t, err)
+	assert.StringContains(t, msg.Subject, "Alice is now following you")
+
+	// Nothing is left to say about a deleted follower
+	assert.DeepEqual(t, outbox.delivered[2], models.OutboxDelivery{})
+
+	// Events that can't be delivered are retried until they run out of
+	// attempts
+	assert.StringContains(t, outbox.failed[3], `unknown event kind "snippet.exploded"`)
+	for range models.OutboxMaxAttempts {
+		app.relayBatch()
+	}
+	assert.Equal(t, outbox.events[2].Attempts, models.OutboxMaxAttempts)
+	_, delivered := outbox.delivered[3]
+	assert.Equal(t, delivered, false)
+}
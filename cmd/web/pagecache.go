@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/justinas/nosurf"
+)
+
+// =============================================================================
+// Anonymous Page Cache
+// =============================================================================
+
+// csrfPlaceholder stands in for the CSRF token in cacheable pages. It is
+// replaced with each visitor's own token whenever the page is served.
+const csrfPlaceholder = "__csrf_token_placeholder__"
+
+// cachedPage is a stored 200 response
+type cachedPage struct {
+	path       string
+	header     http.Header
+	body       []byte
+	stored     time.Time
+	refreshing bool // A background refresh is running
+}
+
+// cacheState is the outcome of a page cache lookup
+type cacheState int
+
+const (
+	cacheMiss  cacheState = iota
+	cacheFresh            // Serve as is
+	cacheStale            // Serve, and refresh in the background
+)
+
+// pageCache holds rendered pages for anonymous visitors. Pages are served
+// fresh for ttl, then served stale for up to stale longer while a single
+// background request refreshes them.
+type pageCache struct {
+	ttl        time.Duration
+	stale      time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mu    sync.Mutex
+	pages map[string]*cachedPage
+}
+
+// newPageCache creates a page cache holding at most maxEntries pages
+func newPageCache(ttl, stale time.Duration, maxEntries int) *pageCache {
+	return &pageCache{
+		ttl:        ttl,
+		stale:      stale,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		pages:      make(map[string]*cachedPage),
+	}
+}
+
+// lookup returns the page stored under key and whether it may be served.
+// A stale result is only returned to one caller at a time, which becomes
+// responsible for refreshing the page; others get it as fresh meanwhile.
+func (c *pageCache) lookup(key string) (*cachedPage, cacheState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	page, ok := c.pages[key]
+	if !ok {
+		return nil, cacheMiss
+	}
+
+	age := c.now().Sub(page.stored)
+	switch {
+	case age < c.ttl:
+		return page, cacheFresh
+	case age >= c.ttl+c.stale:
+		delete(c.pages, key)
+		return nil, cacheMiss
+	case page.refreshing:
+		return page, cacheFresh
+	default:
+		page.refreshing = true
+		return page, cacheStale
+	}
+}
+
+// store saves a recorded response under key if it was a 200, otherwise it
+// drops whatever was stored there
+func (c *pageCache) store(key, path string, rec *pageRecorder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if rec.status != http.StatusOK {
+		delete(c.pages, key)
+		return
+	}
+
+	if _, ok := c.pages[key]; !ok && len(c.pages) >= c.maxEntries {
+		c.sweep()
+		if len(c.pages) >= c.maxEntries {
+			return
+		}
+	}
+
+	// Cookies belong to the visitor who triggered the render
+	header := rec.header.Clone()
+	header.Del("Set-Cookie")
+	header.Del("Content-Length")
+
+	c.pages[key] = &cachedPage{
+		path:   path,
+		header: header,
+		body:   rec.body.Bytes(),
+		stored: c.now(),
+	}
+}
+
+// sweep drops pages too old to be served. The caller must hold the lock.
+func (c *pageCache) sweep() {
+	for key, page := range c.pages {
+		if c.now().Sub(page.stored) >= c.ttl+c.stale {
+			delete(c.pages, key)
+		}
+	}
+}
+
+// purge drops every cached variant of the given paths. It is safe to call
+// on a nil cache.
+func (c *pageCache) purge(paths ...string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, page := range c.pages {
+		for _, path := range paths {
+			if page.path == path {
+				delete(c.pages, key)
+			}
+		}
+	}
+}
+
+// purgeAll drops every cached page, for changes shown on all of them. It is
+// safe to call on a nil cache.
+func (c *pageCache) purgeAll() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	clear(c.pages)
+}
+
+// pageRecorder is a ResponseWriter capturing a response so it can be cached
+type pageRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newPageRecorder() *pageRecorder {
+	return &pageRecorder{header: http.Header{}, status: http.StatusOK}
+}
+
+func (rec *pageRecorder) Header() http.Header         { return rec.header }
+func (rec *pageRecorder) Write(b []byte) (int, error) { return rec.body.Write(b) }
+func (rec *pageRecorder) WriteHeader(status int)      { rec.status = status }
+
+// =============================================================================
+// Page Cache Middleware
+// =============================================================================
+
+// cachePage serves anonymous GET requests from the page cache. Visitors who
+// are logged in, have a flash message waiting or own anonymous snippets
+// always get a fresh render.
+//
+// Cached pages vary on the path, locale, theme and whether the request came
+// from htmx. Pages are rendered with a placeholder CSRF token, swapped for
+// the visitor's own token on the way out, so cached forms keep working.
+func (app *application) cachePage(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.pages == nil || r.Method != http.MethodGet || app.isAuthenticated(r) ||
+			flashesKey.Exists(app.sessionManager, r.Context()) || hasCookie(r, ownedSnippetsCookie) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := strings.Join([]string{r.URL.RequestURI(), app.locale(r), app.theme(r), r.Header.Get("HX-Request")}, "\x00")
+		r = r.WithContext(context.WithValue(r.Context(), pageCacheContextKey, true))
+
+		page, state := app.pages.lookup(key)
+		switch state {
+		case cacheFresh:
+			w.Header().Set("X-Cache", "HIT")
+			writeCachedPage(w, r, http.StatusOK, page.header, page.body)
+		case cacheStale:
+			w.Header().Set("X-Cache", "STALE")
+			writeCachedPage(w, r, http.StatusOK, page.header, page.body)
+			go app.refreshPage(next, r, key)
+		default:
+			rec := newPageRecorder()
+			next.ServeHTTP(rec, r)
+			app.pages.store(key, r.URL.Path, rec)
+
+			w.Header().Set("X-Cache", "MISS")
+			writeCachedPage(w, r, rec.status, rec.header, rec.body.Bytes())
+		}
+	})
+}
+
+// refreshPage renders a stale page again in the background
+func (app *application) refreshPage(next http.Handler, r *http.Request, key string) {
+	rec := newPageRecorder()
+	defer func() {
+		if err := recover(); err != nil {
+			app.logger.ErrorContext(r.Context(), "page cache refresh", "path", r.URL.Path, "error", err)
+			rec.status = http.StatusInternalServerError
+		}
+		app.pages.store(key, r.URL.Path, rec)
+	}()
+
+	next.ServeHTTP(rec, r.Clone(context.WithoutCancel(r.Context())))
+}
+
+// writeCachedPage writes a recorded response, filling in the visitor's CSRF
+// token
+func writeCachedPage(w http.ResponseWriter, r *http.Request, status int, header http.Header, body []byte) {
+	for name, values := range header {
+		for _, v := range values {
+			w.Header().Add(name, v)
+		}
+	}
+
+	token := template.HTMLEscapeString(nosurf.Token(r))
+	body = bytes.ReplaceAll(body, []byte(csrfPlaceholder), []byte(token))
+
+	w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// csrfToken returns the token for forms in the page, or the placeholder if
+// the page may be cached
+func csrfToken(r *http.Request) string {
+	if cacheable, _ := r.Context().Value(pageCacheContextKey).(bool); cacheable {
+		return csrfPlaceholder
+	}
+	return nosurf.Token(r)
+}
+
+// =============================================================================
+// View Counting
+// =============================================================================
+
+// countView records a view of the snippet in the :id route parameter. It
+// runs in front of the page cache so views served from the cache count too.
+func (app *application) countView(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(httprouter.ParamsFromContext(r.Context()).ByName("id"))
+		if err == nil && id > 0 {
+			// A failed view count shouldn't stop the snippet being shown
+			if err := app.snippets.RecordView(id); err != nil {
+				app.logger.ErrorContext(r.Context(), "record view", "error", err)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
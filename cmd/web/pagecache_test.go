@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestPageCache(t *testing.T) {
+	app := newTestApplication(t)
+	app.pages = newPageCache(time.Minute, time.Minute, 10)
+	h := app.routes()
+
+	// Two anonymous visitors and a logged in one, sharing the cache
+	alice := testutil.NewServer(t, h)
+	bob := testutil.NewServer(t, h)
+	carol := testutil.NewServer(t, h)
+	carol.Login(t, "admin@example.com", "pa$$word")
+
+	rs := alice.Get(t, "/")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.Equal(t, rs.Header.Get("X-Cache"), "MISS")
+	aliceToken := testutil.ExtractCSRFToken(t, rs.Body)
+
+	rs = bob.Get(t, "/")
+	assert.Equal(t, rs.Header.Get("X-Cache"), "HIT")
+	bobToken := testutil.ExtractCSRFToken(t, rs.Body)
+	assert.Equal(t, bobToken == aliceToken, false)
+
+	t.Run("Forms in cached pages work", func(t *testing.T) {
+		rs := bob.Submit(t, "/", "/user/theme", url.Values{"theme": {"dark"}})
+		assert.Equal(t, rs.Status, http.StatusSeeOther)
+	})
+
+	t.Run("Varies on theme", func(t *testing.T) {
+		rs := bob.Get(t, "/")
+		assert.Equal(t, rs.Header.Get("X-Cache"), "MISS")
+	})
+
+	t.Run("Logged in bypasses cache", func(t *testing.T) {
+		rs := carol.Get(t, "/")
+		assert.Equal(t, rs.Status, http.StatusOK)
+		assert.Equal(t, rs.Header.Get("X-Cache"), "")
+	})
+
+	t.Run("Not found is not cached", func(t *testing.T) {
+		for range 2 {
+			rs := alice.Get(t, "/snippet/view/2")
+			assert.Equal(t, rs.Status, http.StatusNotFound)
+			assert.Equal(t, rs.Header.Get("X-Cache"), "MISS")
+		}
+	})
+
+	t.Run("Stale while revalidate", func(t *testing.T) {
+		later := time.Now().Add(90 * time.Second)
+		app.pages.now = func() time.Time { return later }
+		defer func() { app.pages.now = time.Now }()
+
+		rs := alice.Get(t, "/")
+		assert.Equal(t, rs.Header.Get("X-Cache"), "STALE")
+		assert.Equal(t, rs.Status, http.StatusOK)
+
+		// Wait for the background render to replace the page
+		deadline := time.Now().Add(time.Second)
+		for !storedAt(app.pages, "/", later) {
+			if time.Now().After(deadline) {
+				t.Fatal("page was not refreshed")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+
+	t.Run("Purge", func(t *testing.T) {
+		app.pages.purge("/")
+		rs := alice.Get(t, "/")
+		assert.Equal(t, rs.Header.Get("X-Cache"), "MISS")
+	})
+
+	t.Run("Purge all", func(t *testing.T) {
+		app.pages.purgeAll()
+		rs := alice.Get(t, "/")
+		assert.Equal(t, rs.Header.Get("X-Cache"), "MISS")
+	})
+}
+
+func TestPageCacheLookup(t *testing.T) {
+	start := time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC)
+	now := start
+
+	c := newPageCache(10*time.Second, 30*time.Second, 1)
+	c.now = func() time.Time { return now }
+
+	rec := newPageRecorder()
+	rec.body.WriteString("page")
+	c.store("a", "/a", rec)
+
+	_, state := c.lookup("a")
+	assert.Equal(t, state, cacheFresh)
+
+	// Only the first request after the TTL refreshes the page
+	now = start.Add(15 * time.Second)
+	_, state = c.lookup("a")
+	assert.Equal(t, state, cacheStale)
+	_, state = c.lookup("a")
+	assert.Equal(t, state, cacheFresh)
+
+	// Full: another page isn't stored until the old one is too old to serve
+	c.store("b", "/b", rec)
+	_, state = c.lookup("b")
+	assert.Equal(t, state, cacheMiss)
+
+	now = start.Add(45 * time.Second)
+	c.store("b", "/b", rec)
+	_, state = c.lookup("b")
+	assert.Equal(t, state, cacheFresh)
+	_, state = c.lookup("a")
+	assert.Equal(t, state, cacheMiss)
+}
+
+// storedAt reports whether a cached variant of path was stored at t
+func storedAt(c *pageCache, path string, t time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, page := range c.pages {
+		if page.path == path && page.stored.Equal(t) {
+			return true
+		}
+	}
+	return false
+}
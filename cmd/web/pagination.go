@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// =============================================================================
+// Pagination
+// =============================================================================
+
+// paginationWindow is how many page links are shown either side of the
+// current page before the rest are collapsed into a gap
+const paginationWindow = 2
+
+// maxPage is the highest page number read from a request. Listings never
+// reach it, and it keeps the offsets worked out from it from overflowing.
+const maxPage = 10000
+
+// Paginator describes the current page of a listing and the page links to
+// show around it. Handlers build one with newPaginator and the shared
+// "pagination" partial renders it.
+type Paginator struct {
+	Page     int // Current page, starting at 1
+	PageSize int
+	Total    int // Total number of records across all pages
+	LastPage int
+	Window   []int // Page numbers to link to; 0 marks a gap ("…")
+
+	path  string
+	query url.Values
+}
+
+// newPaginator creates a Paginator for the request's URL, keeping its other
+// query parameters (e.g. a search term) in the generated page links
+func newPaginator(r *http.Request, page, pageSize, total int) *Paginator {
+	lastPage := (total + pageSize - 1) / pageSize
+	if lastPage < 1 {
+		lastPage = 1
+	}
+
+	p := &Paginator{
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+		LastPage: lastPage,
+		path:     r.URL.Path,
+		query:    r.URL.Query(),
+	}
+
+	// Always link to the first and last pages, plus a window around the
+	// current one, with gaps in between
+	for n := 1; n <= lastPage; n++ {
+		if n == 1 || n == lastPage || (n >= page-paginationWindow && n <= page+paginationWindow) {
+			p.Window = append(p.Window, n)
+		} else if len(p.Window) > 0 && p.Window[len(p.Window)-1] != 0 {
+			p.Window = append(p.Window, 0)
+		}
+	}
+
+	return p
+}
+
+// HasPrev reports whether there is a page before the current one
+func (p *Paginator) HasPrev() bool {
+	return p.Page > 1
+}
+
+// HasNext reports whether there is a page after the current one
+func (p *Paginator) HasNext() bool {
+	return p.Page < p.LastPage
+}
+
+// Prev returns the previous page number
+func (p *Paginator) Prev() int {
+	return p.Page - 1
+}
+
+// Next returns the next page number
+func (p *Paginator) Next() int {
+	return p.Page + 1
+}
+
+// URL returns the link to the given page
+func (p *Paginator) URL(page int) string {
+	query := url.Values{}
+	for k, v := range p.query {
+		query[k] = v
+	}
+
+	if page > 1 {
+		query.Set("page", strconv.Itoa(page))
+	} else {
+		query.Del("page")
+	}
+
+	if len(query) == 0 {
+		return p.path
+	}
+	return p.path + "?" + query.Encode()
+}
+
+// pageParam reads the 1-based ?page= query parameter, defaulting to 1 for
+// missing or invalid values and capped at maxPage
+func pageParam(r *http.Request) int {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		return 1
+	}
+	return min(page, maxPage)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestPaginatorWindow(t *testing.T) {
+	tests := []struct {
+		name  string
+		page  int
+		total int
+		want  string
+	}{
+		{name: "Empty", page: 1, total: 0, want: "[1]"},
+		{name: "Single page", page: 1, total: 10, want: "[1]"},
+		{name: "Few pages", page: 2, total: 30, want: "[1 2 3]"},
+		{name: "Start", page: 1, total: 100, want: "[1 2 3 0 10]"},
+		{name: "Middle", page: 5, total: 100, want: "[1 0 3 4 5 6 7 0 10]"},
+		{name: "End", page: 10, total: 100, want: "[1 0 8 9 10]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/snippet/search", nil)
+			p := newPaginator(r, tt.page, 10, tt.total)
+			assert.Equal(t, fmt.Sprint(p.Window), tt.want)
+		})
+	}
+}
+
+func TestPaginatorURL(t *testing.T) {
+	r := httptest.NewRequest("GET", "/snippet/search?q=go&page=2", nil)
+	p := newPaginator(r, 2, 10, 50)
+
+	assert.Equal(t, p.URL(1), "/snippet/search?q=go")
+	assert.Equal(t, p.URL(3), "/snippet/search?page=3&q=go")
+	assert.Equal(t, p.HasPrev(), true)
+	assert.Equal(t, p.HasNext(), true)
+}
+
+func TestPageParam(t *testing.T) {
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{query: "", want: 1},
+		{query: "?page=3", want: 3},
+		{query: "?page=0", want: 1},
+		{query: "?page=-2", want: 1},
+		{query: "?page=abc", want: 1},
+		{query: "?page=1000000000000000000", want: maxPage},
+		{query: "?page=99999999999999999999", want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/"+tt.query, nil)
+			assert.Equal(t, pageParam(r), tt.want)
+		})
+	}
+}
+
+func TestHugePage(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+
+	// Page numbers whose offset would overflow are read as the last page
+	// we ever serve, which is empty
+	rs := ts.Get(t, "/browse/language/go?page=1000000000000000000")
+	assert.Equal(t, rs.Status, http.StatusOK)
+}
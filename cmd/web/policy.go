@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+
+	"adotkaya.playground/internal/models"
+)
+
+// =============================================================================
+// Authorization Policies
+// =============================================================================
+// Who may use each page of the site is listed here, in one table, rather
+// than wired into the middleware chains route by route. routes registers
+// every route of the HTML site behind authorize, which enforces the route's
+// entry and refuses to start without one. Routes that authenticate some
+// other way (static files, the JSON API, SAML and SCIM) aren't listed.
+
+// access is who may use a route
+type access int
+
+const (
+	anyone     access = iota // Anyone, logged in or not
+	users                    // Logged-in users
+	creators                 // Logged-in users, or anyone when anonymous snippets are enabled
+	moderators               // Moderators and admins
+	admins                   // Admins
+)
+
+// snippetAccess is who may use a route on the snippet in :id
+type snippetAccess int
+
+const (
+	noSnippet snippetAccess = iota // The route isn't about a snippet in :id
+	viewers                        // Whoever may see the snippet (see canView)
+	owners                         // Whoever may edit the snippet (see canEdit)
+)
+
+// policy is a route's authorization rule
+type policy struct {
+	access  access
+	snippet snippetAccess // Loads the snippet in :id for the handler
+}
+
+// routePolicies is the policy for each route, keyed by method and pattern
+var routePolicies = map[string]policy{
+	// Public pages
+	"GET /":                          {access: anyone},
+	"GET /trending":                  {access: anyone},
+	"GET /events":                    {access: anyone},
+	"GET /snippet/view/:id":          {access: anyone, snippet: viewers},
+	"GET /snippet/list":              {access: anyone},
+	"GET /snippet/search":            {access: anyone},
+	"GET /about/stats":               {access: anyone},
+	"GET /browse/language/:lang":     {access: anyone},
+	"GET /browse/tag/:tag":           {access: anyone},
+	"GET /snippet/raw/:id":           {access: anyone},
+	"GET /snippet/download/:id":      {access: anyone},
+	"GET /snippet/shared/:id":        {access: anyone}, // Signed link
+	"GET /leaving":                   {access: anyone},
+	"GET /snippet/attachment/:id":    {access: anyone}, // Checks the snippet is visible
+	"GET /user/profile/:id":          {access: anyone},
+	"GET /user/signup":               {access: anyone},
+	"POST /user/signup":              {access: anyone},
+	"GET /user/login":                {access: anyone},
+	"POST /user/login":               {access: anyone},
+	"GET /user/login/confirm":        {access: anyone}, // Signed link
+	"POST /user/locale":              {access: anyone},
+	"POST /user/theme":               {access: anyone},
+	"GET /unsubscribe":               {access: anyone}, // Signed link
+	"POST /unsubscribe":              {access: anyone}, // Signed link
+	"GET /snippet/create":            {access: creators},
+	"POST /snippet/create":           {access: creators},
+	"POST /snippet/preview":          {access: creators},
+	"GET /snippet/create/encrypted":  {access: creators},
+	"POST /snippet/create/encrypted": {access: creators},
+	"GET /snippet/edit/:id":          {access: anyone, snippet: owners},
+	"POST /snippet/edit/:id":         {access: anyone, snippet: owners},
+	"POST /snippet/delete/:id":       {access: anyone, snippet: owners},
+
+	// Users' own snippets and accounts
+	"GET /snippet/import":               {access: users},
+	"POST /snippet/import":              {access: users},
+	"POST /snippet/report/:id":          {access: users, snippet: viewers},
+	"GET /snippet/share/:id":            {access: users, snippet: owners},
+	"POST /snippet/share/:id":           {access: users, snippet: owners},
+	"POST /snippet/share/:id/revoke":    {access: users, snippet: owners},
+	"POST /snippet/gist/:id":            {access: users, snippet: owners},
+	"GET /snippet/attachments/:id":      {access: users, snippet: owners},
+	"POST /snippet/attachments/:id":     {access: users, snippet: owners},
+	"DELETE /snippet/attachment/:id":    {access: users}, // Checks the attachment's snippet is theirs
+	"POST /user/profile/:id/follow":     {access: users},
+	"POST /user/profile/:id/unfollow":   {access: users},
+	"GET /feed":                         {access: users},
+	"POST /user/logout":                 {access: users},
+	"GET /subscriptions":                {access: users},
+	"POST /subscriptions":               {access: users},
+	"POST /subscriptions/:id/delete":    {access: users},
+	"GET /account/password/update":      {access: users},
+	"POST /account/password/update":     {access: users},
+	"GET /account/security":             {access: users},
+	"POST /account/security":            {access: users},
+	"GET /account/tokens":               {access: users},
+	"POST /account/tokens":              {access: users},
+	"POST /account/tokens/:id/delete":   {access: users},
+	"GET /account/integrations":         {access: users},
+	"POST /account/integrations":        {access: users},
+	"POST /account/integrations/delete": {access: users},
+	"GET /account/avatar":               {access: users},
+	"POST /account/avatar":              {access: users},
+	"DELETE /account/avatar":            {access: users},
+	"GET /notifications":                {access: users},
+	"GET /account/notifications":        {access: users},
+	"POST /account/notifications":       {access: users},
+	"GET /account/snippets.csv":         {access: users},
+
+	// Moderation
+	"GET /admin/moderation":              {access: moderators},
+	"POST /admin/moderation/:id/approve": {access: moderators},
+	"POST /admin/moderation/:id/remove":  {access: moderators},
+	"POST /admin/moderation/:id/ban":     {access: moderators},
+
+	// Administration
+	"GET /admin/mail":                      {access: admins},
+	"GET /admin/bans":                      {access: admins},
+	"POST /admin/bans":                     {access: admins},
+	"POST /admin/bans/:id/delete":          {access: admins},
+	"POST /admin/users/:id/tier":           {access: admins},
+	"GET /admin/history":                   {access: admins},
+	"GET /admin/backups":                   {access: admins},
+	"POST /admin/backups":                  {access: admins},
+	"GET /admin/announcements":             {access: admins},
+	"POST /admin/announcements":            {access: admins},
+	"GET /admin/announcements/:id":         {access: admins},
+	"POST /admin/announcements/:id":        {access: admins},
+	"POST /admin/announcements/:id/delete": {access: admins},
+	"GET /admin/maintenance":               {access: admins},
+	"POST /admin/maintenance":              {access: admins},
+	"GET /admin/reports":                   {access: admins},
+	"GET /admin/export/users.csv":          {access: admins},
+	"GET /admin/export/snippets.csv":       {access: admins},
+	"GET /admin/logging":                   {access: admins},
+	"POST /admin/logging":                  {access: admins},
+	"GET /admin/analytics":                 {access: admins},
+}
+
+// =============================================================================
+// Authorization Middleware
+// =============================================================================
+
+// authorize returns middleware enforcing the policy in routePolicies for
+// the route with method and pattern. It panics if there is none, so a new
+// route can't go live without one.
+func (app *application) authorize(method, pattern string) func(http.Handler) http.Handler {
+	p, ok := routePolicies[method+" "+pattern]
+	if !ok {
+		panic(fmt.Sprintf("no authorization policy for %s %s", method, pattern))
+	}
+	return app.requirePolicy(p)
+}
+
+// requirePolicy returns middleware letting through only the visitors p
+// allows. Visitors who aren't logged in but would need to be are sent to
+// the login page; others who aren't allowed get 403 Forbidden. Routes on a
+// snippet go on to loadSnippet. Pages for logged-in users aren't cached by
+// browsers.
+func (app *application) requirePolicy(p policy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if p.snippet != noSnippet {
+			next = app.loadSnippet(p.snippet)(next)
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			needsLogin := p.access != anyone && !(p.access == creators && app.config.Anonymous.Enabled)
+			if needsLogin {
+				if !app.isAuthenticated(r) {
+					http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+					return
+				}
+				if !app.hasAccess(r, p.access) {
+					role, _ := r.Context().Value(userRoleContextKey).(string)
+					app.logger.DebugContext(r.Context(), "Access denied", "method", r.Method, "path", r.URL.Path, "role", role)
+					app.clientError(w, http.StatusForbidden)
+					return
+				}
+				w.Header().Add("Cache-Control", "no-store")
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// loadSnippet returns middleware fetching the snippet in :id and adding it
+// to the request context for loadedSnippet. Snippets that don't exist get
+// 404 Not Found, as do private ones on routes for viewers that the visitor
+// may not see. Routes for owners give 403 Forbidden to visitors who may not
+// edit the snippet.
+func (app *application) loadSnippet(a snippetAccess) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, err := strconv.Atoi(httprouter.ParamsFromContext(r.Context()).ByName("id"))
+			if err != nil || id < 1 {
+				app.notFound(w, r)
+				return
+			}
+
+			snippet, err := app.snippets.Get(r.Context(), id)
+			if err != nil {
+				app.modelError(w, r, err)
+				return
+			}
+
+			switch a {
+			case viewers:
+				// Private snippets look like missing ones to everyone but
+				// their owner
+				if !app.canView(r, snippet.UserID, snippet.Private) {
+					app.notFound(w, r)
+					return
+				}
+			case owners:
+				if !app.canEdit(r, snippet) {
+					app.clientError(w, http.StatusForbidden)
+					return
+				}
+			}
+
+			ctx := context.WithValue(r.Context(), snippetContextKey, snippet)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// loadedSnippet returns the snippet added by the loadSnippet middleware, or
+// nil if the route has none
+func (app *application) loadedSnippet(r *http.Request) *models.Snippet {
+	s, _ := r.Context().Value(snippetContextKey).(*models.Snippet)
+	return s
+}
+
+// hasAccess reports whether the logged-in user has the role access needs
+func (app *application) hasAccess(r *http.Request, a access) bool {
+	switch a {
+	case moderators:
+		return app.hasRole(r, models.RoleModerator)
+	case admins:
+		return app.hasRole(r, models.RoleAdmin)
+	default:
+		return true
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/models"
+)
+
+func TestRequirePolicy(t *testing.T) {
+	app := newTestApplication(t)
+	user := map[contextKey]any{isAuthenticatedContextKey: true, userRoleContextKey: models.RoleUser}
+	moderator := map[contextKey]any{isAuthenticatedContextKey: true, userRoleContextKey: models.RoleModerator}
+	admin := map[contextKey]any{isAuthenticatedContextKey: true, userRoleContextKey: models.RoleAdmin}
+
+	cases := []middlewareCase{
+		{
+			name:       "anyone",
+			middleware: app.requirePolicy(policy{access: anyone}),
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+		},
+		{
+			name:       "users anonymous",
+			middleware: app.requirePolicy(policy{access: users}),
+			wantStatus: http.StatusSeeOther,
+			wantHeader: map[string]string{"Location": "/user/login"},
+			wantNext:   false,
+		},
+		{
+			name:       "users authenticated",
+			middleware: app.requirePolicy(policy{access: users}),
+			context:    user,
+			wantStatus: http.StatusOK,
+			wantHeader: map[string]string{"Cache-Control": "no-store"},
+			wantNext:   true,
+		},
+		{
+			name:       "creators anonymous",
+			middleware: app.requirePolicy(policy{access: creators}),
+			wantStatus: http.StatusSeeOther,
+			wantHeader: map[string]string{"Location": "/user/login"},
+			wantNext:   false,
+		},
+		{
+			name:       "moderators as a user",
+			middleware: app.requirePolicy(policy{access: moderators}),
+			context:    user,
+			wantStatus: http.StatusForbidden,
+			wantNext:   false,
+		},
+		{
+			name:       "moderators as a moderator",
+			middleware: app.requirePolicy(policy{access: moderators}),
+			context:    moderator,
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+		},
+		{
+			name:       "admins anonymous",
+			middleware: app.requirePolicy(policy{access: admins}),
+			wantStatus: http.StatusSeeOther,
+			wantHeader: map[string]string{"Location": "/user/login"},
+			wantNext:   false,
+		},
+		{
+			name:       "admins as a moderator",
+			middleware: app.requirePolicy(policy{access: admins}),
+			context:    moderator,
+			wantStatus: http.StatusForbidden,
+			wantNext:   false,
+		},
+		{
+			name:       "admins as an admin",
+			middleware: app.requirePolicy(policy{access: admins}),
+			context:    admin,
+			wantStatus: http.StatusOK,
+			wantHeader: map[string]string{"Cache-Control": "no-store"},
+			wantNext:   true,
+		},
+	}
+	runMiddlewareCases(t, app, cases)
+
+	// Anyone may create snippets when anonymous snippets are enabled
+	anon := newTestApplication(t)
+	anon.config.Anonymous.Enabled = true
+	runMiddlewareCases(t, anon, []middlewareCase{{
+		name:       "creators with anonymous snippets",
+		middleware: anon.requirePolicy(policy{access: creators}),
+		wantStatus: http.StatusOK,
+		wantNext:   true,
+	}})
+}
+
+// withID runs middleware with id as the route's :id parameter
+func withID(id string, middleware func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		h := middleware(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), httprouter.ParamsKey, httprouter.Params{{Key: "id", Value: id}})
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func TestLoadSnippet(t *testing.T) {
+	app := newTestApplication(t)
+	loggedIn := map[contextKey]any{isAuthenticatedContextKey: true}
+	alice := map[string]any{"authenticatedUserID": 1}
+	carol := map[string]any{"authenticatedUserID": 3}
+
+	// wantSnippet checks the handler gets the snippet with id
+	wantSnippet := func(id int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, app.loadedSnippet(r).ID, id)
+		}
+	}
+
+	cases := []middlewareCase{
+		{
+			name:       "viewers public",
+			middleware: withID("1", app.loadSnippet(viewers)),
+			next:       wantSnippet(1),
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+		},
+		{
+			name:       "viewers invalid ID",
+			middleware: withID("abc", app.loadSnippet(viewers)),
+			wantStatus: http.StatusNotFound,
+			wantNext:   false,
+		},
+		{
+			name:       "viewers missing",
+			middleware: withID("99", app.loadSnippet(viewers)),
+			wantStatus: http.StatusNotFound,
+			wantNext:   false,
+		},
+		{
+			name:       "viewers private anonymous",
+			middleware: withID("4", app.loadSnippet(viewers)),
+			wantStatus: http.StatusNotFound,
+			wantNext:   false,
+		},
+		{
+			name:       "viewers private owner",
+			middleware: withID("4", app.loadSnippet(viewers)),
+			session:    alice,
+			context:    loggedIn,
+			next:       wantSnippet(4),
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+		},
+		{
+			name:       "owners not the owner",
+			middleware: withID("1", app.loadSnippet(owners)),
+			session:    carol,
+			context:    loggedIn,
+			wantStatus: http.StatusForbidden,
+			wantNext:   false,
+		},
+		{
+			name:       "owners private not the owner",
+			middleware: withID("4", app.loadSnippet(owners)),
+			session:    carol,
+			context:    loggedIn,
+			wantStatus: http.StatusForbidden,
+			wantNext:   false,
+		},
+		{
+			name:       "owners owner",
+			middleware: withID("4", app.loadSnippet(owners)),
+			session:    alice,
+			context:    loggedIn,
+			next:       wantSnippet(4),
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+		},
+	}
+	runMiddlewareCases(t, app, cases)
+}
+
+func TestAuthorize(t *testing.T) {
+	app := newTestApplication(t)
+
+	// Every route of the HTML site has a policy
+	app.objects = &fakeStore{}
+	app.routes()
+
+	// and one without can't be registered
+	assert.Panics(t, func() { app.authorize(http.MethodGet, "/admin/secrets") })
+}
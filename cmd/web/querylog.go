@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// =============================================================================
+// Request IDs and Query Logging
+// =============================================================================
+// Each request gets an ID, returned in the X-Request-ID header and written
+// to the access log. Database queries made for the request are logged with
+// it and the route's pattern, so a slow query can be matched with the
+// request that ran it. Queries made outside a request, such as by the job
+// worker, are logged without an ID and with "-" for the route.
+
+// requestIDHeader carries the request ID, from a trusted proxy and back to
+// the client
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID matches request IDs accepted from trusted proxies
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// maxLoggedQuery is how much of a query's SQL is logged
+const maxLoggedQuery = 300
+
+// assignRequestID adds the request's ID to its context and the response.
+// Requests through a trusted proxy keep the ID the proxy gave them, so its
+// logs match ours.
+func (app *application) assignRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID.MatchString(id) || !app.trustedProxy(remoteAddr(r)) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// newRequestID returns a random request ID
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestIDFromContext returns the ID of the request ctx belongs to, or
+// "-" outside a request
+func requestIDFromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(requestIDContextKey).(string); ok {
+		return id
+	}
+	return "-"
+}
+
+// routeFromContext returns the pattern of the route serving the request ctx
+// belongs to, unmatchedRoute before the router has run, or "-" outside a
+// request
+func routeFromContext(ctx context.Context) string {
+	label, ok := ctx.Value(routeContextKey).(*routeLabel)
+	if !ok {
+		return "-"
+	}
+	if label.pattern == "" {
+		return unmatchedRoute
+	}
+	return label.pattern
+}
+
+// queryTracer logs database queries taking slow or longer as warnings,
+// and every query made for requests with debug logging on
+type queryTracer struct {
+	slow   time.Duration // Zero logs no slow queries
+	logger *slog.Logger
+}
+
+// queryStartKey is the context key under which TraceQueryStart leaves the
+// query for TraceQueryEnd
+type queryStartKey struct{}
+
+// queryStart is a query being run
+type queryStart struct {
+	sql string
+	at  time.Time
+}
+
+// TraceQueryStart notes the query and when it started
+func (t *queryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, queryStartKey{}, queryStart{sql: data.SQL, at: time.Now()})
+}
+
+// TraceQueryEnd logs the query if it was slow or debug logging is on
+func (t *queryTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	start, ok := ctx.Value(queryStartKey{}).(queryStart)
+	if !ok {
+		return
+	}
+	elapsed := time.Since(start.at)
+
+	level := slog.LevelDebug
+	if t.slow > 0 && elapsed >= t.slow {
+		level = slog.LevelWarn
+	}
+	if !t.logger.Enabled(ctx, level) {
+		return
+	}
+
+	outcome := data.CommandTag.String()
+	if data.Err != nil {
+		outcome = "error: " + data.Err.Error()
+	}
+	t.logger.Log(ctx, level, "Query", "route", routeFromContext(ctx), "duration", elapsed.Round(time.Microsecond),
+		"result", outcome, "sql", loggedQuery(start.sql))
+}
+
+// loggedQuery collapses the whitespace in sql and shortens it for the log.
+// Arguments are never logged, as they hold users' data.
+func loggedQuery(sql string) string {
+	sql = strings.Join(strings.Fields(sql), " ")
+	if len(sql) > maxLoggedQuery {
+		sql = sql[:maxLoggedQuery] + "…"
+	}
+	return sql
+}
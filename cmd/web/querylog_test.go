@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"adotkaya.playground/internal/assert"
+)
+
+func TestAssignRequestID(t *testing.T) {
+	app := newTestApplication(t)
+
+	var got string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = requestIDFromContext(r.Context())
+	})
+	serve := func(header string) string {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if header != "" {
+			r.Header.Set(requestIDHeader, header)
+		}
+		rec := httptest.NewRecorder()
+		app.assignRequestID(next).ServeHTTP(rec, r)
+		assert.Equal(t, rec.Header().Get(requestIDHeader), got)
+		return got
+	}
+
+	first := serve("")
+	assert.Equal(t, len(first), 16)
+	if serve("") == first {
+		t.Error("expected a new ID for each request")
+	}
+
+	// Only trusted proxies may set it
+	if serve("from-client") == "from-client" {
+		t.Error("expected the client's request ID to be replaced")
+	}
+	app.config.Server.TrustedProxies = []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}
+	assert.Equal(t, serve("lb-1234.abc"), "lb-1234.abc")
+	if serve("bad id\n") == "bad id\n" {
+		t.Error("expected a malformed request ID to be replaced")
+	}
+
+	assert.Equal(t, requestIDFromContext(context.Background()), "-")
+}
+
+func TestQueryTracer(t *testing.T) {
+	var buf bytes.Buffer
+	settings := newLogSettings(slog.LevelInfo, 0)
+	tracer := &queryTracer{slow: time.Second, logger: newLogger(&buf, settings)}
+
+	ctx := context.WithValue(context.Background(), requestIDContextKey, "abc123")
+	ctx = context.WithValue(ctx, routeContextKey, &routeLabel{pattern: "/snippet/view/:id"})
+	run := func(ctx context.Context, took time.Duration, err error) {
+		ctx = tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "SELECT id\n\t FROM snippets WHERE id = $1"})
+		start := ctx.Value(queryStartKey{}).(queryStart)
+		start.at = start.at.Add(-took)
+		ctx = context.WithValue(ctx, queryStartKey{}, start)
+		tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("SELECT 1"), Err: err})
+	}
+
+	// Fast queries aren't logged
+	run(ctx, time.Millisecond, nil)
+	assert.Equal(t, buf.String(), "")
+
+	run(ctx, 2*time.Second, nil)
+	assert.StringContains(t, buf.String(), `level=WARN msg=Query route=/snippet/view/:id duration=2`)
+	assert.StringContains(t, buf.String(), `s result="SELECT 1" sql="SELECT id FROM snippets WHERE id = $1" request_id=abc123`)
+
+	// Outside a request
+	buf.Reset()
+	run(context.Background(), 2*time.Second, errors.New("canceled"))
+	assert.StringContains(t, buf.String(), `msg=Query route=- duration=2`)
+	assert.StringContains(t, buf.String(), `s result="error: canceled"`)
+	if strings.Contains(buf.String(), "request_id") {
+		t.Errorf("expected no request ID outside a request; got %q", buf.String())
+	}
+
+	// Everything for requests with debug logging on
+	buf.Reset()
+	run(context.WithValue(ctx, debugSampleContextKey, true), time.Millisecond, nil)
+	assert.StringContains(t, buf.String(), "level=DEBUG msg=Query route=/snippet/view/:id")
+	assert.StringContains(t, buf.String(), "request_id=abc123")
+}
+
+func TestLoggedQuery(t *testing.T) {
+	assert.Equal(t, loggedQuery("SELECT 1\n  FROM  t"), "SELECT 1 FROM t")
+	long := loggedQuery("SELECT " + strings.Repeat("x, ", 200))
+	assert.Equal(t, strings.HasSuffix(long, "…"), true)
+	assert.Equal(t, len(long), maxLoggedQuery+len("…"))
+}
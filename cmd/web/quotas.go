@@ -0,0 +1,270 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"adotkaya.playground/internal/models"
+)
+
+// =============================================================================
+// Snippet Quotas
+// =============================================================================
+
+// rateLimiterSweepSize is how many keys the API rate limiter tracks before
+// it drops those whose window has ended
+const rateLimiterSweepSize = 10000
+
+// quotaService decides what a visitor may do under their tier. Handlers
+// and the API consult it rather than reading tiers and overrides
+// themselves.
+type quotaService struct {
+	config  *Config
+	users   models.UserModelInterface
+	api     *rateLimiter
+	imports *rateLimiter
+	beacons *rateLimiter
+}
+
+// userTierForm is the admin form for moving a user to another tier
+type userTierForm struct {
+	Tier string `form:"tier"`
+}
+
+// quotaVisitor is who a quota applies to
+type quotaVisitor struct {
+	UserID int    // Zero for anonymous visitors
+	Role   string // The user's role
+	Tier   string // The user's tier
+	IP     netip.Addr
+}
+
+// newQuotaService returns a quota service applying the tiers in cfg
+func newQuotaService(cfg *Config, users models.UserModelInterface) *quotaService {
+	return &quotaService{
+		config:  cfg,
+		users:   users,
+		api:     newRateLimiter(),
+		imports: newRateLimiter(),
+		beacons: newRateLimiter(),
+	}
+}
+
+// visitor returns who the request is from, for the quota service
+func (app *application) visitor(r *http.Request) quotaVisitor {
+	v := quotaVisitor{IP: app.clientIP(r)}
+	if app.isAuthenticated(r) {
+		v.UserID, _ = r.Context().Value(userIDContextKey).(int)
+		v.Role, _ = r.Context().Value(userRoleContextKey).(string)
+		v.Tier, _ = r.Context().Value(userTierContextKey).(string)
+	}
+	return v
+}
+
+// tier returns the visitor's tier. Admins have no limits. Users on an
+// unknown tier get the free tier. Anonymous visitors have the configured
+// anonymous snippet limits and otherwise the free tier's.
+func (q *quotaService) tier(v quotaVisitor) Tier {
+	free := q.config.Quota.Tiers[models.TierFree]
+
+	if v.UserID == 0 {
+		return Tier{
+			PerHour:      q.config.Anonymous.PerHour,
+			Total:        q.config.Anonymous.Total,
+			MaxSize:      free.MaxSize,
+			APIPerMinute: free.APIPerMinute,
+		}
+	}
+	if (&models.User{Role: v.Role}).HasRole(models.RoleAdmin) {
+		return Tier{}
+	}
+
+	tier, ok := q.config.Quota.Tiers[v.Tier]
+	if !ok {
+		return free
+	}
+	return tier
+}
+
+// snippetLimits returns the visitor's limits for the snippet model, which
+// enforces them when inserting and editing: their tier's, or their own
+// quota if an admin has set one
+func (q *quotaService) snippetLimits(v quotaVisitor) (models.SnippetLimits, error) {
+	tier := q.tier(v)
+	limits := models.SnippetLimits{PerHour: tier.PerHour, Total: tier.Total, Private: tier.Private}
+	if v.UserID == 0 {
+		return limits, nil
+	}
+
+	own, err := q.users.SnippetQuota(v.UserID)
+	if err == nil {
+		limits.PerHour, limits.Total = own.PerHour, own.Total
+	} else if !errors.Is(err, models.ErrNoRecord) {
+		return models.SnippetLimits{}, err
+	}
+	return limits, nil
+}
+
+// allowsSize reports whether the visitor may store size bytes of content
+// in a snippet, and their limit
+func (q *quotaService) allowsSize(v quotaVisitor, size int) (bool, int) {
+	maxSize := q.tier(v).MaxSize
+	return maxSize == 0 || size <= maxSize, maxSize
+}
+
+// allowAPI counts an API request by the visitor and reports whether it is
+// within their tier's rate limit, and if not, how long until it is
+func (q *quotaService) allowAPI(v quotaVisitor) (bool, time.Duration) {
+	limit := q.tier(v).APIPerMinute
+	if limit == 0 {
+		return true, 0
+	}
+
+	key := "ip:" + v.IP.String()
+	if v.UserID != 0 {
+		key = "user:" + strconv.Itoa(v.UserID)
+	}
+	return q.api.allow(key, limit)
+}
+
+// allowImport counts an import by the visitor and reports whether it is
+// within the import rate limit, and if not, how long until it is. The
+// limit is the same for every tier: it protects the sites imported from
+// rather than this one.
+func (q *quotaService) allowImport(v quotaVisitor) (bool, time.Duration) {
+	return q.imports.allow("user:"+strconv.Itoa(v.UserID), importsPerMinute)
+}
+
+// allowBeacon counts an analytics beacon from the visitor's address and
+// reports whether it is within the beacon rate limit, and if not, how long
+// until it is
+func (q *quotaService) allowBeacon(v quotaVisitor) (bool, time.Duration) {
+	return q.beacons.allow("ip:"+v.IP.String(), beaconsPerMinute)
+}
+
+// limitAPI refuses API requests over the visitor's tier's rate limit with
+// 429 Too Many Requests
+func (app *application) limitAPI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ok, retry := app.quotas.allowAPI(app.visitor(r)); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+			app.clientError(w, http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// quotaMessage explains a reached quota in the visitor's language
+func (app *application) quotaMessage(r *http.Request, err *models.QuotaError) string {
+	switch err.Limit {
+	case models.QuotaTotal:
+		return app.translate(r, "validation.quota_total", err.Max)
+	case models.QuotaPrivate:
+		return app.translate(r, "validation.quota_private", err.Max)
+	}
+	minutes := int(math.Ceil(err.RetryAfter.Minutes()))
+	return app.translate(r, "validation.quota_hourly", err.Max, minutes)
+}
+
+// sizeMessage explains the visitor's content size limit in their language
+func (app *application) sizeMessage(r *http.Request, maxSize int) string {
+	return app.translate(r, "validation.max_size", (maxSize+1023)/1024)
+}
+
+// tierNames returns the configured tiers' names in order
+func (q *quotaService) tierNames() []string {
+	names := make([]string, 0, len(q.config.Quota.Tiers))
+	for name := range q.config.Quota.Tiers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// adminUserTierPost moves the profile's user to another tier
+func (app *application) adminUserTierPost(w http.ResponseWriter, r *http.Request) {
+	id, ok := profileID(r)
+	if !ok {
+		app.notFound(w, r)
+		return
+	}
+
+	var form userTierForm
+	err := app.decodePostForm(r, &form)
+	if err != nil || !slices.Contains(app.quotas.tierNames(), form.Tier) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.users.SetTier(id, form.Tier)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+	app.recordAudit(r, models.AuditUserTier, fmt.Sprintf("user:%d", id), form.Tier)
+
+	app.putFlash(r, app.translate(r, "flash.tier_updated", form.Tier))
+	http.Redirect(w, r, fmt.Sprintf("/user/profile/%d", id), http.StatusSeeOther)
+}
+
+// =============================================================================
+// API Rate Limiter
+// =============================================================================
+
+// rateLimiter counts requests per key in fixed one-minute windows. Counts
+// are kept in memory, so each instance applies the limit separately.
+type rateLimiter struct {
+	mu      sync.Mutex
+	windows map[string]*rateWindow
+	now     func() time.Time
+}
+
+// rateWindow is the requests counted for a key since start
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{windows: map[string]*rateWindow{}, now: time.Now}
+}
+
+// allow counts a request for key and reports whether it is within limit
+// requests a minute, and if not, how long until the window ends
+func (l *rateLimiter) allow(key string, limit int) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= time.Minute {
+		if !ok && len(l.windows) >= rateLimiterSweepSize {
+			l.sweep(now)
+		}
+		w = &rateWindow{start: now}
+		l.windows[key] = w
+	}
+
+	if w.count >= limit {
+		return false, w.start.Add(time.Minute).Sub(now)
+	}
+	w.count++
+	return true, 0
+}
+
+// sweep drops the windows that have ended
+func (l *rateLimiter) sweep(now time.Time) {
+	for key, w := range l.windows {
+		if now.Sub(w.start) >= time.Minute {
+			delete(l.windows, key)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/models/mocks"
+	"adotkaya.playground/internal/testutil"
+)
+
+// quotaSnippets is at the limit for every insert, recording the limits it
+// was given
+type quotaSnippets struct {
+	mocks.SnippetModel
+	err    *models.QuotaError
+	limits models.SnippetLimits
+}
+
+func (m *quotaSnippets) Insert(userID int, creatorIP netip.Addr, title string, content string, expires int, private bool, limits models.SnippetLimits) (int, error) {
+	m.limits = limits
+	return 0, m.err
+}
+
+func (m *quotaSnippets) Update(id int, title string, content string, private bool, limits models.SnippetLimits) error {
+	m.limits = limits
+	return m.err
+}
+
+// quotaUsers gives Alice her own quota
+type quotaUsers struct {
+	mocks.UserModel
+}
+
+func (u *quotaUsers) SnippetQuota(id int) (models.SnippetLimits, error) {
+	if id == 1 {
+		return models.SnippetLimits{PerHour: 100, Total: 0}, nil
+	}
+	return models.SnippetLimits{}, models.ErrNoRecord
+}
+
+// proUsers puts Alice on the pro tier
+type proUsers struct {
+	mocks.UserModel
+}
+
+func (u *proUsers) Get(id int) (*models.User, error) {
+	user, err := u.UserModel.Get(id)
+	if err == nil && id == 1 {
+		user.Tier = models.TierPro
+	}
+	return user, err
+}
+
+// testTiers are the tiers the quota tests run with
+var testTiers = map[string]Tier{
+	models.TierFree: {PerHour: 10, Total: 500},
+	models.TierPro:  {PerHour: 100, Total: 10000, Private: 50},
+}
+
+func TestSnippetCreateQuota(t *testing.T) {
+	form := url.Values{}
+	form.Add("title", "O snail")
+	form.Add("content", "O snail\nClimb Mount Fuji,\nBut slowly, slowly!")
+	form.Add("expires", "7")
+
+	tests := []struct {
+		name           string
+		email          string
+		users          models.UserModelInterface
+		err            *models.QuotaError
+		wantLimits     models.SnippetLimits
+		wantRetryAfter string
+		wantBody       string
+	}{
+		{
+			name:           "Hourly limit",
+			email:          "alice@example.com",
+			users:          &mocks.UserModel{},
+			err:            &models.QuotaError{Limit: models.QuotaHourly, Max: 10, RetryAfter: 41*time.Minute + 30*time.Second},
+			wantLimits:     models.SnippetLimits{PerHour: 10, Total: 500},
+			wantRetryAfter: "2490",
+			wantBody:       "You can create up to 10 snippets an hour. Please try again in 42 min.",
+		},
+		{
+			name:       "Total limit",
+			email:      "alice@example.com",
+			users:      &mocks.UserModel{},
+			err:        &models.QuotaError{Limit: models.QuotaTotal, Max: 500},
+			wantLimits: models.SnippetLimits{PerHour: 10, Total: 500},
+			wantBody:   "You have reached your limit of 500 active snippets.",
+		},
+		{
+			name:           "Own quota",
+			email:          "alice@example.com",
+			users:          &quotaUsers{},
+			err:            &models.QuotaError{Limit: models.QuotaHourly, Max: 100, RetryAfter: time.Second},
+			wantLimits:     models.SnippetLimits{PerHour: 100},
+			wantRetryAfter: "1",
+			wantBody:       "You can create up to 100 snippets an hour. Please try again in 1 min.",
+		},
+		{
+			name:       "Pro tier",
+			email:      "alice@example.com",
+			users:      &proUsers{},
+			err:        &models.QuotaError{Limit: models.QuotaTotal, Max: 10000},
+			wantLimits: models.SnippetLimits{PerHour: 100, Total: 10000, Private: 50},
+			wantBody:   "You have reached your limit of 10000 active snippets.",
+		},
+		{
+			name:       "Admins have no limits",
+			email:      "admin@example.com",
+			users:      &mocks.UserModel{},
+			err:        &models.QuotaError{Limit: models.QuotaTotal, Max: 0},
+			wantLimits: models.SnippetLimits{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.Quota = QuotaConfig{Tiers: testTiers}
+			snippets := &quotaSnippets{err: tt.err}
+			app.snippets = snippets
+			app.users = tt.users
+			app.quotas.users = tt.users
+
+			ts := testutil.NewServer(t, app.routes())
+			ts.Login(t, tt.email, "pa$$word")
+
+			rs := ts.Submit(t, "/snippet/create", "/snippet/create", form)
+			assert.Equal(t, rs.Status, http.StatusTooManyRequests)
+			assert.Equal(t, rs.Header.Get("Retry-After"), tt.wantRetryAfter)
+			assert.StringContains(t, rs.Body, tt.wantBody)
+			assert.Equal(t, snippets.limits, tt.wantLimits)
+		})
+	}
+}
+
+func TestSnippetEditPrivateQuota(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.Quota = QuotaConfig{Tiers: map[string]Tier{models.TierFree: {Private: 3}}}
+	snippets := &quotaSnippets{err: &models.QuotaError{Limit: models.QuotaPrivate, Max: 3}}
+	app.snippets = &ownedQuotaSnippets{snippets}
+
+	ts := testutil.NewServer(t, app.routes())
+	ts.Login(t, "alice@example.com", "pa$$word")
+
+	form := url.Values{}
+	form.Add("title", "An old silent pond")
+	form.Add("content", "An old silent pond...")
+	form.Add("private", "true")
+	rs := ts.Submit(t, "/snippet/edit/1", "/snippet/edit/1", form)
+	assert.Equal(t, rs.Status, http.StatusTooManyRequests)
+	assert.StringContains(t, rs.Body, "You have reached your limit of 3 private snippets.")
+	assert.Equal(t, snippets.limits, models.SnippetLimits{Private: 3})
+}
+
+// ownedQuotaSnippets are quotaSnippets belonging to Alice
+type ownedQuotaSnippets struct {
+	*quotaSnippets
+}
+
+func (m *ownedQuotaSnippets) Get(ctx context.Context, id int) (*models.Snippet, error) {
+	return (&aliceSnippets{}).Get(ctx, id)
+}
+
+func TestSnippetSizeLimit(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.Quota = QuotaConfig{Tiers: map[string]Tier{models.TierFree: {MaxSize: 1024}}}
+	ts := testutil.NewServer(t, app.routes())
+
+	submit := func(t *testing.T, content string) testutil.Response {
+		form := url.Values{}
+		form.Add("title", "O snail")
+		form.Add("content", content)
+		form.Add("expires", "7")
+		return ts.Submit(t, "/snippet/create", "/snippet/create", form)
+	}
+
+	ts.Login(t, "alice@example.com", "pa$$word")
+	rs := submit(t, strings.Repeat("a", 1025))
+	assert.Equal(t, rs.Status, http.StatusUnprocessableEntity)
+	assert.StringContains(t, rs.Body, "Snippets on your plan can be up to 1 KB.")
+
+	rs = submit(t, strings.Repeat("a", 1024))
+	assert.Equal(t, rs.Status, http.StatusSeeOther)
+
+	// Admins have no limits
+	ts.Login(t, "admin@example.com", "pa$$word")
+	rs = submit(t, strings.Repeat("a", 1025))
+	assert.Equal(t, rs.Status, http.StatusSeeOther)
+}
+
+func TestAPIRateLimit(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.Quota = QuotaConfig{Tiers: map[string]Tier{
+		models.TierFree: {APIPerMinute: 2},
+		models.TierPro:  {APIPerMinute: 3},
+	}}
+	app.users = &proUsers{}
+	app.quotas.users = app.users
+	ts := testutil.NewServer(t, app.routes())
+
+	for range 2 {
+		rs := ts.Get(t, "/snippet/raw/1")
+		assert.Equal(t, rs.Status, http.StatusOK)
+	}
+	rs := ts.Get(t, "/snippet/download/1")
+	assert.Equal(t, rs.Status, http.StatusTooManyRequests)
+	assert.Equal(t, rs.Header.Get("Retry-After") != "", true)
+
+	// Users are counted separately from their address, at their tier's rate
+	ts.Login(t, "alice@example.com", "pa$$word")
+	for range 3 {
+		rs = ts.Get(t, "/snippet/raw/1")
+		assert.Equal(t, rs.Status, http.StatusOK)
+	}
+	rs = ts.Get(t, "/snippet/raw/1")
+	assert.Equal(t, rs.Status, http.StatusTooManyRequests)
+
+	// Pages aren't limited
+	rs = ts.Get(t, "/snippet/view/1")
+	assert.Equal(t, rs.Status, http.StatusOK)
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := newRateLimiter()
+	l.now = func() time.Time { return now }
+
+	for range 2 {
+		ok, _ := l.allow("a", 2)
+		assert.Equal(t, ok, true)
+	}
+	ok, retry := l.allow("a", 2)
+	assert.Equal(t, ok, false)
+	assert.Equal(t, retry, time.Minute)
+
+	ok, _ = l.allow("b", 2)
+	assert.Equal(t, ok, true)
+
+	now = now.Add(45 * time.Second)
+	ok, retry = l.allow("a", 2)
+	assert.Equal(t, ok, false)
+	assert.Equal(t, retry, 15*time.Second)
+
+	now = now.Add(15 * time.Second)
+	ok, _ = l.allow("a", 2)
+	assert.Equal(t, ok, true)
+}
+
+func TestAdminUserTier(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.Quota = QuotaConfig{Tiers: testTiers}
+	audit := &recordingAudit{}
+	app.audit = audit
+	ts := testutil.NewServer(t, app.routes())
+
+	// Only admins see the form
+	ts.Login(t, "alice@example.com", "pa$$word")
+	rs := ts.Get(t, "/user/profile/1")
+	assert.StringContains(t, rs.Body, "Plan: free")
+	if strings.Contains(rs.Body, `action="/admin/users/1/tier"`) {
+		t.Error("tier form shown to a regular user")
+	}
+	rs = ts.PostForm(t, "/admin/users/1/tier", url.Values{"tier": {"pro"}})
+	assert.Equal(t, rs.Status, http.StatusBadRequest)
+
+	ts.Login(t, "admin@example.com", "pa$$word")
+	rs = ts.Get(t, "/user/profile/1")
+	assert.StringContains(t, rs.Body, `<option value="pro">pro</option>`)
+
+	rs = ts.Submit(t, "/user/profile/1", "/admin/users/1/tier", url.Values{"tier": {"pro"}})
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/user/profile/1")
+	assert.Equal(t, len(audit.entries), 1)
+	assert.Equal(t, audit.entries[0], auditRecord{3, models.AuditUserTier, "user:1", "pro"})
+
+	rs = ts.Submit(t, "/user/profile/1", "/admin/users/1/tier", url.Values{"tier": {"platinum"}})
+	assert.Equal(t, rs.Status, http.StatusBadRequest)
+}
+
+func TestParseTiers(t *testing.T) {
+	defaults := func() map[string]Tier {
+		return map[string]Tier{
+			models.TierFree: {PerHour: 10, Total: 500, Private: 10, MaxSize: 65536, APIPerMinute: 60},
+			models.TierPro:  {PerHour: 100, Total: 10000, MaxSize: 1048576, APIPerMinute: 600},
+		}
+	}
+
+	tiers, err := parseTiers("pro:api=1200; team:hourly=50,private=0\nfree:size=1024", defaults())
+	assert.NilError(t, err)
+	assert.Equal(t, tiers[models.TierPro], Tier{PerHour: 100, Total: 10000, MaxSize: 1048576, APIPerMinute: 1200})
+	assert.Equal(t, tiers["team"], Tier{PerHour: 50, Total: 500, MaxSize: 65536, APIPerMinute: 60})
+	assert.Equal(t, tiers[models.TierFree].MaxSize, 1024)
+
+	for _, list := range []string{"pro:api=fast", "pro:speed=1", ":api=1", "pro:api=-1"} {
+		_, err = parseTiers(list, defaults())
+		assert.NotNil(t, err)
+	}
+}
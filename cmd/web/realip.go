@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// =============================================================================
+// Client Address
+// =============================================================================
+
+// clientIP returns the address of the client that made the request.
+//
+// When the request comes from a trusted proxy, X-Forwarded-For is walked
+// from the right, skipping trusted proxies. The first other address is the
+// client; anything further left was supplied by the client and can't be
+// trusted.
+func (app *application) clientIP(r *http.Request) netip.Addr {
+	ip := remoteAddr(r)
+	if !app.trustedProxy(ip) {
+		return ip
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		ip = hop.Unmap()
+		if !app.trustedProxy(ip) {
+			break
+		}
+	}
+
+	return ip
+}
+
+// trustedProxy reports whether ip belongs to a configured reverse proxy
+func (app *application) trustedProxy(ip netip.Addr) bool {
+	for _, proxy := range app.config.Server.TrustedProxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteAddr parses the address of the directly connected peer
+func remoteAddr(r *http.Request) netip.Addr {
+	if addrPort, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+		return addrPort.Addr().Unmap()
+	}
+	addr, _ := netip.ParseAddr(r.RemoteAddr)
+	return addr.Unmap()
+}
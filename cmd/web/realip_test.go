@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := parsePrefixes("10.0.0.0/8, 192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{
+			name:       "Direct",
+			remoteAddr: "198.51.100.7:51234",
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "Untrusted peer",
+			remoteAddr: "198.51.100.7:51234",
+			forwarded:  []string{"203.0.113.9"},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "Trusted proxy",
+			remoteAddr: "10.1.2.3:51234",
+			forwarded:  []string{"203.0.113.9"},
+			want:       "203.0.113.9",
+		},
+		{
+			name:       "Spoofed hops",
+			remoteAddr: "10.1.2.3:51234",
+			forwarded:  []string{"1.1.1.1, 203.0.113.9"},
+			want:       "203.0.113.9",
+		},
+		{
+			name:       "Proxy chain",
+			remoteAddr: "10.1.2.3:51234",
+			forwarded:  []string{"203.0.113.9, 192.0.2.1", "10.4.5.6"},
+			want:       "203.0.113.9",
+		},
+		{
+			name:       "Garbage hop",
+			remoteAddr: "10.1.2.3:51234",
+			forwarded:  []string{"203.0.113.9, unknown"},
+			want:       "10.1.2.3",
+		},
+		{
+			name:       "IPv4-mapped IPv6",
+			remoteAddr: "[::ffff:198.51.100.7]:51234",
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "IPv6",
+			remoteAddr: "[2001:db8::1]:51234",
+			want:       "2001:db8::1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.Server.TrustedProxies = proxies
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+
+			assert.Equal(t, app.clientIP(r), netip.MustParseAddr(tt.want))
+		})
+	}
+}
+
+func TestParsePrefixes(t *testing.T) {
+	got, err := parsePrefixes(" 192.0.2.1, 10.1.2.3/8,,::ffff:198.51.100.7 ")
+	assert.NilError(t, err)
+	assert.Equal(t, len(got), 3)
+	assert.Equal(t, got[0], netip.MustParsePrefix("192.0.2.1/32"))
+	assert.Equal(t, got[1], netip.MustParsePrefix("10.0.0.0/8"))
+	assert.Equal(t, got[2], netip.MustParsePrefix("198.51.100.7/32"))
+
+	_, err = parsePrefixes("10.0.0.0/33")
+	if err == nil {
+		t.Error("got nil error for an invalid prefix")
+	}
+}
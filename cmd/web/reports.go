@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"adotkaya.playground/internal/models"
+)
+
+// =============================================================================
+// Admin Reports
+// =============================================================================
+// Admins can run the predefined reports in models.Reports from
+// /admin/reports, choosing their parameters, and see the rows or download
+// them as CSV. Downloads are audited, since they take data off the site.
+
+// reportView is a report on the admin reports page, with its parameters'
+// values and, for the report just run, its result
+type reportView struct {
+	Name   string
+	Fields []reportField
+	Result *models.ReportResult
+}
+
+// reportField is a report parameter with the value its form shows
+type reportField struct {
+	models.ReportParam
+	Value int
+}
+
+// adminReports lists the reports with a form for each. With ?report=name
+// it runs that report with the parameters given, showing its rows, or with
+// &format=csv downloading them.
+func (app *application) adminReports(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	name := q.Get("report")
+
+	views := make([]reportView, len(models.Reports))
+	for i, report := range models.Reports {
+		views[i] = reportView{Name: report.Name}
+		for _, p := range report.Params {
+			views[i].Fields = append(views[i].Fields, reportField{ReportParam: p, Value: p.Default})
+		}
+	}
+
+	if name != "" {
+		i := slices.IndexFunc(models.Reports, func(rep models.Report) bool { return rep.Name == name })
+		if i < 0 {
+			app.notFound(w, r)
+			return
+		}
+		report := models.Reports[i]
+
+		args, ok := reportArgs(report, q)
+		if !ok {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+
+		result, err := app.reports.Run(r.Context(), report, args)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		if q.Get("format") == "csv" {
+			app.recordAudit(r, models.AuditReportExport, "report:"+report.Name, formatReportArgs(report, args))
+			app.writeReportCSV(w, report, result)
+			return
+		}
+
+		for j := range views[i].Fields {
+			views[i].Fields[j].Value = args[j]
+		}
+		views[i].Result = result
+	}
+
+	data := app.newTemplateData(r)
+	data.Reports = views
+	data.Breadcrumbs = app.breadcrumbs(r, Crumb{Label: app.translate(r, "admin_reports.title")})
+	app.render(w, http.StatusOK, "admin_reports.tmpl", data)
+}
+
+// reportArgs returns the report's arguments from the query, using each
+// parameter's default when it is blank. ok is false if one isn't a number
+// in the parameter's range.
+func reportArgs(report models.Report, q url.Values) ([]int, bool) {
+	args := make([]int, len(report.Params))
+	for i, p := range report.Params {
+		s := q.Get(p.Name)
+		if s == "" {
+			args[i] = p.Default
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < p.Min || n > p.Max {
+			return nil, false
+		}
+		args[i] = n
+	}
+	return args, true
+}
+
+// formatReportArgs describes a report's arguments for the audit log, e.g.
+// "days=30 limit=20"
+func formatReportArgs(report models.Report, args []int) string {
+	parts := make([]string, len(args))
+	for i, a := range args {
+		parts[i] = fmt.Sprintf("%s=%d", report.Params[i].Name, a)
+	}
+	return strings.Join(parts, " ")
+}
+
+// writeReportCSV sends a report's result as a CSV file named after the
+// report and today's date
+func (app *application) writeReportCSV(w http.ResponseWriter, report models.Report, result *models.ReportResult) {
+	d := newCSVDownload(w, report.Name)
+	d.Write(result.Columns)
+	for _, row := range result.Rows {
+		d.Row(slices.Clone(row)...)
+	}
+	app.finishCSV(w, d, "report "+report.Name, nil)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestAdminReports(t *testing.T) {
+	app := newTestApplication(t)
+	audit := &recordingAudit{}
+	app.audit = audit
+	ts := testutil.NewServer(t, app.routes())
+
+	ts.Login(t, "alice@example.com", "pa$$word")
+	rs := ts.Get(t, "/admin/reports")
+	assert.Equal(t, rs.Status, http.StatusForbidden)
+
+	ts.Login(t, "admin@example.com", "pa$$word")
+	rs = ts.Get(t, "/admin/reports")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.StringContains(t, rs.Body, "Top users")
+	assert.StringContains(t, rs.Body, `<input type="number" name="days" value="30" min="1" max="3650" />`)
+
+	rs = ts.Get(t, "/admin/reports?report=largest_snippets&limit=5")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.StringContains(t, rs.Body, `<input type="number" name="limit" value="5" min="1" max="1000" />`)
+	assert.StringContains(t, rs.Body, "<td>An old silent pond</td>")
+	assert.Equal(t, len(audit.entries), 0)
+
+	rs = ts.Get(t, "/admin/reports?report=largest_snippets&limit=5&format=csv")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.Equal(t, rs.Header.Get("Content-Type"), "text/csv; charset=utf-8")
+	assert.StringContains(t, rs.Header.Get("Content-Disposition"), `attachment; filename="largest_snippets-`)
+	// Formulas are defused
+	assert.Equal(t, rs.Body, "id,title,bytes\n1,An old silent pond,21\n4,\"'=HYPERLINK(\"\"https://example.com\"\")\",12\n")
+	assert.DeepEqual(t, audit.entries, []auditRecord{{3, models.AuditReportExport, "report:largest_snippets", "limit=5"}})
+
+	tests := []struct {
+		name       string
+		urlPath    string
+		wantStatus int
+	}{
+		{"Unknown report", "/admin/reports?report=users", http.StatusNotFound},
+		{"Not a number", "/admin/reports?report=top_users&days=x", http.StatusBadRequest},
+		{"Out of range", "/admin/reports?report=top_users&limit=5000", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := ts.Get(t, tt.urlPath)
+			assert.Equal(t, rs.Status, tt.wantStatus)
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"log/slog"
+
+	"adotkaya.playground/internal/models"
+)
+
+// =============================================================================
+// Content Resealing
+// =============================================================================
+
+// resealBatchSize is how many snippets are resealed per transaction
+const resealBatchSize = 500
+
+// resealSchedule runs resealing daily at 03:00 UTC, catching anything a
+// rotation at startup missed
+var resealSchedule = daily(3)
+
+// resealContent seals every snippet's content with the current content key,
+// encrypting plaintext written before encryption was enabled and content
+// sealed with older keys. Several instances can run it at once.
+func resealContent(m *models.SnippetModel, logger *slog.Logger) error {
+	total := 0
+	for {
+		n, err := m.Reseal(resealBatchSize)
+		total += n
+		if err != nil {
+			return err
+		}
+		if n < resealBatchSize {
+			break
+		}
+	}
+
+	if total > 0 {
+		logger.Info("Resealed snippet content", "count", total)
+	}
+	return nil
+}
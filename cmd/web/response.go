@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"time"
+)
+
+// =============================================================================
+// Response Writer
+// =============================================================================
+// Middleware that needs to know how a request went, such as its status and
+// how much was sent, shares a single responseWriter wrapped around the
+// server's, rather than each wrapping the writer again. One layer sees
+// every WriteHeader and Write, in order, and flushing, hijacking and
+// http.ResponseController reach the server's writer through it.
+
+// responseWriter records the status, size and timing of a response
+type responseWriter struct {
+	http.ResponseWriter
+
+	start   time.Time
+	status  int   // Zero until the header is written
+	written int64 // Body bytes written
+
+	requestID   string // For serverError to log with the error
+	serverError bool   // Whether serverError sent the response
+	dbTimeout   bool   // Whether that was because the database work ran out of time
+}
+
+// wrapResponse returns the responseWriter around w, wrapping it first if
+// no middleware has done so yet
+func wrapResponse(w http.ResponseWriter) *responseWriter {
+	if rw, ok := w.(*responseWriter); ok {
+		return rw
+	}
+	return &responseWriter{ResponseWriter: w, start: time.Now()}
+}
+
+// findResponse returns the responseWriter under w, looking through writers
+// that middleware such as the session manager wrapped around it, or nil if
+// there is none. Unlike wrapResponse, it never wraps w.
+func findResponse(w http.ResponseWriter) *responseWriter {
+	for {
+		switch v := w.(type) {
+		case *responseWriter:
+			return v
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = v.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
+
+// WriteHeader records the status of the first header written, and passes
+// it on
+func (rw *responseWriter) WriteHeader(status int) {
+	// Informational headers are followed by the real one
+	if rw.status == 0 && status >= 200 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+// Write counts the body bytes written. Writing without a header sends 200.
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.written += int64(n)
+	return n, err
+}
+
+// Flush sends any buffered data to the client, if the server's writer can
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets the handler take over the connection, if the server's
+// writer allows it
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(rw.ResponseWriter).Hijack()
+}
+
+// Unwrap returns the server's writer, for http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Status returns the response's status, or 200 if the handler wrote
+// nothing at all, which the server sends as an empty 200
+func (rw *responseWriter) Status() int {
+	if rw.status == 0 {
+		return http.StatusOK
+	}
+	return rw.status
+}
+
+// Written returns the number of body bytes written
+func (rw *responseWriter) Written() int64 {
+	return rw.written
+}
+
+// Duration returns the time since the writer was wrapped
+func (rw *responseWriter) Duration() time.Duration {
+	return time.Since(rw.start)
+}
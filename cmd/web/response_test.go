@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"adotkaya.playground/internal/assert"
+)
+
+func TestResponseWriter(t *testing.T) {
+	tests := []struct {
+		name        string
+		handler     http.HandlerFunc
+		wantStatus  int
+		wantWritten int64
+	}{
+		{
+			name:       "Nothing written",
+			handler:    func(w http.ResponseWriter, r *http.Request) {},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "Body only",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("hello"))
+				w.Write([]byte(", world"))
+			},
+			wantStatus:  http.StatusOK,
+			wantWritten: 12,
+		},
+		{
+			name: "Status then body",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+				w.Write([]byte("short and stout"))
+			},
+			wantStatus:  http.StatusTeapot,
+			wantWritten: 15,
+		},
+		{
+			name: "Informational header first",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusEarlyHints)
+				w.WriteHeader(http.StatusNotFound)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "Second header ignored",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			wantStatus: http.StatusCreated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := wrapResponse(httptest.NewRecorder())
+			tt.handler(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			assert.Equal(t, rw.Status(), tt.wantStatus)
+			assert.Equal(t, rw.Written(), tt.wantWritten)
+		})
+	}
+}
+
+func TestWrapResponseShared(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rw := wrapResponse(rec)
+
+	// Middleware further in reuses the same wrapper rather than adding one
+	assert.Equal(t, wrapResponse(rw), rw)
+	assert.Equal(t, rw.Unwrap(), http.ResponseWriter(rec))
+
+	// Flushing reaches the recorder through the wrapper
+	rw.Write([]byte("x"))
+	if err := http.NewResponseController(rw).Flush(); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, rec.Flushed, true)
+
+	// The recorder can't be hijacked, and says so
+	if _, _, err := rw.Hijack(); err == nil {
+		t.Error("expected an error hijacking a recorder")
+	}
+}
+
+func TestInstrumentStatus(t *testing.T) {
+	app := newTestApplication(t)
+
+	router := newRouter()
+	router.HandlerFunc(http.MethodGet, "/teapot/:id", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	})
+	h := app.instrument(app.logRequest(router))
+
+	counter := requestsTotal.WithLabelValues("GET", "/teapot/:id", "418")
+	before := testutil.ToFloat64(counter)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/teapot/1", nil))
+
+	assert.Equal(t, rec.Code, http.StatusTeapot)
+	assert.Equal(t, rec.Body.String(), "short and stout")
+	assert.Equal(t, testutil.ToFloat64(counter), before+1)
+}
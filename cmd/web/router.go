@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// =============================================================================
+// Router
+// =============================================================================
+// httprouter with the method handling the standard library leaves to it:
+// every GET route answers HEAD too, OPTIONS is answered for every path
+// with the methods it allows, and HTML forms, which can only GET and POST,
+// can ask for PUT, PATCH or DELETE with a _method field.
+
+// methodOverrideField is the form field naming the method a POSTed form
+// stands in for
+const methodOverrideField = "_method"
+
+// labelledRouter is an httprouter.Router whose routes record their pattern
+// in the request's routeLabel, and whose GET routes answer HEAD
+type labelledRouter struct {
+	*httprouter.Router
+}
+
+// newRouter returns a labelledRouter with no routes. OPTIONS requests get
+// an empty 204 with the Allow header httprouter works out for the path.
+func newRouter() labelledRouter {
+	router := httprouter.New()
+	router.GlobalOPTIONS = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return labelledRouter{router}
+}
+
+// Handler registers a handler for a method and path pattern. GET handlers
+// serve HEAD requests as well; the server drops the body they write.
+func (rt labelledRouter) Handler(method, path string, handler http.Handler) {
+	labelled := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if label, ok := r.Context().Value(routeContextKey).(*routeLabel); ok {
+			label.pattern = path
+		}
+		handler.ServeHTTP(w, r)
+	})
+
+	rt.Router.Handler(method, path, labelled)
+	if method == http.MethodGet {
+		rt.Router.Handler(http.MethodHead, path, labelled)
+	}
+}
+
+// HandlerFunc registers a handler function for a method and path pattern
+func (rt labelledRouter) HandlerFunc(method, path string, handler http.HandlerFunc) {
+	rt.Handler(method, path, handler)
+}
+
+// methodOverride routes a POSTed form with a _method field of PUT, PATCH
+// or DELETE as a request of that method. Only URL-encoded forms are read
+// here; multipart bodies are left for limitBody to cap first. The form
+// stays parsed, so noSurf and the handler still find the CSRF token and
+// other fields.
+func (app *application) methodOverride(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+			if err := r.ParseForm(); err != nil {
+				app.clientError(w, http.StatusBadRequest)
+				return
+			}
+			switch method := strings.ToUpper(r.PostForm.Get(methodOverrideField)); method {
+			case http.MethodPut, http.MethodPatch, http.MethodDelete:
+				r.Method = method
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
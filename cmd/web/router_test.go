@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestRouterHead(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+
+	rs := ts.Do(t, ts.NewRequest(t, http.MethodHead, "/snippet/view/1", nil))
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.Equal(t, rs.Header.Get("Content-Type"), "text/html; charset=utf-8")
+	assert.Equal(t, rs.Body, "")
+
+	rs = ts.Do(t, ts.NewRequest(t, http.MethodHead, "/snippet/view/99", nil))
+	assert.Equal(t, rs.Status, http.StatusNotFound)
+
+	rs = ts.Do(t, ts.NewRequest(t, http.MethodHead, "/avatar/3", nil))
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.Equal(t, rs.Header.Get("Content-Type"), "image/png")
+	assert.Equal(t, rs.Body, "")
+}
+
+func TestRouterOptions(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+
+	tests := []struct {
+		path  string
+		allow string
+	}{
+		{"/snippet/view/1", "GET, HEAD, OPTIONS"},
+		{"/snippet/create", "GET, HEAD, OPTIONS, POST"},
+		{"/account/avatar", "DELETE, GET, HEAD, OPTIONS, POST"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rs := ts.Do(t, ts.NewRequest(t, http.MethodOptions, tt.path, nil))
+			assert.Equal(t, rs.Status, http.StatusNoContent)
+			assert.Equal(t, rs.Header.Get("Allow"), tt.allow)
+			assert.Equal(t, rs.Body, "")
+		})
+	}
+}
+
+func TestMethodOverride(t *testing.T) {
+	app := newTestApplication(t)
+	store := &fakeStore{}
+	app.avatarStore = store
+	ts := testutil.NewServer(t, app.routes())
+	ts.Login(t, "alice@example.com", "pa$$word")
+
+	rs := ts.Submit(t, "/account/avatar", "/account/avatar", url.Values{"_method": {"delete"}})
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/account/avatar")
+	assert.Equal(t, len(store.deleted), 2)
+
+	// The overridden request is still checked for its CSRF token
+	req := ts.NewRequest(t, http.MethodPost, "/account/avatar", strings.NewReader("_method=DELETE"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rs = ts.Do(t, req)
+	assert.Equal(t, rs.Status, http.StatusBadRequest)
+	assert.Equal(t, len(store.deleted), 2)
+
+	var method string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+	})
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+	}{
+		{"Delete", "application/x-www-form-urlencoded", "_method=DELETE", http.MethodDelete},
+		{"Patch", "application/x-www-form-urlencoded", "csrf_token=x&_method=patch", http.MethodPatch},
+		{"Not overridable", "application/x-www-form-urlencoded", "_method=GET", http.MethodPost},
+		{"No field", "application/x-www-form-urlencoded", "title=O+snail", http.MethodPost},
+		{"Multipart", "multipart/form-data; boundary=x", "--x\r\nContent-Disposition: form-data; name=\"_method\"\r\n\r\nDELETE\r\n--x--\r\n", http.MethodPost},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			app.methodOverride(next).ServeHTTP(httptest.NewRecorder(), r)
+			assert.Equal(t, method, tt.want)
+		})
+	}
+}
@@ -2,9 +2,10 @@ package main
 
 import (
 	"net/http"
+	"strings"
 
-	"github.com/julienschmidt/httprouter"
 	"github.com/justinas/alice"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"adotkaya.playground/ui"
 )
@@ -15,17 +16,8 @@ import (
 
 // routes configures all application routes and middleware chains
 func (app *application) routes() http.Handler {
-	// Initialize router
-	router := httprouter.New()
-
-	// -------------------------------------------------------------------------
-	// Custom Error Handlers
-	// -------------------------------------------------------------------------
-
-	// Handle 404 Not Found errors
-	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		app.notFound(w)
-	})
+	// Initialize router, recording each route's pattern for instrumentation
+	router := newRouter()
 
 	// -------------------------------------------------------------------------
 	// Static File Server
@@ -39,57 +31,366 @@ func (app *application) routes() http.Handler {
 	// Health Check Route
 	// -------------------------------------------------------------------------
 
-	// Health check endpoint (no middleware required)
+	// Health check endpoints (no middleware required)
 	router.HandlerFunc(http.MethodGet, "/ping", ping)
+	router.HandlerFunc(http.MethodGet, "/health", app.health)
+
+	// Avatars, served without the session so they can be cached
+	router.HandlerFunc(http.MethodGet, "/avatar/:id", app.avatar)
+
+	// Crawler rules
+	router.HandlerFunc(http.MethodGet, "/robots.txt", app.robots)
+
+	// Page view analytics, without the session so it sets no cookies, with
+	// small bodies and a rate limit per client address
+	if app.config.Analytics.Enabled {
+		beacon := alice.New(app.limitBody(maxBeaconSize), app.limitBeacons)
+		router.Handler(http.MethodPost, "/beacon", beacon.ThenFunc(app.beacon))
+	}
+
+	// Prometheus metrics
+	router.Handler(http.MethodGet, "/metrics", promhttp.Handler())
 
 	// -------------------------------------------------------------------------
 	// Dynamic Middleware Chain
 	// -------------------------------------------------------------------------
 	// Applied to routes that need session management, CSRF protection, and
-	// authentication checking (but don't require authentication)
+	// authentication checking. page adds authorize at the end of the chain,
+	// after any middleware particular to the route.
 	//
 	// Middleware order:
-	//   1. LoadAndSave - Load session data and save after response
-	//   2. noSurf - CSRF token generation and validation
+	//   1. loadSession - Load session data, migrating sessions written by
+	//      older builds, and save it after the response
+	//   2. noSurf - CSRF token generation and validation, except on the
+	//      configured exempt paths
 	//   3. authenticate - Check if user is authenticated and add to context
+	//   4. detectLocale - Negotiate the UI language and add to context
+	//   5. detectTheme - Select the colour theme and add to context
+	//   6. announce - Add the announcement banner to show, if any, to context
+	//
+	// Routes only requested by htmx use the hybrid chain, which swaps noSurf
+	// for requireCSRFHeader, so they work without the CSRF cookie and token.
 
-	dynamic := alice.New(app.sessionManager.LoadAndSave, noSurf, app.authenticate)
+	dynamicWith := func(csrf alice.Constructor) alice.Chain {
+		return alice.New(app.loadSession, csrf, app.authenticate, app.detectLocale, app.detectTheme, app.announce)
+	}
+	dynamic := dynamicWith(noSurf(app.config.CSRF.ExemptPaths))
+	hybrid := dynamicWith(app.requireCSRFHeader)
+
+	// page registers a route of the HTML site behind chain, then authorize,
+	// which lets through only the visitors routePolicies allows it. Who may
+	// use which page is listed there, not here.
+	page := func(method, path string, chain alice.Chain, handler http.HandlerFunc) {
+		router.Handler(method, path, chain.Append(app.authorize(method, path)).ThenFunc(handler))
+	}
 
 	// -------------------------------------------------------------------------
-	// Public Routes (Dynamic Middleware)
+	// Custom Error Handlers
 	// -------------------------------------------------------------------------
 
+	// Handle 404 Not Found errors (rendered with the base layout, so the
+	// dynamic chain is needed for session and CSRF data). API paths get a
+	// JSON error without session or CSRF cookies instead.
+	notFound := dynamic.ThenFunc(app.notFound)
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			app.apiError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+			return
+		}
+		notFound.ServeHTTP(w, r)
+	})
+
+	// Handle 405 Method Not Allowed errors in the same style, after the
+	// router has set the Allow header. noSurf is left out: these are mostly
+	// POST or DELETE requests, which it would turn away with a 400 for
+	// want of a CSRF token before the handler ran.
+	errorPage := alice.New(app.loadSession, app.authenticate, app.detectLocale, app.detectTheme, app.announce)
+	router.MethodNotAllowed = errorPage.ThenFunc(app.methodNotAllowed)
+
+	// -------------------------------------------------------------------------
+	// Cached Public Routes
+	// -------------------------------------------------------------------------
+	// Anonymous visitors are served from the page cache.
+	//
+	// Additional middleware:
+	//   7. cachePage - Serve and store rendered pages for anonymous GETs
+
+	cached := dynamic.Append(app.cachePage)
+
 	// Homepage
-	router.Handler(http.MethodGet, "/", dynamic.ThenFunc(app.home))
+	page(http.MethodGet, "/", cached, app.home)
+	page(http.MethodGet, "/trending", cached, app.trending)
+
+	// Newly created snippets, streamed to the home page
+	page(http.MethodGet, "/events", dynamic, app.eventStream)
+
+	// View snippet (by ID), counting the view before the cache is checked
+	page(http.MethodGet, "/snippet/view/:id", dynamic.Append(app.countView, app.cachePage), app.snippetView)
+
+	// -------------------------------------------------------------------------
+	// Public Routes (Dynamic Middleware)
+	// -------------------------------------------------------------------------
+
+	// Latest snippets listing (htmx fragment)
+	page(http.MethodGet, "/snippet/list", dynamic, app.snippetList)
+
+	// Search snippets
+	page(http.MethodGet, "/snippet/search", dynamic, app.snippetSearch)
+
+	// Public instance statistics
+	page(http.MethodGet, "/about/stats", dynamic, app.aboutStats)
 
-	// View snippet (by ID)
-	router.Handler(http.MethodGet, "/snippet/view/:id", dynamic.ThenFunc(app.snippetView))
+	// Browse public snippets by language or tag
+	page(http.MethodGet, "/browse/language/:lang", dynamic, app.browseLanguage)
+	page(http.MethodGet, "/browse/tag/:tag", dynamic, app.browseTag)
 
-	// User signup
-	router.Handler(http.MethodGet, "/user/signup", dynamic.ThenFunc(app.userSignup))
-	router.Handler(http.MethodPost, "/user/signup", dynamic.ThenFunc(app.userSignupPost))
+	// Snippet content as plain text, inline or as a download. Scripts use
+	// these, so they count against the API rate limit.
+	//
+	// Additional middleware:
+	//   7. limitAPI - 429 when over the visitor's tier's API rate limit
+
+	api := dynamic.Append(app.limitAPI)
+	page(http.MethodGet, "/snippet/raw/:id", api, app.snippetRaw)
+	page(http.MethodGet, "/snippet/download/:id", api, app.snippetDownload)
+
+	// User signup. Submissions caught by the bot traps (a hidden field and
+	// a minimum fill time) are turned away before the handler.
+	page(http.MethodGet, "/user/signup", dynamic, app.userSignup)
+	page(http.MethodPost, "/user/signup", dynamic.Append(app.trapBots), app.userSignupPost)
 
 	// User login
-	router.Handler(http.MethodGet, "/user/login", dynamic.ThenFunc(app.userLogin))
-	router.Handler(http.MethodPost, "/user/login", dynamic.ThenFunc(app.userLoginPost))
+	page(http.MethodGet, "/user/login", dynamic, app.userLogin)
+	page(http.MethodPost, "/user/login", dynamic, app.userLoginPost)
+
+	// Complete a login from an unfamiliar device, from the emailed link
+	page(http.MethodGet, "/user/login/confirm", dynamic, app.userLoginConfirm)
+
+	// SAML single sign-on, when configured. The identity provider posts its
+	// response from another site, so the assertion consumer service skips
+	// the CSRF check; the signed response, which must answer the request
+	// in the visitor's cookie, stands in for it.
+	if app.saml != nil {
+		router.HandlerFunc(http.MethodGet, "/saml/metadata", app.samlMetadata)
+		router.HandlerFunc(http.MethodGet, "/saml/login", app.samlLogin)
+		sso := alice.New(app.loadSession, app.detectLocale)
+		router.Handler(http.MethodPost, "/saml/acs", sso.ThenFunc(app.samlACS))
+	}
+
+	// SCIM user provisioning, when configured. The identity provider
+	// authenticates with a bearer token instead of a session.
+	if app.config.SCIM.Enabled() {
+		scim := alice.New(app.requireSCIMToken)
+		router.Handler(http.MethodGet, "/scim/v2/ServiceProviderConfig", scim.ThenFunc(app.scimServiceProviderConfig))
+		router.Handler(http.MethodGet, "/scim/v2/Users", scim.ThenFunc(app.scimUserList))
+		router.Handler(http.MethodPost, "/scim/v2/Users", scim.ThenFunc(app.scimUserCreate))
+		router.Handler(http.MethodGet, "/scim/v2/Users/:id", scim.ThenFunc(app.scimUserGet))
+		router.Handler(http.MethodPut, "/scim/v2/Users/:id", scim.ThenFunc(app.scimUserReplace))
+		router.Handler(http.MethodPatch, "/scim/v2/Users/:id", scim.ThenFunc(app.scimUserPatch))
+		router.Handler(http.MethodDelete, "/scim/v2/Users/:id", scim.ThenFunc(app.scimUserDelete))
+	}
 
 	// -------------------------------------------------------------------------
-	// Protected Routes (Authentication Required)
+	// JSON API (Token Authentication)
 	// -------------------------------------------------------------------------
-	// These routes require the user to be authenticated. If not authenticated,
-	// the user will be redirected to the login page.
+	// Scripts authenticate with a bearer token instead of a session, so these
+	// routes load no session and set no CSRF cookie, and skip the CSRF check.
 	//
-	// Additional middleware:
-	//   4. requireAuthentication - Redirect to login if not authenticated
+	// Middleware order:
+	//   1. negotiateJSON - 406 if the Accept header rules out JSON
+	//   2. authenticateToken - Check the bearer token, if any, and add the
+	//      user to context
+	//   3. limitAPI - 429 when over the visitor's tier's API rate limit
+	//   4. requireToken - 401 if no token was sent (authenticated routes)
+
+	apiPublic := alice.New(app.negotiateJSON, app.authenticateToken, app.limitAPI)
+	apiProtected := apiPublic.Append(app.requireToken)
+
+	// The user the token belongs to
+	router.Handler(http.MethodGet, "/api/v1/user", apiProtected.ThenFunc(app.apiCurrentUser))
 
-	protected := dynamic.Append(app.requireAuthentication)
+	// Snippets: anyone can read public ones; writing needs a token, and
+	// changing one needs its owner's
+	router.Handler(http.MethodGet, "/api/v1/snippets", apiPublic.ThenFunc(app.apiSnippetList))
+	router.Handler(http.MethodPost, "/api/v1/snippets", apiProtected.ThenFunc(app.apiSnippetCreate))
+	router.Handler(http.MethodGet, "/api/v1/snippets/:id", apiPublic.ThenFunc(app.apiSnippetView))
+	router.Handler(http.MethodPut, "/api/v1/snippets/:id", apiProtected.ThenFunc(app.apiSnippetUpdate))
+	router.Handler(http.MethodDelete, "/api/v1/snippets/:id", apiProtected.ThenFunc(app.apiSnippetDelete))
 
-	// Create snippet
-	router.Handler(http.MethodGet, "/snippet/create", protected.ThenFunc(app.snippetCreate))
-	router.Handler(http.MethodPost, "/snippet/create", protected.ThenFunc(app.snippetCreatePost))
+	// The user's tokens, which can be revoked but not created
+	router.Handler(http.MethodGet, "/api/v1/tokens", apiProtected.ThenFunc(app.apiTokenList))
+	router.Handler(http.MethodDelete, "/api/v1/tokens/:id", apiProtected.ThenFunc(app.apiTokenDelete))
+
+	// Language switcher
+	page(http.MethodPost, "/user/locale", dynamic, app.userLocalePost)
+
+	// Edit and delete a snippet (owners, including anonymous creators
+	// holding the owned snippets cookie)
+	page(http.MethodGet, "/snippet/edit/:id", dynamic, app.snippetEdit)
+	page(http.MethodPost, "/snippet/edit/:id", dynamic, app.snippetEditPost)
+	page(http.MethodPost, "/snippet/delete/:id", dynamic, app.snippetDeletePost)
+
+	// User profiles
+	page(http.MethodGet, "/user/profile/:id", dynamic, app.userProfile)
+
+	// Private snippets shared by a signed, time-limited link (no login
+	// needed)
+	page(http.MethodGet, "/snippet/shared/:id", dynamic, app.snippetShared)
+
+	// Warning before following a link to another site from user content
+	page(http.MethodGet, "/leaving", dynamic, app.leaving)
+
+	// Theme switcher
+	page(http.MethodPost, "/user/theme", dynamic, app.userThemePost)
+
+	// Unsubscribe links from notification emails (no login needed)
+	page(http.MethodGet, "/unsubscribe", dynamic, app.unsubscribe)
+	page(http.MethodPost, "/unsubscribe", dynamic, app.unsubscribePost)
+
+	// -------------------------------------------------------------------------
+	// Account Routes
+	// -------------------------------------------------------------------------
+	// Mostly for logged-in users; see routePolicies.
+
+	// Create snippet, and preview it before publishing (htmx fragment).
+	// Visitors without an account may create snippets too when anonymous
+	// snippets are enabled. Submissions go through the bot traps first.
+	page(http.MethodGet, "/snippet/create", dynamic, app.snippetCreate)
+	page(http.MethodPost, "/snippet/create", dynamic.Append(app.trapBots), app.snippetCreatePost)
+	page(http.MethodPost, "/snippet/preview", hybrid, app.snippetPreview)
+
+	// Create a snippet encrypted in the browser
+	page(http.MethodGet, "/snippet/create/encrypted", dynamic, app.snippetCreateEncrypted)
+	page(http.MethodPost, "/snippet/create/encrypted", dynamic.Append(app.trapBots), app.snippetCreateEncryptedPost)
+
+	// Import a snippet from Pastebin or GitLab
+	page(http.MethodGet, "/snippet/import", dynamic, app.snippetImport)
+	page(http.MethodPost, "/snippet/import", dynamic, app.snippetImportPost)
+
+	// Report a snippet for moderation
+	page(http.MethodPost, "/snippet/report/:id", dynamic, app.snippetReportPost)
+
+	// Create and revoke share links for a private snippet
+	page(http.MethodGet, "/snippet/share/:id", dynamic, app.snippetShare)
+	page(http.MethodPost, "/snippet/share/:id", dynamic, app.snippetSharePost)
+	page(http.MethodPost, "/snippet/share/:id/revoke", dynamic, app.snippetShareRevokePost)
+
+	// Follow and unfollow users, and the feed of snippets by followed users
+	page(http.MethodPost, "/user/profile/:id/follow", dynamic, app.userFollowPost)
+	page(http.MethodPost, "/user/profile/:id/unfollow", dynamic, app.userUnfollowPost)
+	page(http.MethodGet, "/feed", dynamic, app.feed)
 
 	// User logout
-	router.Handler(http.MethodPost, "/user/logout", protected.ThenFunc(app.userLogoutPost))
+	page(http.MethodPost, "/user/logout", dynamic, app.userLogoutPost)
+
+	// Saved searches and tag subscriptions
+	page(http.MethodGet, "/subscriptions", dynamic, app.subscriptionList)
+	page(http.MethodPost, "/subscriptions", dynamic, app.subscriptionCreatePost)
+	page(http.MethodPost, "/subscriptions/:id/delete", dynamic, app.subscriptionDeletePost)
+
+	// Password change
+	page(http.MethodGet, "/account/password/update", dynamic, app.accountPasswordUpdate)
+	page(http.MethodPost, "/account/password/update", dynamic, app.accountPasswordUpdatePost)
+
+	// Recent logins and sign-in security settings
+	page(http.MethodGet, "/account/security", dynamic, app.accountSecurity)
+	page(http.MethodPost, "/account/security", dynamic, app.accountSecurityPost)
+
+	// API tokens
+	page(http.MethodGet, "/account/tokens", dynamic, app.accountTokens)
+	page(http.MethodPost, "/account/tokens", dynamic, app.accountTokensPost)
+	page(http.MethodPost, "/account/tokens/:id/delete", dynamic, app.accountTokenDeletePost)
+
+	// GitHub integration, and pushing snippets to Gists
+	page(http.MethodGet, "/account/integrations", dynamic, app.accountIntegrations)
+	page(http.MethodPost, "/account/integrations", dynamic, app.accountIntegrationsPost)
+	page(http.MethodPost, "/account/integrations/delete", dynamic, app.accountIntegrationsDeletePost)
+	page(http.MethodPost, "/snippet/gist/:id", dynamic, app.snippetGistPost)
+
+	// Files attached to snippets, when an object store is configured. The
+	// owner manages them; anyone who can see the snippet downloads them.
+	// Uploads are capped before noSurf reads them.
+	if app.objects != nil {
+		upload := alice.New(app.limitBody(int64(app.config.Attachments.MaxSize) + uploadOverhead)).Extend(dynamic)
+		page(http.MethodGet, "/snippet/attachments/:id", dynamic, app.snippetAttachments)
+		page(http.MethodPost, "/snippet/attachments/:id", upload, app.snippetAttachmentsPost)
+		page(http.MethodGet, "/snippet/attachment/:id", dynamic, app.snippetAttachment)
+		page(http.MethodDelete, "/snippet/attachment/:id", dynamic, app.snippetAttachmentDelete)
+	}
+
+	// Avatars, uploaded into the configured store. Uploads are capped
+	// before noSurf reads them.
+	avatarUpload := alice.New(app.limitBody(int64(app.config.Avatars.MaxSize) + uploadOverhead)).Extend(dynamic)
+	page(http.MethodGet, "/account/avatar", dynamic, app.accountAvatar)
+	page(http.MethodPost, "/account/avatar", avatarUpload, app.accountAvatarPost)
+	page(http.MethodDelete, "/account/avatar", dynamic, app.accountAvatarDelete)
+
+	// In-app notifications
+	page(http.MethodGet, "/notifications", dynamic, app.inbox)
+
+	// Email notification preferences
+	page(http.MethodGet, "/account/notifications", dynamic, app.accountNotifications)
+	page(http.MethodPost, "/account/notifications", dynamic, app.accountNotificationsPost)
+
+	// The user's own snippets as CSV
+	page(http.MethodGet, "/account/snippets.csv", dynamic, app.accountExportSnippets)
+
+	// -------------------------------------------------------------------------
+	// Moderation Routes
+	// -------------------------------------------------------------------------
+
+	// Held and reported snippets
+	page(http.MethodGet, "/admin/moderation", dynamic, app.adminModeration)
+	page(http.MethodPost, "/admin/moderation/:id/approve", dynamic, app.adminModerationApprove)
+	page(http.MethodPost, "/admin/moderation/:id/remove", dynamic, app.adminModerationRemove)
+	page(http.MethodPost, "/admin/moderation/:id/ban", dynamic, app.adminModerationBan)
+
+	// -------------------------------------------------------------------------
+	// Admin Routes
+	// -------------------------------------------------------------------------
+
+	// Recent email deliveries and failures
+	page(http.MethodGet, "/admin/mail", dynamic, app.adminMail)
+
+	// IP bans
+	page(http.MethodGet, "/admin/bans", dynamic, app.adminBans)
+	page(http.MethodPost, "/admin/bans", dynamic, app.adminBansPost)
+	page(http.MethodPost, "/admin/bans/:id/delete", dynamic, app.adminBanDelete)
+
+	// Move a user to another tier
+	page(http.MethodPost, "/admin/users/:id/tier", dynamic, app.adminUserTierPost)
+
+	// Snippet change history, kept after snippets are deleted
+	page(http.MethodGet, "/admin/history", dynamic, app.adminHistory)
+
+	// Backups, written to the backup directory by the job worker
+	page(http.MethodGet, "/admin/backups", dynamic, app.adminBackups)
+	page(http.MethodPost, "/admin/backups", dynamic, app.adminBackupsPost)
+
+	// Site-wide announcement banners
+	page(http.MethodGet, "/admin/announcements", dynamic, app.adminAnnouncements)
+	page(http.MethodPost, "/admin/announcements", dynamic, app.adminAnnouncementsPost)
+	page(http.MethodGet, "/admin/announcements/:id", dynamic, app.adminAnnouncementEdit)
+	page(http.MethodPost, "/admin/announcements/:id", dynamic, app.adminAnnouncementEditPost)
+	page(http.MethodPost, "/admin/announcements/:id/delete", dynamic, app.adminAnnouncementDelete)
+
+	// Search reindexing, trending scores and vacuuming, run by the job worker
+	page(http.MethodGet, "/admin/maintenance", dynamic, app.adminMaintenance)
+	page(http.MethodPost, "/admin/maintenance", dynamic, app.adminMaintenancePost)
+
+	// Predefined read-only queries, shown or downloaded as CSV
+	page(http.MethodGet, "/admin/reports", dynamic, app.adminReports)
+
+	// Every user and snippet as CSV
+	page(http.MethodGet, "/admin/export/users.csv", dynamic, app.adminExportUsers)
+	page(http.MethodGet, "/admin/export/snippets.csv", dynamic, app.adminExportSnippets)
+
+	// Log level and debug sampling of this instance
+	page(http.MethodGet, "/admin/logging", dynamic, app.adminLogging)
+	page(http.MethodPost, "/admin/logging", dynamic, app.adminLoggingPost)
+
+	// Page views counted by the analytics beacon
+	page(http.MethodGet, "/admin/analytics", dynamic, app.adminAnalytics)
 
 	// -------------------------------------------------------------------------
 	// Standard Middleware Chain
@@ -97,11 +398,22 @@ func (app *application) routes() http.Handler {
 	// Applied to ALL routes for core functionality
 	//
 	// Middleware order:
-	//   1. recoverPanic - Recover from panics and return 500 error
-	//   2. logRequest - Log all incoming requests
-	//   3. secureHeaders - Add security headers to all responses
+	//   1. assignRequestID - Give each request an ID. It must come before
+	//      instrument and logRequest, which read it: it goes on the
+	//      response writer instrument shares, for the 500 error log, and
+	//      on every record logged for the request.
+	//   2. instrument - Time and count requests by the pattern of the route
+	//      matched, wrapping the response writer the rest share
+	//   3. logRequest - Log each request with its status, size and duration
+	//   4. recoverPanic - Recover from panics and return 500 error
+	//   5. rejectBanned - Refuse banned clients with 403 Forbidden
+	//   6. secureHeaders - Add security headers to all responses
+	//   7. requestDeadline - Cancel the request's database work once the
+	//      response can no longer be written
+	//   8. methodOverride - Route forms with a _method field as PUT, PATCH
+	//      or DELETE requests
 
-	standard := alice.New(app.recoverPanic, app.logRequest, secureHeaders)
+	standard := alice.New(app.assignRequestID, app.instrument, app.logRequest, app.recoverPanic, app.rejectBanned, secureHeaders(app.config.Server.ReferrerPolicy, app.config.Server.PermissionsPolicy), app.requestDeadline, app.methodOverride)
 
 	// Return the router wrapped in the standard middleware chain
 	return standard.Then(router)
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/crewjam/saml"
+	dsig "github.com/russellhaering/goxmldsig"
+
+	"adotkaya.playground/internal/cookies"
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/validator"
+)
+
+// =============================================================================
+// SAML Single Sign-On
+// =============================================================================
+
+const (
+	// samlRequestCookie holds the ID of the authentication request sent to
+	// the identity provider, so only a response to it is accepted
+	samlRequestCookie = "saml_request"
+	samlRequestTTL    = 10 * time.Minute
+
+	// samlMetadataTimeout bounds fetching the identity provider's metadata
+	// at startup
+	samlMetadataTimeout = 10 * time.Second
+
+	// maxMetadataSize bounds the identity provider's metadata document
+	maxMetadataSize = 1 << 20
+)
+
+// samlIdentity is a user as asserted by the identity provider
+type samlIdentity struct {
+	Subject string // Persistent NameID, stable across sign-ins
+	Email   string
+	Name    string
+}
+
+// newServiceProvider returns the SAML service provider configured in cfg,
+// with the identity provider's metadata read from a file or fetched
+func newServiceProvider(cfg *Config) (*saml.ServiceProvider, error) {
+	pair, err := tls.LoadX509KeyPair(cfg.SAML.CertFile, cfg.SAML.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := pair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("SAML key must be an RSA key")
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+
+	idp, err := loadIDPMetadata(cfg.SAML)
+	if err != nil {
+		return nil, fmt.Errorf("identity provider metadata: %w", err)
+	}
+
+	return samlServiceProvider(cfg.Server.BaseURL, key, cert, idp)
+}
+
+// samlServiceProvider returns the service provider for the site at
+// baseURL, signing with key and trusting the identity provider described
+// by idp
+func samlServiceProvider(baseURL string, key *rsa.PrivateKey, cert *x509.Certificate, idp *saml.EntityDescriptor) (*saml.ServiceProvider, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	sp := &saml.ServiceProvider{
+		EntityID:    base.JoinPath("/saml/metadata").String(),
+		Key:         key,
+		Certificate: cert,
+		MetadataURL: *base.JoinPath("/saml/metadata"),
+		AcsURL:      *base.JoinPath("/saml/acs"),
+		IDPMetadata: idp,
+
+		// Users are matched by subject, so it must not change between
+		// sign-ins as transient IDs do
+		AuthnNameIDFormat: saml.PersistentNameIDFormat,
+		SignatureMethod:   dsig.RSASHA256SignatureMethod,
+	}
+	if sp.GetSSOBindingLocation(saml.HTTPRedirectBinding) == "" {
+		return nil, errors.New("identity provider has no HTTP-Redirect single sign-on service")
+	}
+	return sp, nil
+}
+
+// loadIDPMetadata reads the identity provider's metadata from the
+// configured file or, failing that, fetches it from the configured URL
+func loadIDPMetadata(cfg SAMLConfig) (*saml.EntityDescriptor, error) {
+	var data []byte
+	var err error
+	if cfg.IDPMetadataFile != "" {
+		data, err = os.ReadFile(cfg.IDPMetadataFile)
+	} else {
+		data, err = fetchMetadata(cfg.IDPMetadataURL)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	idp := &saml.EntityDescriptor{}
+	if err := xml.Unmarshal(data, idp); err != nil {
+		return nil, err
+	}
+	return idp, nil
+}
+
+// fetchMetadata downloads a metadata document
+func fetchMetadata(url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), samlMetadataTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxMetadataSize))
+}
+
+// samlIdentity maps an assertion to the user it vouches for. The email
+// address comes from the configured attribute or an email address NameID;
+// the name defaults to the email address's local part.
+func (app *application) samlIdentity(a *saml.Assertion) (samlIdentity, error) {
+	if a.Subject == nil || a.Subject.NameID == nil || a.Subject.NameID.Value == "" {
+		return samlIdentity{}, errors.New("assertion has no subject")
+	}
+	nameID := a.Subject.NameID
+
+	id := samlIdentity{
+		Subject: nameID.Value,
+		Email:   samlAttribute(a, app.config.SAML.EmailAttribute),
+		Name:    samlAttribute(a, app.config.SAML.NameAttribute),
+	}
+	if id.Email == "" && nameID.Format == string(saml.EmailAddressNameIDFormat) {
+		id.Email = nameID.Value
+	}
+
+	if !validator.MaxChars(id.Subject, 255) {
+		return samlIdentity{}, errors.New("assertion subject is too long")
+	}
+	if !validator.Matches(id.Email, validator.EmailRX) || !validator.MaxChars(id.Email, 255) {
+		return samlIdentity{}, fmt.Errorf("assertion has no valid email address for %q", id.Subject)
+	}
+	if id.Name == "" {
+		id.Name, _, _ = strings.Cut(id.Email, "@")
+	}
+	if !validator.MaxChars(id.Name, 255) {
+		id.Name = string([]rune(id.Name)[:255])
+	}
+
+	return id, nil
+}
+
+// samlAttribute returns the first value of the attribute with the given
+// name or friendly name, or "" if the assertion doesn't have it
+func samlAttribute(a *saml.Assertion, name string) string {
+	for _, stmt := range a.AttributeStatements {
+		for _, attr := range stmt.Attributes {
+			if (attr.Name == name || attr.FriendlyName == name) && len(attr.Values) > 0 {
+				return strings.TrimSpace(attr.Values[0].Value)
+			}
+		}
+	}
+	return ""
+}
+
+// samlMetadata serves the service provider's metadata, for registering the
+// site with the identity provider
+func (app *application) samlMetadata(w http.ResponseWriter, r *http.Request) {
+	buf, err := xml.MarshalIndent(app.saml.Metadata(), "", "  ")
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.Write(buf)
+}
+
+// samlLogin starts single sign-on by sending the visitor to the identity
+// provider with an authentication request
+func (app *application) samlLogin(w http.ResponseWriter, r *http.Request) {
+	req, err := app.saml.MakeAuthenticationRequest(
+		app.saml.GetSSOBindingLocation(saml.HTTPRedirectBinding),
+		saml.HTTPRedirectBinding,
+		saml.HTTPPostBinding,
+	)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	redirectURL, err := req.Redirect("", app.saml)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// The response is posted back from the identity provider's site, so
+	// the cookie has to be sent with cross-site requests
+	err = app.cookies.Write(w, &http.Cookie{
+		Name:     samlRequestCookie,
+		Value:    req.ID,
+		Path:     "/saml/acs",
+		MaxAge:   int(samlRequestTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteNoneMode,
+	})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	http.Redirect(w, r, redirectURL.String(), http.StatusFound)
+}
+
+// samlACS is the assertion consumer service. It checks the identity
+// provider's signed response to the request in the visitor's cookie, then
+// logs in the user it vouches for, creating their account if needed.
+func (app *application) samlACS(w http.ResponseWriter, r *http.Request) {
+	var requestIDs []string
+	if id, err := app.cookies.Read(r, samlRequestCookie); err == nil {
+		requestIDs = []string{id}
+	}
+	cookies.Delete(w, samlRequestCookie, "/saml/acs")
+
+	if err := r.ParseForm(); err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	assertion, err := app.saml.ParseResponse(r, requestIDs)
+	if err != nil {
+		// The public error says nothing useful
+		var invalid *saml.InvalidResponseError
+		if errors.As(err, &invalid) {
+			err = invalid.PrivateErr
+		}
+		app.ssoFailed(w, r, err)
+		return
+	}
+
+	identity, err := app.samlIdentity(assertion)
+	if err != nil {
+		app.ssoFailed(w, r, err)
+		return
+	}
+
+	id, err := app.users.AuthenticateSSO(identity.Subject, identity.Email, identity.Name)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			app.ssoFailed(w, r, fmt.Errorf("%s (%s) refused", identity.Subject, identity.Email))
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	if err = app.logIn(r, id); err != nil {
+		app.serverError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+}
+
+// ssoFailed logs and counts why single sign-on failed and sends the visitor
+// back to the login page
+func (app *application) ssoFailed(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.InfoContext(r.Context(), "SAML sign-on failed", "error", err)
+	failedLoginsTotal.WithLabelValues(routePattern(r)).Inc()
+	app.putFlash(r, app.translate(r, "flash.sso_failed"))
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+// testKeyPair returns a fresh RSA key and self-signed certificate
+func testKeyPair(t *testing.T, name string) (*rsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NilError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NilError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NilError(t, err)
+
+	return key, cert
+}
+
+// newTestIDP returns an identity provider for signing test responses
+func newTestIDP(t *testing.T) *saml.IdentityProvider {
+	key, cert := testKeyPair(t, "idp.example.com")
+	return &saml.IdentityProvider{
+		Key:         key,
+		Certificate: cert,
+		MetadataURL: url.URL{Scheme: "https", Host: "idp.example.com", Path: "/metadata"},
+		SSOURL:      url.URL{Scheme: "https", Host: "idp.example.com", Path: "/sso"},
+	}
+}
+
+// samlResponse returns the identity provider's signed response to the
+// request with the given ID, as posted to the assertion consumer service
+func samlResponse(t *testing.T, idp *saml.IdentityProvider, sp *saml.ServiceProvider, requestID string, session *saml.Session) string {
+	t.Helper()
+
+	metadata := sp.Metadata()
+	req := &saml.IdpAuthnRequest{
+		IDP:                     idp,
+		HTTPRequest:             httptest.NewRequest(http.MethodGet, idp.SSOURL.String(), nil),
+		Request:                 saml.AuthnRequest{ID: requestID},
+		ServiceProviderMetadata: metadata,
+		SPSSODescriptor:         &metadata.SPSSODescriptors[0],
+		ACSEndpoint:             &metadata.SPSSODescriptors[0].AssertionConsumerServices[0],
+		Now:                     time.Now(),
+	}
+	assert.NilError(t, saml.DefaultAssertionMaker{}.MakeAssertion(req, session))
+	assert.NilError(t, req.MakeResponse())
+
+	form, err := req.PostBinding()
+	assert.NilError(t, err)
+	return form.SAMLResponse
+}
+
+// newSAMLTestApplication returns a test application with single sign-on
+// set up against idp
+func newSAMLTestApplication(t *testing.T, idp *saml.IdentityProvider) *application {
+	app := newTestApplication(t)
+	app.config.SAML = SAMLConfig{EmailAttribute: "email", NameAttribute: "name"}
+
+	key, cert := testKeyPair(t, "snippetbox.example.com")
+	sp, err := samlServiceProvider(app.config.Server.BaseURL, key, cert, idp.Metadata())
+	assert.NilError(t, err)
+	app.saml = sp
+	return app
+}
+
+func TestSAMLMetadata(t *testing.T) {
+	app := newSAMLTestApplication(t, newTestIDP(t))
+	ts := testutil.NewServer(t, app.routes())
+
+	rs := ts.Get(t, "/saml/metadata")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.Equal(t, rs.Header.Get("Content-Type"), "application/samlmetadata+xml")
+	assert.StringContains(t, rs.Body, `entityID="https://snippetbox.example.com/saml/metadata"`)
+	assert.StringContains(t, rs.Body, `Location="https://snippetbox.example.com/saml/acs"`)
+
+	// Single sign-on is only offered when configured
+	ts = testutil.NewServer(t, newTestApplication(t).routes())
+	rs = ts.Get(t, "/saml/metadata")
+	assert.Equal(t, rs.Status, http.StatusNotFound)
+	rs = ts.Get(t, "/user/login")
+	assert.Equal(t, bytes.Contains([]byte(rs.Body), []byte(`href="/saml/login"`)), false)
+}
+
+func TestSAMLLogin(t *testing.T) {
+	idp := newTestIDP(t)
+	app := newSAMLTestApplication(t, idp)
+	ts := testutil.NewServer(t, app.routes())
+
+	// Starts from the login page, sending the request ID along in a cookie
+	start := func(t *testing.T) string {
+		rs := ts.Get(t, "/user/login")
+		assert.StringContains(t, rs.Body, `href="/saml/login"`)
+
+		rs = ts.Get(t, "/saml/login")
+		assert.Equal(t, rs.Status, http.StatusFound)
+		location, err := url.Parse(rs.Header.Get("Location"))
+		assert.NilError(t, err)
+		assert.Equal(t, location.Host, "idp.example.com")
+		assert.NotNil(t, location.Query().Get("SAMLRequest"))
+
+		for _, cookie := range (&http.Response{Header: rs.Header}).Cookies() {
+			if cookie.Name == samlRequestCookie {
+				r := httptest.NewRequest(http.MethodPost, "/saml/acs", nil)
+				r.AddCookie(cookie)
+				id, err := app.cookies.Read(r, samlRequestCookie)
+				assert.NilError(t, err)
+				return id
+			}
+		}
+		t.Fatal("no request cookie set")
+		return ""
+	}
+
+	alice := &saml.Session{
+		NameID:           "alice",
+		NameIDFormat:     string(saml.PersistentNameIDFormat),
+		CustomAttributes: []saml.Attribute{{Name: "email", Values: []saml.AttributeValue{{Value: "alice@example.com"}}}},
+	}
+
+	t.Run("Valid response", func(t *testing.T) {
+		requestID := start(t)
+		rs := ts.PostForm(t, "/saml/acs", url.Values{"SAMLResponse": {samlResponse(t, idp, app.saml, requestID, alice)}})
+		assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/snippet/create")
+
+		rs = ts.Get(t, "/snippet/create")
+		assert.Equal(t, rs.Status, http.StatusOK)
+	})
+
+	t.Run("Unsolicited response", func(t *testing.T) {
+		start(t)
+		rs := ts.PostForm(t, "/saml/acs", url.Values{"SAMLResponse": {samlResponse(t, idp, app.saml, "id-unsolicited", alice)}})
+		assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/user/login")
+	})
+
+	t.Run("Other identity provider", func(t *testing.T) {
+		requestID := start(t)
+		rogue := newTestIDP(t)
+		rs := ts.PostForm(t, "/saml/acs", url.Values{"SAMLResponse": {samlResponse(t, rogue, app.saml, requestID, alice)}})
+		assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/user/login")
+	})
+
+	t.Run("Refused user", func(t *testing.T) {
+		requestID := start(t)
+		mallory := &saml.Session{
+			NameID:       "mallory@example.com",
+			NameIDFormat: string(saml.EmailAddressNameIDFormat),
+		}
+		rs := ts.PostForm(t, "/saml/acs", url.Values{"SAMLResponse": {samlResponse(t, idp, app.saml, requestID, mallory)}})
+		assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/user/login")
+
+		rs = ts.Get(t, "/user/login")
+		assert.StringContains(t, rs.Body, "Single sign-on failed.")
+	})
+}
+
+func TestSAMLIdentity(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.SAML = SAMLConfig{EmailAttribute: "email", NameAttribute: "name"}
+
+	attribute := func(name, value string) saml.Attribute {
+		return saml.Attribute{FriendlyName: name, Values: []saml.AttributeValue{{Value: value}}}
+	}
+	assertion := func(format, nameID string, attrs ...saml.Attribute) *saml.Assertion {
+		return &saml.Assertion{
+			Subject:             &saml.Subject{NameID: &saml.NameID{Format: format, Value: nameID}},
+			AttributeStatements: []saml.AttributeStatement{{Attributes: attrs}},
+		}
+	}
+	persistent := string(saml.PersistentNameIDFormat)
+
+	tests := []struct {
+		name      string
+		assertion *saml.Assertion
+		want      samlIdentity
+		wantErr   bool
+	}{
+		{
+			name:      "Attributes",
+			assertion: assertion(persistent, "u-42", attribute("email", "dave@example.com"), attribute("name", "Dave Smith")),
+			want:      samlIdentity{Subject: "u-42", Email: "dave@example.com", Name: "Dave Smith"},
+		},
+		{
+			name:      "Email NameID",
+			assertion: assertion(string(saml.EmailAddressNameIDFormat), "dave@example.com"),
+			want:      samlIdentity{Subject: "dave@example.com", Email: "dave@example.com", Name: "dave"},
+		},
+		{
+			name:      "No email",
+			assertion: assertion(persistent, "u-42", attribute("name", "Dave Smith")),
+			wantErr:   true,
+		},
+		{
+			name:      "Invalid email",
+			assertion: assertion(persistent, "u-42", attribute("email", "dave")),
+			wantErr:   true,
+		},
+		{
+			name:      "No subject",
+			assertion: &saml.Assertion{},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := app.samlIdentity(tt.assertion)
+			assert.Equal(t, err != nil, tt.wantErr)
+			assert.Equal(t, got, tt.want)
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// =============================================================================
+// Scheduled Tasks
+// =============================================================================
+
+// scheduleFunc returns the next time a task should run after t
+type scheduleFunc func(t time.Time) time.Time
+
+// scheduledTask is a named function run on a schedule
+type scheduledTask struct {
+	name string
+	next scheduleFunc
+	run  func() error
+}
+
+// scheduler runs tasks at the times given by their schedules. Tasks should
+// be quick, typically just enqueuing a job so the work itself gets the job
+// queue's retries.
+type scheduler struct {
+	tasks  []scheduledTask
+	now    func() time.Time
+	lead   func() bool // Whether this instance runs tasks; nil if it always does
+	logger *slog.Logger
+}
+
+// newScheduler creates a scheduler with no tasks
+func newScheduler(logger *slog.Logger) *scheduler {
+	return &scheduler{
+		now:    time.Now,
+		logger: logger,
+	}
+}
+
+// add registers a task
+func (s *scheduler) add(name string, next scheduleFunc, run func() error) {
+	s.tasks = append(s.tasks, scheduledTask{name: name, next: next, run: run})
+}
+
+// run starts every task and blocks until ctx is cancelled
+func (s *scheduler) run(ctx context.Context) {
+	done := make(chan struct{})
+	for _, task := range s.tasks {
+		go func() {
+			s.runTask(ctx, task)
+			done <- struct{}{}
+		}()
+	}
+	for range s.tasks {
+		<-done
+	}
+}
+
+// runTask sleeps until each scheduled time of a task and runs it
+func (s *scheduler) runTask(ctx context.Context, task scheduledTask) {
+	for {
+		at := task.next(s.now())
+		s.logger.Info("scheduler: next run", "task", task.name, "at", at.Format(time.RFC3339))
+
+		timer := time.NewTimer(time.Until(at))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		// Another instance is running this occurrence
+		if s.lead != nil && !s.lead() {
+			continue
+		}
+
+		if err := task.run(); err != nil {
+			s.logger.Error("scheduler: task failed", "task", task.name, "error", err)
+		}
+	}
+}
+
+// daily returns a schedule running once a day at the given hour, in UTC
+func daily(hour int) scheduleFunc {
+	return func(t time.Time) time.Time {
+		t = t.UTC()
+		next := time.Date(t.Year(), t.Month(), t.Day(), hour, 0, 0, 0, time.UTC)
+		if !next.After(t) {
+			next = next.AddDate(0, 0, 1)
+		}
+		return next
+	}
+}
+
+// weekly returns a schedule running once a week on the given day and hour,
+// in UTC
+func weekly(day time.Weekday, hour int) scheduleFunc {
+	return func(t time.Time) time.Time {
+		t = t.UTC()
+		next := time.Date(t.Year(), t.Month(), t.Day(), hour, 0, 0, 0, time.UTC)
+		next = next.AddDate(0, 0, (int(day)-int(next.Weekday())+7)%7)
+		if !next.After(t) {
+			next = next.AddDate(0, 0, 7)
+		}
+		return next
+	}
+}
+
+// every returns a schedule running at each multiple of interval since the
+// zero time, e.g. on the hour for time.Hour
+func every(interval time.Duration) scheduleFunc {
+	return func(t time.Time) time.Time {
+		return t.UTC().Truncate(interval).Add(interval)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"adotkaya.playground/internal/assert"
+)
+
+func TestWeekly(t *testing.T) {
+	mondayNine := weekly(time.Monday, 9)
+
+	tests := []struct {
+		name string
+		now  string
+		want string
+	}{
+		{"Earlier in the week", "2024-03-06T15:04:05Z", "2024-03-11T09:00:00Z"},
+		{"Same day before", "2024-03-11T08:59:59Z", "2024-03-11T09:00:00Z"},
+		{"Exactly on time", "2024-03-11T09:00:00Z", "2024-03-18T09:00:00Z"},
+		{"Same day after", "2024-03-11T10:00:00Z", "2024-03-18T09:00:00Z"},
+		{"Sunday", "2024-03-17T23:00:00Z", "2024-03-18T09:00:00Z"},
+		{"Other time zone", "2024-03-11T10:30:00+02:00", "2024-03-11T09:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now, err := time.Parse(time.RFC3339, tt.now)
+			assert.NilError(t, err)
+
+			got := mondayNine(now).Format(time.RFC3339)
+			assert.Equal(t, got, tt.want)
+		})
+	}
+}
+
+func TestDaily(t *testing.T) {
+	eight := daily(8)
+
+	tests := []struct {
+		name string
+		now  string
+		want string
+	}{
+		{"Before", "2024-03-11T07:59:59Z", "2024-03-11T08:00:00Z"},
+		{"Exactly on time", "2024-03-11T08:00:00Z", "2024-03-12T08:00:00Z"},
+		{"After", "2024-03-11T20:00:00Z", "2024-03-12T08:00:00Z"},
+		{"End of month", "2024-03-31T09:00:00Z", "2024-04-01T08:00:00Z"},
+		{"Other time zone", "2024-03-11T09:30:00+02:00", "2024-03-11T08:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now, err := time.Parse(time.RFC3339, tt.now)
+			assert.NilError(t, err)
+
+			got := eight(now).Format(time.RFC3339)
+			assert.Equal(t, got, tt.want)
+		})
+	}
+}
+
+func TestEvery(t *testing.T) {
+	hourly := every(time.Hour)
+
+	tests := []struct {
+		name string
+		now  string
+		want string
+	}{
+		{"During the hour", "2024-03-11T08:15:00Z", "2024-03-11T09:00:00Z"},
+		{"Exactly on time", "2024-03-11T08:00:00Z", "2024-03-11T09:00:00Z"},
+		{"End of day", "2024-03-11T23:59:59Z", "2024-03-12T00:00:00Z"},
+		{"Other time zone", "2024-03-11T09:30:00+02:00", "2024-03-11T08:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now, err := time.Parse(time.RFC3339, tt.now)
+			assert.NilError(t, err)
+
+			got := hourly(now).Format(time.RFC3339)
+			assert.Equal(t, got, tt.want)
+		})
+	}
+}
+
+func TestSchedulerRun(t *testing.T) {
+	logger := slog.New(slog.DiscardHandler)
+	s := newScheduler(logger)
+
+	ran := make(chan struct{}, 1)
+	soon := func(t time.Time) time.Time { return t.Add(time.Millisecond) }
+	s.add("test", soon, func() error {
+		select {
+		case ran <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		s.run(ctx)
+		close(stopped)
+	}()
+
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("task did not run")
+	}
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("scheduler did not stop")
+	}
+}
+
+func TestSchedulerFollower(t *testing.T) {
+	logger := slog.New(slog.DiscardHandler)
+	s := newScheduler(logger)
+
+	var leading atomic.Bool
+	s.lead = leading.Load
+
+	ran := make(chan struct{}, 1)
+	soon := func(t time.Time) time.Time { return t.Add(time.Millisecond) }
+	s.add("test", soon, func() error {
+		select {
+		case ran <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.run(ctx)
+
+	// Tasks are skipped while another instance leads...
+	select {
+	case <-ran:
+		t.Fatal("task ran without leading")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// ...and run once this one does
+	leading.Store(true)
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("task did not run")
+	}
+}
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/validator"
+)
+
+// =============================================================================
+// SCIM User Provisioning
+// =============================================================================
+// A SCIM 2.0 (RFC 7643, RFC 7644) API for identity providers to create,
+// update and deactivate users. userName is the user's email address.
+
+const (
+	scimContentType = "application/scim+json"
+
+	scimUserSchema   = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimListSchema   = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimErrorSchema  = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+
+	// scimMaxResults caps the users returned per page
+	scimMaxResults = 100
+
+	// maxSCIMBodySize bounds request bodies
+	maxSCIMBodySize = 64 << 10
+
+	// minSCIMTokenLength is the shortest bearer token accepted in config
+	minSCIMTokenLength = 32
+)
+
+// scimFilterRX matches the only filter supported, which identity
+// providers use to look up a user before creating them
+var scimFilterRX = regexp.MustCompile(`(?i)^\s*userName\s+eq\s+"([^"]*)"\s*$`)
+
+// scimUser is the SCIM representation of a user
+type scimUser struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	UserName    string      `json:"userName"`
+	DisplayName string      `json:"displayName,omitempty"`
+	Name        *scimName   `json:"name,omitempty"`
+	Emails      []scimEmail `json:"emails,omitempty"`
+	Active      *bool       `json:"active,omitempty"`
+	Meta        *scimMeta   `json:"meta,omitempty"`
+}
+
+type scimName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type scimEmail struct {
+	Value   string `json:"value"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type scimMeta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	Location     string    `json:"location"`
+}
+
+// scimPatch is a PatchOp request
+type scimPatch struct {
+	Operations []struct {
+		Op    string          `json:"op"`
+		Path  string          `json:"path"`
+		Value json.RawMessage `json:"value"`
+	} `json:"Operations"`
+}
+
+// scimAccount is the part of a user the identity provider manages
+type scimAccount struct {
+	Name   string
+	Email  string
+	Active bool
+}
+
+// scimErr is a SCIM error response
+type scimErr struct {
+	status   int
+	scimType string // e.g. "uniqueness", "invalidValue"; may be empty
+	detail   string
+}
+
+func (e *scimErr) Error() string {
+	return e.detail
+}
+
+// invalidValue returns a 400 error for a request the API can't act on
+func invalidValue(format string, args ...any) *scimErr {
+	return &scimErr{status: http.StatusBadRequest, scimType: "invalidValue", detail: fmt.Sprintf(format, args...)}
+}
+
+// requireSCIMToken refuses requests without the configured bearer token
+func (app *application) requireSCIMToken(next http.Handler) http.Handler {
+	want := []byte("Bearer " + app.config.SCIM.Token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="scim"`)
+			app.scimError(w, &scimErr{status: http.StatusUnauthorized, detail: "Invalid bearer token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// scimServiceProviderConfig describes which parts of SCIM are supported
+func (app *application) scimServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	supported := func(ok bool) map[string]bool { return map[string]bool{"supported": ok} }
+	app.scimJSON(w, http.StatusOK, map[string]any{
+		"schemas":        []string{scimConfigSchema},
+		"patch":          supported(true),
+		"bulk":           map[string]any{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]any{"supported": true, "maxResults": scimMaxResults},
+		"changePassword": supported(false),
+		"sort":           supported(false),
+		"etag":           supported(false),
+		"authenticationSchemes": []map[string]string{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer Token",
+			"description": "Authentication with the configured SCIM token",
+		}},
+	})
+}
+
+// scimUserList lists users, or finds one with a userName filter
+func (app *application) scimUserList(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	email := ""
+	if filter := query.Get("filter"); filter != "" {
+		m := scimFilterRX.FindStringSubmatch(filter)
+		if m == nil {
+			app.scimError(w, &scimErr{status: http.StatusBadRequest, scimType: "invalidFilter", detail: "Only userName eq filters are supported"})
+			return
+		}
+		email = strings.ToLower(m[1])
+	}
+
+	startIndex := max(scimParam(query.Get("startIndex"), 1), 1)
+	count := min(max(scimParam(query.Get("count"), scimMaxResults), 0), scimMaxResults)
+
+	users, total, err := app.users.Accounts(email, startIndex-1, count)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	resources := make([]scimUser, len(users))
+	for i, u := range users {
+		resources[i] = app.scimResource(u)
+	}
+	app.scimJSON(w, http.StatusOK, map[string]any{
+		"schemas":      []string{scimListSchema},
+		"totalResults": total,
+		"startIndex":   startIndex,
+		"itemsPerPage": len(resources),
+		"Resources":    resources,
+	})
+}
+
+// scimUserCreate provisions a user
+func (app *application) scimUserCreate(w http.ResponseWriter, r *http.Request) {
+	var input scimUser
+	if err := decodeSCIM(w, r, &input); err != nil {
+		app.scimError(w, err)
+		return
+	}
+	account, err := input.account()
+	if err != nil {
+		app.scimError(w, err)
+		return
+	}
+
+	id, err := app.users.Provision(account.Name, account.Email, account.Active)
+	if err != nil {
+		app.scimModelError(w, err)
+		return
+	}
+	app.logger.InfoContext(r.Context(), "SCIM: provisioned user", "user_id", id, "email", account.Email)
+
+	u, err := app.users.Account(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	resource := app.scimResource(u)
+	w.Header().Set("Location", resource.Meta.Location)
+	app.scimJSON(w, http.StatusCreated, resource)
+}
+
+// scimUserGet returns a user
+func (app *application) scimUserGet(w http.ResponseWriter, r *http.Request) {
+	u, ok := app.scimLookup(w, r)
+	if !ok {
+		return
+	}
+	app.scimJSON(w, http.StatusOK, app.scimResource(u))
+}
+
+// scimUserReplace replaces a user's name, email address and status
+func (app *application) scimUserReplace(w http.ResponseWriter, r *http.Request) {
+	u, ok := app.scimLookup(w, r)
+	if !ok {
+		return
+	}
+
+	var input scimUser
+	if err := decodeSCIM(w, r, &input); err != nil {
+		app.scimError(w, err)
+		return
+	}
+	account, err := input.account()
+	if err != nil {
+		app.scimError(w, err)
+		return
+	}
+
+	app.scimUpdate(w, u, account)
+}
+
+// scimUserPatch applies add and replace operations to a user. Deactivating
+// a user is a replace of active with false.
+func (app *application) scimUserPatch(w http.ResponseWriter, r *http.Request) {
+	u, ok := app.scimLookup(w, r)
+	if !ok {
+		return
+	}
+
+	var patch scimPatch
+	if err := decodeSCIM(w, r, &patch); err != nil {
+		app.scimError(w, err)
+		return
+	}
+
+	account := scimAccount{Name: u.Name, Email: u.Email, Active: u.Active}
+	for _, op := range patch.Operations {
+		switch strings.ToLower(op.Op) {
+		case "add", "replace":
+		default:
+			app.scimError(w, invalidValue("Unsupported operation %q", op.Op))
+			return
+		}
+		if err := account.apply(op.Path, op.Value); err != nil {
+			app.scimError(w, err)
+			return
+		}
+	}
+
+	app.scimUpdate(w, u, account)
+}
+
+// scimUserDelete deactivates a user. Their account and snippets are kept,
+// but they can no longer log in.
+func (app *application) scimUserDelete(w http.ResponseWriter, r *http.Request) {
+	u, ok := app.scimLookup(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.users.UpdateAccount(u.ID, u.Name, u.Email, false)
+	if err != nil {
+		app.scimModelError(w, err)
+		return
+	}
+	app.logger.InfoContext(r.Context(), "SCIM: deactivated user", "user_id", u.ID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// scimLookup returns the user named in the URL, or sends a 404 and returns
+// false
+func (app *application) scimLookup(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.scimError(w, &scimErr{status: http.StatusNotFound, detail: "User not found"})
+		return nil, false
+	}
+
+	u, err := app.users.Account(id)
+	if err != nil {
+		app.scimModelError(w, err)
+		return nil, false
+	}
+	return u, true
+}
+
+// scimUpdate stores the account and responds with the updated user
+func (app *application) scimUpdate(w http.ResponseWriter, u *models.User, account scimAccount) {
+	err := app.users.UpdateAccount(u.ID, account.Name, account.Email, account.Active)
+	if err != nil {
+		app.scimModelError(w, err)
+		return
+	}
+	if u.Active != account.Active {
+		app.logger.Info("SCIM: set user active", "user_id", u.ID, "active", account.Active)
+	}
+
+	u.Name, u.Email, u.Active = account.Name, account.Email, account.Active
+	app.scimJSON(w, http.StatusOK, app.scimResource(u))
+}
+
+// scimResource returns the SCIM representation of a user
+func (app *application) scimResource(u *models.User) scimUser {
+	active := u.Active
+	return scimUser{
+		Schemas:     []string{scimUserSchema},
+		ID:          strconv.Itoa(u.ID),
+		UserName:    u.Email,
+		DisplayName: u.Name,
+		Name:        &scimName{Formatted: u.Name},
+		Emails:      []scimEmail{{Value: u.Email, Primary: true}},
+		Active:      &active,
+		Meta: &scimMeta{
+			ResourceType: "User",
+			Created:      u.Created.UTC(),
+			Location:     fmt.Sprintf("%s/scim/v2/Users/%d", strings.TrimSuffix(app.config.Server.BaseURL, "/"), u.ID),
+		},
+	}
+}
+
+// account validates a user sent by the identity provider. The email
+// address is the userName or, if that isn't one, the primary email; the
+// name defaults to the email address's local part.
+func (s *scimUser) account() (scimAccount, error) {
+	account := scimAccount{Email: s.UserName, Active: s.Active == nil || *s.Active}
+	if !validator.Matches(account.Email, validator.EmailRX) {
+		for _, email := range s.Emails {
+			if email.Primary || len(s.Emails) == 1 {
+				account.Email = email.Value
+			}
+		}
+	}
+
+	switch {
+	case s.DisplayName != "":
+		account.Name = s.DisplayName
+	case s.Name != nil && s.Name.Formatted != "":
+		account.Name = s.Name.Formatted
+	case s.Name != nil:
+		account.Name = strings.TrimSpace(s.Name.GivenName + " " + s.Name.FamilyName)
+	}
+
+	return account, account.validate()
+}
+
+// apply sets the attribute at path to value. Without a path, value is an
+// object of attributes to set.
+func (a *scimAccount) apply(path string, value json.RawMessage) error {
+	if path == "" {
+		var attrs map[string]json.RawMessage
+		if err := json.Unmarshal(value, &attrs); err != nil {
+			return invalidValue("Value must be an object when no path is given")
+		}
+		for name, v := range attrs {
+			if err := a.apply(name, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var err error
+	switch strings.ToLower(path) {
+	case "active":
+		a.Active, err = scimBool(value)
+	case "username":
+		err = json.Unmarshal(value, &a.Email)
+	case "displayname", "name.formatted":
+		err = json.Unmarshal(value, &a.Name)
+	case "name":
+		var name scimName
+		if err = json.Unmarshal(value, &name); err == nil && name.Formatted != "" {
+			a.Name = name.Formatted
+		}
+	default:
+		// Attributes the site doesn't keep, such as phone numbers, are
+		// ignored rather than failing the whole request
+		return nil
+	}
+	if err != nil {
+		return invalidValue("Invalid value for %s", path)
+	}
+	return a.validate()
+}
+
+// validate checks the account fits the users table
+func (a *scimAccount) validate() error {
+	a.Email = strings.ToLower(strings.TrimSpace(a.Email))
+	a.Name = strings.TrimSpace(a.Name)
+	if !validator.Matches(a.Email, validator.EmailRX) || !validator.MaxChars(a.Email, 255) {
+		return invalidValue("userName must be an email address")
+	}
+	if a.Name == "" {
+		a.Name, _, _ = strings.Cut(a.Email, "@")
+	}
+	if !validator.MaxChars(a.Name, 255) {
+		return invalidValue("Name must be at most 255 characters")
+	}
+	return nil
+}
+
+// scimBool decodes a boolean, also accepting the strings "True" and
+// "False" some identity providers send
+func scimBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return false, err
+	}
+	return strconv.ParseBool(s)
+}
+
+// scimParam parses an integer query parameter, or returns def if it
+// isn't one
+func scimParam(value string, def int) int {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// decodeSCIM decodes a JSON request body into dst
+func decodeSCIM(w http.ResponseWriter, r *http.Request, dst any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxSCIMBodySize)
+	if err := json.NewDecoder(r.Body).Decode(dst); err != nil {
+		return &scimErr{status: http.StatusBadRequest, scimType: "invalidSyntax", detail: "Request body is not valid JSON"}
+	}
+	return nil
+}
+
+// scimModelError responds to a model error, which is a server error
+// unless the user doesn't exist or the email address is taken
+func (app *application) scimModelError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrNoRecord):
+		app.scimError(w, &scimErr{status: http.StatusNotFound, detail: "User not found"})
+	case errors.Is(err, models.ErrDuplicateEmail):
+		app.scimError(w, &scimErr{status: http.StatusConflict, scimType: "uniqueness", detail: "userName is already in use"})
+	default:
+		app.serverError(w, err)
+	}
+}
+
+// scimError sends a SCIM error response
+func (app *application) scimError(w http.ResponseWriter, err error) {
+	var e *scimErr
+	if !errors.As(err, &e) {
+		app.serverError(w, err)
+		return
+	}
+
+	body := map[string]any{
+		"schemas": []string{scimErrorSchema},
+		"status":  strconv.Itoa(e.status),
+		"detail":  e.detail,
+	}
+	if e.scimType != "" {
+		body["scimType"] = e.scimType
+	}
+	app.scimJSON(w, e.status, body)
+}
+
+// scimJSON sends a SCIM response
+func (app *application) scimJSON(w http.ResponseWriter, status int, body any) {
+	js, err := json.Marshal(body)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", scimContentType)
+	w.WriteHeader(status)
+	w.Write(js)
+}
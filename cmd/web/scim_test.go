@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+const testSCIMToken = "test-scim-token-0123456789abcdef"
+
+// scimRequest sends a SCIM request with the given bearer token
+func scimRequest(t *testing.T, ts *testutil.Server, token, method, urlPath, body string) testutil.Response {
+	t.Helper()
+
+	req := ts.NewRequest(t, method, urlPath, strings.NewReader(body))
+	req.Header.Set("Content-Type", scimContentType)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return ts.Do(t, req)
+}
+
+// newSCIMTestServer returns a test server with the SCIM API enabled
+func newSCIMTestServer(t *testing.T) *testutil.Server {
+	app := newTestApplication(t)
+	app.config.SCIM = SCIMConfig{Token: testSCIMToken}
+	return testutil.NewServer(t, app.routes())
+}
+
+func TestSCIMAuthentication(t *testing.T) {
+	ts := newSCIMTestServer(t)
+
+	rs := scimRequest(t, ts, testSCIMToken, http.MethodGet, "/scim/v2/ServiceProviderConfig", "")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.Equal(t, rs.Header.Get("Content-Type"), scimContentType)
+
+	for _, token := range []string{"", "wrong"} {
+		rs = scimRequest(t, ts, token, http.MethodGet, "/scim/v2/Users", "")
+		assert.Equal(t, rs.Status, http.StatusUnauthorized)
+		assert.Equal(t, rs.Header.Get("WWW-Authenticate"), `Bearer realm="scim"`)
+		assert.StringContains(t, rs.Body, scimErrorSchema)
+	}
+
+	// Provisioning is only offered when configured
+	ts = testutil.NewServer(t, newTestApplication(t).routes())
+	rs = scimRequest(t, ts, testSCIMToken, http.MethodGet, "/scim/v2/Users", "")
+	assert.Equal(t, rs.Status, http.StatusNotFound)
+}
+
+func TestSCIMUsers(t *testing.T) {
+	ts := newSCIMTestServer(t)
+
+	tests := []struct {
+		name       string
+		method     string
+		urlPath    string
+		body       string
+		wantStatus int
+		wantBody   []string
+	}{
+		{
+			name:       "List",
+			method:     http.MethodGet,
+			urlPath:    "/scim/v2/Users",
+			wantStatus: http.StatusOK,
+			wantBody:   []string{`"totalResults":2`, `"userName":"alice@example.com"`, `"userName":"admin@example.com"`},
+		},
+		{
+			name:       "Filter",
+			method:     http.MethodGet,
+			urlPath:    "/scim/v2/Users?filter=userName+eq+%22Alice%40example.com%22",
+			wantStatus: http.StatusOK,
+			wantBody:   []string{`"totalResults":1`, `"id":"1"`},
+		},
+		{
+			name:       "Page",
+			method:     http.MethodGet,
+			urlPath:    "/scim/v2/Users?startIndex=2&count=1",
+			wantStatus: http.StatusOK,
+			wantBody:   []string{`"totalResults":2`, `"startIndex":2`, `"itemsPerPage":1`, `"id":"3"`},
+		},
+		{
+			name:       "Unsupported filter",
+			method:     http.MethodGet,
+			urlPath:    "/scim/v2/Users?filter=displayName+co+%22A%22",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   []string{`"scimType":"invalidFilter"`},
+		},
+		{
+			name:       "Get",
+			method:     http.MethodGet,
+			urlPath:    "/scim/v2/Users/1",
+			wantStatus: http.StatusOK,
+			wantBody:   []string{`"displayName":"Alice"`, `"active":true`, `"location":"https://snippetbox.example.com/scim/v2/Users/1"`},
+		},
+		{
+			name:       "Get missing",
+			method:     http.MethodGet,
+			urlPath:    "/scim/v2/Users/99",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "Create",
+			method:     http.MethodPost,
+			urlPath:    "/scim/v2/Users",
+			body:       `{"schemas":["urn:ietf:params:scim:schemas:core:2.0:User"],"userName":"dave@example.com","name":{"givenName":"Dave","familyName":"Smith"}}`,
+			wantStatus: http.StatusCreated,
+			wantBody:   []string{`"id":"2"`},
+		},
+		{
+			name:       "Create duplicate",
+			method:     http.MethodPost,
+			urlPath:    "/scim/v2/Users",
+			body:       `{"userName":"alice@example.com"}`,
+			wantStatus: http.StatusConflict,
+			wantBody:   []string{`"scimType":"uniqueness"`},
+		},
+		{
+			name:       "Create without email",
+			method:     http.MethodPost,
+			urlPath:    "/scim/v2/Users",
+			body:       `{"userName":"dave"}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   []string{`"scimType":"invalidValue"`},
+		},
+		{
+			name:       "Invalid JSON",
+			method:     http.MethodPost,
+			urlPath:    "/scim/v2/Users",
+			body:       `{"userName":`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   []string{`"scimType":"invalidSyntax"`},
+		},
+		{
+			name:       "Replace",
+			method:     http.MethodPut,
+			urlPath:    "/scim/v2/Users/1",
+			body:       `{"userName":"alice@example.org","displayName":"Alice Jones","active":true}`,
+			wantStatus: http.StatusOK,
+			wantBody:   []string{`"userName":"alice@example.org"`, `"displayName":"Alice Jones"`},
+		},
+		{
+			name:       "Replace with taken email",
+			method:     http.MethodPut,
+			urlPath:    "/scim/v2/Users/1",
+			body:       `{"userName":"dupe@example.com"}`,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "Deactivate",
+			method:     http.MethodPatch,
+			urlPath:    "/scim/v2/Users/1",
+			body:       `{"schemas":["urn:ietf:params:scim:api:messages:2.0:PatchOp"],"Operations":[{"op":"Replace","path":"active","value":"False"}]}`,
+			wantStatus: http.StatusOK,
+			wantBody:   []string{`"active":false`, `"userName":"alice@example.com"`},
+		},
+		{
+			name:       "Patch without path",
+			method:     http.MethodPatch,
+			urlPath:    "/scim/v2/Users/1",
+			body:       `{"Operations":[{"op":"replace","value":{"active":false,"displayName":"Alice Jones"}}]}`,
+			wantStatus: http.StatusOK,
+			wantBody:   []string{`"active":false`, `"displayName":"Alice Jones"`},
+		},
+		{
+			name:       "Patch remove",
+			method:     http.MethodPatch,
+			urlPath:    "/scim/v2/Users/1",
+			body:       `{"Operations":[{"op":"remove","path":"displayName"}]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Delete",
+			method:     http.MethodDelete,
+			urlPath:    "/scim/v2/Users/1",
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "Delete missing",
+			method:     http.MethodDelete,
+			urlPath:    "/scim/v2/Users/abc",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := scimRequest(t, ts, testSCIMToken, tt.method, tt.urlPath, tt.body)
+			assert.Equal(t, rs.Status, tt.wantStatus)
+			for _, want := range tt.wantBody {
+				assert.StringContains(t, rs.Body, want)
+			}
+		})
+	}
+
+	t.Run("Created location", func(t *testing.T) {
+		rs := scimRequest(t, ts, testSCIMToken, http.MethodPost, "/scim/v2/Users", `{"userName":"dave@example.com"}`)
+		assert.Equal(t, rs.Header.Get("Location"), "https://snippetbox.example.com/scim/v2/Users/2")
+
+		var user scimUser
+		assert.NilError(t, json.NewDecoder(bytes.NewBufferString(rs.Body)).Decode(&user))
+		assert.Equal(t, user.Meta.ResourceType, "User")
+		assert.Equal(t, *user.Active, true)
+	})
+}
+
+func TestSCIMAccount(t *testing.T) {
+	active := false
+
+	tests := []struct {
+		name    string
+		user    scimUser
+		want    scimAccount
+		wantErr bool
+	}{
+		{
+			name: "Display name",
+			user: scimUser{UserName: " Dave@Example.com", DisplayName: "Dave Smith"},
+			want: scimAccount{Name: "Dave Smith", Email: "dave@example.com", Active: true},
+		},
+		{
+			name: "Given and family name",
+			user: scimUser{UserName: "dave@example.com", Name: &scimName{GivenName: "Dave", FamilyName: "Smith"}, Active: &active},
+			want: scimAccount{Name: "Dave Smith", Email: "dave@example.com", Active: false},
+		},
+		{
+			name: "Primary email",
+			user: scimUser{UserName: "dsmith", Emails: []scimEmail{{Value: "d@example.org"}, {Value: "dave@example.com", Primary: true}}},
+			want: scimAccount{Name: "dave", Email: "dave@example.com", Active: true},
+		},
+		{
+			name:    "No email",
+			user:    scimUser{UserName: "dsmith"},
+			wantErr: true,
+		},
+		{
+			name:    "Long name",
+			user:    scimUser{UserName: "dave@example.com", DisplayName: strings.Repeat("a", 256)},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.user.account()
+			assert.Equal(t, err != nil, tt.wantErr)
+			if !tt.wantErr {
+				assert.Equal(t, got, tt.want)
+			}
+		})
+	}
+}
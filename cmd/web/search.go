@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"adotkaya.playground/internal/langdetect"
+	"adotkaya.playground/internal/query"
+	"adotkaya.playground/internal/validator"
+)
+
+// =============================================================================
+// Search Queries
+// =============================================================================
+// The search box takes words mixed with filters, such as lang:go or
+// created:>2024-01-01, parsed by the query package. Queries that don't
+// parse, or name a language or tag that can't exist, are shown back with
+// the problem rather than searched for.
+
+// searchPageSize is the number of search results shown per page
+const searchPageSize = 20
+
+// searchForm carries the errors in a search query
+type searchForm struct {
+	validator.Validator `form:"-"`
+}
+
+// queryErrorKeys maps the query package's errors to their messages
+var queryErrorKeys = map[error]string{
+	query.ErrUnknownField:  "search.error.unknown_field",
+	query.ErrEmptyValue:    "search.error.empty_value",
+	query.ErrBadDate:       "search.error.bad_date",
+	query.ErrUnclosedQuote: "search.error.unclosed_quote",
+	query.ErrRepeated:      "search.error.repeated",
+}
+
+// parseSearch parses a search query, adding any problem with it to form
+func (app *application) parseSearch(r *http.Request, form *searchForm, raw string) query.Query {
+	q, err := query.Parse(raw)
+	var qerr *query.Error
+	if errors.As(err, &qerr) {
+		form.AddFieldError("q", app.translate(r, queryErrorKeys[qerr.Err], qerr.Term))
+		return q
+	}
+
+	form.CheckField(q.Language == "" || langdetect.Known(q.Language), "q", app.translate(r, "search.error.language", q.Language))
+	form.CheckField(validTags(q.Tags), "q", app.translate(r, "search.error.tag"))
+	return q
+}
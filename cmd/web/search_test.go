@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestSnippetSearch(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Words",
+			query:    "pond",
+			wantCode: http.StatusOK,
+			wantBody: `An old silent <mark>pond</mark>...`,
+		},
+		{
+			name:     "Filters",
+			query:    "pond lang:go tag:haiku",
+			wantCode: http.StatusOK,
+			wantBody: "No snippets matched &#34;pond lang:go tag:haiku&#34;.",
+		},
+		{
+			name:     "Unknown filter",
+			query:    "author:alice",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "&#34;author:alice&#34; isn&#39;t a filter.",
+		},
+		{
+			name:     "Bad date",
+			query:    "created:>yesterday",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "&#34;created:&gt;yesterday&#34; needs a date like 2024-01-31",
+		},
+		{
+			name:     "Unknown language",
+			query:    "lang:cobol",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "&#34;cobol&#34; isn&#39;t a language snippets are sorted into.",
+		},
+		{
+			name:     "Bad tag",
+			query:    "tag:no_underscores",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "Tags are lowercase letters, digits and hyphens.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := testutil.NewServer(t, newTestApplication(t).routes())
+
+			rs := ts.Get(t, "/snippet/search?q="+url.QueryEscape(tt.query))
+			assert.Equal(t, rs.Status, tt.wantCode)
+			assert.StringContains(t, rs.Body, tt.wantBody)
+		})
+	}
+}
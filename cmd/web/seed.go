@@ -0,0 +1,272 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"adotkaya.playground/internal/models"
+)
+
+// =============================================================================
+// Seed Data Subcommand
+// =============================================================================
+
+// seedOptions is how much fake data to create
+type seedOptions struct {
+	Users    int    // Users to create
+	Snippets int    // Snippets to create, spread over the users
+	Follows  int    // Most users each user follows
+	Views    int    // Most views recorded per snippet
+	Password string // Password of every seeded user
+	Seed     uint64 // Seed of the random choices, so runs are repeatable
+}
+
+// seedStats counts what a seeder created
+type seedStats struct {
+	Users, Snippets, Tags, Follows, Views int
+}
+
+// seeder creates fake data through the same models the handlers use, so
+// it is stored, encrypted and cached like real data
+type seeder struct {
+	users    models.UserModelInterface
+	snippets models.SnippetModelInterface
+	follows  models.FollowModelInterface
+	rand     *rand.Rand
+	stats    seedStats
+}
+
+// Word lists the fake data is made from
+var (
+	seedFirstNames = []string{"Ada", "Alan", "Aylin", "Ben", "Can", "Clara", "Deniz", "Emil", "Emma", "Grace", "Hanna", "Jonas", "Ken", "Lea", "Linus", "Mara", "Mehmet", "Noor", "Rob", "Selin", "Tim", "Zeynep"}
+	seedLastNames  = []string{"Arslan", "Becker", "Demir", "Fischer", "Hopper", "Kaya", "Klein", "Lovelace", "Meyer", "Öztürk", "Pike", "Schmidt", "Thompson", "Turing", "Weber", "Yılmaz"}
+	seedTags       = []string{"go", "sql", "bash", "regex", "docker", "config", "haiku", "poetry", "recipes", "notes", "til", "snippets"}
+	seedAdjectives = []string{"Quick", "Tiny", "Handy", "Old", "Quiet", "Lazy", "Bright", "Simple", "Nested", "Forgotten", "Useful", "Autumn"}
+	seedNouns      = []string{"pond", "query", "loop", "script", "recipe", "note", "pattern", "morning", "helper", "config", "frog", "forest"}
+	seedWords      = []string{"the", "a", "frog", "pond", "silence", "wind", "leaves", "query", "index", "server", "splash", "morning", "mirror", "cache", "river", "moon", "deploy", "branch", "winter", "light", "slowly", "again", "under", "over"}
+	seedExpiries   = []int{1, 7, 365}
+)
+
+// seedCode are code snippets with a %s for an identifier
+var seedCode = []string{
+	"package main\n\nimport \"fmt\"\n\nfunc %s() {\n\tfmt.Println(\"hello, world\")\n}\n",
+	"SELECT id, title, created\nFROM %s\nWHERE expires > CURRENT_TIMESTAMP\nORDER BY id DESC\nLIMIT 10;\n",
+	"#!/bin/sh\nset -eu\n\nfor f in ./%s/*; do\n\techo \"$f\"\ndone\n",
+	"^(?P<%s>[a-z0-9]+)@example\\.com$\n",
+	"FROM golang:1.25\nWORKDIR /%s\nCOPY . .\nRUN go build ./...\n",
+}
+
+// newSeeder returns a seeder making the random choices given by seed
+func newSeeder(users models.UserModelInterface, snippets models.SnippetModelInterface, follows models.FollowModelInterface, seed uint64) *seeder {
+	return &seeder{
+		users:    users,
+		snippets: snippets,
+		follows:  follows,
+		rand:     rand.New(rand.NewPCG(seed, seed)),
+	}
+}
+
+// seed creates the users, then their snippets, then follows and views
+func (s *seeder) seed(opts seedOptions) error {
+	ids := make([]int, 0, opts.Users)
+	for i := range opts.Users {
+		id, err := s.user(i, opts.Password)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return errors.New("no users to own the snippets")
+	}
+
+	snippetIDs := make([]int, 0, opts.Snippets)
+	for range opts.Snippets {
+		id, err := s.snippet(ids)
+		if err != nil {
+			return err
+		}
+		snippetIDs = append(snippetIDs, id)
+	}
+
+	for _, follower := range ids {
+		n := s.rand.IntN(opts.Follows + 1)
+		for _, i := range s.rand.Perm(len(ids)) {
+			if n == 0 {
+				break
+			}
+			if ids[i] == follower {
+				continue
+			}
+			if _, err := s.follows.Follow(follower, ids[i]); err != nil {
+				return err
+			}
+			s.stats.Follows++
+			n--
+		}
+	}
+
+	return s.views(snippetIDs, opts.Views)
+}
+
+// user creates the i'th user, or returns their ID if an earlier run did
+func (s *seeder) user(i int, password string) (int, error) {
+	first := seedFirstNames[s.rand.IntN(len(seedFirstNames))]
+	last := seedLastNames[s.rand.IntN(len(seedLastNames))]
+	email := fmt.Sprintf("seed%d@example.com", i+1)
+
+	err := s.users.Insert(first+" "+last, email, password)
+	if err != nil && !errors.Is(err, models.ErrDuplicateEmail) {
+		return 0, err
+	}
+	if err == nil {
+		s.stats.Users++
+	}
+
+	accounts, _, err := s.users.Accounts(email, 0, 1)
+	if err != nil {
+		return 0, err
+	}
+	if len(accounts) == 0 {
+		return 0, fmt.Errorf("seeded user %s not found", email)
+	}
+	return accounts[0].ID, nil
+}
+
+// snippet creates a snippet by one of the users, or now and then by an
+// anonymous visitor, with some tags
+func (s *seeder) snippet(userIDs []int) (int, error) {
+	userID := userIDs[s.rand.IntN(len(userIDs))]
+	var ip netip.Addr
+	if s.rand.IntN(10) == 0 {
+		userID = 0
+		ip = netip.AddrFrom4([4]byte{192, 0, 2, byte(1 + s.rand.IntN(254))})
+	}
+	private := userID != 0 && s.rand.IntN(10) == 0
+
+	title := seedAdjectives[s.rand.IntN(len(seedAdjectives))] + " " + seedNouns[s.rand.IntN(len(seedNouns))]
+	expires := seedExpiries[s.rand.IntN(len(seedExpiries))]
+
+	// No limits, so the configured quotas don't cut seeding short
+	id, err := s.snippets.Insert(userID, ip, title, s.content(), expires, private, models.SnippetLimits{})
+	if err != nil {
+		return 0, err
+	}
+	s.stats.Snippets++
+
+	tags := []string{}
+	for range s.rand.IntN(maxTags + 1) {
+		tag := seedTags[s.rand.IntN(len(seedTags))]
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) > 0 {
+		if err = s.snippets.SetTags(id, tags); err != nil {
+			return 0, err
+		}
+		s.stats.Tags += len(tags)
+	}
+
+	return id, nil
+}
+
+// content returns either a code snippet or a few lines of verse
+func (s *seeder) content() string {
+	if s.rand.IntN(2) == 0 {
+		code := seedCode[s.rand.IntN(len(seedCode))]
+		return fmt.Sprintf(code, strings.ToLower(seedNouns[s.rand.IntN(len(seedNouns))]))
+	}
+
+	lines := make([]string, 3+s.rand.IntN(4))
+	for i := range lines {
+		words := make([]string, 3+s.rand.IntN(5))
+		for j := range words {
+			words[j] = seedWords[s.rand.IntN(len(seedWords))]
+		}
+		lines[i] = strings.Join(words, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// views records up to max views of each snippet in ids
+func (s *seeder) views(ids []int, max int) error {
+	for _, id := range ids {
+		for range s.rand.IntN(max + 1) {
+			if err := s.snippets.RecordView(id); err != nil {
+				return err
+			}
+			s.stats.Views++
+		}
+	}
+	return nil
+}
+
+// runSeed implements `web seed`: it fills the database configured in the
+// environment with fake users, snippets, tags, follows and views for
+// development and load testing. It refuses to run in production. It
+// returns the process exit code.
+func runSeed(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	fs.SetOutput(out)
+	var opts seedOptions
+	fs.IntVar(&opts.Users, "users", 20, "Number of users (each password takes about a quarter of a second to hash)")
+	fs.IntVar(&opts.Snippets, "snippets", 200, "Number of snippets")
+	fs.IntVar(&opts.Follows, "follows", 5, "Most users each user follows")
+	fs.IntVar(&opts.Views, "views", 10, "Most views per snippet")
+	fs.StringVar(&opts.Password, "password", "pa$$word", "Password of every seeded user")
+	fs.Uint64Var(&opts.Seed, "seed", 1, "Seed for the random data; the same seed gives the same data")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if opts.Users < 1 || opts.Snippets < 0 || opts.Follows < 0 || opts.Views < 0 {
+		fmt.Fprintln(out, "seed: need at least one user, and no negative counts")
+		return 2
+	}
+
+	cfg, pool, err := commandDB(true)
+	if err != nil {
+		fmt.Fprintln(out, "seed:", err)
+		return 1
+	}
+	defer pool.Close()
+
+	if cfg.Server.IsProduction() {
+		fmt.Fprintln(out, "seed: refusing to add fake data in production")
+		return 1
+	}
+
+	var keys *models.ContentKeys
+	if len(cfg.Content.Keys) > 0 {
+		if keys, err = models.NewContentKeys(cfg.Content.Keys); err != nil {
+			fmt.Fprintln(out, "seed:", err)
+			return 1
+		}
+	}
+
+	s := newSeeder(
+		&models.UserModel{DB: pool, Passwords: cfg.Passwords.hasher()},
+		&models.SnippetModel{DB: pool, Keys: keys},
+		&models.FollowModel{DB: pool, Keys: keys},
+		opts.Seed,
+	)
+
+	start := time.Now()
+	if err = s.seed(opts); err != nil {
+		fmt.Fprintln(out, "seed:", err)
+		return 1
+	}
+
+	st := s.stats
+	fmt.Fprintf(out, "Seeded %d users, %d snippets, %d tags, %d follows and %d views in %s\n",
+		st.Users, st.Snippets, st.Tags, st.Follows, st.Views, time.Since(start).Round(time.Millisecond))
+	fmt.Fprintf(out, "Log in as seed1@example.com to seed%d@example.com with the password %q\n", opts.Users, opts.Password)
+	return 0
+}
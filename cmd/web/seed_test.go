@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"net/netip"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/models/mocks"
+)
+
+// seedUsers keeps the users it is asked to insert
+type seedUsers struct {
+	mocks.UserModel
+	ids map[string]int
+}
+
+func (m *seedUsers) Insert(name, email, password string) error {
+	if _, ok := m.ids[email]; ok {
+		return models.ErrDuplicateEmail
+	}
+	m.ids[email] = len(m.ids) + 1
+	return nil
+}
+func (m *seedUsers) Accounts(email string, offset, limit int) ([]*models.User, int, error) {
+	id, ok := m.ids[email]
+	if !ok {
+		return []*models.User{}, 0, nil
+	}
+	return []*models.User{{ID: id, Email: email}}, 1, nil
+}
+
+// seedSnippets keeps the snippets, tags and views it is asked to store
+type seedSnippets struct {
+	mocks.SnippetModel
+	snippets []seedSnippet
+	views    int
+}
+
+type seedSnippet struct {
+	userID  int
+	ip      netip.Addr
+	title   string
+	private bool
+	tags    []string
+}
+
+func (m *seedSnippets) Insert(userID int, creatorIP netip.Addr, title, content string, expires int, private bool, limits models.SnippetLimits) (int, error) {
+	m.snippets = append(m.snippets, seedSnippet{userID: userID, ip: creatorIP, title: title, private: private})
+	return len(m.snippets), nil
+}
+func (m *seedSnippets) SetTags(id int, tags []string) error {
+	m.snippets[id-1].tags = tags
+	return nil
+}
+func (m *seedSnippets) RecordView(id int) error {
+	m.views++
+	return nil
+}
+
+// seedFollows keeps the follows it is asked to make
+type seedFollows struct {
+	mocks.FollowModel
+	follows map[[2]int]bool
+}
+
+func (m *seedFollows) Follow(followerID, followedID int) (bool, error) {
+	m.follows[[2]int{followerID, followedID}] = true
+	return true, nil
+}
+
+func TestSeeder(t *testing.T) {
+	opts := seedOptions{Users: 5, Snippets: 40, Follows: 3, Views: 4, Password: "pa$$word", Seed: 7}
+	users := &seedUsers{ids: map[string]int{}}
+	snippets := &seedSnippets{}
+	follows := &seedFollows{follows: map[[2]int]bool{}}
+
+	s := newSeeder(users, snippets, follows, opts.Seed)
+	assert.NilError(t, s.seed(opts))
+
+	assert.Equal(t, s.stats.Users, 5)
+	assert.Equal(t, len(users.ids), 5)
+	assert.Equal(t, len(snippets.snippets), 40)
+	assert.Equal(t, s.stats.Views, snippets.views)
+
+	// Each follow is made once, never of oneself
+	assert.Equal(t, len(follows.follows), s.stats.Follows)
+	for f := range follows.follows {
+		if f[0] == f[1] {
+			t.Errorf("user %d follows themselves", f[0])
+		}
+	}
+
+	tags := 0
+	for _, sn := range snippets.snippets {
+		if sn.userID == 0 && !sn.ip.IsValid() {
+			t.Errorf("snippet %q has neither an owner nor an address", sn.title)
+		}
+		if sn.userID == 0 && sn.private {
+			t.Errorf("anonymous snippet %q is private", sn.title)
+		}
+		if len(sn.tags) > maxTags || !validTags(sn.tags) {
+			t.Errorf("snippet %q has invalid tags %v", sn.title, sn.tags)
+		}
+		tags += len(sn.tags)
+	}
+	assert.Equal(t, s.stats.Tags, tags)
+
+	// Running again with the same seed reuses the users and repeats the
+	// snippets
+	again := &seedSnippets{}
+	s = newSeeder(users, again, follows, opts.Seed)
+	assert.NilError(t, s.seed(opts))
+	assert.Equal(t, s.stats.Users, 0)
+	assert.Equal(t, len(users.ids), 5)
+	assert.Equal(t, len(again.snippets), len(snippets.snippets))
+	for i := range again.snippets {
+		assert.Equal(t, again.snippets[i].title, snippets.snippets[i].title)
+	}
+}
+
+func TestRunSeedFlags(t *testing.T) {
+	for _, args := range [][]string{{"-users", "0"}, {"-snippets", "-1"}, {"-views", "many"}} {
+		var out bytes.Buffer
+		assert.Equal(t, runSeed(args, &out), 2)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"adotkaya.playground/internal/mailer"
+	"adotkaya.playground/internal/models"
+)
+
+// =============================================================================
+// Startup Self-Check
+// =============================================================================
+// Before the server starts listening it checks what it needs to serve
+// requests: the database schema, the page and email templates, the TLS
+// certificate and, when configured, the SMTP server. Every check runs, so
+// all the problems are reported at once, and the server doesn't start
+// unless they all pass. SELF_CHECK=false skips them.
+
+const (
+	tlsCertFile = "./tls/cert.pem"
+	tlsKeyFile  = "./tls/key.pem"
+
+	// certExpiryWarning is how close to expiring the certificate may get
+	// before startup warns about it
+	certExpiryWarning = 14 * 24 * time.Hour
+)
+
+// selfCheck is one check run at startup. Its error says what is wrong;
+// hint says what to do about it.
+type selfCheck struct {
+	name  string
+	hint  string
+	check func(ctx context.Context) error
+}
+
+// startupChecks returns the checks for the server's configuration
+func startupChecks(schema models.SchemaModelInterface, smtp *mailer.SMTPMailer, logger *slog.Logger) []selfCheck {
+	checks := []selfCheck{
+		{
+			name: "database schema",
+			hint: "run the server with DB_AUTO_MIGRATE=true, or apply the files in migrations/ by hand",
+			check: func(ctx context.Context) error {
+				missing, err := schema.Missing(ctx)
+				if err != nil {
+					return err
+				}
+				if len(missing) > 0 {
+					return fmt.Errorf("missing %s", strings.Join(missing, ", "))
+				}
+				return nil
+			},
+		},
+		{
+			name:  "page templates",
+			hint:  "fix the template named in the error under ui/html",
+			check: func(ctx context.Context) error { _, err := newTemplateCache(); return err },
+		},
+		{
+			name:  "email templates",
+			hint:  "fix the template named in the error under ui/email",
+			check: func(ctx context.Context) error { return mailer.CheckTemplates() },
+		},
+		{
+			name: "TLS certificate",
+			hint: fmt.Sprintf("put a PEM certificate and its key in %s and %s; for development, generate them with go run $(go env GOROOT)/src/crypto/tls/generate_cert.go --host=localhost", tlsCertFile, tlsKeyFile),
+			check: func(ctx context.Context) error {
+				expires, err := loadCertificate(tlsCertFile, tlsKeyFile, time.Now())
+				if err == nil && time.Until(expires) < certExpiryWarning {
+					logger.Warn("The TLS certificate expires soon", "expires", expires.Format(time.DateOnly))
+				}
+				return err
+			},
+		},
+	}
+	if smtp != nil {
+		checks = append(checks, selfCheck{
+			name:  "SMTP server",
+			hint:  "check SMTP_HOST, SMTP_PORT, SMTP_TLS and the credentials, and that the server can be reached from here",
+			check: func(ctx context.Context) error { return smtp.Check() },
+		})
+	}
+	return checks
+}
+
+// runSelfChecks runs every check, logging those that fail with what to do
+// about them, and returns an error if any did
+func runSelfChecks(ctx context.Context, checks []selfCheck, logger *slog.Logger) error {
+	failed := []string{}
+	for _, c := range checks {
+		if err := c.check(ctx); err != nil {
+			logger.Error("Startup check failed", "check", c.name, "error", err, "hint", c.hint)
+			failed = append(failed, c.name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("startup checks failed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// loadCertificate loads the server's certificate and key, checking they
+// match and the certificate hasn't expired by now. It returns the
+// certificate's expiry.
+func loadCertificate(certFile, keyFile string, now time.Time) (time.Time, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(pair.Certificate) == 0 {
+		return time.Time{}, errors.New("no certificate found")
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return time.Time{}, err
+	}
+	if now.After(cert.NotAfter) {
+		return cert.NotAfter, fmt.Errorf("certificate expired on %s", cert.NotAfter.Format(time.DateOnly))
+	}
+	return cert.NotAfter, nil
+}
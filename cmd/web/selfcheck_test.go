@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"adotkaya.playground/internal/assert"
+)
+
+// missingSchema reports a missing constraint
+type missingSchema struct{}
+
+func (missingSchema) Missing(ctx context.Context) ([]string, error) {
+	return []string{`constraint "users_uc_email"`}, nil
+}
+
+func TestRunSelfChecks(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	checks := []selfCheck{
+		{name: "fine", hint: "nothing", check: func(ctx context.Context) error { return nil }},
+		{name: "broken", hint: "fix it", check: func(ctx context.Context) error { return errors.New("it broke") }},
+		{name: "also broken", hint: "fix that too", check: func(ctx context.Context) error { return errors.New("so did this") }},
+	}
+	err := runSelfChecks(context.Background(), checks, logger)
+	assert.Equal(t, err.Error(), "startup checks failed: broken, also broken")
+	assert.StringContains(t, buf.String(), `msg="Startup check failed" check=broken error="it broke" hint="fix it"`)
+	assert.StringContains(t, buf.String(), `msg="Startup check failed" check="also broken" error="so did this" hint="fix that too"`)
+	assert.Equal(t, strings.Count(buf.String(), "\n"), 2)
+
+	// The schema, template and TLS checks, without SMTP; there are no TLS
+	// files where the tests run
+	buf.Reset()
+	checks = startupChecks(missingSchema{}, nil, logger)
+	assert.Equal(t, len(checks), 4)
+	err = runSelfChecks(context.Background(), checks, logger)
+	assert.Equal(t, err.Error(), "startup checks failed: database schema, TLS certificate")
+	assert.StringContains(t, buf.String(), `check="database schema" error="missing constraint \"users_uc_email\"" hint="run the server with DB_AUTO_MIGRATE=true`)
+}
+
+func TestLoadCertificate(t *testing.T) {
+	dir := t.TempDir()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NilError(t, err)
+	expires := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: time.Now().Add(-time.Hour), NotAfter: expires}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NilError(t, err)
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	assert.NilError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	assert.NilError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0o600))
+
+	got, err := loadCertificate(certFile, keyFile, time.Now())
+	assert.NilError(t, err)
+	assert.Equal(t, got.Equal(expires), true)
+
+	_, err = loadCertificate(certFile, keyFile, expires.Add(time.Hour))
+	assert.StringContains(t, err.Error(), "certificate expired on")
+
+	_, err = loadCertificate(filepath.Join(dir, "missing.pem"), keyFile, time.Now())
+	assert.NotNil(t, err)
+}
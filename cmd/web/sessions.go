@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+)
+
+// =============================================================================
+// Session Settings
+// =============================================================================
+
+// configureSessions applies the configured lifetimes and cookie to sm. The
+// cookie is always Secure and HttpOnly, as the site is only served over
+// HTTPS and scripts never need it.
+func configureSessions(sm *scs.SessionManager, cfg SessionConfig) {
+	sm.Lifetime = cfg.Lifetime
+	sm.IdleTimeout = cfg.IdleTimeout
+	sm.Cookie.Name = cfg.CookieName
+	sm.Cookie.Domain = cfg.CookieDomain
+	sm.Cookie.SameSite = cfg.SameSite
+	sm.Cookie.Secure = true
+	sm.Cookie.HttpOnly = true
+}
+
+// =============================================================================
+// Session Read Cache
+// =============================================================================
+
+// maxCachedSessions bounds the memory held by the session read cache
+const maxCachedSessions = 10000
+
+// cachedSession is one session store lookup result
+type cachedSession struct {
+	data    []byte
+	found   bool
+	fetched time.Time
+}
+
+// cachedSessionStore wraps a session store with a short-lived in-memory
+// cache of lookups, so a burst of requests from one visitor costs a single
+// database round trip. Writes go straight through and update the cache.
+//
+// Sessions changed or deleted on another instance can be served stale from
+// here for up to ttl, including a logout elsewhere, so keep ttl short.
+type cachedSessionStore struct {
+	store scs.Store
+	ttl   time.Duration
+	now   func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]cachedSession
+}
+
+// newCachedSessionStore returns store with lookups cached for ttl
+func newCachedSessionStore(store scs.Store, ttl time.Duration) *cachedSessionStore {
+	return &cachedSessionStore{
+		store:    store,
+		ttl:      ttl,
+		now:      time.Now,
+		sessions: make(map[string]cachedSession),
+	}
+}
+
+// Find returns the session for token, from the cache if it was looked up
+// or written within the TTL
+func (s *cachedSessionStore) Find(token string) ([]byte, bool, error) {
+	s.mu.Lock()
+	cached, ok := s.sessions[token]
+	s.mu.Unlock()
+
+	if ok && s.now().Sub(cached.fetched) < s.ttl {
+		return cached.data, cached.found, nil
+	}
+
+	data, found, err := s.store.Find(token)
+	if err != nil {
+		return nil, false, err
+	}
+
+	s.remember(token, data, found)
+	return data, found, nil
+}
+
+// Commit saves the session in the wrapped store and the cache
+func (s *cachedSessionStore) Commit(token string, b []byte, expiry time.Time) error {
+	if err := s.store.Commit(token, b, expiry); err != nil {
+		s.forget(token)
+		return err
+	}
+
+	s.remember(token, b, true)
+	return nil
+}
+
+// Delete removes the session from the wrapped store and the cache
+func (s *cachedSessionStore) Delete(token string) error {
+	s.forget(token)
+	return s.store.Delete(token)
+}
+
+// remember caches a lookup result, first dropping expired entries if the
+// cache is full
+func (s *cachedSessionStore) remember(token string, data []byte, found bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if len(s.sessions) >= maxCachedSessions {
+		for t, cached := range s.sessions {
+			if now.Sub(cached.fetched) >= s.ttl {
+				delete(s.sessions, t)
+			}
+		}
+		if len(s.sessions) >= maxCachedSessions {
+			return
+		}
+	}
+
+	s.sessions[token] = cachedSession{data: data, found: found, fetched: now}
+}
+
+// forget drops a token from the cache
+func (s *cachedSessionStore) forget(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, token)
+}
+
+// =============================================================================
+// Session Values
+// =============================================================================
+// Values are stored under typed keys, so each is always read back as the
+// type it was written with. Sessions also record the version of the layout
+// their values were written in. Changing what a key holds, renaming it or
+// dropping it means bumping sessionVersion and appending a migration that
+// rewrites sessions from the previous version. Older sessions are migrated
+// as they are loaded, so a deploy doesn't log anyone out or trip over
+// values it no longer understands.
+
+// sessionKey is the key of a session value of type T
+type sessionKey[T any] string
+
+// Session keys, with the type of value each holds
+const (
+	userIDKey       sessionKey[int]    = "authenticatedUserID"
+	localeKey       sessionKey[string] = "locale"
+	themeKey        sessionKey[string] = "theme"
+	pendingLoginKey sessionKey[int64]  = "pendingLoginID" // Login awaiting confirmation
+
+	// The user's CredentialVersion when they logged in, absent (0) for
+	// sessions older than it
+	credentialVersionKey sessionKey[int] = "credentialVersion"
+)
+
+// sessionVersionKey holds the layout version of a session's values
+const sessionVersionKey sessionKey[int] = "version"
+
+// sessionMigration rewrites a session's values from one layout version to
+// the next
+type sessionMigration func(ctx context.Context, sm *scs.SessionManager) error
+
+// sessionMigrations upgrade sessions a version at a time: the migration at
+// index i takes a session from version i to i+1. Version 0 is sessions
+// written before they were versioned.
+var sessionMigrations = []sessionMigration{
+	// Unversioned sessions already use the version 1 layout
+	func(ctx context.Context, sm *scs.SessionManager) error { return nil },
+	// Version 2 queues flash messages in a list
+	migrateFlash,
+}
+
+// sessionVersion is the layout version of sessions written by this build
+var sessionVersion = len(sessionMigrations)
+
+// Get returns the key's value, or the zero value if it isn't set
+func (k sessionKey[T]) Get(sm *scs.SessionManager, ctx context.Context) T {
+	v, _ := sm.Get(ctx, string(k)).(T)
+	return v
+}
+
+// Pop returns the key's value, like Get, and removes it
+func (k sessionKey[T]) Pop(sm *scs.SessionManager, ctx context.Context) T {
+	v, _ := sm.Pop(ctx, string(k)).(T)
+	return v
+}
+
+// Put sets the key's value. A session's first value also records the
+// layout version.
+func (k sessionKey[T]) Put(sm *scs.SessionManager, ctx context.Context, v T) {
+	if !sm.Exists(ctx, string(sessionVersionKey)) {
+		sm.Put(ctx, string(sessionVersionKey), sessionVersion)
+	}
+	sm.Put(ctx, string(k), v)
+}
+
+// Remove deletes the key's value
+func (k sessionKey[T]) Remove(sm *scs.SessionManager, ctx context.Context) {
+	sm.Remove(ctx, string(k))
+}
+
+// Exists reports whether the key has a value
+func (k sessionKey[T]) Exists(sm *scs.SessionManager, ctx context.Context) bool {
+	return sm.Exists(ctx, string(k))
+}
+
+// loadSession loads and saves the session around next, like LoadAndSave,
+// migrating sessions written in an older layout first. A session whose
+// migration fails is destroyed, which logs the user out, rather than left
+// half migrated. Sessions from a newer build, seen while a deploy rolls
+// out, are left alone.
+func (app *application) loadSession(next http.Handler) http.Handler {
+	return app.sessionManager.LoadAndSave(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := migrateSession(r.Context(), app.sessionManager, sessionMigrations)
+		if err != nil {
+			app.logger.ErrorContext(r.Context(), "session migration", "error", err)
+			if err := app.sessionManager.Destroy(r.Context()); err != nil {
+				app.serverError(w, err)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// migrateSession runs the migrations the loaded session in ctx needs to
+// reach the latest version. Empty sessions are left empty, so visitors
+// without one still don't get one.
+func migrateSession(ctx context.Context, sm *scs.SessionManager, migrations []sessionMigration) error {
+	if len(sm.Keys(ctx)) == 0 {
+		return nil
+	}
+
+	version := sessionVersionKey.Get(sm, ctx)
+	if version >= len(migrations) {
+		return nil
+	}
+	for ; version < len(migrations); version++ {
+		if err := migrations[version](ctx, sm); err != nil {
+			return fmt.Errorf("version %d: %w", version, err)
+		}
+	}
+	sm.Put(ctx, string(sessionVersionKey), version)
+	return nil
+}
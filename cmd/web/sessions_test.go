@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+	"github.com/alexedwards/scs/v2"
+	"github.com/alexedwards/scs/v2/memstore"
+)
+
+// countingStore is a session store counting lookups
+type countingStore struct {
+	scs.Store
+	finds atomic.Int64
+}
+
+func (s *countingStore) Find(token string) ([]byte, bool, error) {
+	s.finds.Add(1)
+	return s.Store.Find(token)
+}
+
+func TestSessionStoreLookups(t *testing.T) {
+	app := newTestApplication(t)
+	store := &countingStore{Store: memstore.New()}
+	app.sessionManager.Store = store
+	ts := testutil.NewServer(t, app.routes())
+
+	// No session cookie, no lookups, even after switching language and
+	// theme anonymously
+	ts.Get(t, "/")
+	rs := ts.Submit(t, "/", "/user/locale", url.Values{"locale": {"de"}})
+	assert.Equal(t, rs.Status, http.StatusSeeOther)
+	rs = ts.Submit(t, "/", "/user/theme", url.Values{"theme": {"dark"}})
+	assert.Equal(t, rs.Status, http.StatusSeeOther)
+	assert.StringContains(t, ts.Get(t, "/").Body, `<html lang="de" data-theme="dark">`)
+	assert.Equal(t, store.finds.Load(), int64(0))
+
+	// Once logged in, every request looks the session up
+	ts.Login(t, "alice@example.com", "pa$$word")
+	before := store.finds.Load()
+	ts.Get(t, "/")
+	ts.Get(t, "/")
+	assert.Equal(t, store.finds.Load()-before, int64(2))
+}
+
+func TestCachedSessionStore(t *testing.T) {
+	inner := &countingStore{Store: memstore.New()}
+	store := newCachedSessionStore(inner, time.Minute)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	expiry := now.Add(time.Hour)
+	assert.NilError(t, store.Commit("alice", []byte("data"), expiry))
+
+	// Served from the commit without a lookup
+	b, found, err := store.Find("alice")
+	assert.NilError(t, err)
+	assert.Equal(t, found, true)
+	assert.Equal(t, string(b), "data")
+	assert.Equal(t, inner.finds.Load(), int64(0))
+
+	// Unknown tokens are cached too
+	for range 2 {
+		_, found, err = store.Find("mallory")
+		assert.NilError(t, err)
+		assert.Equal(t, found, false)
+	}
+	assert.Equal(t, inner.finds.Load(), int64(1))
+
+	// Looked up again after the TTL
+	now = now.Add(2 * time.Minute)
+	_, found, err = store.Find("alice")
+	assert.NilError(t, err)
+	assert.Equal(t, found, true)
+	assert.Equal(t, inner.finds.Load(), int64(2))
+
+	// Deleted sessions are gone straight away
+	assert.NilError(t, store.Delete("alice"))
+	_, found, err = store.Find("alice")
+	assert.NilError(t, err)
+	assert.Equal(t, found, false)
+}
+
+func TestConfigureSessions(t *testing.T) {
+	sm := scs.New()
+	sm.Store = memstore.New()
+	configureSessions(sm, SessionConfig{
+		Lifetime:     12 * time.Hour,
+		IdleTimeout:  30 * time.Minute,
+		CookieName:   "sb_session",
+		CookieDomain: "snippetbox.example.com",
+		SameSite:     http.SameSiteStrictMode,
+	})
+
+	h := sm.LoadAndSave(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sm.Put(r.Context(), "authenticatedUserID", 1)
+	}))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	cookies := rr.Result().Cookies()
+	assert.Equal(t, len(cookies), 1)
+	c := cookies[0]
+	assert.Equal(t, c.Name, "sb_session")
+	assert.Equal(t, c.Domain, "snippetbox.example.com")
+	assert.Equal(t, c.SameSite, http.SameSiteStrictMode)
+	assert.Equal(t, c.Secure, true)
+	assert.Equal(t, c.HttpOnly, true)
+
+	// An idle session ends well before its lifetime is up
+	if until := time.Until(c.Expires); until > 31*time.Minute {
+		t.Errorf("cookie expires in %s; want the idle timeout", until)
+	}
+}
+
+func TestSessionCookieSettings(t *testing.T) {
+	for _, tt := range []struct {
+		mode string
+		want http.SameSite
+		ok   bool
+	}{
+		{"lax", http.SameSiteLaxMode, true},
+		{"Strict", http.SameSiteStrictMode, true},
+		{"none", http.SameSiteNoneMode, true},
+		{"sometimes", 0, false},
+	} {
+		got, err := parseSameSite(tt.mode)
+		assert.Equal(t, got, tt.want)
+		assert.Equal(t, err == nil, tt.ok)
+	}
+
+	for name, want := range map[string]bool{"session": true, "__Host-session": true, "": false, "my session": false, "a=b": false, "sess;ion": false} {
+		assert.Equal(t, validCookieName(name), want)
+	}
+}
+
+func TestMigrateSession(t *testing.T) {
+	sm := scs.New()
+	sm.Store = memstore.New()
+
+	// Version 1 renamed the user ID key; version 2 dropped the theme
+	migrations := []sessionMigration{
+		func(ctx context.Context, sm *scs.SessionManager) error {
+			if id, ok := sm.Pop(ctx, "userID").(int); ok {
+				userIDKey.Put(sm, ctx, id)
+			}
+			return nil
+		},
+		func(ctx context.Context, sm *scs.SessionManager) error {
+			themeKey.Remove(sm, ctx)
+			return nil
+		},
+	}
+
+	// load returns a context holding a session with values
+	load := func(t *testing.T, values map[string]any) context.Context {
+		t.Helper()
+
+		ctx, err := sm.Load(t.Context(), "")
+		assert.NilError(t, err)
+		for k, v := range values {
+			sm.Put(ctx, k, v)
+		}
+		return ctx
+	}
+
+	t.Run("Unversioned", func(t *testing.T) {
+		ctx := load(t, map[string]any{"userID": 1, "theme": "dark"})
+		assert.NilError(t, migrateSession(ctx, sm, migrations))
+		assert.Equal(t, userIDKey.Get(sm, ctx), 1)
+		assert.Equal(t, themeKey.Exists(sm, ctx), false)
+		assert.Equal(t, sessionVersionKey.Get(sm, ctx), 2)
+	})
+
+	t.Run("Part way", func(t *testing.T) {
+		ctx := load(t, map[string]any{"version": 1, "userID": 1, "theme": "dark"})
+		assert.NilError(t, migrateSession(ctx, sm, migrations))
+		assert.Equal(t, sm.GetInt(ctx, "userID"), 1)
+		assert.Equal(t, themeKey.Exists(sm, ctx), false)
+	})
+
+	t.Run("Newer", func(t *testing.T) {
+		ctx := load(t, map[string]any{"version": 3, "theme": "dark"})
+		assert.NilError(t, migrateSession(ctx, sm, migrations))
+		assert.Equal(t, themeKey.Get(sm, ctx), "dark")
+		assert.Equal(t, sessionVersionKey.Get(sm, ctx), 3)
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		ctx := load(t, nil)
+		assert.NilError(t, migrateSession(ctx, sm, migrations))
+		assert.Equal(t, len(sm.Keys(ctx)), 0)
+	})
+
+	t.Run("Failed", func(t *testing.T) {
+		ctx := load(t, map[string]any{"version": 1, "theme": "dark"})
+		failing := append(migrations[:1:1], func(ctx context.Context, sm *scs.SessionManager) error {
+			return errors.New("boom")
+		})
+		err := migrateSession(ctx, sm, failing)
+		assert.StringContains(t, err.Error(), "version 1: boom")
+	})
+
+	t.Run("New sessions", func(t *testing.T) {
+		ctx := load(t, nil)
+		localeKey.Put(sm, ctx, "de")
+		assert.Equal(t, sessionVersionKey.Get(sm, ctx), sessionVersion)
+		assert.Equal(t, localeKey.Pop(sm, ctx), "de")
+		assert.Equal(t, localeKey.Exists(sm, ctx), false)
+	})
+}
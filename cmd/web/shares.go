@@ -0,0 +1,59 @@
+package main
+
+import (
+	"crypto/hmac"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"adotkaya.playground/internal/models"
+)
+
+// =============================================================================
+// Private Snippets and Share Links
+// =============================================================================
+
+// shareDurations are the link lifetimes offered on the share page, in days
+var shareDurations = []int{1, 7, 30}
+
+// shareLink is a newly created share link shown on the share page
+type shareLink struct {
+	URL     string // Empty until a link is created
+	Expires time.Time
+}
+
+// canView reports whether the current visitor may see a snippet with the
+// given owner and privacy. Private snippets are for their owner only.
+func (app *application) canView(r *http.Request, ownerID int, private bool) bool {
+	if !private {
+		return true
+	}
+	return app.isAuthenticated(r) && userIDKey.Get(app.sessionManager, r.Context()) == ownerID
+}
+
+// shareURL returns an absolute link granting read access to a private
+// snippet until expires, without logging in. Links stop working when the
+// owner revokes them, which bumps the snippet's share generation.
+func (app *application) shareURL(s *models.Snippet, expires time.Time) string {
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	q.Set("sig", app.shareSignature(s.ID, s.Shares, expires.Unix()))
+	return app.canonicalURL(fmt.Sprintf("/snippet/shared/%d?%s", s.ID, q.Encode()))
+}
+
+// validShare reports whether a share link's expiry and signature are valid
+// for the snippet's current share generation
+func (app *application) validShare(s *models.Snippet, expires, sig string) bool {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(app.shareSignature(s.ID, s.Shares, exp)))
+}
+
+// shareSignature signs a snippet ID, share generation and expiry
+func (app *application) shareSignature(id, generation int, expires int64) string {
+	return app.sign(fmt.Sprintf("share:%d:%d:%d", id, generation, expires))
+}
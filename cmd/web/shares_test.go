@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestPrivateSnippetAccess(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		path     string
+		wantCode int
+	}{
+		{"Owner views", "alice@example.com", "/snippet/view/4", http.StatusOK},
+		{"Owner reads raw", "alice@example.com", "/snippet/raw/4", http.StatusOK},
+		{"Anonymous views", "", "/snippet/view/4", http.StatusNotFound},
+		{"Anonymous reads raw", "", "/snippet/raw/4", http.StatusNotFound},
+		{"Other user views", "admin@example.com", "/snippet/view/4", http.StatusNotFound},
+		{"Other user opens share page", "admin@example.com", "/snippet/share/4", http.StatusForbidden},
+		{"Owner opens share page", "alice@example.com", "/snippet/share/4", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := testutil.NewServer(t, newTestApplication(t).routes())
+			if tt.email != "" {
+				ts.Login(t, tt.email, "pa$$word")
+			}
+
+			rs := ts.Get(t, tt.path)
+			assert.Equal(t, rs.Status, tt.wantCode)
+		})
+	}
+}
+
+func TestSnippetShared(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+
+	snippet := &models.Snippet{ID: 4}
+	future := time.Now().Add(24 * time.Hour)
+	link := func(expires time.Time) string {
+		return strings.TrimPrefix(app.shareURL(snippet, expires), app.config.Server.BaseURL)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+	}{
+		{"Valid", link(future), http.StatusOK},
+		{"Expired", link(time.Now().Add(-time.Minute)), http.StatusNotFound},
+		{"Tampered expiry", strings.Replace(link(future), "expires=", "expires=9", 1), http.StatusNotFound},
+		{"No signature", fmt.Sprintf("/snippet/shared/4?expires=%d", future.Unix()), http.StatusNotFound},
+		{"Other snippet", strings.Replace(link(future), "/shared/4", "/shared/99", 1), http.StatusNotFound},
+		{
+			name: "Revoked",
+			path: fmt.Sprintf("/snippet/shared/4?expires=%d&sig=%s",
+				future.Unix(), url.QueryEscape(app.shareSignature(4, 1, future.Unix()))),
+			wantCode: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := ts.Get(t, tt.path)
+			assert.Equal(t, rs.Status, tt.wantCode)
+			if tt.wantCode == http.StatusOK {
+				assert.StringContains(t, rs.Body, "Today I wrote a haiku.")
+				assert.Equal(t, rs.Header.Get("X-Robots-Tag"), "noindex")
+			}
+		})
+	}
+
+	t.Run("Public snippet", func(t *testing.T) {
+		rs := ts.Get(t, "/snippet/shared/1")
+		assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/snippet/view/1")
+	})
+}
+
+func TestSnippetSharePost(t *testing.T) {
+	ts := testutil.NewServer(t, newTestApplication(t).routes())
+	ts.Login(t, "alice@example.com", "pa$$word")
+
+	t.Run("Create link", func(t *testing.T) {
+		rs := ts.Submit(t, "/snippet/share/4", "/snippet/share/4", url.Values{"days": {"7"}})
+		assert.Equal(t, rs.Status, http.StatusOK)
+		assert.StringContains(t, rs.Body, "https://snippetbox.example.com/snippet/shared/4?expires=")
+	})
+
+	t.Run("Unlisted duration", func(t *testing.T) {
+		rs := ts.Submit(t, "/snippet/share/4", "/snippet/share/4", url.Values{"days": {"365"}})
+		assert.Equal(t, rs.Status, http.StatusBadRequest)
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		rs := ts.Submit(t, "/snippet/share/4", "/snippet/share/4/revoke", url.Values{})
+		assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/snippet/share/4")
+	})
+}
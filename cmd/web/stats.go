@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"adotkaya.playground/internal/langdetect"
+	"adotkaya.playground/internal/models"
+)
+
+// =============================================================================
+// Public Statistics
+// =============================================================================
+// /about/stats shows how big the instance is and how busy it has been, with
+// the charts drawn as plain HTML bars. The aggregates scan whole tables, so
+// they are computed at most once every statsTTL.
+
+const (
+	// statsDays is the number of days the activity charts cover
+	statsDays = 30
+
+	// statsTTL is how long computed statistics are shown before they are
+	// computed again
+	statsTTL = 10 * time.Minute
+)
+
+// siteStats are the statistics shown on the page, with the bars of its
+// charts
+type siteStats struct {
+	*models.SiteStats
+	Languages     []statsBar // Snippets per language, most common first
+	SnippetsByDay []statsBar // Snippets created each day, oldest first
+	ViewsByDay    []statsBar // Snippet views each day, oldest first
+	Computed      time.Time
+}
+
+// statsBar is one bar of a chart
+type statsBar struct {
+	Label   string
+	Count   int
+	Percent int // Length relative to the chart's longest bar
+}
+
+// statsCache holds the last computed statistics
+type statsCache struct {
+	model    models.SiteStatsModelInterface
+	snippets models.SnippetModelInterface
+	now      func() time.Time
+
+	mu    sync.Mutex
+	stats *siteStats
+}
+
+// newStatsCache creates an empty cache computing statistics from model and
+// the snippet language counts
+func newStatsCache(model models.SiteStatsModelInterface, snippets models.SnippetModelInterface) *statsCache {
+	return &statsCache{model: model, snippets: snippets, now: time.Now}
+}
+
+// get returns the statistics, computing them if they are older than
+// statsTTL. Concurrent callers wait for a single computation.
+func (c *statsCache) get() (*siteStats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if c.stats != nil && now.Sub(c.stats.Computed) < statsTTL {
+		return c.stats, nil
+	}
+
+	totals, err := c.model.Get(statsDays)
+	if err != nil {
+		return nil, err
+	}
+	languages, err := c.snippets.LanguageCounts()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &siteStats{SiteStats: totals, Computed: now}
+	for _, l := range languages {
+		stats.Languages = append(stats.Languages, statsBar{Label: langdetect.Name(l.Name), Count: l.Count})
+	}
+	for _, a := range totals.Activity {
+		day := a.Day.Format(time.DateOnly)
+		stats.SnippetsByDay = append(stats.SnippetsByDay, statsBar{Label: day, Count: a.Snippets})
+		stats.ViewsByDay = append(stats.ViewsByDay, statsBar{Label: day, Count: a.Views})
+	}
+	scaleBars(stats.Languages)
+	scaleBars(stats.SnippetsByDay)
+	scaleBars(stats.ViewsByDay)
+
+	c.stats = stats
+	return stats, nil
+}
+
+// scaleBars sets each bar's length relative to the longest
+func scaleBars(bars []statsBar) {
+	longest := 0
+	for _, b := range bars {
+		longest = max(longest, b.Count)
+	}
+	if longest == 0 {
+		return
+	}
+	for i := range bars {
+		bars[i].Percent = bars[i].Count * 100 / longest
+	}
+}
+
+// aboutStats displays the public statistics page
+func (app *application) aboutStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := app.stats.get()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Stats = stats
+	data.CanonicalURL = app.canonicalURL("/about/stats")
+	data.Breadcrumbs = app.breadcrumbs(r, Crumb{Label: app.translate(r, "about_stats.title")})
+
+	app.render(w, http.StatusOK, "about_stats.tmpl", data)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/models/mocks"
+	"adotkaya.playground/internal/testutil"
+)
+
+// countingStats counts how often statistics are computed
+type countingStats struct {
+	mocks.SiteStatsModel
+	calls int
+}
+
+func (m *countingStats) Get(days int) (*models.SiteStats, error) {
+	m.calls++
+	return m.SiteStatsModel.Get(days)
+}
+
+func TestStatsCache(t *testing.T) {
+	model := &countingStats{}
+	cache := newStatsCache(model, &mocks.SnippetModel{})
+	now := time.Date(2024, 3, 17, 10, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+
+	stats, err := cache.get()
+	assert.NilError(t, err)
+	assert.Equal(t, model.calls, 1)
+	assert.Equal(t, len(stats.SnippetsByDay), statsDays)
+	assert.DeepEqual(t, stats.Languages, []statsBar{{Label: "Go", Count: 1, Percent: 100}})
+
+	// The busiest day gets the longest bar
+	last := stats.ViewsByDay[statsDays-1]
+	assert.DeepEqual(t, last, statsBar{Label: "2024-03-17", Count: 8, Percent: 100})
+	assert.Equal(t, stats.ViewsByDay[0].Percent, 0)
+
+	now = now.Add(statsTTL - time.Second)
+	_, err = cache.get()
+	assert.NilError(t, err)
+	assert.Equal(t, model.calls, 1)
+
+	now = now.Add(time.Second)
+	_, err = cache.get()
+	assert.NilError(t, err)
+	assert.Equal(t, model.calls, 2)
+}
+
+func TestAboutStats(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+
+	rs := ts.Get(t, "/about/stats")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.StringContains(t, rs.Body, "<h2>Instance Statistics</h2>")
+	assert.StringContains(t, rs.Body, "<dd>2</dd>")
+	assert.StringContains(t, rs.Body, "<dd>3</dd>")
+	assert.StringContains(t, rs.Body, `<th scope="row">Go</th>`)
+	assert.StringContains(t, rs.Body, `<span class="bar" style="width: 100%"></span> 1`)
+	assert.StringContains(t, rs.Body, "<h3>Snippet Views in the Last 30 Days</h3>")
+	assert.StringContains(t, rs.Body, `<span title="2024-03-17: 8"><span class="bar" style="height: 100%"></span></span>`)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/validator"
+)
+
+// =============================================================================
+// Tags
+// =============================================================================
+
+// maxTags is the most tags a snippet can have
+const maxTags = 5
+
+// tagRX is the form of a normalised tag: lowercase letters, digits and
+// hyphens, up to 30 characters
+var tagRX = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,29}$`)
+
+// parseTags splits a comma or space separated tags field into lowercase
+// tags without a leading '#', dropping duplicates. The result still needs
+// validating against tagRX and maxTags.
+func parseTags(field string) []string {
+	fields := strings.FieldsFunc(field, func(r rune) bool { return r == ',' || r == ' ' })
+
+	tags := []string{}
+	for _, tag := range fields {
+		tag = strings.ToLower(strings.TrimPrefix(tag, "#"))
+		if tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// validTags reports whether every tag is well formed
+func validTags(tags []string) bool {
+	for _, tag := range tags {
+		if !tagRX.MatchString(tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkTags adds a tags field error to v if there are too many tags or one
+// is malformed
+func (app *application) checkTags(r *http.Request, v *validator.Validator, tags []string) {
+	v.CheckField(len(tags) <= maxTags, "tags", app.translate(r, "validation.max_tags", maxTags))
+	v.CheckField(validTags(tags), "tags", app.translate(r, "validation.tag"))
+}
+
+// =============================================================================
+// Subscriptions
+// =============================================================================
+
+const (
+	maxSubscriptions    = 20 // Subscriptions a user can have
+	subscriptionListed  = 10 // New matches listed per subscription
+	subscriptionEmailed = 20 // New matches emailed per subscription
+
+	subscriptionsJobKind     = "subscriptions"
+	subscriptionsMaxAttempts = 3
+)
+
+// subscriptionsSchedule emails new subscription matches every morning
+var subscriptionsSchedule = daily(8)
+
+// subscriptionsJob is the payload of a subscription email job
+type subscriptionsJob struct {
+	Day string `json:"day"` // Day the job was queued, as YYYY-MM-DD
+}
+
+// subscriptionMatches is a subscription with its newest matches, for the
+// subscriptions page
+type subscriptionMatches struct {
+	*models.Subscription
+	Snippets []*models.Snippet
+}
+
+// enqueueSubscriptionEmails queues the daily subscription email job. It is
+// run by the scheduler so the work happens on the job worker.
+func (app *application) enqueueSubscriptionEmails() error {
+	day := time.Now().UTC().Format(time.DateOnly)
+	_, err := app.jobs.Enqueue(subscriptionsJobKind, subscriptionsJob{Day: day}, subscriptionsMaxAttempts)
+	return err
+}
+
+// sendSubscriptionsJob is the job handler emailing each user the snippets
+// matching their emailed subscriptions since the last email. Users get one
+// email covering all their subscriptions.
+//
+// A subscription is marked emailed once its user's email is queued, so a
+// retry only sends to users who were missed.
+func (app *application) sendSubscriptionsJob(payload []byte) error {
+	var job subscriptionsJob
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return permanent(err)
+	}
+
+	subs, err := app.subscriptions.Emailed()
+	if err != nil {
+		return err
+	}
+
+	// Subscriptions are grouped by user, so each user's run is contiguous
+	for start := 0; start < len(subs); {
+		end := start
+		for end < len(subs) && subs[end].UserID == subs[start].UserID {
+			end++
+		}
+		if err := app.emailSubscriptions(subs[start:end]); err != nil {
+			app.logger.Error("subscriptions", "user_id", subs[start].UserID, "error", err)
+		}
+		start = end
+	}
+
+	return nil
+}
+
+// emailSubscriptions emails one user their subscriptions' new matches, if
+// there are any
+func (app *application) emailSubscriptions(subs []*models.Subscription) error {
+	var sections []map[string]any
+	lastIDs := make(map[int]int, len(subs))
+
+	for _, sub := range subs {
+		snippets, err := app.subscriptions.Matches(sub, sub.EmailedID, subscriptionEmailed)
+		if err != nil {
+			return err
+		}
+		if len(snippets) == 0 {
+			continue
+		}
+		lastIDs[sub.ID] = snippets[0].ID
+
+		links := make([]map[string]any, 0, len(snippets))
+		for _, s := range snippets {
+			links = append(links, map[string]any{
+				"Title": s.Title,
+				"URL":   app.canonicalURL(fmt.Sprintf("/snippet/view/%d", s.ID)),
+			})
+		}
+		sections = append(sections, map[string]any{
+			"Kind":     sub.Kind,
+			"Query":    sub.Query,
+			"Snippets": links,
+		})
+	}
+	if len(sections) == 0 {
+		return nil
+	}
+
+	data := map[string]any{
+		"Subscriptions":    sections,
+		"SubscriptionsURL": app.canonicalURL("/subscriptions"),
+	}
+	err := app.notify(subs[0].UserID, models.NotifySubscriptions, "subscription_matches.tmpl", data)
+	if err != nil {
+		return err
+	}
+
+	for id, lastID := range lastIDs {
+		if err := app.subscriptions.MarkEmailed(id, lastID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/mailer"
+	"adotkaya.playground/internal/models/mocks"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestParseTags(t *testing.T) {
+	tests := []struct {
+		name  string
+		field string
+		want  []string
+	}{
+		{"Empty", "", []string{}},
+		{"Commas", "go,http", []string{"go", "http"}},
+		{"Spaces and hashes", " #Go  HTTP, ", []string{"go", "http"}},
+		{"Duplicates", "go, Go, #go", []string{"go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.DeepEqual(t, parseTags(tt.field), tt.want)
+		})
+	}
+}
+
+// taggingSnippets remembers the tags it was last given
+type taggingSnippets struct {
+	mocks.SnippetModel
+	tags []string
+}
+
+func (m *taggingSnippets) SetTags(id int, tags []string) error {
+	m.tags = tags
+	return nil
+}
+
+func TestSnippetCreateTags(t *testing.T) {
+	tests := []struct {
+		name     string
+		tags     string
+		wantCode int
+		wantTags []string
+		wantBody string
+	}{
+		{"Valid", "Go, #http go", http.StatusSeeOther, []string{"go", "http"}, ""},
+		{"None", "", http.StatusSeeOther, nil, ""},
+		{"Malformed", "go, c++", http.StatusUnprocessableEntity, nil, "Tags may only contain"},
+		{"Too many", "a b c d e f", http.StatusUnprocessableEntity, nil, "Use at most 5 tags"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			snippets := &taggingSnippets{}
+			app.snippets = snippets
+			ts := testutil.NewServer(t, app.routes())
+			ts.Login(t, "alice@example.com", "pa$$word")
+
+			form := url.Values{}
+			form.Add("title", "O snail")
+			form.Add("content", "O snail\nClimb Mount Fuji,\nBut slowly, slowly!")
+			form.Add("expires", "7")
+			form.Add("tags", tt.tags)
+			rs := ts.Submit(t, "/snippet/create", "/snippet/create", form)
+
+			assert.Equal(t, rs.Status, tt.wantCode)
+			assert.DeepEqual(t, snippets.tags, tt.wantTags)
+			if tt.wantBody != "" {
+				assert.StringContains(t, rs.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSubscriptionList(t *testing.T) {
+	ts := testutil.NewServer(t, newTestApplication(t).routes())
+
+	rs := ts.Get(t, "/subscriptions")
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/user/login")
+
+	ts.Login(t, "alice@example.com", "pa$$word")
+
+	rs = ts.Get(t, "/subscriptions")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.StringContains(t, rs.Body, "&ldquo;pond&rdquo;")
+	assert.StringContains(t, rs.Body, `<a href="/snippet/view/1">An old silent pond</a>`)
+	assert.StringContains(t, rs.Body, "#haiku")
+	assert.StringContains(t, rs.Body, "No new snippets yet.")
+}
+
+func TestSubscriptionCreatePost(t *testing.T) {
+	tests := []struct {
+		name      string
+		email     string
+		kind      string
+		query     string
+		wantCode  int
+		wantRedir string
+		wantBody  string
+	}{
+		{"Tag", "alice@example.com", "tag", "#Go", http.StatusSeeOther, "/subscriptions", ""},
+		{"Search", "alice@example.com", "search", "http server", http.StatusSeeOther, "/subscriptions", ""},
+		{"Malformed tag", "alice@example.com", "tag", "c++", http.StatusUnprocessableEntity, "", "Tags may only contain"},
+		{"Blank", "alice@example.com", "search", "  ", http.StatusUnprocessableEntity, "", "This field cannot be blank"},
+		{"Unknown kind", "alice@example.com", "author", "alice", http.StatusBadRequest, "", ""},
+		{"Anonymous", "", "tag", "go", http.StatusSeeOther, "/user/login", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := testutil.NewServer(t, newTestApplication(t).routes())
+			if tt.email != "" {
+				ts.Login(t, tt.email, "pa$$word")
+			}
+
+			form := url.Values{}
+			form.Add("kind", tt.kind)
+			form.Add("query", tt.query)
+			form.Add("email", "true")
+			rs := ts.Submit(t, "/user/login", "/subscriptions", form)
+
+			assert.Equal(t, rs.Status, tt.wantCode)
+			if tt.wantRedir != "" {
+				assert.Equal(t, rs.Header.Get("Location"), tt.wantRedir)
+			}
+			if tt.wantBody != "" {
+				assert.StringContains(t, rs.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSubscriptionDeletePost(t *testing.T) {
+	ts := testutil.NewServer(t, newTestApplication(t).routes())
+	ts.Login(t, "alice@example.com", "pa$$word")
+
+	rs := ts.Submit(t, "/subscriptions", "/subscriptions/1/delete", url.Values{})
+	assert.Redirect(t, rs.Status, rs.Header, http.StatusSeeOther, "/subscriptions")
+
+	rs = ts.Submit(t, "/subscriptions", "/subscriptions/9/delete", url.Values{})
+	assert.Equal(t, rs.Status, http.StatusNotFound)
+}
+
+func TestSendSubscriptionsJob(t *testing.T) {
+	app := newTestApplication(t)
+	jobs := &fakeJobs{}
+	app.jobs = jobs
+
+	assert.NilError(t, app.enqueueSubscriptionEmails())
+	assert.Equal(t, len(jobs.enqueued), 1)
+
+	payload, err := json.Marshal(jobs.enqueued[0])
+	assert.NilError(t, err)
+	jobs.enqueued = nil
+
+	err = app.sendSubscriptionsJob(payload)
+	assert.NilError(t, err)
+	assert.Equal(t, len(jobs.enqueued), 1)
+
+	job := jobs.enqueued[0].(emailJob)
+	assert.Equal(t, job.Recipient, "alice@example.com")
+
+	// Round-trip through JSON as the job queue does
+	payload, err = json.Marshal(job)
+	assert.NilError(t, err)
+	var queued emailJob
+	assert.NilError(t, json.Unmarshal(payload, &queued))
+
+	msg, err := mailer.Render(queued.Recipient, queued.Template, queued.Data)
+	assert.NilError(t, err)
+	assert.Equal(t, msg.Subject, "New snippets for your subscriptions on Snippetbox")
+	assert.StringContains(t, msg.Text, "- An old silent pond: https://snippetbox.example.com/snippet/view/1")
+	assert.StringContains(t, msg.HTML, "/unsubscribe?kind=subscriptions")
+
+	err = app.sendSubscriptionsJob([]byte("not json"))
+	assert.NotNil(t, err)
+}
@@ -1,11 +1,26 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
 	"html/template"
 	"io/fs"
+	"net/url"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+
+	"adotkaya.playground/internal/i18n"
+	"adotkaya.playground/internal/langdetect"
 	"adotkaya.playground/internal/models"
 	"adotkaya.playground/ui"
 )
@@ -16,13 +31,97 @@ import (
 
 // templateData holds dynamic data that we want to pass to HTML templates
 type templateData struct {
-	CurrentYear     int               // For copyright year in footer
-	Snippet         *models.Snippet   // Single snippet for view page
-	Snippets        []*models.Snippet // Multiple snippets for home page
-	Form            any               // Form data with validation errors
-	Flash           string            // One-time flash message
-	IsAuthenticated bool              // User authentication status
-	CSRFToken       string            // CSRF protection token
+	CurrentYear     int                      // For copyright year in footer
+	Snippet         *models.Snippet          // Single snippet for view page
+	Snippets        []*models.SnippetSummary // Summaries of the snippets in a listing
+	Form            any                      // Form data with validation errors
+	Flashes         []flashMessage           // Flash messages for this page
+	IsAuthenticated bool                     // User authentication status
+	IsAdmin         bool                     // Whether the user has the admin role
+	IsModerator     bool                     // Whether the user can work the moderation queue
+	CSRFToken       string                   // CSRF protection token
+	FormStarted     string                   // Signed time the page's form was first rendered
+	Query           string                   // Search query for the search page
+	Locale          string                   // Negotiated UI locale (e.g. "en")
+	Title           string                   // Page title (defaults to the page's "<page>.title" message)
+	Description     string                   // Meta description (defaults to the site description)
+	CanonicalURL    string                   // Absolute canonical URL, for indexable pages only
+	Breadcrumbs     []Crumb                  // Navigation trail, starting at Home
+	Theme           string                   // Colour theme ("light", "dark", or "" for the OS setting)
+	Pagination      *Paginator               // Page links for paginated listings
+	OGType          string                   // Open Graph og:type (defaults to "website")
+	StructuredData  any                      // JSON-LD object emitted in the page head
+	Deliveries      []emailDelivery          // Recent emails for the admin deliveries page
+	Backups         []backupRun              // Recent backups for the admin backups page
+	BackupDir       string                   // Where the server writes backups
+	MaintenanceRuns []*models.Job            // Recent maintenance jobs for the admin maintenance page
+	Reports         []reportView             // Reports on the admin reports page, with the result of the one run
+	Notifications   []notificationPref       // The user's notification preferences
+	Bans            []*models.IPBan          // Active IP bans for the admin bans page
+	BanDurations    []int                    // Ban lengths offered on the admin bans page, in hours
+	Queue           []*models.ModerationItem // Snippets awaiting moderation
+	Audit           []*models.AuditEntry     // Recent moderation and admin actions
+	Changes         []historyChange          // A snippet's recorded changes for the admin history page
+	Captcha         *captcha                 // CAPTCHA for anonymous visitors creating a snippet
+	CanCreate       bool                     // Whether the visitor may create snippets
+	SSO             bool                     // Whether SAML single sign-on is offered on the login page
+	CanEdit         bool                     // Whether the visitor may edit and delete the snippet shown
+	Profile         *profile                 // User shown on the profile page
+	Tiers           []string                 // Tiers an admin can move the profile's user to
+	Feed            []*models.FeedItem       // Snippets by followed users for the feed page
+	Unread          int                      // Unread in-app notifications, for the nav badge
+	Inbox           []*models.Notification   // The user's recent in-app notifications
+	Subscriptions   []subscriptionMatches    // The user's subscriptions with their new matches
+	Share           *shareLink               // Share link just created on the share page
+	ShareDurations  []int                    // Share link lifetimes offered, in days
+	APITokens       []*models.APIToken       // The user's API tokens
+	NewAPIToken     string                   // API token just created, shown once
+	Logins          []*models.LoginEvent     // The user's recent logins
+	Announcement    *models.Announcement     // Site-wide banner shown at the top of the page
+	Announcements   []*models.Announcement   // Current and scheduled banners for the admin page
+	Levels          []string                 // Announcement levels offered on the admin page
+	Plain           bool                     // Printer-friendly layout without navigation
+	LineNumbers     bool                     // Number the snippet's lines, each with an #L<n> anchor
+	Lines           *lineRange               // Snippet lines to highlight, if any
+	Browse          *browsing                // Language or tag listed on a browse page
+	Trending        bool                     // Whether the home page shows the Trending tab
+	Stats           *siteStats               // Instance statistics for the public stats page
+	GitHub          *models.GitHubToken      // The user's connected GitHub account, if any
+	Gist            *models.GistLink         // Gist the snippet shown is pushed to, for its owner
+	Attachments     []models.Attachment      // Files attached to the snippet shown
+	CanAttach       bool                     // Whether the visitor may attach files to the snippet shown
+	MaxUpload       int64                    // Largest upload accepted, in bytes
+	Avatar          *userAvatar              // The user's avatar on the avatar page
+	Page            string                   // Route pattern the page reports to the analytics beacon, if any
+	Analytics       *analyticsReport         // Page views for the admin analytics page
+	Leaving         *url.URL                 // Where the link on the /leaving page goes
+	Interstitial    bool                     // Links to other sites in markdown go through /leaving
+}
+
+// Crumb is a single breadcrumb in a navigation trail. The current page is
+// the last crumb and has no URL.
+type Crumb struct {
+	Label string
+	URL   string
+}
+
+// =============================================================================
+// Structured Data
+// =============================================================================
+
+// snippetStructuredData describes a snippet as a schema.org
+// SoftwareSourceCode object for the page's JSON-LD block
+func snippetStructuredData(s *models.Snippet, description, url string) map[string]any {
+	return map[string]any{
+		"@context":            "https://schema.org",
+		"@type":               "SoftwareSourceCode",
+		"name":                s.Title,
+		"description":         description,
+		"url":                 url,
+		"dateCreated":         s.Created.UTC().Format(time.RFC3339),
+		"expires":             s.Expires.UTC().Format(time.RFC3339),
+		"isAccessibleForFree": true,
+	}
 }
 
 // =============================================================================
@@ -30,19 +129,206 @@ type templateData struct {
 // =============================================================================
 
 // humanDate formats a time.Time object into a human-readable string
-func humanDate(t time.Time) string {
+//
+// An optional locale selects translated month names, e.g.
+// {{humanDate .Created $.Locale}}; without one English is used.
+func humanDate(t time.Time, locale ...string) string {
 	// Return empty string for zero time
 	if t.IsZero() {
 		return ""
 	}
 
 	// Convert to UTC and format as "DD MMM YYYY at HH:MM"
+	if len(locale) > 0 {
+		return i18n.FormatDate(locale[0], t)
+	}
 	return t.UTC().Format("02 Jan 2006 at 15:04")
 }
 
+// timeAgo formats a time.Time relative to now (e.g. "3 hours ago")
+func timeAgo(t time.Time) string {
+	return relativeTime(t, time.Now())
+}
+
+// relativeTime formats t relative to now, falling back to humanDate for
+// anything older than a month
+func relativeTime(t, now time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return pluralize(int(d/time.Minute), "minute", "minutes") + " ago"
+	case d < 24*time.Hour:
+		return pluralize(int(d/time.Hour), "hour", "hours") + " ago"
+	case d < 30*24*time.Hour:
+		return pluralize(int(d/(24*time.Hour)), "day", "days") + " ago"
+	default:
+		return humanDate(t)
+	}
+}
+
+// truncate shortens s to at most n runes, appending an ellipsis when any
+// characters were removed. Counting runes keeps multi-byte text intact.
+func truncate(s string, n int) string {
+	if n < 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	runes := []rune(s)
+	return strings.TrimRightFunc(string(runes[:n]), unicode.IsSpace) + "…"
+}
+
+// numberedLine is one line of a snippet shown with line numbers
+type numberedLine struct {
+	Number int
+	Text   string
+}
+
+// numberLines splits s into numbered lines. A final newline doesn't start
+// another line, and Windows line endings are dropped.
+func numberLines(s string) []numberedLine {
+	s = strings.TrimSuffix(s, "\n")
+	var lines []numberedLine
+	for i, text := range strings.Split(s, "\n") {
+		lines = append(lines, numberedLine{Number: i + 1, Text: strings.TrimSuffix(text, "\r")})
+	}
+	return lines
+}
+
+// lineRange is a range of snippet lines, numbered from 1, highlighted for a
+// link like /snippet/view/1?lines=10-20#L10
+type lineRange struct {
+	From, To int
+}
+
+// parseLineRange parses a single line ("42") or a range ("10-20"). A range
+// given backwards is turned around. It returns nil if s isn't valid.
+func parseLineRange(s string) *lineRange {
+	from, to, isRange := strings.Cut(s, "-")
+	if !isRange {
+		to = from
+	}
+
+	first, err := strconv.Atoi(from)
+	if err != nil || first < 1 {
+		return nil
+	}
+	last, err := strconv.Atoi(to)
+	if err != nil || last < 1 {
+		return nil
+	}
+
+	if last < first {
+		first, last = last, first
+	}
+	return &lineRange{From: first, To: last}
+}
+
+// Contains reports whether line n is in the range
+func (lr *lineRange) Contains(n int) bool {
+	return n >= lr.From && n <= lr.To
+}
+
+// String formats the range as it appears in the query string
+func (lr *lineRange) String() string {
+	if lr.From == lr.To {
+		return strconv.Itoa(lr.From)
+	}
+	return fmt.Sprintf("%d-%d", lr.From, lr.To)
+}
+
+// pluralize returns the count followed by the singular or plural form
+// (e.g. "1 snippet", "3 snippets")
+func pluralize(n int, singular, plural string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, singular)
+	}
+	return fmt.Sprintf("%d %s", n, plural)
+}
+
+// humanSize formats a size in bytes for display, in binary units
+// (e.g. "512 B", "1.5 KB", "10 MB")
+func humanSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	size, units := float64(n)/unit, "KB"
+	for _, u := range []string{"MB", "GB"} {
+		if size < unit {
+			break
+		}
+		size, units = size/unit, u
+	}
+	return strings.TrimSuffix(fmt.Sprintf("%.1f", size), ".0") + " " + units
+}
+
+// markdownRenderer converts markdown to HTML with GitHub-flavoured extensions,
+// marking links to other sites (see links.go)
+var markdownRenderer = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithParserOptions(parser.WithASTTransformers(externalLinksTransformer)),
+)
+
+// markdownPolicy strips anything from rendered markdown that isn't safe
+// user-generated content (scripts, event handlers, javascript: URLs, ...),
+// keeping the rel attribute of external links
+var markdownPolicy = func() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("rel").Matching(regexp.MustCompile("^" + externalRel + "$")).OnElements("a")
+	return p
+}()
+
+// markdown renders user-supplied markdown to sanitized HTML. With
+// interstitial, links to other sites go through the /leaving page.
+func markdown(s string, interstitial bool) template.HTML {
+	pc := parser.NewContext()
+	pc.Set(interstitialKey, interstitial)
+
+	var buf bytes.Buffer
+	if err := markdownRenderer.Convert([]byte(s), &buf, parser.WithContext(pc)); err != nil {
+		// Fall back to escaped plain text rather than failing the page
+		return template.HTML("<p>" + template.HTMLEscapeString(s) + "</p>")
+	}
+
+	return template.HTML(markdownPolicy.SanitizeBytes(buf.Bytes()))
+}
+
+// highlighter turns a search result headline's match markers into mark
+// elements, once the rest of it has been escaped
+var highlighter = strings.NewReplacer(models.HighlightStart, "<mark>", models.HighlightEnd, "</mark>")
+
+// highlight renders a search result headline as HTML, with the words
+// matching the search marked. Everything else in it is escaped.
+func highlight(s string) template.HTML {
+	return template.HTML(highlighter.Replace(template.HTMLEscapeString(s)))
+}
+
 // functions is a map of custom template functions
 var functions = template.FuncMap{
-	"humanDate": humanDate,
+	"humanDate":     humanDate,
+	"timeAgo":       timeAgo,
+	"truncate":      truncate,
+	"numberLines":   numberLines,
+	"pluralize":     pluralize,
+	"humanSize":     humanSize,
+	"avatarURL":     avatarPath,
+	"markdown":      markdown,
+	"highlight":     highlight,
+	"languageName":  langdetect.Name,
+	"translate":     i18n.T,
+	"locales":       i18n.Supported,
+	"reportReasons": reportReasons,
+}
+
+// reportReasons lists the reasons offered in the snippet report form
+func reportReasons() []string {
+	return models.ReportReasons
 }
 
 // =============================================================================
@@ -1,9 +1,16 @@
 package main
 
 import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/validator"
+
 	"adotkaya.playground/internal/assert"
 )
 
@@ -39,3 +46,330 @@ func TestHumanDate(t *testing.T) {
 		})
 	}
 }
+
+func TestRelativeTime(t *testing.T) {
+	now := time.Date(2024, 3, 17, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		tm   time.Time
+		want string
+	}{
+		{name: "Empty", tm: time.Time{}, want: ""},
+		{name: "Seconds", tm: now.Add(-30 * time.Second), want: "just now"},
+		{name: "One minute", tm: now.Add(-time.Minute), want: "1 minute ago"},
+		{name: "Hours", tm: now.Add(-3 * time.Hour), want: "3 hours ago"},
+		{name: "Days", tm: now.Add(-2 * 24 * time.Hour), want: "2 days ago"},
+		{name: "Old", tm: now.Add(-60 * 24 * time.Hour), want: "17 Jan 2024 at 12:00"},
+		{name: "Future", tm: now.Add(time.Hour), want: "just now"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, relativeTime(tt.tm, now), tt.want)
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		n    int
+		want string
+	}{
+		{name: "Short", s: "hello", n: 10, want: "hello"},
+		{name: "Exact", s: "hello", n: 5, want: "hello"},
+		{name: "Long", s: "hello world", n: 6, want: "hello…"},
+		{name: "Multi-byte", s: "héllo wörld", n: 8, want: "héllo wö…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, truncate(tt.s, tt.n), tt.want)
+		})
+	}
+}
+
+func TestNumberLines(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want []numberedLine
+	}{
+		{name: "Single", s: "one", want: []numberedLine{{1, "one"}}},
+		{name: "Final newline", s: "one\ntwo\n", want: []numberedLine{{1, "one"}, {2, "two"}}},
+		{name: "Blank lines", s: "one\n\nthree", want: []numberedLine{{1, "one"}, {2, ""}, {3, "three"}}},
+		{name: "Windows", s: "one\r\ntwo\r\n", want: []numberedLine{{1, "one"}, {2, "two"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.DeepEqual(t, numberLines(tt.s), tt.want)
+		})
+	}
+}
+
+func TestParseLineRange(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want *lineRange
+	}{
+		{name: "Single line", s: "42", want: &lineRange{42, 42}},
+		{name: "Range", s: "10-20", want: &lineRange{10, 20}},
+		{name: "Backwards", s: "20-10", want: &lineRange{10, 20}},
+		{name: "Blank", s: ""},
+		{name: "Zero", s: "0-5"},
+		{name: "Open-ended", s: "10-"},
+		{name: "Fragment style", s: "L10-L20"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.DeepEqual(t, parseLineRange(tt.s), tt.want)
+		})
+	}
+
+	lr := &lineRange{10, 20}
+	assert.Equal(t, lr.Contains(9), false)
+	assert.Equal(t, lr.Contains(10), true)
+	assert.Equal(t, lr.Contains(20), true)
+	assert.Equal(t, lr.Contains(21), false)
+	assert.Equal(t, lr.String(), "10-20")
+	assert.Equal(t, (&lineRange{7, 7}).String(), "7")
+}
+
+func TestPluralize(t *testing.T) {
+	assert.Equal(t, pluralize(0, "snippet", "snippets"), "0 snippets")
+	assert.Equal(t, pluralize(1, "snippet", "snippets"), "1 snippet")
+	assert.Equal(t, pluralize(2, "snippet", "snippets"), "2 snippets")
+}
+
+func TestHumanSize(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1 KB"},
+		{1536, "1.5 KB"},
+		{10 << 20, "10 MB"},
+		{3 << 30, "3 GB"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, humanSize(tt.n), tt.want)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	got := string(markdown("**bold** <script>alert(1)</script> [x](javascript:alert(1))", false))
+	assert.StringContains(t, got, "<strong>bold</strong>")
+	if strings.Contains(got, "<script>") || strings.Contains(got, "javascript:") {
+		t.Errorf("got: %q; expected unsafe markup to be removed", got)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	got := highlight("a <b>" + models.HighlightStart + "pond" + models.HighlightEnd + " & a frog")
+	assert.Equal(t, got, template.HTML("a &lt;b&gt;<mark>pond</mark> &amp; a frog"))
+}
+
+func TestTemplateSnapshots(t *testing.T) {
+	app := newTestApplication(t)
+
+	created := time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC)
+	snippet := &models.Snippet{
+		ID:      1,
+		Title:   "An old silent pond",
+		Content: "An old silent pond...\nA frog jumps into the pond,\nsplash! Silence again.",
+		Created: created,
+		Expires: created.AddDate(1, 0, 0),
+	}
+	summary := &models.SnippetSummary{
+		ID:       snippet.ID,
+		Title:    snippet.Title,
+		Excerpt:  "An old silent pond...\nA frog jumps into the pond,\nsplash! Silence again.",
+		Created:  snippet.Created,
+		Expires:  snippet.Expires,
+		Language: "go",
+	}
+
+	// newData returns deterministic template data, so the only differences
+	// between runs come from the templates themselves
+	newData := func() *templateData {
+		return &templateData{
+			CurrentYear: 2024,
+			CSRFToken:   "test-csrf-token",
+			Locale:      "en",
+		}
+	}
+
+	tests := []struct {
+		name string
+		page string
+		data func() *templateData
+	}{
+		{
+			name: "home",
+			page: "home.tmpl",
+			data: func() *templateData {
+				d := newData()
+				d.Snippets = []*models.SnippetSummary{summary}
+				d.CanonicalURL = "https://snippetbox.example.com/"
+				return d
+			},
+		},
+		{
+			name: "home_trending",
+			page: "home.tmpl",
+			data: func() *templateData {
+				d := newData()
+				d.Snippets = []*models.SnippetSummary{summary}
+				d.Trending = true
+				return d
+			},
+		},
+		{
+			name: "home_empty",
+			page: "home.tmpl",
+			data: newData,
+		},
+		{
+			name: "view",
+			page: "view.tmpl",
+			data: func() *templateData {
+				d := newData()
+				d.Snippet = snippet
+				d.Title = snippet.Title
+				d.Flashes = []flashMessage{{Message: "Snippet successfully created!"}}
+				d.IsAuthenticated = true
+				d.CanCreate = true
+				d.OGType = "article"
+				d.CanonicalURL = "https://snippetbox.example.com/snippet/view/1"
+				d.StructuredData = snippetStructuredData(snippet, "An old silent pond...", d.CanonicalURL)
+				d.Breadcrumbs = []Crumb{{Label: "Home", URL: "/"}, {Label: snippet.Title}}
+				return d
+			},
+		},
+		{
+			name: "view_print",
+			page: "view.tmpl",
+			data: func() *templateData {
+				d := newData()
+				d.Snippet = snippet
+				d.Title = snippet.Title
+				d.IsAuthenticated = true
+				d.Plain = true
+				d.LineNumbers = true
+				d.Lines = &lineRange{From: 2, To: 3}
+				return d
+			},
+		},
+		{
+			name: "view_language",
+			page: "view.tmpl",
+			data: func() *templateData {
+				d := newData()
+				d.Snippet = &models.Snippet{
+					ID:       2,
+					Title:    "Hello",
+					Content:  "package main\n\nfunc main() {}",
+					Created:  created,
+					Expires:  created.AddDate(0, 0, 7),
+					Language: "go",
+				}
+				d.Title = d.Snippet.Title
+				return d
+			},
+		},
+		{
+			name: "create_errors",
+			page: "create.tmpl",
+			data: func() *templateData {
+				d := newData()
+				d.IsAuthenticated = true
+				d.CanCreate = true
+				d.Form = SnippetCreateForm{
+					Expires: 7,
+					Validator: validator.Validator{
+						FieldErrors: map[string]string{"title": "This field cannot be blank"},
+					},
+				}
+				return d
+			},
+		},
+		{
+			name: "login_errors",
+			page: "login.tmpl",
+			data: func() *templateData {
+				d := newData()
+				d.Form = userLoginForm{
+					Email: "alice@example.com",
+					Validator: validator.Validator{
+						NonFieldErrors: []string{"Email or password is incorrect"},
+					},
+				}
+				return d
+			},
+		},
+		{
+			name: "signup",
+			page: "signup.tmpl",
+			data: func() *templateData {
+				d := newData()
+				d.Form = userSignupForm{}
+				return d
+			},
+		},
+		{
+			name: "search",
+			page: "search.tmpl",
+			data: func() *templateData {
+				d := newData()
+				d.Query = "pond"
+				result := *summary
+				result.Headline = "An old silent " + models.HighlightStart + "pond" + models.HighlightEnd + "...\nA frog jumps into the " +
+					models.HighlightStart + "pond" + models.HighlightEnd + ","
+				d.Snippets = []*models.SnippetSummary{&result}
+				r := httptest.NewRequest(http.MethodGet, "/snippet/search?q=pond&page=2", nil)
+				d.Pagination = newPaginator(r, 2, 1, 3)
+				return d
+			},
+		},
+		{
+			name: "404",
+			page: "404.tmpl",
+			data: func() *templateData {
+				d := newData()
+				d.Title = "Page Not Found"
+				d.Theme = "dark"
+				return d
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			app.render(rr, http.StatusOK, tt.page, tt.data())
+
+			assert.Equal(t, rr.Code, http.StatusOK)
+			assertGolden(t, tt.name, rr.Body.Bytes())
+		})
+	}
+}
+
+func BenchmarkRender(b *testing.B) {
+	templateCache, err := newTemplateCache()
+	if err != nil {
+		b.Fatal(err)
+	}
+	app := &application{templateCache: templateCache}
+
+	created := time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC)
+	snippets := make([]*models.SnippetSummary, 10)
+	for i := range snippets {
+		snippets[i] = &models.SnippetSummary{ID: i + 1, Title: "An old silent pond", Created: created, Expires: created}
+	}
+	data := &templateData{CurrentYear: 2024, Locale: "en", Snippets: snippets}
+
+	for b.Loop() {
+		app.render(httptest.NewRecorder(), http.StatusOK, "home.tmpl", data)
+	}
+}
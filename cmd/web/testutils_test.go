@@ -2,17 +2,15 @@ package main
 
 import (
 	"bytes"
-	"html"
-	"io"
-	"log"
-	"net/http"
-	"net/http/cookiejar"
-	"net/http/httptest"
-	"net/url"
-	"regexp"
+	"flag"
+	"log/slog"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"adotkaya.playground/internal/cookies"
+	"adotkaya.playground/internal/mailer"
 	"adotkaya.playground/internal/models/mocks"
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
@@ -32,85 +30,104 @@ func newTestApplication(t *testing.T) *application {
 	sessionManager := scs.New()
 	sessionManager.Lifetime = 12 * time.Hour
 	sessionManager.Cookie.Secure = true
-	return &application{
-		errorLog:       log.New(io.Discard, "", 0),
-		infoLog:        log.New(io.Discard, "", 0),
+
+	bans := newBanList(&mocks.BanModel{}, slog.New(slog.DiscardHandler))
+	if err := bans.refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	announcements := newAnnouncementBoard(&mocks.AnnouncementModel{}, slog.New(slog.DiscardHandler))
+	if err := announcements.refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	app := &application{
+		logger:         slog.New(slog.DiscardHandler),
+		logSettings:    newLogSettings(slog.LevelInfo, 0),
 		snippets:       &mocks.SnippetModel{}, // Use the mock.
 		users:          &mocks.UserModel{},    // Use the mock.
+		jobs:           &mocks.JobModel{},     // Use the mock.
+		moderation:     &mocks.ModerationModel{},
+		audit:          &mocks.AuditModel{},
+		changes:        &mocks.SnippetChangeModel{},
+		follows:        &mocks.FollowModel{},
+		notifications:  &mocks.NotificationModel{},
+		subscriptions:  &mocks.SubscriptionModel{},
+		backups:        &mocks.BackupModel{},
+		idempotency:    &mocks.IdempotencyModel{},
+		tokens:         &mocks.APITokenModel{},
+		logins:         &mocks.LoginEventModel{},
+		gists:          &mocks.GistModel{},
+		attachments:    &mocks.AttachmentModel{},
+		avatars:        &mocks.AvatarModel{},
+		maintenance:    &mocks.MaintenanceModel{},
+		reports:        &mocks.ReportModel{},
+		exports:        &mocks.ExportModel{},
+		outbox:         &mocks.OutboxModel{},
+		analytics:      &mocks.AnalyticsModel{},
+		avatarStore:    &fakeStore{},
 		templateCache:  templateCache,
+		bans:           bans,
+		announcements:  announcements,
+		stats:          newStatsCache(&mocks.SiteStatsModel{}, &mocks.SnippetModel{}),
 		formDecoder:    formDecoder,
 		sessionManager: sessionManager,
+		cookies:        testCookies(t),
+		mailer:         mailer.NewLogMailer(slog.New(slog.DiscardHandler)),
+		config: &Config{
+			Server: ServerConfig{
+				BaseURL:           "https://snippetbox.example.com",
+				SecretKey:         "test-secret",
+				ReferrerPolicy:    defaultReferrerPolicy,
+				PermissionsPolicy: defaultPermissionsPolicy,
+			},
+		},
 	}
+	app.quotas = newQuotaService(app.config, app.users)
+	app.events = newEventHub()
+	return app
 }
 
-// Define a custom testServer type which embeds a httptest.Server instance.
-type testServer struct {
-	*httptest.Server
-}
+// testCookies returns a cookie codec keyed with the test secret
+func testCookies(t *testing.T) *cookies.Codec {
+	t.Helper()
 
-var csrfTokenRX = regexp.MustCompile(`<input type="hidden" name="csrf_token" value="(.+)" />`)
-
-func extractCSRFToken(t *testing.T, body string) string {
-
-	matches := csrfTokenRX.FindStringSubmatch(body)
-	if len(matches) < 2 {
-		t.Fatal("no csrf token found in body")
-	}
-	return html.UnescapeString(string(matches[1]))
-}
-
-func newTestServer(t *testing.T, h http.Handler) *testServer {
-	ts := httptest.NewTLSServer(h)
-
-	jar, err := cookiejar.New(nil)
+	c, err := cookies.New("test-secret")
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	ts.Client().Jar = jar
-
-	ts.Client().CheckRedirect = func(req *http.Request, via []*http.Request) error {
-		return http.ErrUseLastResponse
-	}
-
-	return &testServer{ts}
+	return c
 }
 
-// Implement a get() method on our custom testServer type. This makes a GET
-// request to a given url path using the test server client, and returns the
-// response status code, headers and body.
-func (ts *testServer) get(t *testing.T, urlPath string) (int, http.Header,
-	string) {
-	rs, err := ts.Client().Get(ts.URL + urlPath)
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer rs.Body.Close()
-	body, err := io.ReadAll(rs.Body)
-	if err != nil {
-		t.Fatal(err)
+// update rewrites golden files with the current output instead of comparing
+// against them: go test ./cmd/web -run TestTemplateSnapshots -update
+var update = flag.Bool("update", false, "update golden files")
+
+// assertGolden compares got with testdata/golden/<name>.golden, or rewrites
+// the golden file when -update is set
+func assertGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+
+	path := filepath.Join("testdata", "golden", name+".golden")
+
+	if *update {
+		err := os.MkdirAll(filepath.Dir(path), 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, got, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
 	}
-	bytes.TrimSpace(body)
-	return rs.StatusCode, rs.Header, string(body)
-}
 
-func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (int, http.Header, string) {
-	req, err := http.NewRequest(http.MethodPost, ts.URL+urlPath, bytes.NewBufferString(form.Encode()))
+	want, err := os.ReadFile(path)
 	if err != nil {
-		t.Fatal(err)
+		t.Fatalf("%v (run with -update to create it)", err)
 	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("Referer", ts.URL+urlPath)
 
-	rs, err := ts.Client().Do(req)
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer rs.Body.Close()
-	body, err := io.ReadAll(rs.Body)
-	if err != nil {
-		t.Fatal(err)
+	if !bytes.Equal(got, want) {
+		t.Errorf("output does not match %s (run with -update to accept changes)\ngot:\n%s", path, got)
 	}
-	bytes.TrimSpace(body)
-	return rs.StatusCode, rs.Header, string(body)
 }
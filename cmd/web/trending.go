@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// =============================================================================
+// Trending Snippets
+// =============================================================================
+// The home page's Trending tab lists the snippets with the highest trending
+// scores. Scoring aggregates every recent view, so a job recomputes the
+// scores each hour and the tab only reads the results.
+
+const (
+	trendingJobKind     = "trending"
+	trendingMaxAttempts = 3
+	trendingSize        = 10 // Snippets listed on the Trending tab
+)
+
+// trendingSchedule recomputes the scores on the hour
+var trendingSchedule = every(time.Hour)
+
+// enqueueTrending queues a recomputation of the trending scores. It is run
+// by the scheduler so the work happens on the job worker.
+func (app *application) enqueueTrending() error {
+	_, err := app.jobs.Enqueue(trendingJobKind, struct{}{}, trendingMaxAttempts)
+	return err
+}
+
+// refreshTrendingJob is the job handler recomputing the trending scores.
+// The cached Trending tab is dropped on this instance; others serve theirs
+// until it goes stale.
+func (app *application) refreshTrendingJob(payload []byte) error {
+	n, err := app.snippets.RefreshTrending()
+	if err != nil {
+		return err
+	}
+
+	app.pages.purge("/trending")
+	app.logger.Info("Scored trending snippets", "count", n)
+	return nil
+}
+
+// trending displays the home page's Trending tab
+func (app *application) trending(w http.ResponseWriter, r *http.Request) {
+	snippets, err := app.snippets.Trending(r.Context(), trendingSize)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippets = snippets
+	data.Trending = true
+	data.CanonicalURL = app.canonicalURL("/trending")
+
+	app.render(w, http.StatusOK, "home.tmpl", data)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestTrending(t *testing.T) {
+	app := newTestApplication(t)
+	ts := testutil.NewServer(t, app.routes())
+
+	rs := ts.Get(t, "/trending")
+	assert.Equal(t, rs.Status, http.StatusOK)
+	assert.StringContains(t, rs.Body, `<a href="/trending" aria-current="page">Trending</a>`)
+	assert.StringContains(t, rs.Body, "<h2>Trending Snippets</h2>")
+	assert.StringContains(t, rs.Body, `<a href="/snippet/view/1">An old silent pond</a>`)
+
+	rs = ts.Get(t, "/")
+	assert.StringContains(t, rs.Body, `<a href="/" aria-current="page">Latest</a>`)
+}
+
+func TestRefreshTrendingJob(t *testing.T) {
+	app := newTestApplication(t)
+	jobs := &fakeJobs{}
+	app.jobs = jobs
+
+	err := app.enqueueTrending()
+	assert.NilError(t, err)
+	assert.Equal(t, len(jobs.enqueued), 1)
+
+	payload, err := json.Marshal(jobs.enqueued[0])
+	assert.NilError(t, err)
+	assert.NilError(t, app.refreshTrendingJob(payload))
+}
@@ -1,6 +1,9 @@
 package assert
 
 import (
+	"errors"
+	"net/http"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -37,3 +40,105 @@ func NilError(t *testing.T, actual error) {
 		t.Errorf("got: %v; expected: nil", actual)
 	}
 }
+
+// ErrorIs checks if an error matches a target error using errors.Is
+func ErrorIs(t *testing.T, actual, target error) {
+	t.Helper()
+
+	if !errors.Is(actual, target) {
+		t.Errorf("got: %v; expected error matching: %v", actual, target)
+	}
+}
+
+// ErrorAs checks if an error can be assigned to target using errors.As
+//
+// Target must be a non-nil pointer to an error type, as with errors.As
+func ErrorAs(t *testing.T, actual error, target any) {
+	t.Helper()
+
+	if !errors.As(actual, target) {
+		t.Errorf("got: %v; expected error assignable to: %T", actual, target)
+	}
+}
+
+// DeepEqual checks if two values are equal using reflect.DeepEqual
+//
+// Use this for slices, maps and structs containing them, which can't be
+// compared with Equal
+func DeepEqual(t *testing.T, actual, expected any) {
+	t.Helper()
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("got: %#v; want: %#v", actual, expected)
+	}
+}
+
+// Nil checks if a value is nil, including typed nil pointers, maps, slices,
+// channels and functions stored in an interface
+func Nil(t *testing.T, actual any) {
+	t.Helper()
+
+	if !isNil(actual) {
+		t.Errorf("got: %v; expected: nil", actual)
+	}
+}
+
+// NotNil checks if a value is not nil
+func NotNil(t *testing.T, actual any) {
+	t.Helper()
+
+	if isNil(actual) {
+		t.Errorf("got: nil; expected: non-nil value")
+	}
+}
+
+// Panics checks if a function panics when called
+func Panics(t *testing.T, fn func()) {
+	t.Helper()
+
+	defer func() {
+		t.Helper()
+
+		if recover() == nil {
+			t.Errorf("expected function to panic")
+		}
+	}()
+
+	fn()
+}
+
+// Status checks if an HTTP status code matches the expected one, naming
+// both codes in the failure message
+func Status(t *testing.T, actual, expected int) {
+	t.Helper()
+
+	if actual != expected {
+		t.Errorf("got status: %d %s; want: %d %s",
+			actual, http.StatusText(actual), expected, http.StatusText(expected))
+	}
+}
+
+// Redirect checks if a response is a redirect with the given status code
+// to the given location
+func Redirect(t *testing.T, actualStatus int, header http.Header, expectedStatus int, expectedLocation string) {
+	t.Helper()
+
+	Status(t, actualStatus, expectedStatus)
+	if location := header.Get("Location"); location != expectedLocation {
+		t.Errorf("got redirect to: %q; want: %q", location, expectedLocation)
+	}
+}
+
+// isNil reports whether v is nil or an interface holding a nil value
+func isNil(v any) bool {
+	if v == nil {
+		return true
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Chan, reflect.Func, reflect.Interface, reflect.Map, reflect.Pointer, reflect.Slice:
+		return rv.IsNil()
+	}
+	return false
+}
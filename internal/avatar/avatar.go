@@ -0,0 +1,101 @@
+// Package avatar turns uploaded pictures into square avatars of fixed
+// sizes, and draws identicons for users without one.
+package avatar
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif"  // Register the GIF decoder
+	_ "image/jpeg" // Register the JPEG decoder
+	"image/png"
+	"io"
+)
+
+// =============================================================================
+// Decoding
+// =============================================================================
+
+// Errors returned by Decode
+var (
+	// ErrFormat is returned for data that isn't a PNG, JPEG or GIF image
+	ErrFormat = errors.New("avatar: not a PNG, JPEG or GIF image")
+
+	// ErrDimensions is returned for images with too many pixels to decode
+	// safely, or none at all
+	ErrDimensions = errors.New("avatar: image dimensions out of range")
+)
+
+// Decode decodes a PNG, JPEG or GIF image of at most maxPixels pixels. The
+// dimensions are checked before the pixels are decoded, so a small file
+// claiming to be a huge image can't exhaust memory.
+func Decode(b []byte, maxPixels int) (image.Image, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil || (format != "png" && format != "jpeg" && format != "gif") {
+		return nil, ErrFormat
+	}
+	if cfg.Width < 1 || cfg.Height < 1 || cfg.Width > maxPixels/cfg.Height {
+		return nil, ErrDimensions
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, ErrFormat
+	}
+	return img, nil
+}
+
+// =============================================================================
+// Resizing
+// =============================================================================
+
+// Resize crops the middle square out of img and scales it to size pixels
+// square. Each pixel of the result averages the pixels it covers, which
+// keeps downscaled pictures smooth; upscaled ones are blocky.
+func Resize(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	crop := image.Rect(0, 0, side, side)
+
+	// Working on premultiplied RGBA pixels makes averaging simple
+	src := image.NewRGBA(crop)
+	offset := image.Pt(b.Min.X+(b.Dx()-side)/2, b.Min.Y+(b.Dy()-side)/2)
+	draw.Draw(src, crop, img, offset, draw.Src)
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := range size {
+		y0, y1 := span(y, side, size)
+		for x := range size {
+			x0, x1 := span(x, side, size)
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i, v := range row {
+					sum[i%4] += int(v)
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			i := dst.PixOffset(x, y)
+			for c := range sum {
+				dst.Pix[i+c] = uint8((sum[c] + n/2) / n)
+			}
+		}
+	}
+	return dst
+}
+
+// span returns the source pixels, from first to last exclusive, that
+// destination pixel i of size covers in a source of side pixels
+func span(i, side, size int) (int, int) {
+	first := i * side / size
+	last := max((i+1)*side/size, first+1)
+	return first, last
+}
+
+// Encode writes img as a PNG
+func Encode(w io.Writer, img image.Image) error {
+	enc := png.Encoder{CompressionLevel: png.BestCompression}
+	return enc.Encode(w, img)
+}
@@ -0,0 +1,81 @@
+package avatar
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+)
+
+// encodePNG returns img as PNG data
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	assert.NilError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestDecode(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	b := encodePNG(t, img)
+
+	got, err := Decode(b, 1200)
+	assert.NilError(t, err)
+	assert.Equal(t, got.Bounds().Dx(), 40)
+
+	// Dimensions are checked before decoding
+	_, err = Decode(b, 1199)
+	assert.ErrorIs(t, err, ErrDimensions)
+
+	_, err = Decode([]byte("<svg xmlns=\"http://www.w3.org/2000/svg\"/>"), 1200)
+	assert.ErrorIs(t, err, ErrFormat)
+}
+
+func TestResize(t *testing.T) {
+	// A wide image: black on the left, white on the right, red bands at
+	// either end which the crop cuts off
+	img := image.NewRGBA(image.Rect(0, 0, 8, 4))
+	for y := range 4 {
+		for x := range 8 {
+			c := color.RGBA{0, 0, 0, 0xff}
+			switch {
+			case x < 2 || x >= 6:
+				c = color.RGBA{0xff, 0, 0, 0xff}
+			case x >= 4:
+				c = color.RGBA{0xff, 0xff, 0xff, 0xff}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+
+	small := Resize(img, 2)
+	assert.Equal(t, small.Bounds(), image.Rect(0, 0, 2, 2))
+	assert.Equal(t, small.RGBAAt(0, 0), color.RGBA{0, 0, 0, 0xff})
+	assert.Equal(t, small.RGBAAt(1, 1), color.RGBA{0xff, 0xff, 0xff, 0xff})
+
+	// Pixels straddling both halves are averaged
+	one := Resize(img, 1)
+	assert.Equal(t, one.RGBAAt(0, 0), color.RGBA{0x80, 0x80, 0x80, 0xff})
+
+	big := Resize(img, 8)
+	assert.Equal(t, big.RGBAAt(7, 7), color.RGBA{0xff, 0xff, 0xff, 0xff})
+}
+
+func TestIdenticon(t *testing.T) {
+	a := Identicon("user:1", 60)
+	assert.Equal(t, a.Bounds(), image.Rect(0, 0, 60, 60))
+	assert.Equal(t, bytes.Equal(a.Pix, Identicon("user:1", 60).Pix), true)
+	assert.Equal(t, bytes.Equal(a.Pix, Identicon("user:2", 60).Pix), false)
+
+	// The pattern is mirrored, inside a plain margin
+	for y := range 60 {
+		for x := range 60 {
+			assert.Equal(t, a.RGBAAt(x, y), a.RGBAAt(59-x, y))
+		}
+	}
+	assert.Equal(t, a.RGBAAt(0, 0), identiconBackground)
+}
@@ -0,0 +1,75 @@
+package avatar
+
+import (
+	"crypto/sha256"
+	"image"
+	"image/color"
+)
+
+// =============================================================================
+// Identicons
+// =============================================================================
+
+// identiconGrid is the number of cells across an identicon
+const identiconGrid = 5
+
+// identiconBackground fills the cells left empty
+var identiconBackground = color.RGBA{0xf0, 0xf0, 0xf0, 0xff}
+
+// Identicon draws a size pixels square identicon for seed: a pattern of
+// cells, mirrored left to right, in one colour. The same seed always gives
+// the same picture, and different seeds almost always different ones.
+func Identicon(seed string, size int) *image.RGBA {
+	sum := sha256.Sum256([]byte(seed))
+
+	// The first bits choose the cells of the left half and middle column;
+	// the last bytes choose the colour
+	var cells [identiconGrid][identiconGrid]bool
+	bit := 0
+	for x := range (identiconGrid + 1) / 2 {
+		for y := range identiconGrid {
+			on := sum[bit/8]>>(bit%8)&1 == 1
+			cells[y][x], cells[y][identiconGrid-1-x] = on, on
+			bit++
+		}
+	}
+	fg := hueColor(int(sum[30])<<8 | int(sum[31]))
+
+	// A margin of half a cell frames the pattern
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	margin := size / (2*identiconGrid + 2)
+	inner := size - 2*margin
+	for y := range size {
+		for x := range size {
+			c := identiconBackground
+			cx, cy := (x-margin)*identiconGrid, (y-margin)*identiconGrid
+			if cx >= 0 && cy >= 0 && cx < inner*identiconGrid && cy < inner*identiconGrid && cells[cy/inner][cx/inner] {
+				c = fg
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// hueColor returns a mid-toned, fairly saturated colour of hue h, from 0 to
+// 65535 round the colour wheel
+func hueColor(h int) color.RGBA {
+	const lo, hi = 0x50, 0xc8 // Channel range, for 50% saturation
+	sector, f := h*6/65536, (h*6%65536)*(hi-lo)/65536
+	rise, fall := uint8(lo+f), uint8(hi-f)
+	switch sector {
+	case 0:
+		return color.RGBA{hi, rise, lo, 0xff}
+	case 1:
+		return color.RGBA{fall, hi, lo, 0xff}
+	case 2:
+		return color.RGBA{lo, hi, rise, 0xff}
+	case 3:
+		return color.RGBA{lo, fall, hi, 0xff}
+	case 4:
+		return color.RGBA{rise, lo, hi, 0xff}
+	default:
+		return color.RGBA{hi, lo, fall, 0xff}
+	}
+}
@@ -0,0 +1,125 @@
+// Package cookies reads and writes cookies whose values are encrypted and
+// authenticated, for state kept in the browser outside the session, such as
+// the theme or the anonymous snippets a visitor may edit. A visitor can
+// neither read nor change such a cookie's value, copy it to another cookie,
+// or keep using it after it expires.
+package cookies
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// =============================================================================
+// Codec
+// =============================================================================
+
+// maxCookieSize is the most bytes browsers are guaranteed to store for a
+// cookie, counting its name and value
+const maxCookieSize = 4096
+
+// Errors returned by Read and Write
+var (
+	// ErrNotFound is returned when the request has no cookie of that name
+	ErrNotFound = errors.New("cookies: cookie not found")
+
+	// ErrInvalid is returned for a cookie that wasn't written by a Codec
+	// with the same secret under the same name, has been tampered with or
+	// has expired
+	ErrInvalid = errors.New("cookies: invalid cookie value")
+
+	// ErrTooLong is returned when a value is too long to fit in a cookie
+	ErrTooLong = errors.New("cookies: value too long")
+)
+
+// Codec encrypts cookie values with AES-GCM. The cookie's name is
+// authenticated along with the value, so a value can't be moved to another
+// cookie, and its expiry is sealed in with it, so it stops being accepted
+// when the cookie's MaxAge runs out even if the browser keeps sending it.
+type Codec struct {
+	aead cipher.AEAD
+	now  func() time.Time
+}
+
+// New returns a Codec with a key derived from secret. Changing the secret
+// invalidates every cookie written with the old one.
+func New(secret string) (*Codec, error) {
+	key, err := hkdf.Key(sha256.New, []byte(secret), nil, "cookies", 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Codec{aead: aead, now: time.Now}, nil
+}
+
+// =============================================================================
+// Reading and Writing
+// =============================================================================
+
+// Write sets cookie on w with its Value encrypted. A positive MaxAge also
+// limits how long Read accepts the value.
+func (c *Codec) Write(w http.ResponseWriter, cookie *http.Cookie) error {
+	var expires int64
+	if cookie.MaxAge > 0 {
+		expires = c.now().Add(time.Duration(cookie.MaxAge) * time.Second).Unix()
+	}
+
+	plaintext := binary.BigEndian.AppendUint64(nil, uint64(expires))
+	plaintext = append(plaintext, cookie.Value...)
+
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(plaintext)+c.aead.Overhead())
+	rand.Read(nonce)
+	sealed := c.aead.Seal(nonce, nonce, plaintext, []byte(cookie.Name))
+
+	encrypted := *cookie
+	encrypted.Value = base64.RawURLEncoding.EncodeToString(sealed)
+	if len(encrypted.Name)+len(encrypted.Value) > maxCookieSize {
+		return ErrTooLong
+	}
+	http.SetCookie(w, &encrypted)
+	return nil
+}
+
+// Read returns the decrypted value of the named cookie
+func (c *Codec) Read(r *http.Request, name string) (string, error) {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return "", ErrNotFound
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil || len(sealed) < c.aead.NonceSize() {
+		return "", ErrInvalid
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil || len(plaintext) < 8 {
+		return "", ErrInvalid
+	}
+
+	expires := int64(binary.BigEndian.Uint64(plaintext))
+	if expires != 0 && c.now().Unix() >= expires {
+		return "", ErrInvalid
+	}
+	return string(plaintext[8:]), nil
+}
+
+// Delete tells the browser to remove the named cookie set with path
+func Delete(w http.ResponseWriter, name, path string) {
+	http.SetCookie(w, &http.Cookie{Name: name, Path: path, MaxAge: -1, HttpOnly: true, Secure: true})
+}
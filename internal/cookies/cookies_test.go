@@ -0,0 +1,103 @@
+package cookies
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"adotkaya.playground/internal/assert"
+)
+
+// newCodec returns a Codec for secret, failing the test on error
+func newCodec(t *testing.T, secret string) *Codec {
+	t.Helper()
+
+	c, err := New(secret)
+	assert.NilError(t, err)
+	return c
+}
+
+// write returns the cookie c sets for cookie
+func write(t *testing.T, c *Codec, cookie *http.Cookie) *http.Cookie {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	assert.NilError(t, c.Write(rr, cookie))
+	return rr.Result().Cookies()[0]
+}
+
+// read returns what c reads from a request carrying cookie
+func read(c *Codec, cookie *http.Cookie, name string) (string, error) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	return c.Read(r, name)
+}
+
+func TestCodec(t *testing.T) {
+	c := newCodec(t, "secret")
+	cookie := write(t, c, &http.Cookie{Name: "theme", Value: "dark", Path: "/", MaxAge: 60, HttpOnly: true})
+
+	// The value is encrypted; the attributes are kept
+	assert.Equal(t, strings.Contains(cookie.Value, "dark"), false)
+	assert.Equal(t, cookie.Path, "/")
+	assert.Equal(t, cookie.MaxAge, 60)
+	assert.Equal(t, cookie.HttpOnly, true)
+
+	value, err := read(c, cookie, "theme")
+	assert.NilError(t, err)
+	assert.Equal(t, value, "dark")
+
+	// Two writes of the same value differ
+	again := write(t, c, &http.Cookie{Name: "theme", Value: "dark", MaxAge: 60})
+	assert.Equal(t, again.Value == cookie.Value, false)
+
+	t.Run("Missing", func(t *testing.T) {
+		_, err := read(c, nil, "theme")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		b := []byte(cookie.Value)
+		b[len(b)-1] ^= 1
+		_, err := read(c, &http.Cookie{Name: "theme", Value: string(b)}, "theme")
+		assert.ErrorIs(t, err, ErrInvalid)
+
+		_, err = read(c, &http.Cookie{Name: "theme", Value: "dark"}, "theme")
+		assert.ErrorIs(t, err, ErrInvalid)
+	})
+
+	t.Run("Renamed", func(t *testing.T) {
+		_, err := read(c, &http.Cookie{Name: "lang", Value: cookie.Value}, "lang")
+		assert.ErrorIs(t, err, ErrInvalid)
+	})
+
+	t.Run("Other secret", func(t *testing.T) {
+		_, err := read(newCodec(t, "other"), cookie, "theme")
+		assert.ErrorIs(t, err, ErrInvalid)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		c := newCodec(t, "secret")
+		c.now = func() time.Time { return time.Now().Add(time.Minute) }
+		_, err := read(c, cookie, "theme")
+		assert.ErrorIs(t, err, ErrInvalid)
+	})
+
+	t.Run("Session cookie", func(t *testing.T) {
+		cookie := write(t, c, &http.Cookie{Name: "theme", Value: ""})
+		c := newCodec(t, "secret")
+		c.now = func() time.Time { return time.Now().AddDate(10, 0, 0) }
+		value, err := read(c, cookie, "theme")
+		assert.NilError(t, err)
+		assert.Equal(t, value, "")
+	})
+
+	t.Run("Too long", func(t *testing.T) {
+		err := c.Write(httptest.NewRecorder(), &http.Cookie{Name: "theme", Value: strings.Repeat("x", maxCookieSize)})
+		assert.ErrorIs(t, err, ErrTooLong)
+	})
+}
@@ -0,0 +1,153 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+// =============================================================================
+// Message Catalogs
+// =============================================================================
+
+// DefaultLocale is used when no preference matches a supported locale, and
+// as the fallback for messages missing from another catalog
+const DefaultLocale = "en"
+
+//go:embed "locales"
+var files embed.FS
+
+// Locale is a message catalog plus the data needed to format dates
+type Locale struct {
+	Code     string            `json:"-"`
+	Name     string            `json:"name"`     // Native name, for the language switcher
+	Months   [12]string        `json:"months"`   // Abbreviated month names
+	At       string            `json:"at"`       // Word joining date and time
+	Messages map[string]string `json:"messages"` // Key -> fmt format string
+}
+
+var (
+	locales = map[string]*Locale{}
+	ordered []*Locale
+	matcher language.Matcher
+)
+
+// init loads every embedded catalog. A malformed catalog is a developer
+// error, so it panics rather than failing at request time.
+func init() {
+	paths, err := fs.Glob(files, "locales/*.json")
+	if err != nil {
+		panic(err)
+	}
+
+	for _, p := range paths {
+		data, err := files.ReadFile(p)
+		if err != nil {
+			panic(err)
+		}
+
+		l := &Locale{Code: strings.TrimSuffix(path.Base(p), ".json")}
+		if err := json.Unmarshal(data, l); err != nil {
+			panic(fmt.Errorf("i18n: parsing %s: %w", p, err))
+		}
+		locales[l.Code] = l
+		ordered = append(ordered, l)
+	}
+
+	if _, ok := locales[DefaultLocale]; !ok {
+		panic("i18n: missing catalog for default locale " + DefaultLocale)
+	}
+
+	// The default locale goes first so the matcher falls back to it
+	sort.Slice(ordered, func(i, j int) bool {
+		if ordered[i].Code == DefaultLocale || ordered[j].Code == DefaultLocale {
+			return ordered[i].Code == DefaultLocale
+		}
+		return ordered[i].Code < ordered[j].Code
+	})
+
+	tags := make([]language.Tag, len(ordered))
+	for i, l := range ordered {
+		tags[i] = language.Make(l.Code)
+	}
+	matcher = language.NewMatcher(tags)
+}
+
+// =============================================================================
+// Locale Selection
+// =============================================================================
+
+// Supported returns all available locales, default first
+func Supported() []*Locale {
+	return ordered
+}
+
+// IsSupported reports whether a catalog exists for the locale code
+func IsSupported(code string) bool {
+	_, ok := locales[code]
+	return ok
+}
+
+// Match returns the supported locale that best fits an Accept-Language
+// header value, or DefaultLocale when nothing matches
+func Match(acceptLanguage string) string {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return DefaultLocale
+	}
+
+	_, index, confidence := matcher.Match(tags...)
+	if confidence == language.No {
+		return DefaultLocale
+	}
+	return ordered[index].Code
+}
+
+// =============================================================================
+// Translation and Formatting
+// =============================================================================
+
+// T translates a message key into the given locale, formatting any args
+// into it. Missing keys fall back to the default locale and then to the key
+// itself, so a gap in a catalog is visible but never breaks a page.
+func T(locale, key string, args ...any) string {
+	msg, ok := lookup(locale).Messages[key]
+	if !ok {
+		msg, ok = locales[DefaultLocale].Messages[key]
+		if !ok {
+			return key
+		}
+	}
+
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+// FormatDate formats t in UTC as "DD Mon YYYY at HH:MM" using the locale's
+// month names and joining word
+func FormatDate(locale string, t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	l := lookup(locale)
+	t = t.UTC()
+	return fmt.Sprintf("%02d %s %d %s %s", t.Day(), l.Months[t.Month()-1], t.Year(), l.At, t.Format("15:04"))
+}
+
+// lookup returns the catalog for locale, or the default catalog
+func lookup(locale string) *Locale {
+	if l, ok := locales[locale]; ok {
+		return l
+	}
+	return locales[DefaultLocale]
+}
@@ -0,0 +1,66 @@
+package i18n
+
+import (
+	"testing"
+	"time"
+
+	"adotkaya.playground/internal/assert"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptLanguage string
+		want           string
+	}{
+		{name: "Empty", acceptLanguage: "", want: "en"},
+		{name: "Exact", acceptLanguage: "de", want: "de"},
+		{name: "Region", acceptLanguage: "tr-TR,tr;q=0.9", want: "tr"},
+		{name: "Weighted", acceptLanguage: "fr;q=0.9,de;q=0.8", want: "de"},
+		{name: "Unsupported", acceptLanguage: "ja", want: "en"},
+		{name: "Malformed", acceptLanguage: ";;;", want: "en"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, Match(tt.acceptLanguage), tt.want)
+		})
+	}
+}
+
+func TestT(t *testing.T) {
+	tests := []struct {
+		name   string
+		locale string
+		key    string
+		args   []any
+		want   string
+	}{
+		{name: "Default", locale: "en", key: "nav.home", want: "Home"},
+		{name: "Translated", locale: "de", key: "nav.home", want: "Startseite"},
+		{name: "Args", locale: "en", key: "validation.max_chars", args: []any{100}, want: "This field cannot be more than 100 characters long"},
+		{name: "Unknown locale", locale: "xx", key: "nav.home", want: "Home"},
+		{name: "Unknown key", locale: "de", key: "no.such.key", want: "no.such.key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, T(tt.locale, tt.key, tt.args...), tt.want)
+		})
+	}
+}
+
+func TestCatalogsComplete(t *testing.T) {
+	def := locales[DefaultLocale]
+	for _, l := range Supported() {
+		for key := range def.Messages {
+			if _, ok := l.Messages[key]; !ok {
+				t.Errorf("locale %s: missing message %q", l.Code, key)
+			}
+		}
+	}
+}
+
+func TestFormatDate(t *testing.T) {
+	tm := time.Date(2022, 3, 17, 10, 15, 0, 0, time.UTC)
+	assert.Equal(t, FormatDate("de", tm), "17 Mär 2022 um 10:15")
+	assert.Equal(t, FormatDate("de", time.Time{}), "")
+}
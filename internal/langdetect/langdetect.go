@@ -0,0 +1,284 @@
+package langdetect
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// =============================================================================
+// Languages
+// =============================================================================
+// Detect guesses a snippet's programming language from its content, so
+// snippets can be highlighted and filtered by language without anyone
+// having to say what it is. It is a lightweight lexical heuristic: a
+// shebang decides outright, otherwise each language scores points for the
+// telltale patterns found in the content and the clear winner is chosen.
+
+// names maps the language identifiers Detect returns to display names
+var names = map[string]string{
+	"c":          "C",
+	"cpp":        "C++",
+	"css":        "CSS",
+	"go":         "Go",
+	"html":       "HTML",
+	"java":       "Java",
+	"javascript": "JavaScript",
+	"json":       "JSON",
+	"markdown":   "Markdown",
+	"php":        "PHP",
+	"python":     "Python",
+	"ruby":       "Ruby",
+	"rust":       "Rust",
+	"shell":      "Shell",
+	"sql":        "SQL",
+	"typescript": "TypeScript",
+	"yaml":       "YAML",
+}
+
+// Name returns the display name of a language identifier, or the
+// identifier itself if it isn't known
+func Name(lang string) string {
+	if name, ok := names[lang]; ok {
+		return name
+	}
+	return lang
+}
+
+// Known reports whether lang is a language identifier Detect can return
+func Known(lang string) bool {
+	_, ok := names[lang]
+	return ok
+}
+
+// =============================================================================
+// Detection
+// =============================================================================
+
+const (
+	// maxSample is how much of the content is examined; the start of a
+	// snippet is as telling as the rest of it
+	maxSample = 32 << 10
+
+	// minScore is the lowest score accepted as a guess. A single weak
+	// pattern, like an arrow or an assignment, isn't enough.
+	minScore = 4
+)
+
+// pattern is a telltale sign of a language, worth weight points if it
+// appears anywhere in the content
+type pattern struct {
+	rx     *regexp.Regexp
+	weight int
+}
+
+// p compiles a pattern. Patterns are multi-line, so ^ and $ match at line
+// boundaries.
+func p(rx string, weight int) pattern {
+	return pattern{rx: regexp.MustCompile("(?m)" + rx), weight: weight}
+}
+
+// patterns lists the signs of each language
+var patterns = map[string][]pattern{
+	"go": {
+		p(`^package \w+\s*$`, 3),
+		p(`^func (\(\w+ \*?\w+(\[\w+\])?\) )?\w+\(`, 3),
+		p(`^import \($`, 2),
+		p(`\w+ := `, 1),
+		p(`\berr != nil\b`, 3),
+		p(`\bfmt\.\w+\(`, 2),
+	},
+	"python": {
+		p(`^\s*def \w+\(.*\)( -> [\w\[\], .]+)?:\s*$`, 3),
+		p(`^\s*class \w+(\(.*\))?:\s*$`, 3),
+		p(`^from [\w.]+ import \w+`, 3),
+		p(`^import [\w.]+( as \w+)?\s*$`, 2),
+		p(`^if __name__ == ['"]__main__['"]:`, 3),
+		p(`\bself\.\w+`, 2),
+		p(`^\s*elif .*:\s*$`, 2),
+		p(`\bprint\(`, 1),
+	},
+	"javascript": {
+		p(`\b(const|let|var) \w+ = `, 1),
+		p(`\bfunction\s*\w*\s*\([^)]*\)\s*\{`, 2),
+		p(`\) => \{?`, 1),
+		p(`\bconsole\.log\(`, 3),
+		p(`\bdocument\.\w+`, 2),
+		p(`\brequire\(['"][\w./@-]+['"]\)`, 2),
+		p(` === `, 2),
+		p(`^import .* from ['"][\w./@-]+['"];?\s*$`, 2),
+	},
+	"typescript": {
+		p(`\b(const|let|var) \w+: [\w<>\[\]|]+ = `, 3),
+		p(`\(\w+\??: (string|number|boolean|any|unknown)\b`, 3),
+		p(`^(export )?interface \w+ \{`, 2),
+		p(`^(export )?type \w+ = `, 2),
+		p(`\): (string|number|boolean|void|Promise<\w+>) \{`, 3),
+	},
+	"rust": {
+		p(`^\s*(pub )?fn \w+(<[^>]*>)?\(`, 2),
+		p(`\blet mut \w+`, 3),
+		p(`^use \w+(::[\w{}, *]+)+;`, 3),
+		p(`\b(println|format|vec)!\(`, 3),
+		p(`^\s*impl\b`, 2),
+		p(`&(mut )?str\b`, 2),
+	},
+	"java": {
+		p(`\bpublic (static )?(final )?(class|void|interface)\b`, 2),
+		p(`\bSystem\.out\.print`, 3),
+		p(`^import java\.`, 3),
+		p(`\bpublic static void main\(String`, 3),
+		p(`^\s*@Override\s*$`, 2),
+		p(`\bString\[\] \w+`, 1),
+	},
+	"c": {
+		p(`^#include\s*[<"][\w/]+\.h[>"]`, 3),
+		p(`\bprintf\(`, 2),
+		p(`\bint main\(`, 2),
+		p(`\b(malloc|free|sizeof)\(`, 2),
+		p(`^#define \w+`, 1),
+	},
+	"cpp": {
+		p(`^#include\s*<\w+>`, 3),
+		p(`\bstd::\w+`, 3),
+		p(`\b(cout|cerr)\s*<<`, 3),
+		p(`^using namespace \w+;`, 3),
+		p(`\btemplate\s*<`, 2),
+	},
+	"ruby": {
+		p(`^\s*def \w+[!?]?(\(.*\))?\s*$`, 2),
+		p(`^\s*end\s*$`, 2),
+		p(`^\s*puts\b`, 2),
+		p(`^require ['"][\w/]+['"]`, 2),
+		p(`\.each( do|\s*\{) \|`, 3),
+		p(`\battr_(accessor|reader|writer)\b`, 3),
+	},
+	"php": {
+		p(`<\?php`, 6),
+		p(`\$\w+ = `, 1),
+		p(`\bfunction \w+\(\$`, 3),
+		p(`\$this->`, 3),
+		p(`^\s*echo `, 1),
+	},
+	"shell": {
+		p(`^\s*(if|while) \[\[? `, 3),
+		p(`^\s*fi\s*$`, 3),
+		p(`^\s*(done|esac)\s*$`, 2),
+		p(`^\s*export \w+=`, 2),
+		p(`^\s*\$? ?(sudo|apt-get|apt|brew|cd|mkdir|curl|wget|chmod|npm|pip) `, 2),
+		p(`^\s*echo `, 1),
+		p(`\$\{\w+\}`, 1),
+	},
+	"sql": {
+		p(`(?i)^\s*(SELECT|INSERT INTO|UPDATE|DELETE FROM|CREATE (TABLE|INDEX|VIEW)|ALTER TABLE|DROP TABLE)\b`, 3),
+		p(`(?i)\bFROM \w+`, 1),
+		p(`(?i)\bWHERE\b`, 1),
+		p(`(?i)\b(INNER|LEFT|RIGHT|OUTER) JOIN\b`, 2),
+		p(`(?i)\b(VARCHAR|INTEGER|SERIAL|PRIMARY KEY)\b`, 2),
+	},
+	"html": {
+		p(`(?i)<!DOCTYPE html`, 6),
+		p(`(?i)<(html|head|body|div|span|p|a|ul|li|table|form)\b[^>]*>`, 2),
+		p(`</\w+>`, 2),
+	},
+	"css": {
+		p(`^\s*[.#]?[\w-]+([ ,>+~]*[.#:]?[\w-]+)*\s*\{\s*$`, 1),
+		p(`^\s*(color|margin|padding|font-size|font-family|display|background|border|width|height):\s*[^;]+;`, 3),
+		p(`^@media\b`, 3),
+	},
+	"yaml": {
+		p(`^---\s*$`, 2),
+		p(`^[\w-]+:\s*$`, 1),
+		p(`^\s+[\w-]+: [^{};]+$`, 1),
+		p(`^\s*- [\w-]+:? `, 1),
+	},
+	"markdown": {
+		p(`^#{1,6} \S`, 1),
+		p(`\[[^\]]+\]\([^)\s]+\)`, 3),
+		p("^```", 3),
+		p(`\*\*\w[^*]*\*\*`, 2),
+		p(`^\s*[-*] \S`, 1),
+	},
+}
+
+// shebangs maps the interpreter named on a #! line to its language
+var shebangs = map[string]string{
+	"bash":    "shell",
+	"sh":      "shell",
+	"zsh":     "shell",
+	"python":  "python",
+	"python3": "python",
+	"node":    "javascript",
+	"ruby":    "ruby",
+	"php":     "php",
+}
+
+// Detect returns the identifier of the language content is most likely
+// written in, or "" if there's no clear winner
+func Detect(content string) string {
+	if len(content) > maxSample {
+		content = content[:maxSample]
+	}
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return ""
+	}
+
+	if lang := shebang(content); lang != "" {
+		return lang
+	}
+	if (content[0] == '{' || content[0] == '[') && json.Valid([]byte(content)) {
+		return "json"
+	}
+
+	scores := make(map[string]int, len(patterns))
+	for lang, signs := range patterns {
+		for _, sign := range signs {
+			if sign.rx.MatchString(content) {
+				scores[lang] += sign.weight
+			}
+		}
+	}
+	// TypeScript is a superset of JavaScript, so once it shows signs of its
+	// own the JavaScript ones count for it too
+	if scores["typescript"] > 0 {
+		scores["typescript"] += scores["javascript"]
+	}
+
+	best, bestScore, runnerUp := "", 0, 0
+	for lang, score := range scores {
+		switch {
+		case score > bestScore:
+			best, bestScore, runnerUp = lang, score, bestScore
+		case score > runnerUp:
+			runnerUp = score
+		}
+	}
+	if bestScore < minScore || bestScore == runnerUp {
+		return ""
+	}
+	return best
+}
+
+// shebang returns the language of the interpreter named on a #! first
+// line, or "" if there is none or it isn't known
+func shebang(content string) string {
+	line, _, _ := strings.Cut(content, "\n")
+	rest, ok := strings.CutPrefix(line, "#!")
+	if !ok {
+		return ""
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return ""
+	}
+	interpreter := fields[0]
+	// #!/usr/bin/env python3 names the interpreter as an argument
+	if strings.HasSuffix(interpreter, "/env") && len(fields) > 1 {
+		interpreter = fields[1]
+	}
+	interpreter = interpreter[strings.LastIndex(interpreter, "/")+1:]
+
+	return shebangs[interpreter]
+}
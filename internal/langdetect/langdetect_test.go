@@ -0,0 +1,127 @@
+package langdetect
+
+import (
+	"strings"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "Empty", content: "  \n", want: ""},
+		{name: "Prose", content: "An old silent pond...\nA frog jumps into the pond,\nsplash! Silence again.", want: ""},
+		{
+			name:    "Go",
+			content: "package main\n\nimport (\n\t\"fmt\"\n)\n\nfunc main() {\n\tmsg := \"hi\"\n\tfmt.Println(msg)\n}\n",
+			want:    "go",
+		},
+		{
+			name:    "Python",
+			content: "import os\n\nclass Pond:\n    def __init__(self, name):\n        self.name = name\n\nprint(Pond('old').name)\n",
+			want:    "python",
+		},
+		{
+			name:    "JavaScript",
+			content: "const pond = document.querySelector('.pond');\npond.addEventListener('click', () => {\n  console.log('splash');\n});\n",
+			want:    "javascript",
+		},
+		{
+			name:    "TypeScript",
+			content: "interface Frog {\n  name: string;\n}\n\nfunction jump(frog: Frog, height: number): void {\n  console.log(frog.name, height);\n}\n",
+			want:    "typescript",
+		},
+		{
+			name:    "Rust",
+			content: "use std::collections::HashMap;\n\nfn main() {\n    let mut ponds = HashMap::new();\n    ponds.insert(\"old\", 1);\n    println!(\"{:?}\", ponds);\n}\n",
+			want:    "rust",
+		},
+		{
+			name:    "Java",
+			content: "public class Pond {\n    public static void main(String[] args) {\n        System.out.println(\"splash\");\n    }\n}\n",
+			want:    "java",
+		},
+		{
+			name:    "C",
+			content: "#include <stdio.h>\n\nint main(void) {\n    printf(\"splash\\n\");\n    return 0;\n}\n",
+			want:    "c",
+		},
+		{
+			name:    "C++",
+			content: "#include <iostream>\n\nint main() {\n    std::cout << \"splash\" << std::endl;\n}\n",
+			want:    "cpp",
+		},
+		{
+			name:    "Ruby",
+			content: "require 'json'\n\nclass Pond\n  attr_reader :frogs\n\n  def splash\n    frogs.each { |f| puts f }\n  end\nend\n",
+			want:    "ruby",
+		},
+		{
+			name:    "PHP",
+			content: "<?php\n$pond = 'old';\necho $pond;\n",
+			want:    "php",
+		},
+		{
+			name:    "Shell",
+			content: "export POND=old\nif [ -d \"$POND\" ]; then\n  echo splash\nfi\n",
+			want:    "shell",
+		},
+		{
+			name:    "Shebang",
+			content: "#!/usr/bin/env python3\nprint('splash')\n",
+			want:    "python",
+		},
+		{
+			name:    "SQL",
+			content: "SELECT s.id, s.title\nFROM snippets s\nLEFT JOIN users u ON u.id = s.user_id\nWHERE s.expires > now();\n",
+			want:    "sql",
+		},
+		{
+			name:    "HTML",
+			content: "<!DOCTYPE html>\n<html>\n<body><p>Splash</p></body>\n</html>\n",
+			want:    "html",
+		},
+		{
+			name:    "CSS",
+			content: "body {\n    color: #34495E;\n    font-family: sans-serif;\n}\n\n@media print {\n    nav {\n        display: none;\n    }\n}\n",
+			want:    "css",
+		},
+		{
+			name:    "JSON",
+			content: `{"pond": "old", "frogs": [1, 2]}`,
+			want:    "json",
+		},
+		{
+			name:    "YAML",
+			content: "---\npond:\n  name: old\n  frogs: 2\nponds:\n  - name: new\n",
+			want:    "yaml",
+		},
+		{
+			name:    "Markdown",
+			content: "# Ponds\n\nSee [Basho](https://example.com) for **more**.\n\n```\nsplash\n```\n",
+			want:    "markdown",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, Detect(tt.content), tt.want)
+		})
+	}
+}
+
+func TestDetectLargeContent(t *testing.T) {
+	// Only the start is examined
+	content := "package main\n\nfunc main() {\n\tif err != nil {\n\t}\n}\n" + strings.Repeat("splash ", maxSample)
+	assert.Equal(t, Detect(content), "go")
+}
+
+func TestName(t *testing.T) {
+	assert.Equal(t, Name("cpp"), "C++")
+	assert.Equal(t, Name("cobol"), "cobol")
+	assert.Equal(t, Known("go"), true)
+	assert.Equal(t, Known("cobol"), false)
+}
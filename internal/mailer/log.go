@@ -0,0 +1,32 @@
+package mailer
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// =============================================================================
+// Log Mailer
+// =============================================================================
+
+// LogMailer renders emails and writes them to a logger instead of sending
+// them, for development without an SMTP server
+type LogMailer struct {
+	logger *slog.Logger
+}
+
+// NewLogMailer returns a LogMailer writing to logger
+func NewLogMailer(logger *slog.Logger) *LogMailer {
+	return &LogMailer{logger: logger}
+}
+
+// Send renders templateFile and logs the result
+func (m *LogMailer) Send(recipient, templateFile string, data any) error {
+	msg, err := Render(recipient, templateFile, data)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidMessage, err)
+	}
+
+	m.logger.Info("email", "to", msg.To, "subject", msg.Subject, "text", msg.Text)
+	return nil
+}
@@ -0,0 +1,130 @@
+// Package mailer renders the email templates embedded in ui.Files and sends
+// them over SMTP, or just logs them during development.
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"net/textproto"
+	"path"
+	"text/template"
+
+	"adotkaya.playground/ui"
+)
+
+// =============================================================================
+// Mailer Interface
+// =============================================================================
+
+// Sender sends templated emails. templateFile names a file in ui/email which
+// defines "subject", "plainBody" and "htmlBody" templates, executed with data.
+type Sender interface {
+	Send(recipient, templateFile string, data any) error
+}
+
+// ErrInvalidMessage is wrapped by errors for messages that can never be
+// sent, such as a template that fails to render or a malformed address
+var ErrInvalidMessage = errors.New("mailer: invalid message")
+
+// IsPermanent reports whether retrying the send that returned err cannot
+// succeed: either the message is invalid or the SMTP server rejected it with
+// a 5xx reply (e.g. a bounced recipient). Network errors and 4xx replies are
+// temporary.
+func IsPermanent(err error) bool {
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Code >= 500
+	}
+	return errors.Is(err, ErrInvalidMessage)
+}
+
+// Message is a rendered email
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// =============================================================================
+// Rendering
+// =============================================================================
+
+// Render executes templateFile with data. The subject and plain-text body use
+// text/template; the HTML body uses html/template so data is escaped.
+func Render(recipient, templateFile string, data any) (*Message, error) {
+	return render(ui.Files, recipient, templateFile, data)
+}
+
+func render(fsys fs.FS, recipient, templateFile string, data any) (*Message, error) {
+	name := path.Join("email", templateFile)
+
+	textTmpl, err := template.New("email").ParseFS(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := new(bytes.Buffer)
+	if err = textTmpl.ExecuteTemplate(subject, "subject", data); err != nil {
+		return nil, err
+	}
+
+	text := new(bytes.Buffer)
+	if err = textTmpl.ExecuteTemplate(text, "plainBody", data); err != nil {
+		return nil, err
+	}
+
+	htmlTmpl, err := htmltemplate.New("email").ParseFS(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	html := new(bytes.Buffer)
+	if err = htmlTmpl.ExecuteTemplate(html, "htmlBody", data); err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		To:      recipient,
+		Subject: subject.String(),
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
+
+// CheckTemplates parses every email template, as text and as HTML, and
+// checks each defines the subject and both bodies, so a broken template is
+// found at startup rather than when the email is first sent
+func CheckTemplates() error {
+	return checkTemplates(ui.Files)
+}
+
+func checkTemplates(fsys fs.FS) error {
+	names, err := fs.Glob(fsys, "email/*.tmpl")
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		textTmpl, err := template.New("email").ParseFS(fsys, name)
+		if err != nil {
+			return err
+		}
+		htmlTmpl, err := htmltemplate.New("email").ParseFS(fsys, name)
+		if err != nil {
+			return err
+		}
+		for _, block := range []string{"subject", "plainBody"} {
+			if textTmpl.Lookup(block) == nil {
+				return fmt.Errorf("%s: no %q template", name, block)
+			}
+		}
+		if htmlTmpl.Lookup("htmlBody") == nil {
+			return fmt.Errorf("%s: no %q template", name, "htmlBody")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"adotkaya.playground/internal/assert"
+)
+
+func TestRender(t *testing.T) {
+	msg, err := Render("bob@example.com", "user_welcome.tmpl", map[string]any{
+		"Name":     "Bob <b>",
+		"LoginURL": "https://snippetbox.example.com/user/login",
+	})
+	assert.NilError(t, err)
+
+	assert.Equal(t, msg.To, "bob@example.com")
+	assert.Equal(t, msg.Subject, "Welcome to Snippetbox, Bob <b>!")
+	assert.StringContains(t, msg.Text, "Hi Bob <b>,")
+	assert.StringContains(t, msg.HTML, "<p>Hi Bob &lt;b&gt;,</p>")
+	assert.StringContains(t, msg.HTML, `<a href="https://snippetbox.example.com/user/login">`)
+}
+
+func TestRenderErrors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"email/no_html.tmpl": {Data: []byte(`{{define "subject"}}Hi{{end}}{{define "plainBody"}}Hi{{end}}`)},
+	}
+
+	_, err := render(fsys, "bob@example.com", "missing.tmpl", nil)
+	assert.NotNil(t, err)
+
+	_, err = render(fsys, "bob@example.com", "no_html.tmpl", nil)
+	assert.NotNil(t, err)
+}
+
+func TestCheckTemplates(t *testing.T) {
+	assert.NilError(t, CheckTemplates())
+
+	fsys := fstest.MapFS{
+		"email/ok.tmpl":      {Data: []byte(`{{define "subject"}}Hi{{end}}{{define "plainBody"}}Hi{{end}}{{define "htmlBody"}}<p>Hi</p>{{end}}`)},
+		"email/no_html.tmpl": {Data: []byte(`{{define "subject"}}Hi{{end}}{{define "plainBody"}}Hi{{end}}`)},
+	}
+	err := checkTemplates(fsys)
+	assert.StringContains(t, err.Error(), `email/no_html.tmpl: no "htmlBody" template`)
+
+	fsys = fstest.MapFS{"email/broken.tmpl": {Data: []byte(`{{define "subject"}}Hi{{end`)}}
+	assert.NotNil(t, checkTemplates(fsys))
+}
+
+func TestMessageBytes(t *testing.T) {
+	msg := &Message{
+		To:      "bob@example.com",
+		Subject: "Grüße",
+		Text:    "Hello\n",
+		HTML:    "<p>Hello</p>\n",
+	}
+	from := &mail.Address{Name: "Snippetbox", Address: "no-reply@example.com"}
+	to := &mail.Address{Address: "bob@example.com"}
+
+	b, err := msg.bytes(from, to, time.Date(2024, 3, 17, 10, 0, 0, 0, time.UTC))
+	assert.NilError(t, err)
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(b))
+	assert.NilError(t, err)
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	assert.NilError(t, err)
+	assert.Equal(t, subject, "Grüße")
+	assert.Equal(t, parsed.Header.Get("From"), `"Snippetbox" <no-reply@example.com>`)
+	assert.Equal(t, parsed.Header.Get("To"), "<bob@example.com>")
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	assert.NilError(t, err)
+	assert.Equal(t, mediaType, "multipart/alternative")
+
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	for _, want := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", "Hello\n"},
+		{"text/html; charset=utf-8", "<p>Hello</p>\n"},
+	} {
+		part, err := reader.NextPart()
+		assert.NilError(t, err)
+		assert.Equal(t, part.Header.Get("Content-Type"), want.contentType)
+
+		// multipart.Reader decodes quoted-printable parts transparently
+		body, err := io.ReadAll(part)
+		assert.NilError(t, err)
+		assert.Equal(t, strings.ReplaceAll(string(body), "\r\n", "\n"), want.body)
+	}
+}
+
+func TestLogMailer(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewLogMailer(slog.New(slog.NewTextHandler(&buf, nil)))
+
+	err := m.Send("bob@example.com", "user_welcome.tmpl", map[string]any{"Name": "Bob"})
+	assert.NilError(t, err)
+	assert.StringContains(t, buf.String(), `msg=email to=bob@example.com subject="Welcome to Snippetbox, Bob!"`)
+
+	err = m.Send("bob@example.com", "missing.tmpl", nil)
+	assert.ErrorIs(t, err, ErrInvalidMessage)
+}
+
+func TestIsPermanent(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"Mailbox unavailable", &textproto.Error{Code: 550, Msg: "no such user"}, true},
+		{"Wrapped rejection", fmt.Errorf("sending: %w", &textproto.Error{Code: 554}), true},
+		{"Greylisted", &textproto.Error{Code: 451, Msg: "try again later"}, false},
+		{"Invalid message", fmt.Errorf("%w: recipient", ErrInvalidMessage), true},
+		{"Network error", errors.New("dial tcp: connection refused"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, IsPermanent(tt.err), tt.want)
+		})
+	}
+}
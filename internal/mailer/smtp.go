@@ -0,0 +1,200 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// =============================================================================
+// SMTP Mailer
+// =============================================================================
+
+// TLS modes for Config.TLS
+const (
+	TLSStartTLS = "starttls" // Plain connection upgraded with STARTTLS (port 587)
+	TLSImplicit = "tls"      // TLS from the first byte (port 465)
+	TLSNone     = "none"     // No encryption; only for local relays
+)
+
+// Config holds SMTP server settings
+type Config struct {
+	Host     string
+	Port     int
+	Username string // Leave empty for servers without authentication
+	Password string
+	Sender   string // From address, e.g. "Snippetbox <no-reply@example.com>"
+	TLS      string // One of TLSStartTLS, TLSImplicit or TLSNone
+	Timeout  time.Duration
+}
+
+// SMTPMailer sends emails through an SMTP server
+type SMTPMailer struct {
+	cfg Config
+}
+
+// New returns an SMTPMailer for the given configuration
+func New(cfg Config) *SMTPMailer {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &SMTPMailer{cfg: cfg}
+}
+
+// Send renders templateFile and delivers it to recipient
+func (m *SMTPMailer) Send(recipient, templateFile string, data any) error {
+	msg, err := Render(recipient, templateFile, data)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidMessage, err)
+	}
+
+	from, err := mail.ParseAddress(m.cfg.Sender)
+	if err != nil {
+		return fmt.Errorf("%w: sender: %w", ErrInvalidMessage, err)
+	}
+	to, err := mail.ParseAddress(recipient)
+	if err != nil {
+		return fmt.Errorf("%w: recipient: %w", ErrInvalidMessage, err)
+	}
+
+	body, err := msg.bytes(from, to, time.Now())
+	if err != nil {
+		return err
+	}
+
+	client, err := m.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if m.cfg.Username != "" {
+		auth := smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+		if err = client.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err = client.Mail(from.Address); err != nil {
+		return err
+	}
+	if err = client.Rcpt(to.Address); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(body); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// Check connects to the server and logs in, without sending anything, to
+// find out at startup whether mail can be sent
+func (m *SMTPMailer) Check() error {
+	client, err := m.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if m.cfg.Username != "" {
+		auth := smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+		if err = client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	return client.Quit()
+}
+
+// dial connects to the server using the configured TLS mode
+func (m *SMTPMailer) dial() (*smtp.Client, error) {
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+	tlsConfig := &tls.Config{ServerName: m.cfg.Host}
+	dialer := &net.Dialer{Timeout: m.cfg.Timeout}
+
+	var conn net.Conn
+	var err error
+	if m.cfg.TLS == TLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(m.cfg.Timeout))
+
+	client, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if m.cfg.TLS == TLSStartTLS {
+		if err = client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+
+	return client, nil
+}
+
+// =============================================================================
+// MIME Encoding
+// =============================================================================
+
+// bytes encodes the message as a multipart/alternative MIME message with
+// quoted-printable plain-text and HTML parts
+func (msg *Message) bytes(from, to *mail.Address, date time.Time) ([]byte, error) {
+	b := make([]byte, 12)
+	rand.Read(b)
+	boundary := hex.EncodeToString(b)
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+
+	parts := []struct{ contentType, body string }{
+		{"text/plain", msg.Text},
+		{"text/html", msg.HTML},
+	}
+	for _, p := range parts {
+		fmt.Fprintf(buf, "--%s\r\n", boundary)
+		fmt.Fprintf(buf, "Content-Type: %s; charset=utf-8\r\n", p.contentType)
+		fmt.Fprintf(buf, "Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+		qp := quotedprintable.NewWriter(buf)
+		if _, err := qp.Write([]byte(p.body)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(buf, "\r\n")
+	}
+	fmt.Fprintf(buf, "--%s--\r\n", boundary)
+
+	return buf.Bytes(), nil
+}
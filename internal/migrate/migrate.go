@@ -0,0 +1,236 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =============================================================================
+// Migration Type
+// =============================================================================
+
+// Migration is a single numbered SQL script
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// lockID is the advisory lock key held while migrating, so that several
+// instances starting at once don't apply the same migration concurrently
+const lockID = 4_815_162_342
+
+// =============================================================================
+// Loading
+// =============================================================================
+
+// Load reads all NNNN_name.sql files from fsys, sorted by version
+func Load(fsys fs.FS) ([]Migration, error) {
+	paths, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := []Migration{}
+	seen := map[int]string{}
+	for _, p := range paths {
+		base := strings.TrimSuffix(path.Base(p), ".sql")
+		prefix, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migrate: %s: expected NNNN_name.sql", p)
+		}
+
+		version, err := strconv.Atoi(prefix)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("migrate: %s: invalid version %q", p, prefix)
+		}
+		if other, dup := seen[version]; dup {
+			return nil, fmt.Errorf("migrate: %s and %s share version %d", other, p, version)
+		}
+		seen[version] = p
+
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, Migration{Version: version, Name: name, SQL: string(data)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// =============================================================================
+// Applying
+// =============================================================================
+
+// Up applies every migration in fsys newer than the database's current
+// version, each in its own transaction, and returns the versions applied
+func Up(ctx context.Context, db *pgxpool.Pool, fsys fs.FS) ([]int, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := db.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, "SELECT pg_advisory_lock($1)", lockID)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", lockID)
+
+	_, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+                                 version INTEGER PRIMARY KEY,
+                                 name TEXT NOT NULL,
+                                 applied TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+                             )`)
+	if err != nil {
+		return nil, err
+	}
+
+	var current int
+	err = conn.QueryRow(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := []int{}
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return applied, err
+		}
+
+		if _, err = tx.Exec(ctx, m.SQL); err != nil {
+			tx.Rollback(ctx)
+			return applied, fmt.Errorf("migrate: applying %04d_%s: %w", m.Version, m.Name, err)
+		}
+
+		_, err = tx.Exec(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.Version, m.Name)
+		if err != nil {
+			tx.Rollback(ctx)
+			return applied, err
+		}
+
+		if err = tx.Commit(ctx); err != nil {
+			return applied, err
+		}
+		applied = append(applied, m.Version)
+	}
+
+	return applied, nil
+}
+
+// =============================================================================
+// Drift
+// =============================================================================
+
+// Drift compares the migrations applied to a database with those embedded
+// in the binary. A database is behind when embedded migrations haven't been
+// applied to it, and ahead when it has migrations the binary doesn't know,
+// as after rolling back to an older release.
+type Drift struct {
+	Database int   // Latest version applied to the database
+	Embedded int   // Latest version embedded
+	Pending  []int // Embedded versions not applied
+	Unknown  []int // Applied versions not embedded
+}
+
+// Behind reports whether embedded migrations haven't been applied
+func (d Drift) Behind() bool {
+	return len(d.Pending) > 0
+}
+
+// Ahead reports whether the database has migrations that aren't embedded
+func (d Drift) Ahead() bool {
+	return len(d.Unknown) > 0
+}
+
+// String describes the drift, or says the schema is up to date
+func (d Drift) String() string {
+	switch {
+	case d.Ahead() && d.Behind():
+		return fmt.Sprintf("database at version %d has migrations %v that aren't embedded and lacks embedded migrations %v", d.Database, d.Unknown, d.Pending)
+	case d.Ahead():
+		return fmt.Sprintf("database at version %d is ahead of the embedded migrations (version %d): %v aren't embedded", d.Database, d.Embedded, d.Unknown)
+	case d.Behind():
+		return fmt.Sprintf("database at version %d is behind the embedded migrations (version %d): %v are pending", d.Database, d.Embedded, d.Pending)
+	}
+	return fmt.Sprintf("database is up to date at version %d", d.Database)
+}
+
+// Check compares the migrations applied to db with those in fsys. A
+// database that was never migrated is behind by every migration.
+func Check(ctx context.Context, db *pgxpool.Pool, fsys fs.FS) (Drift, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return Drift{}, err
+	}
+
+	var exists bool
+	err = db.QueryRow(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists)
+	if err != nil {
+		return Drift{}, err
+	}
+
+	applied := []int{}
+	if exists {
+		rows, err := db.Query(ctx, "SELECT version FROM schema_migrations ORDER BY version")
+		if err != nil {
+			return Drift{}, err
+		}
+		applied, err = pgx.CollectRows(rows, pgx.RowTo[int])
+		if err != nil {
+			return Drift{}, err
+		}
+	}
+
+	return compare(migrations, applied), nil
+}
+
+// compare works out the drift between the migrations and the versions
+// applied, both sorted by version
+func compare(migrations []Migration, applied []int) Drift {
+	d := Drift{}
+	embedded := map[int]bool{}
+	for _, m := range migrations {
+		embedded[m.Version] = true
+		d.Embedded = m.Version
+	}
+
+	done := map[int]bool{}
+	for _, v := range applied {
+		done[v] = true
+		d.Database = v
+		if !embedded[v] {
+			d.Unknown = append(d.Unknown, v)
+		}
+	}
+	for _, m := range migrations {
+		if !done[m.Version] {
+			d.Pending = append(d.Pending, m.Version)
+		}
+	}
+	return d
+}
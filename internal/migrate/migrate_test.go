@@ -0,0 +1,76 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"adotkaya.playground/internal/assert"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0002_second.sql": {Data: []byte("SELECT 2;")},
+		"0001_first.sql":  {Data: []byte("SELECT 1;")},
+		"README.md":       {Data: []byte("ignored")},
+	}
+
+	migrations, err := Load(fsys)
+	assert.NilError(t, err)
+	if len(migrations) != 2 {
+		t.Fatalf("got %d migrations; want 2", len(migrations))
+	}
+	assert.Equal(t, migrations[0], Migration{Version: 1, Name: "first", SQL: "SELECT 1;"})
+	assert.Equal(t, migrations[1].Version, 2)
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{name: "No name", fsys: fstest.MapFS{"0001.sql": {}}},
+		{name: "Bad version", fsys: fstest.MapFS{"abc_first.sql": {}}},
+		{name: "Duplicate", fsys: fstest.MapFS{"0001_a.sql": {}, "1_b.sql": {}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(tt.fsys); err == nil {
+				t.Error("got nil error; want error")
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	migrations := []Migration{{Version: 1}, {Version: 2}, {Version: 3}}
+
+	tests := []struct {
+		name    string
+		applied []int
+		want    Drift
+		ahead   bool
+		behind  bool
+	}{
+		{name: "Up to date", applied: []int{1, 2, 3}, want: Drift{Database: 3, Embedded: 3}},
+		{name: "Never migrated", applied: []int{}, want: Drift{Embedded: 3, Pending: []int{1, 2, 3}}, behind: true},
+		{name: "Behind", applied: []int{1}, want: Drift{Database: 1, Embedded: 3, Pending: []int{2, 3}}, behind: true},
+		{name: "Ahead", applied: []int{1, 2, 3, 4}, want: Drift{Database: 4, Embedded: 3, Unknown: []int{4}}, ahead: true},
+		{name: "Skipped", applied: []int{1, 3}, want: Drift{Database: 3, Embedded: 3, Pending: []int{2}}, behind: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := compare(migrations, tt.applied)
+			assert.DeepEqual(t, got, tt.want)
+			assert.Equal(t, got.Ahead(), tt.ahead)
+			assert.Equal(t, got.Behind(), tt.behind)
+		})
+	}
+}
+
+func TestDriftString(t *testing.T) {
+	assert.Equal(t, Drift{Database: 3, Embedded: 3}.String(), "database is up to date at version 3")
+	assert.Equal(t, Drift{Database: 1, Embedded: 3, Pending: []int{2, 3}}.String(),
+		"database at version 1 is behind the embedded migrations (version 3): [2 3] are pending")
+	assert.Equal(t, Drift{Database: 4, Embedded: 3, Unknown: []int{4}}.String(),
+		"database at version 4 is ahead of the embedded migrations (version 3): [4] aren't embedded")
+}
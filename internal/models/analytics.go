@@ -0,0 +1,176 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =============================================================================
+// Page Analytics - Type Definitions
+// =============================================================================
+// Page views are counted per day, page and class of referrer, and nothing
+// else is kept: no addresses, cookies or user IDs, so the counts can't be
+// tied back to a visitor.
+
+// Referrer classes of a page view
+const (
+	ReferrerDirect   = "direct"   // No referrer, such as a bookmark
+	ReferrerInternal = "internal" // Another page of the site
+	ReferrerSearch   = "search"   // A search engine
+	ReferrerSocial   = "social"   // A social network or link aggregator
+	ReferrerOther    = "other"    // Any other site
+)
+
+// PageViews is the number of views of a page
+type PageViews struct {
+	Page  string // Route pattern, such as /snippet/view/:id
+	Views int
+}
+
+// DailyViews is the number of page views on one day
+type DailyViews struct {
+	Day   time.Time
+	Views int
+}
+
+// ReferrerViews is the number of page views from one class of referrer
+type ReferrerViews struct {
+	Referrer string // One of the Referrer classes
+	Views    int
+}
+
+// AnalyticsModelInterface defines the interface for page analytics
+type AnalyticsModelInterface interface {
+	Record(ctx context.Context, page, referrer string) error
+	Pages(days int) ([]*PageViews, error)
+	Daily(days int, page string) ([]*DailyViews, error)
+	Referrers(days int) ([]*ReferrerViews, error)
+}
+
+// AnalyticsModel wraps a database connection pool
+type AnalyticsModel struct {
+	DB *pgxpool.Pool
+}
+
+// =============================================================================
+// Page Analytics - Methods
+// =============================================================================
+
+// Record counts one view of page, reached from referrer, towards today's
+// total
+func (m *AnalyticsModel) Record(ctx context.Context, page, referrer string) error {
+	stmt := `INSERT INTO page_views (day, page, referrer, views)
+             VALUES (CURRENT_DATE, $1, $2, 1)
+             ON CONFLICT (day, page, referrer) DO UPDATE SET views = page_views.views + 1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, stmt, page, referrer)
+	return err
+}
+
+// Pages returns the views of each page over the last days days (including
+// today), most viewed first
+func (m *AnalyticsModel) Pages(days int) ([]*PageViews, error) {
+	stmt := `SELECT page, SUM(views) AS total
+             FROM page_views
+             WHERE day > CURRENT_DATE - $1::int
+             GROUP BY page
+             ORDER BY total DESC, page`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, stmt, days)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pages := []*PageViews{}
+	for rows.Next() {
+		p := &PageViews{}
+		if err = rows.Scan(&p.Page, &p.Views); err != nil {
+			return nil, err
+		}
+		pages = append(pages, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pages, nil
+}
+
+// Daily returns the views of page on each of the last days days, today
+// included, oldest first. Days without views are included with zero. An
+// empty page counts the views of every page.
+func (m *AnalyticsModel) Daily(days int, page string) ([]*DailyViews, error) {
+	stmt := `SELECT d.day,
+                    COALESCE((SELECT SUM(v.views) FROM page_views v
+                              WHERE v.day = d.day AND ($2 = '' OR v.page = $2)), 0)
+             FROM (SELECT CURRENT_DATE - n AS day FROM generate_series(0, $1::int - 1) n) d
+             ORDER BY d.day`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, stmt, days, page)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	daily := []*DailyViews{}
+	for rows.Next() {
+		d := &DailyViews{}
+		if err = rows.Scan(&d.Day, &d.Views); err != nil {
+			return nil, err
+		}
+		daily = append(daily, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return daily, nil
+}
+
+// Referrers returns the views from each class of referrer over the last
+// days days (including today), most views first
+func (m *AnalyticsModel) Referrers(days int) ([]*ReferrerViews, error) {
+	stmt := `SELECT referrer, SUM(views) AS total
+             FROM page_views
+             WHERE day > CURRENT_DATE - $1::int
+             GROUP BY referrer
+             ORDER BY total DESC, referrer`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, stmt, days)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	referrers := []*ReferrerViews{}
+	for rows.Next() {
+		r := &ReferrerViews{}
+		if err = rows.Scan(&r.Referrer, &r.Views); err != nil {
+			return nil, err
+		}
+		referrers = append(referrers, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return referrers, nil
+}
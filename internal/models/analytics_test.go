@@ -0,0 +1,49 @@
+package models
+
+import (
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+)
+
+func TestAnalyticsModel(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	m := AnalyticsModel{DB: db}
+
+	views := []struct{ page, referrer string }{
+		{"/snippet/view/:id", ReferrerSearch},
+		{"/snippet/view/:id", ReferrerSearch},
+		{"/snippet/view/:id", ReferrerDirect},
+		{"/", ReferrerInternal},
+	}
+	for _, v := range views {
+		assert.NilError(t, m.Record(t.Context(), v.page, v.referrer))
+	}
+
+	pages, err := m.Pages(7)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, pages, []*PageViews{
+		{Page: "/snippet/view/:id", Views: 3},
+		{Page: "/", Views: 1},
+	})
+
+	referrers, err := m.Referrers(7)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, referrers, []*ReferrerViews{
+		{Referrer: ReferrerSearch, Views: 2},
+		{Referrer: ReferrerDirect, Views: 1},
+		{Referrer: ReferrerInternal, Views: 1},
+	})
+
+	daily, err := m.Daily(3, "")
+	assert.NilError(t, err)
+	assert.Equal(t, len(daily), 3)
+	assert.Equal(t, daily[0].Views, 0)
+	assert.Equal(t, daily[2].Views, 4)
+
+	daily, err = m.Daily(3, "/")
+	assert.NilError(t, err)
+	assert.Equal(t, daily[2].Views, 1)
+}
@@ -0,0 +1,195 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =============================================================================
+// Announcement Model - Type Definitions
+// =============================================================================
+
+// Announcement levels, from least to most severe
+const (
+	AnnouncementInfo     = "info"
+	AnnouncementWarning  = "warning"
+	AnnouncementCritical = "critical"
+)
+
+// AnnouncementLevels are the levels an announcement can have, from least to
+// most severe
+var AnnouncementLevels = []string{AnnouncementInfo, AnnouncementWarning, AnnouncementCritical}
+
+// Announcement is a site-wide banner shown between Starts and Ends
+type Announcement struct {
+	ID        int
+	Message   string
+	Level     string // One of AnnouncementLevels
+	Starts    time.Time
+	Ends      time.Time // Zero if the banner shows until it is deleted
+	Created   time.Time
+	CreatedBy string // Name of the admin who added the banner, if known
+}
+
+// Active reports whether the banner is shown at t
+func (a *Announcement) Active(t time.Time) bool {
+	return !a.Starts.After(t) && (a.Ends.IsZero() || a.Ends.After(t))
+}
+
+// AnnouncementModelInterface defines the interface for announcement operations
+type AnnouncementModelInterface interface {
+	Insert(a *Announcement, createdBy int) (int, error)
+	Get(id int) (*Announcement, error)
+	Update(a *Announcement) error
+	Delete(id int) error
+	Current() ([]*Announcement, error)
+}
+
+// AnnouncementModel wraps a database connection pool
+type AnnouncementModel struct {
+	DB *pgxpool.Pool
+}
+
+// =============================================================================
+// Announcement Model - Methods
+// =============================================================================
+
+// announcementColumns are the columns scanned by scanAnnouncement
+const announcementColumns = `a.id, a.message, a.level, a.starts, a.ends, a.created, COALESCE(u.name, '')`
+
+// Insert adds an announcement. Returns its ID.
+func (m *AnnouncementModel) Insert(a *Announcement, createdBy int) (int, error) {
+	stmt := `INSERT INTO announcements (message, level, starts, ends, created, created_by)
+             VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP, $5)
+             RETURNING id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int
+	err := m.DB.QueryRow(ctx, stmt, a.Message, a.Level, a.Starts.UTC(), nullTime(a.Ends), createdBy).Scan(&id)
+	if err != nil {
+		return 0, translateError(err)
+	}
+
+	return id, nil
+}
+
+// Get returns an announcement. Returns ErrNoRecord if there is no such
+// announcement.
+func (m *AnnouncementModel) Get(id int) (*Announcement, error) {
+	stmt := `SELECT ` + announcementColumns + `
+             FROM announcements a
+             LEFT JOIN users u ON u.id = a.created_by
+             WHERE a.id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	a, err := scanAnnouncement(m.DB.QueryRow(ctx, stmt, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, notFound("announcement", id)
+		}
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Update changes an announcement's message, level and times. Returns
+// ErrNoRecord if there is no such announcement.
+func (m *AnnouncementModel) Update(a *Announcement) error {
+	stmt := `UPDATE announcements SET message = $2, level = $3, starts = $4, ends = $5
+             WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tag, err := m.DB.Exec(ctx, stmt, a.ID, a.Message, a.Level, a.Starts.UTC(), nullTime(a.Ends))
+	if err != nil {
+		return translateError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("announcement", a.ID)
+	}
+
+	return nil
+}
+
+// Delete removes an announcement. Returns ErrNoRecord if there is no such
+// announcement.
+func (m *AnnouncementModel) Delete(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tag, err := m.DB.Exec(ctx, "DELETE FROM announcements WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("announcement", id)
+	}
+
+	return nil
+}
+
+// Current returns the announcements that haven't ended, including scheduled
+// ones, in the order they start
+func (m *AnnouncementModel) Current() ([]*Announcement, error) {
+	stmt := `SELECT ` + announcementColumns + `
+             FROM announcements a
+             LEFT JOIN users u ON u.id = a.created_by
+             WHERE a.ends IS NULL OR a.ends > CURRENT_TIMESTAMP
+             ORDER BY a.starts, a.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	announcements := []*Announcement{}
+	for rows.Next() {
+		a, err := scanAnnouncement(rows)
+		if err != nil {
+			return nil, err
+		}
+		announcements = append(announcements, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return announcements, nil
+}
+
+// scanAnnouncement scans a row of announcementColumns
+func scanAnnouncement(row pgx.Row) (*Announcement, error) {
+	a := &Announcement{}
+	var ends *time.Time
+	err := row.Scan(&a.ID, &a.Message, &a.Level, &a.Starts, &ends, &a.Created, &a.CreatedBy)
+	if err != nil {
+		return nil, err
+	}
+	if ends != nil {
+		a.Ends = *ends
+	}
+	return a, nil
+}
+
+// nullTime returns t in UTC, or nil for NULL if t is zero
+func nullTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC()
+}
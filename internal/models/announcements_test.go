@@ -0,0 +1,56 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestAnnouncementModel(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users")
+	m := AnnouncementModel{DB: db}
+
+	now := time.Now().UTC().Truncate(time.Minute)
+	id, err := m.Insert(&Announcement{Message: "Maintenance", Level: AnnouncementWarning, Starts: now.Add(time.Hour), Ends: now.Add(2 * time.Hour)}, 3)
+	assert.NilError(t, err)
+
+	_, err = m.Insert(&Announcement{Message: "Search is degraded", Level: AnnouncementInfo, Starts: now.Add(-time.Hour)}, 3)
+	assert.NilError(t, err)
+
+	// Ended announcements are left out
+	_, err = db.Exec(context.Background(), `INSERT INTO announcements (message, level, starts, ends, created)
+	VALUES ('Old', 'info', CURRENT_TIMESTAMP - INTERVAL '2 hours', CURRENT_TIMESTAMP - INTERVAL '1 minute', CURRENT_TIMESTAMP)`)
+	assert.NilError(t, err)
+
+	current, err := m.Current()
+	assert.NilError(t, err)
+	assert.Equal(t, len(current), 2)
+	assert.Equal(t, current[0].Message, "Search is degraded")
+	assert.Equal(t, current[0].Ends.IsZero(), true)
+	assert.Equal(t, current[1].ID, id)
+
+	a, err := m.Get(id)
+	assert.NilError(t, err)
+	assert.Equal(t, a.Starts, now.Add(time.Hour))
+	assert.Equal(t, a.CreatedBy, "Carol Admin")
+
+	a.Message = "Maintenance moved"
+	a.Ends = time.Time{}
+	assert.NilError(t, m.Update(a))
+	a, err = m.Get(id)
+	assert.NilError(t, err)
+	assert.Equal(t, a.Message, "Maintenance moved")
+	assert.Equal(t, a.Ends.IsZero(), true)
+
+	assert.NilError(t, m.Delete(id))
+	assert.ErrorIs(t, m.Delete(id), ErrNoRecord)
+	_, err = m.Get(id)
+	assert.ErrorIs(t, err, ErrNoRecord)
+	assert.ErrorIs(t, m.Update(a), ErrNoRecord)
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =============================================================================
+// Attachment Model - Type Definitions
+// =============================================================================
+
+// Attachment is a file attached to a snippet, kept in the object store
+type Attachment struct {
+	ID          int
+	SnippetID   int
+	Key         string // Object store key
+	Filename    string
+	ContentType string
+	Size        int64
+	Created     time.Time
+}
+
+// AttachmentModelInterface defines the interface for attachment operations
+type AttachmentModelInterface interface {
+	Insert(snippetID int, key, filename, contentType string, size int64) (int, error)
+	Get(id int) (*Attachment, error)
+	ForSnippet(snippetID int) ([]Attachment, error)
+	Delete(id int) error
+}
+
+// AttachmentModel wraps a database connection pool
+type AttachmentModel struct {
+	DB *pgxpool.Pool
+}
+
+// =============================================================================
+// Attachment Model - Methods
+// =============================================================================
+
+// Insert records a file uploaded to the object store under key and returns
+// its ID
+func (m *AttachmentModel) Insert(snippetID int, key, filename, contentType string, size int64) (int, error) {
+	stmt := `INSERT INTO attachments (snippet_id, object_key, filename, content_type, size, created)
+             VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)
+             RETURNING id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int
+	err := m.DB.QueryRow(ctx, stmt, snippetID, key, filename, contentType, size).Scan(&id)
+	return id, err
+}
+
+// Get returns an attachment. Returns ErrNoRecord if there is none with the
+// ID.
+func (m *AttachmentModel) Get(id int) (*Attachment, error) {
+	stmt := `SELECT id, snippet_id, object_key, filename, content_type, size, created
+             FROM attachments
+             WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	a := &Attachment{}
+	err := m.DB.QueryRow(ctx, stmt, id).Scan(&a.ID, &a.SnippetID, &a.Key, &a.Filename, &a.ContentType, &a.Size, &a.Created)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, notFound("attachment", id)
+		}
+		return nil, err
+	}
+	return a, nil
+}
+
+// ForSnippet returns a snippet's attachments, oldest first
+func (m *AttachmentModel) ForSnippet(snippetID int) ([]Attachment, error) {
+	stmt := `SELECT id, snippet_id, object_key, filename, content_type, size, created
+             FROM attachments
+             WHERE snippet_id = $1
+             ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, stmt, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []Attachment{}
+	for rows.Next() {
+		var a Attachment
+		err = rows.Scan(&a.ID, &a.SnippetID, &a.Key, &a.Filename, &a.ContentType, &a.Size, &a.Created)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
+
+// Delete removes an attachment's record; its file is left to the caller.
+// Returns ErrNoRecord if there is none with the ID.
+func (m *AttachmentModel) Delete(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tag, err := m.DB.Exec(ctx, "DELETE FROM attachments WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("attachment", id)
+	}
+	return nil
+}
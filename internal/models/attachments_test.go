@@ -0,0 +1,48 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestAttachmentModel(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users", "snippets")
+	m := AttachmentModel{DB: db}
+
+	_, err := m.Get(1)
+	var nf *NotFoundError
+	assert.Equal(t, errors.As(err, &nf), true)
+	assert.Equal(t, nf.Resource, "attachment")
+
+	first, err := m.Insert(1, "snippets/1/a", "pond.png", "image/png", 2048)
+	assert.NilError(t, err)
+	second, err := m.Insert(1, "snippets/1/b", "build.log", "text/plain", 12)
+	assert.NilError(t, err)
+
+	// Keys are unique
+	_, err = m.Insert(2, "snippets/1/a", "copy.png", "image/png", 2048)
+	assert.Equal(t, err != nil, true)
+
+	a, err := m.Get(first)
+	assert.NilError(t, err)
+	assert.Equal(t, a.Filename, "pond.png")
+	assert.Equal(t, a.Size, int64(2048))
+
+	attachments, err := m.ForSnippet(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(attachments), 2)
+	assert.Equal(t, attachments[1].ID, second)
+
+	assert.NilError(t, m.Delete(first))
+	assert.Equal(t, errors.Is(m.Delete(first), ErrNoRecord), true)
+
+	attachments, err = m.ForSnippet(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(attachments), 1)
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =============================================================================
+// Audit Log - Type Definitions
+// =============================================================================
+
+// Audit actions
+const (
+	AuditSnippetApprove     = "snippet.approve"
+	AuditSnippetRemove      = "snippet.remove"
+	AuditUserBan            = "user.ban"
+	AuditUserTier           = "user.tier"
+	AuditIPBan              = "ip.ban"
+	AuditIPUnban            = "ip.unban"
+	AuditBackup             = "backup.create"
+	AuditAnnouncementAdd    = "announcement.add"
+	AuditAnnouncementEdit   = "announcement.edit"
+	AuditAnnouncementDelete = "announcement.delete"
+	AuditMaintenance        = "maintenance.run"
+	AuditReportExport       = "report.export"
+	AuditDataExport         = "data.export"
+	AuditLogSettings        = "log.settings"
+)
+
+// AuditEntry records one moderation or admin action
+type AuditEntry struct {
+	ID      int
+	Actor   string // Name of the user who acted, if they still exist
+	Action  string // One of the Audit* constants
+	Target  string // What was acted on, e.g. "snippet:42"
+	Detail  string
+	Created time.Time
+}
+
+// AuditModelInterface defines the interface for audit log operations
+type AuditModelInterface interface {
+	Record(actorID int, action, target, detail string) error
+	Recent(limit int) ([]*AuditEntry, error)
+	ForTarget(target string, limit int) ([]*AuditEntry, error)
+}
+
+// AuditModel wraps a database connection pool
+type AuditModel struct {
+	DB *pgxpool.Pool
+}
+
+// =============================================================================
+// Audit Log - Methods
+// =============================================================================
+
+// Record appends an entry to the audit log
+func (m *AuditModel) Record(actorID int, action, target, detail string) error {
+	stmt := `INSERT INTO audit_log (actor_id, action, target, detail, created)
+             VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, stmt, actorID, action, target, detail)
+	return err
+}
+
+// Recent returns the latest limit entries, newest first
+func (m *AuditModel) Recent(limit int) ([]*AuditEntry, error) {
+	stmt := `SELECT a.id, COALESCE(u.name, ''), a.action, a.target, a.detail, a.created
+             FROM audit_log a
+             LEFT JOIN users u ON u.id = a.actor_id
+             ORDER BY a.id DESC
+             LIMIT $1`
+
+	return m.query(stmt, limit)
+}
+
+// ForTarget returns the latest limit entries about target (e.g.
+// "snippet:42"), newest first
+func (m *AuditModel) ForTarget(target string, limit int) ([]*AuditEntry, error) {
+	stmt := `SELECT a.id, COALESCE(u.name, ''), a.action, a.target, a.detail, a.created
+             FROM audit_log a
+             LEFT JOIN users u ON u.id = a.actor_id
+             WHERE a.target = $1
+             ORDER BY a.id DESC
+             LIMIT $2`
+
+	return m.query(stmt, target, limit)
+}
+
+// query runs stmt and scans the entries it selects
+func (m *AuditModel) query(stmt string, args ...any) ([]*AuditEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*AuditEntry{}
+	for rows.Next() {
+		e := &AuditEntry{}
+		err = rows.Scan(&e.ID, &e.Actor, &e.Action, &e.Target, &e.Detail, &e.Created)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =============================================================================
+// Avatar Model - Type Definitions
+// =============================================================================
+
+// Avatar records that a user uploaded an avatar
+type Avatar struct {
+	UserID  int
+	Version int // Goes up with each upload
+	Updated time.Time
+}
+
+// AvatarModelInterface defines the interface for avatar operations
+type AvatarModelInterface interface {
+	Get(userID int) (*Avatar, error)
+	Set(userID, version int) error
+	Delete(userID int) error
+}
+
+// AvatarModel wraps a database connection pool
+type AvatarModel struct {
+	DB *pgxpool.Pool
+}
+
+// =============================================================================
+// Avatar Model - Methods
+// =============================================================================
+
+// Get returns a user's avatar. Returns ErrNoRecord if they haven't
+// uploaded one.
+func (m *AvatarModel) Get(userID int) (*Avatar, error) {
+	stmt := `SELECT user_id, version, updated FROM avatars WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	a := &Avatar{}
+	err := m.DB.QueryRow(ctx, stmt, userID).Scan(&a.UserID, &a.Version, &a.Updated)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, notFound("avatar", userID)
+		}
+		return nil, err
+	}
+	return a, nil
+}
+
+// Set records that a version of a user's avatar has been stored,
+// replacing the one they had
+func (m *AvatarModel) Set(userID, version int) error {
+	stmt := `INSERT INTO avatars (user_id, version, updated)
+             VALUES ($1, $2, CURRENT_TIMESTAMP)
+             ON CONFLICT (user_id) DO UPDATE
+             SET version = EXCLUDED.version, updated = EXCLUDED.updated`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, stmt, userID, version)
+	return err
+}
+
+// Delete removes a user's avatar. Returns ErrNoRecord if they had none.
+func (m *AvatarModel) Delete(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tag, err := m.DB.Exec(ctx, "DELETE FROM avatars WHERE user_id = $1", userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("avatar", userID)
+	}
+	return nil
+}
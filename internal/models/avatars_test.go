@@ -0,0 +1,30 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestAvatarModel(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users")
+	m := AvatarModel{DB: db}
+
+	_, err := m.Get(1)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	assert.NilError(t, m.Set(1, 1))
+	assert.NilError(t, m.Set(1, 2))
+
+	a, err := m.Get(1)
+	assert.NilError(t, err)
+	assert.Equal(t, a.Version, 2)
+
+	assert.NilError(t, m.Delete(1))
+	assert.Equal(t, errors.Is(m.Delete(1), ErrNoRecord), true)
+}
@@ -0,0 +1,618 @@
+package models
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =============================================================================
+// Backup Model - Type Definitions
+// =============================================================================
+// A backup archive is newline-delimited JSON. The first line is a header
+// naming the format and its version. Each following line is a record with
+// a type and its data: users first, then snippets with their tags, then
+// the rows referring to them. The last line is an "end" record counting
+// the records before it, so a truncated archive is caught before anything
+// is restored.
+//
+// Operational data is left out: sessions, queued jobs, notifications,
+// reports, bans, the audit log and snippet change history.
+
+// backupFormat names the archive format in the header
+const backupFormat = "snippetbox-backup"
+
+// BackupVersion is the archive version Export writes. Restore reads this
+// version and older ones.
+const BackupVersion = 1
+
+// backupTimeout bounds a whole export or restore, which read or write
+// every row
+const backupTimeout = 10 * time.Minute
+
+// maxBackupLine is the longest line read from an archive: a snippet with
+// its content escaped
+const maxBackupLine = 16 << 20
+
+// Record types in a backup archive
+const (
+	backupUserRecord       = "user"
+	backupSnippetRecord    = "snippet"
+	backupViewRecord       = "view"
+	backupFollowRecord     = "follow"
+	backupPreferenceRecord = "preference"
+	backupQuotaRecord      = "quota"
+	backupEndRecord        = "end"
+)
+
+var (
+	// ErrInvalidBackup is wrapped by the errors describing why an archive
+	// can't be restored
+	ErrInvalidBackup = errors.New("models: invalid backup archive")
+
+	// ErrRestoreNotEmpty is returned when restoring into a database that
+	// already has users or snippets
+	ErrRestoreNotEmpty = errors.New("models: can only restore into an empty database")
+)
+
+// BackupStats counts the records of each type in a backup archive
+type BackupStats struct {
+	Users       int
+	Snippets    int
+	Views       int // Days of view counts
+	Follows     int
+	Preferences int // Notification preferences
+	Quotas      int // Per-user snippet quotas
+}
+
+// records returns how many records the counts add up to
+func (s BackupStats) records() int {
+	return s.Users + s.Snippets + s.Views + s.Follows + s.Preferences + s.Quotas
+}
+
+// BackupModelInterface defines the interface for exporting backups
+type BackupModelInterface interface {
+	Export(w io.Writer, passwords bool) (BackupStats, error)
+}
+
+// BackupModel wraps a database connection pool. Keys are those content
+// sealed at rest must have been sealed with to be restored.
+type BackupModel struct {
+	DB   *pgxpool.Pool
+	Keys *ContentKeys
+}
+
+// backupHeader is the first line of an archive
+type backupHeader struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	Created   time.Time `json:"created"`
+	Passwords bool      `json:"passwords"` // Whether users' password hashes are included
+}
+
+// backupRecord is a line of an archive after the header. Data is decoded
+// according to Type.
+type backupRecord struct {
+	Type string `json:"type"`
+	Data any    `json:"data"`
+}
+
+// backupUser is a user record. The columns are in the order Export selects
+// them.
+type backupUser struct {
+	ID             int       `json:"id"`
+	Name           string    `json:"name"`
+	Email          string    `json:"email"`
+	HashedPassword string    `json:"hashed_password,omitempty"`   // Empty if left out
+	Peppered       bool      `json:"password_peppered,omitempty"` // Hashed with the pepper
+	Created        time.Time `json:"created"`
+	Locale         string    `json:"locale"`
+	Theme          string    `json:"theme"`
+	Role           string    `json:"role"`
+	Tier           string    `json:"tier"`
+	Banned         bool      `json:"banned"`
+	Active         bool      `json:"active"`
+	SAMLSubject    *string   `json:"saml_subject,omitempty"`
+}
+
+// backupSnippet is a snippet record. Content sealed at rest stays sealed,
+// with the ID of its key.
+type backupSnippet struct {
+	ID           int         `json:"id"`
+	UserID       *int        `json:"user_id,omitempty"`
+	CreatorIP    *netip.Addr `json:"creator_ip,omitempty"`
+	Title        string      `json:"title"`
+	Content      string      `json:"content"`
+	ContentKey   *string     `json:"content_key,omitempty"`
+	Created      time.Time   `json:"created"`
+	Expires      time.Time   `json:"expires"`
+	Held         bool        `json:"held"`
+	Private      bool        `json:"private"`
+	Encrypted    bool        `json:"encrypted"`
+	ShareVersion int         `json:"share_version"`
+	Language     string      `json:"language,omitempty"`
+	Source       string      `json:"source,omitempty"`
+	Tags         []string    `json:"tags,omitempty"`
+}
+
+// backupView is a snippet's view count on a day
+type backupView struct {
+	SnippetID int       `json:"snippet_id"`
+	Day       time.Time `json:"day"`
+	Views     int       `json:"views"`
+}
+
+// backupFollow is a user following another
+type backupFollow struct {
+	FollowerID int       `json:"follower_id"`
+	FollowedID int       `json:"followed_id"`
+	Created    time.Time `json:"created"`
+}
+
+// backupPreference is a user's notification preference
+type backupPreference struct {
+	UserID  int    `json:"user_id"`
+	Kind    string `json:"kind"`
+	Enabled bool   `json:"enabled"`
+}
+
+// backupQuota is a user's own snippet quota
+type backupQuota struct {
+	UserID  int `json:"user_id"`
+	PerHour int `json:"per_hour"`
+	Total   int `json:"total"`
+}
+
+// backupEnd is the last record, counting the records before it
+type backupEnd struct {
+	Records int `json:"records"`
+}
+
+// =============================================================================
+// Backup Model - Methods
+// =============================================================================
+
+// Export writes an archive of the database to w, with users' password
+// hashes unless passwords is false. It reads a single snapshot, so the
+// archive is consistent while the site stays up.
+func (m *BackupModel) Export(w io.Writer, passwords bool) (BackupStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), backupTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return BackupStats{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+
+	err = enc.Encode(backupHeader{Format: backupFormat, Version: BackupVersion, Created: time.Now().UTC(), Passwords: passwords})
+	if err != nil {
+		return BackupStats{}, err
+	}
+
+	var stats BackupStats
+	stats.Users, err = exportRows[backupUser](ctx, tx, enc, backupUserRecord,
+		`SELECT id, name, email, CASE WHEN $1::boolean THEN hashed_password ELSE '' END,
+                $1::boolean AND password_peppered, created, locale, theme, role, tier, banned, active, saml_subject
+         FROM users
+         ORDER BY id`, passwords)
+	if err != nil {
+		return BackupStats{}, err
+	}
+
+	stats.Snippets, err = exportRows[backupSnippet](ctx, tx, enc, backupSnippetRecord,
+		`SELECT s.id, s.user_id, s.creator_ip, s.title, s.content, s.content_key, s.created, s.expires,
+                s.held, s.private, s.encrypted, s.share_version, s.language, s.source,
+                COALESCE((SELECT array_agg(t.tag ORDER BY t.tag) FROM snippet_tags t WHERE t.snippet_id = s.id), '{}')
+         FROM snippets s
+         ORDER BY s.id`)
+	if err != nil {
+		return BackupStats{}, err
+	}
+
+	stats.Views, err = exportRows[backupView](ctx, tx, enc, backupViewRecord,
+		"SELECT snippet_id, day, views FROM snippet_views ORDER BY snippet_id, day")
+	if err != nil {
+		return BackupStats{}, err
+	}
+
+	stats.Follows, err = exportRows[backupFollow](ctx, tx, enc, backupFollowRecord,
+		"SELECT follower_id, followed_id, created FROM follows ORDER BY follower_id, followed_id")
+	if err != nil {
+		return BackupStats{}, err
+	}
+
+	stats.Preferences, err = exportRows[backupPreference](ctx, tx, enc, backupPreferenceRecord,
+		"SELECT user_id, kind, enabled FROM notification_preferences ORDER BY user_id, kind")
+	if err != nil {
+		return BackupStats{}, err
+	}
+
+	stats.Quotas, err = exportRows[backupQuota](ctx, tx, enc, backupQuotaRecord,
+		"SELECT user_id, per_hour, total FROM snippet_quotas ORDER BY user_id")
+	if err != nil {
+		return BackupStats{}, err
+	}
+
+	err = enc.Encode(backupRecord{Type: backupEndRecord, Data: backupEnd{Records: stats.records()}})
+	if err != nil {
+		return BackupStats{}, err
+	}
+	if err = bw.Flush(); err != nil {
+		return BackupStats{}, err
+	}
+
+	return stats, nil
+}
+
+// exportRows writes a record of type typ for each row stmt returns, with
+// the columns in the order of T's fields, and returns how many it wrote
+func exportRows[T any](ctx context.Context, tx pgx.Tx, enc *json.Encoder, typ, stmt string, args ...any) (int, error) {
+	rows, err := tx.Query(ctx, stmt, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		v, err := pgx.RowToStructByPos[T](rows)
+		if err != nil {
+			return 0, err
+		}
+		if err = enc.Encode(backupRecord{Type: typ, Data: v}); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// Restore checks an archive read from r and imports it, keeping every ID.
+// Nothing is imported unless the whole archive is valid, and it is
+// imported in a single transaction. The database must have no users or
+// snippets, so run it against a freshly migrated database before the site
+// starts.
+//
+// Users without a password hash get a random password nobody knows, so
+// they have to sign in through single sign-on or reset it. Returns an
+// error wrapping ErrInvalidBackup if the archive is invalid, ErrUnknownKey
+// if content in it is sealed with a key that isn't configured and
+// ErrRestoreNotEmpty if the database has data.
+func (m *BackupModel) Restore(r io.Reader) (BackupStats, error) {
+	a, err := readBackup(r)
+	if err != nil {
+		return BackupStats{}, err
+	}
+
+	for _, s := range a.snippets {
+		if s.ContentKey != nil && !m.Keys.has(*s.ContentKey) {
+			return BackupStats{}, fmt.Errorf("%w: snippet %d is sealed with key %q", ErrUnknownKey, s.ID, *s.ContentKey)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), backupTimeout)
+	defer cancel()
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return BackupStats{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	var exists bool
+	err = tx.QueryRow(ctx, "SELECT EXISTS(SELECT true FROM users) OR EXISTS(SELECT true FROM snippets)").Scan(&exists)
+	if err != nil {
+		return BackupStats{}, err
+	}
+	if exists {
+		return BackupStats{}, ErrRestoreNotEmpty
+	}
+
+	// One unknown password serves every user without a hash; generating
+	// each their own would take a quarter of a second per user
+	var unusable string
+	users := make([][]any, 0, len(a.users))
+	for _, u := range a.users {
+		if u.HashedPassword == "" {
+			if unusable == "" {
+				hash, err := unusablePassword()
+				if err != nil {
+					return BackupStats{}, err
+				}
+				unusable = string(hash)
+			}
+			u.HashedPassword = unusable
+		}
+		users = append(users, []any{u.ID, u.Name, u.Email, u.HashedPassword, u.Peppered, u.Created, u.Locale, u.Theme, u.Role, u.Tier, u.Banned, u.Active, u.SAMLSubject})
+	}
+
+	snippets := make([][]any, 0, len(a.snippets))
+	tags := [][]any{}
+	for _, s := range a.snippets {
+		snippets = append(snippets, []any{s.ID, s.UserID, s.CreatorIP, s.Title, s.Content, s.ContentKey, s.Created, s.Expires, s.Held, s.Private, s.Encrypted, s.ShareVersion, s.Language, s.Source})
+		for _, tag := range s.Tags {
+			tags = append(tags, []any{s.ID, tag})
+		}
+	}
+
+	views := make([][]any, 0, len(a.views))
+	for _, v := range a.views {
+		views = append(views, []any{v.SnippetID, v.Day, v.Views})
+	}
+	follows := make([][]any, 0, len(a.follows))
+	for _, f := range a.follows {
+		follows = append(follows, []any{f.FollowerID, f.FollowedID, f.Created})
+	}
+	preferences := make([][]any, 0, len(a.preferences))
+	for _, p := range a.preferences {
+		preferences = append(preferences, []any{p.UserID, p.Kind, p.Enabled})
+	}
+	quotas := make([][]any, 0, len(a.quotas))
+	for _, q := range a.quotas {
+		quotas = append(quotas, []any{q.UserID, q.PerHour, q.Total})
+	}
+
+	tables := []struct {
+		name    string
+		columns []string
+		rows    [][]any
+	}{
+		{"users", []string{"id", "name", "email", "hashed_password", "password_peppered", "created", "locale", "theme", "role", "tier", "banned", "active", "saml_subject"}, users},
+		{"snippets", []string{"id", "user_id", "creator_ip", "title", "content", "content_key", "created", "expires", "held", "private", "encrypted", "share_version", "language", "source"}, snippets},
+		{"snippet_tags", []string{"snippet_id", "tag"}, tags},
+		{"snippet_views", []string{"snippet_id", "day", "views"}, views},
+		{"follows", []string{"follower_id", "followed_id", "created"}, follows},
+		{"notification_preferences", []string{"user_id", "kind", "enabled"}, preferences},
+		{"snippet_quotas", []string{"user_id", "per_hour", "total"}, quotas},
+	}
+	for _, t := range tables {
+		_, err = tx.CopyFrom(ctx, pgx.Identifier{t.name}, t.columns, pgx.CopyFromRows(t.rows))
+		if err != nil {
+			return BackupStats{}, fmt.Errorf("restoring %s: %w", t.name, err)
+		}
+	}
+
+	// New rows carry on numbering after the restored ones
+	for _, table := range []string{"users", "snippets"} {
+		stmt := fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM %[1]s", table)
+		if _, err = tx.Exec(ctx, stmt); err != nil {
+			return BackupStats{}, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return BackupStats{}, err
+	}
+	return a.stats(), nil
+}
+
+// ValidateBackup checks an archive read from r without restoring it, and
+// counts its records. Returns an error wrapping ErrInvalidBackup if the
+// archive is invalid.
+func ValidateBackup(r io.Reader) (BackupStats, error) {
+	a, err := readBackup(r)
+	if err != nil {
+		return BackupStats{}, err
+	}
+	return a.stats(), nil
+}
+
+// =============================================================================
+// Backup Archive Reading
+// =============================================================================
+
+// backupArchive is the contents of a valid archive
+type backupArchive struct {
+	header      backupHeader
+	users       []backupUser
+	snippets    []backupSnippet
+	views       []backupView
+	follows     []backupFollow
+	preferences []backupPreference
+	quotas      []backupQuota
+}
+
+// stats counts the archive's records
+func (a *backupArchive) stats() BackupStats {
+	return BackupStats{
+		Users:       len(a.users),
+		Snippets:    len(a.snippets),
+		Views:       len(a.views),
+		Follows:     len(a.follows),
+		Preferences: len(a.preferences),
+		Quotas:      len(a.quotas),
+	}
+}
+
+// readBackup reads and checks a whole archive. Besides the format, it
+// checks that IDs and email addresses are unique and that every record
+// refers to a user or snippet before it.
+func readBackup(r io.Reader) (*backupArchive, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, maxBackupLine)
+
+	line := 0
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: line %d: %s", ErrInvalidBackup, line, fmt.Sprintf(format, args...))
+	}
+
+	a := &backupArchive{}
+	users := map[int]bool{}
+	emails := map[string]bool{}
+	snippets := map[int]bool{}
+	ended := false
+
+	for sc.Scan() {
+		line++
+
+		if line == 1 {
+			if err := decodeBackupLine(sc.Bytes(), &a.header); err != nil {
+				return nil, invalid("header: %v", err)
+			}
+			if a.header.Format != backupFormat {
+				return nil, invalid("not a backup archive")
+			}
+			if a.header.Version < 1 || a.header.Version > BackupVersion {
+				return nil, invalid("unsupported version %d", a.header.Version)
+			}
+			continue
+		}
+		if ended {
+			return nil, invalid("data after the end record")
+		}
+
+		var rec struct {
+			Type string          `json:"type"`
+			Data json.RawMessage `json:"data"`
+		}
+		if err := decodeBackupLine(sc.Bytes(), &rec); err != nil {
+			return nil, invalid("%v", err)
+		}
+
+		var err error
+		switch rec.Type {
+		case backupUserRecord:
+			var u backupUser
+			if err = decodeBackupLine(rec.Data, &u); err != nil {
+				break
+			}
+			switch {
+			case u.ID < 1 || users[u.ID]:
+				return nil, invalid("user ID %d is invalid or repeated", u.ID)
+			case strings.TrimSpace(u.Email) == "" || emails[u.Email]:
+				return nil, invalid("user %d has a missing or repeated email address", u.ID)
+			case !slices.Contains([]string{RoleUser, RoleModerator, RoleAdmin}, u.Role):
+				return nil, invalid("user %d has unknown role %q", u.ID, u.Role)
+			case u.Tier == "":
+				return nil, invalid("user %d has no tier", u.ID)
+			case u.HashedPassword != "" && (len(u.HashedPassword) != 60 || !strings.HasPrefix(u.HashedPassword, "$2")):
+				return nil, invalid("user %d has an invalid password hash", u.ID)
+			case u.Peppered && u.HashedPassword == "":
+				return nil, invalid("user %d has a peppered password but no hash", u.ID)
+			}
+			users[u.ID], emails[u.Email] = true, true
+			a.users = append(a.users, u)
+
+		case backupSnippetRecord:
+			var s backupSnippet
+			if err = decodeBackupLine(rec.Data, &s); err != nil {
+				break
+			}
+			switch {
+			case s.ID < 1 || snippets[s.ID]:
+				return nil, invalid("snippet ID %d is invalid or repeated", s.ID)
+			case s.UserID != nil && !users[*s.UserID]:
+				return nil, invalid("snippet %d belongs to unknown user %d", s.ID, *s.UserID)
+			case s.Created.IsZero() || s.Expires.IsZero():
+				return nil, invalid("snippet %d has no creation or expiry time", s.ID)
+			}
+			snippets[s.ID] = true
+			a.snippets = append(a.snippets, s)
+
+		case backupViewRecord:
+			var v backupView
+			if err = decodeBackupLine(rec.Data, &v); err != nil {
+				break
+			}
+			if !snippets[v.SnippetID] {
+				return nil, invalid("views of unknown snippet %d", v.SnippetID)
+			}
+			a.views = append(a.views, v)
+
+		case backupFollowRecord:
+			var f backupFollow
+			if err = decodeBackupLine(rec.Data, &f); err != nil {
+				break
+			}
+			if !users[f.FollowerID] || !users[f.FollowedID] || f.FollowerID == f.FollowedID {
+				return nil, invalid("follow of user %d by user %d is invalid", f.FollowedID, f.FollowerID)
+			}
+			a.follows = append(a.follows, f)
+
+		case backupPreferenceRecord:
+			var p backupPreference
+			if err = decodeBackupLine(rec.Data, &p); err != nil {
+				break
+			}
+			if !users[p.UserID] {
+				return nil, invalid("notification preference of unknown user %d", p.UserID)
+			}
+			a.preferences = append(a.preferences, p)
+
+		case backupQuotaRecord:
+			var q backupQuota
+			if err = decodeBackupLine(rec.Data, &q); err != nil {
+				break
+			}
+			if !users[q.UserID] {
+				return nil, invalid("quota of unknown user %d", q.UserID)
+			}
+			a.quotas = append(a.quotas, q)
+
+		case backupEndRecord:
+			var end backupEnd
+			if err = decodeBackupLine(rec.Data, &end); err != nil {
+				break
+			}
+			if n := a.stats().records(); end.Records != n {
+				return nil, invalid("end record counts %d records, found %d", end.Records, n)
+			}
+			ended = true
+
+		default:
+			return nil, invalid("unknown record type %q", rec.Type)
+		}
+		if err != nil {
+			return nil, invalid("%s: %v", rec.Type, err)
+		}
+	}
+
+	if err := sc.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, invalid("line longer than %d bytes", maxBackupLine)
+		}
+		return nil, err
+	}
+	if line == 0 {
+		return nil, invalid("empty archive")
+	}
+	if !ended {
+		return nil, invalid("archive is truncated")
+	}
+
+	return a, nil
+}
+
+// decodeBackupLine decodes a single JSON value, refusing fields v doesn't
+// have
+func decodeBackupLine(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return errors.New("unexpected data after the JSON value")
+	}
+	return nil
+}
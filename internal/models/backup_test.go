@@ -0,0 +1,187 @@
+package models
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+// testBackup builds an archive from its record lines, adding the header
+// and, unless the lines end the archive themselves, the end record
+func testBackup(lines ...string) string {
+	header := `{"format":"snippetbox-backup","version":1,"created":"2026-01-01T00:00:00Z","passwords":false}`
+	if len(lines) == 0 || !strings.Contains(lines[len(lines)-1], `"type":"end"`) {
+		lines = append(lines, `{"type":"end","data":{"records":`+strconv.Itoa(len(lines))+`}}`)
+	}
+	return header + "\n" + strings.Join(lines, "\n") + "\n"
+}
+
+const (
+	testBackupUser    = `{"type":"user","data":{"id":1,"name":"Alice","email":"alice@example.com","created":"2026-01-01T00:00:00Z","locale":"","theme":"","role":"user","tier":"free","banned":false,"active":true}}`
+	testBackupSnippet = `{"type":"snippet","data":{"id":4,"user_id":1,"title":"Pond","content":"splash","created":"2026-01-01T00:00:00Z","expires":"2027-01-01T00:00:00Z","held":false,"private":false,"encrypted":false,"share_version":0,"tags":["haiku"]}}`
+)
+
+func TestValidateBackup(t *testing.T) {
+	tests := []struct {
+		name    string
+		archive string
+		want    BackupStats
+		wantErr string
+	}{
+		{
+			name:    "Valid",
+			archive: testBackup(testBackupUser, testBackupSnippet, `{"type":"view","data":{"snippet_id":4,"day":"2026-01-02T00:00:00Z","views":7}}`),
+			want:    BackupStats{Users: 1, Snippets: 1, Views: 1},
+		},
+		{
+			name:    "Empty",
+			archive: "",
+			wantErr: "empty archive",
+		},
+		{
+			name:    "Not an archive",
+			archive: `{"format":"something-else","version":1}` + "\n",
+			wantErr: "not a backup archive",
+		},
+		{
+			name:    "Newer version",
+			archive: strings.Replace(testBackup(), `"version":1`, `"version":2`, 1),
+			wantErr: "unsupported version 2",
+		},
+		{
+			name:    "Truncated",
+			archive: strings.SplitAfter(testBackup(testBackupUser), "\n")[0] + testBackupUser + "\n",
+			wantErr: "archive is truncated",
+		},
+		{
+			name:    "Wrong count",
+			archive: testBackup(testBackupUser, `{"type":"end","data":{"records":5}}`),
+			wantErr: "end record counts 5 records, found 1",
+		},
+		{
+			name:    "Data after end",
+			archive: testBackup(testBackupUser) + testBackupUser + "\n",
+			wantErr: "line 4: data after the end record",
+		},
+		{
+			name:    "Unknown record type",
+			archive: testBackup(`{"type":"session","data":{}}`),
+			wantErr: `unknown record type "session"`,
+		},
+		{
+			name:    "Unknown field",
+			archive: testBackup(strings.Replace(testBackupUser, `"active":true`, `"active":true,"admin":true`, 1)),
+			wantErr: `unknown field "admin"`,
+		},
+		{
+			name:    "Repeated user",
+			archive: testBackup(testBackupUser, testBackupUser),
+			wantErr: "line 3: user ID 1 is invalid or repeated",
+		},
+		{
+			name:    "Invalid password hash",
+			archive: testBackup(strings.Replace(testBackupUser, `"email"`, `"hashed_password":"secret","email"`, 1)),
+			wantErr: "user 1 has an invalid password hash",
+		},
+		{
+			name:    "Unknown owner",
+			archive: testBackup(testBackupSnippet),
+			wantErr: "snippet 4 belongs to unknown user 1",
+		},
+		{
+			name:    "Self follow",
+			archive: testBackup(testBackupUser, `{"type":"follow","data":{"follower_id":1,"followed_id":1,"created":"2026-01-01T00:00:00Z"}}`),
+			wantErr: "follow of user 1 by user 1 is invalid",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ValidateBackup(strings.NewReader(tt.archive))
+			if tt.wantErr != "" {
+				assert.ErrorIs(t, err, ErrInvalidBackup)
+				assert.StringContains(t, err.Error(), tt.wantErr)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, got, tt.want)
+		})
+	}
+}
+
+func TestBackupModelRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	src := newTestDB(t)
+	testutil.LoadFixtures(t, src, "users", "snippets")
+	_, err := src.Exec(t.Context(), `
+		UPDATE snippets SET user_id = 1 WHERE id = 1;
+		INSERT INTO snippet_tags (snippet_id, tag) VALUES (1, 'haiku'), (1, 'nature');
+		INSERT INTO snippet_views (snippet_id, day, views) VALUES (1, CURRENT_DATE, 3);
+		INSERT INTO follows (follower_id, followed_id, created) VALUES (1, 3, CURRENT_TIMESTAMP);
+		INSERT INTO snippet_quotas (user_id, per_hour, total) VALUES (1, 5, 50);`)
+	assert.NilError(t, err)
+
+	var archive bytes.Buffer
+	stats, err := (&BackupModel{DB: src}).Export(&archive, true)
+	assert.NilError(t, err)
+	assert.Equal(t, stats, BackupStats{Users: 2, Snippets: 3, Views: 1, Follows: 1, Quotas: 1})
+
+	dst := newTestDB(t)
+	m := &BackupModel{DB: dst}
+	restored, err := m.Restore(bytes.NewReader(archive.Bytes()))
+	assert.NilError(t, err)
+	assert.Equal(t, restored, stats)
+
+	// Everything comes back as it was, apart from the header's time
+	var again bytes.Buffer
+	_, err = m.Export(&again, true)
+	assert.NilError(t, err)
+	_, want, _ := strings.Cut(archive.String(), "\n")
+	_, got, _ := strings.Cut(again.String(), "\n")
+	assert.Equal(t, got, want)
+
+	// Restored users keep their passwords, and new rows get fresh IDs
+	users := UserModel{DB: dst}
+	id, err := users.Authenticate("alice@example.com", "pa$$word")
+	assert.NilError(t, err)
+	assert.Equal(t, id, 1)
+	id, err = users.Provision("Dave", "dave@example.com", true)
+	assert.NilError(t, err)
+	assert.Equal(t, id, 4)
+
+	_, err = m.Restore(bytes.NewReader(archive.Bytes()))
+	assert.ErrorIs(t, err, ErrRestoreNotEmpty)
+}
+
+func TestBackupModelWithoutPasswords(t *testing.T) {
+	t.Parallel()
+
+	src := newTestDB(t)
+	testutil.LoadFixtures(t, src, "users")
+
+	var archive bytes.Buffer
+	_, err := (&BackupModel{DB: src}).Export(&archive, false)
+	assert.NilError(t, err)
+	if strings.Contains(archive.String(), "hashed_password") {
+		t.Error("archive holds password hashes")
+	}
+
+	dst := newTestDB(t)
+	_, err = (&BackupModel{DB: dst}).Restore(&archive)
+	assert.NilError(t, err)
+
+	_, err = (&UserModel{DB: dst}).Authenticate("alice@example.com", "pa$$word")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestBackupModelUnknownKey(t *testing.T) {
+	archive := testBackup(testBackupUser, strings.Replace(testBackupSnippet, `"content":"splash"`, `"content":"c2VhbGVk","content_key":"k1"`, 1))
+
+	// Checked before touching the database
+	_, err := (&BackupModel{}).Restore(strings.NewReader(archive))
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"context"
+	"net/netip"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =============================================================================
+// IP Ban Model - Type Definitions
+// =============================================================================
+
+// IPBan blocks requests from a network, or a single address as a /32 or
+// /128 network
+type IPBan struct {
+	ID       int
+	Network  netip.Prefix
+	Reason   string
+	Created  time.Time
+	Expires  time.Time // Zero for permanent bans
+	BannedBy string    // Name of the admin who added the ban, if known
+}
+
+// Active reports whether the ban is in force at t
+func (b *IPBan) Active(t time.Time) bool {
+	return b.Expires.IsZero() || b.Expires.After(t)
+}
+
+// BanModelInterface defines the interface for IP ban operations
+type BanModelInterface interface {
+	Insert(network netip.Prefix, reason string, duration time.Duration, bannedBy int) (int, error)
+	Active() ([]*IPBan, error)
+	Delete(id int) error
+}
+
+// BanModel wraps a database connection pool
+type BanModel struct {
+	DB *pgxpool.Pool
+}
+
+// =============================================================================
+// IP Ban Model - Methods
+// =============================================================================
+
+// Insert bans a network for duration, or permanently if duration is zero.
+// Host bits are cleared, so 10.1.2.3/8 bans 10.0.0.0/8.
+func (m *BanModel) Insert(network netip.Prefix, reason string, duration time.Duration, bannedBy int) (int, error) {
+	stmt := `INSERT INTO ip_bans (network, reason, created, expires, created_by)
+             VALUES ($1, $2, CURRENT_TIMESTAMP,
+                     CASE WHEN $3::float8 = 0 THEN NULL ELSE CURRENT_TIMESTAMP + make_interval(secs => $3) END,
+                     $4)
+             RETURNING id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int
+	err := m.DB.QueryRow(ctx, stmt, network.Masked(), reason, duration.Seconds(), bannedBy).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// Active returns the bans currently in force, newest first
+func (m *BanModel) Active() ([]*IPBan, error) {
+	stmt := `SELECT b.id, b.network, b.reason, b.created, b.expires, COALESCE(u.name, '')
+             FROM ip_bans b
+             LEFT JOIN users u ON u.id = b.created_by
+             WHERE b.expires IS NULL OR b.expires > CURRENT_TIMESTAMP
+             ORDER BY b.created DESC, b.id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bans := []*IPBan{}
+	for rows.Next() {
+		b := &IPBan{}
+		var expires *time.Time
+		err = rows.Scan(&b.ID, &b.Network, &b.Reason, &b.Created, &expires, &b.BannedBy)
+		if err != nil {
+			return nil, err
+		}
+		if expires != nil {
+			b.Expires = *expires
+		}
+		bans = append(bans, b)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return bans, nil
+}
+
+// Delete lifts a ban. Returns ErrNoRecord if there is no such ban.
+func (m *BanModel) Delete(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tag, err := m.DB.Exec(ctx, "DELETE FROM ip_bans WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("ban", id)
+	}
+
+	return nil
+}
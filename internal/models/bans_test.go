@@ -0,0 +1,50 @@
+package models
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestBanModel(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users")
+	m := BanModel{DB: db}
+
+	// Host bits are cleared before storing
+	id, err := m.Insert(netip.MustParsePrefix("203.0.113.77/24"), "Credential stuffing", 0, 3)
+	assert.NilError(t, err)
+
+	_, err = m.Insert(netip.MustParsePrefix("198.51.100.7/32"), "Comment spam", time.Hour, 3)
+	assert.NilError(t, err)
+
+	// Expired bans are left out
+	_, err = db.Exec(context.Background(), `INSERT INTO ip_bans (network, reason, expires)
+	VALUES ('192.0.2.0/24', 'Old', CURRENT_TIMESTAMP - INTERVAL '1 minute')`)
+	assert.NilError(t, err)
+
+	bans, err := m.Active()
+	assert.NilError(t, err)
+	assert.Equal(t, len(bans), 2)
+
+	var permanent *IPBan
+	for _, b := range bans {
+		if b.ID == id {
+			permanent = b
+		}
+	}
+	assert.NotNil(t, permanent)
+	assert.Equal(t, permanent.Network, netip.MustParsePrefix("203.0.113.0/24"))
+	assert.Equal(t, permanent.Expires.IsZero(), true)
+	assert.Equal(t, permanent.Active(time.Now().AddDate(10, 0, 0)), true)
+	assert.Equal(t, permanent.BannedBy, "Carol Admin")
+
+	assert.NilError(t, m.Delete(id))
+	assert.ErrorIs(t, m.Delete(id), ErrNoRecord)
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// =============================================================================
+// Browse - Type Definitions
+// =============================================================================
+
+// GroupCount is the number of public snippets sharing a language or tag
+type GroupCount struct {
+	Name  string
+	Count int
+}
+
+// =============================================================================
+// Browse - Methods
+// =============================================================================
+
+// ByLanguage retrieves one page of summaries of unexpired public snippets
+// guessed to be in a language, most recent first. Returns the page of
+// summaries and the total number in that language.
+func (m *SnippetModel) ByLanguage(ctx context.Context, language string, limit, offset int) ([]*SnippetSummary, int, error) {
+	where := `WHERE expires > CURRENT_TIMESTAMP AND NOT held AND NOT private AND NOT encrypted
+                AND language = $1`
+
+	return m.listPage(ctx, "", where, []any{language}, limit, offset)
+}
+
+// ByTag retrieves one page of summaries of unexpired public snippets with a
+// tag, most recent first. Returns the page of summaries and the total with
+// that tag.
+func (m *SnippetModel) ByTag(ctx context.Context, tag string, limit, offset int) ([]*SnippetSummary, int, error) {
+	where := `WHERE expires > CURRENT_TIMESTAMP AND NOT held AND NOT private AND NOT encrypted
+                AND id IN (SELECT snippet_id FROM snippet_tags WHERE tag = $1)`
+
+	return m.listPage(ctx, "", where, []any{tag}, limit, offset)
+}
+
+// LanguageCounts returns how many unexpired public snippets there are in
+// each language, most common first. Snippets without a language are left
+// out.
+func (m *SnippetModel) LanguageCounts() ([]*GroupCount, error) {
+	stmt := `SELECT language, count(*)
+             FROM snippets
+             WHERE expires > CURRENT_TIMESTAMP AND NOT held AND NOT private AND NOT encrypted
+                AND language <> ''
+             GROUP BY language
+             ORDER BY count(*) DESC, language`
+
+	return m.groupCounts(stmt)
+}
+
+// TagCounts returns how many unexpired public snippets have each of the
+// limit most used tags, most used first
+func (m *SnippetModel) TagCounts(limit int) ([]*GroupCount, error) {
+	stmt := `SELECT t.tag, count(*)
+             FROM snippet_tags t
+             JOIN snippets s ON s.id = t.snippet_id
+             WHERE s.expires > CURRENT_TIMESTAMP AND NOT s.held AND NOT s.private AND NOT s.encrypted
+             GROUP BY t.tag
+             ORDER BY count(*) DESC, t.tag
+             LIMIT $1`
+
+	return m.groupCounts(stmt, limit)
+}
+
+// groupCounts runs a query selecting names and counts
+func (m *SnippetModel) groupCounts(stmt string, args ...any) ([]*GroupCount, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []*GroupCount{}
+	for rows.Next() {
+		c := &GroupCount{}
+		if err = rows.Scan(&c.Name, &c.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"net/netip"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestSnippetModelBrowse(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users", "snippets")
+	m := SnippetModel{DB: db}
+
+	goCode := "package main\n\nfunc main() {\n\tmsg := \"hi\"\n}\n"
+	first, err := m.Insert(1, netip.Addr{}, "First", goCode, 7, false, SnippetLimits{})
+	assert.NilError(t, err)
+	second, err := m.Insert(1, netip.Addr{}, "Second", goCode, 7, false, SnippetLimits{})
+	assert.NilError(t, err)
+	// Private snippets aren't listed or counted
+	private, err := m.Insert(1, netip.Addr{}, "Private", goCode, 7, true, SnippetLimits{})
+	assert.NilError(t, err)
+	assert.NilError(t, m.SetTags(first, []string{"go", "http"}))
+	assert.NilError(t, m.SetTags(second, []string{"go"}))
+	assert.NilError(t, m.SetTags(private, []string{"go", "secret"}))
+
+	snippets, total, err := m.ByLanguage(t.Context(), "go", 1, 0)
+	assert.NilError(t, err)
+	assert.Equal(t, total, 2)
+	assert.Equal(t, len(snippets), 1)
+	assert.Equal(t, snippets[0].ID, second)
+	assert.Equal(t, snippets[0].Language, "go")
+
+	snippets, total, err = m.ByTag(t.Context(), "http", 10, 0)
+	assert.NilError(t, err)
+	assert.Equal(t, total, 1)
+	assert.Equal(t, snippets[0].ID, first)
+
+	languages, err := m.LanguageCounts()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, languages, []*GroupCount{{Name: "go", Count: 2}})
+
+	tags, err := m.TagCounts(10)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, tags, []*GroupCount{{Name: "go", Count: 2}, {Name: "http", Count: 1}})
+}
@@ -0,0 +1,395 @@
+package models
+
+import (
+	"container/list"
+	"context"
+	"io"
+	"net/netip"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"adotkaya.playground/internal/query"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =============================================================================
+// Snippet Cache - Type Definitions
+// =============================================================================
+
+// snippetsChangedChannel is the Postgres NOTIFY channel on which snippet
+// writes are announced. The payload is the ID of the changed snippet.
+const snippetsChangedChannel = "snippets_changed"
+
+// SnippetCache wraps a SnippetModelInterface with an in-memory cache of
+// individual snippets, the latest listing and the first page of All (the
+// home page)
+//
+// Writes made through any application instance are announced with
+// LISTEN/NOTIFY, so every instance running Listen drops stale entries.
+// Snippets and listings are also refetched once they are older than the
+// TTL, bounding staleness if a notification is missed. At most maxSnippets
+// snippets are kept, dropping the least recently read first.
+type SnippetCache struct {
+	model       SnippetModelInterface
+	db          *pgxpool.Pool
+	ttl         time.Duration    // Zero keeps entries until invalidated
+	maxSnippets int              // Zero keeps every snippet read
+	now         func() time.Time // Replaced in tests
+
+	mu       sync.RWMutex
+	snippets map[int]*list.Element // Elements of lru, holding *cachedSnippet
+	lru      *list.List            // Most recently read first
+	latest   []*SnippetSummary
+	latestAt time.Time
+
+	// First page of All, for pages of firstSize snippets
+	first      []*SnippetSummary
+	firstTotal int
+	firstSize  int
+	firstAt    time.Time
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// cachedSnippet is a snippet in the cache and when it was fetched
+type cachedSnippet struct {
+	id        int
+	snippet   *Snippet
+	fetchedAt time.Time
+}
+
+// CacheStats counts cache lookups since the cache was created
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64 // Lookups that went to the database
+}
+
+// NewSnippetCache returns a SnippetCache in front of the given model, keeping
+// entries for at most ttl and at most maxSnippets snippets. The pool is used
+// to hold the dedicated LISTEN connection.
+func NewSnippetCache(model SnippetModelInterface, db *pgxpool.Pool, ttl time.Duration, maxSnippets int) *SnippetCache {
+	return &SnippetCache{
+		model:       model,
+		db:          db,
+		ttl:         ttl,
+		maxSnippets: maxSnippets,
+		now:         time.Now,
+		snippets:    make(map[int]*list.Element),
+		lru:         list.New(),
+	}
+}
+
+// Stats returns the hit and miss counts
+func (c *SnippetCache) Stats() CacheStats {
+	return CacheStats{Hits: c.hits.Load(), Misses: c.misses.Load()}
+}
+
+// =============================================================================
+// Snippet Cache - SnippetModelInterface Methods
+// =============================================================================
+
+// Insert creates a snippet through the wrapped model and invalidates the
+// local cache immediately (other instances are notified by the database)
+func (c *SnippetCache) Insert(userID int, creatorIP netip.Addr, title string, content string, expires int, private bool, limits SnippetLimits) (int, error) {
+	id, err := c.model.Insert(userID, creatorIP, title, content, expires, private, limits)
+	if err != nil {
+		return 0, err
+	}
+
+	c.Invalidate(id)
+	return id, nil
+}
+
+// InsertEncrypted creates an encrypted snippet through the wrapped model
+// and invalidates the local cache immediately
+func (c *SnippetCache) InsertEncrypted(userID int, creatorIP netip.Addr, ciphertext string, expires int, limits SnippetLimits) (int, error) {
+	id, err := c.model.InsertEncrypted(userID, creatorIP, ciphertext, expires, limits)
+	if err != nil {
+		return 0, err
+	}
+
+	c.Invalidate(id)
+	return id, nil
+}
+
+// Update changes a snippet through the wrapped model and invalidates it
+func (c *SnippetCache) Update(id int, title string, content string, private bool, limits SnippetLimits) error {
+	err := c.model.Update(id, title, content, private, limits)
+	c.Invalidate(id)
+	return err
+}
+
+// Delete removes a snippet through the wrapped model and invalidates it
+func (c *SnippetCache) Delete(id int) error {
+	err := c.model.Delete(id)
+	c.Invalidate(id)
+	return err
+}
+
+// RevokeShares bumps a snippet's share generation through the wrapped
+// model and invalidates it
+func (c *SnippetCache) RevokeShares(id int) error {
+	err := c.model.RevokeShares(id)
+	c.Invalidate(id)
+	return err
+}
+
+// SetTags changes a snippet's tags through the wrapped model and
+// invalidates it
+func (c *SnippetCache) SetTags(id int, tags []string) error {
+	err := c.model.SetTags(id, tags)
+	c.Invalidate(id)
+	return err
+}
+
+// SetSource records where a snippet was imported from through the
+// wrapped model and invalidates it
+func (c *SnippetCache) SetSource(id int, source string) error {
+	err := c.model.SetSource(id, source)
+	c.Invalidate(id)
+	return err
+}
+
+// Get returns a cached snippet, falling back to the wrapped model on a miss
+// or once the TTL has passed
+func (c *SnippetCache) Get(ctx context.Context, id int) (*Snippet, error) {
+	now := c.now()
+
+	c.mu.Lock()
+	var cached *cachedSnippet
+	if e, ok := c.snippets[id]; ok {
+		cached = e.Value.(*cachedSnippet)
+		if c.ttl == 0 || now.Sub(cached.fetchedAt) < c.ttl {
+			c.lru.MoveToFront(e)
+		} else {
+			c.removeSnippet(e)
+			cached = nil
+		}
+	}
+	c.mu.Unlock()
+
+	if cached != nil {
+		c.hits.Add(1)
+		if cached.snippet.Expires.After(now) {
+			return cached.snippet, nil
+		}
+		// The snippet expired while cached
+		c.Invalidate(id)
+		return nil, notFound("snippet", id)
+	}
+
+	c.misses.Add(1)
+	s, err := c.model.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if e, ok := c.snippets[id]; ok {
+		c.removeSnippet(e)
+	}
+	c.snippets[id] = c.lru.PushFront(&cachedSnippet{id: id, snippet: s, fetchedAt: now})
+	if c.maxSnippets > 0 && c.lru.Len() > c.maxSnippets {
+		c.removeSnippet(c.lru.Back())
+	}
+	c.mu.Unlock()
+
+	return s, nil
+}
+
+// removeSnippet drops the snippet held in e. The caller holds c.mu.
+func (c *SnippetCache) removeSnippet(e *list.Element) {
+	c.lru.Remove(e)
+	delete(c.snippets, e.Value.(*cachedSnippet).id)
+}
+
+// Latest returns the cached latest listing, falling back to the wrapped
+// model on a miss, once the TTL has passed or when any cached snippet has
+// since expired
+func (c *SnippetCache) Latest(ctx context.Context) ([]*SnippetSummary, error) {
+	now := c.now()
+
+	c.mu.RLock()
+	latest, fetched := c.latest, c.latestAt
+	c.mu.RUnlock()
+
+	fresh := c.ttl == 0 || now.Sub(fetched) < c.ttl
+	if latest != nil && fresh && !anyExpired(latest, now) {
+		c.hits.Add(1)
+		return latest, nil
+	}
+
+	c.misses.Add(1)
+	latest, err := c.model.Latest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.latest, c.latestAt = latest, now
+	c.mu.Unlock()
+
+	return latest, nil
+}
+
+// GetHeader is not cached and goes straight to the wrapped model
+func (c *SnippetCache) GetHeader(ctx context.Context, id int) (*SnippetHeader, error) {
+	return c.model.GetHeader(ctx, id)
+}
+
+// CopyContent is not cached and goes straight to the wrapped model, since
+// it is meant for content too large to keep in memory
+func (c *SnippetCache) CopyContent(ctx context.Context, w io.Writer, id int) (int64, error) {
+	return c.model.CopyContent(ctx, w, id)
+}
+
+// All returns the cached first page, like Latest, and goes straight to the
+// wrapped model for the others, which are rarely visited
+func (c *SnippetCache) All(ctx context.Context, page, pageSize int) ([]*SnippetSummary, int, error) {
+	if page != 1 {
+		return c.model.All(ctx, page, pageSize)
+	}
+	now := c.now()
+
+	c.mu.RLock()
+	first, total, size, fetched := c.first, c.firstTotal, c.firstSize, c.firstAt
+	c.mu.RUnlock()
+
+	fresh := c.ttl == 0 || now.Sub(fetched) < c.ttl
+	if first != nil && size == pageSize && fresh && !anyExpired(first, now) {
+		c.hits.Add(1)
+		return first, total, nil
+	}
+
+	c.misses.Add(1)
+	first, total, err := c.model.All(ctx, page, pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	c.mu.Lock()
+	c.first, c.firstTotal, c.firstSize, c.firstAt = first, total, pageSize, now
+	c.mu.Unlock()
+
+	return first, total, nil
+}
+
+// Search is not cached and goes straight to the wrapped model
+func (c *SnippetCache) Search(ctx context.Context, q query.Query, limit, offset int) ([]*SnippetSummary, int, error) {
+	return c.model.Search(ctx, q, limit, offset)
+}
+
+// RecordView is not cached and goes straight to the wrapped model
+func (c *SnippetCache) RecordView(id int) error {
+	return c.model.RecordView(id)
+}
+
+// Popular is not cached and goes straight to the wrapped model
+func (c *SnippetCache) Popular(days, limit int) ([]*PopularSnippet, error) {
+	return c.model.Popular(days, limit)
+}
+
+// RefreshTrending goes straight to the wrapped model
+func (c *SnippetCache) RefreshTrending() (int, error) {
+	return c.model.RefreshTrending()
+}
+
+// Trending is not cached and goes straight to the wrapped model
+func (c *SnippetCache) Trending(ctx context.Context, limit int) ([]*SnippetSummary, error) {
+	return c.model.Trending(ctx, limit)
+}
+
+// ByLanguage is not cached and goes straight to the wrapped model
+func (c *SnippetCache) ByLanguage(ctx context.Context, language string, limit, offset int) ([]*SnippetSummary, int, error) {
+	return c.model.ByLanguage(ctx, language, limit, offset)
+}
+
+// ByTag is not cached and goes straight to the wrapped model
+func (c *SnippetCache) ByTag(ctx context.Context, tag string, limit, offset int) ([]*SnippetSummary, int, error) {
+	return c.model.ByTag(ctx, tag, limit, offset)
+}
+
+// LanguageCounts is not cached and goes straight to the wrapped model
+func (c *SnippetCache) LanguageCounts() ([]*GroupCount, error) {
+	return c.model.LanguageCounts()
+}
+
+// TagCounts is not cached and goes straight to the wrapped model
+func (c *SnippetCache) TagCounts(limit int) ([]*GroupCount, error) {
+	return c.model.TagCounts(limit)
+}
+
+// =============================================================================
+// Snippet Cache - Invalidation
+// =============================================================================
+
+// Invalidate drops the given snippet and the listings from the cache
+func (c *SnippetCache) Invalidate(id int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.snippets[id]; ok {
+		c.removeSnippet(e)
+	}
+	c.latest = nil
+	c.first = nil
+}
+
+// Flush drops every entry from the cache
+func (c *SnippetCache) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.snippets = make(map[int]*list.Element)
+	c.lru.Init()
+	c.latest = nil
+	c.first = nil
+}
+
+// Listen subscribes to snippet change notifications and invalidates the
+// cache for each one until ctx is cancelled or the connection fails
+//
+// The cache is flushed once the subscription is active, since notifications
+// sent while no listener was connected are lost. Callers should call Listen
+// again (after a delay) when it returns an error.
+func (c *SnippetCache) Listen(ctx context.Context) error {
+	conn, err := c.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, "LISTEN "+snippetsChangedChannel)
+	if err != nil {
+		return err
+	}
+	c.Flush()
+
+	for {
+		n, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		id, err := strconv.Atoi(n.Payload)
+		if err != nil {
+			// Unknown payload: be safe and drop everything
+			c.Flush()
+			continue
+		}
+		c.Invalidate(id)
+	}
+}
+
+// anyExpired reports whether any snippet in the listing has expired by now
+func anyExpired(snippets []*SnippetSummary, now time.Time) bool {
+	for _, s := range snippets {
+		if !s.Expires.After(now) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,211 @@
+package models
+
+import (
+	"context"
+	"io"
+	"net/netip"
+	"testing"
+	"time"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/query"
+)
+
+// countingModel is an in-memory SnippetModelInterface counting how often
+// snippets and the listings are queried
+type countingModel struct {
+	getCalls    int
+	latestCalls int
+	allCalls    int
+	latest      []*SnippetSummary
+}
+
+func (m *countingModel) Insert(userID int, creatorIP netip.Addr, title string, content string, expires int, private bool, limits SnippetLimits) (int, error) {
+	return len(m.latest) + 1, nil
+}
+func (m *countingModel) InsertEncrypted(userID int, creatorIP netip.Addr, ciphertext string, expires int, limits SnippetLimits) (int, error) {
+	return len(m.latest) + 1, nil
+}
+func (m *countingModel) Update(id int, title string, content string, private bool, limits SnippetLimits) error {
+	return nil
+}
+func (m *countingModel) Delete(id int) error {
+	return nil
+}
+func (m *countingModel) SetTags(id int, tags []string) error {
+	return nil
+}
+func (m *countingModel) SetSource(id int, source string) error {
+	return nil
+}
+func (m *countingModel) RevokeShares(id int) error {
+	return nil
+}
+func (m *countingModel) Get(ctx context.Context, id int) (*Snippet, error) {
+	m.getCalls++
+	return &Snippet{ID: id, Expires: time.Date(2099, 1, 1, 0, 0, 0, 0, time.UTC)}, nil
+}
+func (m *countingModel) GetHeader(ctx context.Context, id int) (*SnippetHeader, error) {
+	return nil, ErrNoRecord
+}
+func (m *countingModel) CopyContent(ctx context.Context, w io.Writer, id int) (int64, error) {
+	return 0, ErrNoRecord
+}
+func (m *countingModel) Latest(ctx context.Context) ([]*SnippetSummary, error) {
+	m.latestCalls++
+	return m.latest, nil
+}
+func (m *countingModel) All(ctx context.Context, page, pageSize int) ([]*SnippetSummary, int, error) {
+	m.allCalls++
+	return m.latest, len(m.latest), nil
+}
+func (m *countingModel) Search(ctx context.Context, q query.Query, limit, offset int) ([]*SnippetSummary, int, error) {
+	return nil, 0, nil
+}
+func (m *countingModel) RecordView(id int) error {
+	return nil
+}
+func (m *countingModel) Popular(days, limit int) ([]*PopularSnippet, error) {
+	return nil, nil
+}
+func (m *countingModel) RefreshTrending() (int, error) {
+	return 0, nil
+}
+func (m *countingModel) Trending(ctx context.Context, limit int) ([]*SnippetSummary, error) {
+	return nil, nil
+}
+func (m *countingModel) ByLanguage(ctx context.Context, language string, limit, offset int) ([]*SnippetSummary, int, error) {
+	return nil, 0, nil
+}
+func (m *countingModel) ByTag(ctx context.Context, tag string, limit, offset int) ([]*SnippetSummary, int, error) {
+	return nil, 0, nil
+}
+func (m *countingModel) LanguageCounts() ([]*GroupCount, error) {
+	return nil, nil
+}
+func (m *countingModel) TagCounts(limit int) ([]*GroupCount, error) {
+	return nil, nil
+}
+
+func TestSnippetCacheLatest(t *testing.T) {
+	start := time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC)
+	model := &countingModel{latest: []*SnippetSummary{
+		{ID: 1, Title: "An old silent pond", Expires: start.Add(time.Hour)},
+	}}
+
+	tests := []struct {
+		name      string
+		after     time.Duration // Time since the listing was first fetched
+		invalid   bool          // Insert a snippet before reading
+		wantCalls int
+	}{
+		{"Within TTL", 10 * time.Second, false, 1},
+		{"TTL passed", 31 * time.Second, false, 2},
+		{"Invalidated by insert", 10 * time.Second, true, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model.latestCalls = 0
+			now := start
+			c := NewSnippetCache(model, nil, 30*time.Second, 0)
+			c.now = func() time.Time { return now }
+
+			_, err := c.Latest(t.Context())
+			assert.NilError(t, err)
+
+			now = start.Add(tt.after)
+			if tt.invalid {
+				_, err = c.Insert(1, netip.Addr{}, "Over the wintry forest", "...", 7, false, SnippetLimits{})
+				assert.NilError(t, err)
+			}
+			_, err = c.Latest(t.Context())
+			assert.NilError(t, err)
+
+			assert.Equal(t, model.latestCalls, tt.wantCalls)
+			assert.Equal(t, c.Stats().Misses, uint64(tt.wantCalls))
+			assert.Equal(t, c.Stats().Hits, uint64(2-tt.wantCalls))
+		})
+	}
+}
+
+func TestSnippetCacheAll(t *testing.T) {
+	start := time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC)
+	model := &countingModel{latest: []*SnippetSummary{
+		{ID: 1, Title: "An old silent pond", Expires: start.Add(time.Hour)},
+	}}
+	now := start
+	c := NewSnippetCache(model, nil, 30*time.Second, 0)
+	c.now = func() time.Time { return now }
+
+	// The first page is cached, with its total
+	for range 2 {
+		page, total, err := c.All(t.Context(), 1, 10)
+		assert.NilError(t, err)
+		assert.Equal(t, len(page), 1)
+		assert.Equal(t, total, 1)
+	}
+	assert.Equal(t, model.allCalls, 1)
+
+	// Other pages and page sizes aren't
+	_, _, err := c.All(t.Context(), 2, 10)
+	assert.NilError(t, err)
+	_, _, err = c.All(t.Context(), 1, 20)
+	assert.NilError(t, err)
+	assert.Equal(t, model.allCalls, 3)
+
+	// Writes and the TTL refetch it, like the latest listing
+	_, _, err = c.All(t.Context(), 1, 10)
+	assert.NilError(t, err)
+	c.Invalidate(1)
+	_, _, err = c.All(t.Context(), 1, 10)
+	assert.NilError(t, err)
+	assert.Equal(t, model.allCalls, 5)
+
+	now = start.Add(31 * time.Second)
+	_, _, err = c.All(t.Context(), 1, 10)
+	assert.NilError(t, err)
+	assert.Equal(t, model.allCalls, 6)
+}
+
+func TestSnippetCacheGet(t *testing.T) {
+	start := time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC)
+	model := &countingModel{}
+	now := start
+	c := NewSnippetCache(model, nil, 30*time.Second, 2)
+	c.now = func() time.Time { return now }
+
+	get := func(id int) {
+		t.Helper()
+		s, err := c.Get(t.Context(), id)
+		assert.NilError(t, err)
+		assert.Equal(t, s.ID, id)
+	}
+
+	// Reading 1 again makes 2 the least recently read, so 3 pushes it out
+	get(1)
+	get(2)
+	get(1)
+	get(3)
+	assert.Equal(t, model.getCalls, 3)
+	get(1)
+	get(3)
+	assert.Equal(t, model.getCalls, 3)
+	get(2)
+	assert.Equal(t, model.getCalls, 4)
+	assert.Equal(t, len(c.snippets), 2)
+	assert.Equal(t, c.lru.Len(), 2)
+
+	// Entries are refetched once the TTL has passed
+	now = start.Add(31 * time.Second)
+	get(2)
+	assert.Equal(t, model.getCalls, 5)
+	get(2)
+	assert.Equal(t, model.getCalls, 5)
+
+	// Invalidating drops the entry
+	c.Invalidate(2)
+	get(2)
+	assert.Equal(t, model.getCalls, 6)
+	assert.Equal(t, c.Stats().Hits, uint64(4))
+	assert.Equal(t, c.Stats().Misses, uint64(6))
+}
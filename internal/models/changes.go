@@ -0,0 +1,117 @@
+package models
+
+import (
+	"context"
+	"net/netip"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =============================================================================
+// Snippet Change Model - Type Definitions
+// =============================================================================
+
+// Snippet change actions
+const (
+	ChangeCreate = "create"
+	ChangeEdit   = "edit"
+	ChangeDelete = "delete"
+)
+
+// SnippetMeta is a snippet's metadata as recorded with a change. Content is
+// recorded by size and a short hash, so the history shows that it changed
+// without keeping copies of it.
+type SnippetMeta struct {
+	Title       string    `json:"title"`
+	Size        int       `json:"size"`
+	ContentHash string    `json:"content_hash"`
+	Tags        []string  `json:"tags,omitempty"`
+	Private     bool      `json:"private,omitempty"`
+	Encrypted   bool      `json:"encrypted,omitempty"`
+	Expires     time.Time `json:"expires"`
+}
+
+// SnippetChange records a snippet being created, edited or deleted
+type SnippetChange struct {
+	ID        int
+	SnippetID int
+	ActorID   int        // Zero for anonymous visitors and deleted users
+	Actor     string     // Name of the user, if they still exist
+	ActorIP   netip.Addr // Address of an anonymous visitor
+	Action    string     // One of the Change* actions
+	Before    *SnippetMeta
+	After     *SnippetMeta
+	Created   time.Time
+}
+
+// SnippetChangeModelInterface defines the interface for the snippet change
+// history
+type SnippetChangeModelInterface interface {
+	Record(c *SnippetChange) error
+	History(snippetID int) ([]*SnippetChange, error)
+}
+
+// SnippetChangeModel wraps a database connection pool
+type SnippetChangeModel struct {
+	DB *pgxpool.Pool
+}
+
+// =============================================================================
+// Snippet Change Model - Methods
+// =============================================================================
+
+// Record appends a change to a snippet's history. Before is nil for
+// creations and After for deletions. The actor is the user in ActorID or,
+// if that is zero, the anonymous visitor at ActorIP.
+func (m *SnippetChangeModel) Record(c *SnippetChange) error {
+	stmt := `INSERT INTO snippet_changes (snippet_id, actor_id, actor_ip, action, before, after, created)
+             VALUES ($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	actorID, actorIP := creator(c.ActorID, c.ActorIP)
+	_, err := m.DB.Exec(ctx, stmt, c.SnippetID, actorID, actorIP, c.Action, c.Before, c.After)
+	return err
+}
+
+// History returns every recorded change to a snippet, oldest first,
+// including changes to snippets that have since been deleted
+func (m *SnippetChangeModel) History(snippetID int) ([]*SnippetChange, error) {
+	stmt := `SELECT c.id, c.snippet_id, COALESCE(c.actor_id, 0), COALESCE(u.name, ''), c.actor_ip,
+                    c.action, c.before, c.after, c.created
+             FROM snippet_changes c
+             LEFT JOIN users u ON u.id = c.actor_id
+             WHERE c.snippet_id = $1
+             ORDER BY c.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, stmt, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []*SnippetChange{}
+	for rows.Next() {
+		c := &SnippetChange{}
+		var actorIP *netip.Addr
+		err = rows.Scan(&c.ID, &c.SnippetID, &c.ActorID, &c.Actor, &actorIP, &c.Action, &c.Before, &c.After, &c.Created)
+		if err != nil {
+			return nil, err
+		}
+		if actorIP != nil {
+			c.ActorIP = *actorIP
+		}
+		changes = append(changes, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
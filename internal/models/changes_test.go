@@ -0,0 +1,46 @@
+package models
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestSnippetChangeModel(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users", "snippets")
+	m := SnippetChangeModel{DB: db}
+
+	expires := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	created := &SnippetMeta{Title: "O snail", Size: 16, ContentHash: "aa", Tags: []string{"haiku"}, Expires: expires}
+	edited := &SnippetMeta{Title: "O snail", Size: 20, ContentHash: "bb", Tags: []string{"haiku"}, Expires: expires}
+
+	ip := netip.MustParseAddr("203.0.113.7")
+	assert.NilError(t, m.Record(&SnippetChange{SnippetID: 1, ActorIP: ip, Action: ChangeCreate, After: created}))
+	assert.NilError(t, m.Record(&SnippetChange{SnippetID: 1, ActorID: 1, Action: ChangeEdit, Before: created, After: edited}))
+	assert.NilError(t, m.Record(&SnippetChange{SnippetID: 2, ActorID: 1, Action: ChangeDelete, Before: edited}))
+
+	changes, err := m.History(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(changes), 2)
+
+	assert.Equal(t, changes[0].Action, ChangeCreate)
+	assert.Equal(t, changes[0].ActorID, 0)
+	assert.Equal(t, changes[0].ActorIP, ip)
+	assert.Nil(t, changes[0].Before)
+	assert.DeepEqual(t, changes[0].After, created)
+
+	assert.Equal(t, changes[1].Action, ChangeEdit)
+	assert.Equal(t, changes[1].Actor, "Alice Jones")
+	assert.DeepEqual(t, changes[1].Before, created)
+	assert.DeepEqual(t, changes[1].After, edited)
+
+	changes, err = m.History(3)
+	assert.NilError(t, err)
+	assert.Equal(t, len(changes), 0)
+}
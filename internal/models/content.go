@@ -0,0 +1,129 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// =============================================================================
+// Snippet Content Streaming
+// =============================================================================
+
+// contentChunkSize is the number of characters fetched per row when
+// streaming content, bounding memory use whatever the snippet size
+const contentChunkSize = 64 * 1024
+
+// SnippetHeader is a snippet's metadata without its content
+type SnippetHeader struct {
+	ID        int
+	Title     string
+	Created   time.Time
+	Expires   time.Time
+	Size      int64 // Content length in bytes
+	UserID    int   // Owner, zero for anonymous snippets
+	Private   bool
+	Encrypted bool
+}
+
+// GetHeader retrieves a snippet's metadata without loading its content.
+// Returns ErrNoRecord if the snippet doesn't exist, has expired or is held.
+// Private snippets are returned too; callers check who may see them.
+func (m *SnippetModel) GetHeader(ctx context.Context, id int) (*SnippetHeader, error) {
+	stmt := `SELECT id, title, created, expires, octet_length(content), COALESCE(user_id, 0), private, encrypted, content_key
+             FROM snippets
+             WHERE expires > CURRENT_TIMESTAMP AND NOT held AND id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	h := &SnippetHeader{}
+	var keyID *string
+	err := m.DB.QueryRow(ctx, stmt, id).Scan(&h.ID, &h.Title, &h.Created, &h.Expires, &h.Size, &h.UserID, &h.Private, &h.Encrypted, &keyID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, notFound("snippet", id)
+		}
+		return nil, err
+	}
+	h.Size = openedSize(h.Size, keyID)
+
+	return h, nil
+}
+
+// CopyContent writes a snippet's content to w in fixed-size chunks, one row
+// per chunk, writing each row's raw bytes straight from the connection
+// buffer so the whole content is never held in memory. Returns the number of
+// bytes written, or ErrNoRecord if nothing was found.
+//
+// Content encrypted at rest has to be decrypted whole, so with keys the
+// content is read in one go instead.
+func (m *SnippetModel) CopyContent(ctx context.Context, w io.Writer, id int) (int64, error) {
+	if m.Keys != nil {
+		return m.copySealedContent(ctx, w, id)
+	}
+
+	stmt := `SELECT substr(s.content, g.start, $2)
+             FROM snippets s, generate_series(1, char_length(s.content), $2) AS g(start)
+             WHERE s.expires > CURRENT_TIMESTAMP AND NOT s.held AND s.id = $1
+             ORDER BY g.start`
+
+	// Large snippets over slow connections take a while
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, stmt, id, contentChunkSize)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var written int64
+	for rows.Next() {
+		// Text values are sent as UTF-8, so the raw value is the chunk itself
+		n, err := w.Write(rows.RawValues()[0])
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return written, err
+	}
+	if written == 0 {
+		// Empty content is not allowed, so no rows means no snippet
+		return 0, notFound("snippet", id)
+	}
+
+	return written, nil
+}
+
+// copySealedContent writes a snippet's content, which may be encrypted at
+// rest, to w in one go
+func (m *SnippetModel) copySealedContent(ctx context.Context, w io.Writer, id int) (int64, error) {
+	stmt := `SELECT id, content, content_key FROM snippets
+             WHERE expires > CURRENT_TIMESTAMP AND NOT held AND id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	s := &Snippet{}
+	var keyID *string
+	err := m.DB.QueryRow(ctx, stmt, id).Scan(&s.ID, &s.Content, &keyID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, notFound("snippet", id)
+		}
+		return 0, err
+	}
+	if err = m.Keys.openInto(s, keyID); err != nil {
+		return 0, err
+	}
+
+	n, err := io.WriteString(w, s.Content)
+	return int64(n), err
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"bytes"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestSnippetModelCopyContent(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users", "snippets")
+	m := SnippetModel{DB: db}
+
+	// Several chunks long, with multi-byte characters straddling the
+	// chunk boundaries
+	content := strings.Repeat("古池や蛙飛び込む水の音\n", 3*contentChunkSize/10)
+	id, err := m.Insert(1, netip.Addr{}, "Basho", content, 7, false, SnippetLimits{})
+	assert.NilError(t, err)
+
+	h, err := m.GetHeader(t.Context(), id)
+	assert.NilError(t, err)
+	assert.Equal(t, h.Title, "Basho")
+	assert.Equal(t, h.Size, int64(len(content)))
+
+	var buf bytes.Buffer
+	n, err := m.CopyContent(t.Context(), &buf, id)
+	assert.NilError(t, err)
+	assert.Equal(t, n, int64(len(content)))
+	assert.Equal(t, buf.String() == content, true)
+
+	// Expired snippets are not found
+	_, err = m.GetHeader(t.Context(), 3)
+	assert.ErrorIs(t, err, ErrNoRecord)
+	_, err = m.CopyContent(t.Context(), &buf, 3)
+	assert.ErrorIs(t, err, ErrNoRecord)
+}
@@ -1,6 +1,9 @@
 package models
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 // =============================================================================
 // Custom Error Definitions
@@ -16,4 +19,72 @@ var (
 	// ErrDuplicateEmail is returned when attempting to create a user with
 	// an email address that already exists in the database
 	ErrDuplicateEmail = errors.New("models: this email is already signed up")
+
+	// ErrDuplicateSubject is returned when linking an account to a single
+	// sign-on subject already linked to another
+	ErrDuplicateSubject = errors.New("models: this single sign-on subject is already linked")
+
+	// ErrDuplicateToken is returned when a new API token's hash collides
+	// with an existing token's
+	ErrDuplicateToken = errors.New("models: this API token already exists")
 )
+
+// =============================================================================
+// Error Types
+// =============================================================================
+// The error types carry what the error is about, for messages and logs,
+// and match the sentinel errors above with errors.Is, so callers checking
+// for those keep working. Handlers turn them into responses with errors.As:
+// NotFoundError into 404, ConflictError into 409 and ValidationError into
+// 422.
+
+// NotFoundError is returned when the record asked for doesn't exist, or
+// isn't visible (expired, held or banned). It matches ErrNoRecord.
+type NotFoundError struct {
+	Resource string // What was looked for, e.g. "snippet"
+	ID       any    // Nil when nothing in particular was asked for
+}
+
+func (e *NotFoundError) Error() string {
+	if e.ID == nil {
+		return fmt.Sprintf("models: no %s", e.Resource)
+	}
+	return fmt.Sprintf("models: no %s with ID %v", e.Resource, e.ID)
+}
+
+// Is makes NotFoundError match ErrNoRecord
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNoRecord
+}
+
+// notFound returns a NotFoundError for the resource with the given ID
+func notFound(resource string, id any) error {
+	return &NotFoundError{Resource: resource, ID: id}
+}
+
+// ConflictError is returned when a write clashes with data already there,
+// such as a second account with the same email address. It wraps the
+// sentinel error for the clash, e.g. ErrDuplicateEmail.
+type ConflictError struct {
+	Constraint string // The unique constraint or index violated
+	Err        error
+}
+
+func (e *ConflictError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConflictError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError is returned when the database turns away a value, by a
+// check constraint, that callers should have checked first
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("models: invalid %s: %s", e.Field, e.Message)
+}
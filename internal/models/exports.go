@@ -0,0 +1,114 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =============================================================================
+// Export Model - Type Definitions
+// =============================================================================
+// Exports list every user or snippet for analysis in a spreadsheet. Rows
+// are handed to a callback as they are read, so an export of any size is
+// written out without being held in memory. Snippets' content isn't
+// exported, only what describes them.
+
+// exportTimeout caps how long an export may take, including writing it out
+const exportTimeout = 5 * time.Minute
+
+// ExportedUser is a user's row in an export
+type ExportedUser struct {
+	ID       int
+	Name     string
+	Email    string
+	Role     string
+	Tier     string
+	Active   bool
+	Banned   bool
+	Created  time.Time
+	Snippets int // Unexpired snippets
+}
+
+// ExportedSnippet is a snippet's row in an export
+type ExportedSnippet struct {
+	ID        int
+	UserID    int // 0 for anonymous snippets
+	Title     string
+	Language  string
+	Tags      []string
+	Size      int // Bytes of content as stored
+	Private   bool
+	Encrypted bool
+	Held      bool // Awaiting moderation
+	Views     int
+	Created   time.Time
+	Expires   time.Time
+}
+
+// ExportModelInterface defines the interface for exports
+type ExportModelInterface interface {
+	Users(ctx context.Context, fn func(*ExportedUser) error) error
+	Snippets(ctx context.Context, userID int, fn func(*ExportedSnippet) error) error
+}
+
+// ExportModel wraps a database connection pool
+type ExportModel struct {
+	DB *pgxpool.Pool
+}
+
+// =============================================================================
+// Export Model - Methods
+// =============================================================================
+
+// Users calls fn with every user, in ID order, stopping at the first error
+func (m *ExportModel) Users(ctx context.Context, fn func(*ExportedUser) error) error {
+	stmt := `SELECT u.id, u.name, u.email, u.role, u.tier, u.active, u.banned, u.created,
+                    (SELECT count(*) FROM snippets s WHERE s.user_id = u.id AND s.expires > CURRENT_TIMESTAMP)
+             FROM users u
+             ORDER BY u.id`
+
+	return exportEach(ctx, m.DB, stmt, nil, fn)
+}
+
+// Snippets calls fn with every snippet, expired or not, in ID order,
+// stopping at the first error. A userID other than 0 limits it to that
+// user's snippets.
+func (m *ExportModel) Snippets(ctx context.Context, userID int, fn func(*ExportedSnippet) error) error {
+	stmt := `SELECT s.id, COALESCE(s.user_id, 0), s.title, s.language,
+                    COALESCE((SELECT array_agg(t.tag ORDER BY t.tag) FROM snippet_tags t WHERE t.snippet_id = s.id), '{}'),
+                    octet_length(s.content), s.private, s.encrypted, s.held,
+                    COALESCE((SELECT sum(v.views) FROM snippet_views v WHERE v.snippet_id = s.id), 0),
+                    s.created, s.expires
+             FROM snippets s
+             WHERE $1 = 0 OR s.user_id = $1
+             ORDER BY s.id`
+
+	return exportEach(ctx, m.DB, stmt, []any{userID}, fn)
+}
+
+// exportEach runs stmt and calls fn with each row scanned into a T by
+// position
+func exportEach[T any](ctx context.Context, db *pgxpool.Pool, stmt string, args []any, fn func(*T) error) error {
+	ctx, cancel := context.WithTimeout(ctx, exportTimeout)
+	defer cancel()
+
+	rows, err := db.Query(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		v, err := pgx.RowToAddrOfStructByPos[T](rows)
+		if err != nil {
+			return err
+		}
+		if err = fn(v); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
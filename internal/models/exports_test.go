@@ -0,0 +1,64 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestExportModel(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users", "snippets")
+	m := ExportModel{DB: db}
+	ctx := context.Background()
+
+	_, err := db.Exec(ctx, `UPDATE snippets SET user_id = 1, private = true WHERE id = 2;
+                            INSERT INTO snippet_tags (snippet_id, tag) VALUES (2, 'winter'), (2, 'haiku');
+                            INSERT INTO snippet_views (snippet_id, day, views) VALUES (2, CURRENT_DATE, 3), (2, CURRENT_DATE - 1, 4)`)
+	assert.NilError(t, err)
+
+	var users []*ExportedUser
+	err = m.Users(ctx, func(u *ExportedUser) error {
+		users = append(users, u)
+		return nil
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, len(users), 2)
+	assert.Equal(t, users[0].Email, "alice@example.com")
+	assert.Equal(t, users[0].Snippets, 1)
+	assert.Equal(t, users[1].Role, RoleAdmin)
+
+	var snippets []*ExportedSnippet
+	collect := func(s *ExportedSnippet) error {
+		snippets = append(snippets, s)
+		return nil
+	}
+	assert.NilError(t, m.Snippets(ctx, 0, collect))
+	assert.Equal(t, len(snippets), 3)
+
+	// Only Alice's
+	snippets = nil
+	assert.NilError(t, m.Snippets(ctx, 1, collect))
+	assert.Equal(t, len(snippets), 1)
+	s := snippets[0]
+	assert.Equal(t, s.ID, 2)
+	assert.Equal(t, s.UserID, 1)
+	assert.DeepEqual(t, s.Tags, []string{"haiku", "winter"})
+	assert.Equal(t, s.Private, true)
+	assert.Equal(t, s.Views, 7)
+
+	// An error from fn stops the export
+	stop := errors.New("stop")
+	n := 0
+	err = m.Snippets(ctx, 0, func(s *ExportedSnippet) error {
+		n++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, n, 1)
+}
@@ -0,0 +1,171 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =============================================================================
+// Follow Model - Type Definitions
+// =============================================================================
+
+// FeedItem is a summary of a snippet in a user's feed, with its author
+type FeedItem struct {
+	*SnippetSummary
+	UserID        int // Author's ID
+	Author        string
+	AvatarVersion int // Version of the author's avatar; 0 if they haven't uploaded one
+}
+
+// FollowCounts is how many users follow a user, and how many they follow
+type FollowCounts struct {
+	Followers int
+	Following int
+}
+
+// FollowModelInterface defines the interface for follow operations
+type FollowModelInterface interface {
+	Follow(followerID, followedID int) (bool, error)
+	Unfollow(followerID, followedID int) error
+	IsFollowing(followerID, followedID int) (bool, error)
+	Counts(userID int) (FollowCounts, error)
+	Feed(userID, limit, offset int) ([]*FeedItem, int, error)
+}
+
+// FollowModel wraps a database connection pool
+type FollowModel struct {
+	DB *pgxpool.Pool
+
+	// Keys encrypts content at rest; nil stores it as plaintext
+	Keys *ContentKeys
+}
+
+// =============================================================================
+// Follow Model - Methods
+// =============================================================================
+
+// Follow makes followerID follow followedID. Returns true if they weren't
+// following already, in which case an EventUserFollowed event is written to
+// the outbox with the follow. Following a banned or non-existent user
+// returns ErrNoRecord.
+func (m *FollowModel) Follow(followerID, followedID int) (bool, error) {
+	stmt := `INSERT INTO follows (follower_id, followed_id, created)
+             SELECT $1, id, CURRENT_TIMESTAMP FROM users WHERE id = $2 AND NOT banned
+             ON CONFLICT (follower_id, followed_id) DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, stmt, followerID, followedID)
+	if err != nil {
+		return false, translateError(err)
+	}
+	if tag.RowsAffected() == 1 {
+		err = insertEvent(ctx, tx, EventUserFollowed, UserFollowedEvent{FollowerID: followerID, FollowedID: followedID})
+		if err != nil {
+			return false, err
+		}
+		if err = tx.Commit(ctx); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	// Nothing inserted: already following, or no such user
+	following, err := m.IsFollowing(followerID, followedID)
+	if err != nil {
+		return false, err
+	}
+	if !following {
+		return false, notFound("user", followedID)
+	}
+	return false, nil
+}
+
+// Unfollow stops followerID following followedID. Unfollowing someone not
+// followed does nothing.
+func (m *FollowModel) Unfollow(followerID, followedID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, "DELETE FROM follows WHERE follower_id = $1 AND followed_id = $2", followerID, followedID)
+	return err
+}
+
+// IsFollowing reports whether followerID follows followedID
+func (m *FollowModel) IsFollowing(followerID, followedID int) (bool, error) {
+	stmt := "SELECT EXISTS(SELECT true FROM follows WHERE follower_id = $1 AND followed_id = $2)"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var following bool
+	err := m.DB.QueryRow(ctx, stmt, followerID, followedID).Scan(&following)
+	return following, err
+}
+
+// Counts returns the number of followers and followed users of a user
+func (m *FollowModel) Counts(userID int) (FollowCounts, error) {
+	stmt := `SELECT (SELECT count(*) FROM follows WHERE followed_id = $1),
+                    (SELECT count(*) FROM follows WHERE follower_id = $1)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var c FollowCounts
+	err := m.DB.QueryRow(ctx, stmt, userID).Scan(&c.Followers, &c.Following)
+	return c, err
+}
+
+// Feed returns one page of public snippets by the users userID follows,
+// most recent first, and the total number of such snippets
+func (m *FollowModel) Feed(userID, limit, offset int) ([]*FeedItem, int, error) {
+	from := `FROM snippets s
+             JOIN follows f ON f.followed_id = s.user_id AND f.follower_id = $1
+             JOIN users u ON u.id = s.user_id
+             LEFT JOIN avatars a ON a.user_id = s.user_id
+             WHERE s.expires > CURRENT_TIMESTAMP AND NOT s.held AND NOT s.private AND NOT s.encrypted AND NOT u.banned`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var total int
+	err := m.DB.QueryRow(ctx, "SELECT count(*) "+from, userID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	stmt := `SELECT ` + summaryColumns + `, s.user_id, u.name, COALESCE(a.version, 0) ` + from + `
+             ORDER BY s.created DESC, s.id DESC
+             LIMIT $2 OFFSET $3`
+
+	rows, err := m.DB.Query(ctx, stmt, userID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	items := []*FeedItem{}
+	for rows.Next() {
+		item := &FeedItem{}
+		item.SnippetSummary, err = scanSummary(rows, m.Keys, &item.UserID, &item.Author, &item.AvatarVersion)
+		if err != nil {
+			return nil, 0, err
+		}
+		items = append(items, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return items, total, nil
+}
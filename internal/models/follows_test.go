@@ -0,0 +1,89 @@
+package models
+
+import (
+	"net/netip"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestFollowModel(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users")
+	m := FollowModel{DB: db}
+
+	followed, err := m.Follow(3, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, followed, true)
+
+	// Following again is a no-op
+	followed, err = m.Follow(3, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, followed, false)
+
+	_, err = m.Follow(3, 99)
+	assert.ErrorIs(t, err, ErrNoRecord)
+
+	following, err := m.IsFollowing(3, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, following, true)
+
+	following, err = m.IsFollowing(1, 3)
+	assert.NilError(t, err)
+	assert.Equal(t, following, false)
+
+	counts, err := m.Counts(1)
+	assert.NilError(t, err)
+	assert.Equal(t, counts, FollowCounts{Followers: 1})
+
+	assert.NilError(t, m.Unfollow(3, 1))
+	counts, err = m.Counts(3)
+	assert.NilError(t, err)
+	assert.Equal(t, counts, FollowCounts{})
+}
+
+func TestFollowModelFeed(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users")
+	snippets := SnippetModel{DB: db}
+	m := FollowModel{DB: db}
+
+	first, err := snippets.Insert(1, netip.Addr{}, "First", "One", 7, false, SnippetLimits{})
+	assert.NilError(t, err)
+	second, err := snippets.Insert(1, netip.Addr{}, "Second", "Two", 7, false, SnippetLimits{})
+	assert.NilError(t, err)
+	// Carol's own snippets aren't in her feed
+	_, err = snippets.Insert(3, netip.Addr{}, "Mine", "Three", 7, false, SnippetLimits{})
+	assert.NilError(t, err)
+
+	items, total, err := m.Feed(3, 10, 0)
+	assert.NilError(t, err)
+	assert.Equal(t, total, 0)
+	assert.Equal(t, len(items), 0)
+
+	_, err = m.Follow(3, 1)
+	assert.NilError(t, err)
+
+	items, total, err = m.Feed(3, 1, 0)
+	assert.NilError(t, err)
+	assert.Equal(t, total, 2)
+	assert.Equal(t, len(items), 1)
+	assert.Equal(t, items[0].ID, second)
+	assert.Equal(t, items[0].UserID, 1)
+	assert.Equal(t, items[0].Author, "Alice Jones")
+	assert.Equal(t, items[0].AvatarVersion, 0)
+
+	err = (&AvatarModel{DB: db}).Set(1, 4)
+	assert.NilError(t, err)
+
+	items, _, err = m.Feed(3, 1, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(items), 1)
+	assert.Equal(t, items[0].ID, first)
+	assert.Equal(t, items[0].AvatarVersion, 4)
+}
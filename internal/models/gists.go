@@ -0,0 +1,181 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =============================================================================
+// GitHub Gist Model - Type Definitions
+// =============================================================================
+
+// GitHubToken is the GitHub token a user connected to push snippets to
+// Gists
+type GitHubToken struct {
+	UserID  int
+	Token   string
+	Login   string // GitHub username the token belongs to
+	Created time.Time
+}
+
+// GistLink records that a snippet is pushed to a Gist
+type GistLink struct {
+	SnippetID int
+	UserID    int
+	GistID    string // Empty until the Gist has been created
+	URL       string
+	Sync      bool      // Push edits to the Gist too
+	Synced    time.Time // Zero until first pushed
+}
+
+// GistModelInterface defines the interface for GitHub Gist operations
+type GistModelInterface interface {
+	SetToken(userID int, token, login string) error
+	Token(userID int) (*GitHubToken, error)
+	DeleteToken(userID int) error
+	Link(snippetID, userID int, sync bool) error
+	GetLink(snippetID int) (*GistLink, error)
+	SetGist(snippetID int, gistID, url string) error
+}
+
+// GistModel wraps a database connection pool
+type GistModel struct {
+	DB *pgxpool.Pool
+
+	// Keys encrypts tokens at rest; nil stores them as plaintext
+	Keys *ContentKeys
+}
+
+// =============================================================================
+// GitHub Gist Model - Methods
+// =============================================================================
+
+// SetToken connects a GitHub token to a user, replacing any they had
+func (m *GistModel) SetToken(userID int, token, login string) error {
+	sealed, keyID, err := m.Keys.seal(token)
+	if err != nil {
+		return err
+	}
+
+	stmt := `INSERT INTO github_tokens (user_id, token, token_key, login, created)
+             VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+             ON CONFLICT (user_id) DO UPDATE
+             SET token = EXCLUDED.token, token_key = EXCLUDED.token_key,
+                 login = EXCLUDED.login, created = EXCLUDED.created`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.Exec(ctx, stmt, userID, sealed, keyID, login)
+	return err
+}
+
+// Token returns a user's GitHub token. Returns ErrNoRecord if they haven't
+// connected one.
+func (m *GistModel) Token(userID int) (*GitHubToken, error) {
+	stmt := `SELECT user_id, token, token_key, login, created
+             FROM github_tokens
+             WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	t := &GitHubToken{}
+	var keyID *string
+	err := m.DB.QueryRow(ctx, stmt, userID).Scan(&t.UserID, &t.Token, &keyID, &t.Login, &t.Created)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, notFound("GitHub token", userID)
+		}
+		return nil, err
+	}
+
+	t.Token, err = m.Keys.open(t.Token, keyID)
+	if err != nil {
+		return nil, fmt.Errorf("github token of user %d: %w", userID, err)
+	}
+	return t, nil
+}
+
+// DeleteToken disconnects a user's GitHub token. Their snippets stop
+// syncing, but the Gists already pushed are left alone. Returns
+// ErrNoRecord if they had no token.
+func (m *GistModel) DeleteToken(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tag, err := m.DB.Exec(ctx, "DELETE FROM github_tokens WHERE user_id = $1", userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("GitHub token", userID)
+	}
+
+	_, err = m.DB.Exec(ctx, "UPDATE snippet_gists SET sync = false WHERE user_id = $1", userID)
+	return err
+}
+
+// Link records that a snippet is to be pushed to a Gist by a user, and
+// whether its edits are too. A snippet already linked keeps its Gist.
+func (m *GistModel) Link(snippetID, userID int, sync bool) error {
+	stmt := `INSERT INTO snippet_gists (snippet_id, user_id, sync)
+             VALUES ($1, $2, $3)
+             ON CONFLICT (snippet_id) DO UPDATE
+             SET user_id = EXCLUDED.user_id, sync = EXCLUDED.sync`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, stmt, snippetID, userID, sync)
+	return err
+}
+
+// GetLink returns the Gist a snippet is pushed to. Returns ErrNoRecord if
+// it has never been pushed.
+func (m *GistModel) GetLink(snippetID int) (*GistLink, error) {
+	stmt := `SELECT snippet_id, user_id, gist_id, url, sync, synced
+             FROM snippet_gists
+             WHERE snippet_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	l := &GistLink{}
+	var synced *time.Time
+	err := m.DB.QueryRow(ctx, stmt, snippetID).Scan(&l.SnippetID, &l.UserID, &l.GistID, &l.URL, &l.Sync, &synced)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, notFound("Gist link", snippetID)
+		}
+		return nil, err
+	}
+	if synced != nil {
+		l.Synced = *synced
+	}
+	return l, nil
+}
+
+// SetGist records the Gist a snippet was pushed to, and when. Returns
+// ErrNoRecord if the snippet isn't linked.
+func (m *GistModel) SetGist(snippetID int, gistID, url string) error {
+	stmt := `UPDATE snippet_gists SET gist_id = $2, url = $3, synced = CURRENT_TIMESTAMP
+             WHERE snippet_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tag, err := m.DB.Exec(ctx, stmt, snippetID, gistID, url)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("Gist link", snippetID)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestGistModelToken(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users")
+	m := GistModel{DB: db, Keys: testContentKeys(t, "k1")}
+
+	_, err := m.Token(1)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	assert.NilError(t, m.SetToken(1, "ghp_old", "alice"))
+	assert.NilError(t, m.SetToken(1, "ghp_new", "alice"))
+
+	token, err := m.Token(1)
+	assert.NilError(t, err)
+	assert.Equal(t, token.Token, "ghp_new")
+	assert.Equal(t, token.Login, "alice")
+
+	// The token is sealed at rest
+	var stored string
+	err = db.QueryRow(context.Background(), "SELECT token FROM github_tokens WHERE user_id = 1").Scan(&stored)
+	assert.NilError(t, err)
+	if stored == "ghp_new" {
+		t.Error("token stored as plaintext")
+	}
+
+	assert.NilError(t, m.DeleteToken(1))
+	assert.Equal(t, errors.Is(m.DeleteToken(1), ErrNoRecord), true)
+}
+
+func TestGistModelLink(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users", "snippets")
+	m := GistModel{DB: db}
+
+	_, err := m.GetLink(1)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	assert.Equal(t, errors.Is(m.SetGist(1, "abc", "https://gist.github.com/abc"), ErrNoRecord), true)
+
+	assert.NilError(t, m.Link(1, 1, true))
+	link, err := m.GetLink(1)
+	assert.NilError(t, err)
+	assert.Equal(t, link.GistID, "")
+	assert.Equal(t, link.Sync, true)
+	assert.Equal(t, link.Synced.IsZero(), true)
+
+	assert.NilError(t, m.SetGist(1, "abc", "https://gist.github.com/abc"))
+
+	// Linking again keeps the Gist
+	assert.NilError(t, m.Link(1, 1, false))
+	link, err = m.GetLink(1)
+	assert.NilError(t, err)
+	assert.Equal(t, link.GistID, "abc")
+	assert.Equal(t, link.URL, "https://gist.github.com/abc")
+	assert.Equal(t, link.Sync, false)
+	assert.Equal(t, link.Synced.IsZero(), false)
+
+	// Disconnecting GitHub stops syncing
+	assert.NilError(t, m.Link(1, 1, true))
+	assert.NilError(t, m.SetToken(1, "ghp_token", "alice"))
+	assert.NilError(t, m.DeleteToken(1))
+	link, err = m.GetLink(1)
+	assert.NilError(t, err)
+	assert.Equal(t, link.Sync, false)
+}
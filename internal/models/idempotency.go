@@ -0,0 +1,131 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =============================================================================
+// Idempotency Key Model - Type Definitions
+// =============================================================================
+
+const (
+	// IdempotencyKeyLifetime is how long a key is remembered after the
+	// submission it came with. A later submission with the key is new.
+	IdempotencyKeyLifetime = 24 * time.Hour
+
+	// idempotencyClaimTimeout is how long a key stays claimed without a
+	// result before another submission may take it over, in case the
+	// first one never finished
+	idempotencyClaimTimeout = time.Minute
+)
+
+// ErrKeyInProgress is returned when claiming an idempotency key that another
+// submission has claimed but not finished with
+var ErrKeyInProgress = errors.New("models: idempotency key in use by a submission in progress")
+
+// IdempotencyModelInterface defines the interface for idempotency key
+// operations. A scope keeps the keys of different clients apart.
+type IdempotencyModelInterface interface {
+	Claim(scope, key string) (int, error)
+	Complete(scope, key string, snippetID int) error
+	Release(scope, key string) error
+	Prune() (int64, error)
+}
+
+// IdempotencyModel wraps a database connection pool
+type IdempotencyModel struct {
+	DB *pgxpool.Pool
+}
+
+// =============================================================================
+// Idempotency Key Model - Methods
+// =============================================================================
+
+// Claim claims key for a submission. It returns 0 if the submission should
+// go ahead, the ID of the snippet an earlier submission with the key
+// created, or ErrKeyInProgress if an earlier submission hasn't finished.
+func (m *IdempotencyModel) Claim(scope, key string) (int, error) {
+	stmt := `INSERT INTO idempotency_keys (scope, key, created)
+             VALUES ($1, $2, CURRENT_TIMESTAMP)
+             ON CONFLICT (scope, key) DO UPDATE
+             SET snippet_id = NULL, created = CURRENT_TIMESTAMP
+             WHERE idempotency_keys.created < CURRENT_TIMESTAMP - make_interval(secs => $3)
+                OR (idempotency_keys.snippet_id IS NULL
+                    AND idempotency_keys.created < CURRENT_TIMESTAMP - make_interval(secs => $4))
+             RETURNING true`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var claimed bool
+	err := m.DB.QueryRow(ctx, stmt, scope, key,
+		IdempotencyKeyLifetime.Seconds(), idempotencyClaimTimeout.Seconds()).Scan(&claimed)
+	if err == nil {
+		return 0, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return 0, err
+	}
+
+	// The key is taken; see whether its submission has finished
+	var snippetID *int
+	err = m.DB.QueryRow(ctx, "SELECT snippet_id FROM idempotency_keys WHERE scope = $1 AND key = $2",
+		scope, key).Scan(&snippetID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return 0, err
+	}
+	// A released key is free again, but the caller has to claim it again
+	if snippetID == nil {
+		return 0, ErrKeyInProgress
+	}
+
+	return *snippetID, nil
+}
+
+// Complete records the snippet created by the submission that claimed key
+func (m *IdempotencyModel) Complete(scope, key string, snippetID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tag, err := m.DB.Exec(ctx, "UPDATE idempotency_keys SET snippet_id = $3 WHERE scope = $1 AND key = $2",
+		scope, key, snippetID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("idempotency key", key)
+	}
+
+	return nil
+}
+
+// Release frees a key whose submission didn't create a snippet, so it can
+// be retried. Keys that did create one are left alone.
+func (m *IdempotencyModel) Release(scope, key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, "DELETE FROM idempotency_keys WHERE scope = $1 AND key = $2 AND snippet_id IS NULL",
+		scope, key)
+	return err
+}
+
+// Prune deletes keys older than IdempotencyKeyLifetime, returning how many
+// it deleted
+func (m *IdempotencyModel) Prune() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tag, err := m.DB.Exec(ctx, "DELETE FROM idempotency_keys WHERE created < CURRENT_TIMESTAMP - make_interval(secs => $1)",
+		IdempotencyKeyLifetime.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
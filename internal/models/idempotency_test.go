@@ -0,0 +1,60 @@
+package models
+
+import (
+	"context"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+)
+
+func TestIdempotencyModel(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	m := IdempotencyModel{DB: db}
+
+	// The first submission goes ahead; a second waits for it
+	id, err := m.Claim("user:1", "k1")
+	assert.NilError(t, err)
+	assert.Equal(t, id, 0)
+	_, err = m.Claim("user:1", "k1")
+	assert.ErrorIs(t, err, ErrKeyInProgress)
+
+	// Other scopes have keys of their own
+	id, err = m.Claim("user:2", "k1")
+	assert.NilError(t, err)
+	assert.Equal(t, id, 0)
+
+	// Once complete, the key returns the snippet
+	assert.NilError(t, m.Complete("user:1", "k1", 42))
+	id, err = m.Claim("user:1", "k1")
+	assert.NilError(t, err)
+	assert.Equal(t, id, 42)
+	assert.ErrorIs(t, m.Complete("user:1", "missing", 1), ErrNoRecord)
+
+	// Released keys can be claimed again, but completed ones stay
+	assert.NilError(t, m.Release("user:2", "k1"))
+	id, err = m.Claim("user:2", "k1")
+	assert.NilError(t, err)
+	assert.Equal(t, id, 0)
+	assert.NilError(t, m.Release("user:1", "k1"))
+	id, err = m.Claim("user:1", "k1")
+	assert.NilError(t, err)
+	assert.Equal(t, id, 42)
+
+	// Abandoned claims are taken over, and old keys forgotten
+	_, err = db.Exec(context.Background(), `UPDATE idempotency_keys SET created = created - INTERVAL '2 minutes' WHERE scope = 'user:2'`)
+	assert.NilError(t, err)
+	id, err = m.Claim("user:2", "k1")
+	assert.NilError(t, err)
+	assert.Equal(t, id, 0)
+
+	_, err = db.Exec(context.Background(), `UPDATE idempotency_keys SET created = created - INTERVAL '25 hours' WHERE scope = 'user:1'`)
+	assert.NilError(t, err)
+	n, err := m.Prune()
+	assert.NilError(t, err)
+	assert.Equal(t, n, int64(1))
+	id, err = m.Claim("user:1", "k1")
+	assert.NilError(t, err)
+	assert.Equal(t, id, 0)
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =============================================================================
+// Notification Model - Type Definitions
+// =============================================================================
+
+// Notification is an in-app notice that another user did something that
+// concerns the recipient, such as following them
+type Notification struct {
+	ID      int
+	Kind    string // One of the Notify* kinds
+	ActorID int
+	Actor   string // Name of the user who caused the notification
+	Link    string // Path of the page the notification is about
+	Detail  string // Kind-specific text, such as a snippet title
+	Created time.Time
+	Read    bool
+}
+
+// NotificationModelInterface defines the interface for in-app notification
+// operations
+type NotificationModelInterface interface {
+	Insert(userID, actorID int, kind, link, detail string) error
+	Recent(userID, limit int) ([]*Notification, error)
+	UnreadCount(userID int) (int, error)
+	MarkAllRead(userID int) error
+}
+
+// NotificationModel wraps a database connection pool
+type NotificationModel struct {
+	DB *pgxpool.Pool
+}
+
+// =============================================================================
+// Notification Model - Methods
+// =============================================================================
+
+// Insert records an unread notification for userID
+func (m *NotificationModel) Insert(userID, actorID int, kind, link, detail string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return insertNotification(ctx, m.DB, userID, actorID, kind, link, detail)
+}
+
+// insertNotification records an unread notification using q, which may be a
+// transaction
+func insertNotification(ctx context.Context, q querier, userID, actorID int, kind, link, detail string) error {
+	stmt := `INSERT INTO notifications (user_id, actor_id, kind, link, detail, created)
+             VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)`
+
+	_, err := q.Exec(ctx, stmt, userID, actorID, kind, link, detail)
+	return err
+}
+
+// Recent returns a user's most recent notifications, newest first
+func (m *NotificationModel) Recent(userID, limit int) ([]*Notification, error) {
+	stmt := `SELECT n.id, n.kind, n.actor_id, u.name, n.link, n.detail, n.created, n.read
+             FROM notifications n
+             JOIN users u ON u.id = n.actor_id
+             WHERE n.user_id = $1
+             ORDER BY n.id DESC
+             LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, stmt, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []*Notification{}
+	for rows.Next() {
+		n := &Notification{}
+		err = rows.Scan(&n.ID, &n.Kind, &n.ActorID, &n.Actor, &n.Link, &n.Detail, &n.Created, &n.Read)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+// UnreadCount returns how many of a user's notifications are unread
+func (m *NotificationModel) UnreadCount(userID int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var count int
+	err := m.DB.QueryRow(ctx, "SELECT count(*) FROM notifications WHERE user_id = $1 AND NOT read", userID).Scan(&count)
+	return count, err
+}
+
+// MarkAllRead marks all of a user's notifications as read
+func (m *NotificationModel) MarkAllRead(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, "UPDATE notifications SET read = true WHERE user_id = $1 AND NOT read", userID)
+	return err
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestNotificationModel(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users")
+	m := NotificationModel{DB: db}
+
+	assert.NilError(t, m.Insert(1, 3, NotifyFollowers, "/user/profile/3", ""))
+	assert.NilError(t, m.Insert(1, 3, NotifyComments, "/snippet/view/1", "An old silent pond"))
+
+	count, err := m.UnreadCount(1)
+	assert.NilError(t, err)
+	assert.Equal(t, count, 2)
+
+	notifications, err := m.Recent(1, 10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(notifications), 2)
+	assert.Equal(t, notifications[0].Kind, NotifyComments)
+	assert.Equal(t, notifications[0].Actor, "Carol Admin")
+	assert.Equal(t, notifications[0].Detail, "An old silent pond")
+	assert.Equal(t, notifications[0].Read, false)
+
+	assert.NilError(t, m.MarkAllRead(1))
+	count, err = m.UnreadCount(1)
+	assert.NilError(t, err)
+	assert.Equal(t, count, 0)
+
+	notifications, err = m.Recent(3, 10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(notifications), 0)
+}
@@ -0,0 +1,209 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =============================================================================
+// Job Model - Type Definitions
+// =============================================================================
+
+// Job statuses
+const (
+	JobPending = "pending" // Waiting for run_at (new or scheduled for retry)
+	JobRunning = "running" // Claimed by a worker
+	JobDone    = "done"
+	JobFailed  = "failed" // Gave up: permanent error or out of attempts
+)
+
+// jobLease is how long a claimed job may run before another worker assumes
+// its worker died and claims it again
+const jobLease = 10 * time.Minute
+
+// Job is a unit of background work stored in the jobs table
+type Job struct {
+	ID          int
+	Kind        string
+	Payload     json.RawMessage
+	Status      string
+	Attempts    int
+	MaxAttempts int
+	LastError   string
+	Done        int // Progress through Total units of work, if the job reports it
+	Total       int
+	RunAt       time.Time
+	Created     time.Time
+	Updated     time.Time
+}
+
+// JobModelInterface defines the interface for job queue operations
+type JobModelInterface interface {
+	Enqueue(kind string, payload any, maxAttempts int) (int, error)
+	Claim() (*Job, error)
+	Complete(id int) error
+	Retry(id int, delay time.Duration, errMsg string) error
+	Fail(id int, errMsg string) error
+	Progress(id, done, total int) error
+	Recent(kind string, limit int) ([]*Job, error)
+}
+
+// JobModel wraps a database connection pool
+type JobModel struct {
+	DB *pgxpool.Pool
+}
+
+// =============================================================================
+// Job Model - Methods
+// =============================================================================
+
+// Enqueue stores a new job to run as soon as a worker is free. The payload
+// is stored as JSON.
+func (m *JobModel) Enqueue(kind string, payload any, maxAttempts int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return insertJob(ctx, m.DB, kind, payload, maxAttempts)
+}
+
+// insertJob stores a new job using q, which may be a transaction
+func insertJob(ctx context.Context, q querier, kind string, payload any, maxAttempts int) (int, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt := `INSERT INTO jobs (kind, payload, max_attempts)
+             VALUES ($1, $2, $3)
+             RETURNING id`
+
+	var id int
+	err = q.QueryRow(ctx, stmt, kind, data, maxAttempts).Scan(&id)
+	return id, err
+}
+
+// Claim marks the next due job as running, counts the attempt and returns
+// it. Jobs stuck in running for longer than the lease are claimed again.
+//
+// Returns ErrNoRecord if no job is due. Concurrent workers never claim the
+// same job.
+func (m *JobModel) Claim() (*Job, error) {
+	stmt := `UPDATE jobs
+             SET status = 'running', attempts = attempts + 1, progress_done = 0, progress_total = 0,
+                 updated = CURRENT_TIMESTAMP
+             WHERE id = (
+                 SELECT id FROM jobs
+                 WHERE (status = 'pending' AND run_at <= CURRENT_TIMESTAMP)
+                    OR (status = 'running' AND updated < CURRENT_TIMESTAMP - make_interval(secs => $1))
+                 ORDER BY run_at, id
+                 LIMIT 1
+                 FOR UPDATE SKIP LOCKED
+             )
+             RETURNING id, kind, payload, status, attempts, max_attempts, last_error, progress_done, progress_total,
+                       run_at, created, updated`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	j := &Job{}
+	err := m.DB.QueryRow(ctx, stmt, jobLease.Seconds()).Scan(&j.ID, &j.Kind, &j.Payload, &j.Status,
+		&j.Attempts, &j.MaxAttempts, &j.LastError, &j.Done, &j.Total, &j.RunAt, &j.Created, &j.Updated)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, notFound("due job", nil)
+		}
+		return nil, err
+	}
+
+	return j, nil
+}
+
+// Complete marks a job as done
+func (m *JobModel) Complete(id int) error {
+	return m.setStatus(id, JobDone, "", 0)
+}
+
+// Retry puts a job back in the queue to run again after delay, recording
+// the error from the failed attempt
+func (m *JobModel) Retry(id int, delay time.Duration, errMsg string) error {
+	return m.setStatus(id, JobPending, errMsg, delay)
+}
+
+// Fail marks a job as permanently failed with the given error
+func (m *JobModel) Fail(id int, errMsg string) error {
+	return m.setStatus(id, JobFailed, errMsg, 0)
+}
+
+// Progress records that a running job has done done of total units of
+// work. It also renews the job's lease, so a long job that reports its
+// progress isn't claimed again while it runs. Claiming a job resets its
+// progress.
+func (m *JobModel) Progress(id, done, total int) error {
+	stmt := `UPDATE jobs
+             SET progress_done = $2, progress_total = $3, updated = CURRENT_TIMESTAMP
+             WHERE id = $1 AND status = 'running'`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, stmt, id, done, total)
+	return err
+}
+
+// Recent returns the most recently created jobs of the given kind, newest
+// first
+func (m *JobModel) Recent(kind string, limit int) ([]*Job, error) {
+	stmt := `SELECT id, kind, payload, status, attempts, max_attempts, last_error, progress_done, progress_total,
+                    run_at, created, updated
+             FROM jobs
+             WHERE kind = $1
+             ORDER BY id DESC
+             LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, stmt, kind, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []*Job{}
+	for rows.Next() {
+		j := &Job{}
+		err = rows.Scan(&j.ID, &j.Kind, &j.Payload, &j.Status, &j.Attempts, &j.MaxAttempts,
+			&j.LastError, &j.Done, &j.Total, &j.RunAt, &j.Created, &j.Updated)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// setStatus updates a job's status and error, and sets run_at to delay
+// from now
+func (m *JobModel) setStatus(id int, status, errMsg string, delay time.Duration) error {
+	stmt := `UPDATE jobs
+             SET status = $2, last_error = $3,
+                 run_at = CURRENT_TIMESTAMP + make_interval(secs => $4),
+                 updated = CURRENT_TIMESTAMP
+             WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, stmt, id, status, errMsg, delay.Seconds())
+	return err
+}
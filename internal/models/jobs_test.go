@@ -0,0 +1,83 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"adotkaya.playground/internal/assert"
+)
+
+func TestJobModelQueue(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	m := JobModel{DB: db}
+
+	id, err := m.Enqueue("email", map[string]string{"recipient": "bob@example.com"}, 3)
+	assert.NilError(t, err)
+
+	// Claiming counts the attempt and hides the job from other workers
+	job, err := m.Claim()
+	assert.NilError(t, err)
+	assert.Equal(t, job.ID, id)
+	assert.Equal(t, job.Status, JobRunning)
+	assert.Equal(t, job.Attempts, 1)
+	assert.StringContains(t, string(job.Payload), `"recipient": "bob@example.com"`)
+
+	_, err = m.Claim()
+	assert.ErrorIs(t, err, ErrNoRecord)
+
+	// A retry scheduled in the future isn't due yet
+	err = m.Retry(id, time.Hour, "connection refused")
+	assert.NilError(t, err)
+	_, err = m.Claim()
+	assert.ErrorIs(t, err, ErrNoRecord)
+
+	// ...but one with no delay is
+	err = m.Retry(id, 0, "connection refused")
+	assert.NilError(t, err)
+	job, err = m.Claim()
+	assert.NilError(t, err)
+	assert.Equal(t, job.Attempts, 2)
+	assert.Equal(t, job.LastError, "connection refused")
+
+	err = m.Fail(id, "550 no such user")
+	assert.NilError(t, err)
+
+	jobs, err := m.Recent("email", 10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(jobs), 1)
+	assert.Equal(t, jobs[0].Status, JobFailed)
+	assert.Equal(t, jobs[0].LastError, "550 no such user")
+}
+
+func TestJobModelProgress(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	m := JobModel{DB: db}
+
+	id, err := m.Enqueue("reindex", struct{}{}, 3)
+	assert.NilError(t, err)
+
+	// Only running jobs record progress
+	assert.NilError(t, m.Progress(id, 1, 4))
+	jobs, err := m.Recent("reindex", 1)
+	assert.NilError(t, err)
+	assert.Equal(t, jobs[0].Total, 0)
+
+	_, err = m.Claim()
+	assert.NilError(t, err)
+	assert.NilError(t, m.Progress(id, 3, 4))
+	jobs, err = m.Recent("reindex", 1)
+	assert.NilError(t, err)
+	assert.Equal(t, jobs[0].Done, 3)
+	assert.Equal(t, jobs[0].Total, 4)
+
+	// Claiming the job again starts it over
+	assert.NilError(t, m.Retry(id, 0, "connection reset"))
+	job, err := m.Claim()
+	assert.NilError(t, err)
+	assert.Equal(t, job.Done, 0)
+	assert.Equal(t, job.Total, 0)
+}
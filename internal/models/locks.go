@@ -0,0 +1,100 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =============================================================================
+// Advisory Locks
+// =============================================================================
+// A session-level Postgres advisory lock is held by the connection that took
+// it until it is unlocked or the connection closes, including when the
+// process holding it dies. Instances sharing a database use one to agree
+// which of them does something only one should, such as running scheduled
+// tasks.
+
+// ErrLockLost is returned by Check when the connection holding a lock has
+// gone, taking the lock with it
+var ErrLockLost = errors.New("models: advisory lock lost")
+
+// AdvisoryLock is a session-level advisory lock on Key, held on a
+// connection of its own taken from DB. It is not safe for concurrent use.
+type AdvisoryLock struct {
+	DB  *pgxpool.Pool
+	Key int64
+
+	conn *pgxpool.Conn // Holding the lock; nil while it isn't held
+}
+
+// TryAcquire takes the lock if no other session holds it, without waiting,
+// and reports whether it is now held
+func (l *AdvisoryLock) TryAcquire() (bool, error) {
+	if l.conn != nil {
+		return true, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	conn, err := l.DB.Acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var acquired bool
+	err = conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", l.Key).Scan(&acquired)
+	if err != nil || !acquired {
+		conn.Release()
+		return false, err
+	}
+
+	l.conn = conn
+	return true, nil
+}
+
+// Check confirms the lock is still held, returning ErrLockLost if its
+// connection has failed. The lock is then no longer held, though another
+// session may not be able to take it until the server notices the
+// connection is gone.
+func (l *AdvisoryLock) Check() error {
+	if l.conn == nil {
+		return ErrLockLost
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := l.conn.Ping(ctx); err != nil {
+		// Close the connection rather than return it to the pool, in case
+		// it is only slow and still holds the lock
+		l.conn.Conn().Close(context.Background())
+		l.conn.Release()
+		l.conn = nil
+		return errors.Join(ErrLockLost, err)
+	}
+	return nil
+}
+
+// Release unlocks the lock if it is held, and returns its connection to
+// the pool
+func (l *AdvisoryLock) Release() error {
+	if l.conn == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := l.conn.Exec(ctx, "SELECT pg_advisory_unlock($1)", l.Key)
+	if err != nil {
+		// Closing the connection unlocks it too
+		l.conn.Conn().Close(context.Background())
+	}
+	l.conn.Release()
+	l.conn = nil
+	return err
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+)
+
+func TestAdvisoryLock(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	first := &AdvisoryLock{DB: db, Key: 42}
+	second := &AdvisoryLock{DB: db, Key: 42}
+	other := &AdvisoryLock{DB: db, Key: 43}
+	t.Cleanup(func() {
+		first.Release()
+		second.Release()
+		other.Release()
+	})
+
+	assert.ErrorIs(t, first.Check(), ErrLockLost)
+
+	ok, err := first.TryAcquire()
+	assert.NilError(t, err)
+	assert.Equal(t, ok, true)
+	assert.NilError(t, first.Check())
+
+	// Taking it again is a no-op for the holder, and fails for anyone else
+	ok, err = first.TryAcquire()
+	assert.NilError(t, err)
+	assert.Equal(t, ok, true)
+	ok, err = second.TryAcquire()
+	assert.NilError(t, err)
+	assert.Equal(t, ok, false)
+
+	// Other keys are separate locks
+	ok, err = other.TryAcquire()
+	assert.NilError(t, err)
+	assert.Equal(t, ok, true)
+
+	// Once released, someone else can take it
+	assert.NilError(t, first.Release())
+	assert.ErrorIs(t, first.Check(), ErrLockLost)
+	ok, err = second.TryAcquire()
+	assert.NilError(t, err)
+	assert.Equal(t, ok, true)
+}
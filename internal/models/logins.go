@@ -0,0 +1,165 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =============================================================================
+// Login Event Model - Type Definitions
+// =============================================================================
+
+const (
+	// LoginHistoryWindow is how far back logins are looked at to decide
+	// whether a device or country is familiar
+	LoginHistoryWindow = 90 * 24 * time.Hour
+
+	// LoginConfirmationLifetime is how long a login awaiting confirmation
+	// can be confirmed
+	LoginConfirmationLifetime = 30 * time.Minute
+)
+
+// LoginEvent is a password login
+type LoginEvent struct {
+	ID         int64
+	UserID     int
+	IP         netip.Addr
+	UserAgent  string
+	Country    string // ISO 3166 country code, or "" if unknown
+	NewDevice  bool   // The user agent wasn't seen in recent logins
+	NewCountry bool   // The country wasn't seen in recent logins
+	Confirmed  bool   // False while awaiting confirmation by email
+	Created    time.Time
+}
+
+// Unfamiliar reports whether the login came from a new device or country
+func (e *LoginEvent) Unfamiliar() bool {
+	return e.NewDevice || e.NewCountry
+}
+
+// LoginEventModelInterface defines the interface for login event operations
+type LoginEventModelInterface interface {
+	Familiarity(userID int, userAgent, country string) (newDevice, newCountry bool, err error)
+	Insert(e *LoginEvent) (int64, error)
+	Confirm(id int64) (int, error)
+	Recent(userID, limit int) ([]*LoginEvent, error)
+}
+
+// LoginEventModel wraps a database connection pool
+type LoginEventModel struct {
+	DB *pgxpool.Pool
+}
+
+// =============================================================================
+// Login Event Model - Methods
+// =============================================================================
+
+// Familiarity compares a login with the user's confirmed logins within
+// LoginHistoryWindow, reporting whether its user agent and country are new.
+// A user's first login is never new, nor is the country when it, or that of
+// every earlier login, is unknown.
+func (m *LoginEventModel) Familiarity(userID int, userAgent, country string) (bool, bool, error) {
+	stmt := `SELECT COUNT(*) > 0,
+                    COALESCE(bool_or(user_agent = $2), false),
+                    COALESCE(bool_or(country IS NOT NULL), false),
+                    COALESCE(bool_or(country = $3), false)
+             FROM login_events
+             WHERE user_id = $1 AND confirmed AND created > CURRENT_TIMESTAMP - make_interval(secs => $4)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var history, seenDevice, knownCountries, seenCountry bool
+	window := LoginHistoryWindow.Seconds()
+	err := m.DB.QueryRow(ctx, stmt, userID, userAgent, country, window).Scan(&history, &seenDevice, &knownCountries, &seenCountry)
+	if err != nil || !history {
+		return false, false, err
+	}
+
+	newCountry := country != "" && knownCountries && !seenCountry
+	return !seenDevice, newCountry, nil
+}
+
+// Insert records a login. Returns its ID.
+func (m *LoginEventModel) Insert(e *LoginEvent) (int64, error) {
+	stmt := `INSERT INTO login_events (user_id, ip, user_agent, country, new_device, new_country, confirmed, created)
+             VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, CURRENT_TIMESTAMP)
+             RETURNING id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var ip any
+	if e.IP.IsValid() {
+		ip = e.IP
+	}
+
+	var id int64
+	err := m.DB.QueryRow(ctx, stmt, e.UserID, ip, e.UserAgent, e.Country, e.NewDevice, e.NewCountry, e.Confirmed).Scan(&id)
+	return id, err
+}
+
+// Confirm confirms a login awaiting confirmation, returning its user's ID.
+// Returns ErrNoRecord if there is no such login, it is already confirmed,
+// or it is older than LoginConfirmationLifetime.
+func (m *LoginEventModel) Confirm(id int64) (int, error) {
+	stmt := `UPDATE login_events SET confirmed = true
+             WHERE id = $1 AND NOT confirmed AND created > CURRENT_TIMESTAMP - make_interval(secs => $2)
+             RETURNING user_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var userID int
+	err := m.DB.QueryRow(ctx, stmt, id, LoginConfirmationLifetime.Seconds()).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, notFound("login", id)
+		}
+		return 0, err
+	}
+	return userID, nil
+}
+
+// Recent returns up to limit of a user's latest logins, newest first
+func (m *LoginEventModel) Recent(userID, limit int) ([]*LoginEvent, error) {
+	stmt := `SELECT id, user_id, ip, user_agent, COALESCE(country, ''), new_device, new_country, confirmed, created
+             FROM login_events
+             WHERE user_id = $1
+             ORDER BY id DESC
+             LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, stmt, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*LoginEvent{}
+	for rows.Next() {
+		e := &LoginEvent{}
+		var ip *netip.Addr
+		err = rows.Scan(&e.ID, &e.UserID, &ip, &e.UserAgent, &e.Country, &e.NewDevice, &e.NewCountry, &e.Confirmed, &e.Created)
+		if err != nil {
+			return nil, err
+		}
+		if ip != nil {
+			e.IP = *ip
+		}
+		events = append(events, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
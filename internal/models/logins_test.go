@@ -0,0 +1,86 @@
+package models
+
+import (
+	"net/netip"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestLoginEventModel(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users")
+	m := LoginEventModel{DB: db}
+
+	const laptop, phone = "Firefox on Linux", "Safari on iPhone"
+	ip := netip.MustParseAddr("192.0.2.1")
+
+	// The first login is never new
+	newDevice, newCountry, err := m.Familiarity(1, laptop, "DE")
+	assert.NilError(t, err)
+	assert.Equal(t, newDevice, false)
+	assert.Equal(t, newCountry, false)
+	_, err = m.Insert(&LoginEvent{UserID: 1, IP: ip, UserAgent: laptop, Country: "DE", Confirmed: true})
+	assert.NilError(t, err)
+
+	tests := []struct {
+		name           string
+		userAgent      string
+		country        string
+		wantNewDevice  bool
+		wantNewCountry bool
+	}{
+		{"Same device and country", laptop, "DE", false, false},
+		{"New device", phone, "DE", true, false},
+		{"New country", laptop, "FR", false, true},
+		{"Unknown country", laptop, "", false, false},
+	}
+	for _, tt := range tests {
+		newDevice, newCountry, err := m.Familiarity(1, tt.userAgent, tt.country)
+		assert.NilError(t, err)
+		assert.Equal(t, newDevice, tt.wantNewDevice)
+		assert.Equal(t, newCountry, tt.wantNewCountry)
+	}
+
+	// Logins awaiting confirmation don't make a device familiar until they
+	// are confirmed, which they can be only once
+	id, err := m.Insert(&LoginEvent{UserID: 1, IP: ip, UserAgent: phone, NewDevice: true})
+	assert.NilError(t, err)
+	newDevice, _, err = m.Familiarity(1, phone, "")
+	assert.NilError(t, err)
+	assert.Equal(t, newDevice, true)
+
+	userID, err := m.Confirm(id)
+	assert.NilError(t, err)
+	assert.Equal(t, userID, 1)
+	_, err = m.Confirm(id)
+	assert.ErrorIs(t, err, ErrNoRecord)
+	newDevice, _, err = m.Familiarity(1, phone, "")
+	assert.NilError(t, err)
+	assert.Equal(t, newDevice, false)
+
+	events, err := m.Recent(1, 10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(events), 2)
+	assert.Equal(t, events[0].UserAgent, phone)
+	assert.Equal(t, events[0].NewDevice, true)
+	assert.Equal(t, events[0].Country, "")
+	assert.Equal(t, events[1].IP, ip)
+	assert.Equal(t, events[1].Country, "DE")
+}
+
+func TestUserModelSetConfirmNewDevices(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users")
+	m := UserModel{DB: db}
+
+	assert.NilError(t, m.SetConfirmNewDevices(1, true))
+	user, err := m.Get(1)
+	assert.NilError(t, err)
+	assert.Equal(t, user.ConfirmNewDevices, true)
+}
@@ -0,0 +1,171 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =============================================================================
+// Maintenance Model - Type Definitions
+// =============================================================================
+// Upkeep run on demand by an admin or from the command line: rebuilding the
+// full-text search index and deleting data that has expired. Each works in
+// batches, so the site stays up while it runs and it can report progress.
+
+// PruneStats counts the expired rows PruneExpired deleted
+type PruneStats struct {
+	Sessions int64
+	Bans     int64 // Temporary IP bans that have run out
+	Jobs     int64 // Finished jobs older than the retention period
+	Events   int64 // Delivered outbox events older than the retention period
+}
+
+// MaintenanceModelInterface defines the interface for maintenance operations
+type MaintenanceModelInterface interface {
+	CountSnippets() (int, error)
+	RebuildSearch(afterID, limit int) (int, int, error)
+	CountExpiredSnippets(retention time.Duration) (int, error)
+	PruneSnippets(retention time.Duration, limit int) (int, []string, error)
+	PruneExpired(jobRetention time.Duration) (PruneStats, error)
+}
+
+// MaintenanceModel wraps a database connection pool
+type MaintenanceModel struct {
+	DB *pgxpool.Pool
+}
+
+// =============================================================================
+// Maintenance Model - Methods
+// =============================================================================
+
+// CountSnippets returns how many snippets there are, expired or not, for
+// reporting the progress of a search index rebuild
+func (m *MaintenanceModel) CountSnippets() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var n int
+	err := m.DB.QueryRow(ctx, "SELECT count(*) FROM snippets").Scan(&n)
+	return n, err
+}
+
+// RebuildSearch recomputes the search vectors of up to limit snippets with
+// IDs after afterID, in ID order. It returns the last ID it rebuilt, to
+// pass as afterID for the next batch, and how many it rebuilt; fewer than
+// limit means it reached the end.
+//
+// Snippets written since the search index was added keep their vectors up
+// to date, so this fills in older snippets' and picks up changes to how
+// vectors are computed.
+func (m *MaintenanceModel) RebuildSearch(afterID, limit int) (int, int, error) {
+	stmt := `WITH batch AS (
+                 SELECT id FROM snippets
+                 WHERE id > $1
+                 ORDER BY id
+                 LIMIT $2
+                 FOR UPDATE
+             ), rebuilt AS (
+                 UPDATE snippets s
+                 SET search_vector = snippet_search_vector(s.title, s.content, s.content_key, s.encrypted)
+                 FROM batch
+                 WHERE s.id = batch.id
+                 RETURNING s.id
+             )
+             SELECT COALESCE(MAX(id), $1), count(*) FROM rebuilt`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var last, n int
+	err := m.DB.QueryRow(ctx, stmt, afterID, limit).Scan(&last, &n)
+	return last, n, err
+}
+
+// CountExpiredSnippets returns how many snippets expired longer ago than
+// retention
+func (m *MaintenanceModel) CountExpiredSnippets(retention time.Duration) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var n int
+	err := m.DB.QueryRow(ctx, "SELECT count(*) FROM snippets WHERE expires < CURRENT_TIMESTAMP - make_interval(secs => $1)",
+		retention.Seconds()).Scan(&n)
+	return n, err
+}
+
+// PruneSnippets deletes up to limit snippets that expired longer ago than
+// retention, with everything that belongs to them. It returns how many it
+// deleted and the object store keys of their attachments, whose files the
+// caller should delete. Several instances can run it at once.
+//
+// Expired snippets are never shown, so no change notification is sent.
+func (m *MaintenanceModel) PruneSnippets(retention time.Duration, limit int) (int, []string, error) {
+	stmt := `WITH batch AS (
+                 SELECT id FROM snippets
+                 WHERE expires < CURRENT_TIMESTAMP - make_interval(secs => $1)
+                 ORDER BY id
+                 LIMIT $2
+                 FOR UPDATE SKIP LOCKED
+             ), files AS (
+                 SELECT object_key FROM attachments
+                 WHERE snippet_id IN (SELECT id FROM batch)
+             ), deleted AS (
+                 DELETE FROM snippets
+                 WHERE id IN (SELECT id FROM batch)
+                 RETURNING id
+             )
+             SELECT (SELECT count(*) FROM deleted),
+                    COALESCE((SELECT array_agg(object_key) FROM files), '{}')`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var n int
+	var keys []string
+	err := m.DB.QueryRow(ctx, stmt, retention.Seconds(), limit).Scan(&n, &keys)
+	if err != nil {
+		return 0, nil, err
+	}
+	return n, keys, nil
+}
+
+// PruneExpired deletes expired sessions and IP bans, and jobs that finished
+// and outbox events that were delivered longer ago than jobRetention
+func (m *MaintenanceModel) PruneExpired(jobRetention time.Duration) (PruneStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var stats PruneStats
+
+	tag, err := m.DB.Exec(ctx, "DELETE FROM sessions WHERE expiry < CURRENT_TIMESTAMP")
+	if err != nil {
+		return PruneStats{}, err
+	}
+	stats.Sessions = tag.RowsAffected()
+
+	tag, err = m.DB.Exec(ctx, "DELETE FROM ip_bans WHERE expires < CURRENT_TIMESTAMP")
+	if err != nil {
+		return PruneStats{}, err
+	}
+	stats.Bans = tag.RowsAffected()
+
+	tag, err = m.DB.Exec(ctx, `DELETE FROM jobs
+                               WHERE status IN ('done', 'failed')
+                                 AND updated < CURRENT_TIMESTAMP - make_interval(secs => $1)`,
+		jobRetention.Seconds())
+	if err != nil {
+		return PruneStats{}, err
+	}
+	stats.Jobs = tag.RowsAffected()
+
+	tag, err = m.DB.Exec(ctx, "DELETE FROM outbox WHERE delivered < CURRENT_TIMESTAMP - make_interval(secs => $1)",
+		jobRetention.Seconds())
+	if err != nil {
+		return PruneStats{}, err
+	}
+	stats.Events = tag.RowsAffected()
+
+	return stats, nil
+}
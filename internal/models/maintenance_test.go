@@ -0,0 +1,116 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestMaintenanceModelRebuildSearch(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "snippets")
+	m := MaintenanceModel{DB: db}
+
+	// As if the snippets were written before the search index was added
+	_, err := db.Exec(context.Background(), "UPDATE snippets SET search_vector = NULL")
+	assert.NilError(t, err)
+
+	total, err := m.CountSnippets()
+	assert.NilError(t, err)
+	assert.Equal(t, total, 3)
+
+	last, n, err := m.RebuildSearch(0, 2)
+	assert.NilError(t, err)
+	assert.Equal(t, last, 2)
+	assert.Equal(t, n, 2)
+
+	last, n, err = m.RebuildSearch(last, 2)
+	assert.NilError(t, err)
+	assert.Equal(t, last, 3)
+	assert.Equal(t, n, 1)
+
+	// Past the end, the last ID stays put
+	last, n, err = m.RebuildSearch(last, 2)
+	assert.NilError(t, err)
+	assert.Equal(t, last, 3)
+	assert.Equal(t, n, 0)
+
+	var indexed int
+	err = db.QueryRow(context.Background(), "SELECT count(*) FROM snippets WHERE search_vector @@ plainto_tsquery('simple', 'pond')").Scan(&indexed)
+	assert.NilError(t, err)
+	assert.Equal(t, indexed, 1)
+}
+
+func TestMaintenanceModelPruneSnippets(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "snippets")
+	m := MaintenanceModel{DB: db}
+
+	_, err := db.Exec(context.Background(),
+		`INSERT INTO attachments (snippet_id, object_key, filename, content_type, size, created)
+         VALUES (3, 'attachments/3/notes.txt', 'notes.txt', 'text/plain', 5, CURRENT_TIMESTAMP)`)
+	assert.NilError(t, err)
+
+	// Snippet 3 expired a day ago
+	n, err := m.CountExpiredSnippets(48 * time.Hour)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 0)
+	n, err = m.CountExpiredSnippets(0)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 1)
+
+	n, keys, err := m.PruneSnippets(48*time.Hour, 10)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 0)
+	assert.Equal(t, len(keys), 0)
+
+	n, keys, err = m.PruneSnippets(0, 10)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 1)
+	assert.DeepEqual(t, keys, []string{"attachments/3/notes.txt"})
+
+	total, err := m.CountSnippets()
+	assert.NilError(t, err)
+	assert.Equal(t, total, 2)
+}
+
+func TestMaintenanceModelPruneExpired(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	m := MaintenanceModel{DB: db}
+
+	_, err := db.Exec(context.Background(),
+		`INSERT INTO sessions (token, data, expiry) VALUES
+             ('old', '', CURRENT_TIMESTAMP - INTERVAL '1 hour'),
+             ('live', '', CURRENT_TIMESTAMP + INTERVAL '1 hour');
+         INSERT INTO ip_bans (network, reason, created, expires) VALUES
+             ('192.0.2.0/24', 'spam', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP - INTERVAL '1 hour'),
+             ('198.51.100.0/24', 'spam', CURRENT_TIMESTAMP, NULL);
+         INSERT INTO jobs (kind, payload, status, max_attempts, updated) VALUES
+             ('email', '{}', 'done', 1, CURRENT_TIMESTAMP - INTERVAL '40 days'),
+             ('email', '{}', 'failed', 1, CURRENT_TIMESTAMP - INTERVAL '40 days'),
+             ('email', '{}', 'done', 1, CURRENT_TIMESTAMP),
+             ('email', '{}', 'pending', 1, CURRENT_TIMESTAMP - INTERVAL '40 days');
+         INSERT INTO outbox (kind, payload, created, delivered) VALUES
+             ('user.followed', '{}', CURRENT_TIMESTAMP - INTERVAL '40 days', CURRENT_TIMESTAMP - INTERVAL '40 days'),
+             ('user.followed', '{}', CURRENT_TIMESTAMP - INTERVAL '40 days', NULL),
+             ('user.followed', '{}', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`)
+	assert.NilError(t, err)
+
+	stats, err := m.PruneExpired(30 * 24 * time.Hour)
+	assert.NilError(t, err)
+	assert.Equal(t, stats, PruneStats{Sessions: 1, Bans: 1, Jobs: 2, Events: 1})
+
+	// Nothing is left to prune
+	stats, err = m.PruneExpired(30 * 24 * time.Hour)
+	assert.NilError(t, err)
+	assert.Equal(t, stats, PruneStats{})
+}
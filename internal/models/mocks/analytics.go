@@ -0,0 +1,43 @@
+package mocks
+
+import (
+	"context"
+	"time"
+
+	"adotkaya.playground/internal/models"
+)
+
+type AnalyticsModel struct{}
+
+func (m *AnalyticsModel) Record(ctx context.Context, page, referrer string) error {
+	return nil
+}
+
+func (m *AnalyticsModel) Pages(days int) ([]*models.PageViews, error) {
+	return []*models.PageViews{
+		{Page: "/snippet/view/:id", Views: 12},
+		{Page: "/", Views: 5},
+	}, nil
+}
+
+func (m *AnalyticsModel) Daily(days int, page string) ([]*models.DailyViews, error) {
+	today := time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC)
+	daily := []*models.DailyViews{}
+	for n := days - 1; n >= 0; n-- {
+		daily = append(daily, &models.DailyViews{Day: today.AddDate(0, 0, -n)})
+	}
+	switch page {
+	case "":
+		daily[len(daily)-1].Views = 17
+	case "/":
+		daily[len(daily)-1].Views = 5
+	}
+	return daily, nil
+}
+
+func (m *AnalyticsModel) Referrers(days int) ([]*models.ReferrerViews, error) {
+	return []*models.ReferrerViews{
+		{Referrer: models.ReferrerSearch, Views: 10},
+		{Referrer: models.ReferrerDirect, Views: 7},
+	}, nil
+}
@@ -0,0 +1,52 @@
+package mocks
+
+import (
+	"time"
+
+	"adotkaya.playground/internal/models"
+)
+
+// mockAnnouncement is scheduled, so pages don't show it unless a test
+// puts up a banner of its own
+var mockAnnouncement = &models.Announcement{
+	ID:        1,
+	Message:   "Scheduled maintenance from 02:00 to 04:00 UTC",
+	Level:     models.AnnouncementWarning,
+	Starts:    time.Date(2099, 1, 4, 2, 0, 0, 0, time.UTC),
+	Ends:      time.Date(2099, 1, 4, 4, 0, 0, 0, time.UTC),
+	Created:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	CreatedBy: "Carol",
+}
+
+type AnnouncementModel struct{}
+
+func (m *AnnouncementModel) Insert(a *models.Announcement, createdBy int) (int, error) {
+	return 2, nil
+}
+func (m *AnnouncementModel) Get(id int) (*models.Announcement, error) {
+	switch id {
+	case 1:
+		return mockAnnouncement, nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+func (m *AnnouncementModel) Update(a *models.Announcement) error {
+	switch a.ID {
+	case 1:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+func (m *AnnouncementModel) Delete(id int) error {
+	switch id {
+	case 1:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+func (m *AnnouncementModel) Current() ([]*models.Announcement, error) {
+	return []*models.Announcement{mockAnnouncement}, nil
+}
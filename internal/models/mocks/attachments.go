@@ -0,0 +1,43 @@
+package mocks
+
+import (
+	"time"
+
+	"adotkaya.playground/internal/models"
+)
+
+// Alice's private snippet (4) has a log file attached
+var mockAttachment = models.Attachment{
+	ID:          1,
+	SnippetID:   4,
+	Key:         "snippets/4/0f1e2d3c4b5a69788796a5b4c3d2e1f0",
+	Filename:    "diary.log",
+	ContentType: "text/plain",
+	Size:        1536,
+	Created:     time.Now(),
+}
+
+type AttachmentModel struct{}
+
+func (m *AttachmentModel) Insert(snippetID int, key, filename, contentType string, size int64) (int, error) {
+	return 2, nil
+}
+func (m *AttachmentModel) Get(id int) (*models.Attachment, error) {
+	if id == mockAttachment.ID {
+		a := mockAttachment
+		return &a, nil
+	}
+	return nil, models.ErrNoRecord
+}
+func (m *AttachmentModel) ForSnippet(snippetID int) ([]models.Attachment, error) {
+	if snippetID == mockAttachment.SnippetID {
+		return []models.Attachment{mockAttachment}, nil
+	}
+	return []models.Attachment{}, nil
+}
+func (m *AttachmentModel) Delete(id int) error {
+	if id == mockAttachment.ID {
+		return nil
+	}
+	return models.ErrNoRecord
+}
@@ -0,0 +1,36 @@
+package mocks
+
+import (
+	"time"
+
+	"adotkaya.playground/internal/models"
+)
+
+var mockAudit = []*models.AuditEntry{
+	{
+		ID:      1,
+		Actor:   "Carol",
+		Action:  models.AuditIPBan,
+		Target:  "ip:203.0.113.0/24",
+		Detail:  "Credential stuffing",
+		Created: time.Now(),
+	},
+}
+
+type AuditModel struct{}
+
+func (m *AuditModel) Record(actorID int, action, target, detail string) error {
+	return nil
+}
+func (m *AuditModel) Recent(limit int) ([]*models.AuditEntry, error) {
+	return mockAudit, nil
+}
+func (m *AuditModel) ForTarget(target string, limit int) ([]*models.AuditEntry, error) {
+	entries := []*models.AuditEntry{}
+	for _, e := range mockAudit {
+		if e.Target == target {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
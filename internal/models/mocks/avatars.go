@@ -0,0 +1,32 @@
+package mocks
+
+import (
+	"time"
+
+	"adotkaya.playground/internal/models"
+)
+
+// Alice (1) has uploaded an avatar twice; Carol (3) never has
+var mockAvatar = &models.Avatar{
+	UserID:  1,
+	Version: 2,
+	Updated: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC),
+}
+
+type AvatarModel struct{}
+
+func (m *AvatarModel) Get(userID int) (*models.Avatar, error) {
+	if userID == mockAvatar.UserID {
+		return mockAvatar, nil
+	}
+	return nil, models.ErrNoRecord
+}
+func (m *AvatarModel) Set(userID, version int) error {
+	return nil
+}
+func (m *AvatarModel) Delete(userID int) error {
+	if userID == mockAvatar.UserID {
+		return nil
+	}
+	return models.ErrNoRecord
+}
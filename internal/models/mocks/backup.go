@@ -0,0 +1,21 @@
+package mocks
+
+import (
+	"io"
+
+	"adotkaya.playground/internal/models"
+)
+
+// mockBackup is an archive of the mock users with no snippets
+const mockBackup = `{"format":"snippetbox-backup","version":1,"created":"2026-01-01T00:00:00Z","passwords":false}
+{"type":"user","data":{"id":1,"name":"Alice","email":"alice@example.com","created":"2026-01-01T00:00:00Z","locale":"","theme":"","role":"user","tier":"free","banned":false,"active":true}}
+{"type":"user","data":{"id":3,"name":"Carol","email":"admin@example.com","created":"2026-01-01T00:00:00Z","locale":"","theme":"","role":"admin","tier":"free","banned":false,"active":true}}
+{"type":"end","data":{"records":2}}
+`
+
+type BackupModel struct{}
+
+func (m *BackupModel) Export(w io.Writer, passwords bool) (models.BackupStats, error) {
+	_, err := io.WriteString(w, mockBackup)
+	return models.BackupStats{Users: 2}, err
+}
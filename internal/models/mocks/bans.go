@@ -0,0 +1,43 @@
+package mocks
+
+import (
+	"net/netip"
+	"time"
+
+	"adotkaya.playground/internal/models"
+)
+
+var mockBans = []*models.IPBan{
+	{
+		ID:       2,
+		Network:  netip.MustParsePrefix("198.51.100.7/32"),
+		Reason:   "Comment spam",
+		Created:  time.Now(),
+		Expires:  time.Now().Add(24 * time.Hour),
+		BannedBy: "Carol",
+	},
+	{
+		ID:       1,
+		Network:  netip.MustParsePrefix("203.0.113.0/24"),
+		Reason:   "Credential stuffing",
+		Created:  time.Now(),
+		BannedBy: "Carol",
+	},
+}
+
+type BanModel struct{}
+
+func (m *BanModel) Insert(network netip.Prefix, reason string, duration time.Duration, bannedBy int) (int, error) {
+	return 3, nil
+}
+func (m *BanModel) Active() ([]*models.IPBan, error) {
+	return mockBans, nil
+}
+func (m *BanModel) Delete(id int) error {
+	switch id {
+	case 1, 2:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
@@ -0,0 +1,42 @@
+package mocks
+
+import (
+	"time"
+
+	"adotkaya.playground/internal/models"
+)
+
+// mockChanges is the history of snippet 1: Alice (1) created and edited it
+var mockChanges = []*models.SnippetChange{
+	{
+		ID:        1,
+		SnippetID: 1,
+		ActorID:   1,
+		Actor:     "Alice",
+		Action:    models.ChangeCreate,
+		After:     &models.SnippetMeta{Title: "An old pond", Size: 17, ContentHash: "1f0c2a9be0d3f5a1"},
+		Created:   time.Now(),
+	},
+	{
+		ID:        2,
+		SnippetID: 1,
+		ActorID:   1,
+		Actor:     "Alice",
+		Action:    models.ChangeEdit,
+		Before:    &models.SnippetMeta{Title: "An old pond", Size: 17, ContentHash: "1f0c2a9be0d3f5a1"},
+		After:     &models.SnippetMeta{Title: "An old silent pond", Size: 21, ContentHash: "8d3e7c1b2a4f6e90"},
+		Created:   time.Now(),
+	},
+}
+
+type SnippetChangeModel struct{}
+
+func (m *SnippetChangeModel) Record(c *models.SnippetChange) error {
+	return nil
+}
+func (m *SnippetChangeModel) History(snippetID int) ([]*models.SnippetChange, error) {
+	if snippetID == 1 {
+		return mockChanges, nil
+	}
+	return []*models.SnippetChange{}, nil
+}
@@ -0,0 +1,38 @@
+package mocks
+
+import (
+	"context"
+	"time"
+
+	"adotkaya.playground/internal/models"
+)
+
+type ExportModel struct{}
+
+func (m *ExportModel) Users(ctx context.Context, fn func(*models.ExportedUser) error) error {
+	users := []*models.ExportedUser{
+		{ID: 1, Name: "Alice Jones", Email: "alice@example.com", Role: models.RoleUser, Tier: "free", Active: true, Created: time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC), Snippets: 1},
+		{ID: 3, Name: "Carol Admin", Email: "admin@example.com", Role: models.RoleAdmin, Tier: "free", Active: true, Created: time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC)},
+	}
+	for _, u := range users {
+		if err := fn(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func (m *ExportModel) Snippets(ctx context.Context, userID int, fn func(*models.ExportedSnippet) error) error {
+	snippets := []*models.ExportedSnippet{
+		{ID: 1, Title: mockSnippet.Title, Size: len(mockSnippet.Content), Views: 7, Created: time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC), Expires: time.Date(2027, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{ID: 4, UserID: 1, Title: "=1+1", Language: "go", Tags: []string{"diary", "haiku"}, Size: len(mockPrivateSnippet.Content), Private: true, Created: time.Date(2026, 1, 3, 0, 0, 0, 0, time.UTC), Expires: time.Date(2027, 1, 3, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, s := range snippets {
+		if userID != 0 && s.UserID != userID {
+			continue
+		}
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
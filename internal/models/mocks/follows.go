@@ -0,0 +1,43 @@
+package mocks
+
+import (
+	"adotkaya.playground/internal/models"
+)
+
+// Carol (3) follows Alice (1); Alice follows nobody.
+
+type FollowModel struct{}
+
+func (m *FollowModel) Follow(followerID, followedID int) (bool, error) {
+	switch followedID {
+	case 1, 3:
+		return !(followerID == 3 && followedID == 1), nil
+	default:
+		return false, models.ErrNoRecord
+	}
+}
+func (m *FollowModel) Unfollow(followerID, followedID int) error {
+	return nil
+}
+func (m *FollowModel) IsFollowing(followerID, followedID int) (bool, error) {
+	return followerID == 3 && followedID == 1, nil
+}
+func (m *FollowModel) Counts(userID int) (models.FollowCounts, error) {
+	switch userID {
+	case 1:
+		return models.FollowCounts{Followers: 1}, nil
+	case 3:
+		return models.FollowCounts{Following: 1}, nil
+	default:
+		return models.FollowCounts{}, nil
+	}
+}
+func (m *FollowModel) Feed(userID, limit, offset int) ([]*models.FeedItem, int, error) {
+	if userID != 3 {
+		return []*models.FeedItem{}, 0, nil
+	}
+	if offset > 0 {
+		return []*models.FeedItem{}, 1, nil
+	}
+	return []*models.FeedItem{{SnippetSummary: mockSummary, UserID: 1, Author: "Alice", AvatarVersion: mockAvatar.Version}}, 1, nil
+}
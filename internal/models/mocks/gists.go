@@ -0,0 +1,62 @@
+package mocks
+
+import (
+	"time"
+
+	"adotkaya.playground/internal/models"
+)
+
+// Alice (1) has connected GitHub as "alice". Her private snippet (4) is
+// pushed to a Gist and kept in sync; the anonymous snippet (1) is linked
+// but not yet pushed.
+var mockGitHubToken = &models.GitHubToken{
+	UserID:  1,
+	Token:   "ghp_alice",
+	Login:   "alice",
+	Created: time.Now(),
+}
+
+var mockGistLinks = map[int]*models.GistLink{
+	1: {SnippetID: 1, UserID: 1},
+	4: {
+		SnippetID: 4,
+		UserID:    1,
+		GistID:    "aa5a315d61ae9438b18d",
+		URL:       "https://gist.github.com/alice/aa5a315d61ae9438b18d",
+		Sync:      true,
+		Synced:    time.Now(),
+	},
+}
+
+type GistModel struct{}
+
+func (m *GistModel) SetToken(userID int, token, login string) error {
+	return nil
+}
+func (m *GistModel) Token(userID int) (*models.GitHubToken, error) {
+	if userID == 1 {
+		return mockGitHubToken, nil
+	}
+	return nil, models.ErrNoRecord
+}
+func (m *GistModel) DeleteToken(userID int) error {
+	if userID == 1 {
+		return nil
+	}
+	return models.ErrNoRecord
+}
+func (m *GistModel) Link(snippetID, userID int, sync bool) error {
+	return nil
+}
+func (m *GistModel) GetLink(snippetID int) (*models.GistLink, error) {
+	if link, ok := mockGistLinks[snippetID]; ok {
+		return link, nil
+	}
+	return nil, models.ErrNoRecord
+}
+func (m *GistModel) SetGist(snippetID int, gistID, url string) error {
+	if _, ok := mockGistLinks[snippetID]; ok {
+		return nil
+	}
+	return models.ErrNoRecord
+}
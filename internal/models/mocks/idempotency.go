@@ -0,0 +1,53 @@
+package mocks
+
+import (
+	"sync"
+
+	"adotkaya.playground/internal/models"
+)
+
+// IdempotencyModel remembers keys in memory, so replays can be tested
+type IdempotencyModel struct {
+	mu   sync.Mutex
+	keys map[[2]string]int // Snippet ID, or 0 while in progress
+}
+
+func (m *IdempotencyModel) Claim(scope, key string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.keys == nil {
+		m.keys = make(map[[2]string]int)
+	}
+	id, ok := m.keys[[2]string{scope, key}]
+	if !ok {
+		m.keys[[2]string{scope, key}] = 0
+		return 0, nil
+	}
+	if id == 0 {
+		return 0, models.ErrKeyInProgress
+	}
+	return id, nil
+}
+func (m *IdempotencyModel) Complete(scope, key string, snippetID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.keys[[2]string{scope, key}]; !ok {
+		return models.ErrNoRecord
+	}
+	m.keys[[2]string{scope, key}] = snippetID
+	return nil
+}
+func (m *IdempotencyModel) Release(scope, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.keys[[2]string{scope, key}] == 0 {
+		delete(m.keys, [2]string{scope, key})
+	}
+	return nil
+}
+func (m *IdempotencyModel) Prune() (int64, error) {
+	return 0, nil
+}
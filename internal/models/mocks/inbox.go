@@ -0,0 +1,40 @@
+package mocks
+
+import (
+	"time"
+
+	"adotkaya.playground/internal/models"
+)
+
+// Carol (3) follows Alice (1), and Alice hasn't seen it yet
+var mockNotifications = []*models.Notification{
+	{
+		ID:      1,
+		Kind:    models.NotifyFollowers,
+		ActorID: 3,
+		Actor:   "Carol",
+		Link:    "/user/profile/3",
+		Created: time.Now(),
+	},
+}
+
+type NotificationModel struct{}
+
+func (m *NotificationModel) Insert(userID, actorID int, kind, link, detail string) error {
+	return nil
+}
+func (m *NotificationModel) Recent(userID, limit int) ([]*models.Notification, error) {
+	if userID != 1 {
+		return []*models.Notification{}, nil
+	}
+	return mockNotifications, nil
+}
+func (m *NotificationModel) UnreadCount(userID int) (int, error) {
+	if userID != 1 {
+		return 0, nil
+	}
+	return len(mockNotifications), nil
+}
+func (m *NotificationModel) MarkAllRead(userID int) error {
+	return nil
+}
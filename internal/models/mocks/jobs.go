@@ -0,0 +1,59 @@
+package mocks
+
+import (
+	"encoding/json"
+	"time"
+
+	"adotkaya.playground/internal/models"
+)
+
+var mockJobs = []*models.Job{
+	{
+		ID:          2,
+		Kind:        "email",
+		Payload:     json.RawMessage(`{"recipient":"bob@example.com","template":"user_welcome.tmpl"}`),
+		Status:      models.JobFailed,
+		Attempts:    5,
+		MaxAttempts: 5,
+		LastError:   "dial tcp: connection refused",
+		Created:     time.Now(),
+		Updated:     time.Now(),
+	},
+	{
+		ID:          1,
+		Kind:        "email",
+		Payload:     json.RawMessage(`{"recipient":"alice@example.com","template":"user_welcome.tmpl"}`),
+		Status:      models.JobDone,
+		Attempts:    1,
+		MaxAttempts: 5,
+		Created:     time.Now(),
+		Updated:     time.Now(),
+	},
+}
+
+type JobModel struct{}
+
+func (m *JobModel) Enqueue(kind string, payload any, maxAttempts int) (int, error) {
+	return 3, nil
+}
+func (m *JobModel) Claim() (*models.Job, error) {
+	return nil, models.ErrNoRecord
+}
+func (m *JobModel) Complete(id int) error {
+	return nil
+}
+func (m *JobModel) Retry(id int, delay time.Duration, errMsg string) error {
+	return nil
+}
+func (m *JobModel) Fail(id int, errMsg string) error {
+	return nil
+}
+func (m *JobModel) Progress(id, done, total int) error {
+	return nil
+}
+func (m *JobModel) Recent(kind string, limit int) ([]*models.Job, error) {
+	if kind == "email" {
+		return mockJobs, nil
+	}
+	return []*models.Job{}, nil
+}
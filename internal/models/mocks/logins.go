@@ -0,0 +1,67 @@
+package mocks
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"adotkaya.playground/internal/models"
+)
+
+// LoginEventModel remembers logins in memory, so familiarity can be tested
+type LoginEventModel struct {
+	mu     sync.Mutex
+	events []*models.LoginEvent
+}
+
+func (m *LoginEventModel) Familiarity(userID int, userAgent, country string) (bool, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var history, seenDevice, knownCountries, seenCountry bool
+	for _, e := range m.events {
+		if e.UserID != userID || !e.Confirmed {
+			continue
+		}
+		history = true
+		seenDevice = seenDevice || e.UserAgent == userAgent
+		knownCountries = knownCountries || e.Country != ""
+		seenCountry = seenCountry || (e.Country != "" && e.Country == country)
+	}
+	if !history {
+		return false, false, nil
+	}
+	return !seenDevice, country != "" && knownCountries && !seenCountry, nil
+}
+func (m *LoginEventModel) Insert(e *models.LoginEvent) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := *e
+	stored.ID = int64(len(m.events) + 1)
+	stored.Created = time.Now()
+	m.events = append(m.events, &stored)
+	return stored.ID, nil
+}
+func (m *LoginEventModel) Confirm(id int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id < 1 || id > int64(len(m.events)) || m.events[id-1].Confirmed {
+		return 0, models.ErrNoRecord
+	}
+	m.events[id-1].Confirmed = true
+	return m.events[id-1].UserID, nil
+}
+func (m *LoginEventModel) Recent(userID, limit int) ([]*models.LoginEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := []*models.LoginEvent{}
+	for _, e := range slices.Backward(m.events) {
+		if e.UserID == userID && len(events) < limit {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,25 @@
+package mocks
+
+import (
+	"time"
+
+	"adotkaya.playground/internal/models"
+)
+
+type MaintenanceModel struct{}
+
+func (m *MaintenanceModel) CountSnippets() (int, error) {
+	return 3, nil
+}
+func (m *MaintenanceModel) RebuildSearch(afterID, limit int) (int, int, error) {
+	return afterID, 0, nil
+}
+func (m *MaintenanceModel) CountExpiredSnippets(retention time.Duration) (int, error) {
+	return 0, nil
+}
+func (m *MaintenanceModel) PruneSnippets(retention time.Duration, limit int) (int, []string, error) {
+	return 0, nil, nil
+}
+func (m *MaintenanceModel) PruneExpired(jobRetention time.Duration) (models.PruneStats, error) {
+	return models.PruneStats{}, nil
+}
@@ -0,0 +1,57 @@
+package mocks
+
+import (
+	"time"
+
+	"adotkaya.playground/internal/models"
+)
+
+var mockQueue = []*models.ModerationItem{
+	{
+		Snippet:      mockSnippet,
+		AuthorID:     1,
+		Author:       "Alice",
+		Held:         true,
+		Reports:      3,
+		Reasons:      []string{models.ReportAbuse, models.ReportSpam},
+		LastReported: time.Now(),
+	},
+}
+
+type ModerationModel struct{}
+
+func (m *ModerationModel) Report(snippetID, userID int, reason string) (bool, error) {
+	switch snippetID {
+	case 1:
+		return false, nil
+	default:
+		return false, models.ErrNoRecord
+	}
+}
+func (m *ModerationModel) Queue(limit int) ([]*models.ModerationItem, error) {
+	return mockQueue, nil
+}
+func (m *ModerationModel) Approve(snippetID int) error {
+	switch snippetID {
+	case 1:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+func (m *ModerationModel) Remove(snippetID int) error {
+	switch snippetID {
+	case 1:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+func (m *ModerationModel) BanAuthor(snippetID int) (int, error) {
+	switch snippetID {
+	case 1:
+		return 1, nil
+	default:
+		return 0, models.ErrNoRecord
+	}
+}
@@ -0,0 +1,17 @@
+package mocks
+
+import (
+	"adotkaya.playground/internal/models"
+)
+
+type OutboxModel struct{}
+
+func (m *OutboxModel) Pending(limit int) ([]*models.OutboxEvent, error) {
+	return []*models.OutboxEvent{}, nil
+}
+func (m *OutboxModel) Deliver(id int, delivery models.OutboxDelivery) (bool, error) {
+	return true, nil
+}
+func (m *OutboxModel) Failed(id int, errMsg string) error {
+	return nil
+}
@@ -0,0 +1,19 @@
+package mocks
+
+import (
+	"context"
+
+	"adotkaya.playground/internal/models"
+)
+
+type ReportModel struct{}
+
+func (m *ReportModel) Run(ctx context.Context, report models.Report, args []int) (*models.ReportResult, error) {
+	return &models.ReportResult{
+		Columns: []string{"id", "title", "bytes"},
+		Rows: [][]string{
+			{"1", "An old silent pond", "21"},
+			{"4", "=HYPERLINK(\"https://example.com\")", "12"},
+		},
+	}, nil
+}
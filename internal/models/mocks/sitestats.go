@@ -0,0 +1,20 @@
+package mocks
+
+import (
+	"time"
+
+	"adotkaya.playground/internal/models"
+)
+
+type SiteStatsModel struct{}
+
+func (m *SiteStatsModel) Get(days int) (*models.SiteStats, error) {
+	today := time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC)
+	stats := &models.SiteStats{Snippets: 2, Users: 3}
+	for n := days - 1; n >= 0; n-- {
+		stats.Activity = append(stats.Activity, &models.DailyActivity{Day: today.AddDate(0, 0, -n)})
+	}
+	stats.Activity[len(stats.Activity)-1].Snippets = 2
+	stats.Activity[len(stats.Activity)-1].Views = 8
+	return stats, nil
+}
@@ -1,9 +1,15 @@
 package mocks
 
 import (
+	"context"
+	"errors"
+	"io"
+	"net/netip"
+	"strings"
 	"time"
 
 	"adotkaya.playground/internal/models"
+	"adotkaya.playground/internal/query"
 )
 
 var mockSnippet = &models.Snippet{
@@ -14,19 +20,185 @@ var mockSnippet = &models.Snippet{
 	Expires: time.Now(),
 }
 
+// mockSummary summarises mockSnippet for listings
+var mockSummary = &models.SnippetSummary{
+	ID:      mockSnippet.ID,
+	Title:   mockSnippet.Title,
+	Excerpt: mockSnippet.Content,
+	Created: mockSnippet.Created,
+	Expires: mockSnippet.Expires,
+}
+
+// mockPrivateSnippet is Alice's (1) private snippet
+var mockPrivateSnippet = &models.Snippet{
+	ID:      4,
+	Title:   "Dear diary",
+	Content: "Today I wrote a haiku.",
+	Created: time.Now(),
+	Expires: time.Now(),
+	UserID:  1,
+	Private: true,
+}
+
+// mockEncryptedSnippet is an anonymous encrypted snippet
+var mockEncryptedSnippet = &models.Snippet{
+	ID:        5,
+	Content:   "dHdlbHZlIGJ5dGVzeyJ0aXRsZSI6IkhpIn1zaXh0ZWVuIGJ5dGUgdGFn",
+	Created:   time.Now(),
+	Expires:   time.Now(),
+	Encrypted: true,
+}
+
 type SnippetModel struct{}
 
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
+func (m *SnippetModel) Insert(userID int, creatorIP netip.Addr, title string, content string, expires int, private bool, limits models.SnippetLimits) (int, error) {
 	return 2, nil
 }
-func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
+func (m *SnippetModel) InsertEncrypted(userID int, creatorIP netip.Addr, ciphertext string, expires int, limits models.SnippetLimits) (int, error) {
+	return 5, nil
+}
+func (m *SnippetModel) Update(id int, title string, content string, private bool, limits models.SnippetLimits) error {
+	switch id {
+	case 1, 4:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+func (m *SnippetModel) Delete(id int) error {
+	switch id {
+	case 1, 4:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+func (m *SnippetModel) Get(ctx context.Context, id int) (*models.Snippet, error) {
 	switch id {
 	case 1:
 		return mockSnippet, nil
+	case 4:
+		return mockPrivateSnippet, nil
+	case 5:
+		return mockEncryptedSnippet, nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+func (m *SnippetModel) GetHeader(ctx context.Context, id int) (*models.SnippetHeader, error) {
+	switch id {
+	case 1:
+		return &models.SnippetHeader{
+			ID:      mockSnippet.ID,
+			Title:   mockSnippet.Title,
+			Created: mockSnippet.Created,
+			Expires: mockSnippet.Expires,
+			Size:    int64(len(mockSnippet.Content)),
+		}, nil
+	case 4:
+		return &models.SnippetHeader{
+			ID:      mockPrivateSnippet.ID,
+			Title:   mockPrivateSnippet.Title,
+			Created: mockPrivateSnippet.Created,
+			Expires: mockPrivateSnippet.Expires,
+			Size:    int64(len(mockPrivateSnippet.Content)),
+			UserID:  mockPrivateSnippet.UserID,
+			Private: true,
+		}, nil
+	case 5:
+		return &models.SnippetHeader{
+			ID:        mockEncryptedSnippet.ID,
+			Created:   mockEncryptedSnippet.Created,
+			Expires:   mockEncryptedSnippet.Expires,
+			Size:      int64(len(mockEncryptedSnippet.Content)),
+			Encrypted: true,
+		}, nil
 	default:
 		return nil, models.ErrNoRecord
 	}
 }
-func (m *SnippetModel) Latest() ([]*models.Snippet, error) {
-	return []*models.Snippet{mockSnippet}, nil
+func (m *SnippetModel) CopyContent(ctx context.Context, w io.Writer, id int) (int64, error) {
+	switch id {
+	case 1:
+		n, err := io.WriteString(w, mockSnippet.Content)
+		return int64(n), err
+	case 4:
+		n, err := io.WriteString(w, mockPrivateSnippet.Content)
+		return int64(n), err
+	default:
+		return 0, models.ErrNoRecord
+	}
+}
+func (m *SnippetModel) Latest(ctx context.Context) ([]*models.SnippetSummary, error) {
+	return []*models.SnippetSummary{mockSummary}, nil
+}
+func (m *SnippetModel) All(ctx context.Context, page, pageSize int) ([]*models.SnippetSummary, int, error) {
+	if page == 1 {
+		return []*models.SnippetSummary{mockSummary}, 1, nil
+	}
+	return []*models.SnippetSummary{}, 1, nil
+}
+func (m *SnippetModel) SetTags(id int, tags []string) error {
+	return nil
+}
+func (m *SnippetModel) SetSource(id int, source string) error {
+	return nil
+}
+func (m *SnippetModel) RevokeShares(id int) error {
+	switch id {
+	case 1, 4:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+func (m *SnippetModel) Search(ctx context.Context, q query.Query, limit, offset int) ([]*models.SnippetSummary, int, error) {
+	if q.Language != "" || len(q.Tags) > 0 {
+		return []*models.SnippetSummary{}, 0, nil
+	}
+	if strings.Contains(mockSnippet.Title, q.Text) || strings.Contains(mockSnippet.Content, q.Text) {
+		if offset > 0 {
+			return []*models.SnippetSummary{}, 1, nil
+		}
+		result := *mockSummary
+		if q.Text != "" {
+			result.Headline = strings.ReplaceAll(mockSnippet.Content, q.Text, models.HighlightStart+q.Text+models.HighlightEnd)
+		}
+		return []*models.SnippetSummary{&result}, 1, nil
+	}
+	return []*models.SnippetSummary{}, 0, nil
+}
+func (m *SnippetModel) RecordView(id int) error {
+	return nil
+}
+func (m *SnippetModel) Popular(days, limit int) ([]*models.PopularSnippet, error) {
+	return []*models.PopularSnippet{{Snippet: mockSnippet, Views: 42}}, nil
+}
+func (m *SnippetModel) RefreshTrending() (int, error) {
+	return 1, nil
+}
+func (m *SnippetModel) Trending(ctx context.Context, limit int) ([]*models.SnippetSummary, error) {
+	return []*models.SnippetSummary{mockSummary}, nil
+}
+func (m *SnippetModel) ByLanguage(ctx context.Context, language string, limit, offset int) ([]*models.SnippetSummary, int, error) {
+	// As Postgres does
+	if offset < 0 {
+		return nil, 0, errors.New("OFFSET must not be negative")
+	}
+	if language == "go" && offset == 0 {
+		return []*models.SnippetSummary{mockSummary}, 1, nil
+	}
+	return []*models.SnippetSummary{}, 0, nil
+}
+func (m *SnippetModel) ByTag(ctx context.Context, tag string, limit, offset int) ([]*models.SnippetSummary, int, error) {
+	if tag == "haiku" && offset == 0 {
+		return []*models.SnippetSummary{mockSummary}, 1, nil
+	}
+	return []*models.SnippetSummary{}, 0, nil
+}
+func (m *SnippetModel) LanguageCounts() ([]*models.GroupCount, error) {
+	return []*models.GroupCount{{Name: "go", Count: 1}}, nil
+}
+func (m *SnippetModel) TagCounts(limit int) ([]*models.GroupCount, error) {
+	return []*models.GroupCount{{Name: "haiku", Count: 1}}, nil
 }
@@ -0,0 +1,56 @@
+package mocks
+
+import (
+	"time"
+
+	"adotkaya.playground/internal/models"
+)
+
+// Alice (1) saved a search for "pond", emailed, and follows the "haiku" tag
+var mockSubscriptions = []*models.Subscription{
+	{
+		ID:      1,
+		UserID:  1,
+		Kind:    models.SubscriptionSearch,
+		Query:   "pond",
+		Email:   true,
+		Created: time.Now(),
+	},
+	{
+		ID:      2,
+		UserID:  1,
+		Kind:    models.SubscriptionTag,
+		Query:   "haiku",
+		Created: time.Now(),
+	},
+}
+
+type SubscriptionModel struct{}
+
+func (m *SubscriptionModel) Insert(userID int, kind, query string, email bool) (int, error) {
+	return 3, nil
+}
+func (m *SubscriptionModel) List(userID int) ([]*models.Subscription, error) {
+	if userID != 1 {
+		return []*models.Subscription{}, nil
+	}
+	return mockSubscriptions, nil
+}
+func (m *SubscriptionModel) Delete(userID, id int) error {
+	if userID == 1 && (id == 1 || id == 2) {
+		return nil
+	}
+	return models.ErrNoRecord
+}
+func (m *SubscriptionModel) Matches(sub *models.Subscription, afterID, limit int) ([]*models.Snippet, error) {
+	if sub.Query == "pond" && afterID < mockSnippet.ID {
+		return []*models.Snippet{mockSnippet}, nil
+	}
+	return []*models.Snippet{}, nil
+}
+func (m *SubscriptionModel) Emailed() ([]*models.Subscription, error) {
+	return mockSubscriptions[:1], nil
+}
+func (m *SubscriptionModel) MarkEmailed(id, lastID int) error {
+	return nil
+}
@@ -0,0 +1,44 @@
+package mocks
+
+import (
+	"time"
+
+	"adotkaya.playground/internal/models"
+)
+
+// Alice (1) has an API token, mockAPIToken
+const mockAPIToken = models.APITokenPrefix + "ALICEALICEALICEALICEALICE"
+
+var mockAPITokens = []*models.APIToken{
+	{
+		ID:      1,
+		UserID:  1,
+		Name:    "Laptop",
+		Prefix:  mockAPIToken[:12],
+		Created: time.Now(),
+	},
+}
+
+type APITokenModel struct{}
+
+func (m *APITokenModel) Insert(userID int, name string) (string, int, error) {
+	return models.APITokenPrefix + "NEWTOKENNEWTOKENNEWTOKEN", 2, nil
+}
+func (m *APITokenModel) Authenticate(token string) (int, error) {
+	if token == mockAPIToken {
+		return 1, nil
+	}
+	return 0, models.ErrInvalidCredentials
+}
+func (m *APITokenModel) List(userID int) ([]*models.APIToken, error) {
+	if userID != 1 {
+		return []*models.APIToken{}, nil
+	}
+	return mockAPITokens, nil
+}
+func (m *APITokenModel) Delete(userID, id int) error {
+	if userID == 1 && id == 1 {
+		return nil
+	}
+	return models.ErrNoRecord
+}
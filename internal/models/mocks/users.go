@@ -1,13 +1,28 @@
 package mocks
 
 import (
+	"time"
+
 	"adotkaya.playground/internal/models"
 )
 
 type UserModelInterface interface {
 	Insert(name, email, password string) error
 	Authenticate(email, password string) (int, error)
+	AuthenticateSSO(subject, email, name string) (int, error)
 	Exists(id int) (bool, error)
+	Get(id int) (*models.User, error)
+	SetLocale(id int, locale string) error
+	SetTheme(id int, theme string) error
+	NotificationPreferences(id int) (map[string]bool, error)
+	SetNotificationPreference(id int, kind string, enabled bool) error
+	NotificationSubscribers(kind string) ([]int, error)
+	SnippetQuota(id int) (models.SnippetLimits, error)
+	SetTier(id int, tier string) error
+	Provision(name, email string, active bool) (int, error)
+	Account(id int) (*models.User, error)
+	Accounts(email string, offset, limit int) ([]*models.User, int, error)
+	UpdateAccount(id int, name, email string, active bool) error
 }
 
 type UserModel struct{}
@@ -21,16 +36,143 @@ func (m *UserModel) Insert(name, email, password string) error {
 	}
 }
 func (m *UserModel) Authenticate(email, password string) (int, error) {
-	if email == "alice@example.com" && password == "pa$$word" {
+	switch {
+	case email == "alice@example.com" && password == "pa$$word":
+		return 1, nil
+	case email == "admin@example.com" && password == "pa$$word":
+		return 3, nil
+	default:
+		return 0, models.ErrInvalidCredentials
+	}
+}
+func (m *UserModel) PasswordUpdate(id int, currentPassword, newPassword string) error {
+	switch {
+	case id != 1 && id != 3:
+		return models.ErrNoRecord
+	case currentPassword != "pa$$word":
+		return models.ErrInvalidCredentials
+	default:
+		return nil
+	}
+}
+func (m *UserModel) AuthenticateSSO(subject, email, name string) (int, error) {
+	switch {
+	case subject == "alice" || email == "alice@example.com":
 		return 1, nil
+	default:
+		return 0, models.ErrInvalidCredentials
 	}
-	return 0, models.ErrInvalidCredentials
 }
 func (m *UserModel) Exists(id int) (bool, error) {
 	switch id {
-	case 1:
+	case 1, 3:
 		return true, nil
 	default:
 		return false, nil
 	}
 }
+func (m *UserModel) Get(id int) (*models.User, error) {
+	switch id {
+	case 1:
+		return &models.User{
+			ID:      1,
+			Name:    "Alice",
+			Email:   "alice@example.com",
+			Created: time.Now(),
+			Role:    models.RoleUser,
+			Active:  true,
+			Tier:    models.TierFree,
+		}, nil
+	case 3:
+		return &models.User{
+			ID:      3,
+			Name:    "Carol",
+			Email:   "admin@example.com",
+			Created: time.Now(),
+			Role:    models.RoleAdmin,
+			Active:  true,
+			Tier:    models.TierFree,
+		}, nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+func (m *UserModel) SetLocale(id int, locale string) error {
+	return nil
+}
+func (m *UserModel) SetTheme(id int, theme string) error {
+	return nil
+}
+func (m *UserModel) SetConfirmNewDevices(id int, confirm bool) error {
+	return nil
+}
+func (m *UserModel) NotificationPreferences(id int) (map[string]bool, error) {
+	prefs := map[string]bool{}
+	for _, kind := range models.NotificationKinds {
+		prefs[kind] = models.DefaultNotificationPreference(kind)
+	}
+	return prefs, nil
+}
+func (m *UserModel) SetNotificationPreference(id int, kind string, enabled bool) error {
+	return nil
+}
+func (m *UserModel) NotificationSubscribers(kind string) ([]int, error) {
+	if models.DefaultNotificationPreference(kind) {
+		return []int{1, 3}, nil
+	}
+	return []int{}, nil
+}
+func (m *UserModel) SnippetQuota(id int) (models.SnippetLimits, error) {
+	return models.SnippetLimits{}, models.ErrNoRecord
+}
+func (m *UserModel) SetTier(id int, tier string) error {
+	if id != 1 && id != 3 {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+func (m *UserModel) Provision(name, email string, active bool) (int, error) {
+	switch email {
+	case "alice@example.com", "admin@example.com", "dupe@example.com":
+		return 0, models.ErrDuplicateEmail
+	default:
+		return 2, nil
+	}
+}
+func (m *UserModel) Account(id int) (*models.User, error) {
+	if id == 2 {
+		// As provisioned by Provision
+		return &models.User{
+			ID:      2,
+			Name:    "Dave",
+			Email:   "dave@example.com",
+			Created: time.Now(),
+			Role:    models.RoleUser,
+			Active:  true,
+			Tier:    models.TierFree,
+		}, nil
+	}
+	return m.Get(id)
+}
+func (m *UserModel) Accounts(email string, offset, limit int) ([]*models.User, int, error) {
+	users := []*models.User{}
+	for _, id := range []int{1, 3} {
+		u, _ := m.Get(id)
+		if email == "" || u.Email == email {
+			users = append(users, u)
+		}
+	}
+	total := len(users)
+	users = users[min(offset, total):min(offset+limit, total)]
+	return users, total, nil
+}
+func (m *UserModel) UpdateAccount(id int, name, email string, active bool) error {
+	switch {
+	case id != 1 && id != 3:
+		return models.ErrNoRecord
+	case email == "dupe@example.com":
+		return models.ErrDuplicateEmail
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,290 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =============================================================================
+// Moderation Model - Type Definitions
+// =============================================================================
+
+// Report reasons
+const (
+	ReportSpam    = "spam"
+	ReportAbuse   = "abuse"
+	ReportIllegal = "illegal"
+)
+
+// ReportReasons lists the reasons a snippet can be reported for
+var ReportReasons = []string{ReportSpam, ReportAbuse, ReportIllegal}
+
+// ReportHoldThreshold is the number of reports from different users after
+// which a snippet is held (hidden) until a moderator reviews it
+const ReportHoldThreshold = 3
+
+// ModerationItem is a snippet in the moderation queue, with its reports
+type ModerationItem struct {
+	*Snippet
+	AuthorID     int    // Zero if the author is unknown
+	Author       string // Author's name, if known
+	Held         bool
+	Reports      int
+	Reasons      []string  // Distinct reasons given in reports
+	LastReported time.Time // Zero if held without reports
+}
+
+// ModerationModelInterface defines the interface for moderation operations
+type ModerationModelInterface interface {
+	Report(snippetID, userID int, reason string) (bool, error)
+	Queue(limit int) ([]*ModerationItem, error)
+	Approve(snippetID int) error
+	Remove(snippetID int) error
+	BanAuthor(snippetID int) (int, error)
+}
+
+// ModerationModel wraps a database connection pool
+type ModerationModel struct {
+	DB *pgxpool.Pool
+
+	// Keys encrypts content at rest; nil stores it as plaintext
+	Keys *ContentKeys
+}
+
+// =============================================================================
+// Moderation Model - Methods
+// =============================================================================
+
+// Report records a user's report of a snippet. Reporting the same snippet
+// again does nothing. Once ReportHoldThreshold users have reported it, the
+// snippet is held.
+//
+// Returns whether the snippet is now held, or ErrNoRecord if the snippet
+// doesn't exist or has expired.
+func (m *ModerationModel) Report(snippetID, userID int, reason string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the snippet so concurrent reports count each other
+	var held bool
+	err = tx.QueryRow(ctx, `SELECT held FROM snippets
+                             WHERE id = $1 AND expires > CURRENT_TIMESTAMP
+                             FOR UPDATE`, snippetID).Scan(&held)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, notFound("snippet", snippetID)
+		}
+		return false, err
+	}
+
+	_, err = tx.Exec(ctx, `INSERT INTO snippet_reports (snippet_id, user_id, reason, created)
+                           VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+                           ON CONFLICT (snippet_id, user_id) DO NOTHING`, snippetID, userID, reason)
+	if err != nil {
+		return false, err
+	}
+
+	if !held {
+		var reports int
+		err = tx.QueryRow(ctx, "SELECT count(*) FROM snippet_reports WHERE snippet_id = $1", snippetID).Scan(&reports)
+		if err != nil {
+			return false, err
+		}
+
+		if reports >= ReportHoldThreshold {
+			_, err = tx.Exec(ctx, "UPDATE snippets SET held = true WHERE id = $1", snippetID)
+			if err != nil {
+				return false, err
+			}
+			if err = notifySnippetChanged(ctx, tx, snippetID); err != nil {
+				return false, err
+			}
+			held = true
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return false, err
+	}
+
+	return held, nil
+}
+
+// Queue returns unexpired snippets that are held or have been reported,
+// held ones first, then the most reported
+func (m *ModerationModel) Queue(limit int) ([]*ModerationItem, error) {
+	stmt := `SELECT s.id, s.title, s.content, s.created, s.expires, s.held,
+                    COALESCE(s.user_id, 0), COALESCE(u.name, ''),
+                    count(r.user_id),
+                    COALESCE(array_agg(DISTINCT r.reason) FILTER (WHERE r.reason IS NOT NULL), '{}'),
+                    max(r.created), s.content_key
+             FROM snippets s
+             LEFT JOIN users u ON u.id = s.user_id
+             LEFT JOIN snippet_reports r ON r.snippet_id = s.id
+             WHERE s.expires > CURRENT_TIMESTAMP AND (s.held OR r.snippet_id IS NOT NULL)
+             GROUP BY s.id, u.name
+             ORDER BY s.held DESC, count(r.user_id) DESC, s.id DESC
+             LIMIT $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, stmt, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*ModerationItem{}
+	for rows.Next() {
+		item := &ModerationItem{Snippet: &Snippet{}}
+		var lastReported *time.Time
+		var keyID *string
+		err = rows.Scan(&item.ID, &item.Title, &item.Content, &item.Created, &item.Expires, &item.Held,
+			&item.AuthorID, &item.Author, &item.Reports, &item.Reasons, &lastReported, &keyID)
+		if err != nil {
+			return nil, err
+		}
+		if err = m.Keys.openInto(item.Snippet, keyID); err != nil {
+			return nil, err
+		}
+		if lastReported != nil {
+			item.LastReported = *lastReported
+		}
+		items = append(items, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// Approve publishes a held snippet again and dismisses its reports.
+// Returns ErrNoRecord if the snippet doesn't exist.
+func (m *ModerationModel) Approve(snippetID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, "UPDATE snippets SET held = false WHERE id = $1", snippetID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("snippet", snippetID)
+	}
+
+	_, err = tx.Exec(ctx, "DELETE FROM snippet_reports WHERE snippet_id = $1", snippetID)
+	if err != nil {
+		return err
+	}
+
+	if err = notifySnippetChanged(ctx, tx, snippetID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Remove deletes a snippet along with its reports and views. Returns
+// ErrNoRecord if the snippet doesn't exist.
+func (m *ModerationModel) Remove(snippetID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err = removeSnippet(ctx, tx, snippetID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// BanAuthor removes a snippet and bans the user who created it. Admins are
+// never banned this way.
+//
+// Returns the author's ID, or zero if the snippet has no known author (the
+// snippet is still removed). Returns ErrNoRecord if the snippet doesn't
+// exist.
+func (m *ModerationModel) BanAuthor(snippetID int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var authorID *int
+	err = tx.QueryRow(ctx, "SELECT user_id FROM snippets WHERE id = $1", snippetID).Scan(&authorID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, notFound("snippet", snippetID)
+		}
+		return 0, err
+	}
+
+	if err = removeSnippet(ctx, tx, snippetID); err != nil {
+		return 0, err
+	}
+
+	if authorID == nil {
+		return 0, tx.Commit(ctx)
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE users SET banned = true WHERE id = $1 AND role <> $2", *authorID, RoleAdmin)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return *authorID, nil
+}
+
+// removeSnippet deletes a snippet inside tx and announces the change.
+// Returns ErrNoRecord if the snippet doesn't exist.
+func removeSnippet(ctx context.Context, tx pgx.Tx, id int) error {
+	tag, err := tx.Exec(ctx, "DELETE FROM snippets WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("snippet", id)
+	}
+
+	return notifySnippetChanged(ctx, tx, id)
+}
+
+// notifySnippetChanged sends id on the snippets_changed channel when tx
+// commits, so caches on every instance drop the snippet
+func notifySnippetChanged(ctx context.Context, tx pgx.Tx, id int) error {
+	_, err := tx.Exec(ctx, "SELECT pg_notify($1, $2)", snippetsChangedChannel, strconv.Itoa(id))
+	return err
+}
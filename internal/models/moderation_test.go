@@ -0,0 +1,128 @@
+package models
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestModerationModelReport(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users", "snippets")
+	snippets := SnippetModel{DB: db}
+	m := ModerationModel{DB: db}
+
+	// Reporters beyond the fixtures, one short of the hold threshold
+	var reporters []int
+	for i := range ReportHoldThreshold {
+		var id int
+		err := db.QueryRow(context.Background(), `INSERT INTO users (name, email, hashed_password, created)
+		VALUES ('Reporter', 'reporter' || $1 || '@example.com', '', CURRENT_TIMESTAMP) RETURNING id`, i).Scan(&id)
+		assert.NilError(t, err)
+		reporters = append(reporters, id)
+	}
+
+	for _, id := range reporters[:ReportHoldThreshold-1] {
+		held, err := m.Report(1, id, ReportSpam)
+		assert.NilError(t, err)
+		assert.Equal(t, held, false)
+	}
+
+	// Reporting twice doesn't count twice
+	held, err := m.Report(1, reporters[0], ReportAbuse)
+	assert.NilError(t, err)
+	assert.Equal(t, held, false)
+
+	queue, err := m.Queue(10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(queue), 1)
+	assert.Equal(t, queue[0].Reports, ReportHoldThreshold-1)
+	assert.DeepEqual(t, queue[0].Reasons, []string{ReportSpam})
+
+	held, err = m.Report(1, reporters[ReportHoldThreshold-1], ReportAbuse)
+	assert.NilError(t, err)
+	assert.Equal(t, held, true)
+
+	// Held snippets are hidden
+	_, err = snippets.Get(t.Context(), 1)
+	assert.ErrorIs(t, err, ErrNoRecord)
+
+	_, err = m.Report(99, reporters[0], ReportSpam)
+	assert.ErrorIs(t, err, ErrNoRecord)
+
+	// Approving publishes it again and clears the reports
+	assert.NilError(t, m.Approve(1))
+	_, err = snippets.Get(t.Context(), 1)
+	assert.NilError(t, err)
+
+	queue, err = m.Queue(10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(queue), 0)
+}
+
+func TestModerationModelBanAuthor(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users")
+	snippets := SnippetModel{DB: db}
+	users := UserModel{DB: db}
+	m := ModerationModel{DB: db}
+
+	id, err := snippets.Insert(1, netip.Addr{}, "Spam", "Buy now", 7, false, SnippetLimits{})
+	assert.NilError(t, err)
+
+	authorID, err := m.BanAuthor(id)
+	assert.NilError(t, err)
+	assert.Equal(t, authorID, 1)
+
+	_, err = snippets.Get(t.Context(), id)
+	assert.ErrorIs(t, err, ErrNoRecord)
+
+	_, err = users.Authenticate("alice@example.com", "pa$$word")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	_, err = users.Get(1)
+	assert.ErrorIs(t, err, ErrNoRecord)
+
+	// Admins are never banned
+	id, err = snippets.Insert(3, netip.Addr{}, "Announcement", "Hello", 7, false, SnippetLimits{})
+	assert.NilError(t, err)
+
+	_, err = m.BanAuthor(id)
+	assert.NilError(t, err)
+
+	_, err = users.Get(3)
+	assert.NilError(t, err)
+
+	_, err = m.BanAuthor(id)
+	assert.ErrorIs(t, err, ErrNoRecord)
+}
+
+func TestAuditModel(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users")
+	m := AuditModel{DB: db}
+
+	assert.NilError(t, m.Record(3, AuditSnippetRemove, "snippet:1", ""))
+	assert.NilError(t, m.Record(3, AuditIPBan, "ip:203.0.113.0/24", "Credential stuffing"))
+
+	entries, err := m.Recent(10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 2)
+	assert.Equal(t, entries[0].Action, AuditIPBan)
+	assert.Equal(t, entries[0].Actor, "Carol Admin")
+	assert.Equal(t, entries[0].Detail, "Credential stuffing")
+
+	entries, err = m.ForTarget("snippet:1", 10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 1)
+	assert.Equal(t, entries[0].Action, AuditSnippetRemove)
+}
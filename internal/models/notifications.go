@@ -0,0 +1,118 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// =============================================================================
+// Notification Preferences
+// =============================================================================
+
+// Kinds of notification email a user can opt in to or out of
+const (
+	NotifyComments      = "comments"      // Comments on the user's snippets
+	NotifyFollowers     = "followers"     // Someone followed the user
+	NotifyAnnouncements = "announcements" // Product announcements
+	NotifyDigest        = "digest"        // Weekly digest of popular snippets
+	NotifySubscriptions = "subscriptions" // New snippets matching saved searches and tags
+)
+
+// NotificationKinds lists every notification kind, in display order
+var NotificationKinds = []string{NotifyComments, NotifyFollowers, NotifySubscriptions, NotifyDigest, NotifyAnnouncements}
+
+// DefaultNotificationPreference reports whether a kind is enabled for users
+// who have never changed it. Activity about the user's own content is on by
+// default; digests and announcements are opt-in.
+func DefaultNotificationPreference(kind string) bool {
+	return kind != NotifyAnnouncements && kind != NotifyDigest
+}
+
+// NotificationPreferences returns whether each notification kind is enabled
+// for the user, with defaults filled in for kinds never set
+func (m *UserModel) NotificationPreferences(id int) (map[string]bool, error) {
+	stmt := "SELECT kind, enabled FROM notification_preferences WHERE user_id = $1"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	prefs := make(map[string]bool, len(NotificationKinds))
+	for _, kind := range NotificationKinds {
+		prefs[kind] = DefaultNotificationPreference(kind)
+	}
+
+	rows, err := m.DB.Query(ctx, stmt, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var kind string
+		var enabled bool
+		if err = rows.Scan(&kind, &enabled); err != nil {
+			return nil, err
+		}
+		prefs[kind] = enabled
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return prefs, nil
+}
+
+// SetNotificationPreference enables or disables one notification kind for
+// the user
+func (m *UserModel) SetNotificationPreference(id int, kind string, enabled bool) error {
+	stmt := `INSERT INTO notification_preferences (user_id, kind, enabled)
+             VALUES ($1, $2, $3)
+             ON CONFLICT (user_id, kind) DO UPDATE SET enabled = EXCLUDED.enabled`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, stmt, id, kind, enabled)
+	return err
+}
+
+// NotificationSubscribers returns the IDs of all users who receive the given
+// notification kind, whether by explicit choice or by default
+func (m *UserModel) NotificationSubscribers(kind string) ([]int, error) {
+	stmt := `SELECT user_id FROM notification_preferences
+             WHERE kind = $1 AND enabled
+             ORDER BY user_id`
+	if DefaultNotificationPreference(kind) {
+		stmt = `SELECT u.id FROM users u
+                WHERE NOT EXISTS (
+                    SELECT 1 FROM notification_preferences p
+                    WHERE p.user_id = u.id AND p.kind = $1 AND NOT p.enabled
+                )
+                ORDER BY u.id`
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, stmt, kind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,186 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =============================================================================
+// Outbox Model - Type Definitions
+// =============================================================================
+// Changes that others should hear about write an event to the outbox in the
+// same transaction, so the event exists if and only if the change does. The
+// relay delivers each event afterwards by writing what it causes, such as
+// an in-app notification and a queued email, in one transaction with
+// marking it delivered, so nothing is sent twice either.
+
+// Outbox event kinds
+const (
+	EventUserFollowed = "user.followed" // Payload is a UserFollowedEvent
+)
+
+// OutboxMaxAttempts is how many times the relay tries to deliver an event
+// before leaving it undelivered, with its last error, for someone to look
+// into
+const OutboxMaxAttempts = 10
+
+// UserFollowedEvent is the payload of an EventUserFollowed event
+type UserFollowedEvent struct {
+	FollowerID int `json:"follower_id"`
+	FollowedID int `json:"followed_id"`
+}
+
+// OutboxEvent is an event waiting in the outbox
+type OutboxEvent struct {
+	ID        int
+	Kind      string
+	Payload   json.RawMessage
+	Attempts  int
+	LastError string
+	Created   time.Time
+}
+
+// OutboxDelivery is what delivering an event writes, all or nothing
+type OutboxDelivery struct {
+	Notification *NewNotification // In-app notification, if any
+	Jobs         []NewJob
+}
+
+// NewNotification is an in-app notification to record
+type NewNotification struct {
+	UserID  int
+	ActorID int
+	Kind    string
+	Link    string
+	Detail  string
+}
+
+// NewJob is a job to queue
+type NewJob struct {
+	Kind        string
+	Payload     any
+	MaxAttempts int
+}
+
+// OutboxModelInterface defines the interface for relaying outbox events
+type OutboxModelInterface interface {
+	Pending(limit int) ([]*OutboxEvent, error)
+	Deliver(id int, delivery OutboxDelivery) (bool, error)
+	Failed(id int, errMsg string) error
+}
+
+// OutboxModel wraps a database connection pool
+type OutboxModel struct {
+	DB *pgxpool.Pool
+}
+
+// querier runs statements on either a pool or a transaction
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// =============================================================================
+// Outbox Model - Methods
+// =============================================================================
+
+// insertEvent writes an event to the outbox. Call it in the transaction
+// making the change the event describes.
+func insertEvent(ctx context.Context, tx pgx.Tx, kind string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "INSERT INTO outbox (kind, payload) VALUES ($1, $2)", kind, data)
+	return err
+}
+
+// Pending returns up to limit undelivered events with attempts left, oldest
+// first
+func (m *OutboxModel) Pending(limit int) ([]*OutboxEvent, error) {
+	stmt := `SELECT id, kind, payload, attempts, last_error, created
+             FROM outbox
+             WHERE delivered IS NULL AND attempts < $1
+             ORDER BY id
+             LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, stmt, OutboxMaxAttempts, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*OutboxEvent{}
+	for rows.Next() {
+		e := &OutboxEvent{}
+		err = rows.Scan(&e.ID, &e.Kind, &e.Payload, &e.Attempts, &e.LastError, &e.Created)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// Deliver marks an event delivered and writes the delivery, in one
+// transaction. It returns false, writing nothing, if the event was already
+// delivered, such as by a relay on another instance.
+func (m *OutboxModel) Deliver(id int, delivery OutboxDelivery) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Another relay delivering the event holds its row until it commits,
+	// after which this finds it delivered
+	tag, err := tx.Exec(ctx, "UPDATE outbox SET delivered = CURRENT_TIMESTAMP WHERE id = $1 AND delivered IS NULL", id)
+	if err != nil {
+		return false, err
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	if n := delivery.Notification; n != nil {
+		if err = insertNotification(ctx, tx, n.UserID, n.ActorID, n.Kind, n.Link, n.Detail); err != nil {
+			return false, err
+		}
+	}
+	for _, job := range delivery.Jobs {
+		if _, err = insertJob(ctx, tx, job.Kind, job.Payload, job.MaxAttempts); err != nil {
+			return false, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Failed counts a failed attempt to deliver an event, recording the error
+func (m *OutboxModel) Failed(id int, errMsg string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, "UPDATE outbox SET attempts = attempts + 1, last_error = $2 WHERE id = $1", id, errMsg)
+	return err
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestOutboxModel(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users")
+	follows := FollowModel{DB: db}
+	m := OutboxModel{DB: db}
+
+	// A new follow writes an event; following again doesn't
+	_, err := follows.Follow(3, 1)
+	assert.NilError(t, err)
+	_, err = follows.Follow(3, 1)
+	assert.NilError(t, err)
+
+	events, err := m.Pending(10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(events), 1)
+	assert.Equal(t, events[0].Kind, EventUserFollowed)
+	var payload UserFollowedEvent
+	assert.NilError(t, json.Unmarshal(events[0].Payload, &payload))
+	assert.Equal(t, payload, UserFollowedEvent{FollowerID: 3, FollowedID: 1})
+
+	// A failed attempt leaves the event pending
+	assert.NilError(t, m.Failed(events[0].ID, "mail server down"))
+	events, err = m.Pending(10)
+	assert.NilError(t, err)
+	assert.Equal(t, events[0].Attempts, 1)
+	assert.Equal(t, events[0].LastError, "mail server down")
+
+	delivery := OutboxDelivery{
+		Notification: &NewNotification{UserID: 1, ActorID: 3, Kind: NotifyFollowers, Link: "/user/profile/3"},
+		Jobs:         []NewJob{{Kind: "email", Payload: map[string]string{"recipient": "alice@example.com"}, MaxAttempts: 5}},
+	}
+	delivered, err := m.Deliver(events[0].ID, delivery)
+	assert.NilError(t, err)
+	assert.Equal(t, delivered, true)
+
+	// Delivering again writes nothing
+	delivered, err = m.Deliver(events[0].ID, delivery)
+	assert.NilError(t, err)
+	assert.Equal(t, delivered, false)
+
+	events, err = m.Pending(10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(events), 0)
+
+	unread, err := (&NotificationModel{DB: db}).UnreadCount(1)
+	assert.NilError(t, err)
+	assert.Equal(t, unread, 1)
+
+	var jobs int
+	assert.NilError(t, db.QueryRow(t.Context(), "SELECT count(*) FROM jobs WHERE kind = 'email'").Scan(&jobs))
+	assert.Equal(t, jobs, 1)
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// =============================================================================
+// Password Hashing
+// =============================================================================
+
+// DefaultBcryptCost is the bcrypt cost used when none is configured
+const DefaultBcryptCost = 12
+
+// MaxPasswordBytes is the longest password, in bytes, that can be hashed
+// without a pepper: bcrypt refuses longer ones
+const MaxPasswordBytes = 72
+
+// ErrPepperMissing is returned when checking a password hashed with a pepper
+// while none is configured
+var ErrPepperMissing = errors.New("models: password was hashed with a pepper, but none is configured")
+
+// PasswordHasher holds the parameters passwords are hashed with. The zero
+// value hashes with DefaultBcryptCost and no pepper.
+type PasswordHasher struct {
+	// Cost is the bcrypt cost of new hashes. Hashes of another cost are
+	// replaced when their user next logs in.
+	Cost int
+
+	// Pepper is a secret kept out of the database and mixed into every
+	// password before hashing, so a leaked database alone isn't enough to
+	// guess passwords. Hashes made without it are replaced when their user
+	// next logs in. Hashes made with it can't be checked without it.
+	Pepper []byte
+}
+
+// MaxBytes returns the longest password, in bytes, that can be hashed, or 0
+// if there is no limit
+func (h PasswordHasher) MaxBytes() int {
+	if len(h.Pepper) > 0 {
+		return 0
+	}
+	return MaxPasswordBytes
+}
+
+// cost returns the bcrypt cost of new hashes
+func (h PasswordHasher) cost() int {
+	if h.Cost == 0 {
+		return DefaultBcryptCost
+	}
+	return h.Cost
+}
+
+// prepare returns what is given to bcrypt for password. Peppered passwords
+// are an HMAC of the password, which also lifts bcrypt's 72 byte limit.
+func (h PasswordHasher) prepare(password string, peppered bool) []byte {
+	if !peppered {
+		return []byte(password)
+	}
+	mac := hmac.New(sha256.New, h.Pepper)
+	mac.Write([]byte(password))
+	return []byte(base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+}
+
+// hash hashes password, reporting whether it was peppered
+func (h PasswordHasher) hash(password string) ([]byte, bool, error) {
+	peppered := len(h.Pepper) > 0
+	hash, err := bcrypt.GenerateFromPassword(h.prepare(password, peppered), h.cost())
+	if err != nil {
+		return nil, false, err
+	}
+	return hash, peppered, nil
+}
+
+// check returns ErrInvalidCredentials unless password matches hash
+func (h PasswordHasher) check(hash []byte, peppered bool, password string) error {
+	if peppered && len(h.Pepper) == 0 {
+		return ErrPepperMissing
+	}
+	err := bcrypt.CompareHashAndPassword(hash, h.prepare(password, peppered))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrInvalidCredentials
+	}
+	return err
+}
+
+// needsRehash reports whether hash was made with other parameters than
+// new hashes are
+func (h PasswordHasher) needsRehash(hash []byte, peppered bool) bool {
+	cost, err := bcrypt.Cost(hash)
+	return err != nil || cost != h.cost() || peppered != (len(h.Pepper) > 0)
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+)
+
+func TestPasswordHasher(t *testing.T) {
+	plain := PasswordHasher{Cost: 4}
+	peppered := PasswordHasher{Cost: 4, Pepper: []byte("a-pepper-of-at-least-thirty-two-bytes")}
+
+	hash, wasPeppered, err := plain.hash("pa$$word")
+	assert.NilError(t, err)
+	assert.Equal(t, wasPeppered, false)
+	assert.NilError(t, plain.check(hash, false, "pa$$word"))
+	assert.ErrorIs(t, plain.check(hash, false, "wrong"), ErrInvalidCredentials)
+	assert.Equal(t, plain.needsRehash(hash, false), false)
+
+	// Hashes of another cost, or made before a pepper was configured, are
+	// still checked but need replacing
+	assert.Equal(t, PasswordHasher{}.needsRehash(hash, false), true)
+	assert.NilError(t, peppered.check(hash, false, "pa$$word"))
+	assert.Equal(t, peppered.needsRehash(hash, false), true)
+
+	hash, wasPeppered, err = peppered.hash("pa$$word")
+	assert.NilError(t, err)
+	assert.Equal(t, wasPeppered, true)
+	assert.NilError(t, peppered.check(hash, true, "pa$$word"))
+	assert.ErrorIs(t, peppered.check(hash, true, "wrong"), ErrInvalidCredentials)
+	assert.Equal(t, peppered.needsRehash(hash, true), false)
+
+	// Without the pepper the hash can't be checked, and with another it
+	// doesn't match
+	assert.ErrorIs(t, plain.check(hash, true, "pa$$word"), ErrPepperMissing)
+	other := PasswordHasher{Cost: 4, Pepper: []byte("another-pepper-of-thirty-two-bytes")}
+	assert.ErrorIs(t, other.check(hash, true, "pa$$word"), ErrInvalidCredentials)
+
+	// Peppered passwords aren't cut off at bcrypt's 72 bytes
+	long := strings.Repeat("x", 80)
+	hash, _, err = peppered.hash(long)
+	assert.NilError(t, err)
+	assert.ErrorIs(t, peppered.check(hash, true, long[:72]), ErrInvalidCredentials)
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// =============================================================================
+// Database Error Translation
+// =============================================================================
+// Violations of the constraints callers care about are reported as domain
+// errors, matched on the constraint's name rather than on the message,
+// which changes with the server's version and language. A new unique
+// constraint gets an entry in uniqueErrors and its error in errors.go; a
+// new check constraint an entry in checkErrors.
+
+const (
+	// uniqueViolation is the Postgres error code for a unique constraint
+	// violation
+	uniqueViolation = "23505"
+
+	// checkViolation is the Postgres error code for a check constraint
+	// violation
+	checkViolation = "23514"
+)
+
+// uniqueErrors maps unique constraints and indexes to the error a
+// violation of each is reported as, wrapped in a ConflictError
+var uniqueErrors = map[string]error{
+	"users_uc_email":            ErrDuplicateEmail,
+	"idx_users_saml_subject":    ErrDuplicateSubject,
+	"api_tokens_token_hash_key": ErrDuplicateToken,
+}
+
+// checkErrors maps check constraints to the ValidationError a violation of
+// each is reported as
+var checkErrors = map[string]ValidationError{
+	"follows_check":             {Field: "followed_id", Message: "users can't follow themselves"},
+	"subscriptions_kind_check":  {Field: "kind", Message: "must be search or tag"},
+	"announcements_level_check": {Field: "level", Message: "must be info, warning or critical"},
+}
+
+// translateError returns a ConflictError or ValidationError for a
+// violation of one of the constraints in uniqueErrors or checkErrors, and
+// any other error as it is
+func translateError(err error) error {
+	var pgError *pgconn.PgError
+	if !errors.As(err, &pgError) {
+		return err
+	}
+	switch pgError.Code {
+	case uniqueViolation:
+		if mapped, ok := uniqueErrors[pgError.ConstraintName]; ok {
+			return &ConflictError{Constraint: pgError.ConstraintName, Err: mapped}
+		}
+	case checkViolation:
+		if mapped, ok := checkErrors[pgError.ConstraintName]; ok {
+			return &mapped
+		}
+	}
+	return err
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"adotkaya.playground/internal/assert"
+)
+
+func TestTranslateError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"Email", &pgconn.PgError{Code: uniqueViolation, ConstraintName: "users_uc_email"}, ErrDuplicateEmail},
+		{"Wrapped", fmt.Errorf("insert: %w", &pgconn.PgError{Code: uniqueViolation, ConstraintName: "api_tokens_token_hash_key"}), ErrDuplicateToken},
+		{"SAML subject", &pgconn.PgError{Code: uniqueViolation, ConstraintName: "idx_users_saml_subject"}, ErrDuplicateSubject},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := translateError(tt.err)
+			assert.ErrorIs(t, got, tt.want)
+			var conflict *ConflictError
+			if !errors.As(got, &conflict) {
+				t.Fatalf("got %T; want *ConflictError", got)
+			}
+			assert.Equal(t, conflict.Error(), tt.want.Error())
+		})
+	}
+
+	t.Run("Check constraint", func(t *testing.T) {
+		got := translateError(&pgconn.PgError{Code: checkViolation, ConstraintName: "subscriptions_kind_check"})
+		var invalid *ValidationError
+		if !errors.As(got, &invalid) {
+			t.Fatalf("got %T; want *ValidationError", got)
+		}
+		assert.Equal(t, invalid.Field, "kind")
+		assert.Equal(t, got.Error(), "models: invalid kind: must be search or tag")
+	})
+
+	// Anything else is passed through as it is
+	unmapped := &pgconn.PgError{Code: uniqueViolation, ConstraintName: "follows_pkey"}
+	otherCode := &pgconn.PgError{Code: "23503", ConstraintName: "users_uc_email"}
+	other := errors.New("connection reset")
+	for _, err := range []error{unmapped, otherCode, other, nil} {
+		assert.Equal(t, translateError(err), err)
+	}
+}
+
+func TestNotFoundError(t *testing.T) {
+	err := fmt.Errorf("loading: %w", notFound("snippet", 4))
+	assert.ErrorIs(t, err, ErrNoRecord)
+	assert.Equal(t, err.Error(), "loading: models: no snippet with ID 4")
+
+	var nf *NotFoundError
+	if !errors.As(err, &nf) {
+		t.Fatal("expected a NotFoundError")
+	}
+	assert.Equal(t, nf.Resource, "snippet")
+	assert.Equal(t, nf.ID, any(4))
+
+	// Without an ID, as when no job is due
+	assert.Equal(t, notFound("due job", nil).Error(), "models: no due job")
+}
@@ -0,0 +1,148 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// =============================================================================
+// User Provisioning - Methods
+// =============================================================================
+// These back the SCIM API, through which an identity provider creates,
+// updates and deactivates accounts. Unlike Get, they see banned and
+// deactivated users.
+
+// accountColumns are the user columns returned to identity providers
+const accountColumns = "id, name, email, created, locale, theme, role, active, tier"
+
+// Provision creates an account managed by an identity provider. It gets a
+// random password, so it can only sign in through single sign-on. Returns
+// ErrDuplicateEmail if the email address is already in use.
+func (m *UserModel) Provision(name, email string, active bool) (int, error) {
+	hashedPassword, err := unusablePassword()
+	if err != nil {
+		return 0, err
+	}
+
+	stmt := `INSERT INTO users (name, email, hashed_password, active, created)
+             VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+             RETURNING id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int
+	err = m.DB.QueryRow(ctx, stmt, name, email, string(hashedPassword), active).Scan(&id)
+	if err != nil {
+		return 0, translateError(err)
+	}
+	return id, nil
+}
+
+// Account returns a user whether or not they are banned or deactivated.
+// Returns ErrNoRecord if there is no user with the given ID.
+func (m *UserModel) Account(id int) (*User, error) {
+	stmt := "SELECT " + accountColumns + " FROM users WHERE id = $1"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	u, err := scanAccount(m.DB.QueryRow(ctx, stmt, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, notFound("user", id)
+		}
+		return nil, err
+	}
+	return u, nil
+}
+
+// Accounts returns up to limit users in ID order, skipping the first
+// offset, and how many users there are in all. A non-empty email only
+// matches the user with that address.
+func (m *UserModel) Accounts(email string, offset, limit int) ([]*User, int, error) {
+	stmt := "SELECT " + accountColumns + `, COUNT(*) OVER ()
+             FROM users
+             WHERE $1 = '' OR email = $1
+             ORDER BY id
+             OFFSET $2
+             LIMIT $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, stmt, email, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	total := 0
+	for rows.Next() {
+		u := &User{}
+		err = rows.Scan(&u.ID, &u.Name, &u.Email, &u.Created, &u.Locale, &u.Theme, &u.Role, &u.Active, &u.Tier, &total)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, u)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	// With no rows on the page, none carries the total
+	if len(users) == 0 {
+		err = m.DB.QueryRow(ctx, "SELECT COUNT(*) FROM users WHERE $1 = '' OR email = $1", email).Scan(&total)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return users, total, nil
+}
+
+// UpdateAccount sets a user's name, email address and whether they are
+// active. Deactivated users can't log in and their sessions stop working.
+// Returns ErrNoRecord if there is no such user and ErrDuplicateEmail if
+// another user has the email address.
+func (m *UserModel) UpdateAccount(id int, name, email string, active bool) error {
+	stmt := "UPDATE users SET name = $2, email = $3, active = $4 WHERE id = $1"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tag, err := m.DB.Exec(ctx, stmt, id, name, email, active)
+	if err != nil {
+		return translateError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("user", id)
+	}
+	return nil
+}
+
+// scanAccount scans the accountColumns of a user
+func scanAccount(row pgx.Row) (*User, error) {
+	u := &User{}
+	err := row.Scan(&u.ID, &u.Name, &u.Email, &u.Created, &u.Locale, &u.Theme, &u.Role, &u.Active, &u.Tier)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// unusablePassword returns the bcrypt hash of a random password nobody
+// knows, for accounts that sign in through an identity provider
+func unusablePassword() ([]byte, error) {
+	password := make([]byte, 32)
+	if _, err := rand.Read(password); err != nil {
+		return nil, err
+	}
+	return bcrypt.GenerateFromPassword(password, 12)
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestUserModelProvisioning(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users")
+	m := UserModel{DB: db}
+
+	// Provisioned accounts can't log in with a password
+	id, err := m.Provision("Dave", "dave@example.com", true)
+	assert.NilError(t, err)
+	_, err = m.Authenticate("dave@example.com", "")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	_, err = m.Provision("Alice", "alice@example.com", true)
+	assert.ErrorIs(t, err, ErrDuplicateEmail)
+
+	users, total, err := m.Accounts("dave@example.com", 0, 10)
+	assert.NilError(t, err)
+	assert.Equal(t, total, 1)
+	assert.Equal(t, users[0].ID, id)
+
+	users, total, err = m.Accounts("", 0, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(users), 1)
+	assert.Equal(t, total, 3)
+
+	users, total, err = m.Accounts("", 10, 10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(users), 0)
+	assert.Equal(t, total, 3)
+
+	// Deactivated users can't log in, but are still managed
+	err = m.UpdateAccount(1, "Alice Jones", "alice@example.com", false)
+	assert.NilError(t, err)
+	_, err = m.Authenticate("alice@example.com", "pa$$word")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = m.Get(1)
+	assert.ErrorIs(t, err, ErrNoRecord)
+
+	user, err := m.Account(1)
+	assert.NilError(t, err)
+	assert.Equal(t, user.Active, false)
+
+	err = m.UpdateAccount(1, "Alice Jones", "alice@example.com", true)
+	assert.NilError(t, err)
+	_, err = m.Authenticate("alice@example.com", "pa$$word")
+	assert.NilError(t, err)
+
+	err = m.UpdateAccount(1, "Alice Jones", "admin@example.com", true)
+	assert.ErrorIs(t, err, ErrDuplicateEmail)
+	err = m.UpdateAccount(99, "Nobody", "nobody@example.com", true)
+	assert.ErrorIs(t, err, ErrNoRecord)
+	_, err = m.Account(99)
+	assert.ErrorIs(t, err, ErrNoRecord)
+}
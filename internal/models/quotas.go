@@ -0,0 +1,165 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// =============================================================================
+// Snippet Quotas
+// =============================================================================
+
+// Snippet limit kinds reported in a QuotaError
+const (
+	QuotaHourly  = "hourly"  // Snippets created in the last hour
+	QuotaTotal   = "total"   // Unexpired snippets
+	QuotaPrivate = "private" // Unexpired private snippets
+)
+
+// SnippetLimits caps how many snippets a user, or an anonymous creator's
+// address, may create. Zero means no limit.
+type SnippetLimits struct {
+	PerHour int
+	Total   int
+	Private int // Only users can have private snippets
+}
+
+// QuotaError is returned by Insert, or Update making a snippet private,
+// when the user has reached a limit
+type QuotaError struct {
+	Limit      string // QuotaHourly, QuotaTotal or QuotaPrivate
+	Max        int
+	RetryAfter time.Duration // Until the hourly limit frees up; zero for total
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("models: %s snippet quota of %d reached", e.Limit, e.Max)
+}
+
+// creator returns the user_id and creator_ip values for a new snippet.
+// Snippets by users have no creator_ip; anonymous snippets have no user_id.
+func creator(userID int, ip netip.Addr) (any, any) {
+	if userID != 0 {
+		return userID, nil
+	}
+	if !ip.IsValid() {
+		return nil, nil
+	}
+	return nil, ip
+}
+
+// checkQuota fails with a QuotaError if the creator is at a limit, counting
+// private snippets too if the new one is private. Users are counted by user
+// ID, anonymous creators by address. It must run in the transaction that
+// inserts the snippet; the creator is locked so concurrent inserts by the
+// same creator are checked one at a time.
+func checkQuota(ctx context.Context, tx pgx.Tx, userID, ip any, private bool, limits SnippetLimits) error {
+	if !private {
+		limits.Private = 0
+	}
+	if limits == (SnippetLimits{}) {
+		return nil
+	}
+
+	lock, where, key := "SELECT 1 FROM users WHERE id = $1 FOR UPDATE", "user_id = $1", userID
+	if userID == nil {
+		// All anonymous creators without a known address share one quota
+		lock = "SELECT pg_advisory_xact_lock(hashtext('snippet_quota:' || COALESCE($1::inet::text, '')))"
+		where, key = "user_id IS NULL AND creator_ip = $1", ip
+		if ip == nil {
+			where = "user_id IS NULL AND creator_ip IS NULL AND $1::inet IS NULL"
+		}
+	}
+
+	_, err := tx.Exec(ctx, lock, key)
+	if err != nil {
+		return err
+	}
+
+	stmt := `SELECT
+                 count(*) FILTER (WHERE created > CURRENT_TIMESTAMP - INTERVAL '1 hour'),
+                 count(*) FILTER (WHERE expires > CURRENT_TIMESTAMP),
+                 count(*) FILTER (WHERE private AND expires > CURRENT_TIMESTAMP),
+                 COALESCE(EXTRACT(EPOCH FROM min(created) FILTER (WHERE created > CURRENT_TIMESTAMP - INTERVAL '1 hour')
+                     + INTERVAL '1 hour' - CURRENT_TIMESTAMP), 0)::float8
+             FROM snippets
+             WHERE ` + where
+
+	var hourly, total, privates int
+	var retrySecs float64
+	err = tx.QueryRow(ctx, stmt, key).Scan(&hourly, &total, &privates, &retrySecs)
+	if err != nil {
+		return err
+	}
+
+	if limits.Total > 0 && total >= limits.Total {
+		return &QuotaError{Limit: QuotaTotal, Max: limits.Total}
+	}
+	if limits.Private > 0 && privates >= limits.Private {
+		return &QuotaError{Limit: QuotaPrivate, Max: limits.Private}
+	}
+	if limits.PerHour > 0 && hourly >= limits.PerHour {
+		retry := time.Duration(retrySecs * float64(time.Second)).Round(time.Second)
+		return &QuotaError{Limit: QuotaHourly, Max: limits.PerHour, RetryAfter: max(retry, time.Second)}
+	}
+
+	return nil
+}
+
+// checkPrivateQuota fails with a QuotaError if making a snippet private
+// would take its owner over their limit of private snippets. The snippet
+// itself isn't counted, so private snippets can always be edited. Like
+// checkQuota, it must run in the transaction making the change.
+func checkPrivateQuota(ctx context.Context, tx pgx.Tx, snippetID int, limits SnippetLimits) error {
+	if limits.Private == 0 {
+		return nil
+	}
+
+	var ownerID int
+	stmt := "SELECT id FROM users WHERE id = (SELECT user_id FROM snippets WHERE id = $1) FOR UPDATE"
+	err := tx.QueryRow(ctx, stmt, snippetID).Scan(&ownerID)
+	if err != nil {
+		// Anonymous snippets stay public anyway
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	stmt = `SELECT count(*) FROM snippets
+             WHERE user_id = $1 AND private AND expires > CURRENT_TIMESTAMP AND id <> $2`
+
+	var privates int
+	if err = tx.QueryRow(ctx, stmt, ownerID, snippetID).Scan(&privates); err != nil {
+		return err
+	}
+	if privates >= limits.Private {
+		return &QuotaError{Limit: QuotaPrivate, Max: limits.Private}
+	}
+	return nil
+}
+
+// SnippetQuota returns the user's own snippet limits, or ErrNoRecord if
+// the configured defaults apply
+func (m *UserModel) SnippetQuota(id int) (SnippetLimits, error) {
+	stmt := `SELECT per_hour, total FROM snippet_quotas WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var limits SnippetLimits
+	err := m.DB.QueryRow(ctx, stmt, id).Scan(&limits.PerHour, &limits.Total)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return SnippetLimits{}, notFound("snippet quota", id)
+		}
+		return SnippetLimits{}, err
+	}
+
+	return limits, nil
+}
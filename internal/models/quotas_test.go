@@ -0,0 +1,123 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestSnippetModelInsertQuota(t *testing.T) {
+	tests := []struct {
+		name      string
+		limits    SnippetLimits
+		inserts   int // Snippets created before the one being checked
+		wantLimit string
+	}{
+		{"No limits", SnippetLimits{}, 3, ""},
+		{"Under hourly", SnippetLimits{PerHour: 3}, 2, ""},
+		{"At hourly", SnippetLimits{PerHour: 3}, 3, QuotaHourly},
+		{"At total", SnippetLimits{PerHour: 10, Total: 2}, 2, QuotaTotal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			db := newTestDB(t)
+			testutil.LoadFixtures(t, db, "users", "snippets")
+			m := SnippetModel{DB: db}
+
+			for range tt.inserts {
+				_, err := m.Insert(1, netip.Addr{}, "O snail", "Climb Mount Fuji", 7, false, SnippetLimits{})
+				assert.NilError(t, err)
+			}
+
+			_, err := m.Insert(1, netip.Addr{}, "O snail", "Climb Mount Fuji", 7, false, tt.limits)
+			if tt.wantLimit == "" {
+				assert.NilError(t, err)
+				return
+			}
+
+			var quotaErr *QuotaError
+			assert.Equal(t, errors.As(err, &quotaErr), true)
+			assert.Equal(t, quotaErr.Limit, tt.wantLimit)
+			if tt.wantLimit == QuotaHourly {
+				assert.Equal(t, quotaErr.RetryAfter > 59*time.Minute, true)
+			}
+		})
+	}
+}
+
+func TestUserModelSnippetQuota(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users")
+	m := UserModel{DB: db}
+
+	_, err := m.SnippetQuota(1)
+	assert.ErrorIs(t, err, ErrNoRecord)
+
+	_, err = db.Exec(context.Background(), "INSERT INTO snippet_quotas (user_id, per_hour, total) VALUES (1, 50, 0)")
+	assert.NilError(t, err)
+
+	limits, err := m.SnippetQuota(1)
+	assert.NilError(t, err)
+	assert.Equal(t, limits, SnippetLimits{PerHour: 50})
+}
+
+func TestSnippetModelInsertAnonymousQuota(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	m := SnippetModel{DB: db}
+	limits := SnippetLimits{PerHour: 2}
+	ip := netip.MustParseAddr("198.51.100.7")
+
+	for range 2 {
+		_, err := m.Insert(0, ip, "O snail", "Climb Mount Fuji", 7, false, limits)
+		assert.NilError(t, err)
+	}
+
+	_, err := m.Insert(0, ip, "O snail", "Climb Mount Fuji", 7, false, limits)
+	var quotaErr *QuotaError
+	assert.Equal(t, errors.As(err, &quotaErr), true)
+
+	// Other addresses have their own quota
+	_, err = m.Insert(0, netip.MustParseAddr("198.51.100.8"), "O snail", "Climb Mount Fuji", 7, false, limits)
+	assert.NilError(t, err)
+}
+
+func TestSnippetModelPrivateQuota(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users")
+	m := SnippetModel{DB: db}
+	limits := SnippetLimits{Private: 2}
+
+	var ids []int
+	for range 2 {
+		id, err := m.Insert(1, netip.Addr{}, "Secret", "Shh", 7, true, limits)
+		assert.NilError(t, err)
+		ids = append(ids, id)
+	}
+
+	_, err := m.Insert(1, netip.Addr{}, "Secret", "Shh", 7, true, limits)
+	var quotaErr *QuotaError
+	assert.Equal(t, errors.As(err, &quotaErr), true)
+	assert.Equal(t, quotaErr.Limit, QuotaPrivate)
+
+	// Public snippets aren't affected
+	public, err := m.Insert(1, netip.Addr{}, "Open", "Hello", 7, false, limits)
+	assert.NilError(t, err)
+
+	// Private snippets can still be edited, but no more made private
+	assert.NilError(t, m.Update(ids[0], "Secret", "Still shh", true, limits))
+	err = m.Update(public, "Open", "Hello", true, limits)
+	assert.Equal(t, errors.As(err, &quotaErr), true)
+	assert.Equal(t, quotaErr.Limit, QuotaPrivate)
+}
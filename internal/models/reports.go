@@ -0,0 +1,172 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =============================================================================
+// Report Model - Type Definitions
+// =============================================================================
+// Reports are fixed, read-only queries admins can run from the site to
+// answer routine questions about its data, instead of connecting to the
+// database. Only the integer parameters each report declares can vary, and
+// they are passed as query arguments, never spliced into the SQL.
+
+// reportTimeout caps how long a report may run
+const reportTimeout = 10 * time.Second
+
+// ReportParam is an integer parameter of a report
+type ReportParam struct {
+	Name    string // Suffix of the "admin_reports.param.*" message
+	Default int
+	Min     int
+	Max     int
+}
+
+// Report is a predefined query
+type Report struct {
+	Name   string // Suffix of the "admin_reports.report.*" message
+	Params []ReportParam
+	stmt   string // Takes the Params' values as $1, $2... in order
+}
+
+// Reports are the reports admins can run, in the order they are listed
+var Reports = []Report{
+	{
+		Name: "top_users",
+		Params: []ReportParam{
+			{Name: "days", Default: 30, Min: 1, Max: 3650},
+			{Name: "limit", Default: 20, Min: 1, Max: 1000},
+		},
+		stmt: `SELECT u.id, u.name, u.email, count(*) AS snippets
+               FROM users u
+               JOIN snippets s ON s.user_id = u.id
+               WHERE s.created > CURRENT_TIMESTAMP - make_interval(days => $1)
+               GROUP BY u.id
+               ORDER BY snippets DESC, u.id
+               LIMIT $2`,
+	},
+	{
+		Name: "largest_snippets",
+		Params: []ReportParam{
+			{Name: "limit", Default: 20, Min: 1, Max: 1000},
+		},
+		stmt: `SELECT id, title, user_id, octet_length(content) AS bytes, created, expires
+               FROM snippets
+               ORDER BY bytes DESC, id
+               LIMIT $1`,
+	},
+	{
+		// Rows that refer to a snippet by ID without a foreign key outlive
+		// it. History is kept on purpose; the rest is clutter.
+		Name: "orphaned_rows",
+		stmt: `SELECT 'snippet_changes' AS table_name, count(*) AS orphans
+               FROM snippet_changes c
+               WHERE NOT EXISTS (SELECT 1 FROM snippets s WHERE s.id = c.snippet_id)
+               UNION ALL
+               SELECT 'audit_log', count(*)
+               FROM audit_log a
+               WHERE a.target LIKE 'snippet:%'
+                 AND NOT EXISTS (SELECT 1 FROM snippets s WHERE a.target = 'snippet:' || s.id)
+               UNION ALL
+               SELECT 'idempotency_keys', count(*)
+               FROM idempotency_keys k
+               WHERE k.snippet_id IS NOT NULL
+                 AND NOT EXISTS (SELECT 1 FROM snippets s WHERE s.id = k.snippet_id)`,
+	},
+}
+
+// ReportResult is the output of a report, with every value formatted as
+// text
+type ReportResult struct {
+	Columns []string
+	Rows    [][]string
+}
+
+// ReportModelInterface defines the interface for running reports
+type ReportModelInterface interface {
+	Run(ctx context.Context, report Report, args []int) (*ReportResult, error)
+}
+
+// ReportModel wraps a database connection pool
+type ReportModel struct {
+	DB *pgxpool.Pool
+}
+
+// =============================================================================
+// Report Model - Methods
+// =============================================================================
+
+// Run runs report with args, one for each of its parameters. It runs in a
+// read-only transaction, so it can't change anything, and is cancelled
+// after reportTimeout.
+func (m *ReportModel) Run(ctx context.Context, report Report, args []int) (*ReportResult, error) {
+	if len(args) != len(report.Params) {
+		return nil, fmt.Errorf("models: report %s takes %d arguments, not %d", report.Name, len(report.Params), len(args))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, reportTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	queryArgs := make([]any, len(args))
+	for i, a := range args {
+		queryArgs[i] = a
+	}
+	rows, err := tx.Query(ctx, report.stmt, queryArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := &ReportResult{Rows: [][]string{}}
+	for _, f := range rows.FieldDescriptions() {
+		result.Columns = append(result.Columns, f.Name)
+	}
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return nil, err
+		}
+		row := make([]string, len(values))
+		for i, v := range values {
+			row[i] = formatReportValue(v)
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// formatReportValue formats a value from a report's row. NULL is empty and
+// times are in UTC.
+func formatReportValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
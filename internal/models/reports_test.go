@@ -0,0 +1,48 @@
+package models
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestReportModelRun(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users", "snippets")
+	m := ReportModel{DB: db}
+	ctx := context.Background()
+
+	_, err := db.Exec(ctx, "UPDATE snippets SET user_id = 1 WHERE id IN (1, 2)")
+	assert.NilError(t, err)
+	_, err = db.Exec(ctx, `INSERT INTO snippet_changes (snippet_id, action, created)
+                           VALUES (1, 'create', CURRENT_TIMESTAMP), (99, 'delete', CURRENT_TIMESTAMP)`)
+	assert.NilError(t, err)
+
+	run := func(name string, args ...int) *ReportResult {
+		t.Helper()
+		i := slices.IndexFunc(Reports, func(r Report) bool { return r.Name == name })
+		result, err := m.Run(ctx, Reports[i], args)
+		assert.NilError(t, err)
+		return result
+	}
+
+	result := run("top_users", 30, 20)
+	assert.DeepEqual(t, result.Columns, []string{"id", "name", "email", "snippets"})
+	assert.DeepEqual(t, result.Rows, [][]string{{"1", "Alice Jones", "alice@example.com", "2"}})
+
+	result = run("largest_snippets", 1)
+	assert.Equal(t, len(result.Rows), 1)
+	assert.Equal(t, result.Columns[3], "bytes")
+
+	result = run("orphaned_rows")
+	assert.DeepEqual(t, result.Rows, [][]string{{"snippet_changes", "1"}, {"audit_log", "0"}, {"idempotency_keys", "0"}})
+
+	// Each parameter needs an argument
+	_, err = m.Run(ctx, Reports[0], []int{30})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =============================================================================
+// Schema Check - Type Definitions
+// =============================================================================
+// The server checks at startup that the tables, indexes and constraints it
+// can't work without are there, so a database that was restored partly or
+// migrated by hand fails with a list of what is missing rather than with
+// errors on the first requests.
+
+// schemaCheckTimeout caps how long the schema check may take
+const schemaCheckTimeout = 10 * time.Second
+
+// requiredTables are the tables the site reads or writes
+var requiredTables = []string{
+	"users", "snippets", "snippet_tags", "snippet_views", "snippet_quotas",
+	"snippet_reports", "snippet_changes", "snippet_gists", "trending_snippets",
+	"sessions", "jobs", "outbox", "audit_log", "ip_bans", "follows",
+	"notifications", "notification_preferences", "subscriptions",
+	"announcements", "api_tokens", "github_tokens", "login_events",
+	"idempotency_keys", "attachments", "avatars", "page_views",
+}
+
+// requiredIndexes are the indexes without which pages and the job worker
+// slow to a crawl as the tables grow
+var requiredIndexes = []string{
+	"idx_snippets_created",
+	"idx_snippets_search_vector",
+	"sessions_expiry_idx",
+	"idx_jobs_status_run_at",
+	"idx_outbox_pending",
+}
+
+// requiredConstraints are the constraints the code relies on to turn away
+// duplicates
+var requiredConstraints = []string{
+	"users_uc_email", // Signups and SCIM report ErrDuplicateEmail on it (see uniqueErrors)
+}
+
+// SchemaModelInterface defines the interface for checking the schema
+type SchemaModelInterface interface {
+	Missing(ctx context.Context) ([]string, error)
+}
+
+// SchemaModel wraps a database connection pool
+type SchemaModel struct {
+	DB *pgxpool.Pool
+}
+
+// =============================================================================
+// Schema Check - Methods
+// =============================================================================
+
+// Missing returns the required tables, indexes and constraints that are
+// missing from the current schema, each described like `index
+// "sessions_expiry_idx"`, or an empty slice if none are
+func (m *SchemaModel) Missing(ctx context.Context) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, schemaCheckTimeout)
+	defer cancel()
+
+	stmt := `SELECT kind, name
+             FROM (SELECT 'table' AS kind, unnest($1::text[]) AS name
+                   UNION ALL
+                   SELECT 'index', unnest($2::text[])) AS relations
+             WHERE to_regclass(quote_ident(name)) IS NULL
+             UNION ALL
+             SELECT 'constraint', name
+             FROM unnest($3::text[]) AS name
+             WHERE NOT EXISTS (SELECT 1 FROM pg_constraint c
+                               JOIN pg_namespace n ON n.oid = c.connamespace
+                               WHERE c.conname = name AND n.nspname = current_schema())`
+
+	rows, err := m.DB.Query(ctx, stmt, requiredTables, requiredIndexes, requiredConstraints)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	missing := []string{}
+	for rows.Next() {
+		var kind, name string
+		if err = rows.Scan(&kind, &name); err != nil {
+			return nil, err
+		}
+		missing = append(missing, fmt.Sprintf("%s %q", kind, name))
+	}
+	return missing, rows.Err()
+}
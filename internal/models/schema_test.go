@@ -0,0 +1,29 @@
+package models
+
+import (
+	"context"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+)
+
+func TestSchemaModelMissing(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	m := SchemaModel{DB: db}
+	ctx := context.Background()
+
+	missing, err := m.Missing(ctx)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, missing, []string{})
+
+	_, err = db.Exec(ctx, `DROP INDEX sessions_expiry_idx;
+                           ALTER TABLE users DROP CONSTRAINT users_uc_email;
+                           DROP TABLE avatars`)
+	assert.NilError(t, err)
+
+	missing, err = m.Missing(ctx)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, missing, []string{`table "avatars"`, `index "sessions_expiry_idx"`, `constraint "users_uc_email"`})
+}
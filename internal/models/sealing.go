@@ -0,0 +1,226 @@
+package models
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// =============================================================================
+// Content Encryption at Rest - Type Definitions
+// =============================================================================
+
+// maxKeyIDLength is the longest content key ID
+const maxKeyIDLength = 32
+
+// ErrUnknownKey is returned when content is sealed with a key that isn't
+// configured, or is sealed but no keys are configured at all
+var ErrUnknownKey = errors.New("models: content sealed with an unknown key")
+
+// ContentKey is a 256-bit AES key and the ID stored with content it seals
+type ContentKey struct {
+	ID  string
+	Key []byte
+}
+
+// ContentKeys encrypts snippet content at rest with AES-GCM. Sealed content
+// is stored base64 encoded with the sealing key's ID in content_key; rows
+// without one are plaintext. The first key seals new content; the others
+// only open content sealed before a key rotation, until Reseal has moved it
+// to the first key.
+//
+// A nil *ContentKeys stores content as plaintext, so models without keys
+// behave as before.
+type ContentKeys struct {
+	current string
+	aeads   map[string]cipher.AEAD
+}
+
+// NewContentKeys returns the keys for sealing content. keys must not be
+// empty; the first one seals new content.
+func NewContentKeys(keys []ContentKey) (*ContentKeys, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("models: no content keys")
+	}
+
+	k := &ContentKeys{current: keys[0].ID, aeads: make(map[string]cipher.AEAD, len(keys))}
+	for _, key := range keys {
+		if !validKeyID(key.ID) {
+			return nil, fmt.Errorf("models: invalid content key ID %q", key.ID)
+		}
+		if _, ok := k.aeads[key.ID]; ok {
+			return nil, fmt.Errorf("models: duplicate content key ID %q", key.ID)
+		}
+		if len(key.Key) != 32 {
+			return nil, fmt.Errorf("models: content key %q must be 32 bytes", key.ID)
+		}
+
+		block, err := aes.NewCipher(key.Key)
+		if err != nil {
+			return nil, err
+		}
+		k.aeads[key.ID], err = cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return k, nil
+}
+
+// =============================================================================
+// Content Encryption at Rest - Methods
+// =============================================================================
+
+// seal encrypts content with the current key, returning it with the key ID
+// to store. Without keys content is returned as is, with no key ID.
+func (k *ContentKeys) seal(content string) (sealed string, keyID *string, err error) {
+	if k == nil {
+		return content, nil, nil
+	}
+
+	aead := k.aeads[k.current]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(content)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+	out := aead.Seal(nonce, nonce, []byte(content), nil)
+
+	return base64.RawStdEncoding.EncodeToString(out), &k.current, nil
+}
+
+// open decrypts content sealed with the key keyID. Content without a key
+// ID is plaintext and returned as is.
+func (k *ContentKeys) open(content string, keyID *string) (string, error) {
+	if keyID == nil {
+		return content, nil
+	}
+	if k == nil || k.aeads[*keyID] == nil {
+		return "", ErrUnknownKey
+	}
+	aead := k.aeads[*keyID]
+
+	sealed, err := base64.RawStdEncoding.DecodeString(content)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errors.New("models: malformed sealed content")
+	}
+
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// openInto decrypts a snippet's content, scanned along with its key ID, in
+// place
+func (k *ContentKeys) openInto(s *Snippet, keyID *string) error {
+	content, err := k.open(s.Content, keyID)
+	if err != nil {
+		return fmt.Errorf("snippet %d: %w", s.ID, err)
+	}
+	s.Content = content
+	return nil
+}
+
+// Reseal rewrites up to limit snippets whose content is plaintext or sealed
+// with an old key, sealing it with the current key. Returns how many were
+// rewritten; after turning encryption on or rotating keys, call it until it
+// returns zero before removing old keys. Does nothing without keys.
+//
+// The content itself doesn't change, so no change notification is sent.
+func (m *SnippetModel) Reseal(limit int) (int, error) {
+	if m.Keys == nil {
+		return 0, nil
+	}
+
+	stmt := `SELECT id, content, content_key FROM snippets
+             WHERE content_key IS DISTINCT FROM $1
+             ORDER BY id
+             LIMIT $2
+             FOR UPDATE SKIP LOCKED`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, stmt, m.Keys.current, limit)
+	if err != nil {
+		return 0, err
+	}
+	stale := []*Snippet{}
+	for rows.Next() {
+		s := &Snippet{}
+		var keyID *string
+		if err = rows.Scan(&s.ID, &s.Content, &keyID); err != nil {
+			return 0, err
+		}
+		if err = m.Keys.openInto(s, keyID); err != nil {
+			return 0, err
+		}
+		stale = append(stale, s)
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, s := range stale {
+		content, keyID, err := m.Keys.seal(s.Content)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.Exec(ctx, "UPDATE snippets SET content = $2, content_key = $3 WHERE id = $1", s.ID, content, keyID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return len(stale), nil
+}
+
+// validKeyID reports whether id can be used as a content key ID: up to 32
+// letters, digits and hyphens
+func validKeyID(id string) bool {
+	if id == "" || len(id) > maxKeyIDLength {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// has reports whether content sealed with the key ID can be opened
+func (k *ContentKeys) has(id string) bool {
+	if k == nil {
+		return false
+	}
+	_, ok := k.aeads[id]
+	return ok
+}
+
+// openedSize returns the plaintext size of content of n bytes, sealed if
+// it has a key ID, without decrypting it
+func openedSize(n int64, keyID *string) int64 {
+	if keyID == nil {
+		return n
+	}
+
+	// AES-GCM adds a 12-byte nonce and a 16-byte tag
+	return int64(base64.RawStdEncoding.DecodedLen(int(n))) - 12 - 16
+}
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"net/netip"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func testContentKeys(t *testing.T, ids ...string) *ContentKeys {
+	t.Helper()
+
+	// Each ID always gets the same key
+	var keys []ContentKey
+	for _, id := range ids {
+		key := sha256.Sum256([]byte(id))
+		keys = append(keys, ContentKey{ID: id, Key: key[:]})
+	}
+	k, err := NewContentKeys(keys)
+	assert.NilError(t, err)
+	return k
+}
+
+func TestNewContentKeys(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+
+	tests := []struct {
+		name    string
+		keys    []ContentKey
+		wantErr bool
+	}{
+		{"Valid", []ContentKey{{"2024-06", key}, {"2023-01", key}}, false},
+		{"None", nil, true},
+		{"Short key", []ContentKey{{"a", key[:16]}}, true},
+		{"Empty ID", []ContentKey{{"", key}}, true},
+		{"Bad ID", []ContentKey{{"a:b", key}}, true},
+		{"Duplicate ID", []ContentKey{{"a", key}, {"a", key}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewContentKeys(tt.keys)
+			assert.Equal(t, err != nil, tt.wantErr)
+		})
+	}
+}
+
+func TestContentKeysSealOpen(t *testing.T) {
+	old := testContentKeys(t, "old")
+	rotated := testContentKeys(t, "new", "old")
+
+	sealed, keyID, err := old.seal("An old silent pond")
+	assert.NilError(t, err)
+	assert.Equal(t, *keyID, "old")
+	assert.Equal(t, openedSize(int64(len(sealed)), keyID), int64(len("An old silent pond")))
+
+	// Older keys still open content after a rotation
+	content, err := rotated.open(sealed, keyID)
+	assert.NilError(t, err)
+	assert.Equal(t, content, "An old silent pond")
+
+	// Plaintext passes through, with or without keys
+	content, err = rotated.open("A frog jumps in", nil)
+	assert.NilError(t, err)
+	assert.Equal(t, content, "A frog jumps in")
+
+	var none *ContentKeys
+	content, keyID, err = none.seal("A frog jumps in")
+	assert.NilError(t, err)
+	assert.Equal(t, content, "A frog jumps in")
+	assert.Equal(t, keyID, (*string)(nil))
+
+	_, err = none.open(sealed, &old.current)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+	_, err = testContentKeys(t, "new").open(sealed, &old.current)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	// Tampering is detected
+	_, err = old.open("A"+sealed[1:], &old.current)
+	assert.NotNil(t, err)
+}
+
+func TestSnippetModelReseal(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "snippets")
+
+	// Turning encryption on seals existing plaintext
+	m := SnippetModel{DB: db, Keys: testContentKeys(t, "old")}
+	n, err := m.Reseal(10)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 3)
+
+	var stored string
+	err = db.QueryRow(context.Background(), "SELECT content FROM snippets WHERE id = 1").Scan(&stored)
+	assert.NilError(t, err)
+	assert.Equal(t, stored == "An old silent pond...\nA frog jumps into the pond,\nsplash! Silence again.", false)
+
+	id, err := m.Insert(0, netip.MustParseAddr("203.0.113.7"), "Sealed", "Sealed content", 7, false, SnippetLimits{})
+	assert.NilError(t, err)
+
+	// After a rotation everything moves to the new key and stays readable
+	m.Keys = testContentKeys(t, "new", "old")
+	n, err = m.Reseal(10)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 4)
+	n, err = m.Reseal(10)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 0)
+
+	m.Keys = testContentKeys(t, "new")
+	s, err := m.Get(t.Context(), id)
+	assert.NilError(t, err)
+	assert.Equal(t, s.Content, "Sealed content")
+
+	h, err := m.GetHeader(t.Context(), id)
+	assert.NilError(t, err)
+	assert.Equal(t, h.Size, int64(len("Sealed content")))
+
+	var buf bytes.Buffer
+	_, err = m.CopyContent(t.Context(), &buf, id)
+	assert.NilError(t, err)
+	assert.Equal(t, buf.String(), "Sealed content")
+
+	snippets, err := m.Latest(t.Context())
+	assert.NilError(t, err)
+	assert.Equal(t, snippets[0].Excerpt, "Sealed content")
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =============================================================================
+// Site Statistics - Type Definitions
+// =============================================================================
+
+// SiteStats are the instance-wide totals shown on the public statistics
+// page
+type SiteStats struct {
+	Snippets int              // Unexpired snippets, private ones included
+	Users    int              // Active accounts
+	Activity []*DailyActivity // One entry per day, oldest first
+}
+
+// DailyActivity is what happened on one day
+type DailyActivity struct {
+	Day      time.Time
+	Snippets int // Snippets created
+	Views    int // Snippet views
+}
+
+// SiteStatsModelInterface defines the interface for site statistics
+type SiteStatsModelInterface interface {
+	Get(days int) (*SiteStats, error)
+}
+
+// SiteStatsModel wraps a database connection pool
+type SiteStatsModel struct {
+	DB *pgxpool.Pool
+}
+
+// =============================================================================
+// Site Statistics - Methods
+// =============================================================================
+
+// Get returns the totals and the activity of each of the last days days,
+// today included. Days without activity are included with zero counts.
+func (m *SiteStatsModel) Get(days int) (*SiteStats, error) {
+	totals := `SELECT (SELECT count(*) FROM snippets WHERE expires > CURRENT_TIMESTAMP AND NOT held),
+                      (SELECT count(*) FROM users WHERE active AND NOT banned)`
+
+	activity := `SELECT d.day,
+                        (SELECT count(*) FROM snippets s WHERE s.created >= d.day AND s.created < d.day + 1),
+                        COALESCE((SELECT SUM(v.views) FROM snippet_views v WHERE v.day = d.day), 0)
+                 FROM (SELECT CURRENT_DATE - n AS day FROM generate_series(0, $1::int - 1) n) d
+                 ORDER BY d.day`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stats := &SiteStats{}
+	err := m.DB.QueryRow(ctx, totals).Scan(&stats.Snippets, &stats.Users)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := m.DB.Query(ctx, activity, days)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats.Activity = []*DailyActivity{}
+	for rows.Next() {
+		a := &DailyActivity{}
+		if err = rows.Scan(&a.Day, &a.Snippets, &a.Views); err != nil {
+			return nil, err
+		}
+		stats.Activity = append(stats.Activity, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestSiteStatsModelGet(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users", "snippets")
+	snippets := SnippetModel{DB: db}
+	m := SiteStatsModel{DB: db}
+
+	assert.NilError(t, snippets.RecordView(1))
+	assert.NilError(t, snippets.RecordView(2))
+
+	stats, err := m.Get(3)
+	assert.NilError(t, err)
+
+	// The expired fixture isn't counted
+	assert.Equal(t, stats.Snippets, 2)
+	assert.Equal(t, stats.Users, 2)
+
+	// Fixture snippets were created one and two days ago
+	assert.Equal(t, len(stats.Activity), 3)
+	assert.Equal(t, stats.Activity[0].Snippets, 1)
+	assert.Equal(t, stats.Activity[1].Snippets, 1)
+	assert.Equal(t, stats.Activity[2].Snippets, 0)
+	assert.Equal(t, stats.Activity[2].Views, 2)
+}
@@ -3,8 +3,14 @@ package models
 import (
 	"context"
 	"errors"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
 	"time"
 
+	"adotkaya.playground/internal/langdetect"
+	"adotkaya.playground/internal/query"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -15,23 +21,51 @@ import (
 
 // Snippet represents a code snippet with metadata
 type Snippet struct {
-	ID      int
-	Title   string
-	Content string
-	Created time.Time
-	Expires time.Time
+	ID        int
+	Title     string
+	Content   string
+	Created   time.Time
+	Expires   time.Time
+	UserID    int      // Owner, zero for anonymous snippets. Only loaded by Get.
+	Tags      []string // Sorted tags. Only loaded by Get.
+	Private   bool     // Only the owner, or a share link, can see it. Only loaded by Get.
+	Shares    int      // Share link generation; bumping it revokes links. Only loaded by Get.
+	Encrypted bool     // Content is ciphertext from the browser and Title is empty. Only loaded by Get.
+	Language  string   // Language guessed from the content, empty if unclear. Only loaded by Get.
+	Source    string   // URL of the page the snippet was imported from, if any. Only loaded by Get.
 }
 
 // SnippetModelInterface defines the interface for snippet operations
 type SnippetModelInterface interface {
-	Insert(title string, content string, expires int) (int, error)
-	Get(id int) (*Snippet, error)
-	Latest() ([]*Snippet, error)
+	Insert(userID int, creatorIP netip.Addr, title string, content string, expires int, private bool, limits SnippetLimits) (int, error)
+	InsertEncrypted(userID int, creatorIP netip.Addr, ciphertext string, expires int, limits SnippetLimits) (int, error)
+	Get(ctx context.Context, id int) (*Snippet, error)
+	Update(id int, title string, content string, private bool, limits SnippetLimits) error
+	Delete(id int) error
+	SetTags(id int, tags []string) error
+	SetSource(id int, source string) error
+	RevokeShares(id int) error
+	GetHeader(ctx context.Context, id int) (*SnippetHeader, error)
+	CopyContent(ctx context.Context, w io.Writer, id int) (int64, error)
+	Latest(ctx context.Context) ([]*SnippetSummary, error)
+	All(ctx context.Context, page, pageSize int) ([]*SnippetSummary, int, error)
+	Search(ctx context.Context, q query.Query, limit, offset int) ([]*SnippetSummary, int, error)
+	RecordView(id int) error
+	Popular(days, limit int) ([]*PopularSnippet, error)
+	RefreshTrending() (int, error)
+	Trending(ctx context.Context, limit int) ([]*SnippetSummary, error)
+	ByLanguage(ctx context.Context, language string, limit, offset int) ([]*SnippetSummary, int, error)
+	ByTag(ctx context.Context, tag string, limit, offset int) ([]*SnippetSummary, int, error)
+	LanguageCounts() ([]*GroupCount, error)
+	TagCounts(limit int) ([]*GroupCount, error)
 }
 
 // SnippetModel wraps a database connection pool
 type SnippetModel struct {
 	DB *pgxpool.Pool
+
+	// Keys encrypts content at rest; nil stores it as plaintext
+	Keys *ContentKeys
 }
 
 // =============================================================================
@@ -41,21 +75,67 @@ type SnippetModel struct {
 // Insert creates a new snippet in the database
 //
 // Parameters:
+//   - userID: The user creating the snippet, or zero for anonymous snippets
+//   - creatorIP: The anonymous creator's address, used for their quota
 //   - title: The snippet title (max 100 characters)
 //   - content: The snippet code content
 //   - expires: Number of days until expiration (1, 7, or 365)
+//   - private: Whether to keep the snippet out of public listings. Only
+//     snippets with an owner can be private.
+//   - limits: The user's snippet limits
 //
-// Returns the ID of the newly created snippet, or an error
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
-	stmt := `INSERT INTO snippets (title, content, created, expires)
-             VALUES ($1, $2, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP + make_interval(days => $3))
+// The language is guessed from the content. Returns the ID of the newly
+// created snippet, a *QuotaError if the creator is at one of their limits,
+// or another error. A notification carrying the new
+// ID is sent on the snippets_changed channel when the insert commits, so
+// caches on every instance can be invalidated.
+func (m *SnippetModel) Insert(userID int, creatorIP netip.Addr, title string, content string, expires int, private bool, limits SnippetLimits) (int, error) {
+	return m.insert(userID, creatorIP, title, content, expires, private && userID != 0, false, limits)
+}
+
+// InsertEncrypted creates a snippet encrypted in the browser. The title is
+// part of the ciphertext, so the stored title is empty. Encrypted snippets
+// are left out of listings and search, and can't be edited. Returns the same
+// errors as Insert.
+func (m *SnippetModel) InsertEncrypted(userID int, creatorIP netip.Addr, ciphertext string, expires int, limits SnippetLimits) (int, error) {
+	return m.insert(userID, creatorIP, "", ciphertext, expires, false, true, limits)
+}
+
+// insert checks the creator's quota and inserts a snippet
+func (m *SnippetModel) insert(userID int, creatorIP netip.Addr, title, content string, expires int, private, encrypted bool, limits SnippetLimits) (int, error) {
+	stmt := `INSERT INTO snippets (user_id, creator_ip, title, content, content_key, created, expires, private, encrypted, language)
+             VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP + make_interval(days => $6), $7, $8, $9)
              RETURNING id`
 
+	// Ciphertext gives nothing away
+	language := ""
+	if !encrypted {
+		language = langdetect.Detect(content)
+	}
+
+	content, keyID, err := m.Keys.seal(content)
+	if err != nil {
+		return 0, err
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	owner, ip := creator(userID, creatorIP)
 	var id int
-	err := m.DB.QueryRow(ctx, stmt, title, content, expires).Scan(&id)
+	err = runInTx(ctx, m.DB, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if err := checkQuota(ctx, tx, owner, ip, private, limits); err != nil {
+			return err
+		}
+
+		err := tx.QueryRow(ctx, stmt, owner, ip, title, content, keyID, expires, private, encrypted, language).Scan(&id)
+		if err != nil {
+			return err
+		}
+
+		// NOTIFY inside the transaction is only delivered on commit
+		return notifySnippetChanged(ctx, tx, id)
+	})
 	if err != nil {
 		return 0, err
 	}
@@ -65,40 +145,152 @@ func (m *SnippetModel) Insert(title string, content string, expires int) (int, e
 
 // Get retrieves a specific snippet by ID
 //
-// Only returns snippets that have not expired. Returns ErrNoRecord if the
-// snippet doesn't exist or has expired.
-func (m *SnippetModel) Get(id int) (*Snippet, error) {
-	stmt := `SELECT id, title, content, created, expires
+// Only returns snippets that have not expired and aren't held for
+// moderation. Returns ErrNoRecord otherwise. Private snippets are returned
+// too; callers check who may see them.
+func (m *SnippetModel) Get(ctx context.Context, id int) (*Snippet, error) {
+	stmt := `SELECT id, title, content, created, expires, COALESCE(user_id, 0),
+                    ARRAY(SELECT tag FROM snippet_tags WHERE snippet_id = snippets.id ORDER BY tag),
+                    private, share_version, encrypted, content_key, language, source
              FROM snippets
-             WHERE expires > CURRENT_TIMESTAMP AND id = $1`
+             WHERE expires > CURRENT_TIMESTAMP AND NOT held AND id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	s := &Snippet{}
-	err := m.DB.QueryRow(ctx, stmt, id).Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+	var keyID *string
+	err := m.DB.QueryRow(ctx, stmt, id).Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.UserID, &s.Tags, &s.Private, &s.Shares, &s.Encrypted, &keyID, &s.Language, &s.Source)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, ErrNoRecord
+			return nil, notFound("snippet", id)
 		}
 		return nil, err
 	}
+	if err = m.Keys.openInto(s, keyID); err != nil {
+		return nil, err
+	}
 
 	return s, nil
 }
 
-// Latest retrieves the 10 most recently created snippets
+// Update changes a snippet's title, content and privacy, guessing the
+// language again. Anonymous snippets stay public. Returns ErrNoRecord if the snippet doesn't exist,
+// has expired or is encrypted, or a *QuotaError if making it private would
+// take its owner over limits.Private; other limits don't apply to edits.
+func (m *SnippetModel) Update(id int, title string, content string, private bool, limits SnippetLimits) error {
+	stmt := `UPDATE snippets SET title = $2, content = $3, content_key = $5, private = $4 AND user_id IS NOT NULL, language = $6
+             WHERE expires > CURRENT_TIMESTAMP AND NOT encrypted AND id = $1`
+
+	language := langdetect.Detect(content)
+	content, keyID, err := m.Keys.seal(content)
+	if err != nil {
+		return err
+	}
+
+	var check func(ctx context.Context, tx pgx.Tx) error
+	if private {
+		check = func(ctx context.Context, tx pgx.Tx) error {
+			return checkPrivateQuota(ctx, tx, id, limits)
+		}
+	}
+	return m.changeChecked(id, check, stmt, title, content, private, keyID, language)
+}
+
+// Delete removes a snippet. Returns ErrNoRecord if the snippet doesn't
+// exist.
+func (m *SnippetModel) Delete(id int) error {
+	return m.change(id, "DELETE FROM snippets WHERE id = $1")
+}
+
+// SetSource records the URL of the page a snippet was imported from.
+// Returns ErrNoRecord if the snippet doesn't exist.
+func (m *SnippetModel) SetSource(id int, source string) error {
+	return m.change(id, "UPDATE snippets SET source = $2 WHERE id = $1", source)
+}
+
+// SetTags replaces a snippet's tags. Tags are stored as given, so callers
+// should normalise them first.
+func (m *SnippetModel) SetTags(id int, tags []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "DELETE FROM snippet_tags WHERE snippet_id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	stmt := `INSERT INTO snippet_tags (snippet_id, tag)
+             SELECT $1, tag FROM unnest($2::text[]) AS tag
+             ON CONFLICT DO NOTHING`
+	_, err = tx.Exec(ctx, stmt, id, tags)
+	if err != nil {
+		return err
+	}
+
+	if err = notifySnippetChanged(ctx, tx, id); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// RevokeShares invalidates every share link issued for a snippet so far.
+// Returns ErrNoRecord if the snippet doesn't exist.
+func (m *SnippetModel) RevokeShares(id int) error {
+	return m.change(id, "UPDATE snippets SET share_version = share_version + 1 WHERE id = $1")
+}
+
+// change runs stmt, which must take the snippet ID as $1, and announces the
+// change on the snippets_changed channel
+func (m *SnippetModel) change(id int, stmt string, args ...any) error {
+	return m.changeChecked(id, nil, stmt, args...)
+}
+
+// changeChecked is change, running check first in the same transaction if
+// it isn't nil. The transaction is retried if it clashes with another, so
+// check may run more than once.
+func (m *SnippetModel) changeChecked(id int, check func(ctx context.Context, tx pgx.Tx) error, stmt string, args ...any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return runInTx(ctx, m.DB, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if check != nil {
+			if err := check(ctx, tx); err != nil {
+				return err
+			}
+		}
+
+		tag, err := tx.Exec(ctx, stmt, append([]any{id}, args...)...)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return notFound("snippet", id)
+		}
+
+		return notifySnippetChanged(ctx, tx, id)
+	})
+}
+
+// Latest retrieves summaries of the 10 most recently created snippets
 //
-// Only returns snippets that have not expired, ordered by creation date
-// (most recent first).
-func (m *SnippetModel) Latest() ([]*Snippet, error) {
-	stmt := `SELECT id, title, content, created, expires
-             FROM snippets
-             WHERE expires > CURRENT_TIMESTAMP
+// Only returns public snippets that have not expired or been held, ordered
+// by creation date (most recent first).
+func (m *SnippetModel) Latest(ctx context.Context) ([]*SnippetSummary, error) {
+	stmt := `SELECT ` + summaryColumns + `
+             FROM snippets s
+             WHERE expires > CURRENT_TIMESTAMP AND NOT held AND NOT private AND NOT encrypted
              ORDER BY id DESC
              LIMIT 10`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	rows, err := m.DB.Query(ctx, stmt)
@@ -107,11 +299,10 @@ func (m *SnippetModel) Latest() ([]*Snippet, error) {
 	}
 	defer rows.Close()
 
-	// Iterate through the result set and build a slice of snippets
-	snippets := []*Snippet{}
+	// Iterate through the result set and build a slice of summaries
+	snippets := []*SnippetSummary{}
 	for rows.Next() {
-		s := &Snippet{}
-		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		s, err := scanSummary(rows, m.Keys)
 		if err != nil {
 			return nil, err
 		}
@@ -125,3 +316,118 @@ func (m *SnippetModel) Latest() ([]*Snippet, error) {
 
 	return snippets, nil
 }
+
+// All retrieves a page of summaries of unexpired public snippets, most
+// recent first, numbering pages from 1. Returns the page of summaries and
+// the total number of snippets, to work out how many pages there are.
+func (m *SnippetModel) All(ctx context.Context, page, pageSize int) ([]*SnippetSummary, int, error) {
+	where := "WHERE expires > CURRENT_TIMESTAMP AND NOT held AND NOT private AND NOT encrypted"
+	return m.listPage(ctx, "", where, nil, pageSize, (page-1)*pageSize)
+}
+
+// Search retrieves one page of summaries of unexpired public snippets
+// matching a search query, most recent first. The query's words must all be
+// in the title or content, using the full-text search index; content
+// encrypted at rest isn't indexed, so only its title is matched. Snippets
+// the index hasn't been rebuilt to include yet are matched on the words as
+// a whole (case-insensitive) instead. The query's filters must all match.
+//
+// Returns the page of summaries, each with a Headline showing the words in
+// context if there are any, and the total number of matches.
+func (m *SnippetModel) Search(ctx context.Context, q query.Query, limit, offset int) ([]*SnippetSummary, int, error) {
+	var args []any
+	param := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	conds := append([]string{"expires > CURRENT_TIMESTAMP AND NOT held AND NOT private AND NOT encrypted"},
+		searchConditions(q, param)...)
+	headline := ""
+	if q.Text != "" {
+		headline = headlineColumn(param(q.Text))
+	}
+
+	return m.listPage(ctx, headline, "WHERE "+strings.Join(conds, " AND "), args, limit, offset)
+}
+
+// searchConditions returns the SQL conditions on snippets matching a search
+// query, adding their arguments with param, which returns each one's
+// placeholder
+func searchConditions(q query.Query, param func(any) string) []string {
+	var conds []string
+	if q.Text != "" {
+		p := param(q.Text)
+		conds = append(conds, `(search_vector @@ plainto_tsquery('simple', `+p+`)
+                 OR (search_vector IS NULL AND strpos(lower(title || ' ' || content), lower(`+p+`)) > 0))`)
+	}
+	for _, title := range q.Title {
+		conds = append(conds, "strpos(lower(title), lower("+param(title)+")) > 0")
+	}
+	if q.Language != "" {
+		conds = append(conds, "language = "+param(q.Language))
+	}
+	for _, tag := range q.Tags {
+		conds = append(conds, "id IN (SELECT snippet_id FROM snippet_tags WHERE tag = "+param(tag)+")")
+	}
+	if !q.After.IsZero() {
+		conds = append(conds, "created >= "+param(q.After))
+	}
+	if !q.Before.IsZero() {
+		conds = append(conds, "created < "+param(q.Before))
+	}
+	return conds
+}
+
+// listPage returns one page of summaries of the snippets matching where,
+// most recent first, and the total number of matches. The where clause
+// takes args as $1 onwards. The Headline of each is selected with headline,
+// if it isn't empty.
+func (m *SnippetModel) listPage(ctx context.Context, headline, where string, args []any, limit, offset int) ([]*SnippetSummary, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var total int
+	err := m.DB.QueryRow(ctx, "SELECT count(*) FROM snippets "+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if headline == "" {
+		headline = "''"
+	}
+	stmt := `SELECT ` + summaryColumns + `, ` + headline + `
+             FROM snippets s ` + where + `
+             ORDER BY id DESC
+             LIMIT $` + strconv.Itoa(len(args)+1) + ` OFFSET $` + strconv.Itoa(len(args)+2)
+
+	rows, err := m.DB.Query(ctx, stmt, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	snippets := []*SnippetSummary{}
+	for rows.Next() {
+		var headline string
+		s, err := scanSummary(rows, m.Keys, &headline)
+		if err != nil {
+			return nil, 0, err
+		}
+		s.Headline = headline
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return snippets, total, nil
+}
+
+// escapeLike escapes the LIKE wildcards in s so it is matched literally
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
@@ -0,0 +1,286 @@
+package models
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/query"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestSnippetModelGet(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      int
+		title   string
+		wantErr error
+	}{
+		{
+			name:  "Valid ID",
+			id:    1,
+			title: "An old silent pond",
+		},
+		{
+			name:    "Expired",
+			id:      3,
+			wantErr: ErrNoRecord,
+		},
+		{
+			name:    "Non-existent ID",
+			id:      99,
+			wantErr: ErrNoRecord,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			db := newTestDB(t)
+			testutil.LoadFixtures(t, db, "snippets")
+			m := SnippetModel{DB: db}
+
+			s, err := m.Get(t.Context(), tt.id)
+			assert.ErrorIs(t, err, tt.wantErr)
+			if tt.wantErr == nil && s != nil {
+				assert.Equal(t, s.Title, tt.title)
+			}
+		})
+	}
+}
+
+func TestSnippetModelLatest(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "snippets")
+	m := SnippetModel{DB: db}
+
+	snippets, err := m.Latest(t.Context())
+	assert.NilError(t, err)
+
+	// The expired fixture is left out, newest ID first
+	assert.Equal(t, len(snippets), 2)
+	assert.Equal(t, snippets[0].ID, 2)
+	assert.Equal(t, snippets[1].ID, 1)
+}
+
+func TestSnippetModelAll(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "snippets")
+	m := SnippetModel{DB: db}
+
+	// The expired fixture isn't counted
+	snippets, total, err := m.All(t.Context(), 1, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, total, 2)
+	assert.Equal(t, len(snippets), 1)
+	assert.Equal(t, snippets[0].ID, 2)
+
+	snippets, _, err = m.All(t.Context(), 2, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(snippets), 1)
+	assert.Equal(t, snippets[0].ID, 1)
+
+	snippets, total, err = m.All(t.Context(), 3, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, total, 2)
+	assert.Equal(t, len(snippets), 0)
+}
+
+func BenchmarkSnippetModelLatest(b *testing.B) {
+	db := newTestDB(b)
+	testutil.LoadFixtures(b, db, "snippets")
+	m := SnippetModel{DB: db}
+
+	for b.Loop() {
+		if _, err := m.Latest(b.Context()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestSnippetModelLanguage(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users", "snippets")
+	m := SnippetModel{DB: db}
+
+	// The language is guessed on insert and again on edit
+	id, err := m.Insert(1, netip.Addr{}, "Hello", "package main\n\nfunc main() {\n\tmsg := \"hi\"\n}\n", 7, false, SnippetLimits{})
+	assert.NilError(t, err)
+	s, err := m.Get(t.Context(), id)
+	assert.NilError(t, err)
+	assert.Equal(t, s.Language, "go")
+
+	assert.NilError(t, m.Update(id, "Hello", "A frog jumps in", false, SnippetLimits{}))
+	s, err = m.Get(t.Context(), id)
+	assert.NilError(t, err)
+	assert.Equal(t, s.Language, "")
+}
+
+func TestSnippetModelSource(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "snippets")
+	m := SnippetModel{DB: db}
+
+	s, err := m.Get(t.Context(), 1)
+	assert.NilError(t, err)
+	assert.Equal(t, s.Source, "")
+
+	assert.NilError(t, m.SetSource(1, "https://pastebin.com/AbCd1234"))
+	s, err = m.Get(t.Context(), 1)
+	assert.NilError(t, err)
+	assert.Equal(t, s.Source, "https://pastebin.com/AbCd1234")
+
+	assert.ErrorIs(t, m.SetSource(99, "https://pastebin.com/AbCd1234"), ErrNoRecord)
+}
+
+func TestSnippetModelUpdateDelete(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "snippets")
+	m := SnippetModel{DB: db}
+
+	assert.NilError(t, m.Update(1, "A new pond", "A frog jumps in", false, SnippetLimits{}))
+	s, err := m.Get(t.Context(), 1)
+	assert.NilError(t, err)
+	assert.Equal(t, s.Title, "A new pond")
+	assert.Equal(t, s.UserID, 0)
+
+	// Expired snippets can't be edited
+	assert.ErrorIs(t, m.Update(3, "Too late", "...", false, SnippetLimits{}), ErrNoRecord)
+
+	assert.NilError(t, m.Delete(1))
+	_, err = m.Get(t.Context(), 1)
+	assert.ErrorIs(t, err, ErrNoRecord)
+	assert.ErrorIs(t, m.Delete(1), ErrNoRecord)
+}
+
+func TestSnippetModelPrivate(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users", "snippets")
+	m := SnippetModel{DB: db}
+
+	// Snippets without an owner can't be made private
+	assert.NilError(t, m.Update(2, "Over the wintry forest", "...", true, SnippetLimits{}))
+	s, err := m.Get(t.Context(), 2)
+	assert.NilError(t, err)
+	assert.Equal(t, s.Private, false)
+
+	_, err = db.Exec(context.Background(), "UPDATE snippets SET user_id = 1 WHERE id = 2")
+	assert.NilError(t, err)
+	assert.NilError(t, m.Update(2, "Over the wintry forest", "...", true, SnippetLimits{}))
+	s, err = m.Get(t.Context(), 2)
+	assert.NilError(t, err)
+	assert.Equal(t, s.Private, true)
+	assert.Equal(t, s.Shares, 0)
+
+	// Private snippets are left out of listings
+	snippets, err := m.Latest(t.Context())
+	assert.NilError(t, err)
+	assert.Equal(t, len(snippets), 1)
+	assert.Equal(t, snippets[0].ID, 1)
+
+	assert.NilError(t, m.RevokeShares(2))
+	s, err = m.Get(t.Context(), 2)
+	assert.NilError(t, err)
+	assert.Equal(t, s.Shares, 1)
+	assert.ErrorIs(t, m.RevokeShares(99), ErrNoRecord)
+}
+
+func TestSnippetModelEncrypted(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users", "snippets")
+	m := SnippetModel{DB: db}
+
+	id, err := m.InsertEncrypted(1, netip.Addr{}, "c2VhbGVk", 7, SnippetLimits{})
+	assert.NilError(t, err)
+
+	s, err := m.Get(t.Context(), id)
+	assert.NilError(t, err)
+	assert.Equal(t, s.Encrypted, true)
+	assert.Equal(t, s.Title, "")
+	assert.Equal(t, s.Content, "c2VhbGVk")
+
+	// Encrypted snippets are left out of listings and can't be edited
+	snippets, err := m.Latest(t.Context())
+	assert.NilError(t, err)
+	assert.Equal(t, len(snippets), 2)
+	assert.ErrorIs(t, m.Update(id, "Plain", "text", false, SnippetLimits{}), ErrNoRecord)
+}
+
+func TestSnippetModelSetTags(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "snippets")
+	m := SnippetModel{DB: db}
+
+	s, err := m.Get(t.Context(), 1)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, s.Tags, []string{})
+
+	assert.NilError(t, m.SetTags(1, []string{"haiku", "frogs"}))
+	s, err = m.Get(t.Context(), 1)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, s.Tags, []string{"frogs", "haiku"})
+
+	// Tags are replaced, not added to
+	assert.NilError(t, m.SetTags(1, []string{"haiku"}))
+	s, err = m.Get(t.Context(), 1)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, s.Tags, []string{"haiku"})
+}
+
+func TestSnippetModelSearchFilters(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users")
+	m := SnippetModel{DB: db}
+
+	server, err := m.Insert(1, netip.Addr{}, "HTTP server", "package main\n\nfunc main() {\n\tmsg := \"serve\"\n}\n", 7, false, SnippetLimits{})
+	assert.NilError(t, err)
+	assert.NilError(t, m.SetTags(server, []string{"networking"}))
+	client, err := m.Insert(1, netip.Addr{}, "HTTP client", "import os\n\nclass Client:\n    def __init__(self, url):\n        self.url = url\n", 7, false, SnippetLimits{})
+	assert.NilError(t, err)
+
+	tests := []struct {
+		name  string
+		query string
+		want  []int
+	}{
+		{"Title", "title:http", []int{client, server}},
+		{"Language", "title:http lang:go", []int{server}},
+		{"Tag", "tag:networking", []int{server}},
+		{"Words and filters", "serve title:http", []int{server}},
+		{"Created before", "title:http created:<2000-01-01", []int{}},
+		{"Created after", "title:http created:>=2000-01-01", []int{client, server}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := query.Parse(tt.query)
+			assert.NilError(t, err)
+
+			snippets, total, err := m.Search(t.Context(), q, 10, 0)
+			assert.NilError(t, err)
+			assert.Equal(t, total, len(tt.want))
+			ids := []int{}
+			for _, s := range snippets {
+				ids = append(ids, s.ID)
+			}
+			assert.DeepEqual(t, ids, tt.want)
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// =============================================================================
+// Snippet Statistics
+// =============================================================================
+
+// PopularSnippet is a snippet with its view count over some period
+type PopularSnippet struct {
+	*Snippet
+	Views int
+}
+
+// RecordView counts one view of a snippet towards today's total. Views of
+// snippets that don't exist or have expired are ignored.
+func (m *SnippetModel) RecordView(id int) error {
+	stmt := `INSERT INTO snippet_views (snippet_id, day, views)
+             SELECT id, CURRENT_DATE, 1 FROM snippets
+             WHERE id = $1 AND expires > CURRENT_TIMESTAMP AND NOT held
+             ON CONFLICT (snippet_id, day) DO UPDATE SET views = snippet_views.views + 1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, stmt, id)
+	return err
+}
+
+// Popular returns the unexpired public snippets with the most views over the
+// last days days (including today), most viewed first
+func (m *SnippetModel) Popular(days, limit int) ([]*PopularSnippet, error) {
+	stmt := `SELECT s.id, s.title, s.content, s.created, s.expires, s.content_key, SUM(v.views) AS total
+             FROM snippet_views v
+             JOIN snippets s ON s.id = v.snippet_id
+             WHERE v.day > CURRENT_DATE - $1::int AND s.expires > CURRENT_TIMESTAMP AND NOT s.held AND NOT s.private AND NOT s.encrypted
+             GROUP BY s.id
+             ORDER BY total DESC, s.id DESC
+             LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, stmt, days, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	popular := []*PopularSnippet{}
+	for rows.Next() {
+		p := &PopularSnippet{Snippet: &Snippet{}}
+		var keyID *string
+		err = rows.Scan(&p.ID, &p.Title, &p.Content, &p.Created, &p.Expires, &keyID, &p.Views)
+		if err != nil {
+			return nil, err
+		}
+		if err = m.Keys.openInto(p.Snippet, keyID); err != nil {
+			return nil, err
+		}
+		popular = append(popular, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return popular, nil
+}
+
+// Trending scores favour snippets viewed a lot lately over ones viewed a
+// lot in the past, and new snippets over old ones. Stars aren't tracked,
+// so views are the only signal of interest.
+const (
+	// trendingDays is how many days of views count towards the score
+	trendingDays = 7
+
+	// trendingGravity is how quickly a snippet's age pulls its score down.
+	// Views are divided by (hours since creation + 2) ^ gravity.
+	trendingGravity = 1.5
+)
+
+// RefreshTrending recomputes the trending scores of the unexpired public
+// snippets viewed in the last trendingDays days. Each day's views count half
+// as much as the next day's, and the total is divided by a power of the
+// snippet's age. Returns the number of snippets scored.
+func (m *SnippetModel) RefreshTrending() (int, error) {
+	stmt := `INSERT INTO trending_snippets (snippet_id, score, computed)
+             SELECT s.id,
+                    SUM(v.views * power(0.5, CURRENT_DATE - v.day))
+                        / power(EXTRACT(EPOCH FROM CURRENT_TIMESTAMP - s.created) / 3600 + 2, $2::float8),
+                    CURRENT_TIMESTAMP
+             FROM snippet_views v
+             JOIN snippets s ON s.id = v.snippet_id
+             WHERE v.day > CURRENT_DATE - $1::int AND s.expires > CURRENT_TIMESTAMP AND NOT s.held AND NOT s.private AND NOT s.encrypted
+             GROUP BY s.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Readers see the old scores until the new ones commit
+	if _, err = tx.Exec(ctx, "DELETE FROM trending_snippets"); err != nil {
+		return 0, err
+	}
+	tag, err := tx.Exec(ctx, stmt, trendingDays, trendingGravity)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+// Trending returns summaries of the unexpired public snippets with the
+// highest scores from the last RefreshTrending, highest first
+func (m *SnippetModel) Trending(ctx context.Context, limit int) ([]*SnippetSummary, error) {
+	stmt := `SELECT ` + summaryColumns + `
+             FROM trending_snippets t
+             JOIN snippets s ON s.id = t.snippet_id
+             WHERE s.expires > CURRENT_TIMESTAMP AND NOT s.held AND NOT s.private AND NOT s.encrypted
+             ORDER BY t.score DESC, s.id DESC
+             LIMIT $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, stmt, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snippets := []*SnippetSummary{}
+	for rows.Next() {
+		s, err := scanSummary(rows, m.Keys)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
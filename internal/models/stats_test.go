@@ -0,0 +1,67 @@
+package models
+
+import (
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestSnippetModelPopular(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "snippets")
+	m := SnippetModel{DB: db}
+
+	for _, id := range []int{1, 2, 2, 3, 3, 3} {
+		assert.NilError(t, m.RecordView(id))
+	}
+
+	popular, err := m.Popular(7, 10)
+	assert.NilError(t, err)
+
+	// The expired snippet is left out however often it was viewed
+	assert.Equal(t, len(popular), 2)
+	assert.Equal(t, popular[0].ID, 2)
+	assert.Equal(t, popular[0].Views, 2)
+	assert.Equal(t, popular[1].ID, 1)
+	assert.Equal(t, popular[1].Views, 1)
+
+	popular, err = m.Popular(7, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(popular), 1)
+}
+
+func TestSnippetModelTrending(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "snippets")
+	m := SnippetModel{DB: db}
+
+	// Nothing trends until the scores are computed
+	trending, err := m.Trending(t.Context(), 10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(trending), 0)
+
+	for _, id := range []int{1, 2, 2, 3, 3, 3} {
+		assert.NilError(t, m.RecordView(id))
+	}
+	n, err := m.RefreshTrending()
+	assert.NilError(t, err)
+	assert.Equal(t, n, 2)
+
+	// The newer, more viewed snippet scores higher. The expired snippet is
+	// left out.
+	trending, err = m.Trending(t.Context(), 10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(trending), 2)
+	assert.Equal(t, trending[0].ID, 2)
+	assert.Equal(t, trending[1].ID, 1)
+
+	// Recomputing replaces the old scores
+	n, err = m.RefreshTrending()
+	assert.NilError(t, err)
+	assert.Equal(t, n, 2)
+}
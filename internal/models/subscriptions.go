@@ -0,0 +1,211 @@
+package models
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"adotkaya.playground/internal/query"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =============================================================================
+// Subscription Model - Type Definitions
+// =============================================================================
+
+// Kinds of subscription
+const (
+	SubscriptionSearch = "search" // Snippets matching a search query
+	SubscriptionTag    = "tag"    // Snippets with a tag
+)
+
+// Subscription is a user's saved search or tag subscription. Snippets
+// created after it was made are listed on the subscriptions page.
+type Subscription struct {
+	ID        int
+	UserID    int
+	Kind      string // SubscriptionSearch or SubscriptionTag
+	Query     string // Search query or tag
+	Email     bool   // Whether new matches are emailed
+	Created   time.Time
+	StartID   int // Newest snippet when the subscription was made
+	EmailedID int // Newest snippet already emailed about
+}
+
+// SubscriptionModelInterface defines the interface for subscription
+// operations
+type SubscriptionModelInterface interface {
+	Insert(userID int, kind, query string, email bool) (int, error)
+	List(userID int) ([]*Subscription, error)
+	Delete(userID, id int) error
+	Matches(sub *Subscription, afterID, limit int) ([]*Snippet, error)
+	Emailed() ([]*Subscription, error)
+	MarkEmailed(id, lastID int) error
+}
+
+// SubscriptionModel wraps a database connection pool
+type SubscriptionModel struct {
+	DB *pgxpool.Pool
+
+	// Keys encrypts content at rest; nil stores it as plaintext
+	Keys *ContentKeys
+}
+
+// =============================================================================
+// Subscription Model - Methods
+// =============================================================================
+
+// Insert subscribes a user to a search query or tag. Subscribing again
+// only updates whether matches are emailed. Returns the subscription ID.
+func (m *SubscriptionModel) Insert(userID int, kind, query string, email bool) (int, error) {
+	stmt := `INSERT INTO subscriptions (user_id, kind, query, email, created, start_id, emailed_id)
+             SELECT $1, $2, $3, $4, CURRENT_TIMESTAMP, last.id, last.id
+             FROM (SELECT COALESCE(MAX(id), 0) AS id FROM snippets) last
+             ON CONFLICT (user_id, kind, query) DO UPDATE SET email = EXCLUDED.email
+             RETURNING id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int
+	err := m.DB.QueryRow(ctx, stmt, userID, kind, query, email).Scan(&id)
+	return id, translateError(err)
+}
+
+// List returns a user's subscriptions, oldest first
+func (m *SubscriptionModel) List(userID int) ([]*Subscription, error) {
+	stmt := `SELECT id, user_id, kind, query, email, created, start_id, emailed_id
+             FROM subscriptions
+             WHERE user_id = $1
+             ORDER BY id`
+
+	return m.query(stmt, userID)
+}
+
+// Delete removes one of a user's subscriptions. Returns ErrNoRecord if the
+// user has no such subscription.
+func (m *SubscriptionModel) Delete(userID, id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tag, err := m.DB.Exec(ctx, "DELETE FROM subscriptions WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("subscription", id)
+	}
+	return nil
+}
+
+// Matches returns up to limit unexpired public snippets matching a
+// subscription with IDs above afterID, newest first. Search subscriptions
+// match like Search does; those saved before filters existed that no longer
+// parse are searched for as words.
+func (m *SubscriptionModel) Matches(sub *Subscription, afterID, limit int) ([]*Snippet, error) {
+	args := []any{afterID, limit}
+	param := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	var conds []string
+	if sub.Kind == SubscriptionTag {
+		conds = searchConditions(query.Query{Tags: []string{sub.Query}}, param)
+	} else {
+		q, err := query.Parse(sub.Query)
+		if err != nil {
+			q = query.Query{Text: sub.Query}
+		}
+		conds = searchConditions(q, param)
+	}
+	if len(conds) == 0 {
+		// Nothing to match on, which would match everything
+		return []*Snippet{}, nil
+	}
+
+	stmt := `SELECT id, title, content, created, expires, content_key
+             FROM snippets
+             WHERE expires > CURRENT_TIMESTAMP AND NOT held AND NOT private AND NOT encrypted AND id > $1
+               AND ` + strings.Join(conds, " AND ") + `
+             ORDER BY id DESC
+             LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snippets := []*Snippet{}
+	for rows.Next() {
+		s := &Snippet{}
+		var keyID *string
+		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &keyID)
+		if err != nil {
+			return nil, err
+		}
+		if err = m.Keys.openInto(s, keyID); err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// Emailed returns every subscription whose matches are emailed, grouped by
+// user
+func (m *SubscriptionModel) Emailed() ([]*Subscription, error) {
+	stmt := `SELECT id, user_id, kind, query, email, created, start_id, emailed_id
+             FROM subscriptions
+             WHERE email
+             ORDER BY user_id, id`
+
+	return m.query(stmt)
+}
+
+// MarkEmailed records that matches up to snippet lastID have been emailed
+func (m *SubscriptionModel) MarkEmailed(id, lastID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, "UPDATE subscriptions SET emailed_id = GREATEST(emailed_id, $2) WHERE id = $1", id, lastID)
+	return err
+}
+
+// query runs a SELECT of subscription rows
+func (m *SubscriptionModel) query(stmt string, args ...any) ([]*Subscription, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []*Subscription{}
+	for rows.Next() {
+		s := &Subscription{}
+		err = rows.Scan(&s.ID, &s.UserID, &s.Kind, &s.Query, &s.Email, &s.Created, &s.StartID, &s.EmailedID)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return subs, nil
+}
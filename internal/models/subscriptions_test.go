@@ -0,0 +1,69 @@
+package models
+
+import (
+	"net/netip"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestSubscriptionModel(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users", "snippets")
+	snippets := SnippetModel{DB: db}
+	m := SubscriptionModel{DB: db}
+
+	searchID, err := m.Insert(1, SubscriptionSearch, "pond", false)
+	assert.NilError(t, err)
+	tagID, err := m.Insert(1, SubscriptionTag, "haiku", true)
+	assert.NilError(t, err)
+
+	// Subscribing again only updates the email setting
+	id, err := m.Insert(1, SubscriptionSearch, "pond", true)
+	assert.NilError(t, err)
+	assert.Equal(t, id, searchID)
+
+	subs, err := m.List(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(subs), 2)
+	search, tag := subs[0], subs[1]
+	assert.Equal(t, search.Email, true)
+	assert.Equal(t, search.StartID, 3) // Newest fixture snippet
+
+	// Fixture snippets predate the subscriptions
+	matches, err := m.Matches(search, search.StartID, 10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(matches), 0)
+
+	pond, err := snippets.Insert(3, netip.Addr{}, "Another pond", "Still water", 7, false, SnippetLimits{})
+	assert.NilError(t, err)
+	tagged, err := snippets.Insert(3, netip.Addr{}, "Untitled", "Five, seven, five", 7, false, SnippetLimits{})
+	assert.NilError(t, err)
+	assert.NilError(t, snippets.SetTags(tagged, []string{"haiku"}))
+
+	matches, err = m.Matches(search, search.StartID, 10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(matches), 1)
+	assert.Equal(t, matches[0].ID, pond)
+
+	matches, err = m.Matches(tag, tag.StartID, 10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(matches), 1)
+	assert.Equal(t, matches[0].ID, tagged)
+
+	emailed, err := m.Emailed()
+	assert.NilError(t, err)
+	assert.Equal(t, len(emailed), 2)
+
+	assert.NilError(t, m.MarkEmailed(tagID, tagged))
+	subs, err = m.List(1)
+	assert.NilError(t, err)
+	assert.Equal(t, subs[1].EmailedID, tagged)
+
+	assert.NilError(t, m.Delete(1, searchID))
+	assert.ErrorIs(t, m.Delete(1, searchID), ErrNoRecord)
+	assert.ErrorIs(t, m.Delete(3, tagID), ErrNoRecord)
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// =============================================================================
+// Snippet Summaries - Type Definitions
+// =============================================================================
+// Listings show a few lines of each snippet, not the whole thing, so they
+// load summaries: the metadata and the start of the content, cut short by
+// the database. Content encrypted at rest can only be cut short once it is
+// decrypted, so its summaries still read it whole.
+
+const (
+	ExcerptLength = 200 // Most characters of content in an excerpt
+	ExcerptLines  = 3   // Most lines of content in an excerpt
+)
+
+// Search result headlines mark each word matching the query by putting it
+// between HighlightStart and HighlightEnd. Both are control characters,
+// removed from the content first, so they can't be confused with it.
+const (
+	HighlightStart = "\x02"
+	HighlightEnd   = "\x03"
+)
+
+// SnippetSummary is a snippet as listings show it
+type SnippetSummary struct {
+	ID       int
+	Title    string
+	Excerpt  string // Start of the content, ending in "…" if it was cut short
+	Created  time.Time
+	Expires  time.Time
+	Language string // Language guessed from the content, empty if unclear
+
+	// Headline is the parts of the content around the words searched for,
+	// with the matches marked by HighlightStart and HighlightEnd. Only set
+	// by Search, and never for content encrypted at rest.
+	Headline string
+}
+
+// summaryColumns selects what scanSummary scans from snippets aliased as s.
+// One more character than ExcerptLength is read, to tell whether the
+// content was cut short.
+const summaryColumns = `s.id, s.title,
+                        CASE WHEN s.content_key IS NULL THEN left(s.content, 201) ELSE s.content END,
+                        s.created, s.expires, s.language, s.content_key`
+
+// headlineColumn returns the SQL selecting a search result's Headline from
+// snippets aliased as s, for the words in the query parameter param.
+// Content is cut to the length the search index covers, and any highlight
+// markers in it are dropped.
+func headlineColumn(param string) string {
+	return `CASE WHEN s.content_key IS NULL THEN
+                ts_headline('simple', translate(left(s.content, 262144), chr(2) || chr(3), ''),
+                            plainto_tsquery('simple', ` + param + `),
+                            'StartSel=' || chr(2) || ', StopSel=' || chr(3) ||
+                            ', MaxFragments=2, MaxWords=20, MinWords=8, FragmentDelimiter=" … "')
+            ELSE '' END`
+}
+
+// =============================================================================
+// Snippet Summaries - Helpers
+// =============================================================================
+
+// scanSummary scans a row selected with summaryColumns, followed by extra
+// columns into extra, decrypting its excerpt with keys
+func scanSummary(rows pgx.Rows, keys *ContentKeys, extra ...any) (*SnippetSummary, error) {
+	s := &SnippetSummary{}
+	var keyID *string
+	dest := append([]any{&s.ID, &s.Title, &s.Excerpt, &s.Created, &s.Expires, &s.Language, &keyID}, extra...)
+	if err := rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	content, err := keys.open(s.Excerpt, keyID)
+	if err != nil {
+		return nil, fmt.Errorf("snippet %d: %w", s.ID, err)
+	}
+	s.Excerpt = excerpt(content)
+	return s, nil
+}
+
+// excerpt returns the first ExcerptLines lines of content, up to
+// ExcerptLength characters, marking where it was cut short
+func excerpt(content string) string {
+	cut := false
+
+	if runes := []rune(content); len(runes) > ExcerptLength {
+		content, cut = string(runes[:ExcerptLength]), true
+	}
+	if lines := strings.SplitN(content, "\n", ExcerptLines+1); len(lines) > ExcerptLines {
+		content, cut = strings.Join(lines[:ExcerptLines], "\n"), true
+	}
+
+	content = strings.TrimRight(content, " \t\r\n")
+	if cut {
+		content += "…"
+	}
+	return content
+}
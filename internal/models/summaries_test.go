@@ -0,0 +1,69 @@
+package models
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/query"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestExcerpt(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"Short", "An old silent pond...\n", "An old silent pond..."},
+		{"Many lines", "one\ntwo\nthree\nfour\n", "one\ntwo\nthree…"},
+		{"Exactly enough lines", "one\ntwo\nthree", "one\ntwo\nthree"},
+		{"Long line", strings.Repeat("é", 250), strings.Repeat("é", 200) + "…"},
+		{"Exactly long enough", strings.Repeat("a", 200), strings.Repeat("a", 200)},
+		{"Empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, excerpt(tt.content), tt.want)
+		})
+	}
+}
+
+func TestSnippetModelLatestExcerpt(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users")
+	m := SnippetModel{DB: db}
+
+	_, err := m.Insert(1, netip.Addr{}, "Long", strings.Repeat("x", 5000), 7, false, SnippetLimits{})
+	assert.NilError(t, err)
+
+	snippets, err := m.Latest(t.Context())
+	assert.NilError(t, err)
+	assert.Equal(t, len(snippets), 1)
+	assert.Equal(t, snippets[0].Title, "Long")
+	assert.Equal(t, snippets[0].Excerpt, strings.Repeat("x", ExcerptLength)+"…")
+}
+
+func TestSnippetModelSearchHeadline(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users")
+	m := SnippetModel{DB: db}
+
+	content := "An old silent pond\nA frog jumps into the pond\nSplash! Silence again\x02"
+	_, err := m.Insert(1, netip.Addr{}, "Haiku", content, 7, false, SnippetLimits{})
+	assert.NilError(t, err)
+
+	snippets, total, err := m.Search(t.Context(), query.Query{Text: "frog"}, 10, 0)
+	assert.NilError(t, err)
+	assert.Equal(t, total, 1)
+	assert.StringContains(t, snippets[0].Headline, HighlightStart+"frog"+HighlightEnd)
+
+	// Stray markers in the content are dropped, so the only ones left are
+	// around the match
+	assert.Equal(t, strings.Count(snippets[0].Headline, HighlightStart), 1)
+}
@@ -6,17 +6,256 @@ created TIMESTAMP NOT NULL,
 expires TIMESTAMP NOT NULL
 );
 CREATE INDEX idx_snippets_created ON snippets(created);
+ALTER TABLE snippets ALTER COLUMN content SET STORAGE EXTERNAL;
 CREATE TABLE users (
 id SERIAL PRIMARY KEY,
 name VARCHAR(255) NOT NULL,
 email VARCHAR(255) NOT NULL,
 hashed_password CHAR(60) NOT NULL,
-created TIMESTAMP NOT NULL
+created TIMESTAMP NOT NULL,
+locale VARCHAR(10) NOT NULL DEFAULT '',
+theme VARCHAR(10) NOT NULL DEFAULT '',
+role VARCHAR(20) NOT NULL DEFAULT 'user'
 );
 ALTER TABLE users ADD CONSTRAINT users_uc_email UNIQUE (email);
-INSERT INTO users (name, email, hashed_password, created) VALUES (
-'Alice Jones',
-'alice@example.com',
-'$2a$12$NuTjWXm3KKntReFwyBVHyuf/to.HEwTy.eS206TNfkGfr6HzGJSWG',
-'2022-01-01 10:00:00'
+CREATE TABLE jobs (
+id SERIAL PRIMARY KEY,
+kind VARCHAR(50) NOT NULL,
+payload JSONB NOT NULL,
+status VARCHAR(20) NOT NULL DEFAULT 'pending',
+attempts INTEGER NOT NULL DEFAULT 0,
+max_attempts INTEGER NOT NULL,
+last_error TEXT NOT NULL DEFAULT '',
+run_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+updated TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_jobs_status_run_at ON jobs (status, run_at);
+CREATE TABLE notification_preferences (
+user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+kind VARCHAR(30) NOT NULL,
+enabled BOOLEAN NOT NULL,
+PRIMARY KEY (user_id, kind)
+);
+CREATE TABLE snippet_views (
+snippet_id INTEGER NOT NULL REFERENCES snippets (id) ON DELETE CASCADE,
+day DATE NOT NULL,
+views INTEGER NOT NULL DEFAULT 0,
+PRIMARY KEY (snippet_id, day)
+);
+ALTER TABLE snippets ADD COLUMN user_id INTEGER REFERENCES users (id) ON DELETE SET NULL;
+CREATE INDEX idx_snippets_user_created ON snippets (user_id, created);
+CREATE TABLE snippet_quotas (
+user_id INTEGER PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+per_hour INTEGER NOT NULL,
+total INTEGER NOT NULL
+);
+CREATE TABLE ip_bans (
+id SERIAL PRIMARY KEY,
+network CIDR NOT NULL,
+reason VARCHAR(255) NOT NULL,
+created TIMESTAMP NOT NULL,
+expires TIMESTAMP,
+created_by INTEGER REFERENCES users (id) ON DELETE SET NULL
+);
+ALTER TABLE snippets ADD COLUMN held BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN banned BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE TABLE snippet_reports (
+snippet_id INTEGER NOT NULL REFERENCES snippets (id) ON DELETE CASCADE,
+user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+reason VARCHAR(20) NOT NULL,
+created TIMESTAMP NOT NULL,
+PRIMARY KEY (snippet_id, user_id)
+);
+CREATE TABLE audit_log (
+id BIGSERIAL PRIMARY KEY,
+actor_id INTEGER REFERENCES users (id) ON DELETE SET NULL,
+action VARCHAR(50) NOT NULL,
+target VARCHAR(100) NOT NULL,
+detail TEXT NOT NULL DEFAULT '',
+created TIMESTAMP NOT NULL
+);
+ALTER TABLE snippets ADD COLUMN creator_ip INET;
+CREATE TABLE follows (
+follower_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+followed_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+created TIMESTAMP NOT NULL,
+PRIMARY KEY (follower_id, followed_id),
+CHECK (follower_id <> followed_id)
+);
+CREATE INDEX idx_follows_followed ON follows (followed_id);
+CREATE TABLE notifications (
+id BIGSERIAL PRIMARY KEY,
+user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+kind VARCHAR(30) NOT NULL,
+actor_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+link TEXT NOT NULL,
+detail TEXT NOT NULL DEFAULT '',
+created TIMESTAMP NOT NULL,
+read BOOLEAN NOT NULL DEFAULT false
+);
+CREATE INDEX idx_notifications_user ON notifications (user_id, id DESC);
+CREATE TABLE snippet_tags (
+snippet_id INTEGER NOT NULL REFERENCES snippets (id) ON DELETE CASCADE,
+tag VARCHAR(30) NOT NULL,
+PRIMARY KEY (snippet_id, tag)
+);
+CREATE INDEX idx_snippet_tags_tag ON snippet_tags (tag);
+CREATE TABLE subscriptions (
+id SERIAL PRIMARY KEY,
+user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+kind VARCHAR(10) NOT NULL CHECK (kind IN ('search', 'tag')),
+query VARCHAR(100) NOT NULL,
+email BOOLEAN NOT NULL DEFAULT false,
+created TIMESTAMP NOT NULL,
+start_id INTEGER NOT NULL,
+emailed_id INTEGER NOT NULL,
+UNIQUE (user_id, kind, query)
+);
+ALTER TABLE snippets ADD COLUMN private BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE snippets ADD COLUMN share_version INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE snippets ADD COLUMN encrypted BOOLEAN NOT NULL DEFAULT false;
+
+ALTER TABLE snippets ADD COLUMN content_key TEXT;
+
+CREATE TABLE snippet_changes (
+id BIGSERIAL PRIMARY KEY,
+snippet_id INTEGER NOT NULL,
+actor_id INTEGER REFERENCES users (id) ON DELETE SET NULL,
+actor_ip INET,
+action VARCHAR(20) NOT NULL,
+before JSONB,
+after JSONB,
+created TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_snippet_changes_snippet ON snippet_changes (snippet_id, id);
+ALTER TABLE users ADD COLUMN saml_subject VARCHAR(255);
+CREATE UNIQUE INDEX idx_users_saml_subject ON users (saml_subject);
+ALTER TABLE users ADD COLUMN active BOOLEAN NOT NULL DEFAULT true;
+ALTER TABLE users ADD COLUMN tier VARCHAR(20) NOT NULL DEFAULT 'free';
+CREATE TABLE idempotency_keys (
+scope VARCHAR(64) NOT NULL,
+key VARCHAR(255) NOT NULL,
+snippet_id INTEGER,
+created TIMESTAMP NOT NULL,
+PRIMARY KEY (scope, key)
+);
+CREATE INDEX idx_idempotency_keys_created ON idempotency_keys (created);
+ALTER TABLE users ADD COLUMN password_peppered BOOLEAN NOT NULL DEFAULT false;
+CREATE TABLE api_tokens (
+id SERIAL PRIMARY KEY,
+user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+name VARCHAR(50) NOT NULL,
+token_hash BYTEA NOT NULL UNIQUE,
+prefix VARCHAR(12) NOT NULL,
+created TIMESTAMP NOT NULL,
+last_used TIMESTAMP
+);
+CREATE INDEX idx_api_tokens_user ON api_tokens (user_id);
+CREATE TABLE login_events (
+id BIGSERIAL PRIMARY KEY,
+user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+ip INET,
+user_agent VARCHAR(255) NOT NULL,
+country CHAR(2),
+new_device BOOLEAN NOT NULL,
+new_country BOOLEAN NOT NULL,
+confirmed BOOLEAN NOT NULL,
+created TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_login_events_user ON login_events (user_id, created);
+ALTER TABLE users ADD COLUMN confirm_new_devices BOOLEAN NOT NULL DEFAULT false;
+CREATE TABLE announcements (
+id SERIAL PRIMARY KEY,
+message VARCHAR(500) NOT NULL,
+level VARCHAR(10) NOT NULL CHECK (level IN ('info', 'warning', 'critical')),
+starts TIMESTAMP NOT NULL,
+ends TIMESTAMP,
+created TIMESTAMP NOT NULL,
+created_by INTEGER REFERENCES users (id) ON DELETE SET NULL
+);
+ALTER TABLE snippets ADD COLUMN language VARCHAR(20) NOT NULL DEFAULT '';
+CREATE INDEX idx_snippets_language ON snippets (language);
+CREATE TABLE trending_snippets (
+snippet_id INTEGER PRIMARY KEY REFERENCES snippets (id) ON DELETE CASCADE,
+score DOUBLE PRECISION NOT NULL,
+computed TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_trending_snippets_score ON trending_snippets (score);
+CREATE TABLE github_tokens (
+user_id INTEGER PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+token TEXT NOT NULL,
+token_key VARCHAR(32),
+login VARCHAR(100) NOT NULL,
+created TIMESTAMP NOT NULL
+);
+CREATE TABLE snippet_gists (
+snippet_id INTEGER PRIMARY KEY REFERENCES snippets (id) ON DELETE CASCADE,
+user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+gist_id VARCHAR(100) NOT NULL DEFAULT '',
+url TEXT NOT NULL DEFAULT '',
+sync BOOLEAN NOT NULL DEFAULT false,
+synced TIMESTAMP
+);
+ALTER TABLE snippets ADD COLUMN source VARCHAR(255) NOT NULL DEFAULT '';
+CREATE TABLE attachments (
+id SERIAL PRIMARY KEY,
+snippet_id INTEGER NOT NULL REFERENCES snippets (id) ON DELETE CASCADE,
+object_key VARCHAR(255) NOT NULL UNIQUE,
+filename VARCHAR(255) NOT NULL,
+content_type VARCHAR(100) NOT NULL,
+size BIGINT NOT NULL,
+created TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_attachments_snippet_id ON attachments (snippet_id);
+CREATE TABLE avatars (
+user_id INTEGER PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+version INTEGER NOT NULL,
+updated TIMESTAMP NOT NULL
+);
+ALTER TABLE jobs ADD COLUMN progress_done INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE jobs ADD COLUMN progress_total INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE snippets ADD COLUMN search_vector TSVECTOR;
+CREATE INDEX idx_snippets_search_vector ON snippets USING GIN (search_vector);
+CREATE FUNCTION snippet_search_vector(title TEXT, content TEXT, content_key TEXT, encrypted BOOLEAN)
+RETURNS TSVECTOR AS $$
+SELECT setweight(to_tsvector('simple', title), 'A') ||
+CASE WHEN content_key IS NULL AND NOT encrypted
+THEN setweight(to_tsvector('simple', left(content, 262144)), 'B')
+ELSE ''::TSVECTOR
+END
+$$ LANGUAGE SQL IMMUTABLE;
+CREATE FUNCTION snippets_search_vector_trigger() RETURNS TRIGGER AS $$
+BEGIN
+NEW.search_vector := snippet_search_vector(NEW.title, NEW.content, NEW.content_key, NEW.encrypted);
+RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER snippets_search_vector
+BEFORE INSERT OR UPDATE OF title, content, content_key, encrypted ON snippets
+FOR EACH ROW EXECUTE FUNCTION snippets_search_vector_trigger();
+CREATE TABLE sessions (
+token TEXT PRIMARY KEY,
+data BYTEA NOT NULL,
+expiry TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX sessions_expiry_idx ON sessions (expiry);
+CREATE TABLE outbox (
+id SERIAL PRIMARY KEY,
+kind VARCHAR(50) NOT NULL,
+payload JSONB NOT NULL,
+attempts INTEGER NOT NULL DEFAULT 0,
+last_error TEXT NOT NULL DEFAULT '',
+created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+delivered TIMESTAMP
+);
+CREATE INDEX idx_outbox_pending ON outbox (id) WHERE delivered IS NULL;
+CREATE TABLE page_views (
+day DATE NOT NULL,
+page VARCHAR(100) NOT NULL,
+referrer VARCHAR(20) NOT NULL,
+views INTEGER NOT NULL DEFAULT 0,
+PRIMARY KEY (day, page, referrer)
 );
+ALTER TABLE users ADD COLUMN credential_version INTEGER NOT NULL DEFAULT 0;
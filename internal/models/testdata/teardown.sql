@@ -1,2 +0,0 @@
-DROP TABLE users;
-DROP TABLE snippets;
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =============================================================================
+// API Token Model - Type Definitions
+// =============================================================================
+
+const (
+	// APITokenPrefix starts every API token, so leaked tokens are easy to
+	// recognise and search for
+	APITokenPrefix = "sbx_"
+
+	// apiTokenShown is how much of a token is kept in the clear, so users can
+	// tell their tokens apart
+	apiTokenShown = 12
+)
+
+// APIToken is a personal access token for the JSON API. The token itself is
+// only known when it is created; only its hash is stored.
+type APIToken struct {
+	ID       int
+	UserID   int
+	Name     string
+	Prefix   string // First characters of the token
+	Created  time.Time
+	LastUsed time.Time // Zero if never used
+}
+
+// APITokenModelInterface defines the interface for API token operations
+type APITokenModelInterface interface {
+	Insert(userID int, name string) (string, int, error)
+	Authenticate(token string) (int, error)
+	List(userID int) ([]*APIToken, error)
+	Delete(userID, id int) error
+}
+
+// APITokenModel wraps a database connection pool
+type APITokenModel struct {
+	DB *pgxpool.Pool
+}
+
+// hashAPIToken returns the hash a token is stored and looked up by. Tokens
+// are random, so a fast unsalted hash is enough.
+func hashAPIToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// =============================================================================
+// API Token Model - Methods
+// =============================================================================
+
+// Insert creates a token for a user. Returns the token, which can't be
+// recovered later, and its ID, or ErrDuplicateToken should the token's
+// hash collide with another's.
+func (m *APITokenModel) Insert(userID int, name string) (string, int, error) {
+	token := APITokenPrefix + rand.Text()
+
+	stmt := `INSERT INTO api_tokens (user_id, name, token_hash, prefix, created)
+             VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+             RETURNING id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int
+	err := m.DB.QueryRow(ctx, stmt, userID, name, hashAPIToken(token), token[:apiTokenShown]).Scan(&id)
+	if err != nil {
+		return "", 0, translateError(err)
+	}
+	return token, id, nil
+}
+
+// Authenticate returns the ID of the user a token belongs to, recording
+// that it was used. Returns ErrInvalidCredentials for an unknown token.
+func (m *APITokenModel) Authenticate(token string) (int, error) {
+	stmt := `UPDATE api_tokens SET last_used = CURRENT_TIMESTAMP
+             WHERE token_hash = $1
+             RETURNING user_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var userID int
+	err := m.DB.QueryRow(ctx, stmt, hashAPIToken(token)).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrInvalidCredentials
+		}
+		return 0, err
+	}
+	return userID, nil
+}
+
+// List returns a user's tokens, newest first
+func (m *APITokenModel) List(userID int) ([]*APIToken, error) {
+	stmt := `SELECT id, user_id, name, prefix, created, last_used
+             FROM api_tokens
+             WHERE user_id = $1
+             ORDER BY id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*APIToken{}
+	for rows.Next() {
+		t := &APIToken{}
+		var lastUsed *time.Time
+		err = rows.Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &t.Created, &lastUsed)
+		if err != nil {
+			return nil, err
+		}
+		if lastUsed != nil {
+			t.LastUsed = *lastUsed
+		}
+		tokens = append(tokens, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// Delete revokes one of a user's tokens. Returns ErrNoRecord if the user has
+// no such token.
+func (m *APITokenModel) Delete(userID, id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tag, err := m.DB.Exec(ctx, "DELETE FROM api_tokens WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("API token", id)
+	}
+	return nil
+}
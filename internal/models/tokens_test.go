@@ -0,0 +1,48 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
+)
+
+func TestAPITokenModel(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users")
+	m := APITokenModel{DB: db}
+
+	token, id, err := m.Insert(1, "Laptop")
+	assert.NilError(t, err)
+	if !strings.HasPrefix(token, APITokenPrefix) {
+		t.Errorf("got token %q; want prefix %q", token, APITokenPrefix)
+	}
+
+	tokens, err := m.List(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(tokens), 1)
+	assert.Equal(t, tokens[0].ID, id)
+	assert.Equal(t, tokens[0].Prefix, token[:apiTokenShown])
+	assert.Equal(t, tokens[0].LastUsed.IsZero(), true)
+
+	// The token authenticates its user and is marked used
+	userID, err := m.Authenticate(token)
+	assert.NilError(t, err)
+	assert.Equal(t, userID, 1)
+	tokens, err = m.List(1)
+	assert.NilError(t, err)
+	assert.Equal(t, tokens[0].LastUsed.IsZero(), false)
+
+	_, err = m.Authenticate(token + "x")
+	assert.Equal(t, errors.Is(err, ErrInvalidCredentials), true)
+
+	// Only the owner can revoke it
+	assert.Equal(t, errors.Is(m.Delete(3, id), ErrNoRecord), true)
+	assert.NilError(t, m.Delete(1, id))
+	_, err = m.Authenticate(token)
+	assert.Equal(t, errors.Is(err, ErrInvalidCredentials), true)
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// =============================================================================
+// Retried Transactions
+// =============================================================================
+// Transactions that touch several rows other transactions contend for, such
+// as quota checks locking their creator, can fail with a serialization
+// failure or a deadlock through no fault of their own.
+// Postgres expects the client to try again, so runInTx does, after a short
+// random wait that keeps the transactions that clashed from clashing again.
+
+const (
+	// serializationFailure is the Postgres error code for a transaction
+	// that couldn't be serialized with those running alongside it
+	serializationFailure = "40001"
+
+	// deadlockDetected is the Postgres error code for a transaction
+	// cancelled to break a deadlock
+	deadlockDetected = "40P01"
+
+	// txAttempts is how many times runInTx tries a transaction
+	txAttempts = 4
+
+	// txBackoff is the longest wait before the first retry; each retry
+	// after it may wait twice as long as the one before
+	txBackoff = 20 * time.Millisecond
+)
+
+// txBeginner starts transactions; *pgxpool.Pool is one
+type txBeginner interface {
+	BeginTx(ctx context.Context, opts pgx.TxOptions) (pgx.Tx, error)
+}
+
+// runInTx runs fn in a transaction started with opts and commits it,
+// trying again from the start if it fails with a serialization failure or
+// a deadlock. fn may run more than once, so it must not do anything outside
+// the transaction, and should set any results it returns afresh each time.
+// Other errors, including fn's own, roll the transaction back and are
+// returned as they are.
+func runInTx(ctx context.Context, db txBeginner, opts pgx.TxOptions, fn func(tx pgx.Tx) error) error {
+	var err error
+	for attempt := range txAttempts {
+		if attempt > 0 {
+			if err := sleepCtx(ctx, retryDelay(attempt)); err != nil {
+				return err
+			}
+		}
+		if err = tryTx(ctx, db, opts, fn); !retryable(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// tryTx runs fn in a transaction once, committing it if fn succeeds
+func tryTx(ctx context.Context, db txBeginner, opts pgx.TxOptions, fn func(tx pgx.Tx) error) error {
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// retryable reports whether err is worth running the transaction again for
+func retryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == serializationFailure || pgErr.Code == deadlockDetected
+}
+
+// retryDelay returns a random wait before the given retry, up to txBackoff
+// doubled for each retry before it
+func retryDelay(attempt int) time.Duration {
+	ceiling := txBackoff << (attempt - 1)
+	return rand.N(ceiling) + 1
+}
+
+// sleepCtx waits for d, or returns ctx's error if it is done first
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"adotkaya.playground/internal/assert"
+)
+
+// fakeTx is a transaction whose commit fails with the next of errs. Only
+// Commit and Rollback may be called.
+type fakeTx struct {
+	pgx.Tx
+	db *fakeBeginner
+}
+
+func (tx fakeTx) Commit(ctx context.Context) error {
+	tx.db.commits++
+	if len(tx.db.errs) == 0 {
+		return nil
+	}
+	err := tx.db.errs[0]
+	tx.db.errs = tx.db.errs[1:]
+	return err
+}
+
+func (tx fakeTx) Rollback(ctx context.Context) error { return nil }
+
+type fakeBeginner struct {
+	errs    []error
+	commits int
+}
+
+func (db *fakeBeginner) BeginTx(ctx context.Context, opts pgx.TxOptions) (pgx.Tx, error) {
+	return fakeTx{db: db}, nil
+}
+
+func TestRunInTx(t *testing.T) {
+	serialization := &pgconn.PgError{Code: serializationFailure}
+	deadlock := &pgconn.PgError{Code: deadlockDetected}
+	other := &pgconn.PgError{Code: uniqueViolation}
+
+	tests := []struct {
+		name    string
+		errs    []error
+		want    error
+		commits int
+	}{
+		{"First time", nil, nil, 1},
+		{"After a serialization failure", []error{serialization}, nil, 2},
+		{"After a deadlock", []error{deadlock, serialization}, nil, 3},
+		{"Gives up", []error{deadlock, deadlock, deadlock, deadlock, deadlock}, deadlock, txAttempts},
+		{"Other errors", []error{other}, other, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &fakeBeginner{errs: tt.errs}
+			runs := 0
+			err := runInTx(t.Context(), db, pgx.TxOptions{}, func(tx pgx.Tx) error {
+				runs++
+				return nil
+			})
+			if tt.want == nil {
+				assert.NilError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.want)
+			}
+			assert.Equal(t, db.commits, tt.commits)
+			assert.Equal(t, runs, tt.commits)
+		})
+	}
+
+	t.Run("Error from fn", func(t *testing.T) {
+		db := &fakeBeginner{}
+		err := runInTx(t.Context(), db, pgx.TxOptions{}, func(tx pgx.Tx) error { return ErrNoRecord })
+		assert.ErrorIs(t, err, ErrNoRecord)
+		assert.Equal(t, db.commits, 0)
+	})
+
+	t.Run("Context done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+		db := &fakeBeginner{errs: []error{serialization}}
+		err := runInTx(ctx, db, pgx.TxOptions{}, func(tx pgx.Tx) error { return nil })
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, db.commits, 1)
+	})
+}
+
+func TestRetryDelay(t *testing.T) {
+	for attempt := 1; attempt < txAttempts; attempt++ {
+		for range 100 {
+			d := retryDelay(attempt)
+			if d <= 0 || d > txBackoff<<(attempt-1) {
+				t.Fatalf("retryDelay(%d) = %s", attempt, d)
+			}
+		}
+	}
+}
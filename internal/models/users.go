@@ -3,13 +3,10 @@ package models
 import (
 	"context"
 	"errors"
-	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // =============================================================================
@@ -23,18 +20,66 @@ type User struct {
 	Email          string
 	HashedPassword []byte
 	Created        time.Time
+	Locale         string // Preferred UI locale, empty if never chosen
+	Theme          string // Preferred colour theme, empty to follow the OS
+	Role           string // RoleUser, RoleModerator or RoleAdmin
+	Active         bool   // False once deactivated by the identity provider
+	Tier           string // Plan the user is on, e.g. TierFree
+
+	// ConfirmNewDevices requires logins from unfamiliar devices to be
+	// confirmed by email
+	ConfirmNewDevices bool
+
+	// CredentialVersion is bumped each time the password changes, so
+	// sessions logged in with an older password can be ended
+	CredentialVersion int
+}
+
+// User roles
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator" // Works the moderation queue
+	RoleAdmin     = "admin"
+)
+
+// Built-in tiers. Others may be configured; their names are stored as is.
+const (
+	TierFree = "free" // Every new user
+	TierPro  = "pro"
+)
+
+// HasRole reports whether the user has the given role. Admins have every
+// role.
+func (u *User) HasRole(role string) bool {
+	return u.Role == role || u.Role == RoleAdmin
 }
 
 // UserModelInterface defines the interface for user operations
 type UserModelInterface interface {
 	Insert(name, email, password string) error
 	Authenticate(email, password string) (int, error)
+	AuthenticateSSO(subject, email, name string) (int, error)
 	Exists(id int) (bool, error)
+	Get(id int) (*User, error)
+	SetLocale(id int, locale string) error
+	SetTheme(id int, theme string) error
+	SetConfirmNewDevices(id int, confirm bool) error
+	NotificationPreferences(id int) (map[string]bool, error)
+	SetNotificationPreference(id int, kind string, enabled bool) error
+	NotificationSubscribers(kind string) ([]int, error)
+	SnippetQuota(id int) (SnippetLimits, error)
+	SetTier(id int, tier string) error
+	Provision(name, email string, active bool) (int, error)
+	Account(id int) (*User, error)
+	Accounts(email string, offset, limit int) ([]*User, int, error)
+	UpdateAccount(id int, name, email string, active bool) error
+	PasswordUpdate(id int, currentPassword, newPassword string) error
 }
 
 // UserModel wraps a database connection pool
 type UserModel struct {
-	DB *pgxpool.Pool
+	DB        *pgxpool.Pool
+	Passwords PasswordHasher
 }
 
 // =============================================================================
@@ -43,34 +88,25 @@ type UserModel struct {
 
 // Insert creates a new user account in the database
 //
-// The password will be hashed using bcrypt (cost 12) before storage.
-// Returns ErrDuplicateEmail if the email address is already in use.
+// The password will be hashed using bcrypt, with the configured cost and
+// pepper, before storage. Returns ErrDuplicateEmail if the email address
+// is already in use.
 func (m *UserModel) Insert(name, email, password string) error {
-	// Hash the plain-text password using bcrypt with cost factor 12
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	hashedPassword, peppered, err := m.Passwords.hash(password)
 	if err != nil {
 		return err
 	}
 
-	stmt := `INSERT INTO users (name, email, hashed_password, created)
-             VALUES ($1, $2, $3, CURRENT_TIMESTAMP)`
+	stmt := `INSERT INTO users (name, email, hashed_password, password_peppered, created)
+             VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	// Attempt to insert the user record
-	_, err = m.DB.Exec(ctx, stmt, name, email, string(hashedPassword))
+	_, err = m.DB.Exec(ctx, stmt, name, email, string(hashedPassword), peppered)
 	if err != nil {
-		// Check if the error is a PostgreSQL unique constraint violation
-		var pgError *pgconn.PgError
-		if errors.As(err, &pgError) {
-			// Error code 23505 is unique_violation
-			// Check if it's specifically for the email constraint
-			if pgError.Code == "23505" && strings.Contains(pgError.Message, "users_uc_email") {
-				return ErrDuplicateEmail
-			}
-		}
-		return err
+		return translateError(err)
 	}
 
 	return nil
@@ -78,19 +114,23 @@ func (m *UserModel) Insert(name, email, password string) error {
 
 // Authenticate verifies user credentials and returns the user ID
 //
-// Returns ErrInvalidCredentials if the email doesn't exist or the password
-// doesn't match. On success, returns the user's ID.
+// Returns ErrInvalidCredentials if the email doesn't exist, the password
+// doesn't match or the user is banned or deactivated, and ErrPepperMissing
+// if the password was hashed with a pepper that is no longer configured.
+// On success, returns the user's ID. A hash made with another cost or
+// pepper than configured is replaced, now that the password is known.
 func (m *UserModel) Authenticate(email, password string) (int, error) {
 	var id int
 	var hashedPassword []byte
+	var peppered bool
 
 	// Retrieve the user ID and hashed password for the given email
-	stmt := "SELECT id, hashed_password FROM users WHERE email = $1"
+	stmt := "SELECT id, hashed_password, password_peppered FROM users WHERE email = $1 AND NOT banned AND active"
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRow(ctx, stmt, email).Scan(&id, &hashedPassword)
+	err := m.DB.QueryRow(ctx, stmt, email).Scan(&id, &hashedPassword, &peppered)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			// No user found with this email
@@ -100,26 +140,171 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 	}
 
 	// Compare the provided password with the stored hash
-	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+	if err = m.Passwords.check(hashedPassword, peppered, password); err != nil {
+		return 0, err
+	}
+
+	if m.Passwords.needsRehash(hashedPassword, peppered) {
+		if err = m.rehash(id, hashedPassword, password); err != nil {
+			return 0, err
+		}
+	}
+
+	// Authentication successful
+	return id, nil
+}
+
+// rehash replaces a user's password hash with one made with the configured
+// parameters, unless the password changed since old was read
+func (m *UserModel) rehash(id int, old []byte, password string) error {
+	hashedPassword, peppered, err := m.Passwords.hash(password)
 	if err != nil {
-		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
-			// Password doesn't match
+		return err
+	}
+
+	stmt := `UPDATE users SET hashed_password = $3, password_peppered = $4
+             WHERE id = $1 AND hashed_password = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.Exec(ctx, stmt, id, string(old), string(hashedPassword), peppered)
+	return err
+}
+
+// PasswordUpdate changes a user's password to newPassword, hashed with the
+// configured cost and pepper, once currentPassword has been checked against
+// the one stored. The user's CredentialVersion is bumped and their API
+// tokens are deleted, so whoever knew the old password is shut out. Returns
+// ErrInvalidCredentials if it doesn't match, or if the password was
+// changed elsewhere meanwhile, and ErrNoRecord if there is no such user.
+func (m *UserModel) PasswordUpdate(id int, currentPassword, newPassword string) error {
+	var hashedPassword []byte
+	var peppered bool
+
+	stmt := "SELECT hashed_password, password_peppered FROM users WHERE id = $1"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRow(ctx, stmt, id).Scan(&hashedPassword, &peppered)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return notFound("user", id)
+		}
+		return err
+	}
+
+	if err = m.Passwords.check(hashedPassword, peppered, currentPassword); err != nil {
+		return err
+	}
+
+	newHash, newPeppered, err := m.Passwords.hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	// Only replace the hash that was checked
+	stmt = `UPDATE users SET hashed_password = $3, password_peppered = $4,
+                             credential_version = credential_version + 1
+            WHERE id = $1 AND hashed_password = $2`
+
+	return runInTx(ctx, m.DB, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, stmt, id, string(hashedPassword), string(newHash), newPeppered)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrInvalidCredentials
+		}
+		_, err = tx.Exec(ctx, "DELETE FROM api_tokens WHERE user_id = $1", id)
+		return err
+	})
+}
+
+// AuthenticateSSO returns the ID of the user an identity provider has
+// vouched for, identified by its subject (NameID)
+//
+// The first sign-in links the subject to the account with the same email
+// address or, if there is none, creates one just in time. The new account
+// gets a random password, so it can only sign in through the identity
+// provider. Returns ErrInvalidCredentials if the user is banned or
+// deactivated, or their email address is already linked to a different
+// subject, and ErrDuplicateSubject or ErrDuplicateEmail if a sign-in
+// running at the same time linked or created the account first.
+func (m *UserModel) AuthenticateSSO(subject, email, name string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var id int
+	var banned, active bool
+	var linked *string
+
+	// Returning users are found by their subject, even if their email
+	// address has changed at the identity provider
+	err = tx.QueryRow(ctx, "SELECT id, banned, active FROM users WHERE saml_subject = $1", subject).Scan(&id, &banned, &active)
+	switch {
+	case err == nil:
+		if banned || !active {
 			return 0, ErrInvalidCredentials
 		}
+		return id, nil
+	case !errors.Is(err, pgx.ErrNoRows):
 		return 0, err
 	}
 
-	// Authentication successful
+	stmt := "SELECT id, banned, active, saml_subject FROM users WHERE email = $1 FOR UPDATE"
+	err = tx.QueryRow(ctx, stmt, email).Scan(&id, &banned, &active, &linked)
+	switch {
+	case err == nil:
+		if banned || !active || linked != nil {
+			return 0, ErrInvalidCredentials
+		}
+		_, err = tx.Exec(ctx, "UPDATE users SET saml_subject = $1 WHERE id = $2", subject, id)
+	case errors.Is(err, pgx.ErrNoRows):
+		id, err = m.provision(ctx, tx, subject, email, name)
+	}
+	if err != nil {
+		return 0, translateError(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, err
+	}
 	return id, nil
 }
 
+// provision creates an account for a user signing in through single
+// sign-on for the first time
+func (m *UserModel) provision(ctx context.Context, tx pgx.Tx, subject, email, name string) (int, error) {
+	hashedPassword, err := unusablePassword()
+	if err != nil {
+		return 0, err
+	}
+
+	stmt := `INSERT INTO users (name, email, hashed_password, saml_subject, created)
+             VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+             RETURNING id`
+
+	var id int
+	err = tx.QueryRow(ctx, stmt, name, email, string(hashedPassword), subject).Scan(&id)
+	return id, err
+}
+
 // Exists checks whether a user with the given ID exists in the database
 //
-// Returns true if the user exists, false otherwise
+// Returns true if the user exists and isn't banned or deactivated, false
+// otherwise
 func (m *UserModel) Exists(id int) (bool, error) {
 	var exists bool
 
-	stmt := "SELECT EXISTS(SELECT true FROM users WHERE id = $1)"
+	stmt := "SELECT EXISTS(SELECT true FROM users WHERE id = $1 AND NOT banned AND active)"
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -127,3 +312,78 @@ func (m *UserModel) Exists(id int) (bool, error) {
 	err := m.DB.QueryRow(ctx, stmt, id).Scan(&exists)
 	return exists, err
 }
+
+// Get retrieves a user by ID (without the password hash)
+//
+// Returns ErrNoRecord if no user with the given ID exists or the user is
+// banned or deactivated, so their sessions stop authenticating
+func (m *UserModel) Get(id int) (*User, error) {
+	stmt := `SELECT id, name, email, created, locale, theme, role, active, tier, confirm_new_devices, credential_version
+             FROM users WHERE id = $1 AND NOT banned AND active`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	u := &User{}
+	err := m.DB.QueryRow(ctx, stmt, id).Scan(&u.ID, &u.Name, &u.Email, &u.Created, &u.Locale, &u.Theme, &u.Role, &u.Active, &u.Tier, &u.ConfirmNewDevices, &u.CredentialVersion)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, notFound("user", id)
+		}
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// SetLocale stores the user's preferred UI locale
+func (m *UserModel) SetLocale(id int, locale string) error {
+	stmt := "UPDATE users SET locale = $1 WHERE id = $2"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, stmt, locale, id)
+	return err
+}
+
+// SetTheme stores the user's preferred colour theme
+func (m *UserModel) SetTheme(id int, theme string) error {
+	stmt := "UPDATE users SET theme = $1 WHERE id = $2"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, stmt, theme, id)
+	return err
+}
+
+// SetConfirmNewDevices turns on or off the user's requirement to confirm
+// logins from unfamiliar devices by email
+func (m *UserModel) SetConfirmNewDevices(id int, confirm bool) error {
+	stmt := "UPDATE users SET confirm_new_devices = $1 WHERE id = $2"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, stmt, confirm, id)
+	return err
+}
+
+// SetTier moves a user to another tier. Returns ErrNoRecord if there is no
+// such user.
+func (m *UserModel) SetTier(id int, tier string) error {
+	stmt := "UPDATE users SET tier = $2 WHERE id = $1"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tag, err := m.DB.Exec(ctx, stmt, id, tier)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("user", id)
+	}
+	return nil
+}
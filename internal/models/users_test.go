@@ -1,9 +1,11 @@
 package models
 
 import (
+	"context"
 	"testing"
 
 	"adotkaya.playground/internal/assert"
+	"adotkaya.playground/internal/testutil"
 )
 
 func TestUserModelExists(t *testing.T) {
@@ -31,8 +33,9 @@ func TestUserModelExists(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-
+			t.Parallel()
 			db := newTestDB(t)
+			testutil.LoadFixtures(t, db, "users")
 			// Create a new instance of the UserModel.
 			m := UserModel{DB: db}
 
@@ -42,3 +45,184 @@ func TestUserModelExists(t *testing.T) {
 		})
 	}
 }
+
+func TestUserModelNotificationPreferences(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users")
+	m := UserModel{DB: db}
+
+	// Defaults apply until a preference is saved
+	prefs, err := m.NotificationPreferences(1)
+	assert.NilError(t, err)
+	assert.Equal(t, prefs[NotifyComments], true)
+	assert.Equal(t, prefs[NotifyAnnouncements], false)
+
+	assert.NilError(t, m.SetNotificationPreference(1, NotifyComments, false))
+	assert.NilError(t, m.SetNotificationPreference(1, NotifyAnnouncements, true))
+	assert.NilError(t, m.SetNotificationPreference(1, NotifyAnnouncements, true))
+
+	prefs, err = m.NotificationPreferences(1)
+	assert.NilError(t, err)
+	assert.Equal(t, prefs[NotifyComments], false)
+	assert.Equal(t, prefs[NotifyFollowers], true)
+	assert.Equal(t, prefs[NotifyAnnouncements], true)
+}
+
+func TestUserModelNotificationSubscribers(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users")
+	m := UserModel{DB: db}
+
+	assert.NilError(t, m.SetNotificationPreference(1, NotifyComments, false))
+	assert.NilError(t, m.SetNotificationPreference(3, NotifyDigest, true))
+
+	// Opted out of a default-on kind
+	ids, err := m.NotificationSubscribers(NotifyComments)
+	assert.NilError(t, err)
+	assert.Equal(t, len(ids), 1)
+	assert.Equal(t, ids[0], 3)
+
+	// Opted in to an opt-in kind
+	ids, err = m.NotificationSubscribers(NotifyDigest)
+	assert.NilError(t, err)
+	assert.Equal(t, len(ids), 1)
+	assert.Equal(t, ids[0], 3)
+}
+
+func TestUserModelAuthenticateSSO(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users")
+	m := UserModel{DB: db}
+
+	// The first sign-in links an existing account by email address
+	id, err := m.AuthenticateSSO("idp|alice", "alice@example.com", "Alice")
+	assert.NilError(t, err)
+	assert.Equal(t, id, 1)
+
+	// Later sign-ins find it by subject, whatever the email address
+	id, err = m.AuthenticateSSO("idp|alice", "alice@corp.example.com", "Alice")
+	assert.NilError(t, err)
+	assert.Equal(t, id, 1)
+
+	// Another subject can't take over a linked account
+	_, err = m.AuthenticateSSO("idp|mallory", "alice@example.com", "Mallory")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// New users get an account that can't log in with a password
+	id, err = m.AuthenticateSSO("idp|dave", "dave@example.com", "Dave")
+	assert.NilError(t, err)
+	user, err := m.Get(id)
+	assert.NilError(t, err)
+	assert.Equal(t, user.Name, "Dave")
+	assert.Equal(t, user.Role, RoleUser)
+	_, err = m.Authenticate("dave@example.com", "")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	again, err := m.AuthenticateSSO("idp|dave", "dave@example.com", "Dave")
+	assert.NilError(t, err)
+	assert.Equal(t, again, id)
+
+	// Banned users are turned away
+	_, err = db.Exec(context.Background(), "UPDATE users SET banned = true WHERE id = $1", id)
+	assert.NilError(t, err)
+	_, err = m.AuthenticateSSO("idp|dave", "dave@example.com", "Dave")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestUserModelSetTier(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users")
+	m := UserModel{DB: db}
+
+	user, err := m.Get(1)
+	assert.NilError(t, err)
+	assert.Equal(t, user.Tier, TierFree)
+
+	assert.NilError(t, m.SetTier(1, TierPro))
+	user, err = m.Get(1)
+	assert.NilError(t, err)
+	assert.Equal(t, user.Tier, TierPro)
+
+	assert.ErrorIs(t, m.SetTier(99, TierPro), ErrNoRecord)
+}
+
+func TestUserModelAuthenticateRehash(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users")
+
+	hashOf := func(email string) (hash string, peppered bool) {
+		t.Helper()
+		err := db.QueryRow(context.Background(), "SELECT hashed_password, password_peppered FROM users WHERE email = $1", email).Scan(&hash, &peppered)
+		assert.NilError(t, err)
+		return hash, peppered
+	}
+	before, _ := hashOf("alice@example.com")
+
+	// Logging in with a new cost and pepper replaces the hash
+	m := UserModel{DB: db, Passwords: PasswordHasher{Cost: 4, Pepper: []byte("a-pepper-of-at-least-thirty-two-bytes")}}
+	id, err := m.Authenticate("alice@example.com", "pa$$word")
+	assert.NilError(t, err)
+	assert.Equal(t, id, 1)
+	after, peppered := hashOf("alice@example.com")
+	assert.Equal(t, after != before, true)
+	assert.Equal(t, peppered, true)
+
+	// The new hash works, and is kept
+	_, err = m.Authenticate("alice@example.com", "pa$$word")
+	assert.NilError(t, err)
+	again, _ := hashOf("alice@example.com")
+	assert.Equal(t, again, after)
+
+	// It needs the pepper
+	_, err = (&UserModel{DB: db}).Authenticate("alice@example.com", "pa$$word")
+	assert.ErrorIs(t, err, ErrPepperMissing)
+
+	// Failed logins change nothing
+	_, err = m.Authenticate("admin@example.com", "wrong")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, peppered = hashOf("admin@example.com")
+	assert.Equal(t, peppered, false)
+}
+
+func TestUserModelPasswordUpdate(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	testutil.LoadFixtures(t, db, "users")
+	m := UserModel{DB: db, Passwords: PasswordHasher{Cost: 4}}
+
+	// The current password has to match
+	assert.ErrorIs(t, m.PasswordUpdate(1, "wrong", "new-pa$$word"), ErrInvalidCredentials)
+	_, err := m.Authenticate("alice@example.com", "pa$$word")
+	assert.NilError(t, err)
+
+	tokens := APITokenModel{DB: db}
+	token, _, err := tokens.Insert(1, "Laptop")
+	assert.NilError(t, err)
+
+	assert.NilError(t, m.PasswordUpdate(1, "pa$$word", "new-pa$$word"))
+	_, err = m.Authenticate("alice@example.com", "pa$$word")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	id, err := m.Authenticate("alice@example.com", "new-pa$$word")
+	assert.NilError(t, err)
+	assert.Equal(t, id, 1)
+
+	// Sessions and API tokens from before the change stop working
+	user, err := m.Get(1)
+	assert.NilError(t, err)
+	assert.Equal(t, user.CredentialVersion, 1)
+	_, err = tokens.Authenticate(token)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	assert.ErrorIs(t, m.PasswordUpdate(99, "pa$$word", "new-pa$$word"), ErrNoRecord)
+}
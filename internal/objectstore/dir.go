@@ -0,0 +1,110 @@
+package objectstore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+)
+
+// =============================================================================
+// Directory Store
+// =============================================================================
+
+// Dir keeps files in a local directory, each key a path below it. It can't
+// make download links, so it only suits files the application serves
+// itself, on a single server.
+type Dir struct {
+	root string
+}
+
+// NewDir returns a store keeping files below the directory at root,
+// creating it if needed
+func NewDir(root string) (*Dir, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("objectstore: %w", err)
+	}
+	return &Dir{root: root}, nil
+}
+
+// Put writes size bytes from body to the file under key. The file is
+// written aside and renamed into place, so readers never see half of it.
+func (d *Dir) Put(key, contentType string, body io.Reader, size int64) error {
+	if !fs.ValidPath(key) || key == "." {
+		return ErrInvalidKey
+	}
+
+	root, err := os.OpenRoot(d.root)
+	if err != nil {
+		return fmt.Errorf("objectstore: %w", err)
+	}
+	defer root.Close()
+
+	if err := root.MkdirAll(path.Dir(key), 0o755); err != nil {
+		return fmt.Errorf("objectstore: %w", err)
+	}
+
+	tmp := key + ".tmp"
+	f, err := root.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("objectstore: %w", err)
+	}
+	n, err := io.Copy(f, body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n != size {
+		err = fmt.Errorf("wrote %d bytes of %d", n, size)
+	}
+	if err != nil {
+		root.Remove(tmp)
+		return fmt.Errorf("objectstore: %s: %w", key, err)
+	}
+
+	if err := root.Rename(tmp, key); err != nil {
+		return fmt.Errorf("objectstore: %w", err)
+	}
+	return nil
+}
+
+// Get opens the file under key. Returns ErrNotFound if there is none.
+func (d *Dir) Get(key string) (io.ReadCloser, error) {
+	if !fs.ValidPath(key) || key == "." {
+		return nil, ErrInvalidKey
+	}
+
+	root, err := os.OpenRoot(d.root)
+	if err != nil {
+		return nil, fmt.Errorf("objectstore: %w", err)
+	}
+	defer root.Close()
+
+	f, err := root.Open(key)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("objectstore: %w", err)
+	}
+	return f, nil
+}
+
+// Delete removes the file under key
+func (d *Dir) Delete(key string) error {
+	if !fs.ValidPath(key) || key == "." {
+		return ErrInvalidKey
+	}
+
+	root, err := os.OpenRoot(d.root)
+	if err != nil {
+		return fmt.Errorf("objectstore: %w", err)
+	}
+	defer root.Close()
+
+	err = root.Remove(key)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("objectstore: %w", err)
+	}
+	return nil
+}
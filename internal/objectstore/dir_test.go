@@ -0,0 +1,39 @@
+package objectstore
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"adotkaya.playground/internal/assert"
+)
+
+func TestDir(t *testing.T) {
+	d, err := NewDir(t.TempDir())
+	assert.NilError(t, err)
+
+	assert.NilError(t, d.Put("avatars/1/64.png", "image/png", strings.NewReader("pond"), 4))
+
+	f, err := d.Get("avatars/1/64.png")
+	assert.NilError(t, err)
+	b, err := io.ReadAll(f)
+	assert.NilError(t, err)
+	assert.NilError(t, f.Close())
+	assert.Equal(t, string(b), "pond")
+
+	// Short bodies leave nothing behind
+	err = d.Put("avatars/1/256.png", "image/png", strings.NewReader("po"), 4)
+	assert.Equal(t, err != nil, true)
+	_, err = d.Get("avatars/1/256.png")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.NilError(t, d.Delete("avatars/1/64.png"))
+	assert.NilError(t, d.Delete("avatars/1/64.png"))
+	_, err = d.Get("avatars/1/64.png")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Keys stay inside the directory
+	for _, key := range []string{"", "../escape", "/etc/passwd", "a//b"} {
+		assert.ErrorIs(t, d.Put(key, "text/plain", strings.NewReader(""), 0), ErrInvalidKey)
+	}
+}
@@ -0,0 +1,38 @@
+// Package objectstore keeps files in an S3-compatible object store, such as
+// Amazon S3 or MinIO, and hands out signed links for downloading them. Files
+// only the application serves can be kept in a local directory instead.
+package objectstore
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// =============================================================================
+// Store Interface
+// =============================================================================
+
+// Store keeps files under keys. The files are never served through the
+// application: URL returns a link to download one from the store directly.
+type Store interface {
+	// Put uploads size bytes from body under key, replacing any file there
+	Put(key, contentType string, body io.Reader, size int64) error
+
+	// Delete removes the file under key. Missing files are not an error.
+	Delete(key string) error
+
+	// URL returns a link which downloads the file under key as filename
+	// until expires has passed
+	URL(key, filename string, expires time.Duration) (string, error)
+}
+
+// Errors returned by stores
+var (
+	// ErrInvalidKey is returned for keys the store can't hold, such as
+	// empty ones
+	ErrInvalidKey = errors.New("objectstore: invalid key")
+
+	// ErrNotFound is returned when there is no file under a key
+	ErrNotFound = errors.New("objectstore: not found")
+)
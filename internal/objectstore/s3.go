@@ -0,0 +1,364 @@
+package objectstore
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// =============================================================================
+// S3 Store
+// =============================================================================
+
+// Request signing with AWS Signature Version 4
+const (
+	algorithm       = "AWS4-HMAC-SHA256"
+	unsignedPayload = "UNSIGNED-PAYLOAD" // Bodies are streamed, not hashed
+	amzDateFormat   = "20060102T150405Z"
+
+	// maxExpiry is the longest a signed URL can be valid for
+	maxExpiry = 7 * 24 * time.Hour
+
+	// maxKeyLength is the longest key S3 accepts, in bytes
+	maxKeyLength = 1024
+)
+
+// Config holds the settings of an S3-compatible store
+type Config struct {
+	// Endpoint is the service's URL, e.g. http://localhost:9000 for MinIO.
+	// Empty means Amazon S3 in Region.
+	Endpoint string
+	Region   string // Defaults to us-east-1
+	Bucket   string
+
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// PathStyle addresses the bucket in the URL's path rather than its host
+	// name, as MinIO and most other self-hosted stores need
+	PathStyle bool
+
+	Timeout time.Duration
+}
+
+// S3 is a Store keeping files in a bucket of an S3-compatible service
+type S3 struct {
+	cfg    Config
+	bucket *url.URL // Keys are appended to its path
+	client *http.Client
+	now    func() time.Time
+}
+
+// New returns an S3 store for the given configuration
+func New(cfg Config) (*S3, error) {
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = time.Minute
+	}
+	if cfg.Bucket == "" {
+		return nil, errors.New("objectstore: no bucket")
+	}
+
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("objectstore: invalid endpoint %q", endpoint)
+	}
+
+	bucket := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: strings.TrimSuffix(u.Path, "/")}
+	if cfg.PathStyle {
+		bucket.Path += "/" + cfg.Bucket
+	} else {
+		bucket.Host = cfg.Bucket + "." + u.Host
+	}
+
+	return &S3{
+		cfg:    cfg,
+		bucket: bucket,
+		client: &http.Client{Timeout: cfg.Timeout},
+		now:    time.Now,
+	}, nil
+}
+
+// Put uploads size bytes from body under key
+func (s *S3) Put(key, contentType string, body io.Reader, size int64) error {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, u.String(), body)
+	if err != nil {
+		return fmt.Errorf("objectstore: %w", err)
+	}
+	// S3 needs the length up front; it doesn't take chunked uploads
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	return s.do(req)
+}
+
+// Delete removes the file under key
+func (s *S3) Delete(key string) error {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("objectstore: %w", err)
+	}
+	return s.do(req)
+}
+
+// Get downloads the file under key. Returns ErrNotFound if there is none.
+func (s *S3) Get(key string) (io.ReadCloser, error) {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("objectstore: %w", err)
+	}
+	resp, err := s.send(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// URL returns a presigned link downloading the file under key as an
+// attachment named filename
+func (s *S3) URL(key, filename string, expires time.Duration) (string, error) {
+	if expires <= 0 || expires > maxExpiry {
+		return "", fmt.Errorf("objectstore: links can be valid for at most %s", maxExpiry)
+	}
+	u, err := s.objectURL(key)
+	if err != nil {
+		return "", err
+	}
+
+	// The store names the download, since the link doesn't pass through
+	// the application
+	query := url.Values{}
+	if disposition := mime.FormatMediaType("attachment", map[string]string{"filename": filename}); filename != "" && disposition != "" {
+		query.Set("response-content-disposition", disposition)
+	}
+
+	return s.presign(http.MethodGet, u, query, expires, s.now()), nil
+}
+
+// objectURL returns the URL of the file under key
+func (s *S3) objectURL(key string) (*url.URL, error) {
+	if key == "" || strings.HasPrefix(key, "/") || len(key) > maxKeyLength || !utf8.ValidString(key) {
+		return nil, ErrInvalidKey
+	}
+
+	u := *s.bucket
+	u.Path += "/" + key
+	u.RawPath = escape(u.Path, true)
+	return &u, nil
+}
+
+// do signs and sends req, discarding the response
+func (s *S3) do(req *http.Request) error {
+	resp, err := s.send(req)
+	if errors.Is(err, ErrNotFound) && req.Method == http.MethodDelete {
+		// Deleting a missing file is already done
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// send signs and sends req, turning error responses into errors. The
+// caller closes the body of the response returned.
+func (s *S3) send(req *http.Request) (*http.Response, error) {
+	s.sign(req, unsignedPayload, s.now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("objectstore: %w", err)
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	var body struct {
+		Code    string
+		Message string
+	}
+	xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body)
+	if body.Code == "" {
+		return nil, fmt.Errorf("objectstore: %s %s: %s", req.Method, req.URL.Path, resp.Status)
+	}
+	return nil, fmt.Errorf("objectstore: %s %s: %s: %s", req.Method, req.URL.Path, body.Code, body.Message)
+}
+
+// =============================================================================
+// Signature Version 4
+// =============================================================================
+
+// sign adds an Authorization header to req covering its headers, which
+// should all be set by now
+func (s *S3) sign(req *http.Request, payloadHash string, t time.Time) {
+	req.Header.Set("X-Amz-Date", t.UTC().Format(amzDateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	values := map[string]string{"host": host}
+	for name, v := range req.Header {
+		values[strings.ToLower(name)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var headers strings.Builder
+	for _, name := range names {
+		headers.WriteString(name + ":" + values[name] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		canonicalURI(req.URL),
+		canonicalQuery(req.URL.Query()),
+		headers.String(),
+		signed,
+		payloadHash,
+	}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s,SignedHeaders=%s,Signature=%s",
+		algorithm, s.cfg.AccessKeyID, s.scope(t), signed, s.signature(t, canonical)))
+}
+
+// presign returns u with query and a signature for method added, valid
+// from t until expires has passed
+func (s *S3) presign(method string, u *url.URL, query url.Values, expires time.Duration, t time.Time) string {
+	query.Set("X-Amz-Algorithm", algorithm)
+	query.Set("X-Amz-Credential", s.cfg.AccessKeyID+"/"+s.scope(t))
+	query.Set("X-Amz-Date", t.UTC().Format(amzDateFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires/time.Second)))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	canonical := strings.Join([]string{
+		method,
+		canonicalURI(u),
+		canonicalQuery(query),
+		"host:" + u.Host + "\n",
+		"host",
+		unsignedPayload,
+	}, "\n")
+
+	signed := *u
+	signed.RawQuery = canonicalQuery(query) + "&X-Amz-Signature=" + s.signature(t, canonical)
+	return signed.String()
+}
+
+// scope returns the credential scope of requests signed at t
+func (s *S3) scope(t time.Time) string {
+	return t.UTC().Format("20060102") + "/" + s.cfg.Region + "/s3/aws4_request"
+}
+
+// signature signs canonicalRequest with a key derived for the day of t
+func (s *S3) signature(t time.Time, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := algorithm + "\n" + t.UTC().Format(amzDateFormat) + "\n" + s.scope(t) + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretAccessKey), t.UTC().Format("20060102"))
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalURI returns the path of u, escaped once as S3 expects
+func canonicalURI(u *url.URL) string {
+	if u.Path == "" {
+		return "/"
+	}
+	return escape(u.Path, true)
+}
+
+// canonicalQuery returns query escaped and sorted by name, then value
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	pairs := []string{}
+	for _, name := range names {
+		values := slices.Clone(query[name])
+		slices.Sort(values)
+		for _, v := range values {
+			pairs = append(pairs, escape(name, false)+"="+escape(v, false))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// escape percent-encodes every byte of s but unreserved characters and,
+// in paths, slashes
+func escape(s string, path bool) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~', path && c == '/':
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hexDigits[c>>4])
+			b.WriteByte(hexDigits[c&15])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,197 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// =============================================================================
+// Search Queries
+// =============================================================================
+// A search query is words to look for, mixed with filters narrowing the
+// results, such as:
+//
+//	handler title:http lang:go tag:networking created:>2024-01-01
+//
+// Filters are a field name, a colon and a value. Values and words can be
+// double-quoted to include spaces, and a quoted word is never a filter, so
+// "http://example.com" is searched for rather than read as an http filter.
+// The filters are:
+//
+//   - title:WORD     the title contains WORD, ignoring case; can repeat
+//   - lang:LANGUAGE  the language guessed from the content, e.g. go
+//   - tag:TAG        the snippet has TAG; can repeat
+//   - created:DATE   created on DATE, as YYYY-MM-DD in UTC. DATE can follow
+//     >, >=, < or <= for after, on or after, before and on or before it;
+//     repeating it narrows the range.
+
+// Query is a parsed search query
+type Query struct {
+	Text     string    // Words to search for, outside any filter
+	Title    []string  // Text the title must contain, ignoring case
+	Language string    // Language identifier, empty for any
+	Tags     []string  // Tags the snippet must have, lowercase
+	After    time.Time // Created at or after this; zero for no limit
+	Before   time.Time // Created before this; zero for no limit
+}
+
+// Errors wrapped by Error, saying what is wrong with a term
+var (
+	ErrUnknownField  = errors.New("unknown filter")
+	ErrEmptyValue    = errors.New("filter without a value")
+	ErrBadDate       = errors.New("malformed date")
+	ErrUnclosedQuote = errors.New("unclosed quote")
+	ErrRepeated      = errors.New("filter can only be given once")
+)
+
+// Error is a syntax error in a search query
+type Error struct {
+	Term string // The offending term
+	Err  error  // One of the Err* values
+}
+
+func (e *Error) Error() string { return fmt.Sprintf("query: %s: %q", e.Err, e.Term) }
+func (e *Error) Unwrap() error { return e.Err }
+
+// IsZero reports whether the query has no words or filters, so would match
+// everything
+func (q Query) IsZero() bool {
+	return q.Text == "" && len(q.Title) == 0 && q.Language == "" && len(q.Tags) == 0 &&
+		q.After.IsZero() && q.Before.IsZero()
+}
+
+// =============================================================================
+// Parsing
+// =============================================================================
+
+// Parse parses a search query. The error, if any, is an *Error.
+func Parse(s string) (Query, error) {
+	terms, err := split(s)
+	if err != nil {
+		return Query{}, err
+	}
+
+	var q Query
+	var words []string
+	for _, term := range terms {
+		field, value, isFilter := cutField(term)
+		if !isFilter {
+			words = append(words, unquote(term))
+			continue
+		}
+		if value == "" {
+			return Query{}, &Error{Term: term, Err: ErrEmptyValue}
+		}
+
+		switch field {
+		case "title":
+			q.Title = append(q.Title, value)
+		case "lang", "language":
+			if q.Language != "" {
+				return Query{}, &Error{Term: term, Err: ErrRepeated}
+			}
+			q.Language = strings.ToLower(value)
+		case "tag":
+			q.Tags = append(q.Tags, strings.ToLower(strings.TrimPrefix(value, "#")))
+		case "created":
+			if err := q.addCreated(value); err != nil {
+				return Query{}, &Error{Term: term, Err: err}
+			}
+		default:
+			return Query{}, &Error{Term: term, Err: ErrUnknownField}
+		}
+	}
+
+	q.Text = strings.Join(words, " ")
+	return q, nil
+}
+
+// split splits s into terms at whitespace outside double quotes. The quotes
+// are kept.
+func split(s string) ([]string, error) {
+	var terms []string
+	var term strings.Builder
+	quoted := false
+
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			term.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if term.Len() > 0 {
+				terms = append(terms, term.String())
+				term.Reset()
+			}
+		default:
+			term.WriteRune(r)
+		}
+	}
+	if quoted {
+		return nil, &Error{Term: term.String(), Err: ErrUnclosedQuote}
+	}
+	if term.Len() > 0 {
+		terms = append(terms, term.String())
+	}
+	return terms, nil
+}
+
+// cutField splits a filter term into its lowercased field name and
+// unquoted value. Terms starting with a quote or without a field name
+// before a colon aren't filters.
+func cutField(term string) (field, value string, ok bool) {
+	field, value, ok = strings.Cut(term, ":")
+	if !ok || field == "" || strings.ContainsFunc(field, func(r rune) bool { return !unicode.IsLetter(r) }) {
+		return "", "", false
+	}
+	return strings.ToLower(field), unquote(value), true
+}
+
+// unquote removes the double quotes from a term
+func unquote(term string) string {
+	return strings.TrimSpace(strings.ReplaceAll(term, `"`, ""))
+}
+
+// addCreated narrows the creation date range by a created filter's value
+func (q *Query) addCreated(value string) error {
+	op := strings.TrimRight(value, "0123456789-")
+	day, err := time.Parse(time.DateOnly, value[len(op):])
+	if err != nil {
+		return ErrBadDate
+	}
+	next := day.AddDate(0, 0, 1)
+
+	switch op {
+	case "":
+		q.after(day)
+		q.before(next)
+	case ">":
+		q.after(next)
+	case ">=":
+		q.after(day)
+	case "<":
+		q.before(day)
+	case "<=":
+		q.before(next)
+	default:
+		return ErrBadDate
+	}
+	return nil
+}
+
+// after raises the start of the creation date range to t
+func (q *Query) after(t time.Time) {
+	if t.After(q.After) {
+		q.After = t
+	}
+}
+
+// before lowers the end of the creation date range to t
+func (q *Query) before(t time.Time) {
+	if q.Before.IsZero() || t.Before(q.Before) {
+		q.Before = t
+	}
+}
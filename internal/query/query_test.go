@@ -0,0 +1,92 @@
+package query
+
+import (
+	"testing"
+	"time"
+
+	"adotkaya.playground/internal/assert"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  Query
+	}{
+		{name: "Empty", query: "  ", want: Query{}},
+		{name: "Words", query: "old  silent pond", want: Query{Text: "old silent pond"}},
+		{
+			name:  "Filters",
+			query: "handler title:http LANG:Go tag:#Networking created:>2024-01-01",
+			want: Query{
+				Text:     "handler",
+				Title:    []string{"http"},
+				Language: "go",
+				Tags:     []string{"networking"},
+				After:    date("2024-01-02"),
+			},
+		},
+		{
+			name:  "Quoted",
+			query: `title:"silent pond" "http://example.com" frog`,
+			want:  Query{Text: "http://example.com frog", Title: []string{"silent pond"}},
+		},
+		{name: "Repeated tags", query: "tag:go tag:http", want: Query{Tags: []string{"go", "http"}}},
+		{name: "Single day", query: "created:2024-03-17", want: Query{After: date("2024-03-17"), Before: date("2024-03-18")}},
+		{
+			name:  "Date range",
+			query: "created:>=2024-01-01 created:<=2024-01-31 created:>2023-06-01",
+			want:  Query{After: date("2024-01-01"), Before: date("2024-02-01")},
+		},
+		{name: "Before", query: "created:<2024-01-01", want: Query{Before: date("2024-01-01")}},
+		{name: "Not a field", query: "12:30 c++:templates :pond", want: Query{Text: "12:30 c++:templates :pond"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := Parse(tt.query)
+			assert.NilError(t, err)
+			assert.DeepEqual(t, q, tt.want)
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		wantTerm string
+		wantErr  error
+	}{
+		{"Unknown field", "pond author:alice", "author:alice", ErrUnknownField},
+		{"URL", "http://example.com", "http://example.com", ErrUnknownField},
+		{"Empty value", "tag: pond", "tag:", ErrEmptyValue},
+		{"Bad date", "created:yesterday", "created:yesterday", ErrBadDate},
+		{"Bad operator", "created:=>2024-01-01", "created:=>2024-01-01", ErrBadDate},
+		{"Unclosed quote", `title:"silent pond`, `title:"silent pond`, ErrUnclosedQuote},
+		{"Two languages", "lang:go lang:rust", "lang:rust", ErrRepeated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.query)
+			assert.ErrorIs(t, err, tt.wantErr)
+
+			var qerr *Error
+			assert.ErrorAs(t, err, &qerr)
+			assert.Equal(t, qerr.Term, tt.wantTerm)
+		})
+	}
+}
+
+func TestQueryIsZero(t *testing.T) {
+	assert.Equal(t, Query{}.IsZero(), true)
+	assert.Equal(t, Query{Tags: []string{"go"}}.IsZero(), false)
+	assert.Equal(t, Query{Before: date("2024-01-01")}.IsZero(), false)
+}
@@ -0,0 +1,156 @@
+package testutil
+
+import (
+	"bytes"
+	"html"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+)
+
+// =============================================================================
+// Test Server
+// =============================================================================
+
+// Server is a TLS test server with a client that keeps cookies between
+// requests (so sessions persist) and doesn't follow redirects (so tests can
+// check them)
+type Server struct {
+	*httptest.Server
+}
+
+// Response is the part of an HTTP response tests usually check
+type Response struct {
+	Status int
+	Header http.Header
+	Body   string
+}
+
+// NewServer starts a Server for h, closed automatically when the test ends
+func NewServer(t testing.TB, h http.Handler) *Server {
+	t.Helper()
+
+	ts := httptest.NewTLSServer(h)
+	t.Cleanup(ts.Close)
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Client().Jar = jar
+
+	ts.Client().CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return &Server{ts}
+}
+
+// =============================================================================
+// Requests
+// =============================================================================
+
+// NewRequest builds a request for urlPath on the server, for cases that need
+// custom headers before calling Do
+func (s *Server) NewRequest(t testing.TB, method, urlPath string, body io.Reader) *http.Request {
+	t.Helper()
+
+	req, err := http.NewRequest(method, s.URL+urlPath, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+// Do sends req with the server's client and reads the whole response
+func (s *Server) Do(t testing.TB, req *http.Request) Response {
+	t.Helper()
+
+	rs, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return Response{
+		Status: rs.StatusCode,
+		Header: rs.Header,
+		Body:   string(body),
+	}
+}
+
+// Get fetches urlPath
+func (s *Server) Get(t testing.TB, urlPath string) Response {
+	t.Helper()
+
+	return s.Do(t, s.NewRequest(t, http.MethodGet, urlPath, nil))
+}
+
+// PostForm posts form to urlPath exactly as given, with a same-origin
+// Referer as a browser would send
+func (s *Server) PostForm(t testing.TB, urlPath string, form url.Values) Response {
+	t.Helper()
+
+	req := s.NewRequest(t, http.MethodPost, urlPath, bytes.NewBufferString(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Referer", s.URL+urlPath)
+
+	return s.Do(t, req)
+}
+
+// =============================================================================
+// User Scenarios
+// =============================================================================
+
+// Submit behaves like a user filling in a form: it loads pagePath, takes the
+// CSRF token from it and posts form (plus the token) to actionPath
+func (s *Server) Submit(t testing.TB, pagePath, actionPath string, form url.Values) Response {
+	t.Helper()
+
+	page := s.Get(t, pagePath)
+
+	values := url.Values{}
+	for k, v := range form {
+		values[k] = v
+	}
+	values.Set("csrf_token", ExtractCSRFToken(t, page.Body))
+
+	return s.PostForm(t, actionPath, values)
+}
+
+// Login signs in through the login form, failing the test unless it
+// succeeds. The session cookie is kept for the rest of the test.
+func (s *Server) Login(t testing.TB, email, password string) {
+	t.Helper()
+
+	form := url.Values{}
+	form.Add("email", email)
+	form.Add("password", password)
+
+	rs := s.Submit(t, "/user/login", "/user/login", form)
+	if rs.Status != http.StatusSeeOther {
+		t.Fatalf("login as %s: got status %d; expected %d", email, rs.Status, http.StatusSeeOther)
+	}
+}
+
+var csrfTokenRX = regexp.MustCompile(`<input type="hidden" name="csrf_token" value="(.+)" />`)
+
+// ExtractCSRFToken returns the CSRF token embedded in an HTML form in body
+func ExtractCSRFToken(t testing.TB, body string) string {
+	t.Helper()
+
+	matches := csrfTokenRX.FindStringSubmatch(body)
+	if len(matches) < 2 {
+		t.Fatal("no csrf token found in body")
+	}
+	return html.UnescapeString(matches[1])
+}
@@ -0,0 +1,40 @@
+// Package testutil holds helpers shared by the model, handler and end-to-end
+// tests.
+package testutil
+
+import (
+	"context"
+	"embed"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =============================================================================
+// Database Fixtures
+// =============================================================================
+
+// fixtureFiles holds the SQL fixtures, one file per table (users, snippets).
+// Each file inserts rows with fixed IDs and then moves the table's sequence
+// past them, so rows inserted by the test itself don't collide.
+//
+//go:embed "fixtures/*.sql"
+var fixtureFiles embed.FS
+
+// LoadFixtures inserts the named fixtures (e.g. "users", "snippets") into db
+// in the order given, failing the test if any of them is missing or fails
+func LoadFixtures(t testing.TB, db *pgxpool.Pool, names ...string) {
+	t.Helper()
+
+	for _, name := range names {
+		script, err := fixtureFiles.ReadFile("fixtures/" + name + ".sql")
+		if err != nil {
+			t.Fatalf("testutil: unknown fixture %q", name)
+		}
+
+		_, err = db.Exec(context.Background(), string(script))
+		if err != nil {
+			t.Fatalf("testutil: loading fixture %q: %v", name, err)
+		}
+	}
+}
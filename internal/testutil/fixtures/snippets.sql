@@ -0,0 +1,7 @@
+-- Times are relative to now so that the live/expired split stays stable
+INSERT INTO snippets (id, title, content, created, expires) VALUES
+(1, 'An old silent pond', E'An old silent pond...\nA frog jumps into the pond,\nsplash! Silence again.', CURRENT_TIMESTAMP - INTERVAL '2 days', CURRENT_TIMESTAMP + INTERVAL '363 days'),
+(2, 'Over the wintry forest', E'Over the wintry\nforest, winds howl in rage\nwith no leaves to blow.', CURRENT_TIMESTAMP - INTERVAL '1 day', CURRENT_TIMESTAMP + INTERVAL '6 days'),
+(3, 'First autumn morning', E'First autumn morning\nthe mirror I stare into\nshows my father''s face.', CURRENT_TIMESTAMP - INTERVAL '8 days', CURRENT_TIMESTAMP - INTERVAL '1 day');
+
+SELECT setval(pg_get_serial_sequence('snippets', 'id'), (SELECT MAX(id) FROM snippets));
@@ -0,0 +1,6 @@
+-- Alice and Carol both use the password "pa$$word"; Carol is an admin
+INSERT INTO users (id, name, email, hashed_password, created, role) VALUES
+(1, 'Alice Jones', 'alice@example.com', '$2a$12$NuTjWXm3KKntReFwyBVHyuf/to.HEwTy.eS206TNfkGfr6HzGJSWG', '2022-01-01 10:00:00', 'user'),
+(3, 'Carol Admin', 'admin@example.com', '$2a$12$NuTjWXm3KKntReFwyBVHyuf/to.HEwTy.eS206TNfkGfr6HzGJSWG', '2022-01-01 10:00:00', 'admin');
+
+SELECT setval(pg_get_serial_sequence('users', 'id'), (SELECT MAX(id) FROM users));
@@ -78,6 +78,11 @@ func MaxChars(value string, n int) bool {
 	return utf8.RuneCountInString(value) <= n
 }
 
+// MaxBytes returns true if a value is no more than n bytes long
+func MaxBytes(value string, n int) bool {
+	return len(value) <= n
+}
+
 // PermittedValue returns true if a value matches one of the permitted values
 //
 // Uses Go generics to work with any comparable type (strings, ints, etc.)
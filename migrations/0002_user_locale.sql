@@ -0,0 +1,2 @@
+-- Preferred UI locale; empty means "detect from the browser"
+ALTER TABLE users ADD COLUMN locale VARCHAR(10) NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- Preferred colour theme ("light" or "dark"); empty means follow the OS
+ALTER TABLE users ADD COLUMN theme VARCHAR(10) NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- Account role: "user" or "admin"
+ALTER TABLE users ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user';
@@ -0,0 +1,8 @@
+-- Per-user email notification opt-ins. A missing row means the kind's
+-- default applies (see models.DefaultNotificationPreference).
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    kind VARCHAR(30) NOT NULL,
+    enabled BOOLEAN NOT NULL,
+    PRIMARY KEY (user_id, kind)
+);
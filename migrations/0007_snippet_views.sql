@@ -0,0 +1,9 @@
+-- Daily view counts per snippet, for popularity statistics
+CREATE TABLE IF NOT EXISTS snippet_views (
+    snippet_id INTEGER NOT NULL REFERENCES snippets (id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    views INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (snippet_id, day)
+);
+
+CREATE INDEX IF NOT EXISTS idx_snippet_views_day ON snippet_views (day);
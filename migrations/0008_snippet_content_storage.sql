@@ -0,0 +1,4 @@
+-- Store large snippet content uncompressed out of line, so substr() reads
+-- only the TOAST chunks it needs when content is streamed in pieces.
+-- Applies to content written from now on.
+ALTER TABLE snippets ALTER COLUMN content SET STORAGE EXTERNAL;
@@ -0,0 +1,12 @@
+-- Record who created each snippet. Snippets created before this migration
+-- have no owner.
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES users (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_snippets_user_created ON snippets (user_id, created);
+
+-- Per-user overrides of the configured snippet limits. Zero means no limit.
+CREATE TABLE IF NOT EXISTS snippet_quotas (
+    user_id INTEGER PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    per_hour INTEGER NOT NULL,
+    total INTEGER NOT NULL
+);
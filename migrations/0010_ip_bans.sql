@@ -0,0 +1,11 @@
+-- Banned client addresses. Single IPs are stored as /32 or /128 networks.
+CREATE TABLE IF NOT EXISTS ip_bans (
+    id SERIAL PRIMARY KEY,
+    network CIDR NOT NULL,
+    reason VARCHAR(255) NOT NULL,
+    created TIMESTAMP NOT NULL,
+    expires TIMESTAMP, -- NULL for permanent bans
+    created_by INTEGER REFERENCES users (id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_ip_bans_expires ON ip_bans (expires);
@@ -0,0 +1,27 @@
+-- Snippets held for moderation are hidden from everyone until approved
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS held BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Banned users can't log in and their sessions stop working
+ALTER TABLE users ADD COLUMN IF NOT EXISTS banned BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Reports of spam or abuse, one per user per snippet
+CREATE TABLE IF NOT EXISTS snippet_reports (
+    snippet_id INTEGER NOT NULL REFERENCES snippets (id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    reason VARCHAR(20) NOT NULL,
+    created TIMESTAMP NOT NULL,
+    PRIMARY KEY (snippet_id, user_id)
+);
+
+-- Record of moderation and admin actions. Target is free text (e.g.
+-- "snippet:42") so entries outlive the things they refer to.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    actor_id INTEGER REFERENCES users (id) ON DELETE SET NULL,
+    action VARCHAR(50) NOT NULL,
+    target VARCHAR(100) NOT NULL,
+    detail TEXT NOT NULL DEFAULT '',
+    created TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_created ON audit_log (created);
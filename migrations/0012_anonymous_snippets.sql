@@ -0,0 +1,5 @@
+-- Address of the creator of an anonymous snippet, for their quota. Not
+-- recorded for snippets created by users.
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS creator_ip INET;
+
+CREATE INDEX IF NOT EXISTS idx_snippets_creator_ip_created ON snippets (creator_ip, created) WHERE user_id IS NULL;
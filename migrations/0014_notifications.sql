@@ -0,0 +1,15 @@
+-- In-app notifications, shown on the notifications page with an unread
+-- count in the nav. Emails for the same events respect
+-- notification_preferences; these rows are always recorded.
+CREATE TABLE IF NOT EXISTS notifications (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    kind VARCHAR(30) NOT NULL,
+    actor_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    link TEXT NOT NULL,
+    detail TEXT NOT NULL DEFAULT '',
+    created TIMESTAMP NOT NULL,
+    read BOOLEAN NOT NULL DEFAULT false
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications (user_id, id DESC);
@@ -0,0 +1,23 @@
+-- Snippet tags, and users' saved searches and tag subscriptions.
+CREATE TABLE IF NOT EXISTS snippet_tags (
+    snippet_id INTEGER NOT NULL REFERENCES snippets (id) ON DELETE CASCADE,
+    tag VARCHAR(30) NOT NULL,
+    PRIMARY KEY (snippet_id, tag)
+);
+
+CREATE INDEX IF NOT EXISTS idx_snippet_tags_tag ON snippet_tags (tag);
+
+-- start_id is the newest snippet when the subscription was made, so only
+-- snippets created since are listed. emailed_id is the newest snippet
+-- already emailed about.
+CREATE TABLE IF NOT EXISTS subscriptions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    kind VARCHAR(10) NOT NULL CHECK (kind IN ('search', 'tag')),
+    query VARCHAR(100) NOT NULL,
+    email BOOLEAN NOT NULL DEFAULT false,
+    created TIMESTAMP NOT NULL,
+    start_id INTEGER NOT NULL,
+    emailed_id INTEGER NOT NULL,
+    UNIQUE (user_id, kind, query)
+);
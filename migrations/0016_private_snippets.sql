@@ -0,0 +1,4 @@
+-- Private snippets are only visible to their owner and through signed share
+-- links. Incrementing share_version revokes all links issued so far.
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS private BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS share_version INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+-- Encrypted snippets are encrypted in the browser. content holds the
+-- ciphertext (title and content together) and title is left empty; the key
+-- only ever appears in the URL fragment.
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS encrypted BOOLEAN NOT NULL DEFAULT false;
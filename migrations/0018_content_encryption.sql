@@ -0,0 +1,3 @@
+-- Snippet content can be encrypted at rest by the application. content_key
+-- is the ID of the key sealing the content, or NULL for plaintext.
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS content_key TEXT;
@@ -0,0 +1,15 @@
+-- Who created, edited or deleted each snippet, with its metadata before and
+-- after, for admins. snippet_id has no foreign key so the history outlives
+-- the snippet. actor_ip is recorded for anonymous visitors only.
+CREATE TABLE IF NOT EXISTS snippet_changes (
+    id BIGSERIAL PRIMARY KEY,
+    snippet_id INTEGER NOT NULL,
+    actor_id INTEGER REFERENCES users (id) ON DELETE SET NULL,
+    actor_ip INET,
+    action VARCHAR(20) NOT NULL,
+    before JSONB,
+    after JSONB,
+    created TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_snippet_changes_snippet ON snippet_changes (snippet_id, id);
@@ -0,0 +1,5 @@
+-- Users signing in through SAML single sign-on are matched by the subject
+-- (NameID) the identity provider asserts for them. NULL for everyone else.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS saml_subject VARCHAR(255);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_saml_subject ON users (saml_subject);
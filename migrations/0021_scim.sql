@@ -0,0 +1,4 @@
+-- Identity providers can deactivate users through SCIM. Unlike a ban,
+-- deactivation can be undone by the identity provider and leaves the user's
+-- snippets visible.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS active BOOLEAN NOT NULL DEFAULT true;
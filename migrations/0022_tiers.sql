@@ -0,0 +1,3 @@
+-- Plan each user is on. The limits of each tier are configured in the
+-- application; per-user overrides in snippet_quotas still apply.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tier VARCHAR(20) NOT NULL DEFAULT 'free';
@@ -0,0 +1,10 @@
+-- Idempotency keys sent with snippet submissions, and the snippet each one
+-- created. snippet_id is NULL while the first submission is in progress.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    scope VARCHAR(64) NOT NULL,
+    key VARCHAR(255) NOT NULL,
+    snippet_id INTEGER,
+    created TIMESTAMP NOT NULL,
+    PRIMARY KEY (scope, key)
+);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created ON idempotency_keys (created);
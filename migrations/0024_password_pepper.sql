@@ -0,0 +1,3 @@
+-- Whether each password hash was made with the configured pepper, so
+-- hashes made before one was configured can still be checked
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_peppered BOOLEAN NOT NULL DEFAULT false;
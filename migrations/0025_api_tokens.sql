@@ -0,0 +1,14 @@
+-- Personal access tokens for the JSON API. Only a SHA-256 hash of each
+-- token is kept; prefix is its first characters, shown so users can tell
+-- their tokens apart.
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    token_hash BYTEA NOT NULL UNIQUE,
+    prefix VARCHAR(12) NOT NULL,
+    created TIMESTAMP NOT NULL,
+    last_used TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user ON api_tokens (user_id);
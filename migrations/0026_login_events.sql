@@ -0,0 +1,19 @@
+-- Password logins, kept to recognise the devices and countries users sign
+-- in from. confirmed is false while a login from an unfamiliar device
+-- awaits confirmation by email.
+CREATE TABLE IF NOT EXISTS login_events (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    ip INET,
+    user_agent VARCHAR(255) NOT NULL,
+    country CHAR(2),
+    new_device BOOLEAN NOT NULL,
+    new_country BOOLEAN NOT NULL,
+    confirmed BOOLEAN NOT NULL,
+    created TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_events_user ON login_events (user_id, created);
+
+-- Whether logins from unfamiliar devices must be confirmed by email
+ALTER TABLE users ADD COLUMN IF NOT EXISTS confirm_new_devices BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,11 @@
+-- Site-wide banners announcing maintenance windows and incidents. A banner
+-- shows from starts until ends, or until it is deleted if ends is NULL.
+CREATE TABLE IF NOT EXISTS announcements (
+    id SERIAL PRIMARY KEY,
+    message VARCHAR(500) NOT NULL,
+    level VARCHAR(10) NOT NULL CHECK (level IN ('info', 'warning', 'critical')),
+    starts TIMESTAMP NOT NULL,
+    ends TIMESTAMP,
+    created TIMESTAMP NOT NULL,
+    created_by INTEGER REFERENCES users (id) ON DELETE SET NULL
+);
@@ -0,0 +1,4 @@
+-- The language a snippet's content is written in, guessed on insert and
+-- edit. Empty when there's no clear guess or the content is encrypted.
+ALTER TABLE snippets ADD COLUMN language VARCHAR(20) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_snippets_language ON snippets (language);
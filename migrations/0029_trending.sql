@@ -0,0 +1,8 @@
+-- Trending scores, recomputed every hour by a background job so the home
+-- page's Trending tab reads a handful of rows instead of aggregating views
+CREATE TABLE IF NOT EXISTS trending_snippets (
+    snippet_id INTEGER PRIMARY KEY REFERENCES snippets (id) ON DELETE CASCADE,
+    score DOUBLE PRECISION NOT NULL,
+    computed TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_trending_snippets_score ON trending_snippets (score);
@@ -0,0 +1,21 @@
+-- GitHub tokens users connect to push snippets to Gists. token is sealed
+-- with the content keys when they are configured; token_key is the sealing
+-- key's ID, NULL for a plaintext token.
+CREATE TABLE IF NOT EXISTS github_tokens (
+    user_id INTEGER PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    token TEXT NOT NULL,
+    token_key VARCHAR(32),
+    login VARCHAR(100) NOT NULL,
+    created TIMESTAMP NOT NULL
+);
+
+-- Snippets pushed to a Gist. gist_id is empty until the push job has
+-- created the Gist; with sync set, edits are pushed to it too.
+CREATE TABLE IF NOT EXISTS snippet_gists (
+    snippet_id INTEGER PRIMARY KEY REFERENCES snippets (id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    gist_id VARCHAR(100) NOT NULL DEFAULT '',
+    url TEXT NOT NULL DEFAULT '',
+    sync BOOLEAN NOT NULL DEFAULT false,
+    synced TIMESTAMP
+);
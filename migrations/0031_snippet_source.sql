@@ -0,0 +1,4 @@
+-- Where imported snippets came from: the URL of the Pastebin or GitLab
+-- page they were fetched from, shown on the snippet page. Empty for
+-- snippets created here.
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS source VARCHAR(255) NOT NULL DEFAULT '';
@@ -0,0 +1,14 @@
+-- Files attached to snippets. The files themselves are in the object
+-- store under object_key; the filename is the one they were uploaded
+-- with, given back on download.
+CREATE TABLE IF NOT EXISTS attachments (
+    id SERIAL PRIMARY KEY,
+    snippet_id INTEGER NOT NULL REFERENCES snippets (id) ON DELETE CASCADE,
+    object_key VARCHAR(255) NOT NULL UNIQUE,
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    created TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachments_snippet_id ON attachments (snippet_id);
@@ -0,0 +1,8 @@
+-- Avatars users uploaded. The resized pictures are in the avatar store,
+-- named by version, which goes up with each upload so old copies cached
+-- by browsers are never mistaken for the new one.
+CREATE TABLE IF NOT EXISTS avatars (
+    user_id INTEGER PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    updated TIMESTAMP NOT NULL
+);
@@ -0,0 +1,34 @@
+-- How far a running job has got, for jobs that report it, such as the
+-- maintenance an admin can start
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS progress_done INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS progress_total INTEGER NOT NULL DEFAULT 0;
+
+-- Full-text search index. A snippet's vector holds its title, and its
+-- content unless that is sealed at rest or encrypted, and a trigger keeps
+-- it up to date. Existing snippets start without one until the search
+-- index is rebuilt from the admin maintenance page or with
+-- `web maintenance reindex`. Only the first 256 KB of content is indexed,
+-- well within the limit on a tsvector's size.
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS search_vector TSVECTOR;
+CREATE INDEX IF NOT EXISTS idx_snippets_search_vector ON snippets USING GIN (search_vector);
+
+CREATE OR REPLACE FUNCTION snippet_search_vector(title TEXT, content TEXT, content_key TEXT, encrypted BOOLEAN)
+RETURNS TSVECTOR AS $$
+    SELECT setweight(to_tsvector('simple', title), 'A') ||
+        CASE WHEN content_key IS NULL AND NOT encrypted
+             THEN setweight(to_tsvector('simple', left(content, 262144)), 'B')
+             ELSE ''::TSVECTOR
+        END
+$$ LANGUAGE SQL IMMUTABLE;
+
+CREATE OR REPLACE FUNCTION snippets_search_vector_trigger() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.search_vector := snippet_search_vector(NEW.title, NEW.content, NEW.content_key, NEW.encrypted);
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS snippets_search_vector ON snippets;
+CREATE TRIGGER snippets_search_vector
+    BEFORE INSERT OR UPDATE OF title, content, content_key, encrypted ON snippets
+    FOR EACH ROW EXECUTE FUNCTION snippets_search_vector_trigger();
@@ -0,0 +1,14 @@
+-- Events written in the same transaction as the change they describe, such
+-- as a follow, and delivered afterwards by the outbox relay. An event is
+-- delivered exactly once, whenever the process stops. Delivered events are
+-- kept until maintenance vacuums them.
+CREATE TABLE IF NOT EXISTS outbox (
+    id SERIAL PRIMARY KEY,
+    kind VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    delivered TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox (id) WHERE delivered IS NULL;
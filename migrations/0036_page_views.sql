@@ -0,0 +1,11 @@
+-- Views of each page of the site per day, counted by the analytics beacon.
+-- Pages are route patterns, such as /snippet/view/:id, and referrers are
+-- only classed (direct, internal, search, social or other): nothing about
+-- the visitor is stored.
+CREATE TABLE IF NOT EXISTS page_views (
+    day DATE NOT NULL,
+    page VARCHAR(100) NOT NULL,
+    referrer VARCHAR(20) NOT NULL,
+    views INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, page, referrer)
+);
@@ -0,0 +1,3 @@
+-- Bumped when a user's password changes. Sessions remember the version
+-- they logged in with, and those with an older one are logged out.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS credential_version INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,11 @@
+package migrations
+
+import (
+	"embed"
+)
+
+// Files holds the numbered SQL migrations (NNNN_description.sql), applied in
+// order by internal/migrate
+//
+//go:embed "*.sql"
+var Files embed.FS
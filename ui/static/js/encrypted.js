@@ -0,0 +1,105 @@
+// Encrypted snippets. The title and content are sealed with a fresh AES-GCM
+// key before posting, and the key is only ever put in the URL fragment,
+// which browsers never send to the server.
+
+function toBase64URL(bytes) {
+	var s = "";
+	for (var i = 0; i < bytes.length; i++) {
+		s += String.fromCharCode(bytes[i]);
+	}
+	return btoa(s).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+}
+
+function fromBase64URL(s) {
+	var bin = atob(s.replace(/-/g, "+").replace(/_/g, "/"));
+	var bytes = new Uint8Array(bin.length);
+	for (var i = 0; i < bin.length; i++) {
+		bytes[i] = bin.charCodeAt(i);
+	}
+	return bytes;
+}
+
+// seal encrypts the snippet, returning the ciphertext (IV then sealed data)
+// and the key, both base64url encoded
+async function seal(title, content) {
+	var key = await crypto.subtle.generateKey({ name: "AES-GCM", length: 256 }, true, ["encrypt"]);
+	var iv = crypto.getRandomValues(new Uint8Array(12));
+	var plaintext = new TextEncoder().encode(JSON.stringify({ title: title, content: content }));
+	var sealed = new Uint8Array(await crypto.subtle.encrypt({ name: "AES-GCM", iv: iv }, key, plaintext));
+
+	var payload = new Uint8Array(iv.length + sealed.length);
+	payload.set(iv);
+	payload.set(sealed, iv.length);
+	var raw = new Uint8Array(await crypto.subtle.exportKey("raw", key));
+	return { ciphertext: toBase64URL(payload), key: toBase64URL(raw) };
+}
+
+// unseal decrypts a snippet sealed by seal
+async function unseal(ciphertext, key) {
+	var payload = fromBase64URL(ciphertext);
+	var k = await crypto.subtle.importKey("raw", fromBase64URL(key), "AES-GCM", false, ["decrypt"]);
+	var plaintext = await crypto.subtle.decrypt({ name: "AES-GCM", iv: payload.slice(0, 12) }, k, payload.slice(12));
+	return JSON.parse(new TextDecoder().decode(plaintext));
+}
+
+// Creating: post only the ciphertext. The server answers like it does htmx,
+// with the new snippet's URL in HX-Redirect or the re-rendered form.
+document.addEventListener("submit", async function (e) {
+	var form = e.target;
+	if (!form.matches("form.encrypt")) {
+		return;
+	}
+	e.preventDefault();
+
+	var title = form.querySelector("#encrypt-title").value;
+	var content = form.querySelector("#encrypt-content").value;
+	var sealed = await seal(title, content);
+
+	var body = new URLSearchParams(new FormData(form));
+	body.set("ciphertext", sealed.ciphertext);
+	var rs = await fetch(form.action, { method: "POST", body: body, headers: { "HX-Request": "true" } });
+
+	var next = rs.headers.get("HX-Redirect");
+	if (rs.ok && next) {
+		window.location.assign(next + "#" + sealed.key);
+		return;
+	}
+
+	// Keep what was typed, which the server never saw
+	var holder = document.createElement("div");
+	holder.innerHTML = await rs.text();
+	var replacement = holder.querySelector("form.encrypt");
+	if (replacement) {
+		replacement.querySelector("#encrypt-title").value = title;
+		replacement.querySelector("#encrypt-content").value = content;
+		form.replaceWith(replacement);
+	}
+});
+
+// Viewing: decrypt with the key from the fragment
+(async function () {
+	var el = document.getElementById("decrypt");
+	if (!el) {
+		return;
+	}
+
+	var status = el.querySelector(".decrypt-status");
+	var key = window.location.hash.slice(1);
+	if (!key) {
+		status.textContent = el.dataset.missingKey;
+		return;
+	}
+
+	var snippet;
+	try {
+		snippet = await unseal(el.dataset.ciphertext, key);
+	} catch (err) {
+		status.textContent = el.dataset.wrongKey;
+		return;
+	}
+
+	el.querySelector(".decrypted-title").textContent = snippet.title;
+	el.querySelector(".decrypted-content").textContent = snippet.content;
+	el.querySelector(".snippet").hidden = false;
+	status.hidden = true;
+})();
@@ -5,4 +5,71 @@ for (var i = 0; i < navLinks.length; i++) {
 		link.classList.add("live");
 		break;
 	}
-}
\ No newline at end of file
+}
+
+// Prepend snippets created elsewhere to the latest snippets list as they
+// are announced, keeping the list at most as long as it was
+var snippetList = document.getElementById("snippet-list");
+if (snippetList && snippetList.dataset.events && window.EventSource) {
+	var listLength = snippetList.querySelectorAll("tr").length - 1;
+	var events = new EventSource(snippetList.dataset.events);
+	events.addEventListener("snippet", function (e) {
+		var snippet = JSON.parse(e.data);
+		// htmx replaces the list when it refreshes, so look it up each time
+		var table = document.querySelector("#snippet-list table");
+		if (!table) {
+			htmx.ajax("GET", "/snippet/list", {target: "#snippet-list", swap: "outerHTML"});
+			return;
+		}
+		if (table.querySelector('a[href="/snippet/view/' + snippet.id + '"]')) {
+			return;
+		}
+
+		var row = table.insertRow(1);
+		var link = document.createElement("a");
+		link.href = "/snippet/view/" + snippet.id;
+		link.textContent = snippet.title;
+		row.insertCell().appendChild(link);
+		row.insertCell().textContent = snippet.created;
+		row.insertCell().textContent = "#" + snippet.id;
+
+		while (listLength > 0 && table.rows.length > listLength + 1) {
+			table.deleteRow(-1);
+		}
+	});
+}
+
+// Browsers don't send the fragment of a #L10-L20 link, so reload with the
+// range in the query string for the server to highlight it
+var lineRange = window.location.hash.match(/^#L(\d+)-L(\d+)$/);
+if (lineRange && document.querySelector(".snippet")) {
+	var query = new URLSearchParams(window.location.search);
+	query.set("lines", lineRange[1] + "-" + lineRange[2]);
+	window.location.replace(window.location.pathname + "?" + query.toString() + "#L" + lineRange[1]);
+}
+
+// Shift-clicking a line number selects the lines from the one in the
+// address bar to it
+var lineNumbers = document.querySelectorAll("pre.numbered a.lineno");
+for (var i = 0; i < lineNumbers.length; i++) {
+	lineNumbers[i].addEventListener("click", function (e) {
+		var from = window.location.hash.match(/^#L(\d+)$/);
+		if (!e.shiftKey || !from) {
+			return;
+		}
+		e.preventDefault();
+		var to = this.getAttribute("href").slice(2);
+		var first = Math.min(from[1], to), last = Math.max(from[1], to);
+		var query = new URLSearchParams(window.location.search);
+		query.set("lines", first + "-" + last);
+		window.location.assign(window.location.pathname + "?" + query.toString() + "#L" + first);
+	});
+}
+
+// Report the page view to the first-party analytics beacon: the page's route
+// pattern and where the visitor came from, nothing else. Visitors asking not
+// to be tracked aren't counted.
+var page = document.body.dataset.page;
+if (page && navigator.sendBeacon && navigator.doNotTrack !== "1" && !navigator.globalPrivacyControl) {
+	navigator.sendBeacon("/beacon", new URLSearchParams({page: page, referrer: document.referrer}));
+}